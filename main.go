@@ -5,6 +5,7 @@ import (
 
 	"github.com/nanobot-ai/nanobot/pkg/cli"
 	"github.com/nanobot-ai/nanobot/pkg/cmd"
+	"github.com/nanobot-ai/nanobot/pkg/codeexec"
 	"github.com/nanobot-ai/nanobot/pkg/supervise"
 )
 
@@ -15,5 +16,9 @@ func main() {
 		}
 		return
 	}
+	if len(os.Args) > 2 && os.Args[1] == codeexec.SandboxCommand {
+		codeexec.Sandbox()
+		return
+	}
 	cmd.Main(cli.New())
 }
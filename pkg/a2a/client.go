@@ -0,0 +1,175 @@
+package a2a
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// Client calls a remote agent with the JSON-RPC transport of A2A.
+type Client struct {
+	url     string
+	headers map[string]string
+	http    *http.Client
+
+	lock sync.Mutex
+	card *AgentCard
+}
+
+// NewClient returns a client for the agent at url, which is either the URL of its agent card or the URL
+// the agent card is served under.
+func NewClient(url string, headers map[string]string) *Client {
+	return &Client{
+		url:     strings.TrimSuffix(url, "/"),
+		headers: headers,
+		http:    transport.Client,
+	}
+}
+
+// Card returns the agent card of the agent, it is fetched once.
+func (c *Client) Card(ctx context.Context) (*AgentCard, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.card != nil {
+		return c.card, nil
+	}
+
+	urls := []string{c.url}
+	if !strings.HasSuffix(c.url, ".json") {
+		urls = []string{c.url + AgentCardPath, c.url + legacyAgentCardPath}
+	}
+
+	var lastErr error
+	for _, url := range urls {
+		var card AgentCard
+		if err := c.do(ctx, http.MethodGet, url, nil, &card); err != nil {
+			lastErr = err
+			continue
+		}
+		if card.URL == "" {
+			card.URL = c.url
+		}
+		c.card = &card
+		return c.card, nil
+	}
+	return nil, fmt.Errorf("failed to get agent card of %s: %w", c.url, lastErr)
+}
+
+// SendMessage sends the message and returns the reply of the agent, which is either a message or a task.
+func (c *Client) SendMessage(ctx context.Context, params MessageSendParams) (*Message, *Task, error) {
+	if params.Message.Kind == "" {
+		params.Message.Kind = "message"
+	}
+	if params.Message.MessageID == "" {
+		params.Message.MessageID = uuid.String()
+	}
+
+	var result json.RawMessage
+	if err := c.call(ctx, "message/send", params, &result); err != nil {
+		return nil, nil, err
+	}
+
+	var kind struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(result, &kind); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode result of message/send: %w", err)
+	}
+
+	switch kind.Kind {
+	case "message":
+		var msg Message
+		if err := json.Unmarshal(result, &msg); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode message: %w", err)
+		}
+		return &msg, nil, nil
+	case "task":
+		var task Task
+		if err := json.Unmarshal(result, &task); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode task: %w", err)
+		}
+		return nil, &task, nil
+	default:
+		return nil, nil, fmt.Errorf("unexpected result of kind %q from message/send", kind.Kind)
+	}
+}
+
+func (c *Client) GetTask(ctx context.Context, id string) (*Task, error) {
+	var task Task
+	return &task, c.call(ctx, "tasks/get", TaskQueryParams{ID: id}, &task)
+}
+
+func (c *Client) CancelTask(ctx context.Context, id string) (*Task, error) {
+	var task Task
+	return &task, c.call(ctx, "tasks/cancel", TaskIDParams{ID: id}, &task)
+}
+
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	card, err := c.Card(ctx)
+	if err != nil {
+		return err
+	}
+
+	msg, err := mcp.NewMessage(method, params)
+	if err != nil {
+		return err
+	}
+	msg.ID = uuid.String()
+
+	var resp mcp.Message
+	if err := c.do(ctx, http.MethodPost, card.URL, msg, &resp); err != nil {
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("failed to call %s: %w", method, resp.Error)
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("failed to decode result of %s: %w", method, err)
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, url string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unexpected status %d from %s: %s", resp.StatusCode, url, strings.TrimSpace(string(data)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,684 @@
+package a2a
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tools"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+	"github.com/nanobot-ai/nanobot/pkg/version"
+)
+
+const (
+	// PathPrefix is the path agents are served under, followed by the name of the agent.
+	PathPrefix = "/a2a/"
+
+	maxBodySize = 50 << 20
+	// taskTTL is how long finished tasks can be read.
+	taskTTL = time.Hour
+	// contextIdleTimeout is how long the session of a context is kept without new messages.
+	contextIdleTimeout = 24 * time.Hour
+)
+
+type Caller interface {
+	Call(ctx context.Context, server, tool string, args any, opts ...tools.CallOptions) (*types.CallResult, error)
+}
+
+type contextSession struct {
+	session  *mcp.Session
+	lastUsed time.Time
+	// lock keeps the tasks of the same context from running at the same time.
+	lock sync.Mutex
+}
+
+type task struct {
+	// user is the ID of the user that created the task, only that user can read it.
+	user   string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	lock        sync.Mutex
+	task        Task
+	finished    time.Time
+	subscribers map[chan any]struct{}
+}
+
+// Handler serves the agents of the config with the JSON-RPC transport of the A2A protocol. Each context
+// of A2A is a session, the messages of a context are tasks that run one at a time.
+type Handler struct {
+	ctx        context.Context
+	config     types.Config
+	caller     Caller
+	newSession func(context.Context) context.Context
+
+	lock     sync.Mutex
+	tasks    map[string]*task
+	contexts map[string]*contextSession
+}
+
+// NewHandler returns the handler for the agents of the config. Tasks and the sessions of contexts use ctx,
+// which should be canceled when the server stops. newSession returns a context with a new session.
+func NewHandler(ctx context.Context, config types.Config, caller Caller, newSession func(context.Context) context.Context) *Handler {
+	return &Handler{
+		ctx:        ctx,
+		config:     config,
+		caller:     caller,
+		newSession: newSession,
+		tasks:      map[string]*task{},
+		contexts:   map[string]*contextSession{},
+	}
+}
+
+// Register adds the agent cards and the endpoints of the agents to the mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	for _, path := range []string{AgentCardPath, legacyAgentCardPath} {
+		mux.HandleFunc("GET "+path, h.defaultCard)
+		mux.HandleFunc("GET "+PathPrefix+"{agent}"+path, h.card)
+	}
+	mux.HandleFunc("POST "+PathPrefix+"{agent}", h.rpc)
+}
+
+// PublicPaths returns the paths of the agent cards, which clients read before they authenticate.
+func PublicPaths(config types.Config) (result []string) {
+	for _, path := range []string{AgentCardPath, legacyAgentCardPath} {
+		result = append(result, path)
+		for name := range config.Agents {
+			result = append(result, PathPrefix+name+path)
+		}
+	}
+	return
+}
+
+func (h *Handler) defaultCard(rw http.ResponseWriter, req *http.Request) {
+	agents := types.NanobotContext(req.Context()).AllowedEntrypoints(h.config)
+	if len(agents) == 0 {
+		http.Error(rw, "no agents", http.StatusNotFound)
+		return
+	}
+	writeJSON(req.Context(), rw, h.agentCard(req, agents[0]))
+}
+
+func (h *Handler) card(rw http.ResponseWriter, req *http.Request) {
+	name := req.PathValue("agent")
+	if !slices.Contains(types.NanobotContext(req.Context()).AllowedEntrypoints(h.config), name) {
+		http.Error(rw, fmt.Sprintf("agent %s not found", name), http.StatusNotFound)
+		return
+	}
+	writeJSON(req.Context(), rw, h.agentCard(req, name))
+}
+
+func (h *Handler) agentCard(req *http.Request, name string) AgentCard {
+	agent := h.config.Agents[name]
+
+	displayName := agent.Name
+	if displayName == "" {
+		displayName = name
+	}
+
+	card := AgentCard{
+		ProtocolVersion:    ProtocolVersion,
+		Name:               displayName,
+		Description:        agent.Description,
+		URL:                baseURL(req) + PathPrefix + name,
+		PreferredTransport: "JSONRPC",
+		Version:            version.Get().String(),
+		Capabilities: Capabilities{
+			Streaming: true,
+		},
+		DefaultInputModes:  []string{"text/plain"},
+		DefaultOutputModes: []string{"text/plain"},
+		Skills: []Skill{
+			{
+				ID:          name,
+				Name:        displayName,
+				Description: agent.Description,
+				Tags:        []string{"nanobot"},
+				Examples:    agent.StarterMessages,
+			},
+		},
+	}
+	if strings.HasPrefix(agent.Icon, "https://") {
+		card.IconURL = agent.Icon
+	}
+	return card
+}
+
+func baseURL(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	host := req.Host
+	if forwarded := req.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	return scheme + "://" + host
+}
+
+func (h *Handler) rpc(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	agent := req.PathValue("agent")
+
+	var msg mcp.Message
+	if err := json.NewDecoder(io.LimitReader(req.Body, maxBodySize)).Decode(&msg); err != nil {
+		writeResponse(ctx, rw, nil, nil, mcp.ErrRPCParse.WithMessage("%v", err))
+		return
+	}
+
+	if !slices.Contains(types.NanobotContext(ctx).AllowedEntrypoints(h.config), agent) {
+		writeResponse(ctx, rw, msg.ID, nil, mcp.ErrRPCInvalidRequest.WithMessage("agent %s not found", agent))
+		return
+	}
+
+	switch msg.Method {
+	case "message/send":
+		var params MessageSendParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			writeResponse(ctx, rw, msg.ID, nil, err)
+			return
+		}
+		t, rpcErr := h.start(ctx, agent, params.Message)
+		if rpcErr != nil {
+			writeResponse(ctx, rw, msg.ID, nil, rpcErr)
+			return
+		}
+		if params.Configuration != nil && params.Configuration.Blocking {
+			select {
+			case <-t.done:
+			case <-ctx.Done():
+				return
+			}
+		}
+		writeResponse(ctx, rw, msg.ID, t.snapshot(historyLength(params.Configuration)), nil)
+	case "message/stream":
+		var params MessageSendParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			writeResponse(ctx, rw, msg.ID, nil, err)
+			return
+		}
+		t, rpcErr := h.start(ctx, agent, params.Message)
+		if rpcErr != nil {
+			writeResponse(ctx, rw, msg.ID, nil, rpcErr)
+			return
+		}
+		h.stream(rw, req, msg.ID, t)
+	case "tasks/get":
+		var params TaskQueryParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			writeResponse(ctx, rw, msg.ID, nil, err)
+			return
+		}
+		t, ok := h.task(ctx, params.ID)
+		if !ok {
+			writeResponse(ctx, rw, msg.ID, nil, ErrTaskNotFound)
+			return
+		}
+		writeResponse(ctx, rw, msg.ID, t.snapshot(params.HistoryLength), nil)
+	case "tasks/cancel":
+		var params TaskIDParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			writeResponse(ctx, rw, msg.ID, nil, err)
+			return
+		}
+		t, ok := h.task(ctx, params.ID)
+		if !ok {
+			writeResponse(ctx, rw, msg.ID, nil, ErrTaskNotFound)
+			return
+		}
+		select {
+		case <-t.done:
+			writeResponse(ctx, rw, msg.ID, nil, ErrTaskNotCancelable)
+			return
+		default:
+		}
+		t.cancel()
+		select {
+		case <-t.done:
+		case <-ctx.Done():
+			return
+		}
+		writeResponse(ctx, rw, msg.ID, t.snapshot(nil), nil)
+	case "tasks/resubscribe":
+		var params TaskIDParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			writeResponse(ctx, rw, msg.ID, nil, err)
+			return
+		}
+		t, ok := h.task(ctx, params.ID)
+		if !ok {
+			writeResponse(ctx, rw, msg.ID, nil, ErrTaskNotFound)
+			return
+		}
+		h.stream(rw, req, msg.ID, t)
+	case "tasks/pushNotificationConfig/set", "tasks/pushNotificationConfig/get",
+		"tasks/pushNotificationConfig/list", "tasks/pushNotificationConfig/delete":
+		writeResponse(ctx, rw, msg.ID, nil, ErrUnsupportedOperation)
+	default:
+		writeResponse(ctx, rw, msg.ID, nil, mcp.ErrRPCMethodNotFound.WithMessage("%s", msg.Method))
+	}
+}
+
+func unmarshalParams(msg mcp.Message, out any) *mcp.RPCError {
+	if err := json.Unmarshal(msg.Params, out); err != nil {
+		return mcp.ErrRPCInvalidParams.WithMessage("%v", err)
+	}
+	return nil
+}
+
+func historyLength(config *MessageSendConfiguration) *int {
+	if config == nil {
+		return nil
+	}
+	return config.HistoryLength
+}
+
+func (h *Handler) task(ctx context.Context, id string) (*task, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	t, ok := h.tasks[id]
+	if !ok || t.user != types.NanobotContext(ctx).User.ID {
+		return nil, false
+	}
+	return t, true
+}
+
+// contextSession returns the session of the context, creating it if needed, and drops the sessions and
+// tasks that are no longer used. The lock must be held.
+func (h *Handler) contextSession(contextID string) *contextSession {
+	now := time.Now()
+	for id, c := range h.contexts {
+		// Contexts with a task running are in use even if they were not used recently.
+		if now.Sub(c.lastUsed) > contextIdleTimeout && c.lock.TryLock() {
+			c.session.Close(false)
+			delete(h.contexts, id)
+			c.lock.Unlock()
+		}
+	}
+	for id, t := range h.tasks {
+		t.lock.Lock()
+		if !t.finished.IsZero() && now.Sub(t.finished) > taskTTL {
+			delete(h.tasks, id)
+		}
+		t.lock.Unlock()
+	}
+
+	c, ok := h.contexts[contextID]
+	if !ok {
+		c = &contextSession{
+			session: mcp.SessionFromContext(h.newSession(h.ctx)),
+		}
+		h.contexts[contextID] = c
+	}
+	c.lastUsed = now
+	return c
+}
+
+// start creates the task for the message and runs the agent in the background.
+func (h *Handler) start(ctx context.Context, agent string, msg Message) (*task, *mcp.RPCError) {
+	if msg.TaskID != "" {
+		if _, ok := h.task(ctx, msg.TaskID); !ok {
+			return nil, ErrTaskNotFound
+		}
+		// Agents do not ask for input, so tasks can not be continued.
+		return nil, mcp.ErrRPCInvalidParams.WithMessage("task %s is in a final state", msg.TaskID)
+	}
+
+	if msg.ContextID == "" {
+		msg.ContextID = uuid.String()
+	}
+	if msg.MessageID == "" {
+		msg.MessageID = uuid.String()
+	}
+	msg.Kind = "message"
+
+	now := time.Now()
+	t := &task{
+		user: types.NanobotContext(ctx).User.ID,
+		done: make(chan struct{}),
+		task: Task{
+			Kind:      "task",
+			ID:        uuid.String(),
+			ContextID: msg.ContextID,
+			Status: TaskStatus{
+				State:     TaskStateSubmitted,
+				Timestamp: &now,
+			},
+		},
+		subscribers: map[chan any]struct{}{},
+	}
+	msg.TaskID = t.task.ID
+	t.task.History = []Message{msg}
+
+	// The task keeps running when the request is done, but not when the server stops.
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(h.ctx, cancel)
+	t.cancel = cancel
+
+	h.lock.Lock()
+	session := h.contextSession(msg.ContextID)
+	h.tasks[t.task.ID] = t
+	h.lock.Unlock()
+
+	go func() {
+		defer stop()
+		defer cancel()
+		h.run(runCtx, agent, session, t, msg)
+	}()
+
+	return t, nil
+}
+
+func (h *Handler) run(ctx context.Context, agent string, session *contextSession, t *task, msg Message) {
+	defer close(t.done)
+
+	session.lock.Lock()
+	defer session.lock.Unlock()
+
+	ctx = mcp.WithSession(ctx, session.session)
+	t.setStatus(TaskStateWorking, nil)
+
+	args := types.SampleCallRequest{
+		Prompt: Text(msg.Parts),
+	}
+	for _, part := range msg.Parts {
+		if part.Kind == "file" && part.File != nil {
+			args.Attachments = append(args.Attachments, toAttachment(*part.File))
+		}
+	}
+
+	var (
+		progressToken = uuid.String()
+		artifactID    = uuid.String()
+	)
+	remove := session.session.AddFilter(t.deltaFilter(progressToken, artifactID))
+	defer remove()
+
+	result, err := h.caller.Call(ctx, agent, agent, args, tools.CallOptions{
+		ProgressToken: progressToken,
+	})
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		t.setStatus(TaskStateCanceled, nil)
+	case err != nil:
+		log.Errorf(ctx, "a2a task %s of agent %s failed: %v", t.task.ID, agent, err)
+		t.setStatus(TaskStateFailed, t.agentMessage([]Part{{Kind: "text", Text: err.Error()}}))
+	case result.IsError:
+		t.setStatus(TaskStateFailed, t.agentMessage(toParts(result.Content)))
+	default:
+		parts := toParts(result.Content)
+		t.addArtifact(Artifact{
+			ArtifactID: artifactID,
+			Name:       "response",
+			Parts:      parts,
+		})
+		t.setStatus(TaskStateCompleted, t.agentMessage(parts))
+	}
+}
+
+func toAttachment(file FileContent) types.Attachment {
+	url := file.URI
+	if url == "" {
+		url = "data:" + file.MIMEType + ";base64," + file.Bytes
+	}
+	return types.Attachment{
+		URL:      url,
+		Name:     file.Name,
+		MimeType: file.MIMEType,
+	}
+}
+
+func toParts(contents []mcp.Content) (parts []Part) {
+	for _, content := range contents {
+		switch {
+		case content.Type == "text":
+			parts = append(parts, Part{
+				Kind: "text",
+				Text: content.Text,
+			})
+		case content.Type == "image" || content.Type == "audio":
+			parts = append(parts, Part{
+				Kind: "file",
+				File: &FileContent{
+					MIMEType: content.MIMEType,
+					Bytes:    content.Data,
+				},
+			})
+		case content.Resource != nil && content.Resource.Blob != "":
+			parts = append(parts, Part{
+				Kind: "file",
+				File: &FileContent{
+					Name:     content.Resource.URI,
+					MIMEType: content.Resource.MIMEType,
+					Bytes:    content.Resource.Blob,
+				},
+			})
+		case content.Resource != nil:
+			parts = append(parts, Part{
+				Kind: "text",
+				Text: content.Resource.Text,
+			})
+		}
+	}
+	return parts
+}
+
+func (t *task) agentMessage(parts []Part) *Message {
+	return &Message{
+		Kind:      "message",
+		MessageID: uuid.String(),
+		Role:      "agent",
+		Parts:     parts,
+		ContextID: t.task.ContextID,
+		TaskID:    t.task.ID,
+	}
+}
+
+func (t *task) setStatus(state string, msg *Message) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	t.task.Status = TaskStatus{
+		State:     state,
+		Message:   msg,
+		Timestamp: &now,
+	}
+	if msg != nil {
+		t.task.History = append(t.task.History, *msg)
+	}
+	final := t.task.Status.Final()
+	if final {
+		t.finished = now
+	}
+	t.publish(TaskStatusUpdateEvent{
+		Kind:      "status-update",
+		TaskID:    t.task.ID,
+		ContextID: t.task.ContextID,
+		Status:    t.task.Status,
+		Final:     final,
+	})
+}
+
+func (t *task) addArtifact(artifact Artifact) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.task.Artifacts = append(t.task.Artifacts, artifact)
+	t.publish(TaskArtifactUpdateEvent{
+		Kind:      "artifact-update",
+		TaskID:    t.task.ID,
+		ContextID: t.task.ContextID,
+		Artifact:  artifact,
+		LastChunk: true,
+	})
+}
+
+// publish sends the event to the subscribers, the lock must be held.
+func (t *task) publish(event any) {
+	for ch := range t.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Drop events rather than block the agent if the client is slow
+		}
+	}
+}
+
+func (t *task) subscribe() (chan any, func()) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	ch := make(chan any, 1000)
+	t.subscribers[ch] = struct{}{}
+	return ch, func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		delete(t.subscribers, ch)
+	}
+}
+
+// deltaFilter streams the text of the agent to the subscribers as chunks of the artifact.
+func (t *task) deltaFilter(progressToken, artifactID string) mcp.MessageFilter {
+	var started bool
+	return func(_ context.Context, msg *mcp.Message) (*mcp.Message, error) {
+		if msg.Method != "notifications/progress" {
+			return msg, nil
+		}
+
+		var progress mcp.NotificationProgressRequest
+		if err := json.Unmarshal(msg.Params, &progress); err != nil || fmt.Sprint(progress.ProgressToken) != progressToken {
+			return msg, nil
+		}
+
+		var completion types.CompletionProgress
+		if err := mcp.JSONCoerce(progress.Meta[types.CompletionProgressMetaKey], &completion); err != nil {
+			return msg, nil
+		}
+
+		item := completion.Item
+		if !item.Partial || item.Content == nil || item.Content.Type != "text" || item.Content.Text == "" {
+			return msg, nil
+		}
+
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		t.publish(TaskArtifactUpdateEvent{
+			Kind:      "artifact-update",
+			TaskID:    t.task.ID,
+			ContextID: t.task.ContextID,
+			Artifact: Artifact{
+				ArtifactID: artifactID,
+				Name:       "response",
+				Parts: []Part{
+					{
+						Kind: "text",
+						Text: item.Content.Text,
+					},
+				},
+			},
+			Append: started,
+		})
+		started = true
+		return msg, nil
+	}
+}
+
+func (t *task) snapshot(historyLength *int) Task {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	result := t.task
+	result.Artifacts = slices.Clone(t.task.Artifacts)
+	result.History = slices.Clone(t.task.History)
+	if historyLength != nil && *historyLength < len(result.History) {
+		result.History = result.History[len(result.History)-max(*historyLength, 0):]
+	}
+	return result
+}
+
+// stream writes the task and its events as server-sent events until the task is done.
+func (h *Handler) stream(rw http.ResponseWriter, req *http.Request, id any, t *task) {
+	events, unsubscribe := t.subscribe()
+	defer unsubscribe()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+
+	write := func(result any) {
+		data, err := json.Marshal(result)
+		if err != nil {
+			log.Errorf(req.Context(), "failed to marshal a2a event: %v", err)
+			return
+		}
+		resp, _ := json.Marshal(mcp.Message{
+			JSONRPC: "2.0",
+			ID:      id,
+			Result:  data,
+		})
+		_, _ = fmt.Fprintf(rw, "data: %s\n\n", resp)
+		if flusher, ok := rw.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+
+	write(t.snapshot(nil))
+
+	for {
+		select {
+		case event := <-events:
+			write(event)
+		case <-t.done:
+			for {
+				select {
+				case event := <-events:
+					write(event)
+				default:
+					return
+				}
+			}
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func writeResponse(ctx context.Context, rw http.ResponseWriter, id, result any, rpcErr *mcp.RPCError) {
+	resp := mcp.Message{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   rpcErr,
+	}
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = mcp.ErrRPCInternal.WithMessage("%v", err)
+		} else {
+			resp.Result = data
+		}
+	}
+	writeJSON(ctx, rw, resp)
+}
+
+func writeJSON(ctx context.Context, rw http.ResponseWriter, obj any) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(obj); err != nil {
+		log.Errorf(ctx, "failed to marshal a2a response: %v", err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	_, _ = rw.Write(buf.Bytes())
+}
@@ -0,0 +1,168 @@
+package a2a
+
+import (
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+)
+
+// ProtocolVersion is the version of the A2A protocol implemented by the server and the client.
+const ProtocolVersion = "0.3.0"
+
+// Paths of the agent card, relative to the URL of the agent.
+const (
+	AgentCardPath       = "/.well-known/agent-card.json"
+	legacyAgentCardPath = "/.well-known/agent.json"
+)
+
+// Task states.
+const (
+	TaskStateSubmitted     = "submitted"
+	TaskStateWorking       = "working"
+	TaskStateInputRequired = "input-required"
+	TaskStateCompleted     = "completed"
+	TaskStateCanceled      = "canceled"
+	TaskStateFailed        = "failed"
+	TaskStateRejected      = "rejected"
+	TaskStateAuthRequired  = "auth-required"
+)
+
+// Errors defined by the A2A protocol.
+var (
+	ErrTaskNotFound         = mcp.NewRPCError(-32001, "Task not found")
+	ErrTaskNotCancelable    = mcp.NewRPCError(-32002, "Task cannot be canceled")
+	ErrUnsupportedOperation = mcp.NewRPCError(-32004, "This operation is not supported")
+)
+
+type AgentCard struct {
+	ProtocolVersion    string       `json:"protocolVersion"`
+	Name               string       `json:"name"`
+	Description        string       `json:"description"`
+	URL                string       `json:"url"`
+	PreferredTransport string       `json:"preferredTransport,omitempty"`
+	IconURL            string       `json:"iconUrl,omitempty"`
+	Version            string       `json:"version"`
+	Capabilities       Capabilities `json:"capabilities"`
+	DefaultInputModes  []string     `json:"defaultInputModes"`
+	DefaultOutputModes []string     `json:"defaultOutputModes"`
+	Skills             []Skill      `json:"skills"`
+}
+
+type Capabilities struct {
+	Streaming         bool `json:"streaming,omitempty"`
+	PushNotifications bool `json:"pushNotifications,omitempty"`
+}
+
+type Skill struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Examples    []string `json:"examples,omitempty"`
+}
+
+type Message struct {
+	Kind      string `json:"kind"`
+	MessageID string `json:"messageId"`
+	Role      string `json:"role"`
+	Parts     []Part `json:"parts"`
+	ContextID string `json:"contextId,omitempty"`
+	TaskID    string `json:"taskId,omitempty"`
+}
+
+// Part is a text, file, or data part of a message or artifact, depending on its kind.
+type Part struct {
+	Kind string         `json:"kind"`
+	Text string         `json:"text,omitempty"`
+	File *FileContent   `json:"file,omitempty"`
+	Data map[string]any `json:"data,omitempty"`
+}
+
+// FileContent has either the base64 encoded bytes or the URI of the file.
+type FileContent struct {
+	Name     string `json:"name,omitempty"`
+	MIMEType string `json:"mimeType,omitempty"`
+	Bytes    string `json:"bytes,omitempty"`
+	URI      string `json:"uri,omitempty"`
+}
+
+type Task struct {
+	Kind      string     `json:"kind"`
+	ID        string     `json:"id"`
+	ContextID string     `json:"contextId"`
+	Status    TaskStatus `json:"status"`
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	History   []Message  `json:"history,omitempty"`
+}
+
+type TaskStatus struct {
+	State     string     `json:"state"`
+	Message   *Message   `json:"message,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// Final returns true if the task will not change anymore, or needs more input to continue.
+func (t TaskStatus) Final() bool {
+	switch t.State {
+	case TaskStateSubmitted, TaskStateWorking:
+		return false
+	}
+	return true
+}
+
+type Artifact struct {
+	ArtifactID string `json:"artifactId"`
+	Name       string `json:"name,omitempty"`
+	Parts      []Part `json:"parts"`
+}
+
+type TaskStatusUpdateEvent struct {
+	Kind      string     `json:"kind"`
+	TaskID    string     `json:"taskId"`
+	ContextID string     `json:"contextId"`
+	Status    TaskStatus `json:"status"`
+	Final     bool       `json:"final"`
+}
+
+type TaskArtifactUpdateEvent struct {
+	Kind      string   `json:"kind"`
+	TaskID    string   `json:"taskId"`
+	ContextID string   `json:"contextId"`
+	Artifact  Artifact `json:"artifact"`
+	Append    bool     `json:"append,omitempty"`
+	LastChunk bool     `json:"lastChunk,omitempty"`
+}
+
+type MessageSendParams struct {
+	Message       Message                   `json:"message"`
+	Configuration *MessageSendConfiguration `json:"configuration,omitempty"`
+}
+
+type MessageSendConfiguration struct {
+	AcceptedOutputModes []string `json:"acceptedOutputModes,omitempty"`
+	HistoryLength       *int     `json:"historyLength,omitempty"`
+	Blocking            bool     `json:"blocking,omitempty"`
+}
+
+type TaskQueryParams struct {
+	ID            string `json:"id"`
+	HistoryLength *int   `json:"historyLength,omitempty"`
+}
+
+type TaskIDParams struct {
+	ID string `json:"id"`
+}
+
+// Text returns the text parts of the parts.
+func Text(parts []Part) string {
+	var text string
+	for _, part := range parts {
+		if part.Kind == "text" {
+			if text != "" {
+				text += "\n"
+			}
+			text += part.Text
+		}
+	}
+	return text
+}
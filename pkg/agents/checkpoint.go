@@ -0,0 +1,139 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// ErrNoCheckpoint is returned when a turn is resumed but the thread has no interrupted turn.
+var ErrNoCheckpoint = errors.New("no interrupted turn to resume")
+
+// ErrTurnRunning is returned when a turn is resumed while it is still running.
+var ErrTurnRunning = errors.New("the turn is still running")
+
+// checkpointer stores the checkpoint of a turn in the session and persists the session after each
+// completion and tool call. A nil checkpointer does nothing.
+type checkpointer struct {
+	session    *mcp.Session
+	key        string
+	lock       sync.Mutex
+	checkpoint types.Checkpoint
+}
+
+var (
+	runningLock sync.Mutex
+	// running counts the turns running in this process by session and checkpoint key, a turn is not
+	// resumed while it is running.
+	running = map[string]int{}
+)
+
+// newCheckpointer returns the checkpointer of the turn, or nil if the agent does not checkpoint its turns.
+func newCheckpointer(config types.Config, agentName string, session *mcp.Session, key string, checkpoint types.Checkpoint, resume bool) (*checkpointer, error) {
+	if session == nil || !config.Agents[agentName].Checkpoint {
+		return nil, nil
+	}
+
+	runningLock.Lock()
+	defer runningLock.Unlock()
+	runningKey := session.ID() + "/" + key
+	if resume && running[runningKey] > 0 {
+		return nil, ErrTurnRunning
+	}
+	running[runningKey]++
+
+	return &checkpointer{
+		session:    session,
+		key:        key,
+		checkpoint: checkpoint,
+	}, nil
+}
+
+// save stores the run after its completion.
+func (c *checkpointer) save(ctx context.Context, previous, run *types.Execution) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	copied := *run
+	copied.ToolOutputs = maps.Clone(run.ToolOutputs)
+	c.checkpoint.Previous = previous
+	c.checkpoint.Run = &copied
+	c.persist(ctx)
+}
+
+// fallback replaces the thread that is restored if the turn fails.
+func (c *checkpointer) fallback(thread *types.Execution) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.checkpoint.Fallback = thread
+}
+
+// toolOutput adds the output of a tool call of the run to the checkpoint, before the other calls of the
+// run finished.
+func (c *checkpointer) toolOutput(ctx context.Context, callID string, output types.Message) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.checkpoint.Run == nil {
+		return
+	}
+	copied := *c.checkpoint.Run
+	copied.ToolOutputs = maps.Clone(copied.ToolOutputs)
+	if copied.ToolOutputs == nil {
+		copied.ToolOutputs = map[string]types.ToolOutput{}
+	}
+	copied.ToolOutputs[callID] = types.ToolOutput{
+		Output: output,
+		Done:   true,
+	}
+	c.checkpoint.Run = &copied
+	c.persist(ctx)
+}
+
+func (c *checkpointer) persist(ctx context.Context) {
+	c.checkpoint.Updated = time.Now()
+	checkpoint := c.checkpoint
+	c.session.Set(c.key, &checkpoint)
+	if err := c.session.Persist(ctx); err != nil {
+		log.Errorf(ctx, "failed to persist checkpoint of session %s: %v", c.session.ID(), err)
+	}
+}
+
+// done removes the checkpoint if the turn finished or failed. The checkpoint of a turn that ended because
+// its context was canceled or timed out is kept, so that the turn can be resumed.
+func (c *checkpointer) done(ctx context.Context, err error) {
+	if c == nil {
+		return
+	}
+	runningLock.Lock()
+	runningKey := c.session.ID() + "/" + c.key
+	if running[runningKey]--; running[runningKey] <= 0 {
+		delete(running, runningKey)
+	}
+	runningLock.Unlock()
+
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	c.session.Set(c.key, nil)
+	// A turn that timed out may still have finished with the response so far
+	if err := c.session.Persist(context.WithoutCancel(ctx)); err != nil {
+		log.Errorf(ctx, "failed to persist session %s: %v", c.session.ID(), err)
+	}
+}
@@ -0,0 +1,95 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func checkpointSession(t *testing.T) *mcp.Session {
+	t.Helper()
+	serverSession, err := mcp.NewExistingServerSession(context.Background(), mcp.SessionState{ID: "s1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serverSession.GetSession()
+}
+
+var checkpointConfig = types.Config{
+	Agents: map[string]types.Agent{
+		"agent": {Checkpoint: true},
+	},
+}
+
+func TestCheckpointerDone(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		kept bool
+	}{
+		{name: "finished", ctx: context.Background()},
+		{name: "failed", ctx: context.Background(), err: errors.New("failed")},
+		{name: "canceled", ctx: canceled, err: context.Canceled, kept: true},
+		{name: "responded after the timeout", ctx: canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := checkpointSession(t)
+			checkpoint, err := newCheckpointer(checkpointConfig, "agent", session, types.CheckpointKey, types.Checkpoint{StartID: "start"}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkpoint.save(tt.ctx, nil, &types.Execution{})
+			checkpoint.done(tt.ctx, tt.err)
+
+			var stored types.Checkpoint
+			if kept := session.Get(types.CheckpointKey, &stored) && stored.Run != nil; kept != tt.kept {
+				t.Errorf("expected checkpoint kept %v, got %v", tt.kept, kept)
+			}
+		})
+	}
+}
+
+func TestCheckpointerResume(t *testing.T) {
+	session := checkpointSession(t)
+	checkpoint, err := newCheckpointer(checkpointConfig, "agent", session, types.CheckpointKey, types.Checkpoint{StartID: "start"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint.save(context.Background(), nil, &types.Execution{})
+	checkpoint.toolOutput(context.Background(), "call1", types.Message{Role: "user"})
+
+	if _, err := newCheckpointer(checkpointConfig, "agent", session, types.CheckpointKey, types.Checkpoint{}, true); !errors.Is(err, ErrTurnRunning) {
+		t.Fatalf("expected %v while the turn is running, got %v", ErrTurnRunning, err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	checkpoint.done(canceled, context.Canceled)
+
+	var stored types.Checkpoint
+	if !session.Get(types.CheckpointKey, &stored) || stored.Run == nil {
+		t.Fatal("expected the checkpoint of the canceled turn")
+	}
+	if stored.StartID != "start" || !stored.Run.ToolOutputs["call1"].Done {
+		t.Errorf("expected the checkpoint with the output of call1, got %+v", stored)
+	}
+
+	resumed, err := newCheckpointer(checkpointConfig, "agent", session, types.CheckpointKey, stored, true)
+	if err != nil {
+		t.Fatalf("expected the canceled turn to resume, got %v", err)
+	}
+	resumed.done(context.Background(), nil)
+	if session.Get(types.CheckpointKey, &types.Checkpoint{}) {
+		t.Error("expected the checkpoint to be removed after the resumed turn finished")
+	}
+}
@@ -0,0 +1,172 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tokens"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+const (
+	defaultCompactionThreshold = 0.8
+	defaultKeepMessages        = 4
+	// toolResultPreview is how much of a tool result is shown to the summarizer.
+	toolResultPreview = 200
+)
+
+const compactionPrompt = `You compact the history of a conversation between a user and an AI assistant so the ` +
+	`conversation can continue in a smaller context window. Write a concise summary that keeps the goals of ` +
+	`the user, decisions made, facts learned, open questions and the current state of the task. Tool results ` +
+	`are shown as references like [tool result call_123]; refer to them by that ID instead of repeating their ` +
+	`content, unless a detail is needed to continue. Respond with the summary only.`
+
+// compactionSplit returns the index of the first message that is kept. Messages before it are
+// summarized. The kept messages never start with a tool result, so tool calls and their results stay
+// together, and always include the new input of this run.
+func compactionSplit(input []types.Message, keep int) int {
+	split := len(input) - keep
+	for ; split > 0; split-- {
+		if !hasToolResult(input[split]) {
+			break
+		}
+	}
+	return split
+}
+
+func hasToolResult(msg types.Message) bool {
+	for _, item := range msg.Items {
+		if item.ToolCallResult != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// compact replaces the older messages of the request with a summary if the request is close to the
+// context window of the model.
+func (a *Agents) compact(ctx context.Context, config types.Config, req types.CompletionRequest, newMessages int) (types.CompletionRequest, error) {
+	compaction := config.Agents[req.Agent].Compaction
+	if !compaction.IsSet() {
+		return req, nil
+	}
+
+	threshold := compaction.Threshold
+	if threshold == 0 {
+		threshold = defaultCompactionThreshold
+	}
+	count := tokens.Request(req.Model, req)
+	if float64(count) < threshold*float64(compaction.ContextWindow) {
+		return req, nil
+	}
+
+	keep := compaction.KeepMessages
+	if keep == 0 {
+		keep = defaultKeepMessages
+	}
+	split := compactionSplit(req.Input, max(keep, newMessages))
+	if split <= 0 {
+		return req, nil
+	}
+
+	model := compaction.Model
+	if model == "" {
+		model = req.Model
+	}
+
+	log.Debugf(ctx, "compacting %d messages of agent %s, %d tokens", split, req.Agent, count)
+
+	resp, err := a.completer.Complete(ctx, types.CompletionRequest{
+		Model:        model,
+		BaseURL:      req.BaseURL,
+		SystemPrompt: compactionPrompt,
+		Input: []types.Message{
+			textMessage(fmt.Sprintf("Summarize this conversation:\n\n%s", compactionTranscript(req.Input[:split]))),
+		},
+	})
+	if err != nil {
+		return req, fmt.Errorf("failed to compact conversation: %w", err)
+	}
+
+	var summary strings.Builder
+	for _, item := range resp.Output.Items {
+		if item.Content != nil && item.Content.Type == "text" {
+			summary.WriteString(item.Content.Text)
+		}
+	}
+	if summary.Len() == 0 {
+		return req, nil
+	}
+
+	req.Input = append([]types.Message{
+		textMessage("<summary of the earlier conversation>\n" + summary.String() + "\n</summary of the earlier conversation>"),
+	}, req.Input[split:]...)
+	return req, nil
+}
+
+// compactionTranscript renders the messages for the summarizer, tool results are referenced by their
+// call ID with a short preview.
+func compactionTranscript(messages []types.Message) string {
+	var buf strings.Builder
+	for _, msg := range messages {
+		for _, item := range msg.Items {
+			switch {
+			case item.Content != nil && item.Content.Type == "text":
+				fmt.Fprintf(&buf, "%s: %s\n", msg.Role, item.Content.Text)
+			case item.Content != nil:
+				fmt.Fprintf(&buf, "%s: [%s content]\n", msg.Role, item.Content.Type)
+			case item.ToolCall != nil:
+				fmt.Fprintf(&buf, "%s: [tool call %s] %s(%s)\n", msg.Role, item.ToolCall.CallID, item.ToolCall.Name, item.ToolCall.Arguments)
+			case item.ToolCallResult != nil:
+				preview := item.ToolCallResult.Output.Text()
+				if len(preview) > toolResultPreview {
+					preview = preview[:toolResultPreview] + "..."
+				}
+				fmt.Fprintf(&buf, "[tool result %s] %s\n", item.ToolCallResult.CallID, preview)
+			}
+		}
+	}
+	return buf.String()
+}
+
+func textMessage(text string) types.Message {
+	now := time.Now()
+	id := uuid.String()
+	return types.Message{
+		ID:      id,
+		Created: &now,
+		Role:    "user",
+		Items: []types.CompletionItem{
+			{
+				ID: id + "_0",
+				Content: &mcp.Content{
+					Type: "text",
+					Text: text,
+				},
+			},
+		},
+	}
+}
+
+// compactedThread returns the thread before the run with its history replaced by the compacted
+// history, so the summary is kept even if the run fails.
+func compactedThread(prev *types.Execution, history []types.Message) *types.Execution {
+	var populated types.CompletionRequest
+	if prev.PopulatedRequest != nil {
+		populated = *prev.PopulatedRequest
+	}
+	populated.Input = slices.Clone(history)
+	return &types.Execution{
+		Request:          prev.Request,
+		Done:             prev.Done,
+		PopulatedRequest: &populated,
+		ToolToMCPServer:  prev.ToolToMCPServer,
+		Response:         &types.CompletionResponse{},
+	}
+}
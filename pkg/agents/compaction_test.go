@@ -0,0 +1,28 @@
+package agents
+
+import (
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func TestCompactedThread(t *testing.T) {
+	prev := &types.Execution{
+		Done:             true,
+		PopulatedRequest: &types.CompletionRequest{Model: "model", Input: []types.Message{textMessage("one"), textMessage("two")}},
+		Response:         &types.CompletionResponse{Output: textMessage("three")},
+		ToolOutputs:      map[string]types.ToolOutput{"call1": {Done: true}},
+	}
+	history := []types.Message{textMessage("summary"), textMessage("three")}
+
+	thread := compactedThread(prev, history)
+	if thread.PopulatedRequest.Model != "model" || len(thread.PopulatedRequest.Input) != 2 || thread.PopulatedRequest.Input[0].Items[0].Content.Text != "summary" {
+		t.Errorf("expected the compacted history in the thread, got %+v", thread.PopulatedRequest)
+	}
+	if len(thread.Response.Output.Items) != 0 || len(thread.ToolOutputs) != 0 || !thread.Done {
+		t.Errorf("expected a done thread without output, got %+v", thread)
+	}
+	if len(prev.PopulatedRequest.Input) != 2 || prev.PopulatedRequest.Input[0].Items[0].Content.Text != "one" {
+		t.Errorf("expected the previous thread to be unchanged, got %+v", prev.PopulatedRequest)
+	}
+}
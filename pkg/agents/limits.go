@@ -0,0 +1,164 @@
+package agents
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/usage"
+)
+
+const usageCountersSessionKey = "agents/usageCounters"
+
+// usageCounter tracks the usage of a session or of one agent in a session for enforcing limits.
+type usageCounter struct {
+	// Day is the UTC day (YYYY-MM-DD) DayTokens are counted for
+	Day       string      `json:"day,omitempty"`
+	DayTokens int         `json:"dayTokens,omitempty"`
+	Requests  []time.Time `json:"requests,omitempty"`
+	CostUSD   float64     `json:"costUSD,omitempty"`
+}
+
+func (u usageCounter) check(limits *types.Limits, agentName string, now time.Time) error {
+	if !limits.IsSet() {
+		return nil
+	}
+	if limits.TokensPerDay > 0 && u.Day == day(now) && u.DayTokens >= limits.TokensPerDay {
+		return &types.LimitExceededError{Agent: agentName, Limit: "tokensPerDay", Value: limits.TokensPerDay}
+	}
+	if limits.RequestsPerMinute > 0 && len(u.recentRequests(now)) >= limits.RequestsPerMinute {
+		return &types.LimitExceededError{Agent: agentName, Limit: "requestsPerMinute", Value: limits.RequestsPerMinute}
+	}
+	if limits.MaxCostUSD > 0 && u.CostUSD >= limits.MaxCostUSD {
+		return &types.LimitExceededError{Agent: agentName, Limit: "maxCostUSD", Value: limits.MaxCostUSD}
+	}
+	return nil
+}
+
+func (u usageCounter) recentRequests(now time.Time) []time.Time {
+	cutoff := now.Add(-time.Minute)
+	i := slices.IndexFunc(u.Requests, func(t time.Time) bool {
+		return t.After(cutoff)
+	})
+	if i < 0 {
+		return nil
+	}
+	return u.Requests[i:]
+}
+
+func (u usageCounter) addRequest(now time.Time) usageCounter {
+	u.Requests = append(slices.Clone(u.recentRequests(now)), now)
+	return u
+}
+
+func (u usageCounter) addUsage(now time.Time, tokens int, cost float64) usageCounter {
+	if today := day(now); u.Day != today {
+		u.Day = today
+		u.DayTokens = 0
+	}
+	u.DayTokens += tokens
+	u.CostUSD += cost
+	return u
+}
+
+type usageCounters struct {
+	Session usageCounter            `json:"session,omitzero"`
+	Agents  map[string]usageCounter `json:"agents,omitempty"`
+}
+
+func (u usageCounters) Serialize() (any, error) {
+	return u, nil
+}
+
+func (u *usageCounters) Deserialize(data any) (any, error) {
+	if err := mcp.JSONCoerce(data, u); err != nil {
+		return nil, err
+	}
+	return *u, nil
+}
+
+func day(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// update returns the counters with the counter of the session and of the agent updated.
+func (u usageCounters) update(agentName string, update func(counter usageCounter) usageCounter) usageCounters {
+	agents := maps.Clone(u.Agents)
+	if agents == nil {
+		agents = map[string]usageCounter{}
+	}
+	agents[agentName] = update(u.Agents[agentName])
+	return usageCounters{
+		Session: update(u.Session),
+		Agents:  agents,
+	}
+}
+
+func updateUsage(session *mcp.Session, agentName string, update func(counter usageCounter) usageCounter) {
+	var counters usageCounters
+	_ = session.Update(usageCountersSessionKey, &counters, func() error {
+		counters = counters.update(agentName, update)
+		return nil
+	})
+}
+
+// checkLimits returns a LimitExceededError if the session or the agent has used up its limits. If the
+// limits are not exceeded the request is counted against the requests per minute, in the same update of
+// the counters so that concurrent requests can not all pass the check.
+func checkLimits(ctx context.Context, config types.Config, agentName string) error {
+	agentLimits := config.Agents[agentName].Limits
+	if !config.Limits.IsSet() && !agentLimits.IsSet() {
+		return nil
+	}
+
+	session := mcp.SessionFromContext(ctx).Root()
+	if session == nil {
+		return nil
+	}
+
+	var (
+		counters usageCounters
+		now      = time.Now()
+	)
+	return session.Update(usageCountersSessionKey, &counters, func() error {
+		if err := counters.Session.check(config.Limits, "", now); err != nil {
+			return err
+		}
+		if err := counters.Agents[agentName].check(agentLimits, agentName, now); err != nil {
+			return err
+		}
+		counters = counters.update(agentName, func(counter usageCounter) usageCounter {
+			return counter.addRequest(now)
+		})
+		return nil
+	})
+}
+
+// recordUsage adds the tokens and cost of a completion to the usage ledger of the session and to the
+// counters of the session and the agent.
+func recordUsage(ctx context.Context, config types.Config, agentName string, resp *types.CompletionResponse) {
+	if resp == nil || resp.Usage == nil {
+		return
+	}
+	usage.Record(ctx, config, agentName, resp)
+	if !config.Limits.IsSet() && !config.Agents[agentName].Limits.IsSet() {
+		return
+	}
+
+	session := mcp.SessionFromContext(ctx).Root()
+	if session == nil {
+		return
+	}
+
+	var (
+		now    = time.Now()
+		tokens = resp.Usage.TotalTokens()
+		cost   = config.Cost(resp.Model, resp.Usage)
+	)
+	updateUsage(session, agentName, func(counter usageCounter) usageCounter {
+		return counter.addUsage(now, tokens, cost)
+	})
+}
@@ -0,0 +1,57 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func TestCheckLimitsConcurrent(t *testing.T) {
+	tests := []struct {
+		name   string
+		config types.Config
+	}{
+		{name: "session", config: types.Config{
+			Limits: &types.Limits{RequestsPerMinute: 5},
+			Agents: map[string]types.Agent{"agent": {}},
+		}},
+		{name: "agent", config: types.Config{
+			Agents: map[string]types.Agent{"agent": {Limits: &types.Limits{RequestsPerMinute: 5}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := mcp.WithSession(context.Background(), checkpointSession(t))
+
+			var (
+				wg       sync.WaitGroup
+				allowed  atomic.Int32
+				exceeded atomic.Int32
+			)
+			for range 20 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var limitErr *types.LimitExceededError
+					if err := checkLimits(ctx, tt.config, "agent"); err == nil {
+						allowed.Add(1)
+					} else if errors.As(err, &limitErr) {
+						exceeded.Add(1)
+					} else {
+						t.Errorf("unexpected error: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if allowed.Load() != 5 || exceeded.Load() != 15 {
+				t.Errorf("expected 5 requests allowed and 15 exceeded, got %d and %d", allowed.Load(), exceeded.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// loopGuard counts the rounds of tool calls of a turn and the calls of the same tool with the same
+// arguments in a row.
+type loopGuard struct {
+	limits  types.Loop
+	rounds  int
+	last    string
+	repeats int
+}
+
+func newLoopGuard(limits *types.Loop) *loopGuard {
+	guard := &loopGuard{}
+	if limits != nil {
+		guard.limits = *limits
+	}
+	return guard
+}
+
+// check returns why the turn stops instead of running the tool calls of the run, or "" if they run.
+func (l *loopGuard) check(run *types.Execution) string {
+	if run.Response == nil {
+		return ""
+	}
+	calls := plannedToolCalls(run)
+	if len(calls) == 0 {
+		return ""
+	}
+
+	l.rounds++
+	if l.limits.MaxIterations > 0 && l.rounds > l.limits.MaxIterations {
+		return fmt.Sprintf("Stopped after %d rounds of tool calls, the most this agent can make in one turn.", l.limits.MaxIterations)
+	}
+
+	for _, call := range calls {
+		signature := call.Name + "\x00" + canonicalArguments(call.Arguments)
+		if signature == l.last {
+			l.repeats++
+		} else {
+			l.last, l.repeats = signature, 1
+		}
+		if l.limits.MaxRepeats > 0 && l.repeats > l.limits.MaxRepeats {
+			return fmt.Sprintf("Stopped because tool %s was called %d times in a row with the same arguments.", call.Name, l.limits.MaxRepeats)
+		}
+	}
+	return ""
+}
+
+// canonicalArguments returns the arguments with sorted keys, so that calls that only differ in the order
+// of their arguments are the same call.
+func canonicalArguments(arguments string) string {
+	var data any
+	if err := json.Unmarshal([]byte(arguments), &data); err != nil {
+		return arguments
+	}
+	canonical, err := json.Marshal(data)
+	if err != nil {
+		return arguments
+	}
+	return string(canonical)
+}
+
+// stopLoop ends the turn without running the tool calls of the run. The calls get the reason as their
+// result, so that the thread stays valid and the LLM knows why they were not made, and the response
+// is the reason.
+func stopLoop(run *types.Execution, reason string) *types.CompletionResponse {
+	if run.ToolOutputs == nil {
+		run.ToolOutputs = make(map[string]types.ToolOutput)
+	}
+	for _, call := range plannedToolCalls(run) {
+		run.ToolOutputs[call.CallID] = types.ToolOutput{
+			Output: types.Message{
+				Role: "user",
+				Items: []types.CompletionItem{
+					{
+						ToolCallResult: &types.ToolCallResult{
+							CallID: call.CallID,
+							Output: types.CallResult{
+								Content: []mcp.Content{{Type: "text", Text: reason + " The tool was not called."}},
+								IsError: true,
+							},
+						},
+					},
+				},
+			},
+			Done: true,
+		}
+	}
+	run.Done = true
+
+	now := time.Now()
+	id := uuid.String()
+	resp := *run.Response
+	resp.Output = types.Message{
+		ID:      id,
+		Created: &now,
+		Role:    "assistant",
+		Items: []types.CompletionItem{
+			{
+				ID: id + "_0",
+				Content: &mcp.Content{
+					Type: "text",
+					Text: reason,
+				},
+			},
+		},
+	}
+	return &resp
+}
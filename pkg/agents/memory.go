@@ -0,0 +1,141 @@
+package agents
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/knowledge"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/memory"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+type recalledKey struct{}
+
+func withRecalled(ctx context.Context, recalled string) context.Context {
+	return context.WithValue(ctx, recalledKey{}, recalled)
+}
+
+// recalledFromContext returns the memories and knowledge recalled for the current turn, added to the
+// system prompt of every completion of the turn.
+func recalledFromContext(ctx context.Context) string {
+	recalled, _ := ctx.Value(recalledKey{}).(string)
+	return recalled
+}
+
+func contentText(contents ...mcp.Content) string {
+	var texts []string
+	for _, content := range contents {
+		if content.Type == "text" && strings.TrimSpace(content.Text) != "" {
+			texts = append(texts, content.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func messagesText(messages []types.Message, role string) string {
+	var texts []string
+	for _, msg := range messages {
+		if msg.Role != role {
+			continue
+		}
+		for _, item := range msg.Items {
+			if item.Content != nil {
+				if text := contentText(*item.Content); text != "" {
+					texts = append(texts, text)
+				}
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// recall adds the memories of the agent and the knowledge relevant to the input to the context,
+// replacing what was recalled for an agent that called this one. Failing to recall does not fail the turn.
+func (a *Agents) recall(ctx context.Context, config types.Config, agentName string, input []types.Message) context.Context {
+	var (
+		agent    = config.Agents[agentName]
+		query    = messagesText(input, "user")
+		recalled []string
+	)
+
+	if a.memory != nil && agent.Memory != nil {
+		memories, err := a.memory.Recall(ctx, config, agentName, query)
+		if err != nil {
+			log.Errorf(ctx, "failed to recall memories of agent %s: %v", agentName, err)
+		} else if memories != "" {
+			recalled = append(recalled, memories)
+		}
+	}
+
+	if a.knowledge != nil && agent.Knowledge != nil && agent.Knowledge.Inject && strings.TrimSpace(query) != "" {
+		matches, err := a.knowledge.Search(ctx, config, agentName, query)
+		if err != nil {
+			log.Errorf(ctx, "failed to search knowledge of agent %s: %v", agentName, err)
+		} else if len(matches) > 0 {
+			recalled = append(recalled, "Passages from the knowledge base that may be relevant:\n\n"+knowledge.Format(matches))
+		}
+	}
+
+	if len(recalled) == 0 && recalledFromContext(ctx) == "" {
+		return ctx
+	}
+	return withRecalled(ctx, strings.Join(recalled, "\n\n"))
+}
+
+// toolMemoryParts returns the results of the tool calls of the run as memory parts.
+func toolMemoryParts(run *types.Execution) (parts []memory.Part) {
+	names := map[string]string{}
+	if run.Response != nil {
+		for _, item := range run.Response.Output.Items {
+			if item.ToolCall != nil {
+				names[item.ToolCall.CallID] = item.ToolCall.Name
+			}
+		}
+	}
+
+	for _, callID := range toolOutputOrder(run) {
+		output := run.ToolOutputs[callID]
+		if !output.Done {
+			continue
+		}
+		for _, item := range output.Output.Items {
+			if item.ToolCallResult == nil || item.ToolCallResult.Output.IsError {
+				continue
+			}
+			if text := contentText(item.ToolCallResult.Output.Content...); text != "" {
+				parts = append(parts, memory.Part{
+					Kind: types.RememberTools,
+					Text: names[callID] + " returned " + text,
+				})
+			}
+		}
+	}
+	return parts
+}
+
+// remember stores the turn in the memory of the agent in the background, so that embedding it does not
+// delay the response.
+func (a *Agents) remember(ctx context.Context, config types.Config, agentName string, input []types.Message, resp *types.CompletionResponse, toolParts []memory.Part) {
+	if a.memory == nil || config.Agents[agentName].Memory == nil {
+		return
+	}
+
+	parts := []memory.Part{{
+		Kind: types.RememberUser,
+		Text: messagesText(input, "user"),
+	}}
+	parts = append(parts, toolParts...)
+	parts = append(parts, memory.Part{
+		Kind: types.RememberAssistant,
+		Text: messagesText([]types.Message{resp.Output}, "assistant"),
+	})
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := a.memory.Remember(ctx, config, agentName, parts); err != nil {
+			log.Errorf(ctx, "failed to remember turn of agent %s: %v", agentName, err)
+		}
+	}()
+}
@@ -0,0 +1,133 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/metrics"
+	"github.com/nanobot-ai/nanobot/pkg/schema"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const defaultOutputRetries = 2
+
+func outputText(resp *types.CompletionResponse) (string, bool) {
+	var text strings.Builder
+	for _, item := range resp.Output.Items {
+		if item.ToolCall != nil {
+			// Not the final response of the agent yet
+			return "", false
+		}
+		if item.Content != nil && item.Content.Type == "text" {
+			text.WriteString(item.Content.Text)
+		}
+	}
+	return trimCodeFence(text.String()), true
+}
+
+// trimCodeFence removes a markdown code fence around JSON, which some models add even when asked not to.
+func trimCodeFence(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") {
+		return text
+	}
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "```"), "```")
+	trimmed = strings.TrimPrefix(trimmed, "json")
+	return strings.TrimSpace(trimmed)
+}
+
+// enforceOutputSchema validates the final response of the LLM against the output schema of the
+// request. If it does not match, the LLM is asked again with the validation errors as feedback.
+func (a *Agents) enforceOutputSchema(ctx context.Context, config types.Config, req types.CompletionRequest, resp *types.CompletionResponse, opts []types.CompletionOptions) (*types.CompletionResponse, error) {
+	if req.OutputSchema == nil {
+		return resp, nil
+	}
+	outputSchema := req.OutputSchema.ToSchema()
+	if len(outputSchema) == 0 {
+		return resp, nil
+	}
+
+	maxRetries := req.OutputSchema.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultOutputRetries
+	}
+
+	for attempt := 1; ; attempt++ {
+		output, final := outputText(resp)
+		if !final {
+			return resp, nil
+		}
+
+		err := schema.ValidateJSON(outputSchema, output)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt > maxRetries {
+			return nil, &types.OutputValidationError{
+				Agent:    req.Agent,
+				Attempts: attempt,
+				Output:   output,
+				Err:      err,
+			}
+		}
+
+		log.Debugf(ctx, "output of agent %s does not match the output schema, retrying (%d/%d): %v", req.Agent, attempt, maxRetries, err)
+
+		retry := req
+		retry.Input = append(slices.Clone(req.Input), resp.Output, textMessage(fmt.Sprintf(
+			"The response does not match the required output schema %q: %v\n\nRespond again with only the JSON that matches the schema.",
+			req.OutputSchema.Name, err)))
+
+		if err := checkLimits(ctx, config, req.Agent); err != nil {
+			metrics.Error(metrics.ErrorLimitExceeded, err)
+			return nil, err
+		}
+		resp, err = a.complete(ctx, retry, opts...)
+		if err != nil {
+			return nil, err
+		}
+		recordUsage(ctx, config, req.Agent, resp)
+	}
+}
+
+// preferStructuredContent replaces the text content of the tool results that have structured content
+// with the structured content as JSON, the text of newer MCP servers is only a fallback for clients that
+// do not support structured content. Content that is not text, like images, is kept. It runs before the
+// middleware, so that the middleware sees the content the model gets.
+func preferStructuredContent(req types.CompletionRequest) types.CompletionRequest {
+	input := slices.Clone(req.Input)
+	for i, msg := range input {
+		cloned := false
+		for j, item := range msg.Items {
+			if item.ToolCallResult == nil || item.ToolCallResult.Output.StructuredContent == nil {
+				continue
+			}
+			data, err := json.Marshal(item.ToolCallResult.Output.StructuredContent)
+			if err != nil {
+				continue
+			}
+
+			result := *item.ToolCallResult
+			result.Output.StructuredContent = nil
+			result.Output.Content = []mcp.Content{{Type: "text", Text: string(data)}}
+			for _, content := range item.ToolCallResult.Output.Content {
+				if content.Text == "" {
+					result.Output.Content = append(result.Output.Content, content)
+				}
+			}
+
+			if !cloned {
+				input[i].Items = slices.Clone(msg.Items)
+				cloned = true
+			}
+			input[i].Items[j].ToolCallResult = &result
+		}
+	}
+	req.Input = input
+	return req
+}
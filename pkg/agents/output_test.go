@@ -0,0 +1,50 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+type completerFunc func(ctx context.Context, req types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error)
+
+func (f completerFunc) Complete(ctx context.Context, req types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error) {
+	return f(ctx, req, opts...)
+}
+
+func TestEnforceOutputSchemaLimits(t *testing.T) {
+	ctx := mcp.WithSession(context.Background(), checkpointSession(t))
+	config := types.Config{
+		Agents: map[string]types.Agent{"agent": {Limits: &types.Limits{RequestsPerMinute: 3}}},
+	}
+	invalid := &types.CompletionResponse{Output: textMessage("not JSON")}
+
+	var completions int
+	a := &Agents{
+		completer: completerFunc(func(context.Context, types.CompletionRequest, ...types.CompletionOptions) (*types.CompletionResponse, error) {
+			completions++
+			return invalid, nil
+		}),
+	}
+
+	// The first request of the turn
+	if err := checkLimits(ctx, config, "agent"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := a.enforceOutputSchema(ctx, config, types.CompletionRequest{
+		Agent:        "agent",
+		OutputSchema: &types.OutputSchema{Schema: json.RawMessage(`{"type": "object"}`), MaxRetries: 5},
+	}, invalid, nil)
+
+	var limitErr *types.LimitExceededError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected a limit exceeded error, got %v", err)
+	}
+	if completions != 2 {
+		t.Errorf("expected 2 retries within the limit of 3 requests, got %d", completions)
+	}
+}
@@ -3,25 +3,51 @@ package agents
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"maps"
 	"slices"
 	"strings"
 	"time"
 
+	"github.com/nanobot-ai/nanobot/pkg/analytics"
+	"github.com/nanobot-ai/nanobot/pkg/audit"
+	"github.com/nanobot-ai/nanobot/pkg/codeexec"
 	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/experiments"
+	"github.com/nanobot-ai/nanobot/pkg/guardrails"
+	"github.com/nanobot-ai/nanobot/pkg/knowledge"
 	"github.com/nanobot-ai/nanobot/pkg/llm/progress"
+	"github.com/nanobot-ai/nanobot/pkg/log"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/memory"
+	"github.com/nanobot-ai/nanobot/pkg/metrics"
+	"github.com/nanobot-ai/nanobot/pkg/middleware"
+	"github.com/nanobot-ai/nanobot/pkg/orchestration"
 	"github.com/nanobot-ai/nanobot/pkg/schema"
 	"github.com/nanobot-ai/nanobot/pkg/sessiondata"
+	"github.com/nanobot-ai/nanobot/pkg/similarity"
+	"github.com/nanobot-ai/nanobot/pkg/telemetry"
+	"github.com/nanobot-ai/nanobot/pkg/tokens"
 	"github.com/nanobot-ai/nanobot/pkg/tools"
 	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/untrusted"
 	"github.com/nanobot-ai/nanobot/pkg/uuid"
+	"github.com/nanobot-ai/nanobot/pkg/web"
 )
 
 type Agents struct {
-	completer types.Completer
-	registry  *tools.Service
+	completer    types.Completer
+	registry     *tools.Service
+	orchestrator *orchestration.Orchestrator
+	memory       *memory.Service
+	knowledge    *knowledge.Service
+	speech       types.SpeechConverter
+	// chain runs on the turns of all agents, before the middleware of the config.
+	chain      middleware.Chain
+	guardrails *guardrails.Checker
+	untrusted  *untrusted.Checker
 }
 
 type ToolListOptions struct {
@@ -29,19 +55,33 @@ type ToolListOptions struct {
 	Names    []string
 }
 
-func New(completer types.Completer, registry *tools.Service) *Agents {
-	return &Agents{
-		completer: completer,
-		registry:  registry,
-	}
+func New(completer types.Completer, registry *tools.Service, memory *memory.Service, knowledge *knowledge.Service, speech types.SpeechConverter, moderator types.Moderator, chain middleware.Chain) *Agents {
+	a := &Agents{
+		completer:  completer,
+		registry:   registry,
+		memory:     memory,
+		knowledge:  knowledge,
+		speech:     speech,
+		chain:      chain,
+		guardrails: guardrails.NewChecker(completer, moderator),
+		untrusted:  untrusted.NewChecker(completer),
+	}
+	a.orchestrator = orchestration.New(a, completer)
+	return a
 }
 
-func (a *Agents) addTools(ctx context.Context, req *types.CompletionRequest, agent *types.Agent) (types.ToolMappings, error) {
-	toolMappings, err := a.registry.BuildToolMappings(ctx, slices.Concat(agent.Tools, agent.Agents, agent.Flows, agent.MCPServers))
+func (a *Agents) addTools(ctx context.Context, config types.Config, req *types.CompletionRequest, agent *types.Agent) (types.ToolMappings, error) {
+	toolMappings, err := a.registry.BuildToolMappings(ctx, slices.Concat([]string(agent.Tools), agent.Agents, agent.Flows, agent.MCPServers))
 	if err != nil {
 		return nil, fmt.Errorf("failed to build tool mappings: %w", err)
 	}
 
+	maps.Copy(toolMappings, orchestration.ToolMappings(config, agent.Handoff))
+	maps.Copy(toolMappings, knowledge.ToolMappings(req.Agent, agent.Knowledge))
+	maps.Copy(toolMappings, similarity.ToolMappings(req.Agent, agent.Similarity))
+	maps.Copy(toolMappings, codeexec.ToolMappings(req.Agent, agent.Exec))
+	maps.Copy(toolMappings, web.ToolMappings(req.Agent, agent.Web))
+
 	for _, key := range slices.Sorted(maps.Keys(toolMappings)) {
 		toolMapping := toolMappings[key]
 
@@ -90,6 +130,32 @@ func populateToolCallResult(previousRun *types.Execution, req *types.CompletionR
 	req.Input = nil
 }
 
+// toolOutputOrder returns the call IDs of the tool outputs in the order the LLM made the calls, so the
+// results are sent back in the same order no matter which call finished first.
+func toolOutputOrder(run *types.Execution) []string {
+	var (
+		order []string
+		seen  = map[string]bool{}
+	)
+	if run.Response != nil {
+		for _, item := range run.Response.Output.Items {
+			if item.ToolCall == nil || seen[item.ToolCall.CallID] {
+				continue
+			}
+			if _, ok := run.ToolOutputs[item.ToolCall.CallID]; ok {
+				order = append(order, item.ToolCall.CallID)
+				seen[item.ToolCall.CallID] = true
+			}
+		}
+	}
+	for _, callID := range slices.Sorted(maps.Keys(run.ToolOutputs)) {
+		if !seen[callID] {
+			order = append(order, callID)
+		}
+	}
+	return order
+}
+
 func (a *Agents) populateRequest(ctx context.Context, config types.Config, run *types.Execution, previousRun *types.Execution) (types.CompletionRequest, types.ToolMappings, error) {
 	req := run.Request
 
@@ -118,7 +184,7 @@ func (a *Agents) populateRequest(ctx context.Context, config types.Config, run *
 			}
 		}
 
-		for _, callID := range slices.Sorted(maps.Keys(previousRun.ToolOutputs)) {
+		for _, callID := range toolOutputOrder(previousRun) {
 			toolCall := previousRun.ToolOutputs[callID]
 			if toolCall.Done {
 				input = append(input, toolCall.Output)
@@ -134,13 +200,22 @@ func (a *Agents) populateRequest(ctx context.Context, config types.Config, run *
 		agentName = req.Model
 	}
 
+	// Log lines of the turn, and of the turns of the agents it calls, have the ID of the turn
+	if !slices.ContainsFunc(log.Attrs(ctx), func(attr slog.Attr) bool { return attr.Key == "turn_id" }) {
+		ctx = log.With(ctx, slog.String("turn_id", uuid.String()))
+	}
+	ctx = log.With(ctx, slog.String("agent", agentName))
+
 	agent, ok := config.Agents[agentName]
 	if !ok {
 		return req, nil, nil
 	}
 
 	req.Agent = agentName
-	req.Reasoning = agent.Reasoning
+	if req.Reasoning == nil {
+		req.Reasoning = agent.Reasoning
+	}
+	req.SafetySettings = agent.SafetySettings
 
 	if req.SystemPrompt != "" {
 		var agentInstructions types.DynamicInstructions
@@ -159,6 +234,10 @@ func (a *Agents) populateRequest(ctx context.Context, config types.Config, run *
 		}
 	}
 
+	if recalled := recalledFromContext(ctx); recalled != "" {
+		req.SystemPrompt = strings.TrimSpace(req.SystemPrompt + "\n\n" + recalled)
+	}
+
 	if req.TopP == nil && agent.TopP != nil {
 		req.TopP = agent.TopP
 	}
@@ -167,6 +246,22 @@ func (a *Agents) populateRequest(ctx context.Context, config types.Config, run *
 		req.Temperature = agent.Temperature
 	}
 
+	if req.Stop == nil && agent.Stop != nil {
+		req.Stop = agent.Stop
+	}
+
+	if req.FrequencyPenalty == nil && agent.FrequencyPenalty != nil {
+		req.FrequencyPenalty = agent.FrequencyPenalty
+	}
+
+	if req.PresencePenalty == nil && agent.PresencePenalty != nil {
+		req.PresencePenalty = agent.PresencePenalty
+	}
+
+	if req.Seed == nil && agent.Seed != nil {
+		req.Seed = agent.Seed
+	}
+
 	if req.Truncation == "" && agent.Truncation != "" {
 		req.Truncation = agent.Truncation
 	}
@@ -190,6 +285,7 @@ func (a *Agents) populateRequest(ctx context.Context, config types.Config, run *
 			Description: agent.Output.Description,
 			Schema:      agent.Output.ToSchema(),
 			Strict:      agent.Output.Strict,
+			MaxRetries:  agent.Output.MaxRetries,
 		}
 	}
 
@@ -201,9 +297,15 @@ func (a *Agents) populateRequest(ctx context.Context, config types.Config, run *
 		req.ThreadName = agent.ThreadName
 	}
 
-	req.Model = agent.Model
+	req.Model = agent.Model.Primary()
+	req.FallbackModels = agent.Model.Fallbacks()
+	if req.ModelOverride != "" {
+		req.Model = req.ModelOverride
+		req.FallbackModels = nil
+	}
+	req.BaseURL = agent.BaseURL
 
-	toolMapping, err := a.addTools(ctx, &req, &agent)
+	toolMapping, err := a.addTools(ctx, config, &req, &agent)
 	if err != nil {
 		return req, nil, fmt.Errorf("failed to add tools: %w", err)
 	}
@@ -380,6 +482,7 @@ func (a *Agents) handleUIAction(ctx context.Context, config types.Config, req ty
 func (a *Agents) Complete(ctx context.Context, req types.CompletionRequest, opts ...types.CompletionOptions) (_ *types.CompletionResponse, err error) {
 	var (
 		previousExecutionKey = types.PreviousExecutionKey
+		checkpointKey        = types.CheckpointKey
 		session              = mcp.SessionFromContext(ctx)
 		isChat               = session != nil
 		previousRun          *types.Execution
@@ -388,9 +491,20 @@ func (a *Agents) Complete(ctx context.Context, req types.CompletionRequest, opts
 		startID              = ""
 	)
 
-	for session != nil && session.Parent != nil {
-		session = session.Parent
+	session = session.Root()
+
+	// Sessions of an experiment run the variant of the agent they are assigned to
+	if req.Agent == "" {
+		req.Model = experiments.Route(ctx, config, req.Model)
+	}
+
+	ctx, span := telemetry.Start(ctx, "agent.complete", telemetry.AgentName.String(req.Model))
+	if session != nil {
+		span.SetAttributes(telemetry.SessionID.String(session.ID()))
 	}
+	defer func() {
+		telemetry.End(span, err)
+	}()
 
 	if len(req.Input) > 0 {
 		startID = req.Input[0].ID
@@ -402,6 +516,19 @@ func (a *Agents) Complete(ctx context.Context, req types.CompletionRequest, opts
 
 	if req.ThreadName != "" {
 		previousExecutionKey = fmt.Sprintf("%s/%s", previousExecutionKey, req.ThreadName)
+		checkpointKey = fmt.Sprintf("%s/%s", checkpointKey, req.ThreadName)
+	}
+
+	// A resumed turn continues with the request and the runs of its checkpoint
+	var resumed *types.Checkpoint
+	if req.Resume {
+		if lookup := (types.Checkpoint{}); session.Get(checkpointKey, &lookup) && lookup.Run != nil {
+			resumed = &lookup
+		} else {
+			return nil, ErrNoCheckpoint
+		}
+		req = resumed.Request
+		startID = resumed.StartID
 	}
 
 	if isChat && config.Agents[req.Model].Chat != nil && !*config.Agents[req.Model].Chat {
@@ -416,17 +543,45 @@ func (a *Agents) Complete(ctx context.Context, req types.CompletionRequest, opts
 		req.InputAsToolResult = &isChat
 	}
 
+	agentName := req.Agent
+	if agentName == "" {
+		agentName = req.Model
+	}
+
+	if timeout := config.GetTurnTimeout(agentName); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, &types.TimeoutError{
+			Kind:    types.TimeoutTurn,
+			Name:    agentName,
+			Timeout: timeout.String(),
+		})
+		defer cancel()
+	}
+
+	var audioInput bool
+	if resumed != nil {
+		audioInput = resumed.AudioInput
+	} else if req.Input, audioInput, err = a.transcribe(ctx, config, agentName, req.Input); err != nil {
+		return nil, err
+	}
+
 	// Save the original request to the Execution status
 	currentRun.Request = req
 
+	var (
+		checkpoint *checkpointer
+		// fallBack is the thread that is restored if the turn fails
+		fallBack *types.Execution
+	)
 	if isChat {
-		var fallBack *types.Execution
-		if lookup := (types.Execution{}); session.Get(previousExecutionKey, &lookup) {
+		if resumed != nil {
+			fallBack, previousRun, currentRun = resumed.Fallback, resumed.Previous, resumed.Run
+		} else if lookup := (types.Execution{}); session.Get(previousExecutionKey, &lookup) {
 			fallBack = &lookup
 			previousRun = &lookup
 		}
 
-		if req.NewThread && previousRun != nil {
+		if req.NewThread && previousRun != nil && resumed == nil {
 			session.Set(previousExecutionKey+"/"+time.Now().Format(time.RFC3339), previousRun)
 			session.Set(previousExecutionKey, nil)
 		}
@@ -436,20 +591,92 @@ func (a *Agents) Complete(ctx context.Context, req types.CompletionRequest, opts
 				session.Set(previousExecutionKey, fallBack)
 			}
 		}()
+
+		checkpoint, err = newCheckpointer(config, agentName, session, checkpointKey, types.Checkpoint{
+			StartID:    startID,
+			Request:    req,
+			Fallback:   fallBack,
+			AudioInput: audioInput,
+		}, resumed != nil)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			checkpoint.done(ctx, err)
+		}()
+		if resumed != nil && checkpoint == nil {
+			// The agent no longer checkpoints its turns, the checkpoint is resumed once
+			session.Set(checkpointKey, nil)
+		}
+	} else if resumed != nil {
+		return nil, fmt.Errorf("only the turns of chats can be resumed")
 	}
 
+	ctx = a.recall(ctx, config, agentName, req.Input)
+
+	var (
+		toolMemories []memory.Part
+		// turn counts the tool calls of the turn for the analytics of the session
+		turn = analytics.Turn{Agent: agentName, Time: time.Now().UTC()}
+		// lastRun is the last run of this turn that got a response from the LLM
+		lastRun *types.Execution
+		guard   = newLoopGuard(config.Agents[agentName].Loop)
+		// skipRun is true if the turn resumes with the tool calls of a completion of its checkpoint
+		skipRun = resumed != nil && currentRun.Response != nil
+	)
 	for {
-		if err := a.run(ctx, config, currentRun, previousRun, opts); err != nil {
-			return nil, err
+		if !skipRun {
+			compacted, err := a.run(ctx, config, currentRun, previousRun, opts)
+			if compacted != nil && lastRun == nil && fallBack != nil {
+				// Keep the summary of the older messages if the turn fails, it is not computed again.
+				fallBack = compacted
+				checkpoint.fallback(compacted)
+			}
+			if err != nil {
+				if resp, ok := timedOut(ctx, lastRun, startID, isChat); ok {
+					return resp, nil
+				}
+				return nil, err
+			}
+		}
+		skipRun = false
+		lastRun = currentRun
+
+		if types.NanobotContext(ctx).DryRun {
+			// The thread is not updated, the planned calls never become part of it.
+			if planned := plannedToolCalls(currentRun); len(planned) > 0 {
+				resp := *currentRun.Response
+				resp.PlannedToolCalls = planned
+				return &resp, nil
+			}
+		}
+
+		if reason := guard.check(currentRun); reason != "" {
+			log.Debugf(ctx, "agent %s: %s", agentName, reason)
+			resp := stopLoop(currentRun, reason)
+			recordTurn(ctx, turn, resp)
+			if isChat {
+				currentRun.Response.ChatResponse = true
+				resp.ChatResponse = true
+				session.Set(previousExecutionKey, currentRun)
+			}
+			resp.InternalMessages = turnMessages(currentRun, startID, resp.InternalMessages)
+			return resp, nil
 		}
 
 		if isChat {
 			session.Set(previousExecutionKey, currentRun)
 		}
+		checkpoint.save(ctx, previousRun, currentRun)
 
-		if err := a.toolCalls(ctx, config, currentRun, opts); err != nil {
+		if err := a.toolCalls(ctx, config, currentRun, checkpoint, opts); err != nil {
+			if resp, ok := timedOut(ctx, lastRun, startID, isChat); ok {
+				return resp, nil
+			}
 			return nil, err
 		}
+		toolMemories = append(toolMemories, toolMemoryParts(currentRun)...)
+		countToolCalls(&turn, currentRun)
 
 		if isChat {
 			for _, toolOutput := range currentRun.ToolOutputs {
@@ -476,15 +703,11 @@ func (a *Agents) Complete(ctx context.Context, req types.CompletionRequest, opts
 			}
 
 			finalResponse := *currentRun.Response
+			recordTurn(ctx, turn, &finalResponse)
+			a.remember(ctx, config, agentName, req.Input, &finalResponse, toolMemories)
+			a.synthesize(ctx, config, agentName, audioInput, &finalResponse)
 
-			if startID != "" && currentRun.PopulatedRequest != nil {
-				i := slices.IndexFunc(currentRun.PopulatedRequest.Input, func(msg types.Message) bool {
-					return msg.ID == startID
-				})
-				if i >= 0 {
-					finalResponse.InternalMessages = types.ConsolidateTools(currentRun.PopulatedRequest.Input[i:])
-				}
-			}
+			finalResponse.InternalMessages = turnMessages(currentRun, startID, finalResponse.InternalMessages)
 
 			return &finalResponse, nil
 		}
@@ -496,18 +719,113 @@ func (a *Agents) Complete(ctx context.Context, req types.CompletionRequest, opts
 	}
 }
 
+// countToolCalls adds the tool calls of the run, and those that returned an error, to the turn.
+func countToolCalls(turn *analytics.Turn, run *types.Execution) {
+	for _, toolOutput := range run.ToolOutputs {
+		for _, output := range toolOutput.Output.Items {
+			if output.ToolCallResult == nil {
+				continue
+			}
+			turn.ToolCalls++
+			if output.ToolCallResult.Output.IsError {
+				turn.ToolErrors++
+			}
+		}
+	}
+}
+
+// recordTurn records the turn with the message and model of its response in the analytics of the session.
+func recordTurn(ctx context.Context, turn analytics.Turn, resp *types.CompletionResponse) {
+	if resp == nil {
+		return
+	}
+	turn.MessageID = resp.Output.ID
+	turn.Model = resp.Model
+	turn.DurationMS = time.Since(turn.Time).Milliseconds()
+	analytics.RecordTurn(ctx, turn)
+}
+
+// turnMessages returns the messages of the request of the run from the first message of the turn on.
+func turnMessages(run *types.Execution, startID string, def []types.Message) []types.Message {
+	if startID == "" || run.PopulatedRequest == nil {
+		return def
+	}
+	i := slices.IndexFunc(run.PopulatedRequest.Input, func(msg types.Message) bool {
+		return msg.ID == startID
+	})
+	if i < 0 {
+		return def
+	}
+	return types.ConsolidateTools(run.PopulatedRequest.Input[i:])
+}
+
+// timedOut returns what the turn produced before it ran out of time if ctx ended because of the turn
+// timeout, with the timeout as the error of the response.
+func timedOut(ctx context.Context, lastRun *types.Execution, startID string, isChat bool) (*types.CompletionResponse, bool) {
+	var timeoutErr *types.TimeoutError
+	if !errors.As(context.Cause(ctx), &timeoutErr) || timeoutErr.Kind != types.TimeoutTurn {
+		return nil, false
+	}
+
+	resp := &types.CompletionResponse{}
+	if lastRun != nil && lastRun.Response != nil {
+		partial := *lastRun.Response
+		partial.InternalMessages = turnMessages(lastRun, startID, partial.InternalMessages)
+		resp = &partial
+	}
+	resp.ChatResponse = isChat
+	resp.HasMore = false
+	resp.Error = timeoutErr.Error()
+	return resp, true
+}
+
+// middleware returns the middleware of the agent, the middleware of the runtime and of the config run
+// first.
+func (a *Agents) middleware(config types.Config, agentName string) (middleware.Chain, error) {
+	chain, err := middleware.Load(slices.Concat(config.Middleware, config.Agents[agentName].Middleware))
+	if err != nil {
+		return nil, err
+	}
+	chain = slices.Concat(a.chain, chain)
+	if config := config.Agents[agentName].Untrusted; config != nil {
+		guard, err := a.untrusted.Middleware(agentName, *config)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, guard)
+	}
+	if guards := config.Agents[agentName].Guardrails; guards != nil {
+		// Guardrails run last on the request and first on the response
+		chain = append(chain, a.guardrails.Middleware(agentName, *guards))
+	}
+	return chain, nil
+}
+
 func (a *Agents) runBefore(ctx context.Context, config types.Config, req types.CompletionRequest) (types.CompletionRequest, *types.CompletionResponse, error) {
-	return req, nil, nil
+	chain, err := a.middleware(config, req.Agent)
+	if err != nil {
+		return req, nil, err
+	}
+	req = preferStructuredContent(req)
+	resp, err := chain.BeforeCompletion(ctx, &req)
+	return req, resp, err
 }
 
 func (a *Agents) runAfter(ctx context.Context, config types.Config, req types.CompletionRequest, resp *types.CompletionResponse) (*types.CompletionResponse, error) {
+	chain, err := a.middleware(config, req.Agent)
+	if err != nil {
+		return nil, err
+	}
+	if err := chain.AfterCompletion(ctx, req, resp); err != nil {
+		return nil, err
+	}
 	return resp, nil
 }
 
-func (a *Agents) run(ctx context.Context, config types.Config, run *types.Execution, prev *types.Execution, opts []types.CompletionOptions) error {
+func (a *Agents) run(ctx context.Context, config types.Config, run *types.Execution, prev *types.Execution, opts []types.CompletionOptions) (*types.Execution, error) {
 	completionRequest, toolMapping, err := a.populateRequest(ctx, config, run, prev)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Don't forget about old tools that might not be in use anymore. If the old name mapped to a
@@ -520,35 +838,110 @@ func (a *Agents) run(ctx context.Context, config types.Config, run *types.Execut
 
 	run.ToolToMCPServer = allToolMappings
 
+	uncompacted := len(completionRequest.Input)
+	completionRequest, err = a.compact(ctx, config, completionRequest, len(run.Request.Input))
+	if err != nil {
+		return nil, err
+	}
+	var compacted *types.Execution
+	if prev != nil && len(completionRequest.Input) < uncompacted {
+		compacted = compactedThread(prev, completionRequest.Input[:len(completionRequest.Input)-len(run.Request.Input)])
+	}
+
 	completionRequest, resp, err := a.runBefore(ctx, config, completionRequest)
 	if err != nil {
-		return fmt.Errorf("failed to run before agent: %w", err)
+		return compacted, fmt.Errorf("failed to run before agent: %w", err)
 	} else if resp != nil {
 		run.PopulatedRequest = &completionRequest
 		run.Response = resp
-		return nil
+		return compacted, nil
 	}
 
 	run.PopulatedRequest = &completionRequest
 
 	modifiedRequest, resp, err := a.handleUIAction(ctx, config, completionRequest, opts)
 	if err != nil {
-		return fmt.Errorf("failed to handle UI action: %w", err)
+		return compacted, fmt.Errorf("failed to handle UI action: %w", err)
 	} else if resp != nil {
 		run.Response = resp
-		return nil
+		return compacted, nil
+	}
+
+	if err := checkLimits(ctx, config, modifiedRequest.Agent); err != nil {
+		metrics.Error(metrics.ErrorLimitExceeded, err)
+		return compacted, err
+	}
+
+	resp, err = a.complete(ctx, modifiedRequest, opts...)
+	if err != nil {
+		return compacted, err
 	}
 
-	resp, err = a.completer.Complete(ctx, modifiedRequest, opts...)
+	recordUsage(ctx, config, modifiedRequest.Agent, resp)
+
+	resp, err = a.enforceOutputSchema(ctx, config, modifiedRequest, resp, opts)
 	if err != nil {
-		return err
+		return compacted, err
 	}
 
 	resp, err = a.runAfter(ctx, config, completionRequest, resp)
 	if err != nil {
-		return fmt.Errorf("failed to run after agent: %w", err)
+		return compacted, fmt.Errorf("failed to run after agent: %w", err)
 	}
 
 	run.Response = resp
-	return nil
+	return compacted, nil
+}
+
+func (a *Agents) complete(ctx context.Context, req types.CompletionRequest, opts ...types.CompletionOptions) (resp *types.CompletionResponse, err error) {
+	ctx, span := telemetry.Start(ctx, "llm.completion", telemetry.AgentName.String(req.Agent), telemetry.Model.String(req.Model))
+	start := time.Now()
+	defer func() {
+		if resp != nil && resp.Usage != nil {
+			span.SetAttributes(telemetry.InputTokens.Int(resp.Usage.InputTokens), telemetry.OutputTokens.Int(resp.Usage.OutputTokens))
+		}
+		telemetry.End(span, err)
+		metrics.ObserveCompletion(req.Model, start, resp, err)
+		recordCompletion(ctx, req, resp, err)
+	}()
+
+	resp, err = a.completer.Complete(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	countTokens(req, resp)
+	return resp, nil
+}
+
+// countTokens records the output tokens on the output message, and counts the usage of the completion
+// with the tokenizer of the model if the provider did not report it.
+func countTokens(req types.CompletionRequest, resp *types.CompletionResponse) {
+	if resp == nil {
+		return
+	}
+	if resp.Usage == nil {
+		model := complete.First(resp.Model, req.Model)
+		resp.Usage = &types.Usage{
+			InputTokens:  tokens.Request(model, req),
+			OutputTokens: tokens.Message(model, resp.Output),
+			Estimated:    true,
+		}
+	}
+	resp.Output.Tokens = resp.Usage.OutputTokens
+}
+
+func recordCompletion(ctx context.Context, req types.CompletionRequest, resp *types.CompletionResponse, err error) {
+	event := audit.Event{
+		Type:  audit.ModelRequest,
+		Agent: req.Agent,
+		Model: req.Model,
+	}
+	if resp != nil && resp.Usage != nil {
+		event.InputTokens = resp.Usage.InputTokens
+		event.OutputTokens = resp.Usage.OutputTokens
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	audit.Record(ctx, event)
 }
@@ -0,0 +1,101 @@
+package agents
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// transcribe replaces the audio input of the user with its transcription, if the agent transcribes
+// speech. It returns true if the input had audio.
+func (a *Agents) transcribe(ctx context.Context, config types.Config, agentName string, input []types.Message) ([]types.Message, bool, error) {
+	var (
+		speech   = config.Agents[agentName].Speech
+		hasAudio bool
+	)
+
+	result := slices.Clone(input)
+	for i, msg := range result {
+		if msg.Role != "user" {
+			continue
+		}
+		cloned := false
+		for j, item := range msg.Items {
+			if item.Content == nil || item.Content.Type != "audio" {
+				continue
+			}
+			hasAudio = true
+			if a.speech == nil || speech == nil || speech.Transcription == nil {
+				continue
+			}
+
+			audio, err := base64.StdEncoding.DecodeString(item.Content.Data)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to decode audio input: %w", err)
+			}
+			text, err := a.speech.Transcribe(ctx, *speech.Transcription, item.Content.MIMEType, audio)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to transcribe audio input: %w", err)
+			}
+
+			if !cloned {
+				msg.Items = slices.Clone(msg.Items)
+				cloned = true
+			}
+			msg.Items[j] = types.CompletionItem{
+				ID: item.ID,
+				Content: &mcp.Content{
+					Type: "text",
+					Text: text,
+				},
+			}
+			result[i] = msg
+		}
+	}
+
+	return result, hasAudio, nil
+}
+
+// synthesize adds the speech of the text of the reply to its output, if the agent synthesizes replies to
+// this input. Failing to synthesize does not fail the turn, the reply still has its text.
+func (a *Agents) synthesize(ctx context.Context, config types.Config, agentName string, audioInput bool, resp *types.CompletionResponse) {
+	speech := config.Agents[agentName].Speech
+	if a.speech == nil || speech == nil || speech.Synthesis == nil || (!audioInput && !speech.Synthesis.Always) {
+		return
+	}
+
+	var texts []string
+	for _, item := range resp.Output.Items {
+		if item.Content != nil {
+			if text := contentText(*item.Content); text != "" {
+				texts = append(texts, text)
+			}
+		}
+	}
+	text := strings.Join(texts, "\n")
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+
+	audio, err := a.speech.Synthesize(ctx, *speech.Synthesis, text)
+	if err != nil {
+		log.Errorf(ctx, "failed to synthesize reply of agent %s: %v", agentName, err)
+		return
+	}
+
+	resp.Output.Items = append(slices.Clone(resp.Output.Items), types.CompletionItem{
+		ID: uuid.String(),
+		Content: &mcp.Content{
+			Type:     "audio",
+			Data:     base64.StdEncoding.EncodeToString(audio),
+			MIMEType: speech.Synthesis.MIMEType(),
+		},
+	})
+}
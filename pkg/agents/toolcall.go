@@ -3,15 +3,59 @@ package agents
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/nanobot-ai/nanobot/pkg/codeexec"
 	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/knowledge"
+	"github.com/nanobot-ai/nanobot/pkg/log"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/middleware"
+	"github.com/nanobot-ai/nanobot/pkg/orchestration"
+	"github.com/nanobot-ai/nanobot/pkg/schema"
+	"github.com/nanobot-ai/nanobot/pkg/similarity"
 	"github.com/nanobot-ai/nanobot/pkg/tools"
 	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/web"
+	"github.com/nanobot-ai/nanobot/pkg/workdir"
+	"golang.org/x/sync/errgroup"
 )
 
-func (a *Agents) toolCalls(ctx context.Context, config types.Config, run *types.Execution, opts []types.CompletionOptions) error {
+const defaultToolConcurrency = 8
+
+type pendingToolCall struct {
+	target     types.TargetMapping[mcp.Tool]
+	invocation tools.ToolCallInvocation
+	output     *types.Message
+}
+
+// plannedToolCalls returns the tool calls of the response that have not run yet.
+func plannedToolCalls(run *types.Execution) (result []types.PlannedToolCall) {
+	for _, output := range run.Response.Output.Items {
+		functionCall := output.ToolCall
+		if functionCall == nil || run.ToolOutputs[functionCall.CallID].Done {
+			continue
+		}
+
+		target := run.ToolToMCPServer[functionCall.Name]
+		result = append(result, types.PlannedToolCall{
+			CallID:    functionCall.CallID,
+			Name:      functionCall.Name,
+			MCPServer: target.MCPServer,
+			Tool:      target.TargetName,
+			Arguments: functionCall.Arguments,
+		})
+	}
+	return
+}
+
+// toolCalls runs the tool calls of the response concurrently, limited by the toolConcurrency of the
+// config and the maxConcurrency of each MCP server. If a call fails the calls still running are
+// canceled.
+func (a *Agents) toolCalls(ctx context.Context, config types.Config, run *types.Execution, checkpoint *checkpointer, opts []types.CompletionOptions) error {
+	var pending []*pendingToolCall
 	for _, output := range run.Response.Output.Items {
 		functionCall := output.ToolCall
 
@@ -28,25 +72,102 @@ func (a *Agents) toolCalls(ctx context.Context, config types.Config, run *types.
 			return fmt.Errorf("can not map tool %s to a MCP server", functionCall.Name)
 		}
 
-		callOutput, err := a.invoke(ctx, config, targetServer, tools.ToolCallInvocation{
-			MessageID: run.Response.Output.ID,
-			ItemID:    output.ID,
-			ToolCall:  *functionCall,
-		}, opts)
-		if err != nil {
-			return fmt.Errorf("failed to invoke tool %s on MCP server %s: %w", functionCall.Name, targetServer.MCPServer, err)
+		pending = append(pending, &pendingToolCall{
+			target: targetServer,
+			invocation: tools.ToolCallInvocation{
+				MessageID: run.Response.Output.ID,
+				ItemID:    output.ID,
+				ToolCall:  *functionCall,
+			},
+		})
+	}
+
+	var agentName string
+	if run.PopulatedRequest != nil {
+		agentName = run.PopulatedRequest.Agent
+	}
+	chain, err := a.middleware(config, agentName)
+	if err != nil {
+		return err
+	}
+
+	limit := config.ToolConcurrency
+	if limit == 0 {
+		limit = defaultToolConcurrency
+	}
+
+	serverLimits := map[string]chan struct{}{}
+	for _, call := range pending {
+		if n := config.MCPServers[call.target.MCPServer].MaxConcurrency; n > 0 && serverLimits[call.target.MCPServer] == nil {
+			serverLimits[call.target.MCPServer] = make(chan struct{}, n)
+		}
+	}
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(limit)
+	for _, call := range pending {
+		eg.Go(func() (err error) {
+			defer func() {
+				if err == nil && call.output != nil {
+					checkpoint.toolOutput(ctx, call.invocation.ToolCall.CallID, *call.output)
+				}
+			}()
+
+			if serverLimit := serverLimits[call.target.MCPServer]; serverLimit != nil {
+				select {
+				case serverLimit <- struct{}{}:
+					defer func() { <-serverLimit }()
+				case <-egCtx.Done():
+					return context.Cause(egCtx)
+				}
+			}
+
+			if call.output, err = a.beforeToolCall(egCtx, chain, agentName, call); err != nil || call.output != nil {
+				return err
+			}
+
+			functionCall := call.invocation.ToolCall
+			if call.target.TargetName == orchestration.HandoffTool && strings.HasPrefix(functionCall.Name, orchestration.ToolPrefix) {
+				call.output, err = a.handoff(egCtx, config, run, call.target, call.invocation, opts)
+			} else if call.target.TargetName == knowledge.SearchTool && config.Agents[call.target.MCPServer].Knowledge != nil {
+				call.output, err = a.searchKnowledge(egCtx, config, call.target, call.invocation)
+			} else if call.target.TargetName == similarity.Tool && config.Agents[call.target.MCPServer].Similarity != nil {
+				call.output, err = a.computeSimilarity(egCtx, config, call.target, call.invocation)
+			} else if call.target.TargetName == codeexec.Tool && config.Agents[call.target.MCPServer].Exec != nil {
+				call.output, err = a.runCode(egCtx, config, call.target, call.invocation)
+			} else if (call.target.TargetName == web.FetchTool || call.target.TargetName == web.SearchTool) && config.Agents[call.target.MCPServer].Web != nil {
+				call.output, err = a.callWeb(egCtx, config, call.target, call.invocation)
+			} else {
+				call.output, err = a.invoke(egCtx, config, call.target, call.invocation, opts)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to invoke tool %s on MCP server %s: %w", functionCall.Name, call.target.MCPServer, err)
+			}
+			return nil
+		})
+	}
+	err = eg.Wait()
+
+	// Keep the results of the calls that finished, even if another call failed.
+	for _, call := range pending {
+		if call.output == nil {
+			continue
 		}
 
 		if run.ToolOutputs == nil {
 			run.ToolOutputs = make(map[string]types.ToolOutput)
 		}
 
-		run.ToolOutputs[functionCall.CallID] = types.ToolOutput{
-			Output: *callOutput,
+		run.ToolOutputs[call.invocation.ToolCall.CallID] = types.ToolOutput{
+			Output: *call.output,
 			Done:   true,
 		}
 	}
 
+	if err != nil {
+		return err
+	}
+
 	if len(run.ToolOutputs) == 0 {
 		run.Done = true
 	}
@@ -54,23 +175,64 @@ func (a *Agents) toolCalls(ctx context.Context, config types.Config, run *types.
 	return nil
 }
 
-func (a *Agents) invoke(ctx context.Context, config types.Config, target types.TargetMapping[mcp.Tool], funcCall tools.ToolCallInvocation, opts []types.CompletionOptions) (*types.Message, error) {
-	var (
-		data map[string]any
-	)
+// beforeToolCall runs the middleware on the call, it returns the output of the call if the middleware
+// returned a result instead of dispatching it. Changes to the arguments are kept in the invocation.
+func (a *Agents) beforeToolCall(ctx context.Context, chain middleware.Chain, agentName string, call *pendingToolCall) (*types.Message, error) {
+	if len(chain) == 0 {
+		return nil, nil
+	}
 
-	if funcCall.ToolCall.Arguments != "" {
-		data = make(map[string]any)
-		if err := json.Unmarshal([]byte(funcCall.ToolCall.Arguments), &data); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal function call arguments: %w", err)
-		}
+	toolCall := &middleware.ToolCall{
+		ToolCall: call.invocation.ToolCall,
+		Agent:    agentName,
+		Server:   call.target.MCPServer,
+		Tool:     call.target.TargetName,
+	}
+	result, err := chain.BeforeToolCall(ctx, toolCall)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run middleware on tool call %s: %w", toolCall.Name, err)
+	}
+	call.invocation.ToolCall.Arguments = toolCall.Arguments
+	if result == nil {
+		return nil, nil
 	}
 
-	response, err := a.registry.Call(ctx, target.MCPServer, target.TargetName, data, tools.CallOptions{
+	return &types.Message{
+		Role: "user",
+		Items: []types.CompletionItem{
+			{
+				ToolCallResult: &types.ToolCallResult{
+					CallID: call.invocation.ToolCall.CallID,
+					Output: *result,
+				},
+			},
+		},
+	}, nil
+}
+
+func (a *Agents) invoke(ctx context.Context, config types.Config, target types.TargetMapping[mcp.Tool], funcCall tools.ToolCallInvocation, opts []types.CompletionOptions) (*types.Message, error) {
+	var response *types.CallResult
+
+	data, err := schema.CoerceArguments(target.TargetName, target.Target.InputSchema, funcCall.ToolCall.Arguments)
+	if argsErr := (*types.ArgumentsError)(nil); errors.As(err, &argsErr) {
+		// The tool is not called, the LLM gets the errors to correct the arguments
+		log.Debugf(ctx, "not calling tool %s on MCP server %s: %v", target.TargetName, target.MCPServer, err)
+		response = &types.CallResult{
+			Content: []mcp.Content{
+				{
+					Type: "text",
+					Text: err.Error() + "\n\nCall the tool again with arguments that match its input schema.",
+					StructuredContent: map[string]any{
+						"error": argsErr,
+					},
+				},
+			},
+			IsError: true,
+		}
+	} else if response, err = a.registry.Call(ctx, target.MCPServer, target.TargetName, data, tools.CallOptions{
 		ProgressToken:      complete.Complete(opts...).ProgressToken,
 		ToolCallInvocation: &funcCall,
-	})
-	if err != nil {
+	}); err != nil {
 		response = &types.CallResult{
 			Content: []mcp.Content{
 				{
@@ -80,6 +242,12 @@ func (a *Agents) invoke(ctx context.Context, config types.Config, target types.T
 			},
 			IsError: true,
 		}
+		if timeoutErr := (*types.TimeoutError)(nil); errors.As(err, &timeoutErr) {
+			// The transcript keeps the timeout as data, so clients can tell it apart from a failed call
+			response.Content[0].StructuredContent = map[string]any{
+				"error": timeoutErr,
+			}
+		}
 	}
 	return &types.Message{
 		Role: "user",
@@ -94,3 +262,240 @@ func (a *Agents) invoke(ctx context.Context, config types.Config, target types.T
 		},
 	}, nil
 }
+
+func (a *Agents) handoff(ctx context.Context, config types.Config, run *types.Execution, target types.TargetMapping[mcp.Tool], funcCall tools.ToolCallInvocation, opts []types.CompletionOptions) (*types.Message, error) {
+	var args orchestration.Args
+	if funcCall.ToolCall.Arguments != "" {
+		if err := json.Unmarshal([]byte(funcCall.ToolCall.Arguments), &args); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal handoff arguments: %w", err)
+		}
+	}
+
+	var (
+		from    string
+		history []types.Message
+	)
+	if run.PopulatedRequest != nil {
+		from = run.PopulatedRequest.Agent
+		history = append(history, run.PopulatedRequest.Input...)
+	}
+	history = append(history, run.Response.Output)
+
+	response, err := a.orchestrator.Handoff(ctx, config, from, target.MCPServer, args, history, opts...)
+	if err != nil {
+		response = &types.CallResult{
+			Content: []mcp.Content{
+				{
+					Type: "text",
+					Text: fmt.Sprintf("Error handing off to %s: %v", target.MCPServer, err),
+				},
+			},
+			IsError: true,
+		}
+	}
+
+	result := types.ToolCallResult{
+		CallID: funcCall.ToolCall.CallID,
+		Output: *response,
+	}
+
+	if session, progressToken := mcp.SessionFromContext(ctx), complete.Complete(opts...).ProgressToken; session != nil && progressToken != nil {
+		tc := funcCall.ToolCall
+		tc.Target = target.MCPServer
+		tc.TargetType = "agent"
+		_ = session.SendPayload(ctx, "notifications/progress", mcp.NotificationProgressRequest{
+			ProgressToken: progressToken,
+			Meta: map[string]any{
+				types.CompletionProgressMetaKey: types.CompletionProgress{
+					MessageID: funcCall.MessageID,
+					Item: types.CompletionItem{
+						ID:             funcCall.ItemID,
+						ToolCall:       &tc,
+						ToolCallResult: &result,
+					},
+				},
+			},
+		})
+	}
+
+	return &types.Message{
+		Role: "user",
+		Items: []types.CompletionItem{
+			{
+				ToolCallResult: &result,
+			},
+		},
+	}, nil
+}
+
+func (a *Agents) searchKnowledge(ctx context.Context, config types.Config, target types.TargetMapping[mcp.Tool], funcCall tools.ToolCallInvocation) (*types.Message, error) {
+	var args knowledge.Args
+	if funcCall.ToolCall.Arguments != "" {
+		if err := json.Unmarshal([]byte(funcCall.ToolCall.Arguments), &args); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal search arguments: %w", err)
+		}
+	}
+
+	result := types.CallResult{}
+	if a.knowledge == nil {
+		result.IsError = true
+		result.Content = []mcp.Content{{Type: "text", Text: "Knowledge search is not available"}}
+	} else if matches, err := a.knowledge.Search(ctx, config, target.MCPServer, args.Query); err != nil {
+		result.IsError = true
+		result.Content = []mcp.Content{{Type: "text", Text: fmt.Sprintf("Error searching knowledge: %v", err)}}
+	} else {
+		result.Content = []mcp.Content{{Type: "text", Text: knowledge.Format(matches)}}
+	}
+
+	return &types.Message{
+		Role: "user",
+		Items: []types.CompletionItem{
+			{
+				ToolCallResult: &types.ToolCallResult{
+					CallID: funcCall.ToolCall.CallID,
+					Output: result,
+				},
+			},
+		},
+	}, nil
+}
+
+func (a *Agents) computeSimilarity(ctx context.Context, config types.Config, target types.TargetMapping[mcp.Tool], funcCall tools.ToolCallInvocation) (*types.Message, error) {
+	var args similarity.Args
+	if funcCall.ToolCall.Arguments != "" {
+		if err := json.Unmarshal([]byte(funcCall.ToolCall.Arguments), &args); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal similarity arguments: %w", err)
+		}
+	}
+
+	result := types.CallResult{}
+	if a.memory == nil {
+		result.IsError = true
+		result.Content = []mcp.Content{{Type: "text", Text: "Embeddings are not available"}}
+	} else if scores, err := similarity.Compute(ctx, a.memory, config.Agents[target.MCPServer].Similarity.GetEmbeddingModel(), args); err != nil {
+		result.IsError = true
+		result.Content = []mcp.Content{{Type: "text", Text: fmt.Sprintf("Error computing similarity: %v", err)}}
+	} else {
+		result.Content = []mcp.Content{{
+			Type:              "text",
+			Text:              similarity.Format(scores),
+			StructuredContent: map[string]any{"scores": scores},
+		}}
+	}
+
+	return &types.Message{
+		Role: "user",
+		Items: []types.CompletionItem{
+			{
+				ToolCallResult: &types.ToolCallResult{
+					CallID: funcCall.ToolCall.CallID,
+					Output: result,
+				},
+			},
+		},
+	}, nil
+}
+
+func (a *Agents) runCode(ctx context.Context, config types.Config, target types.TargetMapping[mcp.Tool], funcCall tools.ToolCallInvocation) (*types.Message, error) {
+	var args codeexec.Args
+	if funcCall.ToolCall.Arguments != "" {
+		if err := json.Unmarshal([]byte(funcCall.ToolCall.Arguments), &args); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal exec arguments: %w", err)
+		}
+	}
+
+	execConfig := *config.Agents[target.MCPServer].Exec
+	result := types.CallResult{}
+	if output, err := a.execCode(ctx, config, execConfig, args); err != nil {
+		result.IsError = true
+		result.Content = []mcp.Content{{Type: "text", Text: fmt.Sprintf("Error running code: %v", err)}}
+	} else {
+		result.IsError = output.ExitCode != 0
+		result.Content = []mcp.Content{{
+			Type:              "text",
+			Text:              codeexec.Format(output, execConfig.GetTimeout()),
+			StructuredContent: output,
+		}}
+	}
+
+	return &types.Message{
+		Role: "user",
+		Items: []types.CompletionItem{
+			{
+				ToolCallResult: &types.ToolCallResult{
+					CallID: funcCall.ToolCall.CallID,
+					Output: result,
+				},
+			},
+		},
+	}, nil
+}
+
+func (a *Agents) callWeb(ctx context.Context, config types.Config, target types.TargetMapping[mcp.Tool], funcCall tools.ToolCallInvocation) (*types.Message, error) {
+	webConfig := *config.Agents[target.MCPServer].Web
+	result := types.CallResult{}
+
+	var (
+		content mcp.Content
+		err     error
+	)
+	switch target.TargetName {
+	case web.FetchTool:
+		var args web.FetchArgs
+		if funcCall.ToolCall.Arguments != "" {
+			if err := json.Unmarshal([]byte(funcCall.ToolCall.Arguments), &args); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal web_fetch arguments: %w", err)
+			}
+		}
+		var page *web.Page
+		if page, err = web.Fetch(ctx, webConfig, args); err == nil {
+			result.IsError = page.Status >= 400
+			content = mcp.Content{Type: "text", Text: web.FormatPage(page, webConfig.GetRedirects()), StructuredContent: page}
+		}
+	default:
+		var args web.SearchArgs
+		if funcCall.ToolCall.Arguments != "" {
+			if err := json.Unmarshal([]byte(funcCall.ToolCall.Arguments), &args); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal web_search arguments: %w", err)
+			}
+		}
+		var results []web.SearchResult
+		if results, err = web.Search(ctx, webConfig, args); err == nil {
+			content = mcp.Content{Type: "text", Text: web.FormatResults(results), StructuredContent: results}
+		}
+	}
+	if err != nil {
+		result.IsError = true
+		content = mcp.Content{Type: "text", Text: fmt.Sprintf("Error calling %s: %v", target.TargetName, err)}
+	}
+	result.Content = []mcp.Content{content}
+
+	return &types.Message{
+		Role: "user",
+		Items: []types.CompletionItem{
+			{
+				ToolCallResult: &types.ToolCallResult{
+					CallID: funcCall.ToolCall.CallID,
+					Output: result,
+				},
+			},
+		},
+	}, nil
+}
+
+// execCode runs the code with the working directory of the session as its scratch directory.
+func (a *Agents) execCode(ctx context.Context, config types.Config, execConfig types.Exec, args codeexec.Args) (*codeexec.Result, error) {
+	session := mcp.SessionFromContext(ctx)
+	workdirConfig := config.Session.GetWorkdir()
+	if workdirConfig == nil {
+		workdirConfig = &types.Workdir{}
+	}
+	if err := workdir.CheckQuota(workdirConfig, session); err != nil {
+		return nil, err
+	}
+	dir, err := workdir.Ensure(ctx, workdirConfig, session)
+	if err != nil {
+		return nil, err
+	}
+	return codeexec.Run(ctx, execConfig, dir, args)
+}
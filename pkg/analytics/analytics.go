@@ -0,0 +1,158 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+)
+
+// SessionKey is the session attribute the turns and feedback of a session are stored in.
+const SessionKey = "analytics/log"
+
+// Ratings of feedback.
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// Turn is a turn of an agent, it is identified by the ID of the message the agent responded with.
+type Turn struct {
+	MessageID string `json:"messageID"`
+	Agent     string `json:"agent,omitempty"`
+	Model     string `json:"model,omitempty"`
+	// ToolCalls are the tools the agent called in the turn, ToolErrors the calls that returned an error.
+	ToolCalls  int `json:"toolCalls,omitempty"`
+	ToolErrors int `json:"toolErrors,omitempty"`
+	// Time is when the turn started, DurationMS how long it took until the agent responded.
+	Time       time.Time `json:"time"`
+	DurationMS int64     `json:"durationMs,omitempty"`
+}
+
+// Feedback is the rating of a user of the response of a turn.
+type Feedback struct {
+	MessageID string   `json:"messageID"`
+	Rating    string   `json:"rating"`
+	Comment   string   `json:"comment,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	// Agent and Model are those of the turn, they are set when the feedback is added.
+	Agent  string    `json:"agent,omitempty"`
+	Model  string    `json:"model,omitempty"`
+	UserID string    `json:"userID,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Log is the turns and feedback of a session.
+type Log struct {
+	Turns    []Turn     `json:"turns,omitempty"`
+	Feedback []Feedback `json:"feedback,omitempty"`
+}
+
+func (l Log) Serialize() (any, error) {
+	return l, nil
+}
+
+func (l *Log) Deserialize(data any) (any, error) {
+	if err := mcp.JSONCoerce(data, l); err != nil {
+		return nil, err
+	}
+	return *l, nil
+}
+
+// AddFeedback returns the log with the feedback on the turn of its message. Feedback of a user replaces
+// the previous feedback of the user on the same message.
+func (l Log) AddFeedback(feedback Feedback) (Log, Feedback, error) {
+	feedback.Rating = strings.ToLower(strings.TrimSpace(feedback.Rating))
+	if feedback.Rating != RatingUp && feedback.Rating != RatingDown {
+		return l, feedback, fmt.Errorf("invalid rating %q, must be %s or %s", feedback.Rating, RatingUp, RatingDown)
+	}
+	if feedback.MessageID == "" {
+		return l, feedback, fmt.Errorf("the message ID of the feedback is required")
+	}
+
+	i := slices.IndexFunc(l.Turns, func(t Turn) bool {
+		return t.MessageID == feedback.MessageID
+	})
+	if i < 0 {
+		return l, feedback, fmt.Errorf("message %s is not the response of a turn of the session", feedback.MessageID)
+	}
+	feedback.Agent = l.Turns[i].Agent
+	feedback.Model = l.Turns[i].Model
+	feedback.Tags = tags(feedback.Tags)
+	if feedback.Time.IsZero() {
+		feedback.Time = time.Now().UTC()
+	}
+
+	result := Log{
+		Turns: l.Turns,
+		Feedback: slices.DeleteFunc(slices.Clone(l.Feedback), func(f Feedback) bool {
+			return f.MessageID == feedback.MessageID && f.UserID == feedback.UserID
+		}),
+	}
+	result.Feedback = append(result.Feedback, feedback)
+	return result, feedback, nil
+}
+
+// tags returns the trimmed, lower cased, distinct tags.
+func tags(in []string) (result []string) {
+	for _, tag := range in {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// RecordTurn adds the turn to the log of the root session in ctx.
+func RecordTurn(ctx context.Context, turn Turn) {
+	session := mcp.SessionFromContext(ctx).Root()
+	if session == nil || turn.MessageID == "" {
+		return
+	}
+	if turn.Time.IsZero() {
+		turn.Time = time.Now().UTC()
+	}
+
+	var log Log
+	_ = session.Update(SessionKey, &log, func() error {
+		log.Turns = append(slices.Clip(log.Turns), turn)
+		return nil
+	})
+}
+
+// AddFeedback adds the feedback to the log of the session, see Log.AddFeedback.
+func AddFeedback(session *mcp.Session, feedback Feedback) (Feedback, error) {
+	session = session.Root()
+	if session == nil {
+		return feedback, fmt.Errorf("no session to add feedback to")
+	}
+
+	var log Log
+	err := session.Update(SessionKey, &log, func() (err error) {
+		log, feedback, err = log.AddFeedback(feedback)
+		return err
+	})
+	return feedback, err
+}
+
+// Get returns the log of the session.
+func Get(session *mcp.Session) Log {
+	var log Log
+	session.Root().Get(SessionKey, &log)
+	return log
+}
+
+// FromAttributes reads the log from the stored attributes of a session.
+func FromAttributes(attributes map[string]any) (Log, error) {
+	var log Log
+	data, ok := attributes[SessionKey]
+	if !ok {
+		return log, nil
+	}
+	err := mcp.JSONCoerce(data, &log)
+	return log, err
+}
@@ -0,0 +1,131 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/session"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// Load returns the logs of the sessions of the account, or of all sessions if accountID is empty.
+func Load(ctx context.Context, store *session.Store, accountID string) ([]Log, error) {
+	var (
+		sessions []session.Session
+		err      error
+	)
+	if accountID == "" {
+		sessions, err = store.List(ctx)
+	} else {
+		sessions, err = store.FindByAccountID(ctx, accountID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	logs := make([]Log, 0, len(sessions))
+	for _, s := range sessions {
+		l, err := FromAttributes(s.State.Attributes)
+		if err != nil {
+			log.Errorf(ctx, "failed to read analytics of session %s: %v", s.SessionID, err)
+			continue
+		}
+		logs = append(logs, l)
+	}
+	return logs, nil
+}
+
+// Handler serves the analytics report of the sessions of the caller as JSON. Callers of a server without
+// auth, and admins that set all=true, get the report of all sessions, anonymous callers of a server with
+// auth are rejected. The since, agent and model query parameters filter the report.
+func Handler(store *session.Store) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		accountID, ok := types.NanobotContext(req.Context()).AccountID(req.URL.Query().Get("all") == "true")
+		if !ok {
+			http.Error(rw, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		logs, err := Load(req.Context(), store, accountID)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		query := req.URL.Query()
+		report := NewReport(Filter{
+			Since: query.Get("since"),
+			Agent: query.Get("agent"),
+			Model: query.Get("model"),
+		}, logs...)
+
+		writeJSON(req.Context(), rw, report)
+	})
+}
+
+// FeedbackHandler lists the feedback of the session in the session_id path value on GET and adds
+// feedback to one of its turns on POST. Only the account of the session can rate it.
+func FeedbackHandler(m *session.Manager) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var (
+			ctx           = req.Context()
+			accountID, ok = types.NanobotContext(ctx).AccountID(false)
+			id            = req.PathValue("session_id")
+		)
+		if !ok {
+			http.Error(rw, "authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		serverSession, found, err := m.Acquire(ctx, nil, id)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if found {
+			defer m.Release(serverSession)
+			var owner string
+			serverSession.GetSession().Get(types.AccountIDSessionKey, &owner)
+			found = owner == accountID
+		}
+		if !found {
+			http.Error(rw, fmt.Sprintf("session %s not found", id), http.StatusNotFound)
+			return
+		}
+
+		if req.Method == http.MethodGet {
+			writeJSON(ctx, rw, Get(serverSession.GetSession()).Feedback)
+			return
+		}
+
+		var feedback Feedback
+		if err := json.NewDecoder(req.Body).Decode(&feedback); err != nil {
+			http.Error(rw, fmt.Sprintf("invalid feedback: %v", err), http.StatusBadRequest)
+			return
+		}
+		feedback.UserID = accountID
+		feedback.Time = time.Time{}
+
+		feedback, err = AddFeedback(serverSession.GetSession(), feedback)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := m.Store(ctx, id, serverSession); err != nil {
+			http.Error(rw, fmt.Sprintf("failed to store feedback: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(ctx, rw, feedback)
+	})
+}
+
+func writeJSON(ctx context.Context, rw http.ResponseWriter, obj any) {
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(obj); err != nil {
+		log.Errorf(ctx, "failed to write analytics response: %v", err)
+	}
+}
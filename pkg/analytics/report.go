@@ -0,0 +1,172 @@
+package analytics
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Stats are the turns and feedback of a set of sessions.
+type Stats struct {
+	Turns int `json:"turns"`
+	// LatencyMS is the average duration of the turns.
+	LatencyMS  float64 `json:"latencyMs"`
+	durationMS int64
+	ToolCalls  int `json:"toolCalls"`
+	ToolErrors int `json:"toolErrors"`
+	// ToolFailureRate is the share of the tool calls that returned an error.
+	ToolFailureRate float64 `json:"toolFailureRate"`
+	Feedback        int     `json:"feedback"`
+	Up              int     `json:"up"`
+	Down            int     `json:"down"`
+	// Satisfaction is the share of the feedback that is a thumbs up.
+	Satisfaction float64 `json:"satisfaction"`
+}
+
+func (s *Stats) addTurn(turn Turn) {
+	s.Turns++
+	s.durationMS += turn.DurationMS
+	s.ToolCalls += turn.ToolCalls
+	s.ToolErrors += turn.ToolErrors
+}
+
+func (s *Stats) addFeedback(feedback Feedback) {
+	s.Feedback++
+	if feedback.Rating == RatingUp {
+		s.Up++
+	} else {
+		s.Down++
+	}
+}
+
+func (s *Stats) complete() {
+	if s.Turns > 0 {
+		s.LatencyMS = float64(s.durationMS) / float64(s.Turns)
+	}
+	s.ToolFailureRate = rate(s.ToolErrors, s.ToolCalls)
+	s.Satisfaction = rate(s.Up, s.Feedback)
+}
+
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// Group is the stats of one agent, model, or feedback tag.
+type Group struct {
+	Key string `json:"key"`
+	Stats
+}
+
+// Report is the analytics of one or more sessions.
+type Report struct {
+	Sessions int `json:"sessions"`
+	// RatedSessions are the sessions with feedback, a rated session is resolved if its latest feedback is
+	// a thumbs up.
+	RatedSessions    int     `json:"ratedSessions"`
+	ResolvedSessions int     `json:"resolvedSessions"`
+	ResolutionRate   float64 `json:"resolutionRate"`
+	Total            Stats   `json:"total"`
+	ByAgent          []Group `json:"byAgent"`
+	ByModel          []Group `json:"byModel"`
+	// ByTag only has the feedback stats of the tags of the feedback.
+	ByTag []Group `json:"byTag"`
+}
+
+// Filter selects the turns and feedback that are included in a report. Empty fields match all.
+type Filter struct {
+	// Since is the first UTC day (YYYY-MM-DD) to include.
+	Since string
+	Agent string
+	Model string
+}
+
+func (f Filter) matches(t time.Time, agent, model string) bool {
+	return (f.Since == "" || t.UTC().Format(time.DateOnly) >= f.Since) &&
+		(f.Agent == "" || agent == f.Agent) &&
+		(f.Model == "" || model == f.Model)
+}
+
+// NewReport sums the turns and feedback of the logs that match the filter, each log is a session.
+func NewReport(filter Filter, logs ...Log) Report {
+	var (
+		report  Report
+		byAgent = map[string]*Stats{}
+		byModel = map[string]*Stats{}
+		byTag   = map[string]*Stats{}
+	)
+
+	for _, log := range logs {
+		var (
+			included bool
+			latest   *Feedback
+		)
+		for _, turn := range log.Turns {
+			if !filter.matches(turn.Time, turn.Agent, turn.Model) {
+				continue
+			}
+			included = true
+			report.Total.addTurn(turn)
+			statsOf(byAgent, turn.Agent).addTurn(turn)
+			statsOf(byModel, turn.Model).addTurn(turn)
+		}
+		for _, feedback := range log.Feedback {
+			if !filter.matches(feedback.Time, feedback.Agent, feedback.Model) {
+				continue
+			}
+			included = true
+			report.Total.addFeedback(feedback)
+			statsOf(byAgent, feedback.Agent).addFeedback(feedback)
+			statsOf(byModel, feedback.Model).addFeedback(feedback)
+			for _, tag := range feedback.Tags {
+				statsOf(byTag, tag).addFeedback(feedback)
+			}
+			if latest == nil || !feedback.Time.Before(latest.Time) {
+				latest = &feedback
+			}
+		}
+
+		if included {
+			report.Sessions++
+		}
+		if latest != nil {
+			report.RatedSessions++
+			if latest.Rating == RatingUp {
+				report.ResolvedSessions++
+			}
+		}
+	}
+
+	report.ResolutionRate = rate(report.ResolvedSessions, report.RatedSessions)
+	report.Total.complete()
+	report.ByAgent = groups(byAgent)
+	report.ByModel = groups(byModel)
+	report.ByTag = groups(byTag)
+	return report
+}
+
+func statsOf(m map[string]*Stats, key string) *Stats {
+	s, ok := m[key]
+	if !ok {
+		s = &Stats{}
+		m[key] = s
+	}
+	return s
+}
+
+func groups(m map[string]*Stats) []Group {
+	result := make([]Group, 0, len(m))
+	for key, stats := range m {
+		stats.complete()
+		result = append(result, Group{
+			Key:   key,
+			Stats: *stats,
+		})
+	}
+	slices.SortFunc(result, func(a, b Group) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return result
+}
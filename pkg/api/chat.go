@@ -132,6 +132,12 @@ func printProgressURI(rw http.ResponseWriter, req *http.Request, client *mcp.Cli
 			}
 		}
 
+		if callResult.Usage != nil {
+			if err := writeEvent(rw, nil, "usage", callResult.Usage); err != nil {
+				return err
+			}
+		}
+
 		for _, progressMessage := range callResult.Content {
 			if progressMessage.Resource != nil && progressMessage.Resource.MIMEType == types.MessageMimeType {
 				var id string
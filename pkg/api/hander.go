@@ -110,11 +110,22 @@ func (s *server) withContext(f func(rw http.ResponseWriter, req *http.Request) e
 func (s *server) api(f func(rw http.ResponseWriter, req *http.Request) error) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		if err := f(rw, req); err != nil {
-			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			writeError(rw, err)
 		}
 	})
 }
 
+// writeError responds with the ErrorData of err, so clients can tell the type of the failure.
+func writeError(rw http.ResponseWriter, err error) {
+	data := types.GetErrorData(err)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(data.StatusCode())
+	_ = json.NewEncoder(rw).Encode(map[string]any{
+		"error": data,
+	})
+}
+
 type Context struct {
 	ChatClient     *mcp.Client
 	SessionManager *session.Manager
@@ -0,0 +1,267 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/audit"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+const (
+	// Always requires confirmation for every call of the tool
+	Always = "always"
+	// Never does not require confirmation for calls of the tool, this is the default
+	Never = "never"
+
+	// Timeout is the action of confirmations the user did not answer within ConfirmTimeout
+	Timeout = "timeout"
+
+	AuditSessionKey   = "approval/audit"
+	PendingSessionKey = "approval/pending"
+)
+
+// ConfirmTimeout is how long the user has to answer a confirmation before the call is denied.
+var ConfirmTimeout = 10 * time.Minute
+
+// Policy returns the confirmation policy of a tool of an MCP server. A "*" entry applies to all tools
+// of the server.
+func Policy(server mcp.Server, tool string) string {
+	if policy, ok := server.Confirm[tool]; ok {
+		return policy
+	}
+	return server.Confirm["*"]
+}
+
+// Required returns true if the policy requires confirmation for a call with the given JSON arguments.
+// Policies other than always and never are regular expressions that are matched against the arguments.
+func Required(policy, arguments string) (bool, error) {
+	switch policy {
+	case "", Never:
+		return false, nil
+	case Always:
+		return true, nil
+	}
+	re, err := regexp.Compile(policy)
+	if err != nil {
+		return false, fmt.Errorf("invalid confirm pattern %q: %w", policy, err)
+	}
+	return re.MatchString(arguments), nil
+}
+
+// Record is an entry of the audit log of approvals kept in the session.
+type Record struct {
+	Server    string `json:"server"`
+	Tool      string `json:"tool"`
+	Arguments string `json:"arguments,omitempty"`
+	Approved  bool   `json:"approved"`
+	// Action is the elicitation response, accept, decline or cancel, or timeout if there was none
+	Action string    `json:"action"`
+	UserID string    `json:"userID,omitempty"`
+	User   string    `json:"user,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+type Audit []Record
+
+func (a Audit) Serialize() (any, error) {
+	return a, nil
+}
+
+func (a *Audit) Deserialize(data any) (any, error) {
+	if err := mcp.JSONCoerce(data, a); err != nil {
+		return nil, err
+	}
+	return *a, nil
+}
+
+// Request is a tool call waiting for the user to approve it.
+type Request struct {
+	ID        string    `json:"id"`
+	Server    string    `json:"server"`
+	Tool      string    `json:"tool"`
+	Arguments string    `json:"arguments,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+type Pending []Request
+
+func (p Pending) Serialize() (any, error) {
+	return p, nil
+}
+
+func (p *Pending) Deserialize(data any) (any, error) {
+	if err := mcp.JSONCoerce(data, p); err != nil {
+		return nil, err
+	}
+	return *p, nil
+}
+
+// Unexpired returns the requests that were made less than ConfirmTimeout before now, older requests
+// were denied.
+func (p Pending) Unexpired(now time.Time) Pending {
+	var result Pending
+	for _, r := range p {
+		if now.Sub(r.Time) < ConfirmTimeout {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// GetAudit returns the approvals recorded in the session.
+func GetAudit(session *mcp.Session) Audit {
+	var audit Audit
+	session.Root().Get(AuditSessionKey, &audit)
+	return audit
+}
+
+// GetPending returns the tool calls of the session that are waiting for approval.
+func GetPending(session *mcp.Session) Pending {
+	var pending Pending
+	session.Root().Get(PendingSessionKey, &pending)
+	return pending
+}
+
+func setPending(session *mcp.Session, update func(Pending) Pending) {
+	var pending Pending
+	_ = session.Update(PendingSessionKey, &pending, func() error {
+		pending = update(slices.Clone(pending))
+		return nil
+	})
+}
+
+func record(ctx context.Context, session *mcp.Session, r Record) {
+	audit.Record(ctx, audit.Event{
+		Time:      r.Time,
+		Type:      audit.Approval,
+		Server:    r.Server,
+		Tool:      r.Tool,
+		Arguments: r.Arguments,
+		Action:    r.Action,
+	})
+
+	user := types.NanobotContext(ctx).User
+	r.UserID = user.ID
+	r.User = user.Email
+	if r.User == "" {
+		r.User = user.Login
+	}
+	if r.UserID == "" {
+		session.Get(types.AccountIDSessionKey, &r.UserID)
+	}
+
+	var audit Audit
+	_ = session.Update(AuditSessionKey, &audit, func() error {
+		audit = append(slices.Clip(audit), r)
+		return nil
+	})
+}
+
+// DeniedError is returned when the user did not approve a tool call.
+type DeniedError struct {
+	Server string
+	Tool   string
+	Action string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("the user did not approve the call of tool %s on MCP server %s (%s)", e.Tool, e.Server, e.Action)
+}
+
+// Check asks the user to confirm the tool call if the policy of the tool requires it. It returns a
+// DeniedError if the call was not approved.
+func Check(ctx context.Context, serverName string, server mcp.Server, tool string, args any) error {
+	policy := Policy(server, tool)
+	if policy == "" || policy == Never {
+		return nil
+	}
+
+	argsData, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("failed to marshal arguments: %w", err)
+	}
+	arguments := string(argsData)
+
+	required, err := Required(policy, arguments)
+	if err != nil || !required {
+		return err
+	}
+
+	return Ask(ctx, serverName, tool, arguments, fmt.Sprintf("Allow the tool %s of MCP server %s to run with the arguments %s?", tool, serverName, arguments))
+}
+
+// Ask asks the user to approve the tool call with the message and records the answer. It returns a
+// DeniedError if the call was not approved.
+func Ask(ctx context.Context, serverName, tool, arguments, message string) error {
+	session := mcp.SessionFromContext(ctx).Root()
+	if session == nil || session.InitializeRequest.Capabilities.Elicitation == nil {
+		return fmt.Errorf("tool %s on MCP server %s requires confirmation but the client does not support elicitation", tool, serverName)
+	}
+
+	meta, _ := json.Marshal(map[string]any{
+		types.MetaPrefix + "server-name":    serverName,
+		types.MetaPrefix + "tool-name":      tool,
+		types.MetaPrefix + "tool-arguments": arguments,
+	})
+
+	request := Request{
+		ID:        uuid.String(),
+		Server:    serverName,
+		Tool:      tool,
+		Arguments: arguments,
+		Time:      time.Now(),
+	}
+	setPending(session, func(pending Pending) Pending {
+		return append(pending, request)
+	})
+	defer setPending(session, func(pending Pending) Pending {
+		return slices.DeleteFunc(pending, func(r Request) bool {
+			return r.ID == request.ID
+		})
+	})
+
+	elicitCtx, cancel := context.WithTimeout(ctx, ConfirmTimeout)
+	defer cancel()
+
+	var result mcp.ElicitResult
+	if err := session.Exchange(elicitCtx, "elicitation/create", mcp.ElicitRequest{
+		Message: message,
+		RequestedSchema: mcp.PrimitiveSchema{
+			Type:       "object",
+			Properties: map[string]mcp.PrimitiveProperty{},
+		},
+		Meta: meta,
+	}, &result); err != nil {
+		if !errors.Is(elicitCtx.Err(), context.DeadlineExceeded) || ctx.Err() != nil {
+			return fmt.Errorf("failed to elicit confirmation: %w", err)
+		}
+		result.Action = Timeout
+	}
+
+	approved := result.Action == "accept"
+	record(ctx, session, Record{
+		Server:    serverName,
+		Tool:      tool,
+		Arguments: arguments,
+		Approved:  approved,
+		Action:    result.Action,
+		Time:      time.Now(),
+	})
+
+	if !approved {
+		return &DeniedError{
+			Server: serverName,
+			Tool:   tool,
+			Action: result.Action,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// Types of the events in the audit log.
+const (
+	ToolCall     = "tool_call"
+	Approval     = "approval"
+	ModelRequest = "model_request"
+	ConfigChange = "config_change"
+	// Elicitation is recorded when an elicitation request is answered without a user.
+	Elicitation = "elicitation"
+	// Retention is recorded when events older than the retention of the log are removed.
+	Retention = "retention"
+)
+
+// Event is an entry of the audit log. Hash is the SHA-256 of the previous hash and the event without
+// its hash, so removing or changing an event breaks the chain of the events after it.
+type Event struct {
+	Seq       int64     `json:"seq"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	SessionID string    `json:"sessionID,omitempty"`
+	UserID    string    `json:"userID,omitempty"`
+	Agent     string    `json:"agent,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Server    string    `json:"server,omitempty"`
+	Tool      string    `json:"tool,omitempty"`
+	Arguments string    `json:"arguments,omitempty"`
+	// Action is the response of the user to an approval, accept, decline or cancel.
+	Action       string `json:"action,omitempty"`
+	InputTokens  int    `json:"inputTokens,omitempty"`
+	OutputTokens int    `json:"outputTokens,omitempty"`
+	// Digest is the SHA-256 of the config of config changes.
+	Digest   string `json:"digest,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Error    string `json:"error,omitempty"`
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+var current atomic.Pointer[Log]
+
+// SetDefault sets the log the events passed to Record are appended to.
+func SetDefault(l *Log) {
+	current.Store(l)
+}
+
+// Enabled returns true if events are recorded.
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Record appends the event to the default log, if there is one. The session and user of the event are
+// filled in from ctx.
+func Record(ctx context.Context, event Event) {
+	l := current.Load()
+	if l == nil {
+		return
+	}
+
+	session := mcp.SessionFromContext(ctx).Root()
+	if event.SessionID == "" {
+		event.SessionID = session.ID()
+	}
+	if event.UserID == "" {
+		event.UserID = types.NanobotContext(ctx).User.ID
+	}
+	if event.UserID == "" && session != nil {
+		session.Get(types.AccountIDSessionKey, &event.UserID)
+	}
+
+	if err := l.Append(event); err != nil {
+		log.Errorf(ctx, "failed to write %s event to audit log: %v", event.Type, err)
+	}
+}
@@ -0,0 +1,359 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+)
+
+// pruneInterval is how often events older than the retention are removed while appending.
+const pruneInterval = time.Hour
+
+type Options struct {
+	// Retention is how long events are kept, zero keeps them forever.
+	Retention time.Duration
+}
+
+func (o Options) Merge(other Options) (result Options) {
+	result.Retention = complete.Last(o.Retention, other.Retention)
+	return
+}
+
+// Log is an append-only JSONL file of hash chained events. Only one process should write to a log.
+type Log struct {
+	lock      sync.Mutex
+	path      string
+	file      *os.File
+	opt       Options
+	lastPrune time.Time
+	seq       int64
+	hash      string
+	anchor    Anchor
+}
+
+// Anchor is the first and last event of a log, it is stored next to the log in a file with the .anchor
+// suffix after every append. The chain only links the events to each other, the anchor detects
+// events removed from the start or the end of the log.
+type Anchor struct {
+	FirstSeq      int64  `json:"firstSeq"`
+	FirstPrevHash string `json:"firstPrevHash"`
+	LastSeq       int64  `json:"lastSeq"`
+	LastHash      string `json:"lastHash"`
+}
+
+// AnchorPath returns the path of the anchor of the log at path.
+func AnchorPath(path string) string {
+	return path + ".anchor"
+}
+
+// Open opens the log at path, creating it if it does not exist. It fails if the events in the file
+// do not verify, so that a tampered log is not continued.
+func Open(path string, opts ...Options) (*Log, error) {
+	l := &Log{
+		path: path,
+		opt:  complete.Complete(opts...),
+	}
+
+	events, err := ReadLog(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+	if len(events) > 0 {
+		l.seq = events[len(events)-1].Seq
+		l.hash = events[len(events)-1].Hash
+		l.anchor = Anchor{
+			FirstSeq:      events[0].Seq,
+			FirstPrevHash: events[0].PrevHash,
+			LastSeq:       l.seq,
+			LastHash:      l.hash,
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create directory of audit log %s: %w", path, err)
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	if l.opt.Retention > 0 {
+		if err := l.prune(events); err != nil {
+			_ = l.file.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (l *Log) open() (err error) {
+	l.file, err = os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", l.path, err)
+	}
+	return nil
+}
+
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.file.Close()
+}
+
+// Append adds the event to the end of the log and sets its sequence number and hashes. Events without a
+// time get the current time.
+func (l *Log) Append(event Event) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.opt.Retention > 0 && time.Since(l.lastPrune) > pruneInterval {
+		events, err := ReadFile(l.path)
+		if err != nil {
+			return fmt.Errorf("failed to read audit log %s: %w", l.path, err)
+		}
+		if err := l.prune(events); err != nil {
+			return err
+		}
+	}
+
+	return l.append(event)
+}
+
+func (l *Log) append(event Event) error {
+	event.Seq = l.seq + 1
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Time = event.Time.UTC()
+	event.PrevHash = l.hash
+
+	var err error
+	event.Hash, err = hash(event)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log %s: %w", l.path, err)
+	}
+
+	l.seq = event.Seq
+	l.hash = event.Hash
+	if l.anchor.FirstSeq == 0 {
+		l.anchor.FirstSeq, l.anchor.FirstPrevHash = event.Seq, event.PrevHash
+	}
+	l.anchor.LastSeq, l.anchor.LastHash = event.Seq, event.Hash
+	return l.writeAnchor()
+}
+
+func (l *Log) writeAnchor() error {
+	data, err := json.Marshal(l.anchor)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit log anchor: %w", err)
+	}
+	path := AnchorPath(l.path)
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("failed to write audit log anchor %s: %w", path, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to replace audit log anchor %s: %w", path, err)
+	}
+	return nil
+}
+
+// prune rewrites the log without the events older than the retention. The first event that is kept
+// still has the hash of the last removed event as its previous hash, and a retention event records the
+// removal.
+func (l *Log) prune(events []Event) error {
+	l.lastPrune = time.Now()
+
+	cutoff := l.lastPrune.Add(-l.opt.Retention)
+	var removed int
+	for removed < len(events) && events[removed].Time.Before(cutoff) {
+		removed++
+	}
+	if removed == 0 {
+		return nil
+	}
+
+	tmp := l.path + ".tmp"
+	if err := writeFile(tmp, events[removed:]); err != nil {
+		return err
+	}
+	// The anchor is moved first, a log that still has the removed events verifies with it
+	if removed < len(events) {
+		l.anchor.FirstSeq, l.anchor.FirstPrevHash = events[removed].Seq, events[removed].PrevHash
+	} else {
+		// The retention event is the first event of the log
+		l.anchor.FirstSeq, l.anchor.FirstPrevHash = l.seq+1, l.hash
+	}
+	if err := l.writeAnchor(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("failed to replace audit log %s: %w", l.path, err)
+	}
+
+	_ = l.file.Close()
+	if err := l.open(); err != nil {
+		return err
+	}
+
+	return l.append(Event{
+		Time:    l.lastPrune,
+		Type:    Retention,
+		Message: fmt.Sprintf("removed %d events older than %s", removed, cutoff.UTC().Format(time.RFC3339)),
+	})
+}
+
+func writeFile(path string, events []Event) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := Write(f, events); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// Write writes the events as JSONL.
+func Write(w io.Writer, events []Event) error {
+	bw := bufio.NewWriter(w)
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit event: %w", err)
+		}
+		if _, err := bw.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func hash(event Event) (string, error) {
+	event.Hash = ""
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ReadLog reads and verifies the events of the log at path, with its anchor. The log must include the
+// first and the last event of the anchor. Without an anchor, the log must start with the first event
+// that was ever recorded.
+func ReadLog(path string) ([]Event, error) {
+	anchor := Anchor{FirstSeq: 1}
+	data, err := os.ReadFile(AnchorPath(path))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read audit log anchor: %w", err)
+	} else if err == nil {
+		if err := json.Unmarshal(data, &anchor); err != nil {
+			return nil, fmt.Errorf("invalid audit log anchor: %w", err)
+		}
+	}
+
+	events, err := ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && anchor.FirstSeq <= anchor.LastSeq {
+		return nil, fmt.Errorf("the log of events %d to %d was removed", anchor.FirstSeq, anchor.LastSeq)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 {
+		if anchor.FirstSeq <= anchor.LastSeq {
+			return nil, fmt.Errorf("the log is empty, events %d to %d were removed", anchor.FirstSeq, anchor.LastSeq)
+		}
+		return events, nil
+	}
+
+	first, last := events[0], events[len(events)-1]
+	if first.Seq > anchor.FirstSeq {
+		return nil, fmt.Errorf("the log starts with event %d instead of event %d, events were removed from its start", first.Seq, anchor.FirstSeq)
+	}
+	// The first event of the anchor is the first event that is kept by a retention that did not finish
+	// if it is not in the log yet.
+	if anchor.FirstSeq <= last.Seq && events[anchor.FirstSeq-first.Seq].PrevHash != anchor.FirstPrevHash {
+		return nil, fmt.Errorf("event %d does not follow the event before the start of the log", anchor.FirstSeq)
+	}
+	if anchor.LastSeq > 0 && !Contains(events, anchor.LastHash) {
+		return nil, fmt.Errorf("the log does not contain event %d of its anchor, events were removed from its end", anchor.LastSeq)
+	}
+	return events, nil
+}
+
+// Contains returns true if the events include the event with the hash, like a hash that was recorded
+// outside of the log. The hash covers the sequence number, so the event is also at its position.
+func Contains(events []Event, hash string) bool {
+	return slices.ContainsFunc(events, func(event Event) bool {
+		return event.Hash == hash
+	})
+}
+
+// ReadFile reads and verifies the events of the log at path.
+func ReadFile(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read reads and verifies JSONL events. The previous hash of the first event is not checked, so a part
+// of a log, like an export or a log that was pruned, verifies too.
+func Read(r io.Reader) (result []Event, _ error) {
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(bytes.TrimSpace(data)) == 0 {
+			return result, nil
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		var event Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, fmt.Errorf("invalid event on line %d: %w", line, err)
+		}
+
+		expected, err := hash(event)
+		if err != nil {
+			return nil, err
+		}
+		if event.Hash != expected {
+			return nil, fmt.Errorf("event %d on line %d was modified, its hash does not match", event.Seq, line)
+		}
+		if len(result) > 0 {
+			prev := result[len(result)-1]
+			if event.PrevHash != prev.Hash || event.Seq != prev.Seq+1 {
+				return nil, fmt.Errorf("event %d on line %d does not follow event %d, events were removed or reordered", event.Seq, line, prev.Seq)
+			}
+		}
+		result = append(result, event)
+	}
+}
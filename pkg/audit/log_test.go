@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeLog(t *testing.T, path string, times ...time.Time) {
+	t.Helper()
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tm := range times {
+		if err := l.Append(Event{Time: tm, Type: ToolCall, Tool: "tool" + string(rune('a'+i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadLog(t *testing.T) {
+	editLines := func(edit func([]string) []string) func(t *testing.T, path string) {
+		return func(t *testing.T, path string) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := edit(strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n"))
+			if err := os.WriteFile(path, []byte(strings.Join(lines, "")), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		edit  func(t *testing.T, path string)
+		valid bool
+	}{
+		{name: "intact", edit: func(*testing.T, string) {}, valid: true},
+		{name: "modified", edit: editLines(func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], "toolb", "toolx", 1)
+			return lines
+		})},
+		{name: "removed from the middle", edit: editLines(func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		})},
+		{name: "removed from the start", edit: editLines(func(lines []string) []string {
+			return lines[1:]
+		})},
+		{name: "removed from the end", edit: editLines(func(lines []string) []string {
+			return lines[:len(lines)-1]
+		})},
+		{name: "removed", edit: func(t *testing.T, path string) {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "removed from the start without anchor", edit: func(t *testing.T, path string) {
+			editLines(func(lines []string) []string { return lines[1:] })(t, path)
+			if err := os.Remove(AnchorPath(path)); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			now := time.Now()
+			writeLog(t, path, now, now, now)
+
+			tt.edit(t, path)
+			_, err := ReadLog(path)
+			if tt.valid && err != nil {
+				t.Errorf("expected the log to verify, got %v", err)
+			} else if !tt.valid && err == nil {
+				t.Error("expected the log not to verify")
+			}
+		})
+	}
+}
+
+func TestRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	old := time.Now().Add(-48 * time.Hour)
+	writeLog(t, path, old, old, time.Now())
+
+	l, err := Open(path, Options{Retention: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := ReadLog(path)
+	if err != nil {
+		t.Fatalf("expected the pruned log to verify, got %v", err)
+	}
+	if len(events) != 2 || events[0].Seq != 3 || events[1].Type != Retention {
+		t.Fatalf("expected event 3 and the retention event, got %+v", events)
+	}
+	if _, err := ReadFile(path); err != nil {
+		t.Errorf("expected the events to verify without the anchor, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rest, _ := strings.Cut(string(data), "\n")
+	if err := os.WriteFile(path, []byte(rest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLog(path); err == nil {
+		t.Error("expected the log without the first kept event not to verify")
+	}
+}
+
+func TestContains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeLog(t, path, time.Now(), time.Now())
+
+	events, err := ReadLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Contains(events, events[1].Hash) {
+		t.Error("expected the events to contain the last hash")
+	}
+	if Contains(events[:1], events[1].Hash) {
+		t.Error("expected the truncated events not to contain the last hash")
+	}
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
@@ -16,7 +17,9 @@ import (
 	proxytypes "github.com/obot-platform/mcp-oauth-proxy/pkg/types"
 )
 
-func Wrap(env map[string]string, cfg types.Config, dsn string, next http.Handler) (http.Handler, error) {
+// Wrap adds the authentication of the auth config to next. The publicPaths, and the paths below those that
+// end with a slash, are served without API keys, JWTs, or OAuth tokens.
+func Wrap(ctx context.Context, env map[string]string, cfg types.Config, dsn string, next http.Handler, publicPaths ...string) (http.Handler, error) {
 	var (
 		result = next
 		err    error
@@ -26,10 +29,19 @@ func Wrap(env map[string]string, cfg types.Config, dsn string, next http.Handler
 		return result, nil
 	}
 
-	if err := envvar.ReplaceObject(env, auth); err != nil {
+	next = withAuth(next)
+	result = next
+
+	if err := envvar.ReplaceObject(ctx, env, auth); err != nil {
 		return nil, fmt.Errorf("failed to replace variables in auth config: %w", err)
 	}
 
+	if auth.RequiresBearer() && auth.OAuthClientID == "" {
+		// Only requests with an API key or a JWT are accepted, so user headers set by the client must
+		// not be trusted.
+		return newBearerAuth(auth, next, nil, publicPaths), nil
+	}
+
 	result = setupContext(auth, result)
 
 	if auth.OAuthClientID != "" {
@@ -47,16 +59,46 @@ func Wrap(env map[string]string, cfg types.Config, dsn string, next http.Handler
 		if err != nil {
 			return nil, fmt.Errorf("failed to create oauth proxy: %w", err)
 		}
+		// The OAuth proxy requires a token for all other paths
+		result = withPublicPaths(result, next, publicPaths)
 	}
 
 	if len(auth.OAuthAuthorizationServerMetadata) > 0 {
 		panic("not implemented")
 	}
 
+	if auth.RequiresBearer() {
+		result = newBearerAuth(auth, next, result, publicPaths)
+	}
+
 	return result, nil
 }
 
-func userFromHeaders(next http.Handler) http.Handler {
+// withAuth marks the requests to next as authenticated by the auth config, so that handlers do not treat
+// requests without a user as coming from a server without auth.
+func withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nctx := types.NanobotContext(req.Context())
+		nctx.Auth = true
+		next.ServeHTTP(rw, req.WithContext(types.WithNanobotContext(req.Context(), nctx)))
+	})
+}
+
+// withPublicPaths serves the requests of the public paths with public and all others with next.
+func withPublicPaths(next, public http.Handler, publicPaths []string) http.Handler {
+	if len(publicPaths) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if isPublic(publicPaths, req.URL.Path) {
+			public.ServeHTTP(rw, req)
+		} else {
+			next.ServeHTTP(rw, req)
+		}
+	})
+}
+
+func userFromHeaders(auth *types.Auth, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		var user types.User
 		keys := map[string]any{}
@@ -80,13 +122,15 @@ func userFromHeaders(next http.Handler) http.Handler {
 
 		nctx := types.NanobotContext(req.Context())
 		nctx.User = user
+		nctx.Admin = auth.IsAdmin(user)
 		next.ServeHTTP(rw, req.WithContext(types.WithNanobotContext(req.Context(), nctx)))
 	})
 }
 
 func setupContext(auth *types.Auth, next http.Handler) http.Handler {
+	next = defaultScope(auth, next)
 	if auth.OAuthClientID == "" {
-		return userFromHeaders(next)
+		return userFromHeaders(auth, next)
 	}
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		info := validate.GetTokenInfo(req)
@@ -99,6 +143,7 @@ func setupContext(auth *types.Auth, next http.Handler) http.Handler {
 			nctx := types.NanobotContext(req.Context())
 			nctx.User = user
 			nctx.User.ID = info.UserID
+			nctx.Admin = auth.IsAdmin(nctx.User)
 			req = req.WithContext(types.WithNanobotContext(req.Context(), nctx))
 		}
 		next.ServeHTTP(rw, req)
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func TestWithPublicPaths(t *testing.T) {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			_, _ = rw.Write([]byte(name))
+		})
+	}
+	h := withPublicPaths(handler("oauth"), handler("public"), []string{"/healthz", "/api/shares/"})
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/healthz", expected: "public"},
+		{path: "/api/shares/token", expected: "public"},
+		{path: "/api/shares", expected: "oauth"},
+		{path: "/healthz/other", expected: "oauth"},
+		{path: "/mcp", expected: "oauth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rw.Body.String() != tt.expected {
+				t.Errorf("expected %s to be served by %s, got %s", tt.path, tt.expected, rw.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminEmailMustBeVerified(t *testing.T) {
+	auth := &types.Auth{Admins: []string{"ops@example.com", "root"}}
+	workspace := types.Workspace{Users: []string{"ops@example.com"}}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		admin   bool
+		member  bool
+	}{
+		{name: "verified email", headers: map[string]string{"id": "1", "email": "OPS@example.com", "email_verified": "true"}, admin: true, member: true},
+		{name: "unverified email", headers: map[string]string{"id": "1", "email": "ops@example.com"}},
+		{name: "id", headers: map[string]string{"id": "root"}, admin: true},
+		{name: "other user", headers: map[string]string{"id": "2", "email": "dev@example.com", "email_verified": "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nctx types.Context
+			h := userFromHeaders(auth, http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+				nctx = types.NanobotContext(req.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/mcp", nil)
+			for key, value := range tt.headers {
+				req.Header.Set("X-Forwarded-"+key, value)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if nctx.Admin != tt.admin {
+				t.Errorf("expected admin %v, got %v", tt.admin, nctx.Admin)
+			}
+			if member := workspace.HasUser(nctx.User); member != tt.member {
+				t.Errorf("expected member %v, got %v", tt.member, member)
+			}
+		})
+	}
+}
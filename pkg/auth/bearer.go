@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+var errNoCredentials = errors.New("no credentials")
+
+// bearerAuth authenticates requests with the API keys or JWTs of the auth config. Requests without
+// valid credentials are passed to fallback if it is set, otherwise they are rejected.
+type bearerAuth struct {
+	auth        *types.Auth
+	jwks        *jwks
+	publicPaths []string
+	next        http.Handler
+	fallback    http.Handler
+}
+
+func newBearerAuth(auth *types.Auth, next, fallback http.Handler, publicPaths []string) *bearerAuth {
+	b := &bearerAuth{
+		auth:        auth,
+		publicPaths: publicPaths,
+		next:        next,
+		fallback:    fallback,
+	}
+	if auth.JWT != nil {
+		b.jwks = newJWKS(auth.JWT.JWKSURL)
+	}
+	return b
+}
+
+func (b *bearerAuth) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if isPublic(b.publicPaths, req.URL.Path) {
+		if b.fallback != nil {
+			b.fallback.ServeHTTP(rw, req)
+		} else {
+			b.next.ServeHTTP(rw, req)
+		}
+		return
+	}
+
+	user, agents, tools, err := b.authenticate(req)
+	if err != nil {
+		if b.fallback != nil {
+			b.fallback.ServeHTTP(rw, req)
+			return
+		}
+		rw.Header().Set("WWW-Authenticate", `Bearer realm="nanobot"`)
+		if errors.Is(err, errNoCredentials) {
+			http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+		} else {
+			http.Error(rw, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		}
+		return
+	}
+
+	nctx := types.NanobotContext(req.Context())
+	nctx.User = user
+	nctx.Admin = b.auth.IsAdmin(user)
+	nctx.AllowedAgents = agents
+	nctx.AllowedTools = tools
+	b.next.ServeHTTP(rw, req.WithContext(types.WithNanobotContext(req.Context(), nctx)))
+}
+
+// isPublic returns true if the path is a public path, or is below a public path that ends with a slash.
+func isPublic(publicPaths []string, path string) bool {
+	return slices.ContainsFunc(publicPaths, func(public string) bool {
+		return path == public || strings.HasSuffix(public, "/") && strings.HasPrefix(path, public)
+	})
+}
+
+func (b *bearerAuth) authenticate(req *http.Request) (_ types.User, agents, tools []string, _ error) {
+	token := req.Header.Get("X-API-Key")
+	if token == "" {
+		scheme, value, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			token = strings.TrimSpace(value)
+		}
+	}
+	if token == "" {
+		return types.User{}, nil, nil, errNoCredentials
+	}
+
+	for _, key := range b.auth.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key.Key)) == 1 {
+			agents, tools = scope(b.auth, key.Roles, key.Agents)
+			return types.User{
+				ID:   "apikey:" + key.Name,
+				Name: key.Name,
+			}, agents, tools, nil
+		}
+	}
+
+	if b.jwks == nil {
+		return types.User{}, nil, nil, errors.New("invalid API key")
+	}
+
+	return b.validateJWT(req.Context(), token)
+}
+
+func (b *bearerAuth) validateJWT(ctx context.Context, token string) (types.User, []string, []string, error) {
+	config := b.auth.JWT
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+	}
+	if config.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		opts = append(opts, jwt.WithAudience(config.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, b.jwks.keyfunc(ctx), opts...); err != nil {
+		return types.User{}, nil, nil, err
+	}
+
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return types.User{}, nil, nil, errors.New("token has no subject")
+	}
+
+	user := types.User{
+		ID:  sub,
+		Sub: sub,
+	}
+	user.Email, _ = claims["email"].(string)
+	user.EmailVerified, _ = claims["email_verified"].(bool)
+	user.Name, _ = claims["name"].(string)
+	user.Login, _ = claims["preferred_username"].(string)
+
+	agents := []string(config.Agents)
+	if config.AgentsClaim != "" {
+		if claimAgents, ok := namesFromClaim(claims[config.AgentsClaim]); ok {
+			agents = claimAgents
+		}
+	}
+
+	roles := []string(config.Roles)
+	if config.RolesClaim != "" {
+		if claimRoles, ok := namesFromClaim(claims[config.RolesClaim]); ok {
+			roles = claimRoles
+		}
+	}
+
+	agents, tools := scope(b.auth, roles, agents)
+	return user, agents, tools, nil
+}
+
+// namesFromClaim accepts a list of names or a string of names separated by spaces or commas.
+func namesFromClaim(claim any) ([]string, bool) {
+	names := []string{}
+	switch v := claim.(type) {
+	case string:
+		names = append(names, strings.FieldsFunc(v, func(r rune) bool {
+			return r == ' ' || r == ','
+		})...)
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				names = append(names, s)
+			}
+		}
+	default:
+		return nil, false
+	}
+	return names, true
+}
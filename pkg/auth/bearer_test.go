@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// testJWKS serves the public keys of its signing keys, or fails while failing is set.
+type testJWKS struct {
+	t       *testing.T
+	lock    sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	failing bool
+	fetches int
+}
+
+func newTestJWKS(t *testing.T, kids ...string) (*testJWKS, *httptest.Server) {
+	j := &testJWKS{t: t, keys: map[string]*rsa.PrivateKey{}}
+	for _, kid := range kids {
+		j.addKey(kid)
+	}
+	srv := httptest.NewServer(j)
+	t.Cleanup(srv.Close)
+	return j, srv
+}
+
+func (j *testJWKS) addKey(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		j.t.Fatal(err)
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.keys[kid] = key
+}
+
+func (j *testJWKS) setFailing(failing bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.failing = failing
+}
+
+func (j *testJWKS) fetchCount() int {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.fetches
+}
+
+func (j *testJWKS) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.fetches++
+	if j.failing {
+		http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	for kid, key := range j.keys {
+		set.Keys = append(set.Keys, jwk{
+			Kid: kid,
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	_ = json.NewEncoder(rw).Encode(set)
+}
+
+// token signs the claims with the key of kid, or with a key the JWKS does not serve if it is unknown.
+func (j *testJWKS) token(kid string, claims jwt.MapClaims) string {
+	j.lock.Lock()
+	key, ok := j.keys[kid]
+	j.lock.Unlock()
+	if !ok {
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			j.t.Fatal(err)
+		}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		j.t.Fatal(err)
+	}
+	return signed
+}
+
+func claims(sub string, expires time.Duration) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": sub,
+		"exp": time.Now().Add(expires).Unix(),
+	}
+}
+
+func authenticate(b *bearerAuth, headers map[string]string) (types.User, []string, []string, error) {
+	req := httptest.NewRequest(http.MethodGet, "/mcp", nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return b.authenticate(req)
+}
+
+func TestAPIKey(t *testing.T) {
+	b := newBearerAuth(&types.Auth{
+		APIKeys: []types.APIKey{
+			{Name: "ci", Key: "secret", Roles: []string{"reader"}},
+		},
+		Roles: map[string]types.Role{
+			"reader": {Tools: []string{"search/*"}},
+		},
+	}, nil, nil, nil)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		user    string
+		err     bool
+	}{
+		{name: "header", headers: map[string]string{"X-API-Key": "secret"}, user: "apikey:ci"},
+		{name: "bearer", headers: map[string]string{"Authorization": "Bearer secret"}, user: "apikey:ci"},
+		{name: "invalid key", headers: map[string]string{"X-API-Key": "other"}, err: true},
+		{name: "no credentials", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, _, tools, err := authenticate(b, tt.headers)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got user %q", user.ID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.ID != tt.user {
+				t.Errorf("expected user %q, got %q", tt.user, user.ID)
+			}
+			if !slices.Equal(tools, []string{"search/*"}) {
+				t.Errorf("expected the tools of the reader role, got %v", tools)
+			}
+		})
+	}
+}
+
+func TestJWT(t *testing.T) {
+	keys, srv := newTestJWKS(t, "k1")
+	b := newBearerAuth(&types.Auth{
+		JWT: &types.JWTAuth{JWKSURL: srv.URL, RolesClaim: "roles"},
+		Roles: map[string]types.Role{
+			"writer": {Agents: []string{"main"}},
+		},
+	}, nil, nil, nil)
+
+	withRoles := claims("alice", time.Hour)
+	withRoles["roles"] = "writer"
+
+	tests := []struct {
+		name   string
+		token  string
+		user   string
+		agents []string
+		err    bool
+	}{
+		{name: "valid", token: keys.token("k1", claims("alice", time.Hour)), user: "alice"},
+		{name: "roles claim", token: keys.token("k1", withRoles), user: "alice", agents: []string{"main"}},
+		{name: "expired", token: keys.token("k1", claims("alice", -time.Minute)), err: true},
+		{name: "unknown kid", token: keys.token("k2", claims("alice", time.Hour)), err: true},
+		{name: "no expiry", token: keys.token("k1", jwt.MapClaims{"sub": "alice"}), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, agents, _, err := authenticate(b, map[string]string{"Authorization": "Bearer " + tt.token})
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got user %q", user.ID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.ID != tt.user {
+				t.Errorf("expected user %q, got %q", tt.user, user.ID)
+			}
+			if !slices.Equal(agents, tt.agents) {
+				t.Errorf("expected agents %v, got %v", tt.agents, agents)
+			}
+		})
+	}
+
+	if n := keys.fetchCount(); n != 1 {
+		t.Errorf("expected the unknown kid not to refresh the JWKS within a minute of the last fetch, got %d fetches", n)
+	}
+}
+
+func TestJWKSRefresh(t *testing.T) {
+	keys, srv := newTestJWKS(t, "k1")
+	b := newBearerAuth(&types.Auth{JWT: &types.JWTAuth{JWKSURL: srv.URL}}, nil, nil, nil)
+	bearer := func(kid string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + keys.token(kid, claims("alice", time.Hour))}
+	}
+	backdate := func(fetched, attempted time.Duration) {
+		b.jwks.lock.Lock()
+		defer b.jwks.lock.Unlock()
+		b.jwks.fetched = time.Now().Add(-fetched)
+		b.jwks.attempted = time.Now().Add(-attempted)
+	}
+
+	if _, _, _, err := authenticate(b, bearer("k1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A key that was added to the JWKS is found by refreshing on its unknown kid.
+	keys.addKey("k2")
+	backdate(2*jwksMinRefreshInterval, 2*jwksMinRefreshInterval)
+	if _, _, _, err := authenticate(b, bearer("k2")); err != nil {
+		t.Fatalf("expected the new key to be fetched: %v", err)
+	}
+	if n := keys.fetchCount(); n != 2 {
+		t.Errorf("expected 2 fetches, got %d", n)
+	}
+
+	// The keys fetched before are used while the JWKS fails.
+	keys.setFailing(true)
+	backdate(2*jwksRefreshInterval, 2*jwksMinRefreshInterval)
+	for _, kid := range []string{"k1", "k2"} {
+		if _, _, _, err := authenticate(b, bearer(kid)); err != nil {
+			t.Errorf("expected %s to be valid while the JWKS fails: %v", kid, err)
+		}
+	}
+	backdate(2*jwksRefreshInterval, 2*jwksMinRefreshInterval)
+	if _, _, _, err := authenticate(b, bearer("k3")); err == nil {
+		t.Error("expected the unknown kid to be rejected")
+	}
+	if _, _, _, err := authenticate(b, bearer("k1")); err != nil {
+		t.Errorf("expected k1 to be valid after a failed refresh: %v", err)
+	}
+}
+
+func TestScope(t *testing.T) {
+	auth := &types.Auth{
+		Roles: map[string]types.Role{
+			"reader": {Tools: []string{"search/*"}, Agents: []string{"main"}},
+			"writer": {Tools: []string{"files/write"}, Agents: []string{"main", "editor"}},
+			"admin":  {},
+		},
+		DefaultRoles: []string{"reader"},
+	}
+
+	tests := []struct {
+		name   string
+		roles  []string
+		agents []string
+		// allowedAgents and allowedTools are nil if everything is allowed
+		allowedAgents []string
+		allowedTools  []string
+	}{
+		{name: "default roles", allowedAgents: []string{"main"}, allowedTools: []string{"search/*"}},
+		{name: "merged roles", roles: []string{"reader", "writer"}, allowedAgents: []string{"main", "editor"}, allowedTools: []string{"search/*", "files/write"}},
+		{name: "role allowing everything", roles: []string{"reader", "admin"}},
+		{name: "limited agents", roles: []string{"writer"}, agents: []string{"editor"}, allowedAgents: []string{"editor"}, allowedTools: []string{"files/write"}},
+		{name: "agents outside the role", roles: []string{"reader"}, agents: []string{"editor"}, allowedAgents: []string{}, allowedTools: []string{"search/*"}},
+		{name: "undefined role", roles: []string{"missing"}, allowedAgents: []string{}, allowedTools: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agents, tools := scope(auth, tt.roles, tt.agents)
+			if !slices.Equal(agents, tt.allowedAgents) || (agents == nil) != (tt.allowedAgents == nil) {
+				t.Errorf("expected agents %#v, got %#v", tt.allowedAgents, agents)
+			}
+			if !slices.Equal(tools, tt.allowedTools) || (tools == nil) != (tt.allowedTools == nil) {
+				t.Errorf("expected tools %#v, got %#v", tt.allowedTools, tools)
+			}
+		})
+	}
+}
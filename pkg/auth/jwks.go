@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+)
+
+const (
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefreshInterval limits how often an unknown key ID triggers a refresh of the key set.
+	jwksMinRefreshInterval = time.Minute
+	jwksRefreshTimeout     = 10 * time.Second
+)
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwks fetches and caches the public keys of a JWKS URL. The last key set that was fetched is used
+// until a refresh succeeds.
+type jwks struct {
+	url    string
+	client *http.Client
+	// refreshLock serializes the fetches of the key set, lock guards the fields below it
+	refreshLock sync.Mutex
+	lock        sync.Mutex
+	keys        map[string]any
+	fetched     time.Time
+	attempted   time.Time
+	err         error
+}
+
+func newJWKS(url string) *jwks {
+	return &jwks{
+		url: url,
+		client: &http.Client{
+			Transport: transport.Transport,
+		},
+	}
+}
+
+// keyfunc returns the function that finds the key that signed a token, refreshing the key set with the
+// ctx of the request if the key ID is unknown. Keys of a key set that is due for a refresh are still
+// used while it is refreshed in the background.
+func (j *jwks) keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, ok, stale, canRefresh := j.lookup(kid)
+		if ok {
+			if stale && canRefresh {
+				go func() {
+					if err := j.refresh(context.WithoutCancel(ctx)); err != nil {
+						log.Errorf(ctx, "failed to refresh JWKS, using the keys fetched before: %v", err)
+					}
+				}()
+			}
+			return key, nil
+		}
+
+		if canRefresh {
+			if err := j.refresh(ctx); err != nil {
+				return nil, err
+			}
+			if key, ok, _, _ = j.lookup(kid); ok {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("no key with id %q in JWKS", kid)
+	}
+}
+
+// lookup returns the key with the ID, whether the key set is due for a refresh, and whether it may be
+// refreshed now.
+func (j *jwks) lookup(kid string) (key any, ok, stale, canRefresh bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	key, ok = j.keys[kid]
+	if !ok && kid == "" && len(j.keys) == 1 {
+		for _, key = range j.keys {
+			ok = true
+		}
+	}
+	stale = j.keys == nil || time.Since(j.fetched) > jwksRefreshInterval
+	canRefresh = j.keys == nil || time.Since(j.attempted) > jwksMinRefreshInterval
+	return key, ok, stale, canRefresh
+}
+
+// refresh fetches the key set, the keys are kept if it fails. Callers that wait for another refresh get
+// its result.
+func (j *jwks) refresh(ctx context.Context) error {
+	start := time.Now()
+
+	j.refreshLock.Lock()
+	defer j.refreshLock.Unlock()
+
+	j.lock.Lock()
+	if j.attempted.After(start) {
+		err := j.err
+		j.lock.Unlock()
+		return err
+	}
+	j.attempted = time.Now()
+	j.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, jwksRefreshTimeout)
+	defer cancel()
+	keys, err := j.fetch(ctx)
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.err = err
+	if err == nil {
+		j.keys = keys
+		j.fetched = time.Now()
+	}
+	return err
+}
+
+func (j *jwks) fetch(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWKS key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// publicKey returns the key, or nil if the key type is not supported.
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBase64URL(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URL(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+		x, err := decodeBase64URL(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URL(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := decodeBase64URL(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// scope returns the agents and tools an identity with the given roles may use, nil allows all. The
+// default roles apply if roles is empty. If agents is set the allowed agents are limited to them.
+func scope(auth *types.Auth, roles, agents []string) (allowedAgents, allowedTools []string) {
+	if len(roles) == 0 {
+		roles = auth.DefaultRoles
+	}
+	if len(roles) == 0 {
+		return limitAgents(nil, agents), nil
+	}
+
+	allowedAgents = []string{}
+	allowedTools = []string{}
+	for _, name := range roles {
+		role, ok := auth.Roles[name]
+		if !ok {
+			continue
+		}
+		if len(role.Tools) == 0 && len(role.Agents) == 0 {
+			return limitAgents(nil, agents), nil
+		}
+		for _, agent := range role.Agents {
+			if !slices.Contains(allowedAgents, agent) {
+				allowedAgents = append(allowedAgents, agent)
+			}
+		}
+		for _, tool := range role.Tools {
+			if !slices.Contains(allowedTools, tool) {
+				allowedTools = append(allowedTools, tool)
+			}
+		}
+	}
+	return limitAgents(allowedAgents, agents), allowedTools
+}
+
+func limitAgents(allowed, agents []string) []string {
+	if len(agents) == 0 {
+		return allowed
+	}
+	if allowed == nil {
+		return agents
+	}
+	var result []string
+	for _, agent := range allowed {
+		if slices.Contains(agents, agent) {
+			result = append(result, agent)
+		}
+	}
+	if result == nil {
+		result = []string{}
+	}
+	return result
+}
+
+// defaultScope applies the default roles to the requests of identities authenticated by OAuth or by
+// the headers of a reverse proxy.
+func defaultScope(auth *types.Auth, next http.Handler) http.Handler {
+	if len(auth.DefaultRoles) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nctx := types.NanobotContext(req.Context())
+		nctx.AllowedAgents, nctx.AllowedTools = scope(auth, nil, nil)
+		next.ServeHTTP(rw, req.WithContext(types.WithNanobotContext(req.Context(), nctx)))
+	})
+}
@@ -0,0 +1,127 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/usage"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Record is one line of the input file. A line is either a JSON object or a JSON string that is used
+// as the prompt.
+type Record struct {
+	// ID identifies the record in the output, it defaults to the line number.
+	ID     string `json:"id,omitempty"`
+	Prompt string `json:"prompt,omitempty"`
+	// Agent overrides the agent of the batch for this record.
+	Agent string `json:"agent,omitempty"`
+}
+
+// Result is one line of the output file.
+type Result struct {
+	ID        string           `json:"id"`
+	Agent     string           `json:"agent,omitempty"`
+	Status    string           `json:"status"`
+	Output    string           `json:"output,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	ToolCalls []types.ToolCall `json:"toolCalls,omitempty"`
+	Usage     *usage.Totals    `json:"usage,omitempty"`
+	Attempts  int              `json:"attempts,omitempty"`
+	Duration  time.Duration    `json:"duration,omitempty"`
+}
+
+// Read parses the records of a JSONL input. Blank lines are skipped.
+func Read(r io.Reader) ([]Record, error) {
+	var (
+		records []Record
+		ids     = map[string]int{}
+		scanner = bufio.NewScanner(r)
+		line    int
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var record Record
+		if data[0] == '"' {
+			if err := json.Unmarshal(data, &record.Prompt); err != nil {
+				return nil, fmt.Errorf("failed to parse line %d: %w", line, err)
+			}
+		} else if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d: %w", line, err)
+		}
+
+		if record.Prompt == "" {
+			return nil, fmt.Errorf("line %d has no prompt", line)
+		}
+		if record.ID == "" {
+			record.ID = strconv.Itoa(line)
+		}
+		if previous, ok := ids[record.ID]; ok {
+			return nil, fmt.Errorf("line %d has the same id %q as line %d", line, record.ID, previous)
+		}
+		ids[record.ID] = line
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	return records, nil
+}
+
+// Completed returns the ids of the records that succeeded in the output file of a previous run, so
+// they are skipped when the run is resumed. A partial last line, left by a crash while it was
+// written, is removed from the file.
+func Completed(file string) (map[string]bool, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]bool{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	if i := bytes.LastIndexByte(data, '\n'); i != len(data)-1 {
+		data = data[:i+1]
+		if err := os.Truncate(file, int64(len(data))); err != nil {
+			return nil, fmt.Errorf("failed to remove partial line from %s: %w", file, err)
+		}
+	}
+
+	completed := map[string]bool{}
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var result Result
+		if err := json.Unmarshal(line, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of %s: %w", i+1, file, err)
+		}
+		// A record that failed and was retried on resume has its newer result on a later line
+		completed[result.ID] = result.Status == StatusOK
+	}
+	for id, ok := range completed {
+		if !ok {
+			delete(completed, id)
+		}
+	}
+	return completed, nil
+}
@@ -0,0 +1,82 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompleted(t *testing.T) {
+	tests := []struct {
+		name      string
+		missing   bool
+		content   string
+		completed []string
+		remaining string
+	}{
+		{name: "no file", missing: true},
+		{name: "empty", content: ""},
+		{
+			name:      "succeeded and failed",
+			content:   `{"id":"1","status":"ok"}` + "\n" + `{"id":"2","status":"error"}` + "\n",
+			completed: []string{"1"},
+			remaining: `{"id":"1","status":"ok"}` + "\n" + `{"id":"2","status":"error"}` + "\n",
+		},
+		{
+			name:      "retried after a failure",
+			content:   `{"id":"1","status":"error"}` + "\n" + `{"id":"1","status":"ok"}` + "\n",
+			completed: []string{"1"},
+			remaining: `{"id":"1","status":"error"}` + "\n" + `{"id":"1","status":"ok"}` + "\n",
+		},
+		{
+			name:      "partial last line",
+			content:   `{"id":"1","status":"ok"}` + "\n" + `{"id":"2","sta`,
+			completed: []string{"1"},
+			remaining: `{"id":"1","status":"ok"}` + "\n",
+		},
+		{name: "only a partial line", content: `{"id":"1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "out.jsonl")
+			if !tt.missing {
+				if err := os.WriteFile(file, []byte(tt.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			completed, err := Completed(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(completed) != len(tt.completed) {
+				t.Errorf("expected %v to be completed, got %v", tt.completed, completed)
+			}
+			for _, id := range tt.completed {
+				if !completed[id] {
+					t.Errorf("expected %s to be completed", id)
+				}
+			}
+
+			if !tt.missing {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != tt.remaining {
+					t.Errorf("expected the file to be %q, got %q", tt.remaining, data)
+				}
+			}
+		})
+	}
+
+	t.Run("invalid line", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "out.jsonl")
+		if err := os.WriteFile(file, []byte("not json\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Completed(file); err == nil {
+			t.Error("expected an error for an invalid line")
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/eval"
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tools"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/usage"
+)
+
+type Caller interface {
+	Call(ctx context.Context, server, tool string, args any, opts ...tools.CallOptions) (*types.CallResult, error)
+}
+
+type Options struct {
+	// Agent the records are run against, unless the record sets one.
+	Agent string
+	// Concurrency is the number of records that run at the same time. Defaults to 4.
+	Concurrency int
+	// Retries is how often a record is run again after a rate limit or a transient error.
+	Retries int
+	// Backoff is the pause of all records after a rate limit, doubled for each retry. Defaults to 2s.
+	Backoff time.Duration
+}
+
+func (o Options) Merge(other Options) (result Options) {
+	result.Agent = complete.Last(o.Agent, other.Agent)
+	result.Concurrency = complete.Last(o.Concurrency, other.Concurrency)
+	result.Retries = complete.Last(o.Retries, other.Retries)
+	result.Backoff = complete.Last(o.Backoff, other.Backoff)
+	return
+}
+
+func (o Options) Complete() Options {
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+	o.Retries = max(o.Retries, 0)
+	if o.Backoff <= 0 {
+		o.Backoff = 2 * time.Second
+	}
+	return o
+}
+
+// Run runs each record in a new session returned by newSession, with at most Concurrency records at a
+// time, and passes the results to write in the order they finish. Records still running when ctx is
+// canceled are not written, so they run again when the batch is resumed.
+func Run(ctx context.Context, caller Caller, records []Record, newSession func(context.Context) context.Context, write func(Result) error, opts ...Options) error {
+	opt := complete.Complete(opts...)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		slots   = make(chan struct{}, opt.Concurrency)
+		limiter = &limiter{}
+	)
+
+	for _, record := range records {
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			result := runRecord(ctx, caller, limiter, record, newSession, opt)
+			if ctx.Err() != nil {
+				return
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err := write(result); err != nil {
+				cancel(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if err := context.Cause(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return ctx.Err()
+}
+
+func runRecord(ctx context.Context, caller Caller, limiter *limiter, record Record, newSession func(context.Context) context.Context, opt Options) (result Result) {
+	start := time.Now()
+	result.ID = record.ID
+	result.Agent = complete.First(record.Agent, opt.Agent)
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	backoff := opt.Backoff
+	for {
+		result.Attempts++
+		if err := limiter.wait(ctx); err != nil {
+			result.Status, result.Error = StatusError, err.Error()
+			return
+		}
+
+		sessionCtx := newSession(ctx)
+		callResult, err := caller.Call(sessionCtx, result.Agent, result.Agent, types.SampleCallRequest{
+			Prompt: record.Prompt,
+		})
+		if err == nil {
+			session := mcp.SessionFromContext(sessionCtx)
+			result.Output = callResult.Text()
+			result.ToolCalls = eval.ToolCalls(session)
+			result.Usage = usage.SessionTotals(session)
+			if callResult.IsError {
+				result.Status, result.Error = StatusError, "agent returned an error"
+			} else {
+				result.Status, result.Error = StatusOK, ""
+			}
+			return
+		}
+
+		result.Status, result.Error = StatusError, err.Error()
+		retryable, wait := retryable(err)
+		if !retryable || result.Attempts > opt.Retries || ctx.Err() != nil {
+			return
+		}
+		if wait <= 0 {
+			wait = backoff + rand.N(backoff/2+1)
+			backoff *= 2
+		}
+
+		log.Infof(ctx, "retrying record %s in %s after attempt %d failed: %v", record.ID, wait.Round(time.Millisecond), result.Attempts, err)
+		limiter.pause(wait)
+	}
+}
+
+// retryable returns true if the call may succeed when it is made again. Errors of the LLM providers
+// reach the caller as text when the agent runs behind an MCP session, so the text is checked too.
+func retryable(err error) (bool, time.Duration) {
+	if ok, wait := retry.Retryable(err); ok {
+		return true, wait
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"429", "too many requests", "rate limit", "overloaded", "503 service unavailable"} {
+		if strings.Contains(msg, s) {
+			return true, 0
+		}
+	}
+	return false, 0
+}
+
+// limiter pauses all records after one of them is rate limited, so the others do not keep hitting
+// the limit while it waits.
+type limiter struct {
+	lock  sync.Mutex
+	until time.Time
+}
+
+func (l *limiter) pause(d time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if until := time.Now().Add(d); until.After(l.until) {
+		l.until = until
+	}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	for {
+		l.lock.Lock()
+		wait := time.Until(l.until)
+		l.lock.Unlock()
+		if wait <= 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
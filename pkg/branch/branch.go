@@ -0,0 +1,237 @@
+package branch
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tokens"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+const (
+	// Main is the ID of the branch of a chat before it was first forked
+	Main = "main"
+
+	// The keys start with the thread key so that cloned sessions keep their branches.
+	SessionKey       = types.PreviousExecutionKey + "Branches"
+	threadSessionKey = types.PreviousExecutionKey + "Branch/"
+)
+
+// Branch is a version of the conversation of a chat. Forked branches start with the messages of their
+// parent before MessageIndex.
+type Branch struct {
+	ID           string    `json:"id"`
+	Parent       string    `json:"parent,omitempty"`
+	MessageIndex int       `json:"messageIndex"`
+	Created      time.Time `json:"created,omitzero"`
+	Current      bool      `json:"current,omitempty"`
+	Messages     int       `json:"messages"`
+}
+
+type Branches struct {
+	Current  string   `json:"current,omitempty"`
+	Branches []Branch `json:"branches,omitempty"`
+}
+
+func (b Branches) Serialize() (any, error) {
+	return b, nil
+}
+
+func (b *Branches) Deserialize(data any) (any, error) {
+	if err := mcp.JSONCoerce(data, b); err != nil {
+		return nil, err
+	}
+	return *b, nil
+}
+
+// branchLock serializes forks and switches of the branches of a session.
+var branchLock sync.Mutex
+
+// List returns the branches of the chat of the session, with the number of messages of each.
+func List(session *mcp.Session) []Branch {
+	session = session.Root()
+
+	branchLock.Lock()
+	defer branchLock.Unlock()
+
+	branches := getBranches(session)
+	result := make([]Branch, 0, len(branches.Branches))
+	for _, branch := range branches.Branches {
+		var run types.Execution
+		if branch.ID == branches.Current {
+			branch.Current = true
+			session.Get(types.PreviousExecutionKey, &run)
+		} else {
+			session.Get(threadSessionKey+branch.ID, &run)
+		}
+		branch.Messages = len(Transcript(&run))
+		result = append(result, branch)
+	}
+	return result
+}
+
+// Fork starts a new branch of the chat of the session with the messages of the transcript before
+// messageIndex and makes it the current branch. The current branch is kept so that it can be switched back to.
+func Fork(session *mcp.Session, messageIndex int) (Branch, error) {
+	session = session.Root()
+
+	branchLock.Lock()
+	defer branchLock.Unlock()
+
+	var run types.Execution
+	if !session.Get(types.PreviousExecutionKey, &run) {
+		return Branch{}, fmt.Errorf("the chat has no messages to fork")
+	}
+
+	history := history(&run)
+	positions := transcriptPositions(history)
+	if messageIndex < 0 || messageIndex > len(positions) {
+		return Branch{}, fmt.Errorf("message index %d is out of range, the chat has %d messages", messageIndex, len(positions))
+	}
+
+	keep := len(history)
+	if messageIndex < len(positions) {
+		keep = positions[messageIndex]
+	}
+
+	var populated types.CompletionRequest
+	if run.PopulatedRequest != nil {
+		populated = *run.PopulatedRequest
+	}
+	populated.Input = slices.Clone(history[:keep])
+
+	branches := getBranches(session)
+	branch := Branch{
+		ID:           uuid.String(),
+		Parent:       branches.Current,
+		MessageIndex: messageIndex,
+		Created:      time.Now(),
+	}
+
+	session.Set(threadSessionKey+branches.Current, &run)
+	session.Set(types.PreviousExecutionKey, &types.Execution{
+		Request:          run.Request,
+		Done:             true,
+		PopulatedRequest: &populated,
+		ToolToMCPServer:  run.ToolToMCPServer,
+		Response:         &types.CompletionResponse{},
+	})
+
+	branches.Current = branch.ID
+	branches.Branches = append(slices.Clone(branches.Branches), branch)
+	session.Set(SessionKey, branches)
+
+	branch.Current = true
+	branch.Messages = messageIndex
+	return branch, nil
+}
+
+// Switch makes the branch the current branch of the chat of the session.
+func Switch(session *mcp.Session, id string) (Branch, error) {
+	session = session.Root()
+
+	branchLock.Lock()
+	defer branchLock.Unlock()
+
+	branches := getBranches(session)
+	i := slices.IndexFunc(branches.Branches, func(branch Branch) bool {
+		return branch.ID == id
+	})
+	if i < 0 {
+		return Branch{}, fmt.Errorf("branch %s not found", id)
+	}
+
+	var run types.Execution
+	session.Get(types.PreviousExecutionKey, &run)
+	if id != branches.Current {
+		var target types.Execution
+		if !session.Get(threadSessionKey+id, &target) {
+			return Branch{}, fmt.Errorf("branch %s has no messages", id)
+		}
+		session.Set(threadSessionKey+branches.Current, &run)
+		session.Set(types.PreviousExecutionKey, &target)
+		session.Delete(threadSessionKey + id)
+		run = target
+
+		branches.Current = id
+		session.Set(SessionKey, branches)
+	}
+
+	branch := branches.Branches[i]
+	branch.Current = true
+	branch.Messages = len(Transcript(&run))
+	return branch, nil
+}
+
+// Transcript returns the messages of the thread as they are shown to users, the indexes of forks refer to them.
+func Transcript(run *types.Execution) []types.Message {
+	var model string
+	if run.PopulatedRequest != nil {
+		model = run.PopulatedRequest.Model
+	}
+	return tokens.Annotate(model, types.ConsolidateTools(history(run)))
+}
+
+// TurnStart returns the index of the first message of the transcript after the last message of the user
+// at or before messageIndex, so that the whole response of the agent to the user is regenerated.
+func TurnStart(transcript []types.Message, messageIndex int) int {
+	messageIndex = min(max(messageIndex, 0), len(transcript))
+	for messageIndex > 0 && transcript[messageIndex-1].Role != "user" {
+		messageIndex--
+	}
+	return messageIndex
+}
+
+// history returns the messages the next completion of the thread starts with.
+func history(run *types.Execution) []types.Message {
+	var messages []types.Message
+	if run.PopulatedRequest != nil {
+		messages = append(messages, run.PopulatedRequest.Input...)
+	}
+	if run.Response != nil {
+		messages = append(messages, run.Response.Output)
+	}
+	return messages
+}
+
+// transcriptPositions returns the index in messages of each message of the transcript of the messages,
+// skipping the messages that only have results of tool calls the transcript merges into the calls.
+func transcriptPositions(messages []types.Message) []int {
+	var (
+		calls  = map[string]bool{}
+		result []int
+	)
+	for i, msg := range messages {
+		shown := false
+		for _, item := range msg.Items {
+			if item.ToolCallResult != nil && item.ToolCall == nil && calls[item.ToolCallResult.CallID] {
+				continue
+			}
+			if item.ToolCall != nil && item.ToolCallResult == nil {
+				calls[item.ToolCall.CallID] = true
+			}
+			shown = true
+		}
+		if shown {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// getBranches returns the branches of the session, a chat that was never forked has only the main branch.
+func getBranches(session *mcp.Session) Branches {
+	var branches Branches
+	session.Get(SessionKey, &branches)
+	if len(branches.Branches) == 0 {
+		branches = Branches{
+			Current:  Main,
+			Branches: []Branch{{ID: Main}},
+		}
+	}
+	return branches
+}
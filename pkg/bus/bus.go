@@ -0,0 +1,89 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// Bus carries messages between the processes of a deployment. Messages published on a topic are
+// received by the subscribers of the topic in every process, including the publishing one.
+type Bus interface {
+	Publish(ctx context.Context, topic string, data []byte) error
+	// Subscribe returns a channel of the messages published on topic after it is called. The channel
+	// is closed when ctx is done.
+	Subscribe(ctx context.Context, topic string) (<-chan []byte, error)
+	Close() error
+}
+
+// New returns the bus at the URL, redis:// and rediss:// URLs use Redis Streams and memory:// a bus
+// that only reaches the subscribers of this process.
+func New(busURL string) (Bus, error) {
+	u, err := url.Parse(busURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bus URL %q: %w", busURL, err)
+	}
+	switch u.Scheme {
+	case "redis", "rediss":
+		return NewRedis(busURL)
+	case "memory":
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unsupported bus URL %q, expected redis://, rediss://, or memory://", busURL)
+	}
+}
+
+type memory struct {
+	lock        sync.Mutex
+	subscribers map[string]map[chan []byte]struct{}
+}
+
+// NewMemory returns a bus that delivers messages to the subscribers of this process.
+func NewMemory() Bus {
+	return &memory{
+		subscribers: map[string]map[chan []byte]struct{}{},
+	}
+}
+
+func (m *memory) Publish(_ context.Context, topic string, data []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for ch := range m.subscribers[topic] {
+		select {
+		case ch <- data:
+		default:
+			// Slow subscribers miss messages rather than block publishers
+		}
+	}
+	return nil
+}
+
+func (m *memory) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	ch := make(chan []byte, 100)
+
+	m.lock.Lock()
+	if m.subscribers[topic] == nil {
+		m.subscribers[topic] = map[chan []byte]struct{}{}
+	}
+	m.subscribers[topic][ch] = struct{}{}
+	m.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		delete(m.subscribers[topic], ch)
+		if len(m.subscribers[topic]) == 0 {
+			delete(m.subscribers, topic)
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
@@ -0,0 +1,202 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// streamPrefix is prepended to topics to get the key of their stream.
+	streamPrefix = "nanobot:bus:"
+	// streamMaxLen is about the number of messages kept in a stream, subscribers only read new messages
+	// so the stream does not need to be longer than what they can fall behind.
+	streamMaxLen = 1000
+	// streamTTL is how long the stream of a topic is kept after the last message was published.
+	streamTTL = time.Hour
+	// blockTimeout is how long a read waits for new messages before it is retried.
+	blockTimeout = 5 * time.Second
+)
+
+type redisBus struct {
+	client *redis.Client
+	// wakeKey is the stream of this process that Subscribe adds to, so that the reader starts
+	// reading the streams of new topics without waiting for blockTimeout.
+	wakeKey string
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	lock    sync.Mutex
+	topics  map[string]*redisTopic
+	reading bool
+}
+
+// redisTopic is a topic subscribed to in this process.
+type redisTopic struct {
+	lastID      string
+	subscribers map[chan []byte]struct{}
+}
+
+// NewRedis returns a bus on Redis Streams, each topic is a stream. A single reader per process reads
+// the streams of all subscribed topics and delivers their messages to the subscribers.
+func NewRedis(redisURL string) (Bus, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &redisBus{
+		client:  redis.NewClient(opts),
+		wakeKey: streamPrefix + "wake:" + uuid.String(),
+		ctx:     ctx,
+		cancel:  cancel,
+		topics:  map[string]*redisTopic{},
+	}, nil
+}
+
+func (r *redisBus) Publish(ctx context.Context, topic string, data []byte) error {
+	if err := r.add(ctx, streamPrefix+topic, streamMaxLen, map[string]any{"data": data}); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+func (r *redisBus) add(ctx context.Context, key string, maxLen int64, values map[string]any) error {
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: key,
+			MaxLen: maxLen,
+			Approx: true,
+			Values: values,
+		})
+		pipe.Expire(ctx, key, streamTTL)
+		return nil
+	})
+	return err
+}
+
+func (r *redisBus) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	key := streamPrefix + topic
+
+	// Start after the last message, so that only messages published from now on are read
+	lastID := "0-0"
+	last, err := r.client.XRevRangeN(ctx, key, "+", "-", 1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", topic, err)
+	}
+	if len(last) > 0 {
+		lastID = last[0].ID
+	}
+
+	ch := make(chan []byte, 100)
+
+	r.lock.Lock()
+	t, ok := r.topics[key]
+	if !ok {
+		t = &redisTopic{
+			lastID:      lastID,
+			subscribers: map[chan []byte]struct{}{},
+		}
+		r.topics[key] = t
+	}
+	t.subscribers[ch] = struct{}{}
+	start := !r.reading
+	r.reading = true
+	r.lock.Unlock()
+
+	if start {
+		go r.read()
+	} else if !ok {
+		if err := r.add(ctx, r.wakeKey, 1, map[string]any{"topic": topic}); err != nil {
+			log.Debugf(ctx, "failed to wake the reader of the bus for %s: %v", topic, err)
+		}
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-r.ctx.Done():
+		}
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		delete(t.subscribers, ch)
+		if len(t.subscribers) == 0 && r.topics[key] == t {
+			delete(r.topics, key)
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// read reads the streams of the subscribed topics and delivers their messages until the bus is
+// closed.
+func (r *redisBus) read() {
+	ctx := r.ctx
+	wakeID := "0-0"
+	for ctx.Err() == nil {
+		r.lock.Lock()
+		keys, ids := []string{r.wakeKey}, []string{wakeID}
+		for key, t := range r.topics {
+			keys = append(keys, key)
+			ids = append(ids, t.lastID)
+		}
+		r.lock.Unlock()
+
+		streams, err := r.client.XRead(ctx, &redis.XReadArgs{
+			Streams: append(keys, ids...),
+			Count:   100,
+			Block:   blockTimeout,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		} else if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf(ctx, "failed to read messages of the bus: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+			continue
+		}
+
+		r.lock.Lock()
+		for _, stream := range streams {
+			if len(stream.Messages) == 0 {
+				continue
+			}
+			if stream.Stream == r.wakeKey {
+				wakeID = stream.Messages[len(stream.Messages)-1].ID
+				continue
+			}
+			t, ok := r.topics[stream.Stream]
+			if !ok {
+				continue
+			}
+			for _, msg := range stream.Messages {
+				t.lastID = msg.ID
+				data, _ := msg.Values["data"].(string)
+				for ch := range t.subscribers {
+					select {
+					case ch <- []byte(data):
+					default:
+						// Slow subscribers miss messages rather than hold up the others
+					}
+				}
+			}
+		}
+		r.lock.Unlock()
+	}
+}
+
+func (r *redisBus) Close() error {
+	r.cancel()
+	return r.client.Close()
+}
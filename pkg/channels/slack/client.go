@@ -0,0 +1,133 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+)
+
+const (
+	apiURL = "https://slack.com/api/"
+	// maxTextLength keeps messages below the limit of Slack for the text of a message.
+	maxTextLength = 39_000
+)
+
+// client is a minimal client of the Slack Web API.
+type client struct {
+	botToken string
+	appToken string
+	http     *http.Client
+}
+
+func newClient(botToken, appToken string) *client {
+	return &client{
+		botToken: botToken,
+		appToken: appToken,
+		http: &http.Client{
+			Transport: transport.Transport,
+			Timeout:   30 * time.Second,
+		},
+	}
+}
+
+type response struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func (c *client) call(ctx context.Context, token, method string, args, result any) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+method, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", method, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to call %s: unexpected status %s", method, resp.Status)
+	}
+
+	var (
+		raw    json.RawMessage
+		status response
+	)
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	if !status.OK {
+		return fmt.Errorf("failed to call %s: %s", method, status.Error)
+	}
+	if result != nil {
+		if err := json.Unmarshal(raw, result); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// botUserID returns the user ID of the bot the bot token belongs to.
+func (c *client) botUserID(ctx context.Context) (string, error) {
+	var result struct {
+		UserID string `json:"user_id"`
+	}
+	err := c.call(ctx, c.botToken, "auth.test", map[string]any{}, &result)
+	return result.UserID, err
+}
+
+// postMessage posts text to the channel, in the thread if threadTS is set, and returns the timestamp of
+// the new message.
+func (c *client) postMessage(ctx context.Context, channel, threadTS, text string) (string, error) {
+	var result struct {
+		TS string `json:"ts"`
+	}
+	err := c.call(ctx, c.botToken, "chat.postMessage", map[string]any{
+		"channel":   channel,
+		"thread_ts": threadTS,
+		"text":      truncate(text),
+	}, &result)
+	return result.TS, err
+}
+
+func (c *client) updateMessage(ctx context.Context, channel, ts, text string) error {
+	return c.call(ctx, c.botToken, "chat.update", map[string]any{
+		"channel": channel,
+		"ts":      ts,
+		"text":    truncate(text),
+	}, nil)
+}
+
+// openConnection returns the WebSocket URL of a new Socket Mode connection.
+func (c *client) openConnection(ctx context.Context) (string, error) {
+	var result struct {
+		URL string `json:"url"`
+	}
+	err := c.call(ctx, c.appToken, "apps.connections.open", map[string]any{}, &result)
+	return result.URL, err
+}
+
+func truncate(text string) string {
+	if len(text) <= maxTextLength {
+		return text
+	}
+	return strings.ToValidUTF8(text[:maxTextLength], "") + "…"
+}
@@ -0,0 +1,113 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+)
+
+const (
+	maxBodySize = 1 << 20
+	// maxRequestAge rejects replayed requests.
+	maxRequestAge = 5 * time.Minute
+)
+
+// EventsHandler receives the events of the Events API.
+func (a *Adapter) EventsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, ok := a.verifiedBody(rw, req)
+		if !ok {
+			return
+		}
+
+		var callback eventCallback
+		if err := json.Unmarshal(body, &callback); err != nil {
+			http.Error(rw, "invalid event: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch callback.Type {
+		case "url_verification":
+			rw.Header().Set("Content-Type", "text/plain")
+			_, _ = rw.Write([]byte(callback.Challenge))
+			return
+		case "event_callback":
+			// Slack retries events that were not acknowledged in time, they were already handled.
+			if req.Header.Get("X-Slack-Retry-Num") == "" {
+				go a.handleEvent(callback.Event)
+			}
+		}
+		rw.WriteHeader(http.StatusOK)
+	})
+}
+
+// CommandsHandler receives slash commands.
+func (a *Adapter) CommandsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, ok := a.verifiedBody(rw, req)
+		if !ok {
+			return
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(rw, "invalid command: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		go a.handleCommand(slashCommand{
+			Command:   form.Get("command"),
+			Text:      form.Get("text"),
+			ChannelID: form.Get("channel_id"),
+			UserID:    form.Get("user_id"),
+		})
+		rw.WriteHeader(http.StatusOK)
+	})
+}
+
+// verifiedBody reads the body of the request and checks its signature with the signing secret.
+func (a *Adapter) verifiedBody(rw http.ResponseWriter, req *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBodySize))
+	if err != nil {
+		http.Error(rw, "failed to read body: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	timestamp := req.Header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(seconds, 0)).Abs() > maxRequestAge {
+		http.Error(rw, "invalid timestamp", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(req.Header.Get("X-Slack-Signature"), "v0="))
+	if err != nil || len(signature) == 0 {
+		http.Error(rw, "invalid signature", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if a.config.SigningSecret == "" {
+		http.Error(rw, "no signing secret configured", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	mac := hmac.New(sha256.New, []byte(a.config.SigningSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		log.Debugf(req.Context(), "rejected slack request with invalid signature")
+		http.Error(rw, "invalid signature", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return body, true
+}
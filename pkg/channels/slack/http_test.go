@@ -0,0 +1,119 @@
+package slack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func newTestAdapter(t *testing.T, slack types.SlackChannel, env map[string]string) (*Adapter, error) {
+	t.Helper()
+	return New(context.Background(), types.Config{
+		Channels: &types.Channels{
+			Slack: &slack,
+		},
+	}, env, nil, nil)
+}
+
+func TestNewChecksExpandedCredentials(t *testing.T) {
+	tests := []struct {
+		name  string
+		slack types.SlackChannel
+		env   map[string]string
+		err   string
+	}{
+		{
+			name:  "signing secret",
+			slack: types.SlackChannel{BotToken: "xoxb", SigningSecret: "${SLACK_SIGNING_SECRET}"},
+			env:   map[string]string{"SLACK_SIGNING_SECRET": "s3cret"},
+		},
+		{
+			name:  "app token",
+			slack: types.SlackChannel{BotToken: "xoxb", AppToken: "xapp"},
+		},
+		{
+			name:  "empty signing secret",
+			slack: types.SlackChannel{BotToken: "xoxb", SigningSecret: "${SLACK_SIGNING_SECRET}"},
+			env:   map[string]string{"SLACK_SIGNING_SECRET": ""},
+			err:   "signingSecret of channels slack is empty",
+		},
+		{
+			name:  "unset signing secret",
+			slack: types.SlackChannel{BotToken: "xoxb", SigningSecret: "${SLACK_SIGNING_SECRET}"},
+			err:   "failed to evaluate signingSecret of channels slack",
+		},
+		{
+			name:  "empty app token",
+			slack: types.SlackChannel{BotToken: "xoxb", AppToken: "${SLACK_APP_TOKEN}"},
+			env:   map[string]string{"SLACK_APP_TOKEN": " "},
+			err:   "appToken of channels slack is empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestAdapter(t, tt.slack, tt.env)
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			} else if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestEventsHandlerVerifiesSignatures(t *testing.T) {
+	a, err := newTestAdapter(t, types.SlackChannel{BotToken: "xoxb", SigningSecret: "s3cret"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"type": "url_verification", "challenge": "challenge1"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	sign := func(secret, timestamp string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + timestamp + ":" + body))
+		return "v0=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		status    int
+	}{
+		{name: "valid", timestamp: now, signature: sign("s3cret", now), status: http.StatusOK},
+		{name: "wrong secret", timestamp: now, signature: sign("other", now), status: http.StatusUnauthorized},
+		{name: "empty secret", timestamp: now, signature: sign("", now), status: http.StatusUnauthorized},
+		{name: "replayed", timestamp: old, signature: sign("s3cret", old), status: http.StatusUnauthorized},
+		{name: "missing signature", timestamp: now, status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, EventsPath, strings.NewReader(body))
+			req.Header.Set("X-Slack-Request-Timestamp", tt.timestamp)
+			if tt.signature != "" {
+				req.Header.Set("X-Slack-Signature", tt.signature)
+			}
+			rw := httptest.NewRecorder()
+			a.EventsHandler().ServeHTTP(rw, req)
+
+			if rw.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rw.Code, rw.Body.String())
+			}
+			if tt.status == http.StatusOK && rw.Body.String() != "challenge1" {
+				t.Errorf("expected challenge, got %q", rw.Body.String())
+			}
+		})
+	}
+}
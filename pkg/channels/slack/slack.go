@@ -0,0 +1,395 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/expr"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tools"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+const (
+	// EventsPath receives events of the Events API.
+	EventsPath = "/channels/slack/events"
+	// CommandsPath receives slash commands when Socket Mode is not used.
+	CommandsPath = "/channels/slack/commands"
+
+	// threadIdleTimeout is how long the session of a thread is kept without new messages.
+	threadIdleTimeout = 24 * time.Hour
+)
+
+var mentionRegexp = regexp.MustCompile(`<@[A-Z0-9]+>`)
+
+type Caller interface {
+	Call(ctx context.Context, server, tool string, args any, opts ...tools.CallOptions) (*types.CallResult, error)
+}
+
+// event is the inner event of an event_callback.
+type event struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype,omitempty"`
+	User        string `json:"user,omitempty"`
+	BotID       string `json:"bot_id,omitempty"`
+	Text        string `json:"text,omitempty"`
+	Channel     string `json:"channel,omitempty"`
+	ChannelType string `json:"channel_type,omitempty"`
+	TS          string `json:"ts,omitempty"`
+	ThreadTS    string `json:"thread_ts,omitempty"`
+}
+
+type eventCallback struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge,omitempty"`
+	Event     event  `json:"event"`
+}
+
+type slashCommand struct {
+	Command   string `json:"command"`
+	Text      string `json:"text"`
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+}
+
+type thread struct {
+	session  *mcp.Session
+	agent    string
+	lastUsed time.Time
+	// lock keeps messages of the same thread from running at the same time.
+	lock sync.Mutex
+}
+
+// Adapter relays messages between Slack and agents. Each Slack thread is a session with the agent that
+// started it.
+type Adapter struct {
+	ctx        context.Context
+	config     types.SlackChannel
+	agent      string
+	client     *client
+	caller     Caller
+	newSession func(context.Context) context.Context
+
+	botUserOnce sync.Once
+	botUser     string
+
+	threadsLock sync.Mutex
+	threads     map[string]*thread
+}
+
+// New returns an adapter for the Slack channel of the config. Threads run in sessions returned by
+// newSession for ctx, which should be canceled when the server stops.
+func New(ctx context.Context, config types.Config, env map[string]string, caller Caller, newSession func(context.Context) context.Context) (*Adapter, error) {
+	slackConfig := *config.Channels.Slack
+	// The credentials are checked after they are expanded, an empty or unresolved signing secret would
+	// otherwise be used as the key requests are verified with.
+	for field, value := range map[string]*string{
+		"botToken":      &slackConfig.BotToken,
+		"appToken":      &slackConfig.AppToken,
+		"signingSecret": &slackConfig.SigningSecret,
+	} {
+		if *value == "" {
+			continue
+		}
+		expanded, err := expr.EvalString(ctx, env, nil, *value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate %s of channels slack: %w", field, err)
+		}
+		if strings.TrimSpace(expanded) == "" {
+			return nil, fmt.Errorf("%s of channels slack is empty", field)
+		}
+		*value = expanded
+	}
+	if slackConfig.AppToken == "" && slackConfig.SigningSecret == "" {
+		return nil, fmt.Errorf("channels slack must have an appToken for Socket Mode or a signingSecret for the Events API")
+	}
+
+	return &Adapter{
+		ctx:        ctx,
+		config:     slackConfig,
+		agent:      slackConfig.GetAgent(config),
+		client:     newClient(slackConfig.BotToken, slackConfig.AppToken),
+		caller:     caller,
+		newSession: newSession,
+		threads:    map[string]*thread{},
+	}, nil
+}
+
+// SocketMode returns true if events are received over a WebSocket instead of HTTP.
+func (a *Adapter) SocketMode() bool {
+	return a.config.AppToken != ""
+}
+
+func (a *Adapter) botUserID() string {
+	a.botUserOnce.Do(func() {
+		userID, err := a.client.botUserID(a.ctx)
+		if err != nil {
+			log.Errorf(a.ctx, "failed to get the user of the slack bot: %v", err)
+		}
+		a.botUser = userID
+	})
+	return a.botUser
+}
+
+func (a *Adapter) handleEvent(e event) {
+	if e.BotID != "" || e.Subtype != "" || e.User == "" || e.User == a.botUserID() {
+		return
+	}
+
+	threadTS := e.ThreadTS
+	if threadTS == "" {
+		threadTS = e.TS
+	}
+
+	switch {
+	case e.Type == "app_mention":
+	case e.Type == "message" && e.ChannelType == "im":
+	case e.Type == "message" && e.ThreadTS != "" && a.hasThread(e.Channel, e.ThreadTS):
+		if strings.Contains(e.Text, "<@"+a.botUserID()+">") {
+			// Answered for the app_mention event of the same message
+			return
+		}
+	default:
+		return
+	}
+
+	prompt := strings.TrimSpace(mentionRegexp.ReplaceAllString(e.Text, ""))
+	if prompt == "" {
+		return
+	}
+	a.respond(e.Channel, threadTS, a.agent, prompt)
+}
+
+func (a *Adapter) handleCommand(cmd slashCommand) {
+	agent, ok := a.config.Commands[cmd.Command]
+	if !ok {
+		log.Errorf(a.ctx, "slack command %s is not configured", cmd.Command)
+		return
+	}
+
+	ts, err := a.client.postMessage(a.ctx, cmd.ChannelID, "", fmt.Sprintf("<@%s> %s %s", cmd.UserID, cmd.Command, cmd.Text))
+	if err != nil {
+		log.Errorf(a.ctx, "failed to start thread for slack command %s: %v", cmd.Command, err)
+		return
+	}
+	a.respond(cmd.ChannelID, ts, agent, cmd.Text)
+}
+
+func (a *Adapter) hasThread(channel, threadTS string) bool {
+	a.threadsLock.Lock()
+	defer a.threadsLock.Unlock()
+	_, ok := a.threads[channel+"/"+threadTS]
+	return ok
+}
+
+// thread returns the thread for the key, creating it with the agent if needed, and drops threads that
+// have been idle for too long.
+func (a *Adapter) thread(key, agent string) *thread {
+	a.threadsLock.Lock()
+	defer a.threadsLock.Unlock()
+
+	now := time.Now()
+	for k, t := range a.threads {
+		// Threads with a message running are in use even if they were not used recently.
+		if now.Sub(t.lastUsed) > threadIdleTimeout && t.lock.TryLock() {
+			t.session.Close(false)
+			delete(a.threads, k)
+			t.lock.Unlock()
+		}
+	}
+
+	t, ok := a.threads[key]
+	if !ok {
+		t = &thread{
+			session: mcp.SessionFromContext(a.newSession(a.ctx)),
+			agent:   agent,
+		}
+		a.threads[key] = t
+	}
+	t.lastUsed = now
+	return t
+}
+
+// respond runs the agent of the thread with the prompt and posts the tool calls and output to the thread.
+func (a *Adapter) respond(channel, threadTS, agent, prompt string) {
+	t := a.thread(channel+"/"+threadTS, agent)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var (
+		ctx           = mcp.WithSession(a.ctx, t.session)
+		progressToken = uuid.String()
+	)
+
+	var progress *toolCallPoster
+	if !a.config.HideToolCalls {
+		progress = newToolCallPoster(ctx, a.client, channel, threadTS, progressToken)
+		remove := t.session.AddFilter(progress.filter)
+		defer remove()
+	}
+
+	result, err := a.caller.Call(ctx, t.agent, t.agent, types.SampleCallRequest{
+		Prompt: prompt,
+	}, tools.CallOptions{
+		ProgressToken: progressToken,
+	})
+
+	if progress != nil {
+		// Post the remaining tool calls before the answer
+		progress.close()
+	}
+
+	var text string
+	switch {
+	case err != nil:
+		text = ":warning: " + err.Error()
+	case result.IsError:
+		text = ":warning: " + result.Text()
+	default:
+		text = result.Text()
+	}
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+
+	if _, err := a.client.postMessage(ctx, channel, threadTS, text); err != nil {
+		log.Errorf(ctx, "failed to post slack message: %v", err)
+	}
+}
+
+type toolCallUpdate struct {
+	callID string
+	name   string
+	done   bool
+	failed bool
+}
+
+// toolCallPoster posts a message to the thread for each tool call of the agent and marks it when the
+// call is done. Messages are posted from one goroutine so that they appear in order without blocking
+// the agent.
+type toolCallPoster struct {
+	ctx           context.Context
+	client        *client
+	channel       string
+	threadTS      string
+	progressToken string
+	updates       chan toolCallUpdate
+	done          chan struct{}
+
+	lock    sync.Mutex
+	closed  bool
+	started map[string]bool
+	ended   map[string]bool
+}
+
+func newToolCallPoster(ctx context.Context, client *client, channel, threadTS, progressToken string) *toolCallPoster {
+	p := &toolCallPoster{
+		ctx:           ctx,
+		client:        client,
+		channel:       channel,
+		threadTS:      threadTS,
+		progressToken: progressToken,
+		updates:       make(chan toolCallUpdate, 100),
+		done:          make(chan struct{}),
+		started:       map[string]bool{},
+		ended:         map[string]bool{},
+	}
+	go p.run()
+	return p
+}
+
+func (p *toolCallPoster) filter(_ context.Context, msg *mcp.Message) (*mcp.Message, error) {
+	if msg.Method != "notifications/progress" {
+		return msg, nil
+	}
+
+	var progress mcp.NotificationProgressRequest
+	if err := json.Unmarshal(msg.Params, &progress); err != nil || fmt.Sprint(progress.ProgressToken) != p.progressToken {
+		return msg, nil
+	}
+
+	var completion types.CompletionProgress
+	if err := mcp.JSONCoerce(progress.Meta[types.CompletionProgressMetaKey], &completion); err != nil {
+		return msg, nil
+	}
+
+	item := completion.Item
+	if item.ToolCall == nil || item.ToolCall.Name == "" || item.ToolCall.CallID == "" {
+		return msg, nil
+	}
+
+	update := toolCallUpdate{
+		callID: item.ToolCall.CallID,
+		name:   item.ToolCall.Name,
+	}
+	if item.ToolCallResult != nil && !item.Partial {
+		update.done = true
+		update.failed = item.ToolCallResult.Output.IsError
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	send := false
+	if update.done && !p.ended[update.callID] {
+		p.ended[update.callID] = true
+		send = true
+	} else if !update.done && !p.started[update.callID] {
+		p.started[update.callID] = true
+		send = true
+	}
+
+	if send && !p.closed {
+		select {
+		case p.updates <- update:
+		default:
+			// Drop updates rather than block the agent if Slack is slow
+		}
+	}
+	return msg, nil
+}
+
+func (p *toolCallPoster) run() {
+	defer close(p.done)
+
+	messages := map[string]string{}
+	for update := range p.updates {
+		text := fmt.Sprintf(":hammer_and_wrench: Calling `%s`…", update.name)
+		if update.done {
+			text = fmt.Sprintf(":white_check_mark: Called `%s`", update.name)
+			if update.failed {
+				text = fmt.Sprintf(":x: Calling `%s` failed", update.name)
+			}
+		}
+
+		if ts, ok := messages[update.callID]; ok {
+			if err := p.client.updateMessage(p.ctx, p.channel, ts, text); err != nil {
+				log.Errorf(p.ctx, "failed to update slack message: %v", err)
+			}
+			continue
+		}
+
+		ts, err := p.client.postMessage(p.ctx, p.channel, p.threadTS, text)
+		if err != nil {
+			log.Errorf(p.ctx, "failed to post slack message: %v", err)
+			continue
+		}
+		messages[update.callID] = ts
+	}
+}
+
+// close waits for the pending updates to be posted.
+func (p *toolCallPoster) close() {
+	p.lock.Lock()
+	p.closed = true
+	close(p.updates)
+	p.lock.Unlock()
+	<-p.done
+}
@@ -0,0 +1,98 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+)
+
+const socketReconnectDelay = 5 * time.Second
+
+type envelope struct {
+	EnvelopeID string          `json:"envelope_id,omitempty"`
+	Type       string          `json:"type"`
+	Reason     string          `json:"reason,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+// RunSocketMode receives events and slash commands over Socket Mode until ctx is done, reconnecting when
+// the connection is closed.
+func (a *Adapter) RunSocketMode(ctx context.Context) {
+	for {
+		if err := a.runSocket(ctx); err != nil {
+			log.Errorf(ctx, "slack socket mode connection failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(socketReconnectDelay):
+		}
+	}
+}
+
+func (a *Adapter) runSocket(ctx context.Context) error {
+	url, err := a.client.openConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            transport.Transport.Proxy,
+		TLSClientConfig:  transport.Transport.TLSClientConfig,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+	}
+	conn, _, err := dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	for {
+		var env envelope
+		if err := conn.ReadJSON(&env); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if env.EnvelopeID != "" {
+			// Acknowledge right away, Slack redelivers envelopes that are not acknowledged within seconds.
+			if err := conn.WriteJSON(map[string]string{"envelope_id": env.EnvelopeID}); err != nil {
+				return err
+			}
+		}
+
+		switch env.Type {
+		case "hello":
+			log.Infof(ctx, "connected to slack over socket mode")
+		case "disconnect":
+			log.Debugf(ctx, "slack requested to reconnect: %s", env.Reason)
+			return nil
+		case "events_api":
+			var callback eventCallback
+			if err := json.Unmarshal(env.Payload, &callback); err != nil {
+				log.Errorf(ctx, "failed to decode slack event: %v", err)
+				continue
+			}
+			go a.handleEvent(callback.Event)
+		case "slash_commands":
+			var cmd slashCommand
+			if err := json.Unmarshal(env.Payload, &cmd); err != nil {
+				log.Errorf(ctx, "failed to decode slack command: %v", err)
+				continue
+			}
+			go a.handleCommand(cmd)
+		}
+	}
+}
@@ -0,0 +1,511 @@
+package chatcompletions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+const (
+	// CompletionsPath receives the OpenAI Chat Completions requests.
+	CompletionsPath = "/v1/chat/completions"
+	// ModelsPath lists the agents as models.
+	ModelsPath = "/v1/models"
+
+	maxBodySize = 50 << 20
+)
+
+type Completer interface {
+	Complete(ctx context.Context, req types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error)
+	GetDynamicInstruction(ctx context.Context, instruction types.DynamicInstructions) (string, error)
+}
+
+// Handler serves the OpenAI Chat Completions API with the agents of the config as models. Requests are
+// stateless like in the OpenAI API, the messages of the request are the conversation and each request
+// runs in a new session.
+type Handler struct {
+	config     types.Config
+	completer  Completer
+	newSession func(context.Context) context.Context
+}
+
+// NewHandler returns the handler for the agents of the config. newSession returns a context with a new
+// session.
+func NewHandler(config types.Config, completer Completer, newSession func(context.Context) context.Context) *Handler {
+	return &Handler{
+		config:     config,
+		completer:  completer,
+		newSession: newSession,
+	}
+}
+
+// Register adds the paths of the API to the mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST "+CompletionsPath, h.complete)
+	mux.HandleFunc("GET "+ModelsPath, h.models)
+}
+
+func (h *Handler) models(rw http.ResponseWriter, req *http.Request) {
+	list := ModelList{
+		Object: "list",
+		Data:   []Model{},
+	}
+	for _, agent := range types.NanobotContext(req.Context()).AllowedEntrypoints(h.config) {
+		list.Data = append(list.Data, Model{
+			ID:      agent,
+			Object:  "model",
+			OwnedBy: "nanobot",
+		})
+	}
+	writeJSON(req.Context(), rw, http.StatusOK, list)
+}
+
+func (h *Handler) complete(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	var chatReq Request
+	if err := json.NewDecoder(io.LimitReader(req.Body, maxBodySize)).Decode(&chatReq); err != nil {
+		writeError(ctx, rw, http.StatusBadRequest, "invalid_request_error", "", "failed to decode request: "+err.Error())
+		return
+	}
+
+	agents := types.NanobotContext(ctx).AllowedEntrypoints(h.config)
+	agent := chatReq.Model
+	if !slices.Contains(agents, agent) {
+		// Clients that do not know the agents send the name of a model, they get the default agent.
+		if _, ok := h.config.Agents[agent]; ok || len(agents) == 0 {
+			writeError(ctx, rw, http.StatusNotFound, "invalid_request_error", "model_not_found",
+				fmt.Sprintf("the model %q does not exist", agent))
+			return
+		}
+		agent = agents[0]
+	}
+
+	ctx = h.newSession(ctx)
+	defer mcp.SessionFromContext(ctx).Close(false)
+
+	completion, err := h.toCompletionRequest(ctx, agent, chatReq)
+	if err != nil {
+		writeError(ctx, rw, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+		return
+	}
+
+	var (
+		id      = "chatcmpl-" + uuid.String()
+		created = time.Now().Unix()
+		opts    = types.CompletionOptions{
+			// The conversation is the messages of the request, not the previous runs of the session.
+			Chat: new(bool),
+		}
+		stream *chunkWriter
+	)
+
+	if chatReq.Stream {
+		stream = newChunkWriter(rw, id, agent, created)
+		opts.ProgressToken = id
+		remove := mcp.SessionFromContext(ctx).AddFilter(stream.filter(id))
+		defer remove()
+	}
+
+	resp, err := h.completer.Complete(ctx, completion, opts)
+	if err != nil {
+		log.Errorf(ctx, "chat completion with agent %s failed: %v", agent, err)
+		data := types.GetErrorData(err)
+		if stream != nil && stream.started() {
+			stream.writeError(data)
+			return
+		}
+		writeJSON(ctx, rw, data.StatusCode(), errorResponse{
+			Error: newAPIError(data),
+		})
+		return
+	}
+
+	usage := toUsage(resp.Usage)
+	if stream != nil {
+		stream.finish(outputText(resp.Output), usage, chatReq.StreamOptions != nil && chatReq.StreamOptions.IncludeUsage)
+		return
+	}
+
+	writeJSON(ctx, rw, http.StatusOK, Response{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   agent,
+		Choices: []Choice{
+			{
+				Message: &ResponseMessage{
+					Role:    "assistant",
+					Content: outputText(resp.Output),
+				},
+				FinishReason: &[]string{"stop"}[0],
+			},
+		},
+		Usage: usage,
+	})
+}
+
+func (h *Handler) toCompletionRequest(ctx context.Context, agent string, chatReq Request) (types.CompletionRequest, error) {
+	req := types.CompletionRequest{
+		Model:            agent,
+		Temperature:      chatReq.Temperature,
+		TopP:             chatReq.TopP,
+		MaxTokens:        chatReq.MaxCompletionTokens,
+		Stop:             chatReq.Stop,
+		FrequencyPenalty: chatReq.FrequencyPenalty,
+		PresencePenalty:  chatReq.PresencePenalty,
+		Seed:             chatReq.Seed,
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = chatReq.MaxTokens
+	}
+	if chatReq.ReasoningEffort != "" {
+		req.Reasoning = &types.AgentReasoning{
+			Effort: chatReq.ReasoningEffort,
+		}
+	}
+
+	var systemPrompt []string
+	for i, msg := range chatReq.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			systemPrompt = append(systemPrompt, text(msg.Content))
+		case "user", "assistant":
+			items, err := toItems(msg)
+			if err != nil {
+				return req, fmt.Errorf("invalid message %d: %w", i, err)
+			}
+			req.Input = append(req.Input, types.Message{
+				ID:    uuid.String(),
+				Role:  msg.Role,
+				Items: items,
+			})
+		case "tool":
+			req.Input = append(req.Input, types.Message{
+				ID:   uuid.String(),
+				Role: "user",
+				Items: []types.CompletionItem{
+					{
+						ToolCallResult: &types.ToolCallResult{
+							CallID: msg.ToolCallID,
+							Output: types.CallResult{
+								Content: []mcp.Content{
+									{
+										Type: "text",
+										Text: text(msg.Content),
+									},
+								},
+							},
+						},
+					},
+				},
+			})
+		default:
+			return req, fmt.Errorf("invalid message %d: unsupported role %q", i, msg.Role)
+		}
+	}
+
+	if len(req.Input) == 0 {
+		return req, fmt.Errorf("messages must have at least one user message")
+	}
+
+	if len(systemPrompt) > 0 {
+		// The system messages of the client add to the instructions of the agent instead of replacing them.
+		instructions, err := h.completer.GetDynamicInstruction(ctx, h.config.Agents[agent].Instructions)
+		if err != nil {
+			return req, fmt.Errorf("failed to get instructions of agent %s: %w", agent, err)
+		}
+		req.SystemPrompt = strings.TrimSpace(instructions + "\n\n" + strings.Join(systemPrompt, "\n\n"))
+	}
+
+	return req, nil
+}
+
+func toItems(msg Message) (items []types.CompletionItem, _ error) {
+	for _, part := range msg.Content {
+		content, err := toContent(part)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, types.CompletionItem{
+			ID:      uuid.String(),
+			Content: content,
+		})
+	}
+	for _, toolCall := range msg.ToolCalls {
+		items = append(items, types.CompletionItem{
+			ToolCall: &types.ToolCall{
+				CallID:    toolCall.ID,
+				Name:      toolCall.Function.Name,
+				Arguments: toolCall.Function.Arguments,
+			},
+		})
+	}
+	return items, nil
+}
+
+func toContent(part ContentPart) (*mcp.Content, error) {
+	switch part.Type {
+	case "text":
+		return &mcp.Content{
+			Type: "text",
+			Text: part.Text,
+		}, nil
+	case "image_url":
+		if part.ImageURL == nil {
+			return nil, fmt.Errorf("image_url part without image_url")
+		}
+		mimeType, data, ok := parseDataURL(part.ImageURL.URL)
+		if !ok {
+			return nil, fmt.Errorf("only base64 data URLs are supported for images")
+		}
+		return &mcp.Content{
+			Type:     "image",
+			MIMEType: mimeType,
+			Data:     data,
+		}, nil
+	case "input_audio":
+		if part.InputAudio == nil {
+			return nil, fmt.Errorf("input_audio part without input_audio")
+		}
+		return &mcp.Content{
+			Type:     "audio",
+			MIMEType: "audio/" + strings.ReplaceAll(part.InputAudio.Format, "mp3", "mpeg"),
+			Data:     part.InputAudio.Data,
+		}, nil
+	case "file":
+		if part.File == nil {
+			return nil, fmt.Errorf("file part without file")
+		}
+		mimeType, data, ok := parseDataURL(part.File.FileData)
+		if !ok {
+			return nil, fmt.Errorf("only base64 data URLs are supported for files")
+		}
+		return &mcp.Content{
+			Type: "resource",
+			Resource: &mcp.EmbeddedResource{
+				URI:      "file:///" + part.File.Filename,
+				MIMEType: mimeType,
+				Blob:     data,
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported content part type %q", part.Type)
+	}
+}
+
+// parseDataURL returns the mime type and the base64 data of the data URL.
+func parseDataURL(url string) (mimeType, data string, ok bool) {
+	header, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !ok || !strings.HasPrefix(url, "data:") {
+		return "", "", false
+	}
+	mimeType, ok = strings.CutSuffix(header, ";base64")
+	return mimeType, data, ok
+}
+
+func text(content Content) string {
+	var parts []string
+	for _, part := range content {
+		if part.Type == "text" {
+			parts = append(parts, part.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func outputText(msg types.Message) string {
+	var buf strings.Builder
+	for _, item := range msg.Items {
+		if item.Content != nil && item.Content.Type == "text" {
+			buf.WriteString(item.Content.Text)
+		}
+	}
+	return buf.String()
+}
+
+func toUsage(usage *types.Usage) *Usage {
+	if usage == nil {
+		return nil
+	}
+	return &Usage{
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      usage.TotalTokens(),
+	}
+}
+
+// chunkWriter writes the text of the agent as chat completion chunks while it runs.
+type chunkWriter struct {
+	rw      http.ResponseWriter
+	id      string
+	model   string
+	created int64
+
+	lock     sync.Mutex
+	wrote    bool
+	streamed bool
+}
+
+func newChunkWriter(rw http.ResponseWriter, id, model string, created int64) *chunkWriter {
+	return &chunkWriter{
+		rw:      rw,
+		id:      id,
+		model:   model,
+		created: created,
+	}
+}
+
+func (c *chunkWriter) started() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.wrote
+}
+
+// filter writes the text deltas of the completion progress with the token.
+func (c *chunkWriter) filter(progressToken string) mcp.MessageFilter {
+	return func(ctx context.Context, msg *mcp.Message) (*mcp.Message, error) {
+		if msg.Method != "notifications/progress" {
+			return msg, nil
+		}
+
+		var progress mcp.NotificationProgressRequest
+		if err := json.Unmarshal(msg.Params, &progress); err != nil || fmt.Sprint(progress.ProgressToken) != progressToken {
+			return msg, nil
+		}
+
+		var completion types.CompletionProgress
+		if err := mcp.JSONCoerce(progress.Meta[types.CompletionProgressMetaKey], &completion); err != nil {
+			return msg, nil
+		}
+
+		item := completion.Item
+		if item.Partial && item.Content != nil && item.Content.Type == "text" && item.Content.Text != "" {
+			c.lock.Lock()
+			c.streamed = true
+			c.lock.Unlock()
+			c.write(&ResponseMessage{
+				Content: item.Content.Text,
+			}, nil, nil)
+		}
+		return msg, nil
+	}
+}
+
+func (c *chunkWriter) write(delta *ResponseMessage, finishReason *string, usage *Usage) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.wrote {
+		c.rw.Header().Set("Content-Type", "text/event-stream")
+		c.rw.Header().Set("Cache-Control", "no-cache")
+		c.rw.WriteHeader(http.StatusOK)
+		c.wrote = true
+		// The first chunk has the role
+		if delta == nil {
+			delta = &ResponseMessage{}
+		}
+		delta.Role = "assistant"
+	}
+
+	chunk := Response{
+		ID:      c.id,
+		Object:  "chat.completion.chunk",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []Choice{},
+		Usage:   usage,
+	}
+	if delta != nil || finishReason != nil {
+		if delta == nil {
+			delta = &ResponseMessage{}
+		}
+		chunk.Choices = append(chunk.Choices, Choice{
+			Delta:        delta,
+			FinishReason: finishReason,
+		})
+	}
+
+	data, _ := json.Marshal(chunk)
+	_, _ = fmt.Fprintf(c.rw, "data: %s\n\n", data)
+	if flusher, ok := c.rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish writes the output if it was not streamed, which happens when the completion is cached, and ends
+// the stream.
+func (c *chunkWriter) finish(output string, usage *Usage, includeUsage bool) {
+	c.lock.Lock()
+	streamed := c.streamed
+	c.lock.Unlock()
+	if !streamed && output != "" {
+		c.write(&ResponseMessage{
+			Content: output,
+		}, nil, nil)
+	}
+	c.write(nil, &[]string{"stop"}[0], nil)
+	if includeUsage && usage != nil {
+		c.write(nil, nil, usage)
+	}
+	c.done()
+}
+
+// writeError ends a stream that already started, the status can not be changed anymore.
+func (c *chunkWriter) writeError(errData types.ErrorData) {
+	c.lock.Lock()
+	data, _ := json.Marshal(errorResponse{
+		Error: newAPIError(errData),
+	})
+	_, _ = fmt.Fprintf(c.rw, "data: %s\n\n", data)
+	c.lock.Unlock()
+	c.done()
+}
+
+func (c *chunkWriter) done() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, _ = fmt.Fprint(c.rw, "data: [DONE]\n\n")
+	if flusher, ok := c.rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func writeError(ctx context.Context, rw http.ResponseWriter, status int, errType, code, message string) {
+	writeJSON(ctx, rw, status, errorResponse{
+		Error: apiError{
+			Message: message,
+			Type:    errType,
+			Code:    code,
+		},
+	})
+}
+
+// newAPIError is the error of a failed completion, the type and code are the ones of the ErrorData.
+func newAPIError(data types.ErrorData) apiError {
+	return apiError{
+		Message:   data.Message,
+		Type:      data.Type,
+		Code:      data.Code,
+		Retryable: &data.Retryable,
+	}
+}
+
+func writeJSON(ctx context.Context, rw http.ResponseWriter, status int, obj any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(obj); err != nil {
+		log.Errorf(ctx, "failed to write chat completions response: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/analytics"
+	"github.com/nanobot-ai/nanobot/pkg/session"
+	"github.com/spf13/cobra"
+)
+
+type Analytics struct {
+	By      string `usage:"Break down the analytics by agent, model, or tag" default:"agent"`
+	Since   string `usage:"Only include turns and feedback since this UTC day (YYYY-MM-DD)"`
+	Agent   string `usage:"Only include turns and feedback of this agent"`
+	Model   string `usage:"Only include turns and feedback of this model"`
+	Account string `usage:"Only include sessions of this account"`
+	Output  string `usage:"Output format (json, yaml, table)" short:"o" default:"table"`
+	n       *Nanobot
+}
+
+func NewAnalytics(n *Nanobot) *Analytics {
+	return &Analytics{
+		n: n,
+	}
+}
+
+func (a *Analytics) Customize(cmd *cobra.Command) {
+	cmd.Use = "analytics [flags]"
+	cmd.Short = "Show the resolution rate, tool failure rate, and feedback of sessions."
+	cmd.Long = `Show the analytics of the turns and feedback of sessions. A session with feedback is resolved if its
+latest feedback is a thumbs up, the satisfaction is the share of the feedback that is a thumbs up.`
+	cmd.Example = `
+  # Show the analytics per agent
+  nanobot analytics
+
+  # Export the analytics per model since the start of the month as JSON
+  nanobot analytics --by model --since 2025-06-01 -o json
+`
+	cmd.Args = cobra.NoArgs
+}
+
+func (a *Analytics) Run(cmd *cobra.Command, _ []string) error {
+	var groupOf func(analytics.Report) []analytics.Group
+	switch a.By {
+	case "agent":
+		groupOf = func(r analytics.Report) []analytics.Group { return r.ByAgent }
+	case "model":
+		groupOf = func(r analytics.Report) []analytics.Group { return r.ByModel }
+	case "tag":
+		groupOf = func(r analytics.Report) []analytics.Group { return r.ByTag }
+	default:
+		return fmt.Errorf("invalid --by %q, must be agent, model, or tag", a.By)
+	}
+
+	store, err := session.NewStoreFromDSN(a.n.DSN())
+	if err != nil {
+		return err
+	}
+
+	logs, err := analytics.Load(cmd.Context(), store, a.Account)
+	if err != nil {
+		return err
+	}
+
+	report := analytics.NewReport(analytics.Filter{
+		Since: a.Since,
+		Agent: a.Agent,
+		Model: a.Model,
+	}, logs...)
+
+	if display(report, a.Output) {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "%s\tTURNS\tLATENCY\tTOOL CALLS\tTOOL FAILURES\tFEEDBACK\tUP\tDOWN\tSATISFACTION\n", map[string]string{
+		"agent": "AGENT",
+		"model": "MODEL",
+		"tag":   "TAG",
+	}[a.By])
+	for _, group := range groupOf(report) {
+		key := group.Key
+		if key == "" {
+			key = "-"
+		}
+		writeStats(tw, key, group.Stats)
+	}
+	writeStats(tw, "TOTAL", report.Total)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d sessions, %d with feedback, %d resolved (%.1f%%)\n", report.Sessions, report.RatedSessions,
+		report.ResolvedSessions, report.ResolutionRate*100)
+	return nil
+}
+
+func writeStats(tw *tabwriter.Writer, key string, stats analytics.Stats) {
+	_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%d (%.1f%%)\t%d\t%d\t%d\t%.1f%%\n", key, stats.Turns, latency(stats.LatencyMS), stats.ToolCalls,
+		stats.ToolErrors, stats.ToolFailureRate*100, stats.Feedback, stats.Up, stats.Down, stats.Satisfaction*100)
+}
+
+// latency returns the average duration of turns in milliseconds rounded to tenths of seconds.
+func latency(ms float64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/audit"
+	"github.com/nanobot-ai/nanobot/pkg/cmd"
+	"github.com/spf13/cobra"
+)
+
+type Audit struct {
+	Nanobot *Nanobot
+}
+
+func NewAudit(n *Nanobot) *cobra.Command {
+	a := &Audit{
+		Nanobot: n,
+	}
+	return cmd.Command(a,
+		&AuditExport{a: a},
+		&AuditVerify{a: a})
+}
+
+func (a *Audit) Customize(cmd *cobra.Command) {
+	cmd.Use = "audit [flags]"
+	cmd.Short = "Export and verify the audit log"
+	cmd.Long = `The audit log records the tool calls, approvals, model requests, and config changes of nanobot when
+it runs with --audit-log. Each event has the hash of the event before it, so removing or changing events
+is detected by verifying the log. The first and last event of the log are kept in its anchor file, next
+to the log with the .anchor suffix, so removing events from its start or end is detected too.`
+	cmd.Args = cobra.NoArgs
+}
+
+func (a *Audit) Run(cmd *cobra.Command, _ []string) error {
+	return cmd.Help()
+}
+
+// read reads and verifies the events of the file, or of the audit log of nanobot if file is empty. The
+// audit log, and files with an anchor, are verified with their anchor.
+func (a *Audit) read(file string) ([]audit.Event, error) {
+	if file == "" {
+		file = a.Nanobot.AuditLog
+	}
+	if file == "" {
+		return nil, fmt.Errorf("no audit log, set --audit-log or NANOBOT_AUDIT_LOG")
+	}
+	read := audit.ReadFile
+	if _, err := os.Stat(audit.AnchorPath(file)); err == nil || file == a.Nanobot.AuditLog {
+		read = audit.ReadLog
+	}
+	events, err := read(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify audit log %s: %w", file, err)
+	}
+	return events, nil
+}
+
+// parseTime parses a duration before now, a UTC day (YYYY-MM-DD), or an RFC 3339 time.
+func parseTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, must be a duration (24h), a day (YYYY-MM-DD), or an RFC 3339 time", value)
+}
+
+type AuditExport struct {
+	a     *Audit
+	Since string `usage:"Only export events since this time, a duration (24h), a UTC day (YYYY-MM-DD), or an RFC 3339 time"`
+	Until string `usage:"Only export events before this time, in the same formats as --since"`
+	File  string `usage:"File to write the events to (default: stdout)" short:"f"`
+}
+
+func (e *AuditExport) Customize(cmd *cobra.Command) {
+	cmd.Use = "export [flags]"
+	cmd.Short = "Export the events of the audit log as JSONL"
+	cmd.Long = `Export verifies the audit log and writes its events as JSONL. The exported events are consecutive, so
+the export itself can be verified with nanobot audit verify.`
+	cmd.Args = cobra.NoArgs
+	cmd.Example = `
+  # Export the events of the last week
+  nanobot audit export --audit-log ./audit.jsonl --since 168h -f audit-week.jsonl
+`
+}
+
+func (e *AuditExport) Run(cmd *cobra.Command, _ []string) error {
+	var since, until time.Time
+	if e.Since != "" {
+		var err error
+		if since, err = parseTime(e.Since); err != nil {
+			return err
+		}
+	}
+	if e.Until != "" {
+		var err error
+		if until, err = parseTime(e.Until); err != nil {
+			return err
+		}
+	}
+
+	events, err := e.a.read("")
+	if err != nil {
+		return err
+	}
+
+	var selected []audit.Event
+	for _, event := range events {
+		if event.Time.Before(since) || !until.IsZero() && !event.Time.Before(until) {
+			continue
+		}
+		selected = append(selected, event)
+	}
+
+	if e.File == "" || e.File == "-" {
+		return audit.Write(os.Stdout, selected)
+	}
+
+	out, err := os.OpenFile(e.File, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", e.File, err)
+	}
+	defer out.Close()
+
+	if err := audit.Write(out, selected); err != nil {
+		return fmt.Errorf("failed to write %s: %w", e.File, err)
+	}
+	return out.Close()
+}
+
+type AuditVerify struct {
+	a    *Audit
+	Hash string `usage:"Also fail if the events do not include the event with this hash, like the last hash printed by an earlier verify"`
+}
+
+func (v *AuditVerify) Customize(cmd *cobra.Command) {
+	cmd.Use = "verify [flags] [FILE]"
+	cmd.Short = "Verify the hash chain of the audit log or of an export"
+	cmd.Long = `Verify checks the hash chain of the events. The audit log is also checked against its anchor. Record
+the last hash outside of the host and pass it to --hash later to detect a log that was truncated along
+with its anchor.`
+	cmd.Args = cobra.MaximumNArgs(1)
+}
+
+func (v *AuditVerify) Run(cmd *cobra.Command, args []string) error {
+	var file string
+	if len(args) > 0 {
+		file = args[0]
+	}
+
+	events, err := v.a.read(file)
+	if err != nil {
+		return err
+	}
+	if v.Hash != "" && !audit.Contains(events, v.Hash) {
+		return fmt.Errorf("the events do not include the event with hash %s", v.Hash)
+	}
+	if len(events) == 0 {
+		fmt.Println("No events")
+		return nil
+	}
+
+	first, last := events[0], events[len(events)-1]
+	fmt.Printf("Verified %d events (%d to %d) from %s to %s\n", len(events), first.Seq, last.Seq,
+		first.Time.Format(time.RFC3339), last.Time.Format(time.RFC3339))
+	fmt.Printf("Last hash: %s\n", last.Hash)
+	return nil
+}
@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nanobot-ai/nanobot/pkg/batch"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+type Batch struct {
+	Input       string `usage:"JSONL file of records to run, - reads stdin" short:"i"`
+	Output      string `usage:"JSONL file to write the results to, defaults to stdout" short:"o"`
+	Agent       string `usage:"Agent to run the records against, defaults to the only agent of the config" short:"a"`
+	Concurrency int    `usage:"Number of records to run at the same time" default:"4" short:"c"`
+	Retries     int    `usage:"Number of times a record is retried after a rate limit or a transient error" default:"3"`
+	Resume      bool   `usage:"Skip the records that succeeded in the output file of a previous run and append to it"`
+	n           *Nanobot
+}
+
+func NewBatch(n *Nanobot) *Batch {
+	return &Batch{
+		n: n,
+	}
+}
+
+func (b *Batch) Customize(cmd *cobra.Command) {
+	cmd.Use = "batch [flags] NANOBOT_CONFIG"
+	cmd.Short = "Run each record of a JSONL file through an agent and write the results as JSONL."
+	cmd.Long = `Run each record of a JSONL file through an agent, each in its own temporary session, and write one
+JSON result per record with its status, output, tool calls, and usage.
+
+A record is a JSON string with the prompt, or an object with "prompt" and optionally "id" and "agent".
+When the agent is rate limited all records pause and the record is retried. If a run is interrupted
+rerun it with --resume to skip the records that already succeeded.`
+	cmd.Example = `
+  # Run prompts.jsonl against the agent of nanobot.yaml in the current directory, 8 records at a time
+  nanobot batch --input prompts.jsonl --output results.jsonl --concurrency 8 .
+
+  # Continue an interrupted run
+  nanobot batch --input prompts.jsonl --output results.jsonl --resume .
+
+  # An input file
+  {"id": "berlin", "prompt": "What is the weather in Berlin?"}
+  {"id": "paris", "prompt": "What is the weather in Paris?", "agent": "weather"}
+  "What is the weather in Rome?"
+`
+	cmd.Args = cobra.ExactArgs(1)
+}
+
+func (b *Batch) Run(cmd *cobra.Command, args []string) error {
+	log.EnableMessages = false
+
+	if b.Input == "" {
+		return fmt.Errorf("--input is required")
+	}
+	if b.Resume && b.Output == "" {
+		return fmt.Errorf("--resume requires --output")
+	}
+
+	records, err := readBatchInput(b.Input)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := b.n.ReadConfig(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+	if err := b.n.setupLogging(cfg.Logging); err != nil {
+		return err
+	}
+
+	agent := b.Agent
+	if agent == "" && len(cfg.Agents) == 1 {
+		for name := range cfg.Agents {
+			agent = name
+		}
+	}
+	for _, record := range records {
+		name := record.Agent
+		if name == "" {
+			name = agent
+		}
+		if name == "" {
+			return fmt.Errorf("record %s has no agent, set --agent", record.ID)
+		}
+		if _, ok := cfg.Agents[name]; !ok {
+			return fmt.Errorf("agent %q of record %s is not in the config", name, record.ID)
+		}
+	}
+
+	out := io.Writer(os.Stdout)
+	if b.Output != "" {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_EXCL
+		if b.Resume {
+			completed, err := batch.Completed(b.Output)
+			if err != nil {
+				return err
+			}
+			var remaining []batch.Record
+			for _, record := range records {
+				if !completed[record.ID] {
+					remaining = append(remaining, record)
+				}
+			}
+			fmt.Fprintf(os.Stderr, "skipping %d records that already succeeded\n", len(records)-len(remaining))
+			records = remaining
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+
+		f, err := os.OpenFile(b.Output, flags, 0o644)
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists, use --resume to continue the run that wrote it", b.Output)
+		} else if err != nil {
+			return fmt.Errorf("failed to open %s: %w", b.Output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	oauthOpts, err := localOAuth(cmd.Context())
+	if err != nil {
+		return err
+	}
+	rt, err := b.n.GetRuntime(runtime.Options{
+		MaxConcurrency: b.n.MaxConcurrency,
+		DSN:            b.n.DSN(),
+	}, oauthOpts)
+	if err != nil {
+		return err
+	}
+
+	env, err := b.n.loadEnv()
+	if err != nil {
+		return err
+	}
+
+	// Results are written one at a time, so the counts need no lock
+	var ok, failed int
+	err = batch.Run(cmd.Context(), rt, records, func(ctx context.Context) context.Context {
+		return runtime.WithTempSession(ctx, cfg, env)
+	}, func(result batch.Result) error {
+		if result.Status == batch.StatusOK {
+			ok++
+		} else {
+			failed++
+		}
+		// Each result is written with a single write, so a crash leaves at most a partial last line
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write result of record %s: %w", result.ID, err)
+		}
+		return nil
+	}, batch.Options{
+		Agent:       agent,
+		Concurrency: b.Concurrency,
+		Retries:     b.Retries,
+	})
+
+	fmt.Fprintf(os.Stderr, "%d succeeded, %d failed, %d not run\n", ok, failed, len(records)-ok-failed)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d records failed", failed)
+	}
+	return nil
+}
+
+func readBatchInput(file string) ([]batch.Record, error) {
+	if file == "-" {
+		return batch.Read(os.Stdin)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	records, err := batch.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return records, nil
+}
@@ -1,19 +1,43 @@
 package cli
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/nanobot-ai/nanobot/pkg/chat"
+	"github.com/nanobot-ai/nanobot/pkg/elicit"
+	"github.com/nanobot-ai/nanobot/pkg/eval"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
 	"github.com/nanobot-ai/nanobot/pkg/runtime"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/usage"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 type Call struct {
-	File   string `usage:"File to read input from" default:"" short:"f"`
-	Output string `usage:"Output format (json, pretty)" default:"pretty" short:"o"`
+	File   string `usage:"File to read input from, - reads stdin" short:"f"`
+	Input  string `usage:"File to read the input from, - reads stdin, same as --file"`
+	Format string `usage:"Output format (json, yaml, pretty). json and yaml print the output, tool calls, usage, and error of the call" default:"pretty" short:"o"`
+	Output string `usage:"Deprecated, use --format" hidden:"true"`
+	DryRun bool   `usage:"Return the tool calls the agent plans to make instead of running them"`
 	n      *Nanobot
 }
 
+// CallResult is the result of nanobot call printed with --format json or yaml.
+type CallResult struct {
+	Target    string           `json:"target"`
+	Output    string           `json:"output"`
+	IsError   bool             `json:"isError,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	ErrorData *types.ErrorData `json:"errorData,omitempty"`
+	ToolCalls []types.ToolCall `json:"toolCalls,omitempty"`
+	Usage     *usage.Totals    `json:"usage,omitempty"`
+	Content   []mcp.Content    `json:"content,omitempty"`
+}
+
 func NewCall(n *Nanobot) *Call {
 	return &Call{
 		n: n,
@@ -21,9 +45,16 @@ func NewCall(n *Nanobot) *Call {
 }
 
 func (e *Call) Customize(cmd *cobra.Command) {
-	cmd.Hidden = true
-	cmd.Use = "call [flags] NANOBOT_CONFIG TARGET_NAME [INPUT...]"
+	cmd.Use = "call [flags] [NANOBOT_CONFIG] TARGET_NAME [INPUT...]"
 	cmd.Short = "Call a single tool, agent, or flow in the nanobot. Use \"nanobot targets\" to list available targets."
+	cmd.Long = `Call a single tool, agent, or flow in the nanobot in a temporary session and print the result.
+
+If only TARGET_NAME is given the config in the current directory is used and the input is read from --file.
+The command exits non-zero if the call fails or the result is an error, with --format json the result is
+still printed so it can be inspected in shell pipelines and CI.
+
+Elicitations of MCP servers and tool confirmations are asked on the terminal. Without a terminal they are
+answered from the elicitation section of the config, or declined.`
 	cmd.Example = `
   # Run a tool, passing in a JSON object as input. Tools expect a JSON object as input.
   nanobot call . server1/tool1 '{"arg1": "value1", "arg2": "value2"}'
@@ -33,20 +64,56 @@ func (e *Call) Customize(cmd *cobra.Command) {
 
   # Run an agent, passing in a string as input. If the input is JSON it will be based as is.
   nanobot call . agent1 "What is the weather like today?"
+
+  # Run an agent with the prompt from stdin and print the output, tool calls, and usage as JSON.
+  echo "Summarize the README" | nanobot call --file - --format json agent1
 `
-	cmd.Args = cobra.MinimumNArgs(2)
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 && e.inputFile() == "" {
+			return fmt.Errorf("either pass NANOBOT_CONFIG and TARGET_NAME or set --file")
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	}
 	cmd.Flags().SetInterspersed(false)
 }
 
 func (e *Call) Run(cmd *cobra.Command, args []string) error {
-	cfg, err := e.n.ReadConfig(cmd.Context(), args[0])
+	cfgPath, target, input := ".", args[0], []string(nil)
+	if len(args) > 1 {
+		cfgPath, target, input = args[0], args[1], args[2:]
+	}
+
+	if inputFile := e.inputFile(); inputFile != "" {
+		if len(input) > 0 {
+			return fmt.Errorf("input can not be passed as arguments and with --file")
+		}
+		data, err := readInput(inputFile)
+		if err != nil {
+			return err
+		}
+		input = []string{strings.TrimSpace(string(data))}
+	}
+
+	format := e.Format
+	if e.Output != "" {
+		format = e.Output
+	}
+
+	cfg, err := e.n.ReadConfig(cmd.Context(), cfgPath)
+	if err != nil {
+		return err
+	}
+	if err := e.n.setupLogging(cfg.Logging); err != nil {
+		return err
+	}
+	oauthOpts, err := localOAuth(cmd.Context())
 	if err != nil {
 		return err
 	}
 	rt, err := e.n.GetRuntime(runtime.Options{
 		MaxConcurrency: e.n.MaxConcurrency,
 		DSN:            e.n.DSN(),
-	})
+	}, oauthOpts)
 	if err != nil {
 		return err
 	}
@@ -56,16 +123,81 @@ func (e *Call) Run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	ctx := withTempSession(cmd.Context(), cfg, env)
+	ctx := runtime.WithTempSession(cmd.Context(), cfg, env)
+	if e.inputFile() != "-" && term.IsTerminal(int(os.Stdin.Fd())) {
+		mcp.SessionFromContext(ctx).SetElicitHandler(elicit.Terminal(os.Stdin, os.Stderr))
+	}
+	if e.DryRun {
+		nctx := types.NanobotContext(ctx)
+		nctx.DryRun = true
+		ctx = types.WithNanobotContext(ctx, nctx)
+	}
 
-	result, err := rt.CallFromCLI(ctx, args[1], args[2:]...)
-	if err != nil {
+	result, err := rt.CallFromCLI(ctx, target, input...)
+	if format == "json" || format == "yaml" {
+		callResult := newCallResult(mcp.SessionFromContext(ctx), target, result, err)
+		display(callResult, format)
+		if callResult.Error != "" {
+			return fmt.Errorf("failed to call %s: %s", target, callResult.Error)
+		} else if callResult.IsError {
+			return fmt.Errorf("%s returned an error", target)
+		}
+		return nil
+	} else if err != nil {
 		return err
 	}
 
-	if display(result, e.Output) {
-		return nil
+	if err := chat.PrintResult(os.Stdout, result); err != nil {
+		return err
+	}
+	if result.IsError {
+		return fmt.Errorf("%s returned an error", target)
+	}
+	return nil
+}
+
+func (e *Call) inputFile() string {
+	if e.File != "" {
+		return e.File
+	}
+	return e.Input
+}
+
+func readInput(file string) ([]byte, error) {
+	if file == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input from stdin: %w", err)
+		}
+		return data, nil
 	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input from %s: %w", file, err)
+	}
+	return data, nil
+}
 
-	return chat.PrintResult(os.Stdout, result)
+func newCallResult(session *mcp.Session, target string, result *mcp.CallToolResult, err error) CallResult {
+	callResult := CallResult{
+		Target:    target,
+		ToolCalls: eval.ToolCalls(session),
+		Usage:     usage.SessionTotals(session),
+	}
+	if err != nil {
+		data := types.GetErrorData(err)
+		callResult.Error = err.Error()
+		callResult.ErrorData = &data
+	}
+	if result != nil {
+		callResult.IsError = result.IsError
+		for _, content := range result.Content {
+			if content.Type == "text" {
+				callResult.Output += content.Text
+			} else {
+				callResult.Content = append(callResult.Content, content)
+			}
+		}
+	}
+	return callResult
 }
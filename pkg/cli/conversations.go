@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/cmd"
+	"github.com/nanobot-ai/nanobot/pkg/session"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+type Conversations struct {
+	Nanobot *Nanobot
+	Account string `usage:"Only include conversations of this account"`
+	Output  string `usage:"Output format (json, yaml, table)" short:"o" default:"table"`
+}
+
+func NewConversations(n *Nanobot) *cobra.Command {
+	c := &Conversations{
+		Nanobot: n,
+	}
+	return cmd.Command(c,
+		&ConversationsList{c: c},
+		&ConversationsResume{c: c},
+		&ConversationsDelete{c: c})
+}
+
+func (c *Conversations) Customize(cmd *cobra.Command) {
+	cmd.Use = "conversations [flags]"
+	cmd.Short = "List, resume, and delete conversations started with a conversation ID"
+	cmd.Long = `Clients start a conversation by sending the X-Nanobot-Conversation-Id header with an ID of their
+choosing. Later requests with the same header resume the session of the conversation.`
+	cmd.Aliases = []string{"conversation", "conv"}
+	cmd.Args = cobra.NoArgs
+}
+
+func (c *Conversations) Run(cmd *cobra.Command, _ []string) error {
+	return c.list(cmd.Context())
+}
+
+// find returns the session of the conversation, which must be unique across the accounts that are included.
+func (c *Conversations) find(ctx context.Context, store *session.Store, id string) (*session.Session, error) {
+	sessions, err := store.FindConversations(ctx, c.Account)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []session.Session
+	for _, s := range sessions {
+		if s.ConversationID == id {
+			found = append(found, s)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("conversation %s not found", id)
+	case 1:
+		return &found[0], nil
+	default:
+		return nil, fmt.Errorf("conversation %s exists in %d sessions, use --account to select one", id, len(found))
+	}
+}
+
+func (c *Conversations) list(ctx context.Context) error {
+	store, err := session.NewStoreFromDSN(c.Nanobot.DSN())
+	if err != nil {
+		return err
+	}
+
+	sessions, err := store.FindConversations(ctx, c.Account)
+	if err != nil {
+		return err
+	}
+
+	conversations := make([]types.Conversation, 0, len(sessions))
+	for _, s := range sessions {
+		conversations = append(conversations, s.Conversation())
+	}
+	if display(conversations, c.Output) {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, err = tw.Write([]byte("ID\tSESSION\tUPDATED\tACCT\tAGENT\tTITLE\n"))
+	if err != nil {
+		return err
+	}
+
+	for i, conversation := range conversations {
+		_, _ = tw.Write([]byte(trim(conversation.ID) + "\t" + conversation.SessionID +
+			"\t" + conversation.Updated.Format(time.RFC3339) +
+			"\t" + trim(sessions[i].AccountID) +
+			"\t" + conversation.Agent +
+			"\t" + trim(conversation.Title) + "\n"))
+	}
+
+	return tw.Flush()
+}
+
+type ConversationsList struct {
+	c *Conversations
+}
+
+func (l *ConversationsList) Customize(cmd *cobra.Command) {
+	cmd.Use = "list [flags]"
+	cmd.Short = "List all conversations"
+	cmd.Aliases = []string{"ls"}
+	cmd.Args = cobra.NoArgs
+}
+
+func (l *ConversationsList) Run(cmd *cobra.Command, _ []string) error {
+	return l.c.list(cmd.Context())
+}
+
+type ConversationsResume struct {
+	c *Conversations
+}
+
+func (r *ConversationsResume) Customize(cmd *cobra.Command) {
+	cmd.Use = "resume [flags] CONVERSATION_ID"
+	cmd.Short = "Show the session, transcript, and pending approvals needed to resume a conversation"
+	cmd.Args = cobra.ExactArgs(1)
+	cmd.Example = `
+  # Show the transcript of a conversation as JSON
+  nanobot conversations resume my-conversation -o json
+`
+}
+
+func (r *ConversationsResume) Run(cmd *cobra.Command, args []string) error {
+	store, err := session.NewStoreFromDSN(r.c.Nanobot.DSN())
+	if err != nil {
+		return err
+	}
+
+	stored, err := r.c.find(cmd.Context(), store, args[0])
+	if err != nil {
+		return err
+	}
+
+	resumed, err := stored.Resume()
+	if err != nil {
+		return err
+	}
+
+	if !display(resumed, r.c.Output) {
+		// There is no meaningful table for a transcript, so default to yaml.
+		display(resumed, "yaml")
+	}
+	return nil
+}
+
+type ConversationsDelete struct {
+	c *Conversations
+}
+
+func (d *ConversationsDelete) Customize(cmd *cobra.Command) {
+	cmd.Use = "delete [flags] CONVERSATION_ID..."
+	cmd.Short = "Delete one or more conversations and their sessions"
+	cmd.Aliases = []string{"rm"}
+	cmd.Args = cobra.MinimumNArgs(1)
+}
+
+func (d *ConversationsDelete) Run(cmd *cobra.Command, args []string) error {
+	store, err := session.NewStoreFromDSN(d.c.Nanobot.DSN())
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range args {
+		stored, err := d.c.find(cmd.Context(), store, arg)
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(cmd.Context(), stored.SessionID); err != nil {
+			return fmt.Errorf("failed to delete conversation %s: %w", arg, err)
+		}
+		fmt.Println(arg)
+	}
+
+	return nil
+}
@@ -0,0 +1,355 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/llm"
+	"github.com/nanobot-ai/nanobot/pkg/llm/azure"
+	"github.com/nanobot-ai/nanobot/pkg/llm/bedrock"
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/runtime"
+	"github.com/nanobot-ai/nanobot/pkg/tools"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+type Doctor struct {
+	n             *Nanobot
+	ListenAddress string `usage:"Address the server will listen on, checked to be free" default:"localhost:8080" short:"a"`
+	Timeout       string `usage:"How long each MCP server has to start and list its tools" default:"30s"`
+	Output        string `usage:"Output format (json, yaml, table)" short:"o" default:"table"`
+}
+
+func NewDoctor(n *Nanobot) *Doctor {
+	return &Doctor{
+		n: n,
+	}
+}
+
+func (d *Doctor) Customize(cmd *cobra.Command) {
+	cmd.Use = "doctor [flags] [NANOBOT]"
+	cmd.Short = "Check the config, MCP servers, LLM provider keys, and listen address of a nanobot."
+	cmd.Args = cobra.MaximumNArgs(1)
+	cmd.Example = `
+  # Check nanobot.yaml in the current directory
+  nanobot doctor
+
+  # Check a nanobot that will listen on port 9090
+  nanobot doctor -a localhost:9090 ./my-bot
+`
+}
+
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+type doctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+func (d *Doctor) Run(cmd *cobra.Command, args []string) error {
+	log.EnableMessages = false
+
+	timeout, err := time.ParseDuration(d.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %q: %w", d.Timeout, err)
+	}
+
+	path := "."
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	var checks []doctorCheck
+	c, err := d.n.ReadConfig(cmd.Context(), path)
+	if err != nil {
+		checks = append(checks, doctorCheck{
+			Name:    "config",
+			Status:  checkFail,
+			Message: err.Error(),
+			Fix:     fmt.Sprintf("Fix the error in the config at %s and run nanobot doctor again", path),
+		})
+	} else {
+		checks = append(checks, doctorCheck{
+			Name:    "config",
+			Status:  checkOK,
+			Message: fmt.Sprintf("loaded %d agents and %d MCP servers", len(c.Agents), len(c.MCPServers)),
+		})
+		checks = append(checks, d.checkServers(cmd.Context(), c, timeout)...)
+		checks = append(checks, d.checkProviders(cmd.Context(), *c)...)
+	}
+	checks = append(checks, d.checkListenAddress())
+
+	var failed int
+	for _, check := range checks {
+		if check.Status == checkFail {
+			failed++
+		}
+	}
+
+	if !display(checks, d.Output) {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = tw.Write([]byte("STATUS\tCHECK\tMESSAGE\n"))
+		for _, check := range checks {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.ToUpper(check.Status), check.Name, check.Message)
+			if check.Fix != "" {
+				_, _ = fmt.Fprintf(tw, "\t\tfix: %s\n", check.Fix)
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// checkServers starts each MCP server and lists its tools, which runs initialize and tools/list.
+func (d *Doctor) checkServers(ctx context.Context, c *types.Config, timeout time.Duration) (result []doctorCheck) {
+	if len(c.MCPServers) == 0 {
+		return nil
+	}
+
+	oauthOpts, err := localOAuth(ctx)
+	if err != nil {
+		return []doctorCheck{{
+			Name:    "mcp-servers",
+			Status:  checkFail,
+			Message: err.Error(),
+		}}
+	}
+	r, err := d.n.GetRuntime(runtime.Options{
+		DSN: d.n.DSN(),
+	}, oauthOpts)
+	if err != nil {
+		return []doctorCheck{{
+			Name:    "mcp-servers",
+			Status:  checkFail,
+			Message: err.Error(),
+			Fix:     "Check the --state database is writable",
+		}}
+	}
+
+	env, err := d.n.loadEnv()
+	if err != nil {
+		return []doctorCheck{{
+			Name:    "mcp-servers",
+			Status:  checkFail,
+			Message: fmt.Sprintf("failed to load environment: %v", err),
+			Fix:     fmt.Sprintf("Fix or remove the environment file %s", d.n.EnvFile),
+		}}
+	}
+	ctx = runtime.WithTempSession(ctx, c, env)
+
+	for _, name := range slices.Sorted(maps.Keys(c.MCPServers)) {
+		check := doctorCheck{
+			Name: "mcp-server/" + name,
+		}
+
+		serverCtx, cancel := context.WithTimeout(ctx, timeout)
+		list, err := r.ListTools(serverCtx, tools.ListToolsOptions{
+			Servers: []string{name},
+		})
+		cancel()
+		if err != nil {
+			check.Status = checkFail
+			check.Message = err.Error()
+			check.Fix = serverFix(name, c.MCPServers[name], err, timeout)
+		} else {
+			var count int
+			for _, server := range list {
+				count += len(server.Tools)
+			}
+			check.Status = checkOK
+			check.Message = fmt.Sprintf("started and listed %d tools", count)
+			if count == 0 {
+				check.Status = checkWarn
+				check.Message = "started but has no tools"
+			}
+		}
+		result = append(result, check)
+	}
+	return result
+}
+
+func serverFix(name string, server mcp.Server, err error, timeout time.Duration) string {
+	var authErr mcp.AuthRequiredErr
+	switch {
+	case errors.Is(err, exec.ErrNotFound) || server.Command != "" && !onPath(server.Command):
+		return fmt.Sprintf("Install %s or change the command of %s", server.Command, name)
+	case errors.Is(err, context.DeadlineExceeded):
+		if server.Command != "" {
+			return fmt.Sprintf("%s did not respond within %s, run %q by hand to see its output or raise --timeout", name, timeout, strings.Join(append([]string{server.Command}, server.Args...), " "))
+		}
+		return fmt.Sprintf("%s did not respond within %s, check %s is up or raise --timeout", name, timeout, server.BaseURL)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Sprintf("Start the server at %s or fix the url of %s", server.BaseURL, name)
+	case errors.As(err, &authErr):
+		return fmt.Sprintf("Log in to %s or set the headers it needs to authorize requests", name)
+	case server.Command != "":
+		return fmt.Sprintf("Run %q by hand to see why it fails", strings.Join(append([]string{server.Command}, server.Args...), " "))
+	default:
+		return fmt.Sprintf("Check the url and headers of %s", name)
+	}
+}
+
+func onPath(command string) bool {
+	_, err := exec.LookPath(command)
+	return err == nil
+}
+
+// checkProviders verifies the API keys of the providers of the models the agents use, with a request
+// that lists models and costs nothing.
+func (d *Doctor) checkProviders(ctx context.Context, c types.Config) (result []doctorCheck) {
+	models := map[string][]string{}
+	for _, name := range slices.Sorted(maps.Keys(c.Agents)) {
+		agentProvider := c.Agents[name].Provider
+		agentModels := c.Agents[name].Model
+		if len(agentModels) == 0 {
+			agentModels = []string{d.n.DefaultModel}
+		}
+		for _, model := range agentModels {
+			if model == "default" {
+				model = d.n.DefaultModel
+			}
+			model = c.ResolveModel(model)
+			provider := llm.Provider(model)
+			if agentProvider != "" {
+				provider = agentProvider
+			}
+			if !slices.Contains(models[provider], model) {
+				models[provider] = append(models[provider], model)
+			}
+		}
+	}
+
+	env, _ := d.n.loadEnv()
+	ctx = runtime.WithTempSession(ctx, &c, env)
+
+	client := llm.NewClient(d.n.llmConfig())
+	for _, provider := range slices.Sorted(maps.Keys(models)) {
+		check := doctorCheck{
+			Name: "provider/" + provider,
+		}
+		used := strings.Join(models[provider], ", ")
+
+		if fix := d.missingKey(c, provider); fix != "" {
+			check.Status = checkFail
+			check.Message = fmt.Sprintf("no API key for %s", used)
+			check.Fix = fix
+			result = append(result, check)
+			continue
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		err := client.Check(checkCtx, provider)
+		cancel()
+
+		var statusErr *retry.StatusError
+		switch {
+		case err == nil:
+			check.Status = checkOK
+			check.Message = "reachable, used for " + used
+		case errors.As(err, &statusErr) && (statusErr.StatusCode == 401 || statusErr.StatusCode == 403):
+			check.Status = checkFail
+			check.Message = err.Error()
+			check.Fix = fmt.Sprintf("The API key is invalid or has no access, %s", d.keyFix(c, provider))
+		case provider == "ollama":
+			check.Status = checkFail
+			check.Message = err.Error()
+			check.Fix = fmt.Sprintf("Start Ollama (ollama serve) or point --ollama-base-url at it, it is %s now", d.n.OllamaBaseURL)
+		default:
+			check.Status = checkFail
+			check.Message = err.Error()
+			check.Fix = fmt.Sprintf("Check the network and the base URL of the %s API", provider)
+		}
+		result = append(result, check)
+	}
+	return result
+}
+
+// missingKey returns how to configure the API key of the provider if there is none.
+func (d *Doctor) missingKey(c types.Config, provider string) string {
+	if p, ok := c.Providers[provider]; ok {
+		if p.Type == types.ProviderTypeBedrock && !bedrock.HasCredentials(p) ||
+			p.Type == types.ProviderTypeAzure && !azure.HasCredentials(p) {
+			return d.keyFix(c, provider)
+		}
+		return ""
+	}
+	switch provider {
+	case "anthropic":
+		if d.n.AnthropicAPIKey == "" && d.n.AnthropicHeaders["x-api-key"] == "" {
+			return d.keyFix(c, provider)
+		}
+	case "openai":
+		if d.n.OpenAIAPIKey == "" && d.n.OpenAIHeaders["Authorization"] == "" {
+			return d.keyFix(c, provider)
+		}
+	case "gemini":
+		if d.n.GeminiAPIKey == "" {
+			return d.keyFix(c, provider)
+		}
+	}
+	return ""
+}
+
+func (d *Doctor) keyFix(c types.Config, provider string) string {
+	if p, ok := c.Providers[provider]; ok && p.Type == types.ProviderTypeBedrock {
+		return "set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, AWS_BEARER_TOKEN_BEDROCK, or the accessKeyID and secretAccessKey of provider " + provider
+	} else if ok {
+		return "set AZURE_OPENAI_API_KEY, the apiKey of provider " + provider + ", or use auth: entra"
+	}
+	if provider == "anthropic" {
+		return "set ANTHROPIC_API_KEY in the environment or pass --anthropic-api-key"
+	}
+	if provider == "gemini" {
+		return "set GEMINI_API_KEY in the environment or pass --gemini-api-key"
+	}
+	return "set OPENAI_API_KEY in the environment or pass --openai-api-key"
+}
+
+func (d *Doctor) checkListenAddress() doctorCheck {
+	check := doctorCheck{
+		Name: "listen-address",
+	}
+
+	address := strings.TrimPrefix(d.ListenAddress, "http://")
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		check.Status = checkFail
+		check.Message = err.Error()
+		if errors.Is(err, syscall.EADDRINUSE) {
+			check.Fix = fmt.Sprintf("Stop the process using %s or serve on another address with --listen-address", address)
+		} else {
+			check.Fix = "Use an address of the form host:port, like localhost:8080"
+		}
+		return check
+	}
+	_ = l.Close()
+
+	check.Status = checkOK
+	check.Message = address + " is free"
+	return check
+}
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/eval"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+type Eval struct {
+	JUnit  string `usage:"Write a JUnit XML report to this file"`
+	Agent  string `usage:"Agent to run the cases against, overrides the agent of the eval file" short:"a"`
+	Output string `usage:"Output format (json, yaml, table)" short:"o" default:"table"`
+	n      *Nanobot
+}
+
+func NewEval(n *Nanobot) *Eval {
+	return &Eval{
+		n: n,
+	}
+}
+
+func (e *Eval) Customize(cmd *cobra.Command) {
+	cmd.Use = "eval [flags] NANOBOT_CONFIG EVAL_FILE..."
+	cmd.Short = "Run scripted test cases against an agent and report which passed."
+	cmd.Example = `
+  # Run the cases in evals.yaml against the agent of nanobot.yaml in the current directory
+  nanobot eval . evals.yaml
+
+  # Write a JUnit report for CI
+  nanobot eval --junit report.xml . evals.yaml
+
+  # An eval file
+  agent: weather
+  cases:
+  - name: uses the forecast tool
+    input: What is the weather in Berlin tomorrow?
+    toolCalls:
+    - name: forecast
+      arguments:
+        city: Berlin
+    assert:
+    - regex: (?i)berlin
+    - judge: The response gives a forecast for tomorrow
+`
+	cmd.Args = cobra.MinimumNArgs(2)
+}
+
+func (e *Eval) Run(cmd *cobra.Command, args []string) error {
+	log.EnableMessages = false
+
+	cfg, err := e.n.ReadConfig(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+	if err := e.n.setupLogging(cfg.Logging); err != nil {
+		return err
+	}
+
+	oauthOpts, err := localOAuth(cmd.Context())
+	if err != nil {
+		return err
+	}
+	rt, err := e.n.GetRuntime(runtime.Options{
+		MaxConcurrency: e.n.MaxConcurrency,
+		DSN:            e.n.DSN(),
+	}, oauthOpts)
+	if err != nil {
+		return err
+	}
+
+	env, err := e.n.loadEnv()
+	if err != nil {
+		return err
+	}
+
+	var (
+		reports []eval.Report
+		failed  int
+	)
+
+	for _, file := range args[1:] {
+		suite, err := eval.Load(file)
+		if err != nil {
+			return err
+		}
+		if e.Agent != "" {
+			suite.Agent = e.Agent
+			for i := range suite.Cases {
+				suite.Cases[i].Agent = ""
+			}
+		}
+		if err := eval.Prepare(cfg, suite); err != nil {
+			return err
+		}
+
+		report := eval.Run(cmd.Context(), rt, *suite, func(ctx context.Context) context.Context {
+			return runtime.WithTempSession(ctx, cfg, env)
+		})
+		failed += report.Failed()
+		reports = append(reports, report)
+	}
+
+	if e.JUnit != "" {
+		if err := writeJUnit(e.JUnit, reports); err != nil {
+			return err
+		}
+	}
+
+	if !display(reports, e.Output) {
+		printReports(reports)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d eval cases failed", failed)
+	}
+	return nil
+}
+
+func writeJUnit(file string, reports []eval.Report) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("failed to create JUnit report %s: %w", file, err)
+	}
+	defer f.Close()
+
+	return eval.WriteJUnit(f, reports...)
+}
+
+func printReports(reports []eval.Report) {
+	var passed, total int
+	for _, report := range reports {
+		for _, result := range report.Results {
+			total++
+			switch {
+			case result.Error != "":
+				fmt.Printf("ERROR %s (%s): %s\n", result.Name, result.Duration.Round(time.Millisecond), result.Error)
+			case len(result.Failures) > 0:
+				fmt.Printf("FAIL  %s (%s)\n", result.Name, result.Duration.Round(time.Millisecond))
+				fmt.Printf("      %s\n", strings.Join(result.Failures, "\n      "))
+			default:
+				passed++
+				fmt.Printf("PASS  %s (%s)\n", result.Name, result.Duration.Round(time.Millisecond))
+			}
+		}
+	}
+	fmt.Printf("\n%d/%d passed\n", passed, total)
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nanobot-ai/nanobot/pkg/experiments"
+	"github.com/nanobot-ai/nanobot/pkg/session"
+	"github.com/spf13/cobra"
+)
+
+type Experiments struct {
+	Experiment string `usage:"Only include this experiment"`
+	Since      string `usage:"Only include sessions assigned since this UTC day (YYYY-MM-DD)"`
+	Account    string `usage:"Only include sessions of this account"`
+	Output     string `usage:"Output format (json, yaml, table)" short:"o" default:"table"`
+	n          *Nanobot
+}
+
+func NewExperiments(n *Nanobot) *Experiments {
+	return &Experiments{
+		n: n,
+	}
+}
+
+func (e *Experiments) Customize(cmd *cobra.Command) {
+	cmd.Use = "experiments [flags]"
+	cmd.Short = "Compare the latency, cost, and feedback of the variants of experiments."
+	cmd.Example = `
+  # Compare the variants of all experiments
+  nanobot experiments
+
+  # Export the results of one experiment since it started as JSON
+  nanobot experiments --experiment concise-prompt --since 2025-06-01 -o json
+`
+	cmd.Args = cobra.NoArgs
+}
+
+func (e *Experiments) Run(cmd *cobra.Command, _ []string) error {
+	store, err := session.NewStoreFromDSN(e.n.DSN())
+	if err != nil {
+		return err
+	}
+
+	sessions, err := experiments.Load(cmd.Context(), store, e.Account)
+	if err != nil {
+		return err
+	}
+
+	report := experiments.NewReport(experiments.Filter{
+		Since:      e.Since,
+		Experiment: e.Experiment,
+	}, sessions...)
+
+	if display(report, e.Output) {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = tw.Write([]byte("EXPERIMENT\tVARIANT\tAGENT\tSESSIONS\tTURNS\tLATENCY\tCOST/SESSION (USD)\tTOOL FAILURES\tFEEDBACK\tSATISFACTION\tRESOLVED\n"))
+	for _, result := range report.Experiments {
+		for _, arm := range []experiments.Arm{result.Control, result.Variant} {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%.4f\t%.1f%%\t%d\t%.1f%%\t%.1f%%\n", result.Experiment, arm.Variant,
+				arm.Agent, arm.Sessions, arm.Turns, latency(arm.LatencyMS), arm.CostPerSessionUSD, arm.ToolFailureRate*100,
+				arm.Feedback, arm.Satisfaction*100, arm.ResolutionRate*100)
+		}
+	}
+	return tw.Flush()
+}
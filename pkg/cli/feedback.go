@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/analytics"
+	"github.com/nanobot-ai/nanobot/pkg/cmd"
+	"github.com/nanobot-ai/nanobot/pkg/session"
+	"github.com/spf13/cobra"
+)
+
+type Feedback struct {
+	Nanobot *Nanobot
+	Account string `usage:"Only include sessions of this account"`
+	Output  string `usage:"Output format (json, yaml, table)" short:"o" default:"table"`
+}
+
+func NewFeedback(n *Nanobot) *cobra.Command {
+	f := &Feedback{
+		Nanobot: n,
+	}
+	return cmd.Command(f,
+		&FeedbackList{f: f},
+		&FeedbackAdd{f: f})
+}
+
+func (f *Feedback) Customize(cmd *cobra.Command) {
+	cmd.Use = "feedback [flags]"
+	cmd.Short = "List and add the feedback of users on the turns of sessions"
+	cmd.Args = cobra.NoArgs
+}
+
+func (f *Feedback) Run(cmd *cobra.Command, _ []string) error {
+	return f.list(cmd, "")
+}
+
+type feedbackEntry struct {
+	SessionID string `json:"sessionID"`
+	analytics.Feedback
+}
+
+func (f *Feedback) list(cmd *cobra.Command, sessionID string) error {
+	store, err := session.NewStoreFromDSN(f.Nanobot.DSN())
+	if err != nil {
+		return err
+	}
+
+	var sessions []session.Session
+	if sessionID != "" {
+		stored, err := (&Sessions{Nanobot: f.Nanobot}).find(cmd.Context(), store, sessionID)
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, *stored)
+	} else if f.Account != "" {
+		sessions, err = store.FindByAccountID(cmd.Context(), f.Account)
+	} else {
+		sessions, err = store.List(cmd.Context())
+	}
+	if err != nil {
+		return err
+	}
+
+	entries := make([]feedbackEntry, 0)
+	for _, s := range sessions {
+		log, err := analytics.FromAttributes(s.State.Attributes)
+		if err != nil {
+			return fmt.Errorf("failed to read feedback of session %s: %w", s.SessionID, err)
+		}
+		for _, feedback := range log.Feedback {
+			entries = append(entries, feedbackEntry{
+				SessionID: s.SessionID,
+				Feedback:  feedback,
+			})
+		}
+	}
+
+	if display(entries, f.Output) {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = tw.Write([]byte("TIME\tSESSION\tMESSAGE\tRATING\tAGENT\tMODEL\tTAGS\tCOMMENT\n"))
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Time.Format(time.RFC3339), entry.SessionID,
+			trim(entry.MessageID), entry.Rating, entry.Agent, entry.Model, strings.Join(entry.Tags, ","), trim(entry.Comment))
+	}
+	return tw.Flush()
+}
+
+type FeedbackList struct {
+	f *Feedback
+}
+
+func (l *FeedbackList) Customize(cmd *cobra.Command) {
+	cmd.Use = "list [flags] [SESSION_ID]"
+	cmd.Short = "List the feedback of all sessions or of one session"
+	cmd.Aliases = []string{"ls"}
+	cmd.Args = cobra.MaximumNArgs(1)
+}
+
+func (l *FeedbackList) Run(cmd *cobra.Command, args []string) error {
+	var sessionID string
+	if len(args) > 0 {
+		sessionID = args[0]
+	}
+	return l.f.list(cmd, sessionID)
+}
+
+type FeedbackAdd struct {
+	f       *Feedback
+	Rating  string   `usage:"The rating of the response, up or down"`
+	Comment string   `usage:"A comment on the response"`
+	Tag     []string `usage:"A tag of the feedback, can be repeated"`
+}
+
+func (a *FeedbackAdd) Customize(cmd *cobra.Command) {
+	cmd.Use = "add [flags] SESSION_ID MESSAGE_ID"
+	cmd.Short = "Rate the response of a turn of a session"
+	cmd.Long = `Rate the response of a turn, MESSAGE_ID is the ID of the message the agent responded with. The session
+is changed in the database, a server that has the session loaded replaces the feedback when it stores the
+session, so use the feedback API of the server for sessions that are in use.`
+	cmd.Args = cobra.ExactArgs(2)
+	cmd.Example = `
+  # Give the last response of the most recently used session a thumbs down
+  nanobot feedback add last MESSAGE_ID --rating down --comment "used the wrong tool" --tag tools
+`
+}
+
+func (a *FeedbackAdd) Run(cmd *cobra.Command, args []string) error {
+	store, err := session.NewStoreFromDSN(a.f.Nanobot.DSN())
+	if err != nil {
+		return err
+	}
+
+	stored, err := (&Sessions{Nanobot: a.f.Nanobot}).find(cmd.Context(), store, args[0])
+	if err != nil {
+		return err
+	}
+
+	log, err := analytics.FromAttributes(stored.State.Attributes)
+	if err != nil {
+		return fmt.Errorf("failed to read feedback of session %s: %w", stored.SessionID, err)
+	}
+
+	log, feedback, err := log.AddFeedback(analytics.Feedback{
+		MessageID: args[1],
+		Rating:    a.Rating,
+		Comment:   a.Comment,
+		Tags:      a.Tag,
+	})
+	if err != nil {
+		return err
+	}
+
+	if stored.State.Attributes == nil {
+		stored.State.Attributes = map[string]any{}
+	}
+	stored.State.Attributes[analytics.SessionKey] = log
+	if err := store.Update(cmd.Context(), stored); err != nil {
+		return fmt.Errorf("failed to store feedback of session %s: %w", stored.SessionID, err)
+	}
+
+	if !display(feedbackEntry{SessionID: stored.SessionID, Feedback: feedback}, a.f.Output) {
+		fmt.Printf("Added %s feedback on message %s of session %s\n", feedback.Rating, feedback.MessageID, stored.SessionID)
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nanobot-ai/nanobot/pkg/eval"
+	"github.com/nanobot-ai/nanobot/pkg/llm"
+	"github.com/nanobot-ai/nanobot/pkg/llm/gemini"
+	"github.com/nanobot-ai/nanobot/pkg/llm/ollama"
+	"github.com/nanobot-ai/nanobot/pkg/version"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"sigs.k8s.io/yaml"
+)
+
+type NewCommand struct {
+	n            *Nanobot
+	Name         string   `usage:"Name of the agent (default: the name of the directory)"`
+	Provider     string   `usage:"LLM provider of the agent (openai, anthropic, gemini, ollama)"`
+	Model        string   `usage:"Model of the agent (default: the default model of the provider)"`
+	Servers      []string `usage:"Common MCP servers to add to the agent, see the list below" short:"s"`
+	Instructions string   `usage:"System prompt of the agent"`
+	Eval         bool     `usage:"Also write evals.yaml with a test case to run with nanobot eval"`
+	Dockerfile   bool     `usage:"Also write a Dockerfile that runs the nanobot"`
+	Yes          bool     `usage:"Do not ask questions, use the flags and defaults" short:"y"`
+	Force        bool     `usage:"Overwrite files that exist"`
+}
+
+func NewNew(n *Nanobot) *NewCommand {
+	return &NewCommand{
+		n: n,
+	}
+}
+
+// newProviders maps the providers to their default model and the environment variable of their key.
+var newProviders = map[string]struct {
+	model  string
+	envKey string
+}{
+	"openai":    {model: "gpt-4.1", envKey: "OPENAI_API_KEY"},
+	"anthropic": {model: "claude-sonnet-4-5", envKey: "ANTHROPIC_API_KEY"},
+	"ollama":    {model: ollama.ModelPrefix + "llama3.2"},
+	"gemini":    {model: gemini.ModelPrefix + "gemini-2.5-flash", envKey: "GEMINI_API_KEY"},
+}
+
+type newServer struct {
+	name        string
+	description string
+	url         string
+	command     string
+	args        []string
+	headers     map[string]string
+	// envKey is an environment variable the server needs to be set.
+	envKey string
+}
+
+var newServers = []newServer{
+	{
+		name:        "filesystem",
+		description: "read and write files in the current directory",
+		command:     "npx",
+		args:        []string{"-y", "@modelcontextprotocol/server-filesystem", "."},
+	},
+	{
+		name:        "fetch",
+		description: "fetch web pages as markdown",
+		command:     "uvx",
+		args:        []string{"mcp-server-fetch"},
+	},
+	{
+		name:        "memory",
+		description: "a knowledge graph the agent remembers facts in",
+		command:     "npx",
+		args:        []string{"-y", "@modelcontextprotocol/server-memory"},
+	},
+	{
+		name:        "time",
+		description: "current time and time zone conversions",
+		command:     "uvx",
+		args:        []string{"mcp-server-time"},
+	},
+	{
+		name:        "sequential-thinking",
+		description: "step by step problem solving",
+		command:     "npx",
+		args:        []string{"-y", "@modelcontextprotocol/server-sequential-thinking"},
+	},
+	{
+		name:        "deepwiki",
+		description: "documentation of public GitHub repositories",
+		url:         "https://mcp.deepwiki.com/mcp",
+	},
+	{
+		name:        "github",
+		description: "issues, pull requests, and code on GitHub",
+		url:         "https://api.githubcopilot.com/mcp/",
+		headers:     map[string]string{"Authorization": "Bearer ${GITHUB_PERSONAL_ACCESS_TOKEN}"},
+		envKey:      "GITHUB_PERSONAL_ACCESS_TOKEN",
+	},
+	{
+		name:        "huggingface",
+		description: "models, datasets, and spaces on Hugging Face",
+		url:         "https://huggingface.co/mcp",
+	},
+}
+
+type newFile struct {
+	name string
+	data []byte
+}
+
+func (n *NewCommand) Customize(cmd *cobra.Command) {
+	cmd.Use = "new [flags] [DIRECTORY]"
+	cmd.Short = "Create a nanobot.yaml, asking for the provider, MCP servers, and system prompt of the agent."
+	cmd.Args = cobra.MaximumNArgs(1)
+
+	var servers strings.Builder
+	for _, server := range newServers {
+		fmt.Fprintf(&servers, "    %-20s %s\n", server.name, server.description)
+	}
+	cmd.Example = `
+  # Answer the questions to create nanobot.yaml in the current directory
+  nanobot new
+
+  # Create my-bot/nanobot.yaml, my-bot/evals.yaml, and my-bot/Dockerfile without questions
+  nanobot new -y --provider anthropic -s filesystem,fetch --eval --dockerfile ./my-bot
+
+  # MCP servers that can be added with --servers
+` + servers.String()
+}
+
+func (n *NewCommand) Run(cmd *cobra.Command, args []string) error {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path of %s: %w", dir, err)
+	}
+
+	p := &prompter{
+		in:          bufio.NewReader(os.Stdin),
+		out:         os.Stdout,
+		interactive: !n.Yes && term.IsTerminal(int(os.Stdin.Fd())),
+	}
+	changed := cmd.Flags().Changed
+
+	if n.Name == "" {
+		n.Name = p.ask("Agent name", title(filepath.Base(abs)))
+	}
+
+	if n.Provider == "" && n.Model != "" {
+		n.Provider = llm.Provider(n.Model)
+	}
+	if n.Provider == "" {
+		n.Provider = p.choose("LLM provider", slices.Sorted(maps.Keys(newProviders)), "openai")
+	}
+	provider, ok := newProviders[n.Provider]
+	if !ok {
+		return fmt.Errorf("unknown provider %q, must be openai, anthropic, gemini, or ollama", n.Provider)
+	}
+	if n.Model == "" {
+		n.Model = p.ask("Model", provider.model)
+	}
+
+	if !changed("servers") {
+		names := make([]string, 0, len(newServers))
+		for _, server := range newServers {
+			names = append(names, server.name)
+		}
+		n.Servers = p.list("MCP servers, comma separated ("+strings.Join(names, ", ")+")", nil)
+	}
+	var servers []newServer
+	for _, name := range n.Servers {
+		i := slices.IndexFunc(newServers, func(s newServer) bool {
+			return s.name == name
+		})
+		if i < 0 {
+			return fmt.Errorf("unknown MCP server %q, see nanobot new --help for the list", name)
+		}
+		if !slices.ContainsFunc(servers, func(s newServer) bool { return s.name == name }) {
+			servers = append(servers, newServers[i])
+		}
+	}
+
+	if !changed("instructions") {
+		n.Instructions = p.ask("System prompt", "You are a helpful assistant.")
+	}
+	if !changed("eval") {
+		n.Eval = p.confirm("Add evals.yaml with a test case", false)
+	}
+	if !changed("dockerfile") {
+		n.Dockerfile = p.confirm("Add a Dockerfile", false)
+	}
+
+	files := []newFile{
+		{"nanobot.yaml", newConfig(n.Name, n.Model, n.Instructions, servers)},
+	}
+	if n.Eval {
+		data, err := newEval()
+		if err != nil {
+			return err
+		}
+		files = append(files, newFile{"evals.yaml", data})
+	}
+	if n.Dockerfile {
+		files = append(files, newFile{"Dockerfile", newDockerfile(n.Eval, newEnvKeys(provider.envKey, servers))})
+	}
+
+	for _, file := range files {
+		path := filepath.Join(dir, file.name)
+		if _, err := os.Stat(path); err == nil && !n.Force {
+			return fmt.Errorf("%s exists, use --force to overwrite it", path)
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to check %s: %w", path, err)
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file.name)
+		if err := os.WriteFile(path, file.data, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		fmt.Printf("Created %s\n", path)
+	}
+
+	runPath := dir
+	if !filepath.IsAbs(runPath) && !strings.HasPrefix(runPath, ".") {
+		runPath = "./" + runPath
+	}
+
+	fmt.Println("\nNext steps:")
+	for _, envKey := range newEnvKeys(provider.envKey, servers) {
+		if os.Getenv(envKey) == "" {
+			fmt.Printf("  export %s=...\n", envKey)
+		}
+	}
+	if n.Provider == "ollama" {
+		fmt.Printf("  ollama pull %s\n", strings.TrimPrefix(n.Model, ollama.ModelPrefix))
+	}
+	if n.Eval {
+		fmt.Printf("  nanobot eval %s %s\n", runPath, filepath.Join(runPath, "evals.yaml"))
+	}
+	fmt.Printf("  nanobot run %s\n", runPath)
+	return nil
+}
+
+func newEnvKeys(providerKey string, servers []newServer) (result []string) {
+	if providerKey != "" {
+		result = append(result, providerKey)
+	}
+	for _, server := range servers {
+		if server.envKey != "" && !slices.Contains(result, server.envKey) {
+			result = append(result, server.envKey)
+		}
+	}
+	return
+}
+
+// newConfig writes the config by hand, rather than marshalling a types.Config, to keep the fields in
+// the order people read them.
+func newConfig(name, model, instructions string, servers []newServer) []byte {
+	var sb strings.Builder
+	sb.WriteString("agents:\n  main:\n")
+	fmt.Fprintf(&sb, "    name: %s\n", yamlString(name))
+	fmt.Fprintf(&sb, "    model: %s\n", yamlString(model))
+	if instructions != "" {
+		sb.WriteString("    instructions: |\n")
+		for _, line := range strings.Split(strings.TrimRight(instructions, "\n"), "\n") {
+			sb.WriteString(strings.TrimRight("      "+line, " ") + "\n")
+		}
+	}
+	if len(servers) == 0 {
+		return []byte(sb.String())
+	}
+
+	sb.WriteString("    mcpServers:\n")
+	for _, server := range servers {
+		fmt.Fprintf(&sb, "      - %s\n", server.name)
+	}
+
+	sb.WriteString("\nmcpServers:\n")
+	for _, server := range servers {
+		fmt.Fprintf(&sb, "  %s:\n", server.name)
+		if server.url != "" {
+			fmt.Fprintf(&sb, "    url: %s\n", yamlString(server.url))
+		}
+		if server.command != "" {
+			fmt.Fprintf(&sb, "    command: %s\n", yamlString(server.command))
+		}
+		if len(server.args) > 0 {
+			sb.WriteString("    args:\n")
+			for _, arg := range server.args {
+				fmt.Fprintf(&sb, "      - %s\n", yamlString(arg))
+			}
+		}
+		if len(server.headers) > 0 {
+			sb.WriteString("    headers:\n")
+			for _, key := range slices.Sorted(maps.Keys(server.headers)) {
+				fmt.Fprintf(&sb, "      %s: %s\n", key, yamlString(server.headers[key]))
+			}
+		}
+	}
+	return []byte(sb.String())
+}
+
+func newEval() ([]byte, error) {
+	data, err := yaml.Marshal(eval.Suite{
+		Agent: "main",
+		Cases: []eval.Case{
+			{
+				Name:  "introduces itself",
+				Input: "Hi, what can you help me with?",
+				Assert: []eval.Assertion{
+					{Judge: "The response describes what the assistant can help with"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal eval file: %w", err)
+	}
+	return data, nil
+}
+
+func newDockerfile(withEval bool, envKeys []string) []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "FROM %s\n\n", version.BaseImage)
+	sb.WriteString("WORKDIR /app\nCOPY nanobot.yaml ./\n")
+	if withEval {
+		sb.WriteString("COPY evals.yaml ./\n")
+	}
+	sb.WriteString("\n# docker build -t my-nanobot . && docker run")
+	for _, envKey := range envKeys {
+		sb.WriteString(" -e " + envKey)
+	}
+	sb.WriteString(" -p 8080:8080 my-nanobot\n")
+	sb.WriteString(`ENTRYPOINT ["nanobot", "run", "/app"]` + "\n")
+	return []byte(sb.String())
+}
+
+// yamlString quotes s if it would not be read back as the same string.
+func yamlString(s string) string {
+	parsed := map[string]any{}
+	if err := yaml.Unmarshal([]byte("v: "+s), &parsed); err == nil && parsed["v"] == s && !strings.ContainsAny(s, "#'\"\n") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+func title(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.' || unicode.IsSpace(r)
+	})
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	if len(words) == 0 {
+		return "Assistant"
+	}
+	return strings.Join(words, " ")
+}
+
+// prompter asks questions on the terminal. If it is not interactive the defaults are the answers.
+type prompter struct {
+	in          *bufio.Reader
+	out         io.Writer
+	interactive bool
+}
+
+func (p *prompter) ask(question, def string) string {
+	if !p.interactive {
+		return def
+	}
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, _ := p.in.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+func (p *prompter) choose(question string, options []string, def string) string {
+	for {
+		answer := p.ask(question+" ("+strings.Join(options, ", ")+")", def)
+		if slices.Contains(options, answer) || !p.interactive {
+			return answer
+		}
+		fmt.Fprintf(p.out, "%q is not one of %s\n", answer, strings.Join(options, ", "))
+	}
+}
+
+func (p *prompter) list(question string, def []string) []string {
+	answer := p.ask(question, strings.Join(def, ","))
+	var result []string
+	for _, item := range strings.Split(answer, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func (p *prompter) confirm(question string, def bool) bool {
+	options := "y/N"
+	if def {
+		options = "Y/n"
+	}
+	answer := strings.ToLower(p.ask(question+"? ["+options+"]", ""))
+	switch answer {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	default:
+		return def
+	}
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	goruntime "runtime"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/runtime"
+)
+
+// localOAuth starts a callback listener on the loopback interface so that commands which do not run an
+// HTTP server can still complete the OAuth flow of remote MCP servers. The listener is closed when ctx is
+// done.
+func localOAuth(ctx context.Context) (runtime.Options, error) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return runtime.Options{}, fmt.Errorf("failed to listen for OAuth callbacks: %w", err)
+	}
+
+	callbackHandler := mcp.NewCallbackServer(browserAuthURLHandler{})
+	mux := http.NewServeMux()
+	mux.Handle("/oauth/callback", callbackHandler)
+
+	s := &http.Server{
+		Handler: mux,
+	}
+	go func() {
+		if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Errorf(ctx, "OAuth callback server failed: %v", err)
+		}
+	}()
+	context.AfterFunc(ctx, func() {
+		_ = s.Close()
+	})
+
+	return runtime.Options{
+		CallbackHandler:  callbackHandler,
+		OAuthRedirectURL: fmt.Sprintf("http://localhost:%d/oauth/callback", l.Addr().(*net.TCPAddr).Port),
+	}, nil
+}
+
+// browserAuthURLHandler asks the user to authorize in the browser instead of through an elicitation.
+type browserAuthURLHandler struct{}
+
+func (browserAuthURLHandler) HandleAuthURL(ctx context.Context, mcpServerName, url string) (bool, error) {
+	_, _ = fmt.Fprintf(os.Stderr, "MCP server %s requires authorization, open the following URL in your browser to continue:\n\n  %s\n\n", mcpServerName, url)
+	if err := openBrowser(url); err != nil {
+		log.Debugf(ctx, "failed to open browser: %v", err)
+	}
+	return true, nil
+}
+
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch goruntime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		_ = cmd.Wait()
+	}()
+	return nil
+}
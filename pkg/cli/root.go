@@ -9,24 +9,47 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/nanobot-ai/nanobot/pkg/a2a"
+	"github.com/nanobot-ai/nanobot/pkg/analytics"
 	"github.com/nanobot-ai/nanobot/pkg/api"
+	"github.com/nanobot-ai/nanobot/pkg/audit"
 	"github.com/nanobot-ai/nanobot/pkg/auth"
+	"github.com/nanobot-ai/nanobot/pkg/bus"
+	"github.com/nanobot-ai/nanobot/pkg/channels/slack"
+	"github.com/nanobot-ai/nanobot/pkg/chatcompletions"
 	"github.com/nanobot-ai/nanobot/pkg/cmd"
 	"github.com/nanobot-ai/nanobot/pkg/complete"
 	"github.com/nanobot-ai/nanobot/pkg/config"
+	"github.com/nanobot-ai/nanobot/pkg/drain"
+	"github.com/nanobot-ai/nanobot/pkg/events"
+	"github.com/nanobot-ai/nanobot/pkg/experiments"
+	"github.com/nanobot-ai/nanobot/pkg/gormdsn"
+	"github.com/nanobot-ai/nanobot/pkg/grpcapi"
 	"github.com/nanobot-ai/nanobot/pkg/llm"
 	"github.com/nanobot-ai/nanobot/pkg/llm/anthropic"
+	"github.com/nanobot-ai/nanobot/pkg/llm/gemini"
+	"github.com/nanobot-ai/nanobot/pkg/llm/ollama"
 	"github.com/nanobot-ai/nanobot/pkg/llm/responses"
 	"github.com/nanobot-ai/nanobot/pkg/log"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/metrics"
+	"github.com/nanobot-ai/nanobot/pkg/replay"
 	"github.com/nanobot-ai/nanobot/pkg/runtime"
+	"github.com/nanobot-ai/nanobot/pkg/secrets"
 	"github.com/nanobot-ai/nanobot/pkg/server"
 	"github.com/nanobot-ai/nanobot/pkg/session"
+	"github.com/nanobot-ai/nanobot/pkg/telemetry"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+	"github.com/nanobot-ai/nanobot/pkg/trigger"
 	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/usage"
 	"github.com/nanobot-ai/nanobot/pkg/version"
+	"github.com/nanobot-ai/nanobot/pkg/webhook"
+	"github.com/nanobot-ai/nanobot/pkg/workdir"
 	"github.com/spf13/cobra"
 	"sigs.k8s.io/yaml"
 )
@@ -38,6 +61,20 @@ func New() *cobra.Command {
 		NewCall(n),
 		NewTargets(n),
 		NewSessions(n),
+		NewConversations(n),
+		NewEval(n),
+		NewBatch(n),
+		NewUsage(n),
+		NewAnalytics(n),
+		NewFeedback(n),
+		NewExperiments(n),
+		NewAudit(n),
+		NewWireLog(n),
+		NewTail(n),
+		NewDoctor(n),
+		NewServers(n),
+		NewValidate(n),
+		NewNew(n),
 		NewRun(n))
 	return root
 }
@@ -56,11 +93,40 @@ type Nanobot struct {
 	AnthropicAPIKey  string            `usage:"Anthropic API key" env:"ANTHROPIC_API_KEY" name:"anthropic-api-key"`
 	AnthropicBaseURL string            `usage:"Anthropic API URL" env:"ANTHROPIC_BASE_URL" name:"anthropic-base-url"`
 	AnthropicHeaders map[string]string `usage:"Anthropic API headers" env:"ANTHROPIC_HEADERS" name:"anthropic-headers"`
+	AnthropicCache   bool              `usage:"Enable Anthropic prompt caching" env:"ANTHROPIC_PROMPT_CACHING" name:"anthropic-prompt-caching"`
+	GeminiAPIKey     string            `usage:"Gemini API key, used for models prefixed with gemini/" env:"GEMINI_API_KEY" name:"gemini-api-key"`
+	GeminiBaseURL    string            `usage:"Gemini API URL" env:"GEMINI_BASE_URL" name:"gemini-base-url"`
+	OllamaBaseURL    string            `usage:"Ollama API URL, used for models prefixed with ollama/" env:"OLLAMA_BASE_URL" name:"ollama-base-url" default:"http://localhost:11434"`
+	OllamaPull       bool              `usage:"Pull Ollama models that are not available locally on first use" env:"OLLAMA_PULL_MODELS" name:"ollama-pull-models"`
 	MaxConcurrency   int               `usage:"The maximum number of concurrent tasks in a parallel loop" default:"10" hidden:"true"`
 	Chdir            string            `usage:"Change directory to this path before running the nanobot" default:"." short:"C"`
-	State            string            `usage:"Path to the state file" default:"./nanobot.db"`
-
-	env map[string]string
+	State            string            `usage:"Path to the state file or a database DSN (postgres://..., mysql://...)" default:"./nanobot.db"`
+	DBMaxOpenConns   int               `usage:"Maximum number of open connections to the state database" name:"db-max-open-conns" hidden:"true"`
+	DBMaxIdleConns   int               `usage:"Maximum number of idle connections to the state database" name:"db-max-idle-conns" hidden:"true"`
+	DBConnMaxLife    string            `usage:"Maximum lifetime of a state database connection (e.g. 30m)" name:"db-conn-max-lifetime" hidden:"true"`
+	SessionTTL       string            `usage:"Default time an idle session is kept before it expires (e.g. 24h), unset means sessions never expire" name:"session-ttl"`
+	BusURL           string            `usage:"URL of the message bus that carries notifications to clients connected to other replicas (redis://..., rediss://...)" env:"NANOBOT_BUS_URL" name:"bus-url"`
+	ReplicaURL       string            `usage:"URL other replicas reach this replica at, requests of a session are forwarded to the replica that has it loaded (needs a shared state database)" env:"NANOBOT_REPLICA_URL" name:"replica-url"`
+	ShareKey         string            `usage:"Key that signs the share links of chats, without one links are only valid until the server restarts, required with --replica-url" env:"NANOBOT_SHARE_KEY" name:"share-key"`
+	HealthCheck      string            `usage:"How often MCP servers are pinged to check they are healthy, 0 disables health checks" name:"mcp-health-check-interval" default:"30s" hidden:"true"`
+	SecretsCacheTTL  string            `usage:"How long secrets resolved from vault:, aws-sm: and file: references are cached" name:"secrets-cache-ttl" default:"5m" hidden:"true"`
+	HTTPProxy        string            `usage:"Proxy URL of outbound requests to remote MCP servers, LLM providers and other services, defaults to HTTP_PROXY and HTTPS_PROXY" env:"NANOBOT_HTTP_PROXY" name:"http-proxy"`
+	CAFile           string            `usage:"PEM file of CA certificates trusted by outbound requests in addition to the system roots" env:"NANOBOT_CA_FILE" name:"ca-file"`
+	ClientCert       string            `usage:"PEM client certificate presented by outbound requests to servers that ask for one" env:"NANOBOT_CLIENT_CERT" name:"client-cert"`
+	ClientKey        string            `usage:"PEM key of the client certificate" env:"NANOBOT_CLIENT_KEY" name:"client-key"`
+	MaxConnsPerHost  int               `usage:"Maximum number of connections of outbound requests to one host, 0 means no limit" name:"max-conns-per-host" hidden:"true"`
+	OTLPEndpoint     string            `usage:"OTLP/HTTP endpoint to export traces to (e.g. http://localhost:4318), unset disables tracing" env:"OTEL_EXPORTER_OTLP_ENDPOINT" name:"otlp-endpoint"`
+	OTLPHeaders      map[string]string `usage:"Headers to send to the OTLP endpoint" env:"OTEL_EXPORTER_OTLP_HEADERS" name:"otlp-headers"`
+	Record           string            `usage:"Record all LLM requests and MCP tool calls to this cassette file" env:"NANOBOT_RECORD"`
+	Replay           string            `usage:"Serve LLM responses and MCP tool results from a cassette file recorded with --record instead of calling the real APIs" env:"NANOBOT_REPLAY"`
+	AuditLog         string            `usage:"Path of the append-only audit log of tool calls, approvals, model requests, and config changes" env:"NANOBOT_AUDIT_LOG" name:"audit-log"`
+	AuditRetention   string            `usage:"How long events are kept in the audit log (e.g. 2160h), unset keeps them forever" env:"NANOBOT_AUDIT_RETENTION" name:"audit-retention"`
+	ConfigKey        string            `usage:"Path of a cosign public key, remote configs (oci:// and https://) must be signed with its private key" env:"NANOBOT_CONFIG_KEY" name:"config-key"`
+	LogFormat        string            `usage:"Format of the logs, text or json, overrides the logging format of the config" env:"NANOBOT_LOG_FORMAT" name:"log-format"`
+
+	env      map[string]string
+	cassette *replay.Cassette
+	auditLog *audit.Log
 }
 
 func ensureDirectoryForDSN(dsn string) error {
@@ -101,6 +167,21 @@ func (n *Nanobot) DSN() string {
 	return dsn
 }
 
+func (n *Nanobot) DBOptions() (gormdsn.Options, error) {
+	opts := gormdsn.Options{
+		MaxOpenConns: n.DBMaxOpenConns,
+		MaxIdleConns: n.DBMaxIdleConns,
+	}
+	if n.DBConnMaxLife != "" {
+		d, err := time.ParseDuration(n.DBConnMaxLife)
+		if err != nil {
+			return opts, fmt.Errorf("invalid db-conn-max-lifetime %q: %w", n.DBConnMaxLife, err)
+		}
+		opts.ConnMaxLifetime = d
+	}
+	return opts, nil
+}
+
 func (n *Nanobot) Customize(cmd *cobra.Command) {
 	cmd.Short = "Nanobot: Build MCP Agents"
 	cmd.CompletionOptions.HiddenDefaultCmd = true
@@ -125,6 +206,42 @@ func (n *Nanobot) PersistentPre(cmd *cobra.Command, _ []string) error {
 
 	log.EnableMessages = n.Debug || n.Trace || !n.Quiet
 
+	config.RemoteOptions.KeyFile = n.ConfigKey
+
+	if n.SecretsCacheTTL != "" {
+		ttl, err := time.ParseDuration(n.SecretsCacheTTL)
+		if err != nil {
+			return fmt.Errorf("invalid secrets-cache-ttl %q: %w", n.SecretsCacheTTL, err)
+		}
+		secrets.CacheTTL = ttl
+	}
+
+	if err := transport.Setup(transport.Options{
+		Proxy:           n.HTTPProxy,
+		CAFile:          n.CAFile,
+		CertFile:        n.ClientCert,
+		KeyFile:         n.ClientKey,
+		MaxConnsPerHost: n.MaxConnsPerHost,
+	}); err != nil {
+		return err
+	}
+
+	if n.OTLPEndpoint != "" {
+		shutdown, err := telemetry.Setup(cmd.Context(), telemetry.Options{
+			Endpoint: n.OTLPEndpoint,
+			Headers:  n.OTLPHeaders,
+		})
+		if err != nil {
+			return err
+		}
+		cmd.PersistentPostRunE = func(cmd *cobra.Command, _ []string) error {
+			// Use a fresh context, the command context is usually canceled by now.
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return shutdown(ctx)
+		}
+	}
+
 	for _, sub := range cmd.Commands() {
 		if sub.Name() == "help" {
 			sub.Hidden = true
@@ -134,6 +251,18 @@ func (n *Nanobot) PersistentPre(cmd *cobra.Command, _ []string) error {
 	return nil
 }
 
+// dryRun enables dry runs for requests with the dry run header, or for all requests if always is set.
+func dryRun(next http.Handler, always bool) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if enabled, _ := strconv.ParseBool(req.Header.Get(types.DryRunHeader)); enabled || always {
+			nctx := types.NanobotContext(req.Context())
+			nctx.DryRun = true
+			req = req.WithContext(types.WithNanobotContext(req.Context(), nctx))
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
+
 func display(obj any, format string) bool {
 	if format == "json" {
 		data, _ := json.MarshalIndent(obj, "", "  ")
@@ -156,9 +285,18 @@ func (n *Nanobot) llmConfig() llm.Config {
 			Headers: n.OpenAIHeaders,
 		},
 		Anthropic: anthropic.Config{
-			APIKey:  n.AnthropicAPIKey,
-			BaseURL: n.AnthropicBaseURL,
-			Headers: n.AnthropicHeaders,
+			APIKey:        n.AnthropicAPIKey,
+			BaseURL:       n.AnthropicBaseURL,
+			Headers:       n.AnthropicHeaders,
+			PromptCaching: n.AnthropicCache,
+		},
+		Ollama: ollama.Config{
+			BaseURL:    n.OllamaBaseURL,
+			PullModels: n.OllamaPull,
+		},
+		Gemini: gemini.Config{
+			APIKey:  n.GeminiAPIKey,
+			BaseURL: n.GeminiBaseURL,
 		},
 	}
 }
@@ -224,32 +362,154 @@ func (n *Nanobot) ReadConfig(ctx context.Context, cfgPath string, opts ...runtim
 	return cfg, err
 }
 
+// setupLogging applies the logging config and the --log-format flag.
+func (n *Nanobot) setupLogging(logging *types.Logging) error {
+	var opts log.Options
+	if logging != nil {
+		opts = log.Options{
+			Format:     logging.Format,
+			Level:      logging.Level,
+			Components: logging.Components,
+		}
+		for _, sink := range logging.Sinks {
+			opts.Sinks = append(opts.Sinks, log.Sink{
+				Type:     sink.Type,
+				Path:     sink.Path,
+				MaxSize:  sink.MaxSize,
+				MaxFiles: sink.MaxFiles,
+			})
+		}
+	}
+	if n.LogFormat != "" {
+		if n.LogFormat != "text" && n.LogFormat != "json" {
+			return fmt.Errorf("invalid log-format %q, must be text or json", n.LogFormat)
+		}
+		opts.Format = n.LogFormat
+	}
+	if logging == nil && opts.Format == "" {
+		return nil
+	}
+	return log.Setup(opts)
+}
+
 func (n *Nanobot) GetRuntime(opts ...runtime.Options) (*runtime.Runtime, error) {
-	return runtime.NewRuntime(n.llmConfig(), opts...)
+	dbOptions, err := n.DBOptions()
+	if err != nil {
+		return nil, err
+	}
+	var healthCheck time.Duration
+	if n.HealthCheck != "" {
+		healthCheck, err = time.ParseDuration(n.HealthCheck)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mcp-health-check-interval %q: %w", n.HealthCheck, err)
+		}
+	}
+	cassette, err := n.getCassette()
+	if err != nil {
+		return nil, err
+	}
+	if err := n.openAuditLog(); err != nil {
+		return nil, err
+	}
+	return runtime.NewRuntime(n.llmConfig(), append([]runtime.Options{{
+		DBOptions:           dbOptions,
+		HealthCheckInterval: healthCheck,
+		Cassette:            cassette,
+	}}, opts...)...)
+}
+
+func (n *Nanobot) getCassette() (_ *replay.Cassette, err error) {
+	switch {
+	case n.cassette != nil:
+	case n.Record != "" && n.Replay != "":
+		return nil, fmt.Errorf("--record and --replay can not be used together")
+	case n.Record != "":
+		n.cassette, err = replay.NewRecorder(n.Record)
+	case n.Replay != "":
+		n.cassette, err = replay.Load(n.Replay)
+	}
+	return n.cassette, err
+}
+
+// openAuditLog opens the audit log, if one is configured, and records the events of this process in it.
+func (n *Nanobot) openAuditLog() (err error) {
+	if n.AuditLog == "" || n.auditLog != nil {
+		return nil
+	}
+
+	var opts audit.Options
+	if n.AuditRetention != "" {
+		opts.Retention, err = time.ParseDuration(n.AuditRetention)
+		if err != nil {
+			return fmt.Errorf("invalid audit-retention %q: %w", n.AuditRetention, err)
+		}
+	}
+
+	n.auditLog, err = audit.Open(n.AuditLog, opts)
+	if err != nil {
+		return err
+	}
+	audit.SetDefault(n.auditLog)
+	return nil
 }
 
 func (n *Nanobot) Run(cmd *cobra.Command, _ []string) error {
 	return cmd.Help()
 }
 
-func (n *Nanobot) runMCP(ctx context.Context, config types.ConfigFactory, runt *runtime.Runtime,
-	oauthCallbackHandler mcp.CallbackServer, listenAddress string, healthzPath string, startUI bool) error {
+// mcpOptions is how runMCP serves the MCP server and the APIs next to it.
+type mcpOptions struct {
+	OAuthCallback mcp.CallbackServer
+	ListenAddress string
+	HealthzPath   string
+	MetricsPath   string
+	// UI serves the chat UI
+	UI bool
+	// DryRun makes every request a dry run
+	DryRun    bool
+	GRPC      bool
+	OpenAIAPI bool
+	A2A       bool
+	// DrainTimeout is how long requests in flight may take to finish on shutdown
+	DrainTimeout time.Duration
+}
+
+func (n *Nanobot) runMCP(ctx context.Context, config types.ConfigFactory, runt *runtime.Runtime, opts mcpOptions) error {
 	env, err := n.loadEnv()
 	if err != nil {
 		return fmt.Errorf("failed to load environment: %w", err)
 	}
 
-	address := listenAddress
+	address := opts.ListenAddress
 	if strings.HasPrefix("address", "http://") {
 		address = strings.TrimPrefix(address, "http://")
 	} else if strings.HasPrefix(address, "https://") {
 		return fmt.Errorf("https:// is not supported, use http:// instead")
 	}
 
-	sessionManager, err := session.NewManager(n.DSN())
+	dbOptions, err := n.DBOptions()
+	if err != nil {
+		return err
+	}
+
+	var sessionTTL time.Duration
+	if n.SessionTTL != "" {
+		sessionTTL, err = time.ParseDuration(n.SessionTTL)
+		if err != nil {
+			return fmt.Errorf("invalid session-ttl %q: %w", n.SessionTTL, err)
+		}
+	}
+
+	sessionManager, err := session.NewManager(n.DSN(), session.ManagerOptions{
+		DBOptions:  dbOptions,
+		TTL:        sessionTTL,
+		ReplicaURL: n.ReplicaURL,
+		ShareKey:   n.ShareKey,
+	})
 	if err != nil {
 		return err
 	}
+	defer sessionManager.Close()
 
 	var mcpServer mcp.MessageHandler = server.NewServer(runt, config, sessionManager)
 
@@ -263,50 +523,185 @@ func (n *Nanobot) runMCP(ctx context.Context, config types.ConfigFactory, runt *
 		return nil
 	}
 
+	var notifications bus.Bus
+	if n.BusURL != "" {
+		notifications, err = bus.New(n.BusURL)
+		if err != nil {
+			return err
+		}
+		defer notifications.Close()
+	}
+
 	httpServer := mcp.NewHTTPServer(env, mcpServer, mcp.HTTPServerOptions{
 		SessionStore: sessionManager,
-		HealthzPath:  healthzPath,
+		HealthzPath:  opts.HealthzPath,
+		Bus:          notifications,
 	})
 
 	mux := http.NewServeMux()
-	if oauthCallbackHandler != nil {
-		mux.Handle("/oauth/callback", oauthCallbackHandler)
+	if opts.OAuthCallback != nil {
+		mux.Handle("/oauth/callback", opts.OAuthCallback)
 	}
-	if startUI {
+	if opts.UI {
 		mux.Handle("/", session.UISession(httpServer, sessionManager, api.Handler(sessionManager, address)))
 	} else {
 		mux.Handle("/", httpServer)
 	}
-	if healthzPath != "" {
-		mux.Handle("GET "+healthzPath, httpServer)
+	if opts.HealthzPath != "" {
+		mux.Handle("GET "+opts.HealthzPath, httpServer)
 	}
+	if opts.MetricsPath != "" {
+		mux.Handle("GET "+opts.MetricsPath, metrics.Handler(sessionManager.LiveSessions))
+	}
+	mux.Handle("GET /api/usage", usage.Handler(sessionManager.DB))
+	mux.Handle("GET /api/analytics", analytics.Handler(sessionManager.DB))
+	mux.Handle("GET /api/experiments", experiments.Handler(sessionManager.DB))
+	mux.Handle("GET /api/sessions/{session_id}/feedback", analytics.FeedbackHandler(sessionManager))
+	mux.Handle("POST /api/sessions/{session_id}/feedback", analytics.FeedbackHandler(sessionManager))
+	mux.Handle("GET "+session.SharePathPrefix+"{token}", session.ShareHandler(sessionManager))
+	mux.Handle("GET "+events.Path, events.Handler())
 
 	authCfg, err := config(ctx, "")
 	if err != nil {
 		return err
 	}
 
-	handler, err := auth.Wrap(env, authCfg, n.DSN(), mux)
+	// Turns started by requests keep running while the server drains after ctx is canceled
+	serveCtx, cancelServe := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelServe()
+
+	if workdirConfig := authCfg.Session.GetWorkdir(); workdirConfig != nil {
+		sessionManager.OnEvict(func(_ context.Context, stored *session.Session, _ *mcp.ServerSession) error {
+			return workdir.Remove(workdirConfig, stored.SessionID)
+		})
+	}
+
+	scheduler, err := trigger.NewScheduler(authCfg, env, runt, func(ctx context.Context) context.Context {
+		return runtime.WithTempSession(ctx, &authCfg, env)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to setup triggers: %w", err)
+	}
+	scheduler.Start(ctx)
+
+	go runt.IndexKnowledge(runtime.WithTempSession(ctx, &authCfg, env), authCfg)
+
+	// Share links are signed, so the shared chats are served without other credentials
+	publicPaths := []string{opts.HealthzPath, "/oauth/callback", session.SharePathPrefix}
+
+	if len(authCfg.Webhooks) > 0 {
+		webhooks, err := webhook.NewHandler(serveCtx, authCfg, env, runt, func(ctx context.Context) context.Context {
+			return runtime.WithTempSession(ctx, &authCfg, env)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to setup webhooks: %w", err)
+		}
+		mux.Handle("POST "+webhook.PathPrefix+"{name}", webhooks)
+		publicPaths = append(publicPaths, webhooks.PublicPaths()...)
+	}
+
+	if opts.GRPC {
+		grpcServer := grpcapi.NewServer(serveCtx, authCfg, runt, func(ctx context.Context) context.Context {
+			return runtime.WithTempSession(ctx, &authCfg, env)
+		})
+		defer grpcServer.Close()
+		grpcServer.Register(mux)
+	}
+
+	if opts.OpenAIAPI {
+		chatcompletions.NewHandler(authCfg, runt, func(ctx context.Context) context.Context {
+			return runtime.WithTempSession(ctx, &authCfg, env)
+		}).Register(mux)
+	}
+
+	if opts.A2A {
+		a2a.NewHandler(serveCtx, authCfg, runt, func(ctx context.Context) context.Context {
+			return runtime.WithTempSession(ctx, &authCfg, env)
+		}).Register(mux)
+		// Clients discover the agents before they authenticate
+		publicPaths = append(publicPaths, a2a.PublicPaths(authCfg)...)
+	}
+
+	if authCfg.Channels != nil && authCfg.Channels.Slack != nil {
+		adapter, err := slack.New(ctx, authCfg, env, runt, func(ctx context.Context) context.Context {
+			return runtime.WithTempSession(ctx, &authCfg, env)
+		})
+		if err != nil {
+			return err
+		}
+		if adapter.SocketMode() {
+			go adapter.RunSocketMode(ctx)
+		} else {
+			mux.Handle("POST "+slack.EventsPath, adapter.EventsHandler())
+			mux.Handle("POST "+slack.CommandsPath, adapter.CommandsHandler())
+			// Slack requests are verified with the signing secret
+			publicPaths = append(publicPaths, slack.EventsPath, slack.CommandsPath)
+		}
+	}
+
+	drainer := drain.NewHandler(sessionManager.Route(mux), sessionManager.IsNewSession, opts.HealthzPath)
+
+	handler, err := auth.Wrap(ctx, env, authCfg, n.DSN(), dryRun(drainer, opts.DryRun), publicPaths...)
 	if err != nil {
 		return fmt.Errorf("failed to setup auth: %w", err)
 	}
 
 	s := &http.Server{
 		Addr:    address,
-		Handler: handler,
+		Handler: log.RequestID(handler),
+	}
+	if opts.GRPC {
+		// gRPC clients connect with HTTP/2 without TLS
+		s.Protocols = new(http.Protocols)
+		s.Protocols.SetHTTP1(true)
+		s.Protocols.SetUnencryptedHTTP2(true)
 	}
 
+	stopped := make(chan struct{})
 	context.AfterFunc(ctx, func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		_ = s.Shutdown(ctx)
+		defer close(stopped)
+		shutdown(s, drainer, sessionManager, cancelServe, opts.DrainTimeout)
 	})
 
 	log.Infof(ctx, "Starting server on http://%s\n", address)
 	err = s.ListenAndServe()
 	if errors.Is(err, http.ErrServerClosed) {
+		// Wait for the sessions to be stored and the MCP servers to exit
+		<-stopped
 		return nil
 	}
 	log.Debugf(ctx, "Server stopped: %v", err)
 	return err
 }
+
+// shutdown waits up to drainTimeout for the requests in flight to finish while new sessions are
+// rejected, then stops the server, stores the sessions, and stops the MCP servers they started.
+func shutdown(s *http.Server, drainer *drain.Handler, sessionManager *session.Manager, cancelServe context.CancelFunc, drainTimeout time.Duration) {
+	ctx := context.Background()
+
+	if inflight := drainer.InFlight(); inflight > 0 {
+		log.Infof(ctx, "Shutting down, waiting up to %s for %d requests in flight", drainTimeout, inflight)
+	}
+	drainCtx, cancel := context.WithTimeout(ctx, drainTimeout)
+	if err := drainer.Drain(drainCtx); err != nil {
+		log.Errorf(ctx, "Canceling %d requests still in flight after %s", drainer.InFlight(), drainTimeout)
+	}
+	cancel()
+	cancelServe()
+
+	// Event streams stay open until the client disconnects, so they are closed after a short wait
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		_ = s.Close()
+	}
+	cancel()
+
+	stopCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := sessionManager.Shutdown(stopCtx); err != nil {
+		log.Errorf(ctx, "Failed to store sessions on shutdown: %v", err)
+	}
+	if err := mcp.WaitForProcesses(stopCtx); err != nil {
+		log.Errorf(ctx, "MCP servers did not exit on shutdown: %v", err)
+	}
+}
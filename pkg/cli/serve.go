@@ -6,12 +6,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/nanobot-ai/nanobot/pkg/config"
 	"github.com/nanobot-ai/nanobot/pkg/confirm"
+	"github.com/nanobot-ai/nanobot/pkg/log"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
 	"github.com/nanobot-ai/nanobot/pkg/printer"
 	"github.com/nanobot-ai/nanobot/pkg/runtime"
+	"github.com/nanobot-ai/nanobot/pkg/tui"
 	"github.com/nanobot-ai/nanobot/pkg/types"
 	"github.com/spf13/cobra"
 )
@@ -20,7 +25,16 @@ type Run struct {
 	ListenAddress string   `usage:"Address to listen on" default:"localhost:8080" short:"a"`
 	DisableUI     bool     `usage:"Disable the UI"`
 	HealthzPath   string   `usage:"Path to serve healthz on"`
+	MetricsPath   string   `usage:"Path to serve Prometheus metrics on (e.g. /metrics), unset disables metrics"`
 	Roots         []string `usage:"Roots to expose the MCP server in the form of name:directory" short:"r"`
+	Watch         bool     `usage:"Reload the config when the local config files, or the files they include or extend, change, without restarting sessions"`
+	DryRun        bool     `usage:"Return the tool calls agents plan to make instead of running them, for all requests"`
+	GRPC          bool     `usage:"Serve the gRPC API on the listen address, over HTTP/2 without TLS"`
+	OpenAIAPI     bool     `usage:"Serve an OpenAI compatible chat completions API at /v1/chat/completions with the agents as models"`
+	A2A           bool     `usage:"Serve the agents with the A2A protocol, with agent cards at /.well-known/agent-card.json and /a2a/{agent}/.well-known/agent-card.json"`
+	DrainTimeout  string   `usage:"How long requests in flight are given to finish on shutdown before they are canceled" default:"30s"`
+	Profile       []string `usage:"Profiles of the config to merge onto it, in order, a name ending in ? is skipped if the config does not define it" short:"p"`
+	TUI           bool     `usage:"Chat with the agents in the terminal instead of serving the UI, logs are written to nanobot/tui.log in the user cache directory" name:"tui"`
 	n             *Nanobot
 }
 
@@ -42,6 +56,16 @@ func (r *Run) Customize(cmd *cobra.Command) {
 
   # Run the nanobot.yaml at the URL
   nanobot run https://....
+
+  # Chat with the agents of the nanobot.yaml in the current directory in the terminal
+  nanobot run --tui .
+
+  # Run the nanobot.yaml at the URL only if its content has the digest
+  nanobot run https://example.com/nanobot.yaml#sha256=<hex>
+
+  # Run the config pushed to a registry with oras push ghcr.io/example/agent:v1 nanobot.yaml, checking
+  # that it was signed with cosign sign --key cosign.key ghcr.io/example/agent:v1
+  nanobot run --config-key cosign.pub oci://ghcr.io/example/agent:v1
 `
 }
 
@@ -101,6 +125,7 @@ func (r *Run) Run(cmd *cobra.Command, args []string) (err error) {
 		Roots:           roots,
 		MaxConcurrency:  r.n.MaxConcurrency,
 		CallbackHandler: callbackHandler,
+		Profiles:        r.Profile,
 	}
 
 	cfgPath := "nanobot.default"
@@ -111,7 +136,7 @@ func (r *Run) Run(cmd *cobra.Command, args []string) (err error) {
 	cfgFactory := types.ConfigFactory(func(ctx context.Context, profiles string) (types.Config, error) {
 		optCopy := runtimeOpt
 		if profiles != "" {
-			optCopy.Profiles = append(optCopy.Profiles, strings.Split(profiles, ",")...)
+			optCopy.Profiles = slices.Concat(optCopy.Profiles, strings.Split(profiles, ","))
 		}
 		cfg, err := r.n.ReadConfig(cmd.Context(), cfgPath, optCopy)
 		if err != nil {
@@ -120,13 +145,38 @@ func (r *Run) Run(cmd *cobra.Command, args []string) (err error) {
 		return *cfg, nil
 	})
 
+	if r.Watch {
+		watcher, err := config.NewWatcher(cmd.Context(), cfgPath, cfgFactory)
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+		cfgFactory = watcher.Load
+	}
+
 	once, err := cfgFactory(cmd.Context(), "")
 	if err != nil {
 		return fmt.Errorf("failed to read config file %q: %w", args[0], err)
 	}
 
-	cfg, _ := json.MarshalIndent(once, "", "  ")
-	printer.Prefix("config", string(cfg))
+	if r.TUI {
+		return r.runTUI(cmd.Context(), once, runtimeOpt)
+	}
+
+	if err := r.n.setupLogging(once.Logging); err != nil {
+		return err
+	}
+	defer log.Close()
+
+	if !log.Structured() {
+		cfg, _ := json.MarshalIndent(once, "", "  ")
+		printer.Prefix("config", string(cfg))
+	}
+
+	drainTimeout, err := time.ParseDuration(r.DrainTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid drain-timeout %q: %w", r.DrainTimeout, err)
+	}
 
 	runtime, err := r.n.GetRuntime(runtimeOpt, runtime.Options{
 		OAuthRedirectURL: "http://" + strings.Replace(r.ListenAddress, "127.0.0.1", "localhost", 1) + "/oauth/callback",
@@ -136,5 +186,56 @@ func (r *Run) Run(cmd *cobra.Command, args []string) (err error) {
 		return err
 	}
 
-	return r.n.runMCP(cmd.Context(), cfgFactory, runtime, callbackHandler, r.ListenAddress, r.HealthzPath, !r.DisableUI)
+	return r.n.runMCP(cmd.Context(), cfgFactory, runtime, mcpOptions{
+		OAuthCallback: callbackHandler,
+		ListenAddress: r.ListenAddress,
+		HealthzPath:   r.HealthzPath,
+		MetricsPath:   r.MetricsPath,
+		UI:            !r.DisableUI,
+		DryRun:        r.DryRun,
+		GRPC:          r.GRPC,
+		OpenAIAPI:     r.OpenAIAPI,
+		A2A:           r.A2A,
+		DrainTimeout:  drainTimeout,
+	})
+}
+
+func (r *Run) runTUI(ctx context.Context, cfg types.Config, runtimeOpt runtime.Options) error {
+	logDir, err := os.UserCacheDir()
+	if err != nil {
+		logDir = os.TempDir()
+	}
+	logFile := filepath.Join(logDir, "nanobot", "tui.log")
+	if err := os.MkdirAll(filepath.Dir(logFile), 0o700); err != nil {
+		return fmt.Errorf("failed to create directory of %s: %w", logFile, err)
+	}
+	f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", logFile, err)
+	}
+	defer f.Close()
+
+	// Output of MCP servers and logs would draw over the TUI
+	printer.SetOutput(f)
+	defer printer.SetOutput(os.Stderr)
+
+	oauthOpts, err := localOAuth(ctx)
+	if err != nil {
+		return err
+	}
+	rt, err := r.n.GetRuntime(runtimeOpt, runtime.Options{
+		DSN: r.n.DSN(),
+	}, oauthOpts)
+	if err != nil {
+		return err
+	}
+
+	env, err := r.n.loadEnv()
+	if err != nil {
+		return err
+	}
+
+	return tui.Run(ctx, cfg, rt, func(ctx context.Context, cfg *types.Config) context.Context {
+		return runtime.WithTempSession(ctx, cfg, env)
+	})
 }
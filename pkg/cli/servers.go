@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+type Servers struct {
+	n         *Nanobot
+	MCPServer []string `usage:"Specific MCP server name to connect to (default: all)" short:"s" name:"mcp-server"`
+	Timeout   string   `usage:"How long each MCP server has to start and initialize" default:"30s"`
+	Output    string   `usage:"Output format (json, yaml, table)" short:"o" default:"table"`
+}
+
+func NewServers(n *Nanobot) *Servers {
+	return &Servers{
+		n: n,
+	}
+}
+
+func (s *Servers) Customize(cmd *cobra.Command) {
+	cmd.Use = "servers [flags] [NANOBOT]"
+	cmd.Short = "Connect to the MCP servers of a nanobot and show the protocol version and capabilities each negotiated."
+	cmd.Args = cobra.MaximumNArgs(1)
+	cmd.Example = `
+  # Show the negotiated versions of the MCP servers of nanobot.yaml in the current directory
+  nanobot servers
+
+  # Show everything the github server answered initialize with
+  nanobot servers -s github -o json
+`
+}
+
+type serverStatus struct {
+	Name            string                  `json:"name"`
+	Transport       string                  `json:"transport,omitempty"`
+	ProtocolVersion string                  `json:"protocolVersion,omitempty"`
+	ServerInfo      mcp.ServerInfo          `json:"serverInfo,omitzero"`
+	Capabilities    *mcp.ServerCapabilities `json:"capabilities,omitempty"`
+	Error           string                  `json:"error,omitempty"`
+}
+
+func (s *Servers) Run(cmd *cobra.Command, args []string) error {
+	log.EnableMessages = false
+
+	timeout, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %q: %w", s.Timeout, err)
+	}
+
+	path := "."
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	oauthOpts, err := localOAuth(cmd.Context())
+	if err != nil {
+		return err
+	}
+	r, err := s.n.GetRuntime(runtime.Options{
+		DSN: s.n.DSN(),
+	}, oauthOpts)
+	if err != nil {
+		return err
+	}
+
+	c, err := s.n.ReadConfig(cmd.Context(), path)
+	if err != nil {
+		return err
+	}
+
+	env, err := s.n.loadEnv()
+	if err != nil {
+		return err
+	}
+
+	ctx := runtime.WithTempSession(cmd.Context(), c, env)
+
+	names := s.MCPServer
+	if len(names) == 0 {
+		names = slices.Sorted(maps.Keys(c.MCPServers))
+	}
+
+	var result []serverStatus
+	for _, name := range names {
+		if _, ok := c.MCPServers[name]; !ok {
+			return fmt.Errorf("MCP server %q not found in config", name)
+		}
+
+		status := serverStatus{
+			Name: name,
+		}
+
+		serverCtx, cancel := context.WithTimeout(ctx, timeout)
+		client, err := r.GetClient(serverCtx, name)
+		cancel()
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			initResult := client.Session.InitializeResult
+			status.Transport = client.Transport()
+			status.ProtocolVersion = initResult.ProtocolVersion
+			status.ServerInfo = initResult.ServerInfo
+			status.Capabilities = &initResult.Capabilities
+		}
+		result = append(result, status)
+	}
+
+	if display(result, s.Output) {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = tw.Write([]byte("SERVER\tTRANSPORT\tVERSION\tSERVER INFO\tCAPABILITIES\n"))
+	for _, status := range result {
+		if status.Error != "" {
+			_, _ = fmt.Fprintf(tw, "%s\t\t\t\terror: %s\n", status.Name, status.Error)
+			continue
+		}
+		serverInfo := strings.TrimSpace(status.ServerInfo.Name + " " + status.ServerInfo.Version)
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", status.Name, status.Transport, cmp.Or(status.ProtocolVersion, "-"),
+			cmp.Or(serverInfo, "-"), cmp.Or(capabilities(status.Capabilities), "none"))
+	}
+	return tw.Flush()
+}
+
+// capabilities returns the capabilities of a server in one line, listChanged and subscribe are given in
+// parentheses.
+func capabilities(c *mcp.ServerCapabilities) string {
+	var result []string
+	if c.Tools != nil {
+		result = append(result, withFeatures("tools", c.Tools.ListChanged, false))
+	}
+	if c.Prompts != nil {
+		result = append(result, withFeatures("prompts", c.Prompts.ListChanged, false))
+	}
+	if c.Resources != nil {
+		result = append(result, withFeatures("resources", c.Resources.ListChanged, c.Resources.Subscribe))
+	}
+	if c.Logging != nil {
+		result = append(result, "logging")
+	}
+	if len(c.Experimental) > 0 {
+		result = append(result, "experimental")
+	}
+	return strings.Join(result, ", ")
+}
+
+func withFeatures(name string, listChanged, subscribe bool) string {
+	var features []string
+	if listChanged {
+		features = append(features, "listChanged")
+	}
+	if subscribe {
+		features = append(features, "subscribe")
+	}
+	if len(features) == 0 {
+		return name
+	}
+	return name + " (" + strings.Join(features, ", ") + ")"
+}
@@ -1,12 +1,24 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 	"text/tabwriter"
 	"time"
 
+	"github.com/nanobot-ai/nanobot/pkg/cmd"
+	"github.com/nanobot-ai/nanobot/pkg/experiments"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
 	"github.com/nanobot-ai/nanobot/pkg/session"
+	"github.com/nanobot-ai/nanobot/pkg/types"
 	"github.com/spf13/cobra"
+	"gorm.io/gorm"
 )
 
 type Sessions struct {
@@ -14,42 +26,355 @@ type Sessions struct {
 	Output  string `usage:"Output format (json, yaml, table)" short:"o" default:"table"`
 }
 
-func NewSessions(n *Nanobot) *Sessions {
-	return &Sessions{
+func NewSessions(n *Nanobot) *cobra.Command {
+	s := &Sessions{
 		Nanobot: n,
 	}
+	return cmd.Command(s,
+		&SessionsList{s: s},
+		&SessionsShow{s: s},
+		&SessionsDelete{s: s},
+		&SessionsExport{s: s},
+		&SessionsImport{s: s})
 }
 
 func (t *Sessions) Customize(cmd *cobra.Command) {
 	cmd.Use = "sessions [flags]"
-	cmd.Short = "List all existing sessions"
+	cmd.Short = "List, inspect, and delete existing sessions"
 	cmd.Aliases = []string{"session", "s"}
 	cmd.Args = cobra.NoArgs
 	cmd.Hidden = true
 }
 
-func (t *Sessions) Run(cmd *cobra.Command, args []string) error {
-	store, err := session.NewStoreFromDSN(t.Nanobot.DSN())
+func (t *Sessions) Run(cmd *cobra.Command, _ []string) error {
+	return t.list(cmd.Context())
+}
+
+func (t *Sessions) store() (*session.Store, error) {
+	return session.NewStoreFromDSN(t.Nanobot.DSN())
+}
+
+// find returns the single session matching the given ID or ID prefix. The special
+// value "last" refers to the most recently updated session.
+func (t *Sessions) find(ctx context.Context, store *session.Store, id string) (*session.Session, error) {
+	sessions, err := store.FindByPrefix(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("session %s not found", id)
+	} else if err != nil {
+		return nil, err
+	}
+	switch len(sessions) {
+	case 0:
+		return nil, fmt.Errorf("session %s not found", id)
+	case 1:
+		return &sessions[0], nil
+	default:
+		return nil, fmt.Errorf("session prefix %s is ambiguous, matches %d sessions", id, len(sessions))
+	}
+}
+
+func (t *Sessions) list(ctx context.Context) error {
+	store, err := t.store()
 	if err != nil {
 		return err
 	}
 
-	sessions, err := store.List(cmd.Context())
+	sessions, err := store.List(ctx)
 	if err != nil {
 		return err
 	}
 
+	if display(sessions, t.Output) {
+		return nil
+	}
+
 	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	_, err = tw.Write([]byte("ID\tDATE\tACCT\tDESCRIPTION\n"))
+	_, err = tw.Write([]byte("ID\tDATE\tEXPIRES\tACCT\tDESCRIPTION\n"))
 	if err != nil {
 		return err
 	}
 
 	for _, session := range sessions {
+		expires := "never"
+		if session.ExpiresAt != nil {
+			expires = session.ExpiresAt.Format(time.RFC3339)
+		}
 		_, _ = tw.Write([]byte(session.SessionID + "\t" + session.UpdatedAt.Format(time.RFC3339) +
+			"\t" + expires +
 			"\t" + trim(session.AccountID) +
 			"\t" + trim(session.Description) + "\n"))
 	}
 
 	return tw.Flush()
 }
+
+type SessionsList struct {
+	s *Sessions
+}
+
+func (l *SessionsList) Customize(cmd *cobra.Command) {
+	cmd.Use = "list [flags]"
+	cmd.Short = "List all existing sessions"
+	cmd.Aliases = []string{"ls"}
+	cmd.Args = cobra.NoArgs
+}
+
+func (l *SessionsList) Run(cmd *cobra.Command, _ []string) error {
+	return l.s.list(cmd.Context())
+}
+
+type SessionsShow struct {
+	s *Sessions
+}
+
+func (s *SessionsShow) Customize(cmd *cobra.Command) {
+	cmd.Use = "show [flags] SESSION_ID"
+	cmd.Short = "Show the config, env, and agent state of a session"
+	cmd.Args = cobra.ExactArgs(1)
+	cmd.Example = `
+  # Show the most recently used session
+  nanobot sessions show last
+`
+}
+
+type sessionDetails struct {
+	ID           string            `json:"id"`
+	Type         string            `json:"type,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	AccountID    string            `json:"accountID,omitempty"`
+	Workspace    string            `json:"workspace,omitempty"`
+	Created      time.Time         `json:"created"`
+	Updated      time.Time         `json:"updated"`
+	Expires      *time.Time        `json:"expires,omitempty"`
+	Cwd          string            `json:"cwd,omitempty"`
+	Public       bool              `json:"public"`
+	CurrentAgent string            `json:"currentAgent,omitempty"`
+	Experiments  map[string]string `json:"experiments,omitempty"`
+	Env          map[string]string `json:"env,omitempty"`
+	Attributes   []string          `json:"attributes,omitempty"`
+	Config       types.Config      `json:"config"`
+}
+
+func toSessionDetails(s *session.Session) sessionDetails {
+	details := sessionDetails{
+		ID:          s.SessionID,
+		Type:        s.Type,
+		Description: s.Description,
+		AccountID:   s.AccountID,
+		Workspace:   s.Workspace,
+		Created:     s.CreatedAt,
+		Updated:     s.UpdatedAt,
+		Expires:     s.ExpiresAt,
+		Cwd:         s.Cwd,
+		Public:      s.IsPublic,
+		Attributes:  slices.Sorted(maps.Keys(s.State.Attributes)),
+		Config:      types.Config(s.Config),
+	}
+
+	details.CurrentAgent, _ = s.State.Attributes[types.CurrentAgentSessionKey].(string)
+
+	if assignments, err := experiments.FromAttributes(s.State.Attributes); err == nil {
+		for name, assignment := range assignments {
+			if details.Experiments == nil {
+				details.Experiments = map[string]string{}
+			}
+			details.Experiments[name] = assignment.Variant + " (" + assignment.Agent + ")"
+		}
+	}
+
+	var env map[string]string
+	if err := mcp.JSONCoerce(s.State.Attributes[mcp.SessionEnvMapKey], &env); err == nil && len(env) > 0 {
+		// Only the names are shown, values are often secrets.
+		details.Env = make(map[string]string, len(env))
+		for k := range env {
+			details.Env[k] = "********"
+		}
+	}
+
+	return details
+}
+
+func (s *SessionsShow) Run(cmd *cobra.Command, args []string) error {
+	store, err := s.s.store()
+	if err != nil {
+		return err
+	}
+
+	stored, err := s.s.find(cmd.Context(), store, args[0])
+	if err != nil {
+		return err
+	}
+
+	details := toSessionDetails(stored)
+	if !display(details, s.s.Output) {
+		// There is no meaningful table for a single session, so default to yaml.
+		display(details, "yaml")
+	}
+	return nil
+}
+
+type SessionsDelete struct {
+	s *Sessions
+}
+
+func (d *SessionsDelete) Customize(cmd *cobra.Command) {
+	cmd.Use = "delete [flags] SESSION_ID..."
+	cmd.Short = "Delete one or more sessions"
+	cmd.Aliases = []string{"rm"}
+	cmd.Args = cobra.MinimumNArgs(1)
+}
+
+func (d *SessionsDelete) Run(cmd *cobra.Command, args []string) error {
+	store, err := d.s.store()
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range args {
+		stored, err := d.s.find(cmd.Context(), store, arg)
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(cmd.Context(), stored.SessionID); err != nil {
+			return fmt.Errorf("failed to delete session %s: %w", stored.SessionID, err)
+		}
+		fmt.Println(stored.SessionID)
+	}
+
+	return nil
+}
+
+type SessionsExport struct {
+	s       *Sessions
+	File    string `usage:"File to write the exported session to (default: stdout)" short:"f"`
+	Archive bool   `usage:"Export the full state of the session, with its memories and working directory, as a tar archive that sessions import reads, implied by a file ending in .tar"`
+}
+
+func (e *SessionsExport) Customize(cmd *cobra.Command) {
+	cmd.Use = "export [flags] SESSION_ID"
+	cmd.Short = "Export a session and its transcript as JSON, or its full state as an archive"
+	cmd.Args = cobra.ExactArgs(1)
+	cmd.Example = `
+  # Export the most recently used session to a file
+  nanobot sessions export last -f session.json
+
+  # Archive a session to move it to another nanobot
+  nanobot sessions export 0b6f5c2e -f session.tar
+`
+}
+
+type sessionExport struct {
+	sessionDetails
+	Messages []types.Message `json:"messages,omitempty"`
+}
+
+func (e *SessionsExport) Run(cmd *cobra.Command, args []string) error {
+	store, err := e.s.store()
+	if err != nil {
+		return err
+	}
+
+	stored, err := e.s.find(cmd.Context(), store, args[0])
+	if err != nil {
+		return err
+	}
+
+	if e.File == "" && strings.HasSuffix(e.s.Output, ".tar") {
+		// -o of sessions is the output format, it is also accepted as the name of the archive
+		e.File = e.s.Output
+	}
+	if e.Archive || strings.HasSuffix(e.File, ".tar") {
+		return e.archive(cmd.Context(), store, stored)
+	}
+
+	export := sessionExport{
+		sessionDetails: toSessionDetails(stored),
+	}
+	export.Messages, err = stored.Transcript()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if e.File == "" || e.File == "-" {
+		fmt.Println(string(data))
+		return nil
+	}
+
+	return os.WriteFile(e.File, append(data, '\n'), 0o600)
+}
+
+func (e *SessionsExport) archive(ctx context.Context, store *session.Store, stored *session.Session) error {
+	if e.File == "" || e.File == "-" {
+		_, err := store.Export(ctx, os.Stdout, stored)
+		return err
+	}
+
+	f, err := os.OpenFile(e.File, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	manifest, err := store.Export(ctx, f, stored)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(e.File)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported session %s with %d memories and %d files to %s\n", manifest.SessionID, manifest.Memories, manifest.Files, e.File)
+	return nil
+}
+
+type SessionsImport struct {
+	Config string `usage:"Nanobot config the session working directory is read from, the files are extracted to the default directory without it"`
+	s      *Sessions
+}
+
+func (i *SessionsImport) Customize(cmd *cobra.Command) {
+	cmd.Use = "import [flags] FILE"
+	cmd.Short = "Import a session archived with sessions export, - reads it from stdin"
+	cmd.Args = cobra.ExactArgs(1)
+	cmd.Example = `
+  # Move a session from another nanobot, extracting its files to the working directory of ./nanobot.yaml
+  nanobot sessions import --config . session.tar
+`
+}
+
+func (i *SessionsImport) Run(cmd *cobra.Command, args []string) error {
+	store, err := i.s.store()
+	if err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if args[0] != "-" {
+		in, err = os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+
+	var target *types.Workdir
+	if i.Config != "" {
+		cfg, err := i.s.Nanobot.ReadConfig(cmd.Context(), i.Config)
+		if err != nil {
+			return err
+		}
+		target = cfg.Session.GetWorkdir()
+	}
+
+	stored, manifest, err := store.Import(cmd.Context(), in, target)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Imported session with %d memories and %d files\n", manifest.Memories, manifest.Files)
+	fmt.Println(stored.SessionID)
+	return nil
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/events"
+	"github.com/spf13/cobra"
+)
+
+type Tail struct {
+	Session string `usage:"Only show the events of this session"`
+	Type    string `usage:"Only show events of these comma separated types (provider_request, provider_response, retry, fallback, tool_call, tool_result, guardrail)"`
+	Token   string `usage:"Bearer token to authenticate to the server with" env:"NANOBOT_TOKEN"`
+	Output  string `usage:"Output format (json, text)" short:"o" default:"text"`
+	n       *Nanobot
+}
+
+func NewTail(n *Nanobot) *Tail {
+	return &Tail{
+		n: n,
+	}
+}
+
+func (t *Tail) Customize(cmd *cobra.Command) {
+	cmd.Use = "tail [flags] [URL]"
+	cmd.Short = "Watch the debug events of a running nanobot."
+	cmd.Long = `Streams the provider requests, tool calls, retries, and guardrail decisions of a nanobot started with
+nanobot run as they happen. Users that are not admins only see the events of their sessions.`
+	cmd.Example = `
+  # Watch the nanobot running on localhost:8080
+  nanobot tail
+
+  # Watch the tool calls of one session of a remote nanobot
+  nanobot tail --session 0b5f... --type tool_call,tool_result https://nanobot.example.com
+`
+	cmd.Args = cobra.MaximumNArgs(1)
+}
+
+func (t *Tail) Run(cmd *cobra.Command, args []string) error {
+	if t.Output != "json" && t.Output != "text" {
+		return fmt.Errorf("invalid output format %q, must be json or text", t.Output)
+	}
+
+	base := "http://localhost:8080"
+	if len(args) > 0 {
+		base = args[0]
+	}
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+
+	query := url.Values{}
+	if t.Session != "" {
+		query.Set("session", t.Session)
+	}
+	if t.Type != "" {
+		query.Set("type", t.Type)
+	}
+	target := strings.TrimSuffix(base, "/") + events.Path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(cmd.Context(), http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", base, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to watch events of %s: %s", base, resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if t.Output == "json" {
+			fmt.Println(data)
+			continue
+		}
+		var event events.Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+		printEvent(event)
+	}
+	if err := scanner.Err(); err != nil && cmd.Context().Err() == nil {
+		return fmt.Errorf("failed to read events of %s: %w", base, err)
+	}
+	return nil
+}
+
+func printEvent(event events.Event) {
+	line := []string{event.Time.Local().Format(time.TimeOnly), event.Type}
+	if event.SessionID != "" {
+		line = append(line, "session="+event.SessionID)
+	}
+	if event.Agent != "" {
+		line = append(line, "agent="+event.Agent)
+	}
+	if len(event.Data) > 0 {
+		data, _ := json.Marshal(event.Data)
+		line = append(line, string(data))
+	}
+	if event.Message != "" {
+		line = append(line, strings.ReplaceAll(event.Message, "\n", " "))
+	}
+	_, _ = fmt.Fprintln(os.Stdout, strings.Join(line, " "))
+}
@@ -5,6 +5,7 @@ import (
 	"text/tabwriter"
 
 	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/runtime"
 	"github.com/nanobot-ai/nanobot/pkg/tools"
 	"github.com/spf13/cobra"
 )
@@ -35,7 +36,13 @@ func (t *Targets) Customize(cmd *cobra.Command) {
 
 func (t *Targets) Run(cmd *cobra.Command, args []string) error {
 	log.EnableMessages = false
-	r, err := t.n.GetRuntime()
+	oauthOpts, err := localOAuth(cmd.Context())
+	if err != nil {
+		return err
+	}
+	r, err := t.n.GetRuntime(runtime.Options{
+		DSN: t.n.DSN(),
+	}, oauthOpts)
 	if err != nil {
 		return err
 	}
@@ -50,7 +57,7 @@ func (t *Targets) Run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	ctx := withTempSession(cmd.Context(), c, env)
+	ctx := runtime.WithTempSession(cmd.Context(), c, env)
 
 	tools, err := r.ListTools(ctx, tools.ListToolsOptions{
 		Servers: t.MCPServer,
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nanobot-ai/nanobot/pkg/session"
+	"github.com/nanobot-ai/nanobot/pkg/usage"
+	"github.com/spf13/cobra"
+)
+
+type Usage struct {
+	By      string `usage:"Break down the usage by day, agent, or model" default:"day"`
+	Since   string `usage:"Only include usage since this UTC day (YYYY-MM-DD)"`
+	Agent   string `usage:"Only include usage of this agent"`
+	Model   string `usage:"Only include usage of this model"`
+	Account string `usage:"Only include sessions of this account"`
+	Output  string `usage:"Output format (json, yaml, table)" short:"o" default:"table"`
+	n       *Nanobot
+}
+
+func NewUsage(n *Nanobot) *Usage {
+	return &Usage{
+		n: n,
+	}
+}
+
+func (u *Usage) Customize(cmd *cobra.Command) {
+	cmd.Use = "usage [flags]"
+	cmd.Short = "Show the tokens and cost used by sessions."
+	cmd.Example = `
+  # Show the cost per day
+  nanobot usage
+
+  # Show the cost per agent since the start of the month as JSON
+  nanobot usage --by agent --since 2025-06-01 -o json
+`
+	cmd.Args = cobra.NoArgs
+}
+
+func (u *Usage) Run(cmd *cobra.Command, _ []string) error {
+	var groupOf func(usage.Report) []usage.Group
+	switch u.By {
+	case "day":
+		groupOf = func(r usage.Report) []usage.Group { return r.ByDay }
+	case "agent":
+		groupOf = func(r usage.Report) []usage.Group { return r.ByAgent }
+	case "model":
+		groupOf = func(r usage.Report) []usage.Group { return r.ByModel }
+	default:
+		return fmt.Errorf("invalid --by %q, must be day, agent, or model", u.By)
+	}
+
+	store, err := session.NewStoreFromDSN(u.n.DSN())
+	if err != nil {
+		return err
+	}
+
+	report, err := usage.Load(cmd.Context(), store, u.Account, usage.Filter{
+		Since: u.Since,
+		Agent: u.Agent,
+		Model: u.Model,
+	})
+	if err != nil {
+		return err
+	}
+
+	if display(report, u.Output) {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "%s\tREQUESTS\tINPUT TOKENS\tOUTPUT TOKENS\tCOST (USD)\n", map[string]string{
+		"day":   "DAY",
+		"agent": "AGENT",
+		"model": "MODEL",
+	}[u.By])
+	for _, group := range groupOf(report) {
+		key := group.Key
+		if key == "" {
+			key = "-"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.4f\n", key, group.Requests, group.InputTokens, group.OutputTokens, group.CostUSD)
+	}
+	_, _ = fmt.Fprintf(tw, "TOTAL\t%d\t%d\t%d\t%.4f\n", report.Total.Requests, report.Total.InputTokens, report.Total.OutputTokens, report.Total.CostUSD)
+	return tw.Flush()
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/config"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+type Validate struct {
+	n       *Nanobot
+	Schema  bool     `usage:"Print the JSON Schema of nanobot.yaml instead of validating a config"`
+	Profile []string `usage:"Profiles of the config to merge onto it before validating, in order" short:"p"`
+	Output  string   `usage:"Output format (json, yaml, table)" short:"o" default:"table"`
+}
+
+func NewValidate(n *Nanobot) *Validate {
+	return &Validate{
+		n: n,
+	}
+}
+
+func (v *Validate) Customize(cmd *cobra.Command) {
+	cmd.Use = "validate [flags] [NANOBOT]"
+	cmd.Short = "Validate a nanobot config against its schema and the references between agents, tools, and servers."
+	cmd.Args = cobra.MaximumNArgs(1)
+	cmd.Example = `
+  # Validate nanobot.yaml in the current directory
+  nanobot validate
+
+  # Write the JSON Schema for editors, then add this comment to the top of nanobot.yaml
+  #   # yaml-language-server: $schema=./nanobot.schema.json
+  nanobot validate --schema > nanobot.schema.json
+`
+}
+
+func (v *Validate) Run(cmd *cobra.Command, args []string) error {
+	if v.Schema {
+		data, err := config.JSONSchema()
+		if err != nil {
+			return fmt.Errorf("failed to convert schema to JSON: %w", err)
+		}
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+
+	log.EnableMessages = false
+
+	path := "."
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	c, err := v.n.ReadConfig(cmd.Context(), path, runtime.Options{
+		Profiles: v.Profile,
+	})
+	if err == nil {
+		if !display(struct {
+			Valid bool `json:"valid"`
+		}{true}, v.Output) {
+			fmt.Printf("%s is valid: %d agents, %d MCP servers\n", path, len(c.Agents), len(c.MCPServers))
+		}
+		return nil
+	}
+
+	// Errors other than schema violations, like references to servers that are not defined, have
+	// no position
+	var (
+		validationErr *config.ValidationError
+		problems      []config.Problem
+	)
+	if errors.As(err, &validationErr) {
+		problems = validationErr.Problems
+	} else {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			problems = append(problems, config.Problem{
+				File:    path,
+				Message: line,
+			})
+		}
+	}
+
+	if display(struct {
+		Valid    bool             `json:"valid"`
+		Problems []config.Problem `json:"problems"`
+	}{false, problems}, v.Output) {
+		return fmt.Errorf("%s is not valid", path)
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/cmd"
+	"github.com/nanobot-ai/nanobot/pkg/wirelog"
+	"github.com/spf13/cobra"
+)
+
+type WireLog struct {
+	Nanobot *Nanobot
+	DSN     string `usage:"Database of the wire log, if the config sets its own dsn (default: the state database)" name:"dsn"`
+}
+
+func NewWireLog(n *Nanobot) *cobra.Command {
+	w := &WireLog{
+		Nanobot: n,
+	}
+	return cmd.Command(w,
+		&WireLogExport{w: w})
+}
+
+func (w *WireLog) Customize(cmd *cobra.Command) {
+	cmd.Use = "wirelog [flags]"
+	cmd.Short = "Export the requests and responses of completions recorded in the wire log"
+	cmd.Long = `The wire log records the full requests and responses of the completions of agents with wireLog: true,
+with the env of the session and secrets redacted.`
+	cmd.Args = cobra.NoArgs
+}
+
+func (w *WireLog) Run(cmd *cobra.Command, _ []string) error {
+	return cmd.Help()
+}
+
+type WireLogExport struct {
+	w       *WireLog
+	Agent   string `usage:"Only export completions of this agent"`
+	Session string `usage:"Only export completions of this session"`
+	Since   string `usage:"Only export completions since this time, a duration (24h), a UTC day (YYYY-MM-DD), or an RFC 3339 time"`
+	Until   string `usage:"Only export completions before this time, in the same formats as --since"`
+	File    string `usage:"File to write the completions to (default: stdout)" short:"f"`
+}
+
+func (e *WireLogExport) Customize(cmd *cobra.Command) {
+	cmd.Use = "export [flags]"
+	cmd.Short = "Export the completions of the wire log as JSONL"
+	cmd.Args = cobra.NoArgs
+	cmd.Example = `
+  # Export the completions of the support agent of the last day
+  nanobot wirelog export --agent support --since 24h -f support.jsonl
+`
+}
+
+func (e *WireLogExport) Run(cmd *cobra.Command, _ []string) error {
+	filter := wirelog.Filter{
+		Agent:     e.Agent,
+		SessionID: e.Session,
+	}
+	for _, t := range []struct {
+		value  string
+		target *time.Time
+	}{
+		{e.Since, &filter.Since},
+		{e.Until, &filter.Until},
+	} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := parseTime(t.value)
+		if err != nil {
+			return err
+		}
+		*t.target = parsed
+	}
+
+	dbOptions, err := e.w.Nanobot.DBOptions()
+	if err != nil {
+		return err
+	}
+	dsn := e.w.DSN
+	if dsn == "" {
+		dsn = e.w.Nanobot.DSN()
+	}
+	db, err := wirelog.New(wirelog.Options{
+		DSN:       dsn,
+		DBOptions: dbOptions,
+	}).Open(nil)
+	if err != nil {
+		return err
+	}
+
+	if e.File == "" || e.File == "-" {
+		_, err := wirelog.Export(cmd.Context(), db, filter, os.Stdout)
+		return err
+	}
+
+	out, err := os.OpenFile(e.File, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", e.File, err)
+	}
+	defer out.Close()
+
+	count, err := wirelog.Export(cmd.Context(), db, filter, out)
+	if err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", e.File, err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d completions to %s\n", count, e.File)
+	return nil
+}
@@ -0,0 +1,257 @@
+package codeexec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/mcp/container"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// Tool is the name of the tool agents run code with, and the target name of its tool mapping.
+const Tool = "exec"
+
+// SandboxCommand is the first argument nanobot is run with to start the process sandbox.
+const SandboxCommand = "_sandbox"
+
+// maxOutput limits the stdout and stderr returned to the model, the rest of the output is dropped.
+const maxOutput = 64 * 1024
+
+// codeDir is the directory in the scratch directory the code of the calls is written to.
+const codeDir = ".exec"
+
+var (
+	interpreters = map[string]string{
+		types.ExecPython: "python3",
+		types.ExecNode:   "node",
+		types.ExecShell:  "sh",
+	}
+	extensions = map[string]string{
+		types.ExecPython: ".py",
+		types.ExecNode:   ".js",
+		types.ExecShell:  ".sh",
+	}
+	containers container.Manager
+)
+
+// Args are the arguments of an exec tool call.
+type Args struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
+
+// Result is the output of the code.
+type Result struct {
+	ExitCode  int    `json:"exitCode"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	TimedOut  bool   `json:"timedOut,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// ToolMappings returns the exec tool of the agent if it has exec.
+func ToolMappings(agentName string, config *types.Exec) types.ToolMappings {
+	result := types.ToolMappings{}
+	if config == nil {
+		return result
+	}
+
+	languages, _ := json.Marshal(config.GetLanguages())
+	result[Tool] = types.TargetMapping[mcp.Tool]{
+		MCPServer:  agentName,
+		TargetName: Tool,
+		Target: mcp.Tool{
+			Name: Tool,
+			Description: fmt.Sprintf("Run code in a sandbox and return its exit code, stdout, and stderr. The working directory "+
+				"is a scratch directory that keeps its files between calls. The code has no network access unless enabled, "+
+				"and is stopped after %s.", config.GetTimeout()),
+			InputSchema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "language": {
+      "type": "string",
+      "enum": ` + string(languages) + `,
+      "description": "The language of the code, shell code is run by sh"
+    },
+    "code": {
+      "type": "string",
+      "description": "The code to run, output is read from stdout and stderr"
+    }
+  },
+  "required": ["language", "code"]
+}`),
+		},
+	}
+	return result
+}
+
+// Run runs the code in the sandbox of the config with dir, the scratch directory of the session, as its
+// working directory.
+func Run(ctx context.Context, config types.Exec, dir string, args Args) (*Result, error) {
+	if args.Code == "" {
+		return nil, fmt.Errorf("code is required")
+	}
+	if !slices.Contains(config.GetLanguages(), args.Language) {
+		return nil, fmt.Errorf("unsupported language %q, must be one of %s", args.Language, strings.Join(config.GetLanguages(), ", "))
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, codeDir), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create code directory: %w", err)
+	}
+	file := filepath.Join(dir, codeDir, uuid.String()+extensions[args.Language])
+	if err := os.WriteFile(file, []byte(args.Code), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write code: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(file)
+	}()
+
+	timeout := config.GetTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		cmd *exec.Cmd
+		err error
+	)
+	switch config.GetSandbox() {
+	case types.ExecSandboxProcess:
+		cmd, err = processCommand(ctx, config, dir, interpreters[args.Language], file)
+	default:
+		cmd, err = dockerCommand(ctx, config, dir, args.Language, file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		stdout = &limitedBuffer{limit: maxOutput}
+		stderr = &limitedBuffer{limit: maxOutput}
+	)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// The supervisor of the docker command stops the container when its stdin is closed
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin of %s: %w", args.Language, err)
+	}
+	defer stdin.Close()
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", args.Language, err)
+	}
+	err = cmd.Wait()
+
+	result := &Result{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.TimedOut = true
+		result.ExitCode = -1
+		return result, nil
+	}
+	if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", args.Language, err)
+	}
+	return result, nil
+}
+
+// Sandbox restricts the process with the spec in its arguments and then executes the command of the
+// arguments, it is run by nanobot started with SandboxCommand.
+func Sandbox() {
+	if err := sandbox(os.Args[2:]); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to start sandbox: %v\n", err)
+		os.Exit(126)
+	}
+}
+
+func dockerCommand(ctx context.Context, config types.Exec, dir, language, file string) (*exec.Cmd, error) {
+	opts := container.Options{
+		Image:    config.GetImage(language),
+		Command:  interpreters[language],
+		Args:     []string{file},
+		Env:      []string{"HOME=" + dir, "TMPDIR=/tmp"},
+		Mounts:   []string{dir},
+		Workdir:  dir,
+		User:     fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		Memory:   strconv.FormatUint(config.GetMaxMemory(), 10),
+		PIDs:     256,
+		ReadOnly: true,
+		Pull:     container.PullMissing,
+	}
+	if !config.Network {
+		opts.Network = "none"
+	}
+	cmd, err := containers.Command(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container for %s: %w", language, err)
+	}
+	return cmd, nil
+}
+
+// Format returns the result as the text of the tool call result.
+func Format(result *Result, timeout time.Duration) string {
+	var text strings.Builder
+	text.WriteString(result.Stdout)
+	if result.Stderr != "" {
+		if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+			text.WriteString("\n")
+		}
+		text.WriteString("[stderr]\n")
+		text.WriteString(result.Stderr)
+	}
+	if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+		text.WriteString("\n")
+	}
+	if result.Truncated {
+		fmt.Fprintf(&text, "[output truncated to %d bytes]\n", maxOutput)
+	}
+	if result.TimedOut {
+		fmt.Fprintf(&text, "[timed out after %s]", timeout)
+	} else {
+		fmt.Fprintf(&text, "[exit code %d]", result.ExitCode)
+	}
+	return text.String()
+}
+
+// limitedBuffer keeps the first limit bytes written to it.
+type limitedBuffer struct {
+	lock      sync.Mutex
+	data      []byte
+	limit     int
+	truncated bool
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if remaining := l.limit - len(l.data); remaining < len(p) {
+		l.data = append(l.data, p[:max(remaining, 0)]...)
+		l.truncated = true
+	} else {
+		l.data = append(l.data, p...)
+	}
+	return len(p), nil
+}
+
+func (l *limitedBuffer) String() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return string(l.data)
+}
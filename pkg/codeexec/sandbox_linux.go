@@ -0,0 +1,216 @@
+package codeexec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/nanobot-ai/nanobot/pkg/system"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"golang.org/x/sys/unix"
+)
+
+// The file system access rights landlock handles by its ABI version, the rights of a version include the
+// rights of the versions before it.
+const (
+	accessFSv1 = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR | unix.LANDLOCK_ACCESS_FS_MAKE_DIR | unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SOCK | unix.LANDLOCK_ACCESS_FS_MAKE_FIFO | unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM
+	accessFSv2 = accessFSv1 | unix.LANDLOCK_ACCESS_FS_REFER
+	accessFSv3 = accessFSv2 | unix.LANDLOCK_ACCESS_FS_TRUNCATE
+
+	accessRead     = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR
+	accessReadFile = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_READ_FILE
+	accessDevice   = unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE
+)
+
+var (
+	// systemDirs are readable in the process sandbox, so that interpreters find their libraries.
+	systemDirs = []string{"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/etc", "/opt", "/nix/store"}
+	// procFiles are the files of /proc that are readable, /proc/self is the process of the interpreter. The
+	// processes of nanobot and others would otherwise show their command lines and environment.
+	procFiles = []string{"/proc/self", "/proc/cpuinfo", "/proc/meminfo", "/proc/stat"}
+	devices   = []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"}
+)
+
+// sandboxSpec is what the process sandbox restricts the code to, it is passed to the sandbox as JSON.
+type sandboxSpec struct {
+	Dir       string   `json:"dir"`
+	Read      []string `json:"read,omitempty"`
+	MaxMemory uint64   `json:"maxMemory,omitempty"`
+	Network   bool     `json:"network,omitempty"`
+}
+
+func processCommand(ctx context.Context, config types.Exec, dir, interpreter, file string) (*exec.Cmd, error) {
+	path, err := exec.LookPath(interpreter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s for the process sandbox: %w", interpreter, err)
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", interpreter, err)
+	}
+
+	spec, err := json.Marshal(sandboxSpec{
+		Dir: dir,
+		// Interpreters installed outside the system directories keep their libraries next to their bin directory
+		Read:      slices.Concat(systemDirs, procFiles, []string{filepath.Dir(filepath.Dir(path))}),
+		MaxMemory: config.GetMaxMemory(),
+		Network:   config.Network,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, system.Bin(), SandboxCommand, string(spec), path, file)
+	cmd.Dir = dir
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"LANG=C.UTF-8",
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+	cmd.Cancel = func() error {
+		// Kill the processes the code started too
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	return cmd, nil
+}
+
+func sandbox(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: %s SPEC COMMAND [ARG...]", SandboxCommand)
+	}
+
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(args[0]), &spec); err != nil {
+		return fmt.Errorf("failed to parse sandbox spec: %w", err)
+	}
+
+	// Landlock and no_new_privs apply to the thread, which is the one that executes the command
+	runtime.LockOSThread()
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+	if spec.MaxMemory > 0 {
+		// RLIMIT_AS would count the address space runtimes like V8 reserve without using it
+		if err := unix.Setrlimit(unix.RLIMIT_DATA, &unix.Rlimit{Cur: spec.MaxMemory, Max: spec.MaxMemory}); err != nil {
+			return fmt.Errorf("failed to limit memory: %w", err)
+		}
+	}
+	if err := restrict(spec); err != nil {
+		return err
+	}
+	if err := filterSyscalls(spec); err != nil {
+		return err
+	}
+
+	return unix.Exec(args[1], args[1:], os.Environ())
+}
+
+// restrict allows the thread to read the system directories and to change the files of the scratch
+// directory, and to connect to the network if the spec allows it. Kernels with landlock ABI 6 also keep
+// it from signaling processes outside of the sandbox.
+func restrict(spec sandboxSpec) error {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return fmt.Errorf("the process sandbox requires landlock, which is not enabled in the kernel: %w", errno)
+	}
+
+	attr := unix.LandlockRulesetAttr{}
+	switch {
+	case abi >= 3:
+		attr.Access_fs = accessFSv3
+	case abi == 2:
+		attr.Access_fs = accessFSv2
+	default:
+		attr.Access_fs = accessFSv1
+	}
+	if !spec.Network {
+		if abi < 4 {
+			return fmt.Errorf("the kernel does not support restricting the network of the process sandbox (landlock ABI %d < 4), "+
+				"enable the network of exec or use the docker sandbox", abi)
+		}
+		attr.Access_net = unix.LANDLOCK_ACCESS_NET_BIND_TCP | unix.LANDLOCK_ACCESS_NET_CONNECT_TCP
+	}
+	size := unsafe.Offsetof(attr.Scoped)
+	if abi >= 6 {
+		attr.Scoped = unix.LANDLOCK_SCOPE_SIGNAL | unix.LANDLOCK_SCOPE_ABSTRACT_UNIX_SOCKET
+		size = unsafe.Sizeof(attr)
+	}
+
+	ruleset, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), size, 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to create landlock ruleset: %w", errno)
+	}
+	defer unix.Close(int(ruleset))
+
+	for _, dir := range spec.Read {
+		if err := allow(int(ruleset), dir, accessRead&attr.Access_fs, accessReadFile&attr.Access_fs); err != nil {
+			return err
+		}
+	}
+	for _, device := range devices {
+		if err := allow(int(ruleset), device, 0, accessDevice&attr.Access_fs); err != nil {
+			return err
+		}
+	}
+	if err := allow(int(ruleset), spec.Dir, attr.Access_fs, 0); err != nil {
+		return err
+	}
+
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, ruleset, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to restrict the sandbox: %w", errno)
+	}
+	return nil
+}
+
+// allow adds the access to the path, dirAccess if it is a directory, or fileAccess if it is a file. Paths
+// that do not exist are skipped.
+func allow(ruleset int, path string, dirAccess, fileAccess uint64) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+
+	access := fileAccess
+	if info.IsDir() {
+		access = dirAccess
+	}
+	if access == 0 {
+		return nil
+	}
+
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer unix.Close(fd)
+
+	rule := unix.LandlockPathBeneathAttr{
+		Allowed_access: access,
+		Parent_fd:      int32(fd),
+	}
+	if _, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH,
+		uintptr(unsafe.Pointer(&rule)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to allow access to %s: %w", path, errno)
+	}
+	return nil
+}
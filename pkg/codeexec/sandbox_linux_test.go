@@ -0,0 +1,147 @@
+package codeexec
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func TestMain(m *testing.M) {
+	// The process sandbox runs the test binary to restrict itself before it executes the interpreter
+	if len(os.Args) > 2 && os.Args[1] == SandboxCommand {
+		Sandbox()
+	}
+	os.Exit(m.Run())
+}
+
+func TestProcessSandbox(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+
+	outside := filepath.Join(t.TempDir(), "outside")
+	if err := os.WriteFile(outside, []byte("outside"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		language string
+		code     string
+		network  bool
+		stdout   string
+		failed   bool
+	}{
+		{
+			name:     "writes the scratch directory",
+			language: types.ExecShell,
+			code:     "echo hello > file && cat file",
+			stdout:   "hello\n",
+		},
+		{
+			name:     "reads system directories",
+			language: types.ExecShell,
+			code:     "test -r /etc/passwd && echo ok",
+			stdout:   "ok\n",
+		},
+		{
+			name:     "does not read other files",
+			language: types.ExecShell,
+			code:     "cat " + outside,
+			failed:   true,
+		},
+		{
+			name:     "does not write outside the scratch directory",
+			language: types.ExecShell,
+			code:     "echo hello > " + outside,
+			failed:   true,
+		},
+		{
+			name:     "reads its own process",
+			language: types.ExecPython,
+			code:     "print(open('/proc/self/status').read().startswith('Name:'))",
+			stdout:   "True\n",
+		},
+		{
+			name:     "does not read other processes",
+			language: types.ExecPython,
+			code:     "import os\nopen('/proc/%d/cmdline' % os.getppid()).read()",
+			failed:   true,
+		},
+		{
+			name:     "does not signal nanobot",
+			language: types.ExecPython,
+			code:     "import os, signal\nos.kill(os.getppid(), signal.SIGTERM)",
+			failed:   true,
+		},
+		{
+			name:     "does not signal all processes",
+			language: types.ExecPython,
+			code:     "import os, signal\nos.kill(-1, signal.SIGTERM)",
+			failed:   true,
+		},
+		{
+			name:     "does not open unix sockets",
+			language: types.ExecPython,
+			code:     "import socket\nsocket.socket(socket.AF_UNIX).connect('/var/run/docker.sock')",
+			network:  true,
+			failed:   true,
+		},
+		{
+			name:     "does not open UDP sockets without network",
+			language: types.ExecPython,
+			code:     "import socket\nsocket.socket(socket.AF_INET, socket.SOCK_DGRAM)",
+			failed:   true,
+		},
+		{
+			name:     "does not set up io_uring",
+			language: types.ExecPython,
+			code: "import ctypes, os\nlibc = ctypes.CDLL(None, use_errno=True)\nparams = ctypes.create_string_buffer(120)\n" +
+				"if libc.syscall(425, 8, params) < 0:\n    raise OSError(ctypes.get_errno(), 'io_uring_setup')",
+			network: true,
+			failed:  true,
+		},
+		{
+			name:     "opens unix socket pairs",
+			language: types.ExecPython,
+			code:     "import socket\na, b = socket.socketpair()\na.send(b'ok')\nprint(b.recv(2).decode())",
+			stdout:   "ok\n",
+		},
+		{
+			name:     "opens UDP sockets with network",
+			language: types.ExecPython,
+			code:     "import socket\nsocket.socket(socket.AF_INET, socket.SOCK_DGRAM)\nprint('ok')",
+			network:  true,
+			stdout:   "ok\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Run(context.Background(), types.Exec{
+				Sandbox: types.ExecSandboxProcess,
+				Network: tt.network,
+			}, t.TempDir(), Args{
+				Language: tt.language,
+				Code:     tt.code,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.ExitCode == 126 && (strings.Contains(result.Stderr, "requires landlock") ||
+				strings.Contains(result.Stderr, "does not support restricting the network")) {
+				t.Skip("the kernel does not support the process sandbox: " + result.Stderr)
+			}
+			if failed := result.ExitCode != 0; failed != tt.failed {
+				t.Fatalf("expected failed %v, got exit code %d: %s", tt.failed, result.ExitCode, result.Stderr)
+			}
+			if !tt.failed && result.Stdout != tt.stdout {
+				t.Errorf("expected stdout %q, got %q", tt.stdout, result.Stdout)
+			}
+		})
+	}
+}
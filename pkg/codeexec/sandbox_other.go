@@ -0,0 +1,20 @@
+//go:build !linux
+
+package codeexec
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func processCommand(context.Context, types.Exec, string, string, string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("the process sandbox is not supported on %s, use the docker sandbox", runtime.GOOS)
+}
+
+func sandbox([]string) error {
+	return fmt.Errorf("the process sandbox is not supported on %s", runtime.GOOS)
+}
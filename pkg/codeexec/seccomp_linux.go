@@ -0,0 +1,135 @@
+package codeexec
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// auditArchs are the architectures the seccomp filter of the process sandbox knows the system calls of.
+var auditArchs = map[string]uint32{
+	"amd64": unix.AUDIT_ARCH_X86_64,
+	"arm64": unix.AUDIT_ARCH_AARCH64,
+}
+
+// The offsets of the fields of struct seccomp_data, the low 32 bits of the arguments on little endian.
+const (
+	seccompNr   = 0
+	seccompArch = 4
+	seccompArg0 = 16
+
+	// x32SyscallBit marks the system calls of the x32 ABI, which the filter would otherwise not match.
+	x32SyscallBit = 0x40000000
+)
+
+// denyRule fails the system call with EPERM if its first argument is one of the values, or always if
+// there are no values.
+type denyRule struct {
+	nr     uint32
+	values []uint32
+}
+
+// filterSyscalls installs a seccomp filter that keeps the thread from connecting to Unix sockets, like
+// docker.sock or the D-Bus of the user, from opening network sockets unless the spec allows it, and from
+// signaling nanobot, which landlock only prevents on newer kernels. io_uring is denied because its
+// socket and connect operations do not go through the system calls the filter checks.
+func filterSyscalls(spec sandboxSpec) error {
+	arch, ok := auditArchs[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("the process sandbox is not supported on linux/%s, use the docker sandbox", runtime.GOARCH)
+	}
+
+	var networkFamilies []uint32
+	if !spec.Network {
+		// Landlock only restricts TCP, this keeps the code from using UDP and raw sockets too
+		networkFamilies = []uint32{unix.AF_INET, unix.AF_INET6, unix.AF_PACKET}
+	}
+	families := append([]uint32{unix.AF_UNIX}, networkFamilies...)
+
+	parent := os.Getppid()
+	pids := []uint32{uint32(parent), uint32(0xffffffff)}
+	if pgid, err := syscall.Getpgid(parent); err == nil {
+		pids = append(pids, uint32(-pgid))
+	}
+
+	rules := []denyRule{
+		{nr: unix.SYS_SOCKET, values: families},
+		{nr: unix.SYS_IO_URING_SETUP},
+		{nr: unix.SYS_IO_URING_ENTER},
+		{nr: unix.SYS_IO_URING_REGISTER},
+		{nr: unix.SYS_KILL, values: pids},
+		{nr: unix.SYS_TKILL, values: []uint32{uint32(parent)}},
+		{nr: unix.SYS_TGKILL, values: []uint32{uint32(parent)}},
+		{nr: unix.SYS_RT_SIGQUEUEINFO, values: []uint32{uint32(parent)}},
+		{nr: unix.SYS_RT_TGSIGQUEUEINFO, values: []uint32{uint32(parent)}},
+		{nr: unix.SYS_PIDFD_OPEN, values: []uint32{uint32(parent)}},
+	}
+	if len(networkFamilies) > 0 {
+		// Pairs of Unix sockets are not connected to anything else, runtimes like asyncio use them
+		rules = append(rules, denyRule{nr: unix.SYS_SOCKETPAIR, values: networkFamilies})
+	}
+
+	prog := seccompProgram(arch, rules)
+	fprog := unix.SockFprog{
+		Len:    uint16(len(prog)),
+		Filter: &prog[0],
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER, 0, uintptr(unsafe.Pointer(&fprog))); errno != 0 {
+		return fmt.Errorf("failed to install the seccomp filter of the sandbox: %w", errno)
+	}
+	return nil
+}
+
+// seccompProgram returns a BPF program that kills the process for system calls of other architectures,
+// fails the system calls of the rules with EPERM for the values they deny, and allows the rest.
+func seccompProgram(arch uint32, rules []denyRule) []unix.SockFilter {
+	prog := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, arch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompNr),
+		jump(unix.BPF_JMP|unix.BPF_JSET|unix.BPF_K, x32SyscallBit, 0, 1),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+	}
+
+	for _, rule := range rules {
+		if len(rule.values) == 0 {
+			prog = append(prog,
+				stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompNr),
+				jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, rule.nr, 0, 1),
+				stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM)),
+			)
+			continue
+		}
+
+		n := uint8(len(rule.values))
+		prog = append(prog,
+			stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompNr),
+			// Skip to the next rule if this is another system call
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, rule.nr, 0, n+3),
+			stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompArg0),
+		)
+		for i, value := range rule.values {
+			// Jump over the remaining values and the allow to the deny
+			prog = append(prog, jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, value, n-uint8(i), 0))
+		}
+		prog = append(prog,
+			stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+			stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM)),
+		)
+	}
+
+	return append(prog, stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW))
+}
+
+func stmt(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+func jump(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
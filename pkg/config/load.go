@@ -22,7 +22,7 @@ func Load(ctx context.Context, path string, profiles ...string) (cfg *types.Conf
 			}
 		}
 	}()
-	configResource, err := resolve(path)
+	configResource, err := resolve(ctx, path)
 	if err != nil {
 		return nil, "", fmt.Errorf("error resolving config path %s: %w", path, err)
 	}
@@ -48,6 +48,11 @@ func loadResource(ctx context.Context, configResource *resource, profiles ...str
 		return nil, "", err
 	}
 
+	last, err = mergeIncludes(ctx, configResource, last, []string{configResource.key()})
+	if err != nil {
+		return nil, "", err
+	}
+
 	var lastParent *types.Config
 	for _, parentRef := range last.Extends {
 		parentResource, err := configResource.Rel(parentRef)
@@ -109,13 +114,205 @@ func loadResource(ctx context.Context, configResource *resource, profiles ...str
 	return &last, targetCwd, last.Validate(configResource.resourceType == "path")
 }
 
+// mergeIncludes merges cfg onto the files it includes. seen holds the keys of the configs that include
+// cfg, to detect cycles.
+func mergeIncludes(ctx context.Context, configResource *resource, cfg types.Config, seen []string) (types.Config, error) {
+	var included *types.Config
+	for _, ref := range cfg.Include {
+		includeResource, err := relInclude(configResource, ref)
+		if err != nil {
+			return cfg, fmt.Errorf("error resolving include %s: %w", ref, err)
+		}
+
+		if key := includeResource.key(); slices.Contains(seen, key) {
+			return cfg, fmt.Errorf("include cycle: %s includes %s again", configResource.file(), includeResource.file())
+		}
+
+		include, err := loadInclude(ctx, includeResource, append(seen, includeResource.key()))
+		if err != nil {
+			return cfg, fmt.Errorf("error loading include %s: %w", ref, err)
+		}
+
+		if included == nil {
+			included = &include
+		} else {
+			merged, err := Merge(*included, include)
+			if err != nil {
+				return cfg, fmt.Errorf("error merging include %s: %w", ref, err)
+			}
+			included = &merged
+		}
+	}
+
+	cfg.Include = nil
+	if included == nil {
+		return cfg, nil
+	}
+
+	merged, err := Merge(*included, cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("error merging includes of %s: %w", configResource.file(), err)
+	}
+	return merged, nil
+}
+
+// relInclude resolves an include of the config, absolute paths of local configs are used as is.
+func relInclude(configResource *resource, ref string) (*resource, error) {
+	if configResource.resourceType == "path" && filepath.IsAbs(ref) {
+		return &resource{
+			resourceType: "path",
+			url:          ref,
+		}, nil
+	}
+	return configResource.Rel(ref)
+}
+
+// localFiles returns the local files of the config at path, the configs it includes and the configs it
+// extends.
+func localFiles(ctx context.Context, path string) ([]string, error) {
+	configResource, err := resolve(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving config path %s: %w", path, err)
+	}
+
+	var (
+		files   []string
+		extends []string
+		seen    = map[string]bool{}
+	)
+	var walk func(r *resource) error
+	walk = func(r *resource) error {
+		if seen[r.key()] {
+			return nil
+		}
+		seen[r.key()] = true
+		if r.resourceType == "path" {
+			files = append(files, r.file())
+		}
+
+		cfg, err := r.Load(ctx)
+		if err != nil {
+			return err
+		}
+		extends = append(extends, cfg.Extends...)
+		for _, ref := range cfg.Include {
+			includeResource, err := relInclude(r, ref)
+			if err != nil {
+				return fmt.Errorf("error resolving include %s: %w", ref, err)
+			}
+			if err := walk(includeResource); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(configResource); err != nil {
+		return nil, err
+	}
+
+	// Parents are loaded without their includes and extends.
+	for _, ref := range extends {
+		parentResource, err := configResource.Rel(ref)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving extends %s: %w", ref, err)
+		}
+		if parentResource.resourceType == "path" && !seen[parentResource.key()] {
+			seen[parentResource.key()] = true
+			files = append(files, parentResource.file())
+		}
+	}
+	return files, nil
+}
+
+// loadInclude loads an included config with the files it includes. Its working directories and local
+// paths are made absolute relative to its directory, so the config including it does not change them.
+func loadInclude(ctx context.Context, includeResource *resource, seen []string) (types.Config, error) {
+	cfg, err := includeResource.Load(ctx)
+	if err != nil {
+		return cfg, err
+	}
+	if len(cfg.Extends) > 0 {
+		return cfg, fmt.Errorf("included config %s can not use extends, use include instead", includeResource.file())
+	}
+
+	cfg, err = mergeIncludes(ctx, includeResource, cfg, seen)
+	if err != nil {
+		return cfg, err
+	}
+
+	cwd, err := includeResource.Cwd()
+	if err != nil {
+		return cfg, fmt.Errorf("error determining working directory of %s: %w", includeResource.file(), err)
+	}
+	if includeResource.resourceType == "path" {
+		if cwd, err = filepath.Abs(cwd); err != nil {
+			return cfg, err
+		}
+	}
+
+	cfg = rewriteCwd(cfg, cwd)
+	return rewriteSourceReferences(cfg, includeResource)
+}
+
 func rewriteCwd(cfg types.Config, cwd string) types.Config {
 	newMCPServers := map[string]mcp.Server{}
 	for name, mcpServer := range cfg.MCPServers {
-		mcpServer.Cwd = filepath.Join(cwd, mcpServer.Cwd)
+		if !filepath.IsAbs(mcpServer.Cwd) {
+			mcpServer.Cwd = filepath.Join(cwd, mcpServer.Cwd)
+		}
 		newMCPServers[name] = mcpServer
 	}
 	cfg.MCPServers = newMCPServers
+
+	if len(cfg.Roots) > 0 {
+		newRoots := make(map[string]string, len(cfg.Roots))
+		for name, dir := range cfg.Roots {
+			if dir != "" && !filepath.IsAbs(dir) {
+				dir = filepath.Join(cwd, dir)
+				// Roots are sent to MCP servers as file URIs, which must be absolute
+				if abs, err := filepath.Abs(dir); err == nil {
+					dir = abs
+				}
+			}
+			newRoots[name] = dir
+		}
+		cfg.Roots = newRoots
+	}
+
+	if len(cfg.Profiles) > 0 {
+		newProfiles := make(map[string]types.Config, len(cfg.Profiles))
+		for name, profile := range cfg.Profiles {
+			newProfiles[name] = rewriteCwd(profile, cwd)
+		}
+		cfg.Profiles = newProfiles
+	}
+
+	newAgents := maps.Clone(cfg.Agents)
+	for name, agent := range cfg.Agents {
+		if agent.Knowledge == nil {
+			continue
+		}
+		knowledge := *agent.Knowledge
+		knowledge.Sources = make(types.StringList, 0, len(agent.Knowledge.Sources))
+		for _, source := range agent.Knowledge.Sources {
+			if !filepath.IsAbs(source) {
+				source = filepath.Join(cwd, source)
+			}
+			knowledge.Sources = append(knowledge.Sources, source)
+		}
+		agent.Knowledge = &knowledge
+		newAgents[name] = agent
+	}
+	cfg.Agents = newAgents
+
+	newTools := maps.Clone(cfg.Tools)
+	for name, tool := range cfg.Tools {
+		if tool.WASM != "" && !filepath.IsAbs(tool.WASM) {
+			tool.WASM = filepath.Join(cwd, tool.WASM)
+			newTools[name] = tool
+		}
+	}
+	cfg.Tools = newTools
 	return cfg
 }
 
@@ -9,7 +9,8 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
-func TestSchema(t *testing.T) {
+func compileSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
 	data, err := os.ReadFile("./schema.yaml")
 	if err != nil {
 		t.Fatalf("Failed to read schema file: %v", err)
@@ -29,10 +30,25 @@ func TestSchema(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to compile schema: %v", err)
 	}
+	return s
+}
+
+func TestSchema(t *testing.T) {
+	s := compileSchema(t)
 
 	obj := map[string]any{}
-	err = json.Unmarshal([]byte(`
+	err := json.Unmarshal([]byte(`
 {
+	"extends": "../base",
+	"include": ["./shared/servers.yaml", "/etc/nanobot/agents.yaml"],
+	"profiles": {
+		"prod": {
+			"agents": {
+				"agent1": {"model": "gpt-5"}
+			},
+			"session": {"ttl": "24h"}
+		}
+	},
 	"auth": {
 		"oauthClientId": "clientid",
 		"oauthClientSecret": "clientsecret",
@@ -42,7 +58,180 @@ func TestSchema(t *testing.T) {
 			"authorizationEndpoint": "http://localhost:8080/oauth/authorize",
 			"tokenEndpoint": "http://localhost:8080/oauth/token"
 		},
-		"encryptionKey": "encryptionkey"
+		"encryptionKey": "encryptionkey",
+		"apiKeys": [
+			{"name": "ci", "key": "${CI_API_KEY}", "agents": ["agent1"]},
+			{"name": "dashboard", "key": "${DASHBOARD_API_KEY}", "roles": ["viewer"]}
+		],
+		"jwt": {
+			"jwksURL": "https://auth.example.com/.well-known/jwks.json",
+			"issuer": "https://auth.example.com",
+			"audience": "nanobot",
+			"agentsClaim": "agents",
+			"rolesClaim": "roles"
+		},
+		"roles": {
+			"viewer": {"tools": ["server1/list_*", "search"]},
+			"operator": {"agents": ["agent1"], "tools": "server1/*"}
+		},
+		"defaultRoles": "viewer",
+		"admins": ["admin@example.com"]
+	},
+	"session": {
+		"ttl": "24h",
+		"workdir": {
+			"dir": "/var/lib/nanobot/sessions",
+			"quota": "500MB"
+		}
+	},
+	"limits": {
+		"tokensPerDay": 100000,
+		"requestsPerMinute": 60,
+		"maxCostUSD": 5
+	},
+	"pricing": {
+		"gpt-4.1": {
+			"inputPerMillion": 2,
+			"outputPerMillion": 8
+		}
+	},
+	"modelAliases": {
+		"fast": "claude-3-5-haiku-latest"
+	},
+	"retries": {
+		"anthropic": {
+			"maxAttempts": 3,
+			"initialBackoff": "500ms",
+			"maxBackoff": "10s",
+			"timeout": "2m"
+		},
+		"*": {"maxAttempts": 2}
+	},
+	"memoryStores": {
+		"vectors": {"type": "pgvector", "dsn": "postgres://localhost/nanobot"},
+		"qdrant": {"type": "qdrant", "url": "http://localhost:6333", "apiKey": "${QDRANT_API_KEY}", "collection": "memories"}
+	},
+	"tools": {
+		"wordcount": {
+			"description": "Count the words of a text",
+			"input": {
+				"fields": {
+					"text": "The text to count the words of"
+				}
+			},
+			"wasm": "./wordcount.wasm",
+			"env": {"LANG": "en"},
+			"timeout": "5s",
+			"maxMemory": "32MB"
+		},
+		"slugify": {
+			"description": "Turn a title into a slug",
+			"input": {
+				"fields": {
+					"title": "The title to slugify"
+				}
+			},
+			"script": "return title.toLowerCase().replace(/[^a-z0-9]+/g, '-');",
+			"language": "javascript"
+		}
+	},
+	"a2a": {
+		"researcher": {
+			"url": "https://agents.example.com/a2a/researcher",
+			"headers": {"Authorization": "Bearer ${RESEARCHER_TOKEN}"},
+			"description": "Research a topic on the web"
+		}
+	},
+	"middleware": ["log"],
+	"elicitation": {
+		"answers": [
+			{"server": "github", "tool": "create_issue", "action": "accept"},
+			{"message": "(?i)which repository", "content": {"repository": "nanobot-ai/nanobot"}}
+		],
+		"default": "cancel"
+	},
+	"roots": {
+		"project": ".",
+		"docs": "/usr/share/doc"
+	},
+	"timeouts": {"tool": "1m", "turn": "15m"},
+	"partials": {"tone": "Be concise and friendly."},
+	"providers": {
+		"corp-azure": {
+			"type": "azure",
+			"endpoint": "https://corp.openai.azure.com",
+			"apiVersion": "2025-04-01-preview",
+			"deployments": {"gpt-4.1": "gpt41-prod"},
+			"auth": "entra",
+			"tenantID": "${AZURE_TENANT_ID}"
+		},
+		"corp-bedrock": {"type": "bedrock", "region": "us-east-1", "deployments": {"claude": "us.anthropic.claude-sonnet-4-20250514-v1:0"}}
+	},
+	"toolConcurrency": 4,
+	"triggers": {
+		"daily-report": {
+			"cron": "0 9 * * *",
+			"agent": "agent1",
+			"prompt": "Summarize yesterday's activity",
+			"sinks": [
+				{"webhook": {"url": "https://example.com/hook", "headers": {"Authorization": "Bearer ${HOOK_TOKEN}"}}},
+				{"file": "reports.jsonl"},
+				{"email": {"smtp": "smtp.example.com:587", "from": "bot@example.com", "to": "team@example.com"}}
+			]
+		}
+	},
+	"webhooks": {
+		"github": {
+			"agent": "agent1",
+			"prompt": "Triage issue ${body.issue.title}",
+			"session": "${body.issue.number}",
+			"secret": "${GITHUB_WEBHOOK_SECRET}",
+			"async": true
+		}
+	},
+	"channels": {
+		"slack": {
+			"botToken": "${SLACK_BOT_TOKEN}",
+			"appToken": "${SLACK_APP_TOKEN}",
+			"agent": "agent1",
+			"commands": {
+				"/research": "agent1"
+			}
+		}
+	},
+	"experiments": {
+		"concise-prompt": {
+			"description": "Shorter instructions for agent1",
+			"agent": "agent1",
+			"variant": "agent1-concise",
+			"percent": 12.5
+		}
+	},
+	"workspaces": {
+		"research": {
+			"description": "The research team",
+			"users": ["alice@example.com", "bob"],
+			"env": {"SEARCH_API_KEY": "${vault:secret/research#search}"}
+		}
+	},
+	"logging": {
+		"format": "json",
+		"level": "info",
+		"components": {"mcp": "debug", "llm/anthropic": "warn"},
+		"sinks": [
+			{"type": "stdout"},
+			{"type": "file", "path": "/var/log/nanobot.log", "maxSize": 50, "maxFiles": 3}
+		]
+	},
+	"wireLog": {
+		"dsn": "postgres://wirelog",
+		"retention": "168h",
+		"maxEntries": 10000,
+		"redact": {
+			"env": true,
+			"secrets": false,
+			"patterns": {"ticket": "TICKET-[0-9]+"}
+		}
 	},
 	"mcpServers": {
 		"server1": {
@@ -55,6 +244,24 @@ func TestSchema(t *testing.T) {
 				"env2": "value2"
 			},
 			"image": "an image",
+			"runtime": "docker",
+			"container": {
+				"cpus": "0.5",
+				"memory": "512m",
+				"pids": 100,
+				"network": "bridge",
+				"readOnly": true,
+				"pull": "always"
+			},
+			"kubernetes": {
+				"namespace": "mcp",
+				"serviceAccount": "mcp-server",
+				"requests": {"cpu": "250m", "memory": "256Mi"},
+				"limits": {"memory": "512Mi"},
+				"nodeSelector": {"pool": "mcp"},
+				"connect": "service",
+				"pull": "never"
+			},
 			"dockerfile": "Dockerfile content",
 			"source": {
 				"repo": ".",
@@ -69,6 +276,48 @@ func TestSchema(t *testing.T) {
 			"reversePorts": [123,234],
 			"headers": {
 				"header1": "value1"
+			},
+			"toolCache": {
+				"search": "10m",
+				"*": "30s"
+			},
+			"confirm": {
+				"delete_file": "always",
+				"search": "never",
+				"write_file": "\"path\":\"/etc/"
+			},
+			"maxConcurrency": 2,
+			"roots": ["project", "workdir"],
+			"timeout": "30s",
+			"toolTimeouts": {"slow_tool": "5m"},
+			"warm": 2,
+			"scope": "shared",
+			"tls": {
+				"caFile": "ca.pem",
+				"certFile": "client.pem",
+				"keyFile": "client-key.pem",
+				"insecureSkipVerify": true
+			},
+			"egress": {
+				"allow": ["api.github.com", "*.example.com", "203.0.113.0/24"],
+				"deny": ["private"]
+			},
+			"sampling": {
+				"models": ["agent1"],
+				"maxTokens": 1024,
+				"tokenBudget": 50000,
+				"approval": "once"
+			},
+			"prompts": {
+				"create_issue": {
+					"name": "new_issue",
+					"arguments": {
+						"repo": "nanobot-ai/nanobot"
+					}
+				},
+				"internal": {
+					"hidden": true
+				}
 			}
 		}
 	},
@@ -82,7 +331,7 @@ func TestSchema(t *testing.T) {
 		"introduction": "The introduction to the publish.",
 		"resources": ["resource1", "resource2"],
 		"resourceTemplates": ["resource1", "resource2"],
-		"prompts": ["prompt1", "prompt2"]
+		"prompts": ["prompt1", "prompt2", "*"]
 	},
     "env": {
 		"env2": "Short description of env2",
@@ -103,15 +352,133 @@ func TestSchema(t *testing.T) {
 			"iconDark": "foo",
 			"description": "This is the first agent.",
 			"model": "a model",
+			"baseURL": "http://localhost:11434",
+			"responseCache": "10m",
+			"memory": {
+				"store": "qdrant",
+				"embeddingModel": "text-embedding-3-small",
+				"topK": 3,
+				"minScore": 0.4,
+				"remember": ["user", "assistant", "tools"],
+				"scope": "user"
+			},
+			"knowledge": {
+				"sources": ["docs/**/*.md", "handbook.pdf"],
+				"store": "vectors",
+				"chunkSize": 1000,
+				"chunkOverlap": 100,
+				"topK": 4,
+				"minScore": 0.2,
+				"inject": true,
+				"refresh": "5m"
+			},
+			"similarity": {
+				"embeddingModel": "gemini/gemini-embedding-001"
+			},
+			"exec": {
+				"languages": ["python", "shell"],
+				"sandbox": "process",
+				"images": {
+					"python": "python:3.12-slim"
+				},
+				"timeout": "30s",
+				"maxMemory": "256MB",
+				"network": false
+			},
+			"web": {
+				"maxSize": "5MB",
+				"maxLength": 10000,
+				"redirects": "any",
+				"ignoreRobots": false,
+				"timeout": "20s",
+				"userAgent": "nanobot-research",
+				"egress": {
+					"allow": ["*.example.com"],
+					"deny": ["private"]
+				},
+				"search": {
+					"provider": "searxng",
+					"url": "http://localhost:8888",
+					"maxResults": 8
+				}
+			},
+			"speech": {
+				"transcription": {
+					"model": "whisper-1",
+					"baseURL": "http://localhost:8080/v1",
+					"language": "en"
+				},
+				"synthesis": {
+					"voice": "nova",
+					"format": "opus",
+					"always": true
+				}
+			},
+			"middleware": [
+				"log",
+				{
+					"name": "redact",
+					"config": {
+						"detect": ["secrets", "emails"],
+						"patterns": {"employee": "EMP-\\d{6}"},
+						"allow": ["support@example\\.com"]
+					}
+				}
+			],
+			"roots": "project",
+			"turnTimeout": "10m",
+			"provider": "corp-azure",
+			"safetySettings": {"HARM_CATEGORY_HARASSMENT": "BLOCK_ONLY_HIGH"},
+			"wireLog": true,
+			"checkpoint": true,
+			"guardrails": {
+				"input": [
+					{"keywords": ["password", "ssn"], "action": "rewrite", "replacement": "***"},
+					{"name": "injection", "regex": "(?i)ignore (all )?previous instructions", "message": "I can not do that."},
+					{"moderation": {"categories": ["violence", "self-harm"], "threshold": 0.5}}
+				],
+				"output": [
+					{"judge": {"model": "gpt-4.1-mini", "rubric": "Do not give medical advice."}, "action": "rewrite"},
+					{"regex": "\\bconfidential\\b", "action": "flag"}
+				]
+			},
+			"untrusted": {
+				"trusted": ["agent2"],
+				"sanitize": true,
+				"patterns": ["(?i)send .* to http"],
+				"classifier": {"model": "gpt-4.1-mini"},
+				"confirm": ["server1/*", "*/delete_*"]
+			},
+			"limits": {
+				"requestsPerMinute": 10
+			},
+			"handoff": {
+				"agents": ["agent2"],
+				"forwardContext": true,
+				"maxDepth": 2,
+				"summarize": true,
+				"summaryAgent": "agent2"
+			},
+			"compaction": {
+				"contextWindow": 128000,
+				"threshold": 0.75,
+				"model": "gpt-4.1-mini",
+				"keepMessages": 6
+			},
+			"loop": {
+				"maxIterations": 10,
+				"maxRepeats": 3
+			},
 			"tools": "atool",
 			"flows": "atool",
 			"reasoning": {
 				"effort": "low",
-				"summary": "detailed"
+				"summary": "detailed",
+				"expose": true
 			},
 			"agents": "atool",
 			"chat": true,
-			"instructions": "These are the instructions for the agent.",
+			"instructions": "These are the instructions for the agent. {{ template \"tone\" . }}",
 			"toolExtensions": {
 				"tool1": {
 					"extension1": "value1",
@@ -125,6 +492,7 @@ func TestSchema(t *testing.T) {
 				"name": "output1",
 				"description": "This is the output schema for agent1.",
 				"strict": false,
+				"maxRetries": 3,
 				"fields": {
 					"field1": "description1",
 					"field2": "description2",
@@ -139,6 +507,10 @@ func TestSchema(t *testing.T) {
 			},
 			"truncation": "auto",
 			"maxTokens": 100,
+			"stop": ["END", "\n\n"],
+			"frequencyPenalty": 0.5,
+			"presencePenalty": -0.5,
+			"seed": 42,
 			"aliases": ["alias1", "alias2"],
 			"cost": 0.1,
 			"speed": 0.3,
@@ -146,6 +518,7 @@ func TestSchema(t *testing.T) {
 		},
 		"agent2": {
 			"threadName": "a different thread",
+			"model": ["gpt-4o", "claude-sonnet-4-0", "ollama/llama3"],
 			"tools": ["tool1", "tool2"],
 			"flows": ["tool1", "tool2"],
 			"agents": ["tool1", "tool2"],
@@ -156,6 +529,24 @@ func TestSchema(t *testing.T) {
 					"key": "value"
 				}
 			}
+		},
+		"agent3": {
+			"model": "gpt-4o",
+			"instructions": {
+				"url": "https://prompts.example.com/agent3.md",
+				"headers": {
+					"Authorization": "Bearer ${PROMPTS_TOKEN}"
+				},
+				"refresh": "10m",
+				"fallback": "You are a helpful assistant."
+			}
+		},
+		"agent4": {
+			"model": "gpt-4o",
+			"instructions": {
+				"mcp": "aserver/aprompt",
+				"fallback": "You are a helpful assistant."
+			}
 		}
 	},
     "flows": {
@@ -244,6 +635,15 @@ func TestSchema(t *testing.T) {
 						"topP": 0.5,
 						"toolChoice": "tool1",
 						"inputAsToolResult": true,
+						"model": "gpt-4.1-mini",
+						"maxTokens": 1000,
+						"stop": ["END"],
+						"frequencyPenalty": 1,
+						"presencePenalty": 0.2,
+						"seed": 7,
+						"reasoning": {
+							"effort": "high"
+						},
 						"output": {
 							"description": "output1",	
 							"fields": {
@@ -257,7 +657,16 @@ func TestSchema(t *testing.T) {
 					"id": "step1",
 					"input": "a string",
 					"flow": "tool1",
+					"if": "an expression",
 					"while": "an expression",
+					"maxIterations": 10,
+					"parallel": false,
+					"concurrency": 4,
+					"onError": "continue",
+					"reduce": {
+						"name": "tool1",
+						"model": "gpt-4.1-mini"
+					},
 					"return": {
 						"key1": {
 							"something": 1
@@ -323,3 +732,27 @@ func TestSchema(t *testing.T) {
 		t.Fatalf("Failed to validate schema: %v", err)
 	}
 }
+
+func TestSchemaPublishTools(t *testing.T) {
+	s := compileSchema(t)
+
+	tests := []struct {
+		name  string
+		tools string
+	}{
+		{name: "string", tools: `"server1"`},
+		{name: "list", tools: `["server1", "server2/search"]`},
+		{name: "aliases", tools: `{"fetch": {"server": "server1", "as": "server1_fetch"}, "search": {"server": "server1"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := map[string]any{}
+			if err := json.Unmarshal([]byte(`{"publish": {"tools": `+tt.tools+`}}`), &obj); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			if err := s.Validate(obj); err != nil {
+				t.Fatalf("Failed to validate schema: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/oci"
+)
+
+// RemoteOptions are used to pull configs from oci:// references and to verify configs loaded from URLs.
+var RemoteOptions oci.Options
+
+var sha256Pattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// resolveOCI pulls the artifact and returns the directory of its files as the resource.
+func resolveOCI(ctx context.Context, name string) (*resource, error) {
+	ref, err := oci.ParseReference(strings.TrimPrefix(name, "oci://"))
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := oci.Pull(ctx, ref, RemoteOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull %s: %w", ref, err)
+	}
+
+	return &resource{
+		resourceType: "path",
+		url:          dir,
+	}, nil
+}
+
+// parseURLDigest splits the digest pin from URLs like https://example.com/nanobot.yaml#sha256=<hex>.
+func parseURLDigest(name string) (string, string, error) {
+	url, fragment, ok := strings.Cut(name, "#")
+	if !ok {
+		return name, "", nil
+	}
+	hexDigest, ok := strings.CutPrefix(fragment, "sha256=")
+	if !ok || !sha256Pattern.MatchString(hexDigest) {
+		return "", "", fmt.Errorf("invalid digest %q in %s, must be #sha256=<64 hex characters>", fragment, name)
+	}
+	return url, hexDigest, nil
+}
+
+// httpRead returns the content at the URL of the resource. The content must match the digest of the
+// resource and, if a key is configured, the signature at the URL with .sig appended. Verified content
+// is kept on disk to be used if the URL can not be fetched later.
+func httpRead(ctx context.Context, r *resource) ([]byte, error) {
+	opt := complete.Complete(RemoteOptions)
+	key, err := opt.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	// Content verified with a key is cached separately, so that content loaded without one is not
+	// trusted when a key is set later
+	cacheFile := filepath.Join(opt.CacheDir, "http", hashString(r.url))
+	if r.digest != "" {
+		cacheFile = filepath.Join(opt.CacheDir, "http", "sha256-"+r.digest)
+	}
+	if key != nil {
+		keyFile, err := filepath.Abs(opt.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cacheFile += "-" + hashString(keyFile)[:16]
+	}
+
+	if r.digest != "" {
+		if data, err := os.ReadFile(cacheFile); err == nil && hashBytes(data) == r.digest {
+			return data, nil
+		}
+	}
+
+	data, err := httpGet(ctx, r.url)
+	if err != nil {
+		if cached, cacheErr := os.ReadFile(cacheFile); cacheErr == nil && (r.digest == "" || hashBytes(cached) == r.digest) {
+			log.Errorf(ctx, "failed to load %s, using cached copy: %v", r.url, err)
+			return cached, nil
+		}
+		return nil, err
+	}
+	if err := verifyHTTP(ctx, r, data, key); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0o755); err == nil {
+		_ = os.WriteFile(cacheFile, data, 0o644)
+	}
+	return data, nil
+}
+
+func verifyHTTP(ctx context.Context, r *resource, data []byte, key crypto.PublicKey) error {
+	if r.digest != "" {
+		if got := hashBytes(data); got != r.digest {
+			return fmt.Errorf("content of %s has digest sha256:%s, want sha256:%s", r.url, got, r.digest)
+		}
+	}
+	if key == nil {
+		return nil
+	}
+
+	signature, err := httpGet(ctx, r.url+".sig")
+	if err != nil {
+		return fmt.Errorf("failed to get signature of %s, sign it with cosign sign-blob: %w", r.url, err)
+	}
+	if err := oci.VerifyBlob(key, data, string(signature)); err != nil {
+		return fmt.Errorf("failed to verify signature of %s: %w", r.url, err)
+	}
+	return nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hashString(s string) string {
+	return hashBytes([]byte(s))
+}
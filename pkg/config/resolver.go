@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
 	"github.com/nanobot-ai/nanobot/pkg/types"
 	"sigs.k8s.io/yaml"
 )
@@ -21,6 +22,7 @@ type resource struct {
 	url          string
 	parts        []string
 	ref          string
+	digest       string
 	static       *types.Config
 }
 
@@ -105,7 +107,7 @@ func httpGetRaw(ctx context.Context, url string) ([]byte, error) {
 		return nil, fmt.Errorf("error creating request for %s: %w", url, err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := transport.Client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching %s: %w", url, err)
 	}
@@ -140,7 +142,7 @@ func (r *resource) Load(ctx context.Context) (result types.Config, _ error) {
 
 	s := getSchema()
 	if err := s.Validate(obj); err != nil {
-		return result, fmt.Errorf("error validating resource %s: %w", r.url, err)
+		return result, newValidationError(r.file(), data, err)
 	}
 
 	if err := mcp.JSONCoerce(obj, &result); err != nil {
@@ -195,9 +197,31 @@ func (r *resource) String() string {
 	return r.url
 }
 
+// key identifies the resource, to find include cycles.
+func (r *resource) key() string {
+	if r.resourceType == "path" {
+		if f, err := r.fileToRead(); err == nil {
+			if abs, err := filepath.Abs(f); err == nil {
+				return abs
+			}
+		}
+	}
+	return r.resourceType + ":" + r.String()
+}
+
+// file returns the name of the file of the resource to show in errors.
+func (r *resource) file() string {
+	if r.resourceType == "path" {
+		if f, err := r.fileToRead(); err == nil {
+			return filepath.Clean(f)
+		}
+	}
+	return r.String()
+}
+
 func (r *resource) read(ctx context.Context) ([]byte, error) {
 	if r.resourceType == "http" {
-		return httpGet(ctx, r.url)
+		return httpRead(ctx, r)
 	}
 
 	if r.resourceType == "path" {
@@ -321,16 +345,25 @@ func statics(name string) *resource {
 	}
 	return nil
 }
-func resolve(name string) (*resource, error) {
+func resolve(ctx context.Context, name string) (*resource, error) {
 	if staticCfg := statics(name); staticCfg != nil {
 		return staticCfg, nil
 	}
 
+	if strings.HasPrefix(name, "oci://") {
+		return resolveOCI(ctx, name)
+	}
+
 	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
 		// Handle HTTP resources
+		url, digest, err := parseURLDigest(name)
+		if err != nil {
+			return nil, err
+		}
 		return &resource{
 			resourceType: "http",
-			url:          name,
+			url:          url,
+			digest:       digest,
 		}, nil
 	}
 
@@ -14,6 +14,7 @@ import (
 var (
 	schemaOnce sync.Once
 	schema     *jsonschema.Schema
+	schemaDoc  map[string]any
 	//go:embed schema.yaml
 	schemaByte []byte
 )
@@ -29,11 +30,23 @@ func getSchema() *jsonschema.Schema {
 	return schema
 }
 
+// getSchemaDoc returns the schema as parsed from schema.yaml.
+func getSchemaDoc() map[string]any {
+	getSchema()
+	return schemaDoc
+}
+
+// JSONSchema returns the JSON Schema of nanobot.yaml, for editors to validate and complete configs.
+func JSONSchema() ([]byte, error) {
+	return yaml.YAMLToJSON(schemaByte)
+}
+
 func initSchema() (*jsonschema.Schema, error) {
 	schemaObj := map[string]any{}
 	if err := yaml.Unmarshal(schemaByte, &schemaObj); err != nil {
 		return nil, err
 	}
+	schemaDoc = schemaObj
 
 	c := jsonschema.NewCompiler()
 	if err := c.AddResource("schema.json", schemaObj); err != nil {
@@ -0,0 +1,299 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"go.yaml.in/yaml/v3"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+var printer = message.NewPrinter(language.English)
+
+// Problem is a violation of the config schema at a position of a config file.
+type Problem struct {
+	File   string `json:"file"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	// Path is the location of the value in the config, like agents.main.model.
+	Path       string `json:"path"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+func (p Problem) String() string {
+	var sb strings.Builder
+	sb.WriteString(p.File)
+	if p.Line > 0 {
+		fmt.Fprintf(&sb, ":%d:%d", p.Line, p.Column)
+	}
+	sb.WriteString(": ")
+	if p.Path != "" {
+		sb.WriteString(p.Path + ": ")
+	}
+	sb.WriteString(p.Message)
+	if p.Suggestion != "" {
+		fmt.Fprintf(&sb, ", did you mean %q?", p.Suggestion)
+	}
+	return sb.String()
+}
+
+// ValidationError is returned for config files that do not match the schema.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		lines = append(lines, p.String())
+	}
+	return "invalid config:\n  " + strings.Join(lines, "\n  ")
+}
+
+func (e *ValidationError) ErrorData() types.ErrorData {
+	return types.ErrorData{
+		Type: types.ErrorTypeConfig,
+		Code: "invalid_config",
+	}
+}
+
+func (e *ValidationError) RPCError() *mcp.RPCError {
+	return types.NewRPCError(e)
+}
+
+// newValidationError turns the error of validating data against the schema into problems located in
+// the YAML of file.
+func newValidationError(file string, data []byte, err error) error {
+	var schemaErr *jsonschema.ValidationError
+	if !errors.As(err, &schemaErr) {
+		return fmt.Errorf("error validating resource %s: %w", file, err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("error validating resource %s: %w", file, schemaErr)
+	}
+
+	result := &ValidationError{}
+	for _, leaf := range leaves(schemaErr) {
+		result.Problems = append(result.Problems, toProblems(file, &root, leaf)...)
+	}
+	slices.SortStableFunc(result.Problems, func(a, b Problem) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	result.Problems = slices.CompactFunc(result.Problems, func(a, b Problem) bool {
+		return a == b
+	})
+	return result
+}
+
+// leaves returns the errors that caused err. The branches of oneOf and anyOf that fail only because
+// the value has another type are left out, unless every branch does, then their types are merged into
+// one error.
+func leaves(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+
+	switch err.ErrorKind.(type) {
+	case *kind.OneOf, *kind.AnyOf:
+		var (
+			matching []*jsonschema.ValidationError
+			merged   = &kind.Type{}
+		)
+		for _, cause := range err.Causes {
+			causeLeaves := leaves(cause)
+			if t, ok := typeMismatch(err, causeLeaves); ok {
+				merged.Got = t.Got
+				for _, want := range t.Want {
+					if !slices.Contains(merged.Want, want) {
+						merged.Want = append(merged.Want, want)
+					}
+				}
+				continue
+			}
+			matching = append(matching, causeLeaves...)
+		}
+		if len(matching) > 0 {
+			return matching
+		}
+		return []*jsonschema.ValidationError{{
+			SchemaURL:        err.SchemaURL,
+			InstanceLocation: err.InstanceLocation,
+			ErrorKind:        merged,
+		}}
+	}
+
+	var result []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		result = append(result, leaves(cause)...)
+	}
+	return result
+}
+
+// typeMismatch returns the type error if the only error of a branch is the type of the value of parent.
+func typeMismatch(parent *jsonschema.ValidationError, errs []*jsonschema.ValidationError) (*kind.Type, bool) {
+	if len(errs) != 1 || !slices.Equal(errs[0].InstanceLocation, parent.InstanceLocation) {
+		return nil, false
+	}
+	t, ok := errs[0].ErrorKind.(*kind.Type)
+	return t, ok
+}
+
+func toProblems(file string, root *yaml.Node, err *jsonschema.ValidationError) []Problem {
+	path := formatPath(err.InstanceLocation)
+	key, value := find(root, err.InstanceLocation)
+	at := func(node *yaml.Node, message string) Problem {
+		p := Problem{
+			File:    file,
+			Path:    path,
+			Message: message,
+		}
+		if node != nil {
+			p.Line, p.Column = node.Line, node.Column
+		}
+		return p
+	}
+
+	switch k := err.ErrorKind.(type) {
+	case *kind.AdditionalProperties:
+		known := schemaProperties(err.SchemaURL)
+		var result []Problem
+		for _, property := range k.Properties {
+			propertyKey, _ := find(value, []string{property})
+			p := at(propertyKey, fmt.Sprintf("unknown field %q", property))
+			p.Suggestion = types.ClosestName(property, known)
+			result = append(result, p)
+		}
+		return result
+	case *kind.Required:
+		return []Problem{at(key, fmt.Sprintf("missing required field %s", quoteAll(k.Missing)))}
+	case *kind.Type:
+		return []Problem{at(value, fmt.Sprintf("got %s, want %s", k.Got, strings.Join(k.Want, " or ")))}
+	case *kind.Enum:
+		p := at(value, k.LocalizedString(printer))
+		if got, ok := k.Got.(string); ok {
+			var want []string
+			for _, w := range k.Want {
+				if s, ok := w.(string); ok {
+					want = append(want, s)
+				}
+			}
+			p.Suggestion = types.ClosestName(got, want)
+		}
+		return []Problem{p}
+	default:
+		return []Problem{at(value, err.ErrorKind.LocalizedString(printer))}
+	}
+}
+
+// find returns the key and value nodes at the JSON pointer tokens of location. The key is nil for the
+// root and for items of lists. If the location is not found the closest parent found is returned.
+func find(node *yaml.Node, location []string) (key, value *yaml.Node) {
+	value = node
+	for value != nil && value.Kind == yaml.DocumentNode && len(value.Content) > 0 {
+		value = value.Content[0]
+	}
+
+	for _, token := range location {
+		if value == nil {
+			return key, value
+		}
+		for value.Kind == yaml.AliasNode && value.Alias != nil {
+			value = value.Alias
+		}
+
+		switch value.Kind {
+		case yaml.MappingNode:
+			found := false
+			for i := 0; i+1 < len(value.Content); i += 2 {
+				if value.Content[i].Value == token {
+					key, value = value.Content[i], value.Content[i+1]
+					found = true
+					break
+				}
+			}
+			if !found {
+				return key, value
+			}
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(value.Content) {
+				return key, value
+			}
+			key, value = nil, value.Content[i]
+		default:
+			return key, value
+		}
+	}
+	return key, value
+}
+
+func formatPath(location []string) string {
+	var sb strings.Builder
+	for _, token := range location {
+		if _, err := strconv.Atoi(token); err == nil {
+			sb.WriteString("[" + token + "]")
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(token)
+	}
+	return sb.String()
+}
+
+func quoteAll(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, strconv.Quote(name))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// schemaProperties returns the names of the properties of the schema at the URL, like
+// schema.json#/definitions/Agent.
+func schemaProperties(schemaURL string) []string {
+	_, pointer, _ := strings.Cut(schemaURL, "#")
+	var current any = getSchemaDoc()
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch v := current.(type) {
+		case map[string]any:
+			current = v[token]
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			current = v[i]
+		default:
+			return nil
+		}
+	}
+
+	obj, _ := current.(map[string]any)
+	properties, _ := obj["properties"].(map[string]any)
+	result := make([]string, 0, len(properties))
+	for name := range properties {
+		result = append(result, name)
+	}
+	slices.Sort(result)
+	return result
+}
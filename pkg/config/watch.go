@@ -0,0 +1,234 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nanobot-ai/nanobot/pkg/audit"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// Watcher caches the configs returned by a ConfigFactory and reloads them when the local config
+// files change. Sessions pick up the new config the next time they are synced, in-flight
+// completions keep using the config they started with.
+type Watcher struct {
+	factory  types.ConfigFactory
+	path     string
+	watcher  *fsnotify.Watcher
+	watched  map[string]bool
+	version  atomic.Int64
+	configs  sync.Map
+	loadLock sync.Mutex
+	done     chan struct{}
+}
+
+type versionedConfig struct {
+	version int64
+	config  types.Config
+}
+
+// NewWatcher returns a Watcher for the config at path and the local configs it includes or extends. If
+// path is not a local file or directory the returned Watcher does not cache and calls the factory on
+// every load.
+func NewWatcher(ctx context.Context, path string, factory types.ConfigFactory) (*Watcher, error) {
+	w := &Watcher{
+		factory: factory,
+		path:    path,
+		watched: map[string]bool{},
+		done:    make(chan struct{}),
+	}
+
+	dir, ok := watchDir(path)
+	if !ok {
+		close(w.done)
+		return w, nil
+	}
+
+	var err error
+	w.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config watcher: %w", err)
+	}
+
+	if err := w.watcher.Add(dir); err != nil {
+		_ = w.watcher.Close()
+		return nil, fmt.Errorf("failed to watch config directory %s: %w", dir, err)
+	}
+	w.watched[filepath.Clean(dir)] = true
+	w.watchIncludes(ctx)
+
+	go w.run(ctx)
+	return w, nil
+}
+
+// watchIncludes adds the directories of the files the config includes or extends that are not watched
+// yet. Files that are no longer used stay watched.
+func (w *Watcher) watchIncludes(ctx context.Context) {
+	files, err := localFiles(ctx, w.path)
+	if err != nil {
+		log.Errorf(ctx, "failed to find the included config files: %v", err)
+		return
+	}
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if w.watched[dir] {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			log.Errorf(ctx, "failed to watch config directory %s: %v", dir, err)
+			continue
+		}
+		w.watched[dir] = true
+	}
+}
+
+func watchDir(path string) (string, bool) {
+	if !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, ".") {
+		return "", false
+	}
+	s, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	if s.IsDir() {
+		return path, true
+	}
+	return filepath.Dir(path), true
+}
+
+// Version is incremented every time the config files change and the config is reloaded.
+func (w *Watcher) Version() int64 {
+	return w.version.Load()
+}
+
+// Load returns the current config for the given profiles. It has the same signature as
+// types.ConfigFactory so it can be used in its place.
+func (w *Watcher) Load(ctx context.Context, profiles string) (types.Config, error) {
+	if w.watcher == nil {
+		return w.factory(ctx, profiles)
+	}
+
+	version := w.version.Load()
+	if cached, ok := w.configs.Load(profiles); ok && cached.(*versionedConfig).version == version {
+		return cached.(*versionedConfig).config, nil
+	}
+
+	w.loadLock.Lock()
+	defer w.loadLock.Unlock()
+
+	if cached, ok := w.configs.Load(profiles); ok && cached.(*versionedConfig).version == version {
+		return cached.(*versionedConfig).config, nil
+	}
+
+	cfg, err := w.factory(ctx, profiles)
+	if err != nil {
+		if cached, ok := w.configs.Load(profiles); ok {
+			// Keep serving the last good config until the files are changed again
+			log.Errorf(ctx, "failed to reload config, using previous version: %v", err)
+			recordChange(ctx, version, profiles, nil, err)
+			cfg = cached.(*versionedConfig).config
+		} else {
+			return cfg, err
+		}
+	} else {
+		recordChange(ctx, version, profiles, &cfg, nil)
+	}
+
+	w.configs.Store(profiles, &versionedConfig{
+		version: version,
+		config:  cfg,
+	})
+	return cfg, nil
+}
+
+// recordChange adds the loaded config to the audit log, with the digest of the config so that the
+// versions can be told apart.
+func recordChange(ctx context.Context, version int64, profiles string, cfg *types.Config, err error) {
+	if !audit.Enabled() {
+		return
+	}
+
+	event := audit.Event{
+		Type:    audit.ConfigChange,
+		Message: fmt.Sprintf("loaded config version %d", version),
+	}
+	if profiles != "" {
+		event.Message += " with profiles " + profiles
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	if cfg != nil {
+		data, _ := json.Marshal(cfg)
+		sum := sha256.Sum256(data)
+		event.Digest = hex.EncodeToString(sum[:])
+	}
+	audit.Record(ctx, event)
+}
+
+func (w *Watcher) Close() error {
+	if w.watcher == nil {
+		return nil
+	}
+	err := w.watcher.Close()
+	<-w.done
+	return err
+}
+
+func (w *Watcher) run(ctx context.Context) {
+	defer close(w.done)
+
+	var (
+		// Editors often write a file in multiple steps, so wait for the changes to settle.
+		debounce = time.NewTimer(time.Hour)
+		pending  bool
+	)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !isConfigFile(event.Name) || event.Op == fsnotify.Chmod {
+				continue
+			}
+			pending = true
+			debounce.Reset(200 * time.Millisecond)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf(ctx, "error watching config files: %v", err)
+		case <-debounce.C:
+			if pending {
+				pending = false
+				log.Infof(ctx, "config files changed, reloading config (version %d)", w.version.Add(1))
+				w.watchIncludes(ctx)
+			}
+		}
+	}
+}
+
+func isConfigFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json", ".md":
+		return true
+	}
+	return false
+}
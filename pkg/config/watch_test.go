@@ -0,0 +1,70 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func TestWatcherIncludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("app/nanobot.yaml", "extends: ../base/base.yaml\ninclude: ../shared/agents.yaml\n")
+	write("base/base.yaml", "agents: {}\n")
+	write("shared/agents.yaml", "include: tools/servers.yaml\n")
+	write("shared/tools/servers.yaml", "mcpServers: {}\n")
+
+	path := filepath.Join(dir, "app", "nanobot.yaml")
+	files, err := localFiles(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		path,
+		filepath.Join(dir, "shared", "agents.yaml"),
+		filepath.Join(dir, "shared", "tools", "servers.yaml"),
+		filepath.Join(dir, "base", "base.yaml"),
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("expected files %v, got %v", expected, files)
+	}
+	for i := range expected {
+		if files[i] != expected[i] {
+			t.Errorf("expected file %s, got %s", expected[i], files[i])
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w, err := NewWatcher(ctx, path, func(context.Context, string) (types.Config, error) {
+		return types.Config{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, name := range []string{"shared/tools/servers.yaml", "base/base.yaml"} {
+		version := w.Version()
+		write(name, "# changed\n")
+		deadline := time.Now().Add(5 * time.Second)
+		for w.Version() == version && time.Now().Before(deadline) {
+			time.Sleep(20 * time.Millisecond)
+		}
+		if w.Version() == version {
+			t.Errorf("expected the config to be reloaded after %s changed", name)
+		}
+	}
+}
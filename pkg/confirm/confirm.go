@@ -25,9 +25,7 @@ func (*Service) HandleAuthURL(ctx context.Context, mcpServerName, url string) (b
 		return false, fmt.Errorf("no session found in context")
 	}
 
-	for session.Parent != nil {
-		session = session.Parent
-	}
+	session = session.Root()
 
 	meta := map[string]interface{}{
 		types.MetaPrefix + "oauth-url":   url,
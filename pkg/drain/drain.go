@@ -0,0 +1,102 @@
+package drain
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Handler counts the requests in flight so that shutdown can wait for the turns they run to finish.
+// While draining, requests that would start a new session and health checks are answered with 503 so
+// that clients and load balancers go elsewhere, requests of existing sessions are still served.
+type Handler struct {
+	next        http.Handler
+	newSession  func(*http.Request) bool
+	healthzPath string
+
+	lock     sync.Mutex
+	inflight int
+	idle     chan struct{}
+	draining bool
+}
+
+// NewHandler returns a Handler serving next. newSession returns true for requests that do not belong
+// to an existing session.
+func NewHandler(next http.Handler, newSession func(*http.Request) bool, healthzPath string) *Handler {
+	return &Handler{
+		next:        next,
+		newSession:  newSession,
+		healthzPath: healthzPath,
+	}
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	h.lock.Lock()
+	draining := h.draining
+	h.lock.Unlock()
+
+	if draining {
+		if h.healthzPath != "" && req.URL.Path == h.healthzPath {
+			http.Error(rw, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		if req.Method == http.MethodPost && h.newSession(req) {
+			rw.Header().Set("Connection", "close")
+			rw.Header().Set("Retry-After", "1")
+			http.Error(rw, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	// GET requests stream events for as long as the client is connected, they are not turns.
+	if req.Method == http.MethodGet {
+		h.next.ServeHTTP(rw, req)
+		return
+	}
+
+	h.lock.Lock()
+	h.inflight++
+	h.lock.Unlock()
+
+	defer func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		h.inflight--
+		if h.inflight == 0 && h.idle != nil {
+			close(h.idle)
+			h.idle = nil
+		}
+	}()
+
+	h.next.ServeHTTP(rw, req)
+}
+
+// Drain stops new sessions and waits until no requests are in flight. It returns the error of ctx if
+// it is done first.
+func (h *Handler) Drain(ctx context.Context) error {
+	h.lock.Lock()
+	h.draining = true
+	if h.inflight == 0 {
+		h.lock.Unlock()
+		return nil
+	}
+	if h.idle == nil {
+		h.idle = make(chan struct{})
+	}
+	idle := h.idle
+	h.lock.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// InFlight returns the number of requests being served.
+func (h *Handler) InFlight() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.inflight
+}
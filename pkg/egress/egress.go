@@ -0,0 +1,173 @@
+package egress
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Private is the entry of allow and deny lists that stands for loopback, private, link-local and shared
+// addresses, like instance metadata endpoints and the services of an internal network.
+const Private = "private"
+
+var privatePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+}
+
+// Policy decides which hosts connections can be made to. Deny wins over allow, and if allow is empty all
+// hosts that are not denied are allowed.
+type Policy struct {
+	allow, deny rules
+}
+
+type rules struct {
+	hosts []string
+	nets  []netip.Prefix
+}
+
+// DeniedError is returned for connections to hosts the policy does not allow.
+type DeniedError struct {
+	Host   string
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("connections to %s are not allowed: %s", e.Host, e.Reason)
+}
+
+// NewPolicy returns the policy of the allow and deny lists. Entries are host names, which match the host
+// exactly, *.example.com, which matches the subdomains of example.com, IP addresses, CIDR ranges, and
+// private.
+func NewPolicy(allow, deny []string) (*Policy, error) {
+	allowRules, err := parseRules(allow)
+	if err != nil {
+		return nil, err
+	}
+	denyRules, err := parseRules(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{
+		allow: allowRules,
+		deny:  denyRules,
+	}, nil
+}
+
+func parseRules(entries []string) (result rules, _ error) {
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			return result, fmt.Errorf("empty host")
+		case entry == Private:
+			result.nets = append(result.nets, privatePrefixes...)
+		case strings.Contains(entry, "/"):
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return result, fmt.Errorf("invalid CIDR range %q: %w", entry, err)
+			}
+			result.nets = append(result.nets, prefix.Masked())
+		default:
+			if addr, err := netip.ParseAddr(entry); err == nil {
+				addr = addr.Unmap()
+				result.nets = append(result.nets, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+			if strings.Contains(strings.TrimPrefix(entry, "*."), "*") {
+				return result, fmt.Errorf("invalid host %q, only a leading *. is allowed", entry)
+			}
+			result.hosts = append(result.hosts, strings.TrimSuffix(entry, "."))
+		}
+	}
+	return result, nil
+}
+
+func (r rules) matchHost(host string) bool {
+	for _, pattern := range r.hosts {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (r rules) matchAddr(addr netip.Addr) bool {
+	for _, prefix := range r.nets {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the addresses of the host that connections can be made to, or a DeniedError. A host
+// is allowed by name, or if all of its addresses are allowed. Connections are only made to the returned
+// addresses, so that the host can not resolve to another address after it was checked.
+func (p *Policy) Resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if p.deny.matchHost(host) {
+		return nil, &DeniedError{Host: host, Reason: "the host is denied"}
+	}
+
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+	}
+
+	allowedByName := len(p.allow.hosts) == 0 && len(p.allow.nets) == 0 || p.allow.matchHost(host)
+	for i, addr := range addrs {
+		addr = addr.Unmap()
+		addrs[i] = addr
+		if p.deny.matchAddr(addr) {
+			return nil, &DeniedError{Host: host, Reason: fmt.Sprintf("address %s is denied", addr)}
+		}
+		if !allowedByName && !p.allow.matchAddr(addr) {
+			return nil, &DeniedError{Host: host, Reason: "the host is not allowed"}
+		}
+	}
+	return addrs, nil
+}
+
+// DialContext connects to the address if the policy allows its host, it can be used as the DialContext
+// of an http.Transport.
+func (p *Policy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := p.Resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
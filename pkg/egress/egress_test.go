@@ -0,0 +1,95 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		host    string
+		allowed bool
+	}{
+		{name: "no lists", host: "93.184.216.34", allowed: true},
+		{name: "denied private", deny: []string{Private}, host: "169.254.169.254"},
+		{name: "denied private ipv6", deny: []string{Private}, host: "[::1]"},
+		{name: "denied mapped ipv4", deny: []string{Private}, host: "::ffff:10.0.0.1"},
+		{name: "public with private denied", deny: []string{Private}, host: "93.184.216.34", allowed: true},
+		{name: "denied host", deny: []string{"metadata.internal"}, host: "Metadata.Internal."},
+		{name: "denied subdomain", deny: []string{"*.internal"}, host: "db.internal"},
+		{name: "allowed cidr", allow: []string{"10.0.0.0/8"}, host: "10.1.2.3", allowed: true},
+		{name: "not allowed", allow: []string{"10.0.0.0/8"}, host: "192.168.1.1"},
+		{name: "deny wins over allow", allow: []string{"10.0.0.0/8"}, deny: []string{"10.0.0.1"}, host: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPolicy(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = policy.Resolve(context.Background(), tt.host)
+			var denied *DeniedError
+			if tt.allowed && err != nil {
+				t.Errorf("expected %s to be allowed, got %v", tt.host, err)
+			} else if !tt.allowed && !errors.As(err, &denied) {
+				t.Errorf("expected %s to be denied, got %v", tt.host, err)
+			}
+		})
+	}
+}
+
+func TestNewPolicyInvalid(t *testing.T) {
+	for _, entry := range []string{"", "10.0.0.0/33", "api.*.com"} {
+		if _, err := NewPolicy([]string{entry}, nil); err == nil {
+			t.Errorf("expected an error for %q", entry)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = rw.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name   string
+		deny   []string
+		status int
+	}{
+		{name: "allowed", status: http.StatusOK},
+		{name: "denied", deny: []string{Private}, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			policy, err := NewPolicy(nil, tt.deny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			address, err := StartProxy(ctx, "test", "", policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: address})}}
+			resp, err := client.Get(upstream.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+)
+
+// Proxy is an HTTP proxy that only connects to the hosts the policy allows. Processes use it through the
+// HTTP_PROXY and HTTPS_PROXY environment variables.
+type Proxy struct {
+	name    string
+	policy  *Policy
+	forward *httputil.ReverseProxy
+}
+
+// StartProxy serves a proxy for the policy on a port of host, the loopback address if it is empty, until
+// ctx is done and returns its address. The name is logged with the connections the policy denies.
+func StartProxy(ctx context.Context, name, host string, policy *Policy) (string, error) {
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	l, err := net.Listen("tcp4", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return "", fmt.Errorf("failed to listen for the egress proxy of %s: %w", name, err)
+	}
+
+	p := &Proxy{
+		name:   name,
+		policy: policy,
+	}
+	p.forward = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL = r.In.URL
+			r.Out.Host = r.In.Host
+		},
+		Transport: &http.Transport{
+			DialContext:         policy.DialContext,
+			ForceAttemptHTTP2:   true,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		ErrorHandler: p.error,
+	}
+
+	server := &http.Server{
+		Handler:           p,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf(ctx, "egress proxy of %s stopped: %v", name, err)
+		}
+	}()
+	context.AfterFunc(ctx, func() {
+		_ = server.Close()
+	})
+
+	return l.Addr().String(), nil
+}
+
+func (p *Proxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodConnect {
+		p.connect(rw, req)
+		return
+	}
+	if !req.URL.IsAbs() {
+		http.Error(rw, "only proxy requests are served", http.StatusBadRequest)
+		return
+	}
+	p.forward.ServeHTTP(rw, req)
+}
+
+// connect tunnels the connection to the host of a CONNECT request, which is how HTTPS is proxied.
+func (p *Proxy) connect(rw http.ResponseWriter, req *http.Request) {
+	upstream, err := p.policy.DialContext(req.Context(), "tcp", req.Host)
+	if err != nil {
+		p.error(rw, req, err)
+		return
+	}
+	defer upstream.Close()
+
+	conn, buf, err := http.NewResponseController(rw).Hijack()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Bytes the client sent after the CONNECT request are already buffered
+		_, _ = io.Copy(upstream, buf)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (p *Proxy) error(rw http.ResponseWriter, req *http.Request, err error) {
+	var denied *DeniedError
+	if errors.As(err, &denied) {
+		log.Infof(req.Context(), "denied connection of %s: %v", p.name, denied)
+		http.Error(rw, denied.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(rw, err.Error(), http.StatusBadGateway)
+}
@@ -0,0 +1,266 @@
+package elicit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/audit"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const (
+	Accept  = "accept"
+	Decline = "decline"
+	Cancel  = "cancel"
+)
+
+// Source returns the MCP server that sent the request and, for tool confirmations, the tool.
+func Source(req mcp.ElicitRequest) (server, tool string) {
+	var meta map[string]any
+	if len(req.Meta) > 0 {
+		_ = json.Unmarshal(req.Meta, &meta)
+	}
+	server, _ = meta[types.MetaPrefix+"server-name"].(string)
+	tool, _ = meta[types.MetaPrefix+"tool-name"].(string)
+	return
+}
+
+// Headless answers requests with the elicitation config of the session. Requests that no answer
+// matches are declined. Every answer is logged, and answers other than tool confirmations, which
+// are recorded as approvals, are added to the audit log.
+func Headless(ctx context.Context, req mcp.ElicitRequest) (mcp.ElicitResult, error) {
+	var (
+		server, tool = Source(req)
+		config       = types.ConfigFromContext(ctx).Elicitation
+		result       = mcp.ElicitResult{Action: Decline}
+		answered     bool
+	)
+	if config != nil {
+		if config.Default != "" {
+			result.Action = config.Default
+		}
+		for _, answer := range config.Answers {
+			if matches(answer, req, server, tool) {
+				result = mcp.ElicitResult{
+					Action:  answer.Action,
+					Content: answer.Content,
+				}
+				if result.Action == "" {
+					result.Action = Accept
+				}
+				answered = true
+				break
+			}
+		}
+	}
+
+	from := "nanobot"
+	if server != "" {
+		from = "MCP server " + server
+	}
+	if answered {
+		log.Infof(ctx, "answered elicitation from %s with %s from the config: %s", from, result.Action, req.Message)
+	} else {
+		log.Errorf(ctx, "no one to answer elicitation from %s, responded with %s, add an answer to the elicitation config to change this: %s", from, result.Action, req.Message)
+	}
+
+	if tool == "" {
+		message := req.Message
+		if !answered {
+			message += " (no answer configured)"
+		}
+		audit.Record(ctx, audit.Event{
+			Time:    time.Now(),
+			Type:    audit.Elicitation,
+			Server:  server,
+			Action:  result.Action,
+			Message: message,
+		})
+	}
+	return result, nil
+}
+
+func matches(answer types.ElicitAnswer, req mcp.ElicitRequest, server, tool string) bool {
+	if answer.Server != "" && answer.Server != server {
+		return false
+	}
+	if answer.Tool != "" && answer.Tool != tool {
+		return false
+	}
+	if answer.Message != "" {
+		re, err := regexp.Compile(answer.Message)
+		if err != nil || !re.MatchString(req.Message) {
+			return false
+		}
+	}
+	return true
+}
+
+// Field is a property of the requested schema of an elicitation request.
+type Field struct {
+	Name     string
+	Required bool
+	mcp.PrimitiveProperty
+}
+
+// Fields returns the properties of the schema, the required ones first, each sorted by name.
+func Fields(schema mcp.PrimitiveSchema) []Field {
+	var fields []Field
+	for name, property := range schema.Properties {
+		fields = append(fields, Field{
+			Name:              name,
+			Required:          slices.Contains(schema.Required, name),
+			PrimitiveProperty: property,
+		})
+	}
+	slices.SortFunc(fields, func(a, b Field) int {
+		if a.Required != b.Required {
+			if a.Required {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return fields
+}
+
+// Label is how the field is shown to the user, with its description, choices, and default.
+func (f Field) Label() string {
+	label := f.Title
+	if label == "" {
+		label = f.Name
+	}
+	if f.Description != "" {
+		label += " - " + f.Description
+	}
+
+	var hints []string
+	switch {
+	case len(f.Enum) > 0:
+		for i, value := range f.Enum {
+			if i < len(f.EnumNames) && f.EnumNames[i] != "" {
+				value = f.EnumNames[i]
+			}
+			hints = append(hints, fmt.Sprintf("%d) %s", i+1, value))
+		}
+	case f.Type == "boolean":
+		if f.Default != nil && *f.Default {
+			hints = append(hints, "Y/n")
+		} else if f.Default != nil {
+			hints = append(hints, "y/N")
+		} else {
+			hints = append(hints, "y/n")
+		}
+	case f.Format != "":
+		hints = append(hints, f.Format)
+	case f.Type == "number" || f.Type == "integer":
+		hints = append(hints, f.Type)
+	}
+	if !f.Required {
+		hints = append(hints, "optional")
+	}
+	if len(hints) > 0 {
+		label += " [" + strings.Join(hints, ", ") + "]"
+	}
+	return label
+}
+
+// Parse returns the value of the field for the text the user entered. It returns false if the field is
+// left out of the content.
+func (f Field) Parse(input string) (any, bool, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		if f.Type == "boolean" && f.Default != nil {
+			return *f.Default, true, nil
+		}
+		if f.Required {
+			return nil, false, fmt.Errorf("a value is required")
+		}
+		return nil, false, nil
+	}
+
+	if len(f.Enum) > 0 {
+		if i, err := strconv.Atoi(input); err == nil && i >= 1 && i <= len(f.Enum) {
+			return f.Enum[i-1], true, nil
+		}
+		for i, value := range f.Enum {
+			if strings.EqualFold(input, value) || (i < len(f.EnumNames) && strings.EqualFold(input, f.EnumNames[i])) {
+				return value, true, nil
+			}
+		}
+		return nil, false, fmt.Errorf("must be one of the choices")
+	}
+
+	switch f.Type {
+	case "boolean":
+		switch strings.ToLower(input) {
+		case "y", "yes", "true":
+			return true, true, nil
+		case "n", "no", "false":
+			return false, true, nil
+		}
+		return nil, false, fmt.Errorf("must be yes or no")
+	case "integer":
+		i, err := strconv.ParseInt(input, 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("must be an integer")
+		}
+		return i, true, f.checkRange(float64(i))
+	case "number":
+		n, err := strconv.ParseFloat(input, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("must be a number")
+		}
+		return n, true, f.checkRange(n)
+	}
+
+	if length := len([]rune(input)); f.MinLength != nil && length < *f.MinLength {
+		return nil, false, fmt.Errorf("must be at least %d characters", *f.MinLength)
+	} else if f.MaxLength != nil && length > *f.MaxLength {
+		return nil, false, fmt.Errorf("must be at most %d characters", *f.MaxLength)
+	}
+
+	var err error
+	switch f.Format {
+	case "email":
+		_, err = mail.ParseAddress(input)
+	case "uri":
+		var u *url.URL
+		if u, err = url.Parse(input); err == nil && u.Scheme == "" {
+			err = fmt.Errorf("missing scheme")
+		}
+	case "date":
+		_, err = time.Parse(time.DateOnly, input)
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, input)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("must be a valid %s", f.Format)
+	}
+	return input, true, nil
+}
+
+func (f Field) checkRange(value float64) error {
+	if f.Minimum != nil {
+		if minimum, err := f.Minimum.Float64(); err == nil && value < minimum {
+			return fmt.Errorf("must be at least %s", f.Minimum)
+		}
+	}
+	if f.Maximum != nil {
+		if maximum, err := f.Maximum.Float64(); err == nil && value > maximum {
+			return fmt.Errorf("must be at most %s", f.Maximum)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package elicit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+)
+
+// Terminal returns a handler that asks the user, reading the answers from in and writing the
+// questions to out. Requests are asked one at a time.
+func Terminal(in io.Reader, out io.Writer) mcp.ElicitHandler {
+	t := &terminal{
+		in:  in,
+		out: out,
+	}
+	return t.elicit
+}
+
+type terminal struct {
+	lock  sync.Mutex
+	once  sync.Once
+	in    io.Reader
+	out   io.Writer
+	lines chan line
+}
+
+type line struct {
+	text string
+	err  error
+}
+
+// read sends the lines of in to the lines channel, so that a question that is canceled does not leave
+// a read behind that races with the next question.
+func (t *terminal) read() {
+	reader := bufio.NewReader(t.in)
+	for {
+		text, err := reader.ReadString('\n')
+		if err != nil && text != "" {
+			err = nil
+		}
+		t.lines <- line{text: strings.TrimRight(text, "\r\n"), err: err}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *terminal) elicit(ctx context.Context, req mcp.ElicitRequest) (mcp.ElicitResult, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	server, _ := Source(req)
+	if server != "" {
+		fmt.Fprintf(t.out, "\n%s asks: %s\n", server, req.Message)
+	} else {
+		fmt.Fprintf(t.out, "\n%s\n", req.Message)
+	}
+
+	fields := Fields(req.RequestedSchema)
+	if len(fields) == 0 {
+		answer, err := t.ask(ctx, "Accept? [y/N]: ")
+		if err != nil {
+			return mcp.ElicitResult{Action: Cancel}, nil
+		}
+		if yes(answer) {
+			return mcp.ElicitResult{Action: Accept}, nil
+		}
+		return mcp.ElicitResult{Action: Decline}, nil
+	}
+
+	answer, err := t.ask(ctx, "Respond? [(a)ccept, (d)ecline, (c)ancel] (a): ")
+	if err != nil {
+		return mcp.ElicitResult{Action: Cancel}, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "", "a", "accept", "y", "yes":
+	case "d", "decline", "n", "no":
+		return mcp.ElicitResult{Action: Decline}, nil
+	default:
+		return mcp.ElicitResult{Action: Cancel}, nil
+	}
+
+	content := map[string]any{}
+	for _, field := range fields {
+		for {
+			answer, err := t.ask(ctx, field.Label()+": ")
+			if err != nil {
+				return mcp.ElicitResult{Action: Cancel}, nil
+			}
+			value, ok, err := field.Parse(answer)
+			if err != nil {
+				fmt.Fprintf(t.out, "  %s %v\n", field.Name, err)
+				continue
+			}
+			if ok {
+				content[field.Name] = value
+			}
+			break
+		}
+	}
+	return mcp.ElicitResult{Action: Accept, Content: content}, nil
+}
+
+// ask writes the prompt and returns the next line the user enters. It fails if in is closed or ctx is
+// done.
+func (t *terminal) ask(ctx context.Context, prompt string) (string, error) {
+	t.once.Do(func() {
+		t.lines = make(chan line, 1)
+		go t.read()
+	})
+
+	fmt.Fprint(t.out, prompt)
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(t.out)
+		return "", ctx.Err()
+	case l := <-t.lines:
+		if l.err != nil {
+			// Keep the error for the next question, in is closed for good
+			t.lines <- l
+		}
+		return l.text, l.err
+	}
+}
+
+func yes(answer string) bool {
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
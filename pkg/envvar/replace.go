@@ -11,37 +11,37 @@ import (
 	"github.com/nanobot-ai/nanobot/pkg/log"
 )
 
-func ReplaceString(envs map[string]string, str string) string {
-	r, err := expr.EvalString(context.TODO(), envs, nil, str)
+func ReplaceString(ctx context.Context, envs map[string]string, str string) string {
+	r, err := expr.EvalString(ctx, envs, nil, str)
 	if err != nil {
-		log.Errorf(context.TODO(), "failed to evaluate expression %s: %v", str, err)
+		log.Errorf(ctx, "failed to evaluate expression %s: %v", str, err)
 		return str
 	}
 	return r
 }
 
-func ReplaceObject(envs map[string]string, obj any) error {
+func ReplaceObject(ctx context.Context, envs map[string]string, obj any) error {
 	text, err := json.Marshal(obj)
 	if err != nil {
 		return err
 	}
 	return json.Unmarshal(
-		[]byte(ReplaceString(envs, string(text))),
+		[]byte(ReplaceString(ctx, envs, string(text))),
 		obj,
 	)
 }
 
-func ReplaceMap(envs map[string]string, m map[string]string) map[string]string {
+func ReplaceMap(ctx context.Context, envs map[string]string, m map[string]string) map[string]string {
 	newMap := make(map[string]string, len(m))
 	for k, v := range m {
-		newMap[ReplaceString(envs, k)] = ReplaceString(envs, v)
+		newMap[ReplaceString(ctx, envs, k)] = ReplaceString(ctx, envs, v)
 	}
 	return newMap
 }
 
-func ReplaceEnv(envs map[string]string, command string, args []string, env map[string]string) (string, []string, []string) {
+func ReplaceEnv(ctx context.Context, envs map[string]string, command string, args []string, env map[string]string) (string, []string, []string) {
 	newEnvMap := make(map[string]string, len(env))
-	maps.Copy(newEnvMap, ReplaceMap(envs, env))
+	maps.Copy(newEnvMap, ReplaceMap(ctx, envs, env))
 
 	newEnv := make([]string, 0, len(env))
 	for _, k := range slices.Sorted(maps.Keys(newEnvMap)) {
@@ -50,7 +50,7 @@ func ReplaceEnv(envs map[string]string, command string, args []string, env map[s
 
 	newArgs := make([]string, len(args))
 	for i, arg := range args {
-		newArgs[i] = ReplaceString(envs, arg)
+		newArgs[i] = ReplaceString(ctx, envs, arg)
 	}
-	return ReplaceString(envs, command), newArgs, newEnv
+	return ReplaceString(ctx, envs, command), newArgs, newEnv
 }
@@ -0,0 +1,77 @@
+package eval
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Suite is a file of test cases that are run against an agent.
+type Suite struct {
+	Name string `json:"name,omitempty"`
+	// Agent the cases are run against, defaults to the only agent of the config.
+	Agent string `json:"agent,omitempty"`
+	// JudgeModel is the model used for judge assertions, defaults to the model of the agent.
+	JudgeModel string `json:"judgeModel,omitempty"`
+	Cases      []Case `json:"cases,omitempty"`
+}
+
+type Case struct {
+	Name string `json:"name,omitempty"`
+	// Agent overrides the agent of the suite for this case.
+	Agent string `json:"agent,omitempty"`
+	Input string `json:"input,omitempty"`
+	// ToolCalls that are expected to be made, in this order. Other calls in between are allowed.
+	ToolCalls []ExpectedToolCall `json:"toolCalls,omitempty"`
+	Assert    []Assertion        `json:"assert,omitempty"`
+}
+
+type ExpectedToolCall struct {
+	// Name of the tool, either the name the LLM sees or server/tool.
+	Name string `json:"name,omitempty"`
+	// Arguments that must be present in the call, other arguments are ignored.
+	Arguments map[string]any `json:"arguments,omitempty"`
+}
+
+// Assertion on the output of the agent. If JSONPath is set the output is parsed as JSON and the value at
+// the path is checked with Equals or Regex, otherwise Regex is matched against the output text. Judge is a
+// criteria an LLM decides the output meets.
+type Assertion struct {
+	Regex    string `json:"regex,omitempty"`
+	JSONPath string `json:"jsonPath,omitempty"`
+	Equals   any    `json:"equals,omitempty"`
+	Judge    string `json:"judge,omitempty"`
+}
+
+func Load(file string) (*Suite, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read eval file %s: %w", file, err)
+	}
+
+	var suite Suite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("failed to parse eval file %s: %w", file, err)
+	}
+
+	if suite.Name == "" {
+		suite.Name = file
+	}
+
+	for i, c := range suite.Cases {
+		if c.Name == "" {
+			suite.Cases[i].Name = fmt.Sprintf("case %d", i+1)
+		}
+		if c.Input == "" {
+			return nil, fmt.Errorf("eval case %q has no input", suite.Cases[i].Name)
+		}
+		for _, a := range c.Assert {
+			if a.Regex == "" && a.JSONPath == "" && a.Judge == "" {
+				return nil, fmt.Errorf("eval case %q has an empty assertion", suite.Cases[i].Name)
+			}
+		}
+	}
+
+	return &suite, nil
+}
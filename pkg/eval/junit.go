@@ -0,0 +1,101 @@
+package eval
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+	Duration time.Duration    `xml:"-"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the reports in the JUnit XML format understood by most CI systems, one test suite
+// per report.
+func WriteJUnit(out io.Writer, reports ...Report) error {
+	var suites junitTestSuites
+	for _, r := range reports {
+		suite := r.junit()
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Duration += r.Duration
+		suites.Suites = append(suites.Suites, suite)
+	}
+	suites.Time = fmt.Sprintf("%.3f", suites.Duration.Seconds())
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+func (r Report) junit() junitTestSuite {
+	suite := junitTestSuite{
+		Name:  r.Name,
+		Tests: len(r.Results),
+		Time:  fmt.Sprintf("%.3f", r.Duration.Seconds()),
+	}
+
+	for _, result := range r.Results {
+		tc := junitTestCase{
+			Name:      result.Name,
+			ClassName: result.Agent,
+			Time:      fmt.Sprintf("%.3f", result.Duration.Seconds()),
+			SystemOut: result.Output,
+		}
+		if result.Error != "" {
+			suite.Errors++
+			tc.Error = &junitMessage{
+				Message: result.Error,
+				Body:    result.Error,
+			}
+		} else if len(result.Failures) > 0 {
+			suite.Failures++
+			tc.Failure = &junitMessage{
+				Message: result.Failures[0],
+				Body:    strings.Join(result.Failures, "\n"),
+			}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	return suite
+}
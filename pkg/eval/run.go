@@ -0,0 +1,331 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tools"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const judgeAgent = "nanobot.eval-judge"
+
+const judgeInstructions = `You grade the response of an AI assistant against a criteria. Decide if the ` +
+	`response meets the criteria and give a short reason.`
+
+type Caller interface {
+	Call(ctx context.Context, server, tool string, args any, opts ...tools.CallOptions) (*types.CallResult, error)
+}
+
+type Report struct {
+	Name     string        `json:"name,omitempty"`
+	Results  []Result      `json:"results,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+func (r Report) Failed() (count int) {
+	for _, result := range r.Results {
+		if !result.Passed() {
+			count++
+		}
+	}
+	return
+}
+
+type Result struct {
+	Name      string           `json:"name,omitempty"`
+	Agent     string           `json:"agent,omitempty"`
+	Output    string           `json:"output,omitempty"`
+	ToolCalls []types.ToolCall `json:"toolCalls,omitempty"`
+	Failures  []string         `json:"failures,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Duration  time.Duration    `json:"duration,omitempty"`
+}
+
+func (r Result) Passed() bool {
+	return r.Error == "" && len(r.Failures) == 0
+}
+
+// Prepare resolves the agent of each case and adds the judge agent to the config if a case needs it.
+func Prepare(config *types.Config, suite *Suite) error {
+	if suite.Agent == "" && len(config.Agents) == 1 {
+		suite.Agent = slices.Collect(maps.Keys(config.Agents))[0]
+	}
+
+	var judge bool
+	for i, c := range suite.Cases {
+		if c.Agent == "" {
+			suite.Cases[i].Agent = suite.Agent
+		}
+		if suite.Cases[i].Agent == "" {
+			return fmt.Errorf("eval case %q has no agent and the config has %d agents", c.Name, len(config.Agents))
+		}
+		if _, ok := config.Agents[suite.Cases[i].Agent]; !ok {
+			return fmt.Errorf("agent %q of eval case %q not found", suite.Cases[i].Agent, c.Name)
+		}
+		for _, a := range c.Assert {
+			judge = judge || a.Judge != ""
+		}
+	}
+
+	if !judge {
+		return nil
+	}
+
+	model := config.Agents[suite.Cases[0].Agent].Model
+	if suite.JudgeModel != "" {
+		model = types.ModelList{suite.JudgeModel}
+	}
+	if config.Agents == nil {
+		config.Agents = map[string]types.Agent{}
+	}
+	chat := false
+	config.Agents[judgeAgent] = types.Agent{
+		Name:         "Eval Judge",
+		Model:        model,
+		Instructions: types.DynamicInstructions{Instructions: judgeInstructions},
+		Chat:         &chat,
+		Output: &types.OutputSchema{
+			Name: "verdict",
+			Schema: json.RawMessage(`{"type":"object","properties":{"pass":{"type":"boolean"},"reason":{"type":"string"}},` +
+				`"required":["pass","reason"],"additionalProperties":false}`),
+		},
+	}
+	return nil
+}
+
+// Run runs every case of the suite in a new session returned by newSession.
+func Run(ctx context.Context, caller Caller, suite Suite, newSession func(context.Context) context.Context) Report {
+	start := time.Now()
+	report := Report{
+		Name: suite.Name,
+	}
+	for _, c := range suite.Cases {
+		report.Results = append(report.Results, runCase(newSession(ctx), caller, c))
+	}
+	report.Duration = time.Since(start)
+	return report
+}
+
+func runCase(ctx context.Context, caller Caller, c Case) (result Result) {
+	start := time.Now()
+	result.Name = c.Name
+	result.Agent = c.Agent
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	callResult, err := caller.Call(ctx, c.Agent, c.Agent, types.SampleCallRequest{
+		Prompt: c.Input,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	result.Output = callResult.Text()
+	result.ToolCalls = ToolCalls(mcp.SessionFromContext(ctx))
+
+	if callResult.IsError {
+		result.Failures = append(result.Failures, "agent returned an error: "+result.Output)
+	}
+
+	result.Failures = append(result.Failures, checkToolCalls(c.ToolCalls, result.ToolCalls)...)
+
+	for _, a := range c.Assert {
+		if failure, err := check(ctx, caller, a, c.Input, result.Output); err != nil {
+			result.Error = err.Error()
+			return
+		} else if failure != "" {
+			result.Failures = append(result.Failures, failure)
+		}
+	}
+
+	return
+}
+
+// ToolCalls returns the tool calls of the last execution of the agent in the session.
+func ToolCalls(session *mcp.Session) (result []types.ToolCall) {
+	if session == nil {
+		return nil
+	}
+
+	var execution types.Execution
+	if !session.Get(types.PreviousExecutionKey, &execution) {
+		return nil
+	}
+
+	var messages []types.Message
+	if execution.PopulatedRequest != nil {
+		messages = execution.PopulatedRequest.Input
+	}
+	if execution.Response != nil {
+		messages = append(messages, execution.Response.Output)
+	}
+
+	for _, msg := range messages {
+		for _, item := range msg.Items {
+			if item.ToolCall != nil {
+				result = append(result, *item.ToolCall)
+			}
+		}
+	}
+	return
+}
+
+func checkToolCalls(expected []ExpectedToolCall, actual []types.ToolCall) (failures []string) {
+	i := 0
+	for _, e := range expected {
+		found := false
+		for ; i < len(actual); i++ {
+			if toolCallMatches(e, actual[i]) {
+				found = true
+				i++
+				break
+			}
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("expected tool call %s with arguments %v was not made", e.Name, e.Arguments))
+		}
+	}
+	return
+}
+
+func toolCallMatches(expected ExpectedToolCall, actual types.ToolCall) bool {
+	if expected.Name != actual.Name && expected.Name != actual.Target {
+		if _, tool, _ := strings.Cut(actual.Target, "/"); expected.Name != tool {
+			return false
+		}
+	}
+
+	if len(expected.Arguments) == 0 {
+		return true
+	}
+
+	var args map[string]any
+	if err := json.Unmarshal([]byte(actual.Arguments), &args); err != nil {
+		return false
+	}
+	for k, v := range expected.Arguments {
+		if !jsonEqual(v, args[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+func jsonEqual(a, b any) bool {
+	aData, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bData, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	var aValue, bValue any
+	_ = json.Unmarshal(aData, &aValue)
+	_ = json.Unmarshal(bData, &bValue)
+	return reflect.DeepEqual(aValue, bValue)
+}
+
+// check returns a description of the failure if the assertion does not hold for the output.
+func check(ctx context.Context, caller Caller, a Assertion, input, output string) (string, error) {
+	value := output
+	if a.JSONPath != "" {
+		var data any
+		if err := json.Unmarshal([]byte(output), &data); err != nil {
+			return fmt.Sprintf("output is not JSON, can not evaluate %s", a.JSONPath), nil
+		}
+		v, ok := lookup(data, a.JSONPath)
+		if !ok {
+			return fmt.Sprintf("%s not found in output", a.JSONPath), nil
+		}
+		if a.Equals != nil && !jsonEqual(a.Equals, v) {
+			return fmt.Sprintf("%s is %v, expected %v", a.JSONPath, v, a.Equals), nil
+		}
+		if s, ok := v.(string); ok {
+			value = s
+		} else {
+			data, _ := json.Marshal(v)
+			value = string(data)
+		}
+	}
+
+	if a.Regex != "" {
+		re, err := regexp.Compile(a.Regex)
+		if err != nil {
+			return "", fmt.Errorf("invalid regex %q: %w", a.Regex, err)
+		}
+		if !re.MatchString(value) {
+			if a.JSONPath != "" {
+				return fmt.Sprintf("%s does not match %s", a.JSONPath, a.Regex), nil
+			}
+			return fmt.Sprintf("output does not match %s", a.Regex), nil
+		}
+	}
+
+	if a.Judge != "" {
+		return judge(ctx, caller, a.Judge, input, value)
+	}
+
+	return "", nil
+}
+
+func judge(ctx context.Context, caller Caller, criteria, input, output string) (string, error) {
+	result, err := caller.Call(ctx, judgeAgent, judgeAgent, types.SampleCallRequest{
+		Prompt: fmt.Sprintf("Criteria:\n%s\n\nRequest of the user:\n%s\n\nResponse of the assistant:\n%s", criteria, input, output),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to judge output: %w", err)
+	}
+
+	var verdict struct {
+		Pass   bool   `json:"pass"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(result.Text()), &verdict); err != nil {
+		return "", fmt.Errorf("failed to parse verdict of judge: %w", err)
+	}
+	if !verdict.Pass {
+		return fmt.Sprintf("judge: %s: %s", criteria, verdict.Reason), nil
+	}
+	return "", nil
+}
+
+// lookup returns the value at a path like $.items[0].name or items.0.name.
+func lookup(data any, path string) (any, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	if path == "" {
+		return data, true
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := data.(type) {
+		case map[string]any:
+			var ok bool
+			if data, ok = v[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			data = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return data, true
+}
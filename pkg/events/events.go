@@ -0,0 +1,213 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// Path is the path of the stream of debug events.
+const Path = "/debug/events"
+
+// Types of the debug events.
+const (
+	ProviderRequest  = "provider_request"
+	ProviderResponse = "provider_response"
+	Retry            = "retry"
+	Fallback         = "fallback"
+	ToolCall         = "tool_call"
+	ToolResult       = "tool_result"
+	Guardrail        = "guardrail"
+)
+
+// Event is something nanobot did while running a turn. Events are only sent to the clients watching the
+// stream, they are not stored.
+type Event struct {
+	Time      time.Time      `json:"time"`
+	Type      string         `json:"type"`
+	SessionID string         `json:"sessionID,omitempty"`
+	UserID    string         `json:"userID,omitempty"`
+	TurnID    string         `json:"turnID,omitempty"`
+	Agent     string         `json:"agent,omitempty"`
+	Message   string         `json:"message,omitempty"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// Filter selects the events of a subscription, empty fields match all events.
+type Filter struct {
+	SessionID string
+	UserID    string
+	Types     []string
+}
+
+func (f Filter) matches(event Event) bool {
+	return (f.SessionID == "" || f.SessionID == event.SessionID) &&
+		(f.UserID == "" || f.UserID == event.UserID) &&
+		(len(f.Types) == 0 || slices.Contains(f.Types, event.Type))
+}
+
+var (
+	lock        sync.Mutex
+	subscribers = map[chan Event]Filter{}
+	watchers    = map[*mcp.Session]func(Event){}
+	count       atomic.Int32
+)
+
+// Enabled returns true if a client is watching the stream, callers can skip building events otherwise.
+func Enabled() bool {
+	return count.Load() > 0
+}
+
+// Publish sends the event to the subscribers whose filter matches it. The session, user, turn, and agent
+// of the event are filled in from ctx.
+func Publish(ctx context.Context, event Event) {
+	if !Enabled() {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	session := mcp.SessionFromContext(ctx).Root()
+	if event.SessionID == "" {
+		event.SessionID = session.ID()
+	}
+	if event.UserID == "" {
+		event.UserID = types.NanobotContext(ctx).User.ID
+	}
+	if event.UserID == "" && session != nil {
+		session.Get(types.AccountIDSessionKey, &event.UserID)
+	}
+	for _, attr := range log.Attrs(ctx) {
+		switch {
+		case attr.Key == "turn_id" && event.TurnID == "":
+			event.TurnID = attr.Value.String()
+		case attr.Key == "agent" && event.Agent == "":
+			event.Agent = attr.Value.String()
+		}
+	}
+
+	lock.Lock()
+	watcher := watchers[session]
+	for ch, filter := range subscribers {
+		if !filter.matches(event) {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+			// Drop events rather than block the agent if the client is slow
+		}
+	}
+	lock.Unlock()
+
+	if watcher != nil {
+		watcher(event)
+	}
+}
+
+// Watch calls handler with the events of the session and its child sessions until the returned function
+// is called. Unlike subscribers, which get the events of sessions by their ID, watchers also get the
+// events of sessions that are not stored and have no ID. The handler is called by the agent, so it slows
+// the turn down until it returns.
+func Watch(session *mcp.Session, handler func(Event)) func() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	watchers[session] = handler
+	count.Add(1)
+	return func() {
+		lock.Lock()
+		defer lock.Unlock()
+		if _, ok := watchers[session]; ok {
+			delete(watchers, session)
+			count.Add(-1)
+		}
+	}
+}
+
+// Subscribe returns the events that match the filter until the returned function is called.
+func Subscribe(filter Filter) (<-chan Event, func()) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	ch := make(chan Event, 1000)
+	subscribers[ch] = filter
+	count.Add(1)
+	return ch, func() {
+		lock.Lock()
+		defer lock.Unlock()
+		if _, ok := subscribers[ch]; ok {
+			delete(subscribers, ch)
+			count.Add(-1)
+		}
+	}
+}
+
+// Handler streams the events as server-sent events. The session and type query parameters filter the
+// events, type is a comma separated list. Callers of a server without auth and admins get the events of
+// all users, other users only those of their sessions, and anonymous callers of a server with auth none.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nctx := types.NanobotContext(req.Context())
+		userID, ok := nctx.AccountID(nctx.Admin)
+		if !ok {
+			http.Error(rw, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		filter := Filter{
+			SessionID: req.URL.Query().Get("session"),
+			UserID:    userID,
+		}
+		if eventTypes := req.URL.Query().Get("type"); eventTypes != "" {
+			filter.Types = strings.Split(eventTypes, ",")
+		}
+
+		events, unsubscribe := Subscribe(filter)
+		defer unsubscribe()
+
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.WriteHeader(http.StatusOK)
+		flush := func() {
+			if flusher, ok := rw.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+		flush()
+
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(rw, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case event := <-events:
+				data, err := json.Marshal(event)
+				if err != nil {
+					log.Errorf(req.Context(), "failed to marshal debug event: %v", err)
+					continue
+				}
+				if _, err := fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+					return
+				}
+			}
+			flush()
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func serve(nctx types.Context) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		Handler().ServeHTTP(rw, req.WithContext(types.WithNanobotContext(req.Context(), nctx)))
+	}))
+}
+
+func TestHandlerRejectsAnonymousCallersWithAuth(t *testing.T) {
+	srv := serve(types.Context{Auth: true})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestHandlerFiltersEventsOfOtherUsers(t *testing.T) {
+	tests := []struct {
+		name     string
+		nctx     types.Context
+		expected []string
+	}{
+		{name: "user", nctx: types.Context{Auth: true, User: types.User{ID: "alice"}}, expected: []string{"alice", "alice"}},
+		{name: "admin", nctx: types.Context{Auth: true, Admin: true, User: types.User{ID: "carol"}}, expected: []string{"bob", "alice"}},
+		{name: "no auth", nctx: types.Context{}, expected: []string{"bob", "alice"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serve(tt.nctx)
+			defer srv.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			// The handler subscribed before it sent the headers
+			for _, user := range []string{"bob", "alice", "bob", "alice"} {
+				Publish(types.WithNanobotContext(ctx, types.Context{User: types.User{ID: user}}), Event{Type: ToolCall})
+			}
+
+			var users []string
+			scanner := bufio.NewScanner(resp.Body)
+			for len(users) < len(tt.expected) && scanner.Scan() {
+				data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+				if !ok {
+					continue
+				}
+				var event Event
+				if err := json.Unmarshal([]byte(data), &event); err != nil {
+					t.Fatal(err)
+				}
+				users = append(users, event.UserID)
+			}
+			if strings.Join(users, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected events of %v, got %v", tt.expected, users)
+			}
+		})
+	}
+}
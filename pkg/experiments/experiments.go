@@ -0,0 +1,135 @@
+package experiments
+
+import (
+	"context"
+	"hash/fnv"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/analytics"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// SessionKey is the session attribute the variants a session is assigned to are stored in.
+const SessionKey = "experiments"
+
+// The variants of an experiment a session is assigned to.
+const (
+	Control = "control"
+	Variant = "variant"
+)
+
+// Assignment is the variant of an experiment a session is assigned to, and the agent that runs for it.
+type Assignment struct {
+	Variant string    `json:"variant"`
+	Agent   string    `json:"agent"`
+	Time    time.Time `json:"time"`
+}
+
+// Assignments maps the names of experiments to the assignments of a session.
+type Assignments map[string]Assignment
+
+func (a Assignments) Serialize() (any, error) {
+	return a, nil
+}
+
+func (a *Assignments) Deserialize(data any) (any, error) {
+	if err := mcp.JSONCoerce(data, a); err != nil {
+		return nil, err
+	}
+	return *a, nil
+}
+
+// Route returns the agent that runs for the agent in the session of ctx. A session is assigned to the
+// control or the variant of the experiment of the agent the first time it runs the agent in the
+// experiment, and keeps the assignment for the rest of its life, even if the percent of the experiment
+// changes. Agents that are not in an experiment, and calls without a session, run as is.
+func Route(ctx context.Context, config types.Config, agent string) string {
+	name, experiment, ok := experimentOf(config, agent)
+	if !ok {
+		return agent
+	}
+
+	session := mcp.SessionFromContext(ctx).Root()
+	if session == nil {
+		return agent
+	}
+
+	var assignments Assignments
+	session.Get(SessionKey, &assignments)
+	assignment, ok := assignments[name]
+	if !ok {
+		// Sessions that ran the agent before the experiment was added are not new, they stay on the agent
+		ranAgent := slices.ContainsFunc(analytics.Get(session).Turns, func(turn analytics.Turn) bool {
+			return turn.Agent == experiment.Agent
+		})
+		inVariant := !ranAgent && bucket(session.ID(), name) < experiment.Percent
+
+		_ = session.Update(SessionKey, &assignments, func() error {
+			if assigned, ok := assignments[name]; ok {
+				// Another call assigned the session first
+				assignment = assigned
+				return nil
+			}
+			assignment = Assignment{
+				Variant: Control,
+				Agent:   experiment.Agent,
+				Time:    time.Now().UTC(),
+			}
+			if inVariant {
+				assignment.Variant = Variant
+				assignment.Agent = experiment.Variant
+			}
+			log.Debugf(ctx, "assigned session to the %s of experiment %s, agent %s", assignment.Variant, name, assignment.Agent)
+
+			assignments = maps.Clone(assignments)
+			if assignments == nil {
+				assignments = Assignments{}
+			}
+			assignments[name] = assignment
+			return nil
+		})
+	}
+
+	// The variant of a session could have been removed from the config since it was assigned
+	if _, ok := config.Agents[assignment.Agent]; !ok {
+		return agent
+	}
+	return assignment.Agent
+}
+
+// experimentOf returns the experiment that routes the agent, by name if more than one does.
+func experimentOf(config types.Config, agent string) (string, types.Experiment, bool) {
+	for _, name := range slices.Sorted(maps.Keys(config.Experiments)) {
+		if config.Experiments[name].Agent == agent {
+			return name, config.Experiments[name], true
+		}
+	}
+	return "", types.Experiment{}, false
+}
+
+// bucket returns a number in [0, 100) that is the same for the session in the experiment, so that
+// assignments do not depend on which replica makes them. Sessions without an ID get a random bucket.
+func bucket(sessionID, experiment string) float64 {
+	if sessionID == "" {
+		return rand.Float64() * 100
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(experiment + "/" + sessionID))
+	return float64(h.Sum64()%10000) / 100
+}
+
+// FromAttributes reads the assignments from the stored attributes of a session.
+func FromAttributes(attributes map[string]any) (Assignments, error) {
+	var assignments Assignments
+	data, ok := attributes[SessionKey]
+	if !ok {
+		return assignments, nil
+	}
+	err := mcp.JSONCoerce(data, &assignments)
+	return assignments, err
+}
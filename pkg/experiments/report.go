@@ -0,0 +1,210 @@
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/analytics"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/session"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/usage"
+)
+
+// Arm is the metrics of the sessions assigned to one variant of an experiment. The turns, feedback, and
+// usage are those of the agent of the variant in the sessions.
+type Arm struct {
+	Variant  string `json:"variant"`
+	Agent    string `json:"agent,omitempty"`
+	Sessions int    `json:"sessions"`
+	analytics.Stats
+	ResolutionRate float64 `json:"resolutionRate"`
+	usage.Totals
+	// CostPerSessionUSD is the average cost of the sessions.
+	CostPerSessionUSD float64 `json:"costPerSessionUSD"`
+}
+
+// Result compares the variants of an experiment.
+type Result struct {
+	Experiment string `json:"experiment"`
+	Control    Arm    `json:"control"`
+	Variant    Arm    `json:"variant"`
+}
+
+type Report struct {
+	Experiments []Result `json:"experiments"`
+}
+
+// Session is the assignments, analytics, and usage of a stored session.
+type Session struct {
+	Assignments Assignments
+	Log         analytics.Log
+	Ledger      usage.Ledger
+}
+
+// Filter selects the sessions that are included in a report. Empty fields match all sessions.
+type Filter struct {
+	// Since is the first UTC day (YYYY-MM-DD) sessions were assigned to include.
+	Since      string
+	Experiment string
+}
+
+type arm struct {
+	agent   string
+	logs    []analytics.Log
+	ledgers []usage.Ledger
+}
+
+// NewReport compares the variants of the experiments the sessions are assigned to.
+func NewReport(filter Filter, sessions ...Session) Report {
+	arms := map[string]map[string]*arm{}
+	for _, s := range sessions {
+		for name, assignment := range s.Assignments {
+			if filter.Experiment != "" && name != filter.Experiment ||
+				filter.Since != "" && assignment.Time.UTC().Format(time.DateOnly) < filter.Since {
+				continue
+			}
+			if arms[name] == nil {
+				arms[name] = map[string]*arm{
+					Control: {},
+					Variant: {},
+				}
+			}
+			a, ok := arms[name][assignment.Variant]
+			if !ok {
+				continue
+			}
+			a.agent = assignment.Agent
+			a.logs = append(a.logs, logOf(s.Log, assignment.Agent))
+			a.ledgers = append(a.ledgers, ledgerOf(s.Ledger, assignment.Agent))
+		}
+	}
+
+	report := Report{
+		Experiments: make([]Result, 0, len(arms)),
+	}
+	for _, name := range slices.Sorted(maps.Keys(arms)) {
+		report.Experiments = append(report.Experiments, Result{
+			Experiment: name,
+			Control:    arms[name][Control].result(Control),
+			Variant:    arms[name][Variant].result(Variant),
+		})
+	}
+	return report
+}
+
+func (a *arm) result(variant string) Arm {
+	stats := analytics.NewReport(analytics.Filter{}, a.logs...)
+	result := Arm{
+		Variant:        variant,
+		Agent:          a.agent,
+		Sessions:       len(a.logs),
+		Stats:          stats.Total,
+		ResolutionRate: stats.ResolutionRate,
+		Totals:         usage.NewReport(usage.Filter{}, a.ledgers...).Total,
+	}
+	if result.Sessions > 0 {
+		result.CostPerSessionUSD = result.CostUSD / float64(result.Sessions)
+	}
+	return result
+}
+
+// logOf returns the turns and feedback of the agent in the log.
+func logOf(l analytics.Log, agent string) (result analytics.Log) {
+	for _, turn := range l.Turns {
+		if turn.Agent == agent {
+			result.Turns = append(result.Turns, turn)
+		}
+	}
+	for _, feedback := range l.Feedback {
+		if feedback.Agent == agent {
+			result.Feedback = append(result.Feedback, feedback)
+		}
+	}
+	return result
+}
+
+// ledgerOf returns the usage of the agent in the ledger.
+func ledgerOf(l usage.Ledger, agent string) (result usage.Ledger) {
+	for _, entry := range l.Entries {
+		if entry.Agent == agent {
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	return result
+}
+
+// Load returns the sessions of the account that are assigned to an experiment, or of all accounts if
+// accountID is empty.
+func Load(ctx context.Context, store *session.Store, accountID string) ([]Session, error) {
+	var (
+		sessions []session.Session
+		err      error
+	)
+	if accountID == "" {
+		sessions, err = store.List(ctx)
+	} else {
+		sessions, err = store.FindByAccountID(ctx, accountID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	var result []Session
+	for _, s := range sessions {
+		assignments, err := FromAttributes(s.State.Attributes)
+		if err != nil {
+			log.Errorf(ctx, "failed to read experiments of session %s: %v", s.SessionID, err)
+			continue
+		} else if len(assignments) == 0 {
+			continue
+		}
+		l, err := analytics.FromAttributes(s.State.Attributes)
+		if err != nil {
+			log.Errorf(ctx, "failed to read analytics of session %s: %v", s.SessionID, err)
+		}
+		ledger, err := usage.FromAttributes(s.State.Attributes)
+		if err != nil {
+			log.Errorf(ctx, "failed to read usage of session %s: %v", s.SessionID, err)
+		}
+		result = append(result, Session{
+			Assignments: assignments,
+			Log:         l,
+			Ledger:      ledger,
+		})
+	}
+	return result, nil
+}
+
+// Handler serves the report of the experiments of the sessions of the caller as JSON. Callers of a server
+// without auth, and admins that set all=true, get the report of all sessions, anonymous callers of a server
+// with auth are rejected. The since and experiment query parameters filter the sessions of the report.
+func Handler(store *session.Store) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		accountID, ok := types.NanobotContext(req.Context()).AccountID(req.URL.Query().Get("all") == "true")
+		if !ok {
+			http.Error(rw, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		sessions, err := Load(req.Context(), store, accountID)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		report := NewReport(Filter{
+			Since:      req.URL.Query().Get("since"),
+			Experiment: req.URL.Query().Get("experiment"),
+		}, sessions...)
+
+		rw.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(rw).Encode(report); err != nil {
+			log.Errorf(req.Context(), "failed to write experiments report: %v", err)
+		}
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/dop251/goja"
+	"github.com/nanobot-ai/nanobot/pkg/secrets"
 )
 
 func EvalString(ctx context.Context, env map[string]string, data map[string]any, expr string) (string, error) {
@@ -79,6 +80,7 @@ func translate(ctx context.Context, env map[string]string, data map[string]any,
 			}
 			result[key] = res
 		}
+		return result, nil
 	case string:
 		return evalString(ctx, env, data, expr)
 	}
@@ -95,13 +97,16 @@ func newRuntime(data map[string]any) (*goja.Runtime, error) {
 	return runtime, nil
 }
 
-func evalString(_ context.Context, env map[string]string, data map[string]any, expr string) (any, error) {
+func evalString(ctx context.Context, env map[string]string, data map[string]any, expr string) (any, error) {
 	if strings.TrimSpace(expr) == "" {
 		return "", nil
 	}
 
 	if strings.HasPrefix(expr, "${") && strings.HasSuffix(expr, "}") {
-		envVal, ok := Lookup(env, expr[2:len(expr)-1])
+		if ref := expr[2 : len(expr)-1]; secrets.IsReference(ref) {
+			return secrets.Resolve(ctx, ref)
+		}
+		envVal, ok := Lookup(ctx, env, expr[2:len(expr)-1])
 		if ok {
 			return envVal, nil
 		}
@@ -129,7 +134,14 @@ func evalString(_ context.Context, env map[string]string, data map[string]any, e
 		if lastErr != nil {
 			return name
 		}
-		envVal, ok := Lookup(env, name)
+		if secrets.IsReference(name) {
+			val, err := secrets.Resolve(ctx, name)
+			if err != nil {
+				lastErr = err
+			}
+			return val
+		}
+		envVal, ok := Lookup(ctx, env, name)
 		if ok {
 			return envVal
 		}
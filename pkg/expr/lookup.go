@@ -1,8 +1,12 @@
 package expr
 
 import (
+	"context"
 	"strings"
 	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/secrets"
 )
 
 func builtinEnv(envMap map[string]string, key string) (string, bool) {
@@ -25,7 +29,7 @@ func builtinEnv(envMap map[string]string, key string) (string, bool) {
 	}
 }
 
-func Lookup(envMap map[string]string, envKey string) (string, bool) {
+func Lookup(ctx context.Context, envMap map[string]string, envKey string) (string, bool) {
 	v, ok := builtinEnv(envMap, envKey)
 	if ok {
 		return v, true
@@ -33,7 +37,7 @@ func Lookup(envMap map[string]string, envKey string) (string, bool) {
 
 	val, ok := envMap[envKey]
 	if ok {
-		return val, true
+		return resolveSecret(ctx, envKey, val), true
 	}
 	for envMapKey, envMapVal := range envMap {
 		if strings.EqualFold(envKey, strings.ReplaceAll(envMapKey, "-", "_")) {
@@ -43,8 +47,23 @@ func Lookup(envMap map[string]string, envKey string) (string, bool) {
 		}
 	}
 	if ok {
-		return val, true
+		return resolveSecret(ctx, envKey, val), true
 	}
 
 	return "", false
 }
+
+// resolveSecret returns the value of the secret if val is a reference such as "${vault:secret/app#key}".
+// This allows env vars to be set to secret references instead of the secrets themselves.
+func resolveSecret(ctx context.Context, envKey, val string) string {
+	ref, ok := secrets.ParseExpression(val)
+	if !ok {
+		return val
+	}
+	secret, err := secrets.Resolve(ctx, ref)
+	if err != nil {
+		log.Errorf(ctx, "failed to resolve secret for %s: %v", envKey, err)
+		return ""
+	}
+	return secret
+}
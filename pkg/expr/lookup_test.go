@@ -0,0 +1,99 @@
+package expr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLookupResolvesSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "creds.json"), []byte(`{"user": "bob", "port": 5432}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"TOKEN":   "${file:" + filepath.Join(dir, "token") + "}",
+		"USER":    "${file:" + filepath.Join(dir, "creds.json") + "#user}",
+		"PORT":    "${file:" + filepath.Join(dir, "creds.json") + "#port}",
+		"MISSING": "${file:" + filepath.Join(dir, "missing") + "}",
+		"PLAIN":   "value",
+		"PARTIAL": "prefix ${file:" + filepath.Join(dir, "token") + "}",
+	}
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{key: "TOKEN", expected: "s3cret"},
+		{key: "USER", expected: "bob"},
+		{key: "PORT", expected: "5432"},
+		{key: "MISSING", expected: ""},
+		{key: "PLAIN", expected: "value"},
+		{key: "PARTIAL", expected: env["PARTIAL"]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			val, ok := Lookup(context.Background(), env, tt.key)
+			if !ok {
+				t.Fatalf("expected %s to be found", tt.key)
+			}
+			if val != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, val)
+			}
+		})
+	}
+}
+
+func TestLookupUsesContext(t *testing.T) {
+	var requests atomic.Int32
+	vault := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = rw.Write([]byte(`{"data": {"token": "s3cret"}}`))
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+
+	env := map[string]string{
+		"TOKEN": "${vault:secret/lookup-context#token}",
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if val, ok := Lookup(canceled, env, "TOKEN"); !ok || val != "" {
+		t.Errorf("expected the secret not to resolve with a canceled context, got %q", val)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("expected no request to vault with a canceled context, got %d", n)
+	}
+
+	if val, _ := Lookup(context.Background(), env, "TOKEN"); val != "s3cret" {
+		t.Errorf("expected the secret to resolve, got %q", val)
+	}
+}
+
+func TestEvalStringResolvesSecretExpressions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("s3cret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := EvalString(context.Background(), nil, nil, "Bearer ${file:"+path+"}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "Bearer s3cret" {
+		t.Errorf("expected %q, got %q", "Bearer s3cret", val)
+	}
+
+	if _, err := EvalString(context.Background(), nil, nil, "${file:"+filepath.Join(t.TempDir(), "missing")+"}"); err == nil {
+		t.Error("expected error for a missing secret")
+	}
+}
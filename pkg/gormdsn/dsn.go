@@ -8,13 +8,32 @@ import (
 	"time"
 
 	"github.com/glebarez/sqlite"
+	"github.com/nanobot-ai/nanobot/pkg/complete"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-func NewDBFromDSN(dsn string) (*gorm.DB, error) {
+// Options configures the connection pool of the underlying sql.DB. Zero values
+// leave the database/sql defaults in place.
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+func (o Options) Merge(other Options) (result Options) {
+	result.MaxOpenConns = complete.Last(o.MaxOpenConns, other.MaxOpenConns)
+	result.MaxIdleConns = complete.Last(o.MaxIdleConns, other.MaxIdleConns)
+	result.ConnMaxLifetime = complete.Last(o.ConnMaxLifetime, other.ConnMaxLifetime)
+	result.ConnMaxIdleTime = complete.Last(o.ConnMaxIdleTime, other.ConnMaxIdleTime)
+	return
+}
+
+func NewDBFromDSN(dsn string, opts ...Options) (*gorm.DB, error) {
+	opt := complete.Complete(opts...)
 	var dialector gorm.Dialector
 
 	switch {
@@ -30,7 +49,7 @@ func NewDBFromDSN(dsn string) (*gorm.DB, error) {
 		return nil, fmt.Errorf("unsupported database type in DSN: %s", dsn)
 	}
 
-	return gorm.Open(dialector, &gorm.Config{
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
 			SlowThreshold:             200 * time.Millisecond,
 			LogLevel:                  logger.Warn,
@@ -38,4 +57,26 @@ func NewDBFromDSN(dsn string) (*gorm.DB, error) {
 			Colorful:                  true,
 		}),
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection pool: %w", err)
+	}
+	if opt.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(opt.MaxOpenConns)
+	}
+	if opt.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(opt.MaxIdleConns)
+	}
+	if opt.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(opt.ConnMaxLifetime)
+	}
+	if opt.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(opt.ConnMaxIdleTime)
+	}
+
+	return db, nil
 }
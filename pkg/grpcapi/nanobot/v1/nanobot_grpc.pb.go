@@ -0,0 +1,380 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.29.3
+// source: nanobot/v1/nanobot.proto
+
+package nanobotv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Nanobot_CreateSession_FullMethodName = "/nanobot.v1.Nanobot/CreateSession"
+	Nanobot_DeleteSession_FullMethodName = "/nanobot.v1.Nanobot/DeleteSession"
+	Nanobot_ListAgents_FullMethodName    = "/nanobot.v1.Nanobot/ListAgents"
+	Nanobot_ListTools_FullMethodName     = "/nanobot.v1.Nanobot/ListTools"
+	Nanobot_SendMessage_FullMethodName   = "/nanobot.v1.Nanobot/SendMessage"
+	Nanobot_Chat_FullMethodName          = "/nanobot.v1.Nanobot/Chat"
+	Nanobot_StreamEvents_FullMethodName  = "/nanobot.v1.Nanobot/StreamEvents"
+)
+
+// NanobotClient is the client API for Nanobot service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Nanobot runs the agents of the config for other services. Each session is a conversation with an
+// agent, the messages of a session run one at a time.
+type NanobotClient interface {
+	// CreateSession starts a conversation with an agent.
+	CreateSession(ctx context.Context, in *CreateSessionRequest, opts ...grpc.CallOption) (*Session, error)
+	// DeleteSession ends the conversation and closes its MCP sessions.
+	DeleteSession(ctx context.Context, in *DeleteSessionRequest, opts ...grpc.CallOption) (*DeleteSessionResponse, error)
+	// ListAgents returns the agents the caller may use.
+	ListAgents(ctx context.Context, in *ListAgentsRequest, opts ...grpc.CallOption) (*ListAgentsResponse, error)
+	// ListTools returns the tools of the MCP servers and tools of the config.
+	ListTools(ctx context.Context, in *ListToolsRequest, opts ...grpc.CallOption) (*ListToolsResponse, error)
+	// SendMessage sends a message to the agent of the session and returns its answer.
+	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*MessageResult, error)
+	// Chat sends a message to the agent of the session and streams the text and tool calls of the answer,
+	// followed by the result.
+	Chat(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChatEvent], error)
+	// StreamEvents streams the events of all the messages of the session until the call is canceled or the
+	// session is deleted.
+	StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChatEvent], error)
+}
+
+type nanobotClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewNanobotClient(cc grpc.ClientConnInterface) NanobotClient {
+	return &nanobotClient{cc}
+}
+
+func (c *nanobotClient) CreateSession(ctx context.Context, in *CreateSessionRequest, opts ...grpc.CallOption) (*Session, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Session)
+	err := c.cc.Invoke(ctx, Nanobot_CreateSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nanobotClient) DeleteSession(ctx context.Context, in *DeleteSessionRequest, opts ...grpc.CallOption) (*DeleteSessionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteSessionResponse)
+	err := c.cc.Invoke(ctx, Nanobot_DeleteSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nanobotClient) ListAgents(ctx context.Context, in *ListAgentsRequest, opts ...grpc.CallOption) (*ListAgentsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAgentsResponse)
+	err := c.cc.Invoke(ctx, Nanobot_ListAgents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nanobotClient) ListTools(ctx context.Context, in *ListToolsRequest, opts ...grpc.CallOption) (*ListToolsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListToolsResponse)
+	err := c.cc.Invoke(ctx, Nanobot_ListTools_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nanobotClient) SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*MessageResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MessageResult)
+	err := c.cc.Invoke(ctx, Nanobot_SendMessage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nanobotClient) Chat(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChatEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Nanobot_ServiceDesc.Streams[0], Nanobot_Chat_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SendMessageRequest, ChatEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Nanobot_ChatClient = grpc.ServerStreamingClient[ChatEvent]
+
+func (c *nanobotClient) StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChatEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Nanobot_ServiceDesc.Streams[1], Nanobot_StreamEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamEventsRequest, ChatEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Nanobot_StreamEventsClient = grpc.ServerStreamingClient[ChatEvent]
+
+// NanobotServer is the server API for Nanobot service.
+// All implementations must embed UnimplementedNanobotServer
+// for forward compatibility.
+//
+// Nanobot runs the agents of the config for other services. Each session is a conversation with an
+// agent, the messages of a session run one at a time.
+type NanobotServer interface {
+	// CreateSession starts a conversation with an agent.
+	CreateSession(context.Context, *CreateSessionRequest) (*Session, error)
+	// DeleteSession ends the conversation and closes its MCP sessions.
+	DeleteSession(context.Context, *DeleteSessionRequest) (*DeleteSessionResponse, error)
+	// ListAgents returns the agents the caller may use.
+	ListAgents(context.Context, *ListAgentsRequest) (*ListAgentsResponse, error)
+	// ListTools returns the tools of the MCP servers and tools of the config.
+	ListTools(context.Context, *ListToolsRequest) (*ListToolsResponse, error)
+	// SendMessage sends a message to the agent of the session and returns its answer.
+	SendMessage(context.Context, *SendMessageRequest) (*MessageResult, error)
+	// Chat sends a message to the agent of the session and streams the text and tool calls of the answer,
+	// followed by the result.
+	Chat(*SendMessageRequest, grpc.ServerStreamingServer[ChatEvent]) error
+	// StreamEvents streams the events of all the messages of the session until the call is canceled or the
+	// session is deleted.
+	StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[ChatEvent]) error
+	mustEmbedUnimplementedNanobotServer()
+}
+
+// UnimplementedNanobotServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedNanobotServer struct{}
+
+func (UnimplementedNanobotServer) CreateSession(context.Context, *CreateSessionRequest) (*Session, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateSession not implemented")
+}
+func (UnimplementedNanobotServer) DeleteSession(context.Context, *DeleteSessionRequest) (*DeleteSessionResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DeleteSession not implemented")
+}
+func (UnimplementedNanobotServer) ListAgents(context.Context, *ListAgentsRequest) (*ListAgentsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListAgents not implemented")
+}
+func (UnimplementedNanobotServer) ListTools(context.Context, *ListToolsRequest) (*ListToolsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListTools not implemented")
+}
+func (UnimplementedNanobotServer) SendMessage(context.Context, *SendMessageRequest) (*MessageResult, error) {
+	return nil, status.Error(codes.Unimplemented, "method SendMessage not implemented")
+}
+func (UnimplementedNanobotServer) Chat(*SendMessageRequest, grpc.ServerStreamingServer[ChatEvent]) error {
+	return status.Error(codes.Unimplemented, "method Chat not implemented")
+}
+func (UnimplementedNanobotServer) StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[ChatEvent]) error {
+	return status.Error(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedNanobotServer) mustEmbedUnimplementedNanobotServer() {}
+func (UnimplementedNanobotServer) testEmbeddedByValue()                 {}
+
+// UnsafeNanobotServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to NanobotServer will
+// result in compilation errors.
+type UnsafeNanobotServer interface {
+	mustEmbedUnimplementedNanobotServer()
+}
+
+func RegisterNanobotServer(s grpc.ServiceRegistrar, srv NanobotServer) {
+	// If the following call panics, it indicates UnimplementedNanobotServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Nanobot_ServiceDesc, srv)
+}
+
+func _Nanobot_CreateSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NanobotServer).CreateSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Nanobot_CreateSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NanobotServer).CreateSession(ctx, req.(*CreateSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nanobot_DeleteSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NanobotServer).DeleteSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Nanobot_DeleteSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NanobotServer).DeleteSession(ctx, req.(*DeleteSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nanobot_ListAgents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAgentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NanobotServer).ListAgents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Nanobot_ListAgents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NanobotServer).ListAgents(ctx, req.(*ListAgentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nanobot_ListTools_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListToolsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NanobotServer).ListTools(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Nanobot_ListTools_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NanobotServer).ListTools(ctx, req.(*ListToolsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nanobot_SendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NanobotServer).SendMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Nanobot_SendMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NanobotServer).SendMessage(ctx, req.(*SendMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Nanobot_Chat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SendMessageRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NanobotServer).Chat(m, &grpc.GenericServerStream[SendMessageRequest, ChatEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Nanobot_ChatServer = grpc.ServerStreamingServer[ChatEvent]
+
+func _Nanobot_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NanobotServer).StreamEvents(m, &grpc.GenericServerStream[StreamEventsRequest, ChatEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Nanobot_StreamEventsServer = grpc.ServerStreamingServer[ChatEvent]
+
+// Nanobot_ServiceDesc is the grpc.ServiceDesc for Nanobot service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Nanobot_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "nanobot.v1.Nanobot",
+	HandlerType: (*NanobotServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateSession",
+			Handler:    _Nanobot_CreateSession_Handler,
+		},
+		{
+			MethodName: "DeleteSession",
+			Handler:    _Nanobot_DeleteSession_Handler,
+		},
+		{
+			MethodName: "ListAgents",
+			Handler:    _Nanobot_ListAgents_Handler,
+		},
+		{
+			MethodName: "ListTools",
+			Handler:    _Nanobot_ListTools_Handler,
+		},
+		{
+			MethodName: "SendMessage",
+			Handler:    _Nanobot_SendMessage_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Chat",
+			Handler:       _Nanobot_Chat_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _Nanobot_StreamEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "nanobot/v1/nanobot.proto",
+}
@@ -0,0 +1,412 @@
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative nanobot/v1/nanobot.proto
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	nanobotv1 "github.com/nanobot-ai/nanobot/pkg/grpcapi/nanobot/v1"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tools"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// sessionIdleTimeout is how long a session is kept without new messages.
+const sessionIdleTimeout = 24 * time.Hour
+
+type Caller interface {
+	Call(ctx context.Context, server, tool string, args any, opts ...tools.CallOptions) (*types.CallResult, error)
+	ListTools(ctx context.Context, opts ...tools.ListToolsOptions) ([]tools.ListToolsResult, error)
+}
+
+type session struct {
+	id      string
+	session *mcp.Session
+	agent   string
+	// user is the ID of the user that created the session, only that user can use it.
+	user     string
+	lastUsed time.Time
+	// busy keeps messages of the same session from running at the same time.
+	busy chan struct{}
+}
+
+// Server serves the gRPC API. Requests are served over HTTP/2 by the HTTP server of nanobot, so they
+// go through the same authentication as the other requests.
+type Server struct {
+	nanobotv1.UnimplementedNanobotServer
+
+	ctx        context.Context
+	config     types.Config
+	caller     Caller
+	newSession func(context.Context) context.Context
+	grpc       *grpc.Server
+
+	lock     sync.Mutex
+	sessions map[string]*session
+}
+
+// NewServer returns the gRPC API for the agents of the config. Sessions run in the sessions returned by
+// newSession for ctx, which should be canceled when the server stops.
+func NewServer(ctx context.Context, config types.Config, caller Caller, newSession func(context.Context) context.Context) *Server {
+	s := &Server{
+		ctx:        ctx,
+		config:     config,
+		caller:     caller,
+		newSession: newSession,
+		grpc:       grpc.NewServer(),
+		sessions:   map[string]*session{},
+	}
+	nanobotv1.RegisterNanobotServer(s.grpc, s)
+	reflection.Register(s.grpc)
+	return s
+}
+
+// Register adds the paths of the gRPC services to the mux.
+func (s *Server) Register(mux *http.ServeMux) {
+	for name := range s.grpc.GetServiceInfo() {
+		mux.Handle("POST /"+name+"/", s.grpc)
+	}
+}
+
+// Close ends all the sessions.
+func (s *Server) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, sess := range s.sessions {
+		sess.session.Close(false)
+		delete(s.sessions, id)
+	}
+}
+
+func (s *Server) CreateSession(ctx context.Context, req *nanobotv1.CreateSessionRequest) (*nanobotv1.Session, error) {
+	agents := types.NanobotContext(ctx).AllowedEntrypoints(s.config)
+	agent := req.GetAgent()
+	if agent == "" && len(agents) > 0 {
+		agent = agents[0]
+	}
+	if !slices.Contains(agents, agent) {
+		return nil, status.Errorf(codes.NotFound, "agent %q not found", agent)
+	}
+
+	sess := &session{
+		id:       uuid.String(),
+		session:  mcp.SessionFromContext(s.newSession(s.ctx)),
+		agent:    agent,
+		user:     types.NanobotContext(ctx).User.ID,
+		lastUsed: time.Now(),
+		busy:     make(chan struct{}, 1),
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.dropIdle()
+	s.sessions[sess.id] = sess
+
+	return &nanobotv1.Session{
+		Id:    sess.id,
+		Agent: sess.agent,
+	}, nil
+}
+
+// dropIdle closes the sessions that have been idle for too long, the lock must be held.
+func (s *Server) dropIdle() {
+	now := time.Now()
+	for id, sess := range s.sessions {
+		select {
+		case sess.busy <- struct{}{}:
+			// Sessions with a message running are in use even if they were not used recently.
+			if now.Sub(sess.lastUsed) > sessionIdleTimeout {
+				sess.session.Close(false)
+				delete(s.sessions, id)
+			}
+			<-sess.busy
+		default:
+		}
+	}
+}
+
+func (s *Server) session(ctx context.Context, id string) (*session, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || sess.user != types.NanobotContext(ctx).User.ID {
+		return nil, status.Errorf(codes.NotFound, "session %q not found", id)
+	}
+	sess.lastUsed = time.Now()
+	return sess, nil
+}
+
+func (s *Server) DeleteSession(ctx context.Context, req *nanobotv1.DeleteSessionRequest) (*nanobotv1.DeleteSessionResponse, error) {
+	sess, err := s.session(ctx, req.GetSessionId())
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	delete(s.sessions, sess.id)
+	s.lock.Unlock()
+
+	sess.session.Close(false)
+	return &nanobotv1.DeleteSessionResponse{}, nil
+}
+
+func (s *Server) ListAgents(ctx context.Context, _ *nanobotv1.ListAgentsRequest) (*nanobotv1.ListAgentsResponse, error) {
+	var resp nanobotv1.ListAgentsResponse
+	for _, id := range types.NanobotContext(ctx).AllowedEntrypoints(s.config) {
+		agent := s.config.Agents[id]
+		resp.Agents = append(resp.Agents, &nanobotv1.Agent{
+			Id:              id,
+			Name:            agent.Name,
+			Description:     agent.Description,
+			StarterMessages: agent.StarterMessages,
+		})
+	}
+	return &resp, nil
+}
+
+func (s *Server) ListTools(ctx context.Context, req *nanobotv1.ListToolsRequest) (*nanobotv1.ListToolsResponse, error) {
+	if req.GetSessionId() != "" {
+		sess, err := s.session(ctx, req.GetSessionId())
+		if err != nil {
+			return nil, err
+		}
+		ctx = mcp.WithSession(ctx, sess.session)
+	} else {
+		ctx = s.newSession(ctx)
+		defer mcp.SessionFromContext(ctx).Close(false)
+	}
+
+	results, err := s.caller.ListTools(ctx, tools.ListToolsOptions{
+		Servers: req.GetServers(),
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list tools: %v", err)
+	}
+
+	var (
+		nctx = types.NanobotContext(ctx)
+		resp nanobotv1.ListToolsResponse
+	)
+	for _, result := range results {
+		for _, tool := range result.Tools {
+			if !nctx.ToolAllowed(tool.Name, result.Server, tool.Name) {
+				continue
+			}
+			resp.Tools = append(resp.Tools, &nanobotv1.Tool{
+				Server:          result.Server,
+				Name:            tool.Name,
+				Description:     tool.Description,
+				InputSchemaJson: string(tool.InputSchema),
+			})
+		}
+	}
+	return &resp, nil
+}
+
+func (s *Server) SendMessage(ctx context.Context, req *nanobotv1.SendMessageRequest) (*nanobotv1.MessageResult, error) {
+	return s.send(ctx, req, nil)
+}
+
+func (s *Server) Chat(req *nanobotv1.SendMessageRequest, stream grpc.ServerStreamingServer[nanobotv1.ChatEvent]) error {
+	result, err := s.send(stream.Context(), req, stream.Send)
+	if err != nil {
+		return err
+	}
+	return stream.Send(&nanobotv1.ChatEvent{
+		Event: &nanobotv1.ChatEvent_Result{
+			Result: result,
+		},
+	})
+}
+
+// send runs the agent of the session with the message. If events is set, the events of the message are
+// sent to it while the agent runs.
+func (s *Server) send(ctx context.Context, req *nanobotv1.SendMessageRequest, events func(*nanobotv1.ChatEvent) error) (*nanobotv1.MessageResult, error) {
+	sess, err := s.session(ctx, req.GetSessionId())
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case sess.busy <- struct{}{}:
+		defer func() { <-sess.busy }()
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+
+	args := types.SampleCallRequest{
+		Prompt: req.GetPrompt(),
+	}
+	for _, attachment := range req.GetAttachments() {
+		args.Attachments = append(args.Attachments, toAttachment(attachment))
+	}
+
+	var (
+		progressToken = uuid.String()
+		opts          tools.CallOptions
+	)
+	ctx = mcp.WithSession(ctx, sess.session)
+	if events != nil {
+		opts.ProgressToken = progressToken
+		remove := sess.session.AddFilter(eventFilter(ctx, progressToken, events))
+		defer remove()
+	}
+
+	result, err := s.caller.Call(ctx, sess.agent, sess.agent, args, opts)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to run agent %s: %v", sess.agent, err)
+	}
+	return &nanobotv1.MessageResult{
+		Content: toContents(result.Content),
+		IsError: result.IsError,
+	}, nil
+}
+
+func (s *Server) StreamEvents(req *nanobotv1.StreamEventsRequest, stream grpc.ServerStreamingServer[nanobotv1.ChatEvent]) error {
+	sess, err := s.session(stream.Context(), req.GetSessionId())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	remove := sess.session.AddFilter(eventFilter(ctx, "", func(event *nanobotv1.ChatEvent) error {
+		if err := stream.Send(event); err != nil {
+			cancel()
+			return err
+		}
+		return nil
+	}))
+	defer remove()
+
+	context.AfterFunc(sess.session.Context(), cancel)
+	<-ctx.Done()
+	return nil
+}
+
+// eventFilter returns a filter of the messages of the session that sends the progress of completions to
+// send. If progressToken is set, only the progress of the call with the token is sent.
+func eventFilter(ctx context.Context, progressToken string, send func(*nanobotv1.ChatEvent) error) mcp.MessageFilter {
+	// Tool calls can run in parallel, sends to the stream must not overlap.
+	var lock sync.Mutex
+	return func(_ context.Context, msg *mcp.Message) (*mcp.Message, error) {
+		if msg.Method != "notifications/progress" || ctx.Err() != nil {
+			return msg, nil
+		}
+
+		var progress mcp.NotificationProgressRequest
+		if err := json.Unmarshal(msg.Params, &progress); err != nil {
+			return msg, nil
+		}
+		if progressToken != "" && fmt.Sprint(progress.ProgressToken) != progressToken {
+			return msg, nil
+		}
+
+		var completion types.CompletionProgress
+		if err := mcp.JSONCoerce(progress.Meta[types.CompletionProgressMetaKey], &completion); err != nil {
+			return msg, nil
+		}
+
+		if event := toEvent(completion); event != nil {
+			lock.Lock()
+			// A client that stopped reading only loses its events, the agent keeps running.
+			_ = send(event)
+			lock.Unlock()
+		}
+		return msg, nil
+	}
+}
+
+func toEvent(progress types.CompletionProgress) *nanobotv1.ChatEvent {
+	item := progress.Item
+	switch {
+	case item.Partial && item.Content != nil && item.Content.Type == "text" && item.Content.Text != "":
+		return &nanobotv1.ChatEvent{
+			Event: &nanobotv1.ChatEvent_TextDelta{
+				TextDelta: &nanobotv1.TextDelta{
+					Agent: progress.Agent,
+					Text:  item.Content.Text,
+				},
+			},
+		}
+	case item.Partial:
+		return nil
+	case item.ToolCallResult != nil:
+		result := &nanobotv1.ToolResult{
+			Agent:   progress.Agent,
+			CallId:  item.ToolCallResult.CallID,
+			IsError: item.ToolCallResult.Output.IsError,
+			Content: toContents(item.ToolCallResult.Output.Content),
+		}
+		if item.ToolCall != nil {
+			result.Name = item.ToolCall.Name
+		}
+		return &nanobotv1.ChatEvent{
+			Event: &nanobotv1.ChatEvent_ToolResult{
+				ToolResult: result,
+			},
+		}
+	case item.ToolCall != nil && item.ToolCall.Name != "":
+		return &nanobotv1.ChatEvent{
+			Event: &nanobotv1.ChatEvent_ToolCall{
+				ToolCall: &nanobotv1.ToolCall{
+					Agent:     progress.Agent,
+					CallId:    item.ToolCall.CallID,
+					Name:      item.ToolCall.Name,
+					Arguments: item.ToolCall.Arguments,
+				},
+			},
+		}
+	}
+	return nil
+}
+
+func toAttachment(attachment *nanobotv1.Attachment) types.Attachment {
+	url := attachment.GetUri()
+	if url == "" {
+		url = "data:" + attachment.GetMimeType() + ";base64," + base64.StdEncoding.EncodeToString(attachment.GetData())
+	}
+	return types.Attachment{
+		URL:      url,
+		Name:     attachment.GetName(),
+		MimeType: attachment.GetMimeType(),
+	}
+}
+
+func toContents(contents []mcp.Content) (result []*nanobotv1.Content) {
+	for _, content := range contents {
+		c := &nanobotv1.Content{
+			Type:     content.Type,
+			Text:     content.Text,
+			MimeType: content.MIMEType,
+			Uri:      content.URI,
+		}
+		if content.Data != "" {
+			c.Data, _ = base64.StdEncoding.DecodeString(content.Data)
+		}
+		if content.Resource != nil {
+			c.Uri = content.Resource.URI
+			c.MimeType = content.Resource.MIMEType
+			c.Text = content.Resource.Text
+			if content.Resource.Blob != "" {
+				c.Data, _ = base64.StdEncoding.DecodeString(content.Resource.Blob)
+			}
+		}
+		result = append(result, c)
+	}
+	return result
+}
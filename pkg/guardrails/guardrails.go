@@ -0,0 +1,412 @@
+package guardrails
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/events"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/middleware"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+const DecisionsSessionKey = "guardrails/decisions"
+
+// Decision is an entry of the log of the guardrails that failed in a session.
+type Decision struct {
+	Agent     string `json:"agent"`
+	Guardrail string `json:"guardrail"`
+	// Stage is input or output.
+	Stage  string    `json:"stage"`
+	Action string    `json:"action"`
+	Reason string    `json:"reason,omitempty"`
+	UserID string    `json:"userID,omitempty"`
+	User   string    `json:"user,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+type Decisions []Decision
+
+func (d Decisions) Serialize() (any, error) {
+	return d, nil
+}
+
+func (d *Decisions) Deserialize(data any) (any, error) {
+	if err := mcp.JSONCoerce(data, d); err != nil {
+		return nil, err
+	}
+	return *d, nil
+}
+
+// decisionsLock serializes updates of the decisions of a session.
+var decisionsLock sync.Mutex
+
+// GetDecisions returns the decisions recorded in the session.
+func GetDecisions(session *mcp.Session) Decisions {
+	var decisions Decisions
+	session.Root().Get(DecisionsSessionKey, &decisions)
+	return decisions
+}
+
+func record(ctx context.Context, d Decision) {
+	log.Infof(ctx, "guardrail %s of agent %s failed on %s, action %s: %s", d.Guardrail, d.Agent, d.Stage, d.Action, d.Reason)
+	events.Publish(ctx, events.Event{
+		Type:    events.Guardrail,
+		Agent:   d.Agent,
+		Message: d.Reason,
+		Data: map[string]any{
+			"guardrail": d.Guardrail,
+			"stage":     d.Stage,
+			"action":    d.Action,
+		},
+	})
+
+	session := mcp.SessionFromContext(ctx).Root()
+	if session == nil {
+		return
+	}
+
+	user := types.NanobotContext(ctx).User
+	d.UserID = user.ID
+	d.User = user.Email
+	if d.User == "" {
+		d.User = user.Login
+	}
+	if d.UserID == "" {
+		session.Get(types.AccountIDSessionKey, &d.UserID)
+	}
+
+	var decisions Decisions
+	_ = session.Update(DecisionsSessionKey, &decisions, func() error {
+		decisions = append(slices.Clip(decisions), d)
+		return nil
+	})
+}
+
+// Checker runs guardrails, moderation uses the moderator and judges use the completer.
+type Checker struct {
+	completer types.Completer
+	moderator types.Moderator
+}
+
+func NewChecker(completer types.Completer, moderator types.Moderator) *Checker {
+	return &Checker{
+		completer: completer,
+		moderator: moderator,
+	}
+}
+
+// Middleware returns the middleware that runs the guardrails of the agent on the last message of the
+// user and on the output of the model.
+func (c *Checker) Middleware(agentName string, guardrails types.Guardrails) middleware.Middleware {
+	return &guard{
+		checker:    c,
+		agent:      agentName,
+		guardrails: guardrails,
+	}
+}
+
+type guard struct {
+	middleware.Base
+	checker    *Checker
+	agent      string
+	guardrails types.Guardrails
+}
+
+// result of a failed guardrail, rewritten is the text to use instead when the action is rewrite.
+type result struct {
+	reason    string
+	rewritten string
+}
+
+func (g *guard) BeforeCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	if len(g.guardrails.Input) == 0 || len(req.Input) == 0 {
+		return nil, nil
+	}
+
+	last := req.Input[len(req.Input)-1]
+	if last.Role != "user" || !hasText(last.Items) {
+		// Tool results are not the input of the user
+		return nil, nil
+	}
+
+	items, blocked, err := g.run(ctx, "input", g.guardrails.Input, req.Model, last.Items)
+	if err != nil {
+		return nil, err
+	}
+	if blocked != "" {
+		now := time.Now()
+		return &types.CompletionResponse{
+			Agent: g.agent,
+			Model: req.Model,
+			Output: types.Message{
+				ID:      uuid.String(),
+				Created: &now,
+				Role:    "assistant",
+				Items:   textItems(blocked),
+			},
+		}, nil
+	}
+
+	last.Items = items
+	req.Input = append(slices.Clone(req.Input[:len(req.Input)-1]), last)
+	return nil, nil
+}
+
+func (g *guard) AfterCompletion(ctx context.Context, req types.CompletionRequest, resp *types.CompletionResponse) error {
+	if len(g.guardrails.Output) == 0 || !hasText(resp.Output.Items) {
+		return nil
+	}
+
+	items, blocked, err := g.run(ctx, "output", g.guardrails.Output, req.Model, resp.Output.Items)
+	if err != nil {
+		return err
+	}
+	if blocked != "" {
+		// Tool calls of blocked output are dropped too
+		resp.Output.Items = textItems(blocked)
+		return nil
+	}
+	resp.Output.Items = items
+	return nil
+}
+
+// run checks the text of the items with the guardrails in order. It returns the items with the text
+// rewritten, or the message to reply with if a guardrail blocked them.
+func (g *guard) run(ctx context.Context, stage string, guardrails []types.Guardrail, model string, items []types.CompletionItem) ([]types.CompletionItem, string, error) {
+	items = slices.Clone(items)
+	for _, guardrail := range guardrails {
+		res, err := g.checker.check(ctx, guardrail, model, text(items))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to run %s guardrail %s: %w", stage, guardrail.GetName(), err)
+		}
+		if res == nil {
+			continue
+		}
+
+		record(ctx, Decision{
+			Agent:     g.agent,
+			Guardrail: guardrail.GetName(),
+			Stage:     stage,
+			Action:    guardrail.GetAction(),
+			Reason:    res.reason,
+			Time:      time.Now(),
+		})
+
+		switch guardrail.GetAction() {
+		case types.GuardrailBlock:
+			return nil, guardrail.GetMessage(), nil
+		case types.GuardrailRewrite:
+			items = rewrite(guardrail, items, res.rewritten)
+		}
+	}
+	return items, "", nil
+}
+
+// check returns the result of the guardrail if the text fails it, nil if it passes.
+func (c *Checker) check(ctx context.Context, guardrail types.Guardrail, model, input string) (*result, error) {
+	switch {
+	case len(guardrail.Keywords) > 0:
+		if match := keywordsRegexp(guardrail.Keywords).FindString(input); match != "" {
+			return &result{reason: fmt.Sprintf("matched keyword %q", match)}, nil
+		}
+	case guardrail.Regex != "":
+		re, err := regexp.Compile(guardrail.Regex)
+		if err != nil {
+			return nil, err
+		}
+		if match := re.FindString(input); match != "" {
+			return &result{reason: fmt.Sprintf("matched %q", match)}, nil
+		}
+	case guardrail.Moderation != nil:
+		return c.moderate(ctx, *guardrail.Moderation, input)
+	case guardrail.Judge != nil:
+		return c.judge(ctx, *guardrail.Judge, model, input)
+	}
+	return nil, nil
+}
+
+func keywordsRegexp(keywords []string) *regexp.Regexp {
+	quoted := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		quoted = append(quoted, regexp.QuoteMeta(keyword))
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
+
+func (c *Checker) moderate(ctx context.Context, moderation types.Moderation, input string) (*result, error) {
+	if c.moderator == nil {
+		return nil, fmt.Errorf("moderation is not available")
+	}
+
+	resp, err := c.moderator.Moderate(ctx, moderation, input)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := moderation.Categories
+	if len(categories) == 0 {
+		categories = slices.Collect(maps.Keys(resp.Categories))
+		categories = append(categories, slices.Collect(maps.Keys(resp.Scores))...)
+	}
+
+	var failed []string
+	for _, category := range categories {
+		if slices.Contains(failed, category) {
+			continue
+		}
+		if moderation.Threshold > 0 && resp.Scores[category] >= moderation.Threshold ||
+			moderation.Threshold == 0 && resp.Categories[category] {
+			failed = append(failed, category)
+		}
+	}
+	if len(failed) == 0 {
+		return nil, nil
+	}
+	slices.Sort(failed)
+	return &result{reason: "flagged for " + strings.Join(failed, ", ")}, nil
+}
+
+var judgeSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "violation": {"type": "boolean"},
+    "reason": {"type": "string"},
+    "rewrite": {"type": "string"}
+  },
+  "required": ["violation", "reason", "rewrite"],
+  "additionalProperties": false
+}`)
+
+const judgePrompt = `You check text against a rubric. Decide if the text violates the rubric. If it does, give the
+reason and a rewrite of the text that does not violate it. If it does not, the reason and the rewrite are
+empty. Respond with only JSON.
+
+Rubric:
+%s`
+
+type judgement struct {
+	Violation bool   `json:"violation"`
+	Reason    string `json:"reason"`
+	Rewrite   string `json:"rewrite"`
+}
+
+func (c *Checker) judge(ctx context.Context, judge types.Judge, model, input string) (*result, error) {
+	if judge.Model != "" {
+		model = judge.Model
+	}
+
+	resp, err := c.completer.Complete(ctx, types.CompletionRequest{
+		Model:        model,
+		SystemPrompt: fmt.Sprintf(judgePrompt, judge.Rubric),
+		Input: []types.Message{
+			{
+				ID:    uuid.String(),
+				Role:  "user",
+				Items: textItems(input),
+			},
+		},
+		OutputSchema: &types.OutputSchema{
+			Name:   "judgement",
+			Schema: judgeSchema,
+			Strict: true,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output := strings.TrimSpace(text(resp.Output.Items))
+	output = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(output, "```json"), "```"), "```")
+
+	var j judgement
+	if err := json.Unmarshal([]byte(output), &j); err != nil {
+		return nil, fmt.Errorf("failed to decode judgement %q: %w", output, err)
+	}
+	if !j.Violation {
+		return nil, nil
+	}
+	return &result{
+		reason:    j.Reason,
+		rewritten: j.Rewrite,
+	}, nil
+}
+
+// rewrite replaces the matches of keywords and regex guardrails in the text items, the text of other
+// guardrails is replaced as a whole by the rewritten text or the message of the guardrail.
+func rewrite(guardrail types.Guardrail, items []types.CompletionItem, rewritten string) []types.CompletionItem {
+	var re *regexp.Regexp
+	switch {
+	case len(guardrail.Keywords) > 0:
+		re = keywordsRegexp(guardrail.Keywords)
+	case guardrail.Regex != "":
+		re = regexp.MustCompile(guardrail.Regex)
+	default:
+		if rewritten == "" {
+			rewritten = guardrail.GetMessage()
+		}
+		var (
+			result   []types.CompletionItem
+			replaced bool
+		)
+		for _, item := range items {
+			if isText(item) {
+				if replaced {
+					continue
+				}
+				item.Content = &mcp.Content{Type: "text", Text: rewritten}
+				replaced = true
+			}
+			result = append(result, item)
+		}
+		return result
+	}
+
+	for i, item := range items {
+		if isText(item) {
+			content := *item.Content
+			content.Text = re.ReplaceAllLiteralString(content.Text, guardrail.GetReplacement())
+			items[i].Content = &content
+		}
+	}
+	return items
+}
+
+func isText(item types.CompletionItem) bool {
+	return item.Content != nil && item.Content.Type == "text"
+}
+
+func hasText(items []types.CompletionItem) bool {
+	return slices.ContainsFunc(items, isText)
+}
+
+func text(items []types.CompletionItem) string {
+	var texts []string
+	for _, item := range items {
+		if isText(item) {
+			texts = append(texts, item.Content.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func textItems(text string) []types.CompletionItem {
+	return []types.CompletionItem{
+		{
+			ID: uuid.String(),
+			Content: &mcp.Content{
+				Type: "text",
+				Text: text,
+			},
+		},
+	}
+}
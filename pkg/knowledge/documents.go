@@ -0,0 +1,255 @@
+package knowledge
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/net/html"
+)
+
+// extensions are the documents that are indexed when a source is a directory or a glob pattern.
+var extensions = []string{".md", ".markdown", ".txt", ".html", ".htm", ".pdf"}
+
+// listFiles returns the documents of the sources, which are files, directories, or glob patterns with
+// optional ** segments that match any number of directories.
+func listFiles(sources []string) ([]string, error) {
+	seen := map[string]bool{}
+	add := func(path string) {
+		seen[filepath.Clean(path)] = true
+	}
+
+	for _, source := range sources {
+		if !strings.ContainsAny(source, "*?[") {
+			info, err := os.Stat(source)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read knowledge source %s: %w", source, err)
+			}
+			if !info.IsDir() {
+				add(source)
+				continue
+			}
+		}
+
+		root, pattern := splitGlob(source)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !slices.Contains(extensions, strings.ToLower(filepath.Ext(path))) {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			if pattern == "" || matchGlob(strings.Split(pattern, "/"), strings.Split(filepath.ToSlash(rel), "/")) {
+				add(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read knowledge source %s: %w", source, err)
+		}
+	}
+
+	return slices.Sorted(func(yield func(string) bool) {
+		for path := range seen {
+			if !yield(path) {
+				return
+			}
+		}
+	}), nil
+}
+
+// splitGlob splits a glob pattern into the directory before the first segment with a wildcard and the
+// pattern of the rest. The pattern is empty if source has no wildcards.
+func splitGlob(source string) (root, pattern string) {
+	segments := strings.Split(filepath.ToSlash(source), "/")
+	for i, segment := range segments {
+		if strings.ContainsAny(segment, "*?[") {
+			root = strings.Join(segments[:i], "/")
+			if root == "" && strings.HasPrefix(source, "/") {
+				root = "/"
+			} else if root == "" {
+				root = "."
+			}
+			return filepath.FromSlash(root), strings.Join(segments[i:], "/")
+		}
+	}
+	return source, ""
+}
+
+func matchGlob(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchGlob(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchGlob(pattern[1:], name[1:])
+}
+
+// readDocument returns the text of the document.
+func readDocument(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return readPDF(path)
+	case ".html", ".htm":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return htmlText(data)
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+func readPDF(path string) (string, error) {
+	f, reader, err := pdf.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open PDF %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var buf strings.Builder
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to read page %d of PDF %s: %w", i, path, err)
+		}
+		buf.WriteString(text)
+		buf.WriteString("\n\n")
+	}
+	return buf.String(), nil
+}
+
+// htmlText returns the text of the HTML document without the markup, scripts, and styles. Block elements
+// start a new paragraph.
+func htmlText(data []byte) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		buf  strings.Builder
+		walk func(*html.Node)
+	)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+				buf.WriteString(text)
+				buf.WriteString(" ")
+			}
+			return
+		case html.ElementNode:
+			switch n.Data {
+			case "script", "style", "noscript", "head":
+				return
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "p", "div", "section", "article", "li", "tr", "br", "h1", "h2", "h3", "h4", "h5", "h6", "pre", "blockquote", "table":
+				buf.WriteString("\n\n")
+			}
+		}
+	}
+	walk(doc)
+	return buf.String(), nil
+}
+
+// chunk splits the text into chunks of at most size characters, preferring paragraph boundaries. Each
+// chunk starts with the last overlap characters of the chunk before, so that context is not lost at the
+// boundaries.
+func chunk(text string, size, overlap int) []string {
+	var (
+		chunks  []string
+		current []rune
+		// pending is true if current has text that is not part of a chunk yet, not only the overlap.
+		pending bool
+	)
+
+	flush := func() {
+		pending = false
+		if trimmed := strings.TrimSpace(string(current)); trimmed != "" {
+			chunks = append(chunks, trimmed)
+		}
+		if overlap > 0 && len(current) > overlap {
+			current = append([]rune(nil), current[len(current)-overlap:]...)
+		} else {
+			current = nil
+		}
+	}
+
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		runes := []rune(strings.TrimSpace(paragraph))
+		if len(runes) == 0 {
+			continue
+		}
+
+		if len(current) > 0 && len(current)+len(runes)+2 > size {
+			flush()
+		}
+
+		split := false
+		for len(current)+len(runes) > size {
+			n := max(size-len(current), 1)
+			current = append(current, runes[:n]...)
+			runes = runes[n:]
+			pending = true
+			split = true
+			flush()
+		}
+
+		// The rest of a split paragraph continues the overlap without a paragraph break.
+		if len(current) > 0 && !split {
+			current = append(current, '\n', '\n')
+		}
+		current = append(current, runes...)
+		pending = true
+	}
+
+	if pending {
+		flush()
+	}
+	return chunks
+}
@@ -0,0 +1,337 @@
+package knowledge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/gormdsn"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/memory"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"gorm.io/gorm"
+)
+
+// embedBatchSize is the number of chunks embedded per request.
+const embedBatchSize = 64
+
+type Options struct {
+	// DSN is the database that keeps track of the indexed documents, so that unchanged documents are not
+	// indexed again after a restart. Without it all documents are indexed once per process.
+	DSN       string
+	DBOptions gormdsn.Options
+}
+
+func (o Options) Merge(other Options) (result Options) {
+	result.DSN = complete.Last(o.DSN, other.DSN)
+	result.DBOptions = o.DBOptions.Merge(other.DBOptions)
+	return
+}
+
+// Service indexes the knowledge sources of agents in their vector store and searches them.
+type Service struct {
+	memory *memory.Service
+	opt    Options
+
+	dbOnce sync.Once
+	db     *gorm.DB
+	dbErr  error
+
+	lock    sync.Mutex
+	indexes map[string]*index
+}
+
+// document is an indexed document of the knowledge of an agent.
+type document struct {
+	Agent   string `gorm:"primaryKey"`
+	Path    string `gorm:"primaryKey"`
+	Size    int64
+	ModTime time.Time
+	// Hash is the hash of the text of the document and the settings it was chunked and embedded with.
+	Hash   string
+	Chunks int
+}
+
+func (document) TableName() string {
+	return "knowledge_documents"
+}
+
+type index struct {
+	lock      sync.Mutex
+	loaded    bool
+	checked   time.Time
+	documents map[string]document
+}
+
+func New(memory *memory.Service, opts ...Options) *Service {
+	return &Service{
+		memory:  memory,
+		opt:     complete.Complete(opts...),
+		indexes: map[string]*index{},
+	}
+}
+
+func (s *Service) getDB() (*gorm.DB, error) {
+	s.dbOnce.Do(func() {
+		if s.opt.DSN == "" {
+			return
+		}
+		s.db, s.dbErr = gormdsn.NewDBFromDSN(s.opt.DSN, s.opt.DBOptions)
+		if s.dbErr == nil {
+			s.dbErr = s.db.AutoMigrate(&document{})
+		}
+	})
+	return s.db, s.dbErr
+}
+
+func (s *Service) getIndex(agentName string) *index {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	idx, ok := s.indexes[agentName]
+	if !ok {
+		idx = &index{
+			documents: map[string]document{},
+		}
+		s.indexes[agentName] = idx
+	}
+	return idx
+}
+
+func namespace(agentName string) string {
+	return "knowledge/" + agentName
+}
+
+// chunkID is the ID of the chunk in the store. It has the format of a UUID, which some stores require.
+func chunkID(agentName, path string, i int) string {
+	h := sha256.Sum256([]byte(agentName + "\x00" + path + "\x00" + strconv.Itoa(i)))
+	id := hex.EncodeToString(h[:16])
+	return id[:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:]
+}
+
+func chunkIDs(agentName, path string, count int) []string {
+	ids := make([]string, 0, count)
+	for i := range count {
+		ids = append(ids, chunkID(agentName, path, i))
+	}
+	return ids
+}
+
+// IndexAll indexes the knowledge of all agents of the config, logging the errors.
+func (s *Service) IndexAll(ctx context.Context, config types.Config) {
+	for _, agentName := range slices.Sorted(maps.Keys(config.Agents)) {
+		if config.Agents[agentName].Knowledge == nil {
+			continue
+		}
+		if err := s.Index(ctx, config, agentName); err != nil {
+			log.Errorf(ctx, "failed to index knowledge of agent %s: %v", agentName, err)
+		}
+	}
+}
+
+// Index brings the index of the knowledge of the agent up to date with its sources, if they were not
+// checked within the refresh interval. Only new and changed documents are embedded.
+func (s *Service) Index(ctx context.Context, config types.Config, agentName string) error {
+	knowledge := config.Agents[agentName].Knowledge
+	if knowledge == nil {
+		return nil
+	}
+
+	idx := s.getIndex(agentName)
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	if time.Since(idx.checked) < knowledge.GetRefresh() {
+		return nil
+	}
+
+	db, err := s.getDB()
+	if err != nil {
+		return fmt.Errorf("failed to open knowledge database: %w", err)
+	}
+
+	if !idx.loaded && db != nil {
+		var documents []document
+		if err := db.WithContext(ctx).Where("agent = ?", agentName).Find(&documents).Error; err != nil {
+			return fmt.Errorf("failed to load indexed documents: %w", err)
+		}
+		for _, doc := range documents {
+			idx.documents[doc.Path] = doc
+		}
+	}
+	idx.loaded = true
+
+	store, err := s.memory.Store(config, knowledge.Store)
+	if err != nil {
+		return err
+	}
+
+	files, err := listFiles(knowledge.Sources)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, path := range files {
+		if err := s.indexDocument(ctx, db, store, idx, *knowledge, agentName, path); err != nil {
+			errs = append(errs, fmt.Errorf("failed to index %s: %w", path, err))
+		}
+	}
+
+	for path, doc := range idx.documents {
+		if slices.Contains(files, path) {
+			continue
+		}
+		if err := s.removeDocument(ctx, db, store, idx, doc); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s from index: %w", path, err))
+		}
+	}
+
+	// Documents that failed are tried again after the refresh interval.
+	idx.checked = time.Now()
+	return errors.Join(errs...)
+}
+
+func (s *Service) indexDocument(ctx context.Context, db *gorm.DB, store memory.Store, idx *index, knowledge types.Knowledge, agentName, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	existing, exists := idx.documents[path]
+	if exists && existing.Size == info.Size() && existing.ModTime.Equal(info.ModTime()) {
+		return nil
+	}
+
+	text, err := readDocument(path)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\x00%d\x00%d\x00", knowledge.GetEmbeddingModel(), knowledge.GetChunkSize(), knowledge.GetChunkOverlap())
+	h.Write([]byte(text))
+
+	doc := document{
+		Agent:   agentName,
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hex.EncodeToString(h.Sum(nil)),
+	}
+
+	if !exists || existing.Hash != doc.Hash {
+		log.Infof(ctx, "indexing knowledge document %s of agent %s", path, agentName)
+		if exists {
+			if err := store.Delete(ctx, chunkIDs(agentName, path, existing.Chunks)...); err != nil {
+				return err
+			}
+		}
+
+		chunks := chunk(text, knowledge.GetChunkSize(), knowledge.GetChunkOverlap())
+		source := displayPath(path)
+		for start := 0; start < len(chunks); start += embedBatchSize {
+			batch := chunks[start:min(start+embedBatchSize, len(chunks))]
+			vectors, err := s.memory.Embed(ctx, knowledge.GetEmbeddingModel(), batch)
+			if err != nil {
+				return fmt.Errorf("failed to embed chunks: %w", err)
+			}
+
+			records := make([]memory.Record, 0, len(batch))
+			for i, text := range batch {
+				records = append(records, memory.Record{
+					ID:        chunkID(agentName, path, start+i),
+					Namespace: namespace(agentName),
+					Text:      "Source: " + source + "\n\n" + text,
+					Vector:    vectors[i],
+					Created:   info.ModTime(),
+				})
+			}
+			if err := store.Add(ctx, records...); err != nil {
+				return fmt.Errorf("failed to store chunks: %w", err)
+			}
+		}
+		doc.Chunks = len(chunks)
+	} else {
+		doc.Chunks = existing.Chunks
+	}
+
+	if db != nil {
+		if err := db.WithContext(ctx).Save(&doc).Error; err != nil {
+			return err
+		}
+	}
+	idx.documents[path] = doc
+	return nil
+}
+
+func (s *Service) removeDocument(ctx context.Context, db *gorm.DB, store memory.Store, idx *index, doc document) error {
+	if err := store.Delete(ctx, chunkIDs(doc.Agent, doc.Path, doc.Chunks)...); err != nil {
+		return err
+	}
+	if db != nil {
+		if err := db.WithContext(ctx).Delete(&doc).Error; err != nil {
+			return err
+		}
+	}
+	delete(idx.documents, doc.Path)
+	return nil
+}
+
+// displayPath returns the path relative to the working directory if it is below it.
+func displayPath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+// Search returns the chunks of the knowledge of the agent most relevant to the query.
+func (s *Service) Search(ctx context.Context, config types.Config, agentName, query string) ([]memory.Match, error) {
+	knowledge := config.Agents[agentName].Knowledge
+	if knowledge == nil {
+		return nil, fmt.Errorf("agent %s has no knowledge", agentName)
+	}
+
+	if err := s.Index(ctx, config, agentName); err != nil {
+		// Search what was indexed
+		log.Errorf(ctx, "failed to index knowledge of agent %s: %v", agentName, err)
+	}
+
+	store, err := s.memory.Store(config, knowledge.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors, err := s.memory.Embed(ctx, knowledge.GetEmbeddingModel(), []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	return store.Search(ctx, namespace(agentName), vectors[0], knowledge.GetTopK(), knowledge.MinScore)
+}
+
+// Format returns the matches as text for the LLM.
+func Format(matches []memory.Match) string {
+	if len(matches) == 0 {
+		return "No relevant documents found."
+	}
+	var texts []string
+	for _, match := range matches {
+		texts = append(texts, match.Text)
+	}
+	return strings.Join(texts, "\n\n---\n\n")
+}
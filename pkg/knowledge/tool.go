@@ -0,0 +1,46 @@
+package knowledge
+
+import (
+	"encoding/json"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// SearchTool is the name of the tool agents with knowledge search it with, and the target name of its tool mapping.
+const SearchTool = "search_knowledge"
+
+var inputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "query": {
+      "type": "string",
+      "description": "What to search for, phrased as a question or the topic to find"
+    }
+  },
+  "required": ["query"]
+}`)
+
+// Args are the arguments of a search tool call.
+type Args struct {
+	Query string `json:"query"`
+}
+
+// ToolMappings returns the search tool of the agent if it has knowledge.
+func ToolMappings(agentName string, knowledge *types.Knowledge) types.ToolMappings {
+	result := types.ToolMappings{}
+	if knowledge == nil {
+		return result
+	}
+
+	result[SearchTool] = types.TargetMapping[mcp.Tool]{
+		MCPServer:  agentName,
+		TargetName: SearchTool,
+		Target: mcp.Tool{
+			Name:        SearchTool,
+			Description: "Search the knowledge base of documents for passages relevant to the query.",
+			InputSchema: inputSchema,
+		},
+	}
+	return result
+}
@@ -6,15 +6,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/complete"
 	"github.com/nanobot-ai/nanobot/pkg/llm/progress"
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
 	"github.com/nanobot-ai/nanobot/pkg/log"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
 	"github.com/nanobot-ai/nanobot/pkg/types"
 )
 
@@ -26,9 +27,11 @@ type Config struct {
 	APIKey  string
 	BaseURL string
 	Headers map[string]string
+	// PromptCaching adds cache breakpoints to requests so that repeated prompt prefixes are cached.
+	PromptCaching bool
 }
 
-// NewClient creates a new OpenAI client with the provided API key and base URL.
+// NewClient creates a new Anthropic client with the provided API key and base URL.
 func NewClient(cfg Config) *Client {
 	if cfg.BaseURL == "" {
 		cfg.BaseURL = "https://api.anthropic.com/v1"
@@ -51,23 +54,52 @@ func NewClient(cfg Config) *Client {
 	}
 }
 
+// Check lists the models of the API, a request that costs nothing, to verify the API key and base URL.
+func (c *Client) Check(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/models", nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range c.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return retry.NewStatusError("Anthropic API", httpResp)
+	}
+	return nil
+}
+
 func (c *Client) Complete(ctx context.Context, completionRequest types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error) {
-	req, err := toRequest(&completionRequest)
+	req, err := toRequest(&completionRequest, c.PromptCaching)
 	if err != nil {
 		return nil, err
 	}
+	if completionRequest.FrequencyPenalty != nil || completionRequest.PresencePenalty != nil || completionRequest.Seed != nil {
+		log.Debugf(ctx, "the Anthropic API has no penalties or seed, ignoring them for %s", completionRequest.Model)
+	}
 
 	ts := time.Now()
-	resp, err := c.complete(ctx, completionRequest.Agent, req, opts...)
+	resp, err := c.complete(ctx, completionRequest.Agent, req, completionRequest.Reasoning.Exposed(), opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return toResponse(resp, ts)
+	var outputTool string
+	if completionRequest.OutputSchema != nil {
+		outputTool = completionRequest.OutputSchema.Name
+	}
+	return toResponse(resp, ts, outputTool)
 
 }
 
-func (c *Client) complete(ctx context.Context, agentName string, req Request, opts ...types.CompletionOptions) (*Response, error) {
+// complete streams the response, the thinking of the model is sent as progress if exposeReasoning is true.
+func (c *Client) complete(ctx context.Context, agentName string, req Request, exposeReasoning bool, opts ...types.CompletionOptions) (*Response, error) {
 	var (
 		opt = complete.Complete(opts...)
 	)
@@ -84,14 +116,13 @@ func (c *Client) complete(ctx context.Context, agentName string, req Request, op
 		httpReq.Header.Set(key, value)
 	}
 
-	httpResp, err := http.DefaultClient.Do(httpReq)
+	httpResp, err := transport.Client.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
 	defer httpResp.Body.Close()
 	if httpResp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(httpResp.Body)
-		return nil, fmt.Errorf("failed to get response from Anthropic API: %s %q", httpResp.Status, string(body))
+		return nil, retry.NewStatusError("Anthropic API", httpResp)
 	}
 
 	var (
@@ -118,6 +149,11 @@ func (c *Client) complete(ctx context.Context, agentName string, req Request, op
 		switch delta.Type {
 		case "message_start":
 			resp = delta.Message
+			progress.SendUsage(ctx, types.CompletionProgress{
+				Model:     resp.Model,
+				Agent:     agentName,
+				MessageID: resp.ID,
+			}, toUsage(resp.Usage), "", opt.ProgressToken)
 		case "content_block_start":
 			partialJSON = ""
 			resp.Content = append(resp.Content, delta.ContentBlock)
@@ -141,6 +177,29 @@ func (c *Client) complete(ctx context.Context, agentName string, req Request, op
 						},
 					}, opt.ProgressToken)
 				}
+			case "thinking_delta":
+				if contentIndex >= 0 && resp.Content[contentIndex].Thinking != nil {
+					*resp.Content[contentIndex].Thinking += delta.Delta.Thinking
+					if exposeReasoning {
+						progress.Send(ctx, &types.CompletionProgress{
+							Model:     resp.Model,
+							Agent:     agentName,
+							MessageID: resp.ID,
+							Item: types.CompletionItem{
+								ID:      fmt.Sprintf("%s-%d", resp.ID, contentIndex),
+								Partial: true,
+								HasMore: true,
+								Reasoning: &types.Reasoning{
+									Summary: []types.SummaryText{{Text: delta.Delta.Thinking}},
+								},
+							},
+						}, opt.ProgressToken)
+					}
+				}
+			case "signature_delta":
+				if contentIndex >= 0 {
+					resp.Content[contentIndex].Signature += delta.Delta.Signature
+				}
 			case "input_json_delta":
 				partialJSON += delta.Delta.PartialJSON
 				if contentIndex >= 0 {
@@ -169,7 +228,9 @@ func (c *Client) complete(ctx context.Context, agentName string, req Request, op
 				}
 				resp.Content[contentIndex].Input = args
 			}
-			if contentIndex >= 0 {
+			// Only the deltas of thinking blocks are sent, redacted thinking has none
+			if contentIndex >= 0 && resp.Content[contentIndex].Type != "redacted_thinking" &&
+				(resp.Content[contentIndex].Type != "thinking" || exposeReasoning) {
 				progress.Send(ctx, &types.CompletionProgress{
 					Model:     resp.Model,
 					Agent:     agentName,
@@ -181,14 +242,33 @@ func (c *Client) complete(ctx context.Context, agentName string, req Request, op
 				}, opt.ProgressToken)
 			}
 		case "message_delta":
+			var usage Usage
 			err := json.Unmarshal([]byte(body), &struct {
 				Delta *Response `json:"delta"`
+				Usage *Usage    `json:"usage"`
 			}{
 				Delta: &resp,
+				Usage: &usage,
 			})
 			if err != nil {
 				return nil, fmt.Errorf("failed to unmarshal message delta: %w", err)
 			}
+			// The usage in the message delta is cumulative, the input tokens were reported in message_start
+			if usage.OutputTokens != nil {
+				if resp.Usage == nil {
+					resp.Usage = &Usage{}
+				}
+				resp.Usage.OutputTokens = usage.OutputTokens
+			}
+			var stopReason string
+			if resp.StopReason != nil {
+				stopReason = *resp.StopReason
+			}
+			progress.SendUsage(ctx, types.CompletionProgress{
+				Model:     resp.Model,
+				Agent:     agentName,
+				MessageID: resp.ID,
+			}, toUsage(resp.Usage), stopReason, opt.ProgressToken)
 		case "message_stop":
 			// nothing to do, but here for completeness
 		}
@@ -3,13 +3,31 @@ package anthropic
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
 	"github.com/nanobot-ai/nanobot/pkg/types"
 )
 
-func toResponse(resp *Response, created time.Time) (*types.CompletionResponse, error) {
+// The signatures of thinking blocks and the data of redacted thinking blocks are stored in the encrypted
+// content of reasoning items with these prefixes, so that only the reasoning of Anthropic models is sent
+// back to them.
+const (
+	thinkingPrefix         = types.AnthropicReasoningPrefix + "thinking:"
+	redactedThinkingPrefix = types.AnthropicReasoningPrefix + "redacted-thinking:"
+)
+
+// thinkingBudgets are the thinking tokens of the reasoning efforts, 1024 is the minimum of the API.
+var thinkingBudgets = map[string]int{
+	"minimal": 1024,
+	"low":     1024,
+	"medium":  8192,
+	"high":    24576,
+}
+
+// toResponse converts the response, a call of outputTool is converted to the text output of the model.
+func toResponse(resp *Response, created time.Time, outputTool string) (*types.CompletionResponse, error) {
 	result := &types.CompletionResponse{
 		Model: resp.Model,
 		Output: types.Message{
@@ -20,7 +38,16 @@ func toResponse(resp *Response, created time.Time) (*types.CompletionResponse, e
 	}
 
 	for contentIndex, content := range resp.Content {
-		if content.Type == "tool_use" {
+		if content.Type == "tool_use" && outputTool != "" && content.Name == outputTool {
+			args, _ := json.Marshal(content.Input)
+			result.Output.Items = append(result.Output.Items, types.CompletionItem{
+				ID: fmt.Sprintf("%s-%d", resp.ID, contentIndex),
+				Content: &mcp.Content{
+					Type: "text",
+					Text: string(args),
+				},
+			})
+		} else if content.Type == "tool_use" {
 			args, _ := json.Marshal(content.Input)
 			result.Output.Items = append(result.Output.Items, types.CompletionItem{
 				ID: fmt.Sprintf("%s-%d", resp.ID, contentIndex),
@@ -38,6 +65,21 @@ func toResponse(resp *Response, created time.Time) (*types.CompletionResponse, e
 					Text: *content.Text,
 				},
 			})
+		} else if content.Type == "thinking" && content.Thinking != nil {
+			result.Output.Items = append(result.Output.Items, types.CompletionItem{
+				ID: fmt.Sprintf("%s-%d", resp.ID, contentIndex),
+				Reasoning: &types.Reasoning{
+					EncryptedContent: thinkingPrefix + content.Signature,
+					Summary:          []types.SummaryText{{Text: *content.Thinking}},
+				},
+			})
+		} else if content.Type == "redacted_thinking" {
+			result.Output.Items = append(result.Output.Items, types.CompletionItem{
+				ID: fmt.Sprintf("%s-%d", resp.ID, contentIndex),
+				Reasoning: &types.Reasoning{
+					EncryptedContent: redactedThinkingPrefix + content.Data,
+				},
+			})
 		} else if content.Type == "image" {
 			result.Output.Items = append(result.Output.Items, types.CompletionItem{
 				ID: fmt.Sprintf("%s-%d", resp.ID, contentIndex),
@@ -50,23 +92,66 @@ func toResponse(resp *Response, created time.Time) (*types.CompletionResponse, e
 		}
 	}
 
+	result.Usage = toUsage(resp.Usage)
+
 	return result, nil
 }
 
-func toRequest(req *types.CompletionRequest) (Request, error) {
-	// TODO: handle output schema
+func toUsage(usage *Usage) *types.Usage {
+	if usage == nil {
+		return nil
+	}
+	result := &types.Usage{}
+	for _, tokens := range []*int{usage.InputTokens, usage.CacheCreationInputTokens, usage.CacheReadInputTokens} {
+		if tokens != nil {
+			result.InputTokens += *tokens
+		}
+	}
+	if usage.OutputTokens != nil {
+		result.OutputTokens = *usage.OutputTokens
+	}
+	return result
+}
 
+func toRequest(req *types.CompletionRequest, promptCaching bool) (Request, error) {
 	if req.MaxTokens == 0 {
 		req.MaxTokens = 64_000
 	}
 
 	result := Request{
-		Model:       req.Model,
-		System:      req.SystemPrompt,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
-		TopP:        req.TopP,
-		Metadata:    req.Metadata,
+		Model:         req.Model,
+		MaxTokens:     req.MaxTokens,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+		Metadata:      req.Metadata,
+	}
+
+	if req.Reasoning != nil {
+		budget, ok := thinkingBudgets[req.Reasoning.Effort]
+		if !ok {
+			budget = thinkingBudgets["medium"]
+		}
+		// The thinking tokens count towards the max tokens, which must be more than the budget
+		if result.MaxTokens <= budget {
+			result.MaxTokens += budget
+		}
+		result.Thinking = &Thinking{
+			Type:         "enabled",
+			BudgetTokens: budget,
+		}
+		// Extended thinking does not work with a temperature or top P other than the defaults
+		result.Temperature = nil
+		result.TopP = nil
+	}
+
+	if req.SystemPrompt != "" {
+		result.System = []Content{
+			{
+				Type: "text",
+				Text: &req.SystemPrompt,
+			},
+		}
 	}
 
 	for _, tool := range req.Tools {
@@ -96,8 +181,42 @@ func toRequest(req *types.CompletionRequest) (Request, error) {
 		}
 	}
 
+	if req.OutputSchema != nil && len(req.OutputSchema.ToSchema()) > 0 {
+		// Structured output is done with a tool whose input is the output of the model.
+		description := req.OutputSchema.Description
+		if description == "" {
+			description = "Respond with the final output by calling this tool."
+		}
+		result.Tools = append(result.Tools, CustomTool{
+			Name:        req.OutputSchema.Name,
+			InputSchema: req.OutputSchema.ToSchema(),
+			Description: description,
+		})
+		if len(req.Tools) == 0 && result.ToolChoice == nil {
+			result.ToolChoice = &ToolChoice{
+				Type: "tool",
+				Name: req.OutputSchema.Name,
+			}
+		}
+	}
+
+	if result.Thinking != nil && result.ToolChoice != nil && result.ToolChoice.Type == "tool" {
+		// Extended thinking can not be combined with forcing the use of a tool
+		result.ToolChoice = &ToolChoice{
+			Type: "auto",
+		}
+	}
+
 	for _, msg := range req.Input {
 		for _, input := range msg.Items {
+			if thinking, ok := reasoningToThinking(input.Reasoning); ok {
+				// The API combines consecutive messages of the assistant, so the thinking block is part of the
+				// turn with the tool call that follows it, as required
+				result.Messages = append(result.Messages, Message{
+					Content: []Content{thinking},
+					Role:    "assistant",
+				})
+			}
 			if input.Content != nil {
 				result.Messages = append(result.Messages, Message{
 					Content: contentToContent([]mcp.Content{*input.Content}),
@@ -137,9 +256,63 @@ func toRequest(req *types.CompletionRequest) (Request, error) {
 		}
 	}
 
+	if promptCaching {
+		addCacheControl(&result)
+	}
+
 	return result, nil
 }
 
+// addCacheControl marks the end of the tools, system prompt, and the conversation so far as cache
+// breakpoints. Anthropic caches the prompt prefix up to each breakpoint and the next request with the
+// same prefix reuses it.
+func addCacheControl(req *Request) {
+	ephemeral := &CacheControl{
+		Type: "ephemeral",
+	}
+
+	if len(req.Tools) > 0 {
+		req.Tools[len(req.Tools)-1].CacheControl = ephemeral
+	}
+	if len(req.System) > 0 {
+		req.System[len(req.System)-1].CacheControl = ephemeral
+	}
+	if len(req.Messages) > 0 {
+		lastMsg := req.Messages[len(req.Messages)-1]
+		if len(lastMsg.Content) > 0 {
+			lastMsg.Content[len(lastMsg.Content)-1].CacheControl = ephemeral
+		}
+	}
+}
+
+// reasoningToThinking converts the reasoning of an Anthropic model to its thinking block, the reasoning
+// of other models is left out.
+func reasoningToThinking(reasoning *types.Reasoning) (Content, bool) {
+	if reasoning == nil {
+		return Content{}, false
+	}
+	if data, ok := strings.CutPrefix(reasoning.EncryptedContent, redactedThinkingPrefix); ok {
+		return Content{
+			Type: "redacted_thinking",
+			Data: data,
+		}, true
+	}
+	signature, ok := strings.CutPrefix(reasoning.EncryptedContent, thinkingPrefix)
+	if !ok {
+		return Content{}, false
+	}
+	var text strings.Builder
+	for _, summary := range reasoning.Summary {
+		text.WriteString(summary.Text)
+	}
+	thinking := text.String()
+	return Content{
+		Type:      "thinking",
+		Thinking:  &thinking,
+		Signature: signature,
+	}, true
+}
+
 func contentToContent(content []mcp.Content) (result []Content) {
 	for _, item := range content {
 		if item.Type == "text" || item.Type == "" {
@@ -151,11 +324,53 @@ func contentToContent(content []mcp.Content) (result []Content) {
 			result = append(result, Content{
 				Type: "image",
 				Source: ImageSource{
+					Type:      "base64",
 					MediaType: item.MIMEType,
 					Data:      item.Data,
 				},
 			})
+		} else if item.Type == "resource" && item.Resource != nil {
+			if doc, ok := resourceToDocument(item.Resource); ok {
+				result = append(result, doc)
+			}
 		}
 	}
 	return
 }
+
+// resourceToDocument converts embedded resources to document blocks. Anthropic reads PDFs and plain
+// text documents, other binary resources are left out.
+func resourceToDocument(resource *mcp.EmbeddedResource) (Content, bool) {
+	switch {
+	case resource.Text != "":
+		return Content{
+			Type:  "document",
+			Title: resource.URI,
+			Source: ImageSource{
+				Type:      "text",
+				MediaType: "text/plain",
+				Data:      resource.Text,
+			},
+		}, true
+	case resource.Blob != "" && resource.MIMEType == "application/pdf":
+		return Content{
+			Type:  "document",
+			Title: resource.URI,
+			Source: ImageSource{
+				Type:      "base64",
+				MediaType: resource.MIMEType,
+				Data:      resource.Blob,
+			},
+		}, true
+	case resource.Blob != "" && strings.HasPrefix(resource.MIMEType, "image/"):
+		return Content{
+			Type: "image",
+			Source: ImageSource{
+				Type:      "base64",
+				MediaType: resource.MIMEType,
+				Data:      resource.Blob,
+			},
+		}, true
+	}
+	return Content{}, false
+}
@@ -10,12 +10,19 @@ type Request struct {
 	Model         string         `json:"model"`
 	StopSequences []string       `json:"stop_sequences,omitempty"`
 	Stream        bool           `json:"stream,omitempty"`
-	System        string         `json:"system,omitempty"`
+	System        []Content      `json:"system,omitempty"`
 	Temperature   *json.Number   `json:"temperature,omitempty"`
 	ToolChoice    *ToolChoice    `json:"tool_choice,omitempty"`
 	Tools         []CustomTool   `json:"tools,omitempty"`
 	TopP          *json.Number   `json:"top_p,omitempty"`
 	Metadata      map[string]any `json:"metadata,omitempty"`
+	Thinking      *Thinking      `json:"thinking,omitempty"`
+}
+
+type Thinking struct {
+	// Type is always "enabled"
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
 }
 
 type Response struct {
@@ -58,9 +65,12 @@ type Content struct {
 	// Type = text
 	Text *string `json:"text,omitempty"`
 
-	// Type = image
+	// Type = image or document
 	Source ImageSource `json:"source,omitzero"`
 
+	// Type = document
+	Title string `json:"title,omitempty"`
+
 	// Type = tool_use
 	ID    string         `json:"id,omitempty"`
 	Input map[string]any `json:"input,omitzero"`
@@ -70,25 +80,40 @@ type Content struct {
 	ToolUseID string    `json:"tool_use_id,omitempty"`
 	Content   []Content `json:"content,omitempty"`
 	IsError   bool      `json:"is_error,omitempty"`
+
+	// Type = thinking
+	Thinking  *string `json:"thinking,omitempty"`
+	Signature string  `json:"signature,omitempty"`
+
+	// Type = redacted_thinking
+	Data string `json:"data,omitempty"`
+
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+type CacheControl struct {
+	// Type is always "ephemeral"
+	Type string `json:"type"`
 }
 
 type ImageSource struct {
 	Type string `json:"type"`
 
-	// Type = base64
-	Data      string `json:"data"`
-	MediaType string `json:"media_type"`
+	// Type = base64 or text
+	Data      string `json:"data,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
 
 	// Type = url
-	URL string `json:"url"`
+	URL string `json:"url,omitempty"`
 }
 
 type CustomTool struct {
-	Type        string          `json:"type,omitempty"`
-	Name        string          `json:"name,omitempty"`
-	InputSchema json.RawMessage `json:"input_schema,omitzero"`
-	Description string          `json:"description,omitempty"`
-	Attributes  map[string]any  `json:"-"`
+	Type         string          `json:"type,omitempty"`
+	Name         string          `json:"name,omitempty"`
+	InputSchema  json.RawMessage `json:"input_schema,omitzero"`
+	Description  string          `json:"description,omitempty"`
+	CacheControl *CacheControl   `json:"cache_control,omitempty"`
+	Attributes   map[string]any  `json:"-"`
 }
 
 func (c *CustomTool) UnmarshalJSON(data []byte) error {
@@ -106,6 +131,7 @@ func (c *CustomTool) UnmarshalJSON(data []byte) error {
 	delete(c.Attributes, "input_schema")
 	delete(c.Attributes, "strict")
 	delete(c.Attributes, "description")
+	delete(c.Attributes, "cache_control")
 	c.Type = ""
 
 	return nil
@@ -165,4 +191,6 @@ type Delta struct {
 	Type        string `json:"type"`
 	Text        string `json:"text,omitempty"`
 	PartialJSON string `json:"partial_json,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
+	Signature   string `json:"signature,omitempty"`
 }
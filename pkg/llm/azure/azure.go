@@ -0,0 +1,64 @@
+package azure
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/llm/responses"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"golang.org/x/oauth2"
+)
+
+// NewClient returns a client of the Responses API of the Azure OpenAI resource of the provider. The
+// model of requests must be the name of the deployment.
+func NewClient(provider types.Provider) *responses.Client {
+	var (
+		endpoint   = strings.TrimSuffix(provider.Endpoint, "/")
+		apiVersion = cmp.Or(provider.APIVersion, types.DefaultAzureAPIVersion)
+		cfg        = responses.Config{
+			Headers: map[string]string{},
+		}
+	)
+
+	if !strings.Contains(endpoint, "/openai") {
+		endpoint += "/openai"
+	}
+	if apiVersion == "v1" {
+		// The v1 API is versioned by its path instead of the api-version parameter
+		cfg.BaseURL = strings.TrimSuffix(endpoint, "/v1") + "/v1"
+	} else {
+		cfg.BaseURL = endpoint
+		cfg.DeploymentPaths = true
+		cfg.Query = map[string]string{
+			"api-version": apiVersion,
+		}
+	}
+
+	if provider.Auth == types.AzureAuthEntra {
+		tokens := oauth2.ReuseTokenSource(nil, newTokenSource(provider))
+		cfg.Authorize = func(req *http.Request) error {
+			token, err := tokens.Token()
+			if err != nil {
+				return fmt.Errorf("failed to get Entra ID token: %w", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+			return nil
+		}
+	} else {
+		cfg.Headers["api-key"] = cmp.Or(provider.APIKey, os.Getenv("AZURE_OPENAI_API_KEY"))
+	}
+
+	return responses.NewClient(cfg)
+}
+
+// HasCredentials returns false if requests to the provider can not be authenticated.
+func HasCredentials(provider types.Provider) bool {
+	if provider.Auth == types.AzureAuthEntra {
+		// Managed identities need no configuration, so there are always credentials to try
+		return true
+	}
+	return cmp.Or(provider.APIKey, os.Getenv("AZURE_OPENAI_API_KEY")) != ""
+}
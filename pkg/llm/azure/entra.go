@@ -0,0 +1,140 @@
+package azure
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	cognitiveServicesResource = "https://cognitiveservices.azure.com"
+	imdsEndpoint              = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// newTokenSource returns the Entra ID tokens of the first identity that is configured: the service
+// principal with a client secret, the workload identity of a Kubernetes pod, or the managed identity
+// of the VM or App Service.
+func newTokenSource(provider types.Provider) oauth2.TokenSource {
+	var (
+		tenantID      = cmp.Or(provider.TenantID, os.Getenv("AZURE_TENANT_ID"))
+		clientID      = cmp.Or(provider.ClientID, os.Getenv("AZURE_CLIENT_ID"))
+		clientSecret  = cmp.Or(provider.ClientSecret, os.Getenv("AZURE_CLIENT_SECRET"))
+		tokenFile     = os.Getenv("AZURE_FEDERATED_TOKEN_FILE")
+		authorityHost = cmp.Or(os.Getenv("AZURE_AUTHORITY_HOST"), "https://login.microsoftonline.com/")
+		cfg           = clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     strings.TrimSuffix(authorityHost, "/") + "/" + tenantID + "/oauth2/v2.0/token",
+			Scopes:       []string{cognitiveServicesResource + "/.default"},
+			AuthStyle:    oauth2.AuthStyleInParams,
+		}
+	)
+
+	switch {
+	case clientSecret != "" && tenantID != "":
+		return cfg.TokenSource(context.Background())
+	case tokenFile != "" && tenantID != "":
+		return &workloadIdentity{
+			config:    cfg,
+			tokenFile: tokenFile,
+		}
+	default:
+		return &managedIdentity{
+			clientID: clientID,
+		}
+	}
+}
+
+// workloadIdentity exchanges the federated token that Kubernetes writes to a file, and rotates, for an
+// Entra ID token.
+type workloadIdentity struct {
+	config    clientcredentials.Config
+	tokenFile string
+}
+
+func (w *workloadIdentity) Token() (*oauth2.Token, error) {
+	assertion, err := os.ReadFile(w.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read federated token: %w", err)
+	}
+	cfg := w.config
+	cfg.EndpointParams = url.Values{
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {string(bytes.TrimSpace(assertion))},
+	}
+	return cfg.Token(context.Background())
+}
+
+// managedIdentity gets tokens from the identity endpoint of App Service and Functions, or from the
+// instance metadata service of VMs and AKS nodes.
+type managedIdentity struct {
+	clientID string
+}
+
+func (m *managedIdentity) Token() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	query := url.Values{
+		"resource": {cognitiveServicesResource},
+	}
+	if m.clientID != "" {
+		query.Set("client_id", m.clientID)
+	}
+
+	endpoint, header := imdsEndpoint, "Metadata"
+	headerValue := "true"
+	query.Set("api-version", "2018-02-01")
+	if identityEndpoint := os.Getenv("IDENTITY_ENDPOINT"); identityEndpoint != "" {
+		endpoint, header, headerValue = identityEndpoint, "X-IDENTITY-HEADER", os.Getenv("IDENTITY_HEADER")
+		query.Set("api-version", "2019-08-01")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(header, headerValue)
+
+	resp, err := transport.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get managed identity token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get managed identity token: %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode managed identity token: %w", err)
+	}
+
+	result := &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+	}
+	if seconds, err := strconv.ParseInt(token.ExpiresIn, 10, 64); err == nil {
+		result.Expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+	} else if unix, err := strconv.ParseInt(token.ExpiresOn, 10, 64); err == nil {
+		result.Expiry = time.Unix(unix, 0)
+	}
+	return result, nil
+}
@@ -0,0 +1,280 @@
+package bedrock
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/llm/progress"
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+const api = "Bedrock API"
+
+type Client struct {
+	region      string
+	baseURL     string
+	credentials credentials
+}
+
+// NewClient creates a client of the Converse API of Bedrock in the region of the provider.
+func NewClient(provider types.Provider) *Client {
+	region := cmp.Or(provider.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))
+	return &Client{
+		region:      region,
+		baseURL:     cmp.Or(strings.TrimSuffix(provider.Endpoint, "/"), "https://bedrock-runtime."+region+".amazonaws.com"),
+		credentials: loadCredentials(provider),
+	}
+}
+
+// HasCredentials returns false if there are no AWS credentials to sign requests with.
+func HasCredentials(provider types.Provider) bool {
+	return !loadCredentials(provider).empty()
+}
+
+func (c *Client) validate() error {
+	if c.region == "" {
+		return fmt.Errorf("bedrock provider has no region, set region or AWS_REGION")
+	}
+	if c.credentials.empty() {
+		return fmt.Errorf("bedrock provider has no AWS credentials, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY or AWS_BEARER_TOKEN_BEDROCK")
+	}
+	return nil
+}
+
+// Check lists the foundation models of the region, a request that costs nothing, to verify the
+// credentials.
+func (c *Client) Check(ctx context.Context) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://bedrock."+c.region+".amazonaws.com/foundation-models", nil)
+	if err != nil {
+		return err
+	}
+	c.credentials.sign(httpReq, nil, c.region, "bedrock", time.Now())
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return retry.NewStatusError(api, httpResp)
+	}
+	return nil
+}
+
+func (c *Client) Complete(ctx context.Context, completionRequest types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error) {
+	req, err := toRequest(&completionRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := time.Now()
+	resp, err := c.complete(ctx, completionRequest.Agent, completionRequest.Model, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputTool string
+	if completionRequest.OutputSchema != nil {
+		outputTool = completionRequest.OutputSchema.Name
+	}
+	return toResponse(resp, ts, outputTool), nil
+}
+
+func (c *Client) complete(ctx context.Context, agentName, model string, req Request, opts ...types.CompletionOptions) (*Response, error) {
+	opt := complete.Complete(opts...)
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	data, _ := json.Marshal(req)
+	log.Messages(ctx, "bedrock-api", true, data)
+
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bedrock endpoint: %w", err)
+	}
+	// Model IDs and ARNs of inference profiles have colons and slashes that must be escaped
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/model/" + uriEncode(model) + "/converse-stream"
+	if u.Path, err = url.PathUnescape(u.RawPath); err != nil {
+		return nil, fmt.Errorf("failed to parse bedrock endpoint: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/vnd.amazon.eventstream")
+	c.credentials.sign(httpReq, data, c.region, "bedrock", time.Now())
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, retry.NewStatusError(api, httpResp)
+	}
+
+	var (
+		resp = Response{
+			ID:    uuid.String(),
+			Model: model,
+			Role:  "assistant",
+		}
+		partialJSON = map[int]string{}
+		events      = newEventReader(httpResp.Body)
+	)
+
+	for {
+		e, err := events.next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		var streamEvent StreamEvent
+		if err := json.Unmarshal(e.payload, &streamEvent); err != nil {
+			log.Errorf(ctx, "failed to decode event: %v: %s", err, e.payload)
+			continue
+		}
+
+		if e.headers[":message-type"] == "exception" {
+			return nil, streamError(e.headers[":exception-type"], streamEvent.Message)
+		}
+
+		index := streamEvent.ContentBlockIndex
+		switch e.headers[":event-type"] {
+		case "messageStart":
+			resp.Role = cmp.Or(streamEvent.Role, resp.Role)
+		case "contentBlockStart":
+			block := blockAt(&resp, index)
+			if streamEvent.Start != nil && streamEvent.Start.ToolUse != nil {
+				block.ToolUse = streamEvent.Start.ToolUse
+			}
+		case "contentBlockDelta":
+			if streamEvent.Delta == nil {
+				continue
+			}
+			block := blockAt(&resp, index)
+			item := types.CompletionItem{
+				ID:      fmt.Sprintf("%s-%d", resp.ID, index),
+				Partial: true,
+				HasMore: true,
+			}
+			switch {
+			case streamEvent.Delta.Text != nil:
+				if block.Text == nil {
+					block.Text = new(string)
+				}
+				*block.Text += *streamEvent.Delta.Text
+				item.Content = &mcp.Content{
+					Type: "text",
+					Text: *streamEvent.Delta.Text,
+				}
+			case streamEvent.Delta.ToolUse != nil && block.ToolUse != nil:
+				partialJSON[index] += streamEvent.Delta.ToolUse.Input
+				item.ToolCall = &types.ToolCall{
+					CallID:    block.ToolUse.ToolUseID,
+					Name:      block.ToolUse.Name,
+					Arguments: streamEvent.Delta.ToolUse.Input,
+				}
+			default:
+				continue
+			}
+			progress.Send(ctx, &types.CompletionProgress{
+				Model:     model,
+				Agent:     agentName,
+				MessageID: resp.ID,
+				Item:      item,
+			}, opt.ProgressToken)
+		case "contentBlockStop":
+			block := blockAt(&resp, index)
+			if block.ToolUse != nil {
+				args := map[string]any{}
+				if input := partialJSON[index]; input != "" {
+					if err := json.Unmarshal([]byte(input), &args); err != nil {
+						return nil, fmt.Errorf("failed to unmarshal tool use input: %w", err)
+					}
+				}
+				block.ToolUse.Input = args
+			}
+			progress.Send(ctx, &types.CompletionProgress{
+				Model:     model,
+				Agent:     agentName,
+				MessageID: resp.ID,
+				Item: types.CompletionItem{
+					Partial: true,
+					ID:      fmt.Sprintf("%s-%d", resp.ID, index),
+				},
+			}, opt.ProgressToken)
+		case "messageStop":
+			resp.StopReason = streamEvent.StopReason
+		case "metadata":
+			resp.Usage = streamEvent.Usage
+			progress.SendUsage(ctx, types.CompletionProgress{
+				Model:     model,
+				Agent:     agentName,
+				MessageID: resp.ID,
+			}, toUsage(resp.Usage), stopReason(resp.StopReason), opt.ProgressToken)
+		}
+	}
+
+	respData, err := json.Marshal(resp)
+	if err == nil {
+		log.Messages(ctx, "bedrock-api", false, respData)
+	}
+
+	return &resp, nil
+}
+
+// blockAt returns the content block of the index, adding empty blocks up to it. Text blocks have no
+// start event, they start with their first delta.
+func blockAt(resp *Response, index int) *ContentBlock {
+	for len(resp.Content) <= index {
+		resp.Content = append(resp.Content, ContentBlock{})
+	}
+	return &resp.Content[index]
+}
+
+// streamError converts the exceptions sent in the stream to the status errors the HTTP API responds
+// with for them, so that they are retried in the same way.
+func streamError(exceptionType, message string) error {
+	statusCode := http.StatusBadRequest
+	switch exceptionType {
+	case "throttlingException":
+		statusCode = http.StatusTooManyRequests
+	case "serviceUnavailableException":
+		statusCode = http.StatusServiceUnavailable
+	case "internalServerException", "modelStreamErrorException":
+		statusCode = http.StatusInternalServerError
+	}
+	return &retry.StatusError{
+		API:        api,
+		StatusCode: statusCode,
+		Status:     fmt.Sprintf("%d %s", statusCode, exceptionType),
+		Body:       message,
+	}
+}
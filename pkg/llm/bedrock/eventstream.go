@@ -0,0 +1,111 @@
+package bedrock
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// event is a message of the binary event stream encoding of AWS streaming APIs.
+type event struct {
+	headers map[string]string
+	payload []byte
+}
+
+// eventReader decodes the messages of an event stream. Each message is its total and headers length,
+// a CRC of both, the headers, the payload, and a CRC of the whole message.
+type eventReader struct {
+	r *bufio.Reader
+}
+
+func newEventReader(r io.Reader) *eventReader {
+	return &eventReader{
+		r: bufio.NewReader(r),
+	}
+}
+
+// next returns the next message, or io.EOF at the end of the stream.
+func (e *eventReader) next() (event, error) {
+	prelude := make([]byte, 12)
+	if _, err := io.ReadFull(e.r, prelude); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return event{}, fmt.Errorf("failed to read event prelude: %w", err)
+		}
+		return event{}, err
+	}
+
+	totalLength := binary.BigEndian.Uint32(prelude[0:4])
+	headersLength := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return event{}, fmt.Errorf("invalid event prelude checksum")
+	}
+	if totalLength < 16+headersLength || totalLength > 16<<20 {
+		return event{}, fmt.Errorf("invalid event length %d", totalLength)
+	}
+
+	message := make([]byte, totalLength)
+	copy(message, prelude)
+	if _, err := io.ReadFull(e.r, message[12:]); err != nil {
+		return event{}, fmt.Errorf("failed to read event: %w", err)
+	}
+	if crc32.ChecksumIEEE(message[:totalLength-4]) != binary.BigEndian.Uint32(message[totalLength-4:]) {
+		return event{}, fmt.Errorf("invalid event checksum")
+	}
+
+	headers, err := decodeHeaders(message[12 : 12+headersLength])
+	if err != nil {
+		return event{}, err
+	}
+	return event{
+		headers: headers,
+		payload: message[12+headersLength : totalLength-4],
+	}, nil
+}
+
+// decodeHeaders returns the string headers, like :event-type and :message-type, and skips the others.
+func decodeHeaders(data []byte) (map[string]string, error) {
+	headers := map[string]string{}
+	for len(data) > 0 {
+		nameLength := int(data[0])
+		if len(data) < 2+nameLength {
+			return nil, fmt.Errorf("invalid event header")
+		}
+		name := string(data[1 : 1+nameLength])
+		valueType := data[1+nameLength]
+		data = data[2+nameLength:]
+
+		var size int
+		switch valueType {
+		case 0, 1:
+			// true and false have no value
+		case 2:
+			size = 1
+		case 3:
+			size = 2
+		case 4:
+			size = 4
+		case 5, 8:
+			size = 8
+		case 9:
+			size = 16
+		case 6, 7:
+			if len(data) < 2 {
+				return nil, fmt.Errorf("invalid event header %s", name)
+			}
+			size = 2 + int(binary.BigEndian.Uint16(data))
+		default:
+			return nil, fmt.Errorf("invalid type %d of event header %s", valueType, name)
+		}
+		if len(data) < size {
+			return nil, fmt.Errorf("invalid event header %s", name)
+		}
+		if valueType == 7 {
+			headers[name] = string(data[2:size])
+		}
+		data = data[size:]
+	}
+	return headers, nil
+}
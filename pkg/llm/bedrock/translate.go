@@ -0,0 +1,339 @@
+package bedrock
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+var emptySchema = json.RawMessage(`{"type":"object","properties":{}}`)
+
+func toRequest(req *types.CompletionRequest) (Request, error) {
+	result := Request{}
+
+	if req.MaxTokens > 0 || req.Temperature != nil || req.TopP != nil || len(req.Stop) > 0 {
+		result.InferenceConfig = &InferenceConfig{
+			MaxTokens:     req.MaxTokens,
+			Temperature:   req.Temperature,
+			TopP:          req.TopP,
+			StopSequences: req.Stop,
+		}
+	}
+
+	if req.SystemPrompt != "" {
+		result.System = []SystemContent{
+			{
+				Text: req.SystemPrompt,
+			},
+		}
+	}
+
+	var tools []Tool
+	for _, tool := range req.Tools {
+		tools = append(tools, toTool(tool.Name, tool.Description, tool.Parameters))
+	}
+
+	var toolChoice *ToolChoice
+	switch req.ToolChoice {
+	case "", "none":
+		// Bedrock has no choice to not call tools, the tools are still needed for the tool calls in
+		// the conversation
+	case "auto":
+		toolChoice = &ToolChoice{
+			Auto: &struct{}{},
+		}
+	default:
+		toolChoice = &ToolChoice{
+			Tool: &ToolChoiceTool{
+				Name: req.ToolChoice,
+			},
+		}
+	}
+
+	if req.OutputSchema != nil && len(req.OutputSchema.ToSchema()) > 0 {
+		// Structured output is done with a tool whose input is the output of the model.
+		description := req.OutputSchema.Description
+		if description == "" {
+			description = "Respond with the final output by calling this tool."
+		}
+		tools = append(tools, toTool(req.OutputSchema.Name, description, req.OutputSchema.ToSchema()))
+		if len(req.Tools) == 0 && toolChoice == nil {
+			toolChoice = &ToolChoice{
+				Tool: &ToolChoiceTool{
+					Name: req.OutputSchema.Name,
+				},
+			}
+		}
+	}
+
+	if len(tools) > 0 {
+		result.ToolConfig = &ToolConfig{
+			Tools:      tools,
+			ToolChoice: toolChoice,
+		}
+	}
+
+	for _, msg := range req.Input {
+		for _, input := range msg.Items {
+			if input.Content != nil {
+				appendContent(&result, msg.Role, contentToContent([]mcp.Content{*input.Content})...)
+			}
+			if input.ToolCall != nil {
+				args := map[string]any{}
+				if input.ToolCall.Arguments != "" {
+					if err := json.Unmarshal([]byte(input.ToolCall.Arguments), &args); err != nil {
+						return Request{}, fmt.Errorf("failed to unmarshal tool call arguments: %w", err)
+					}
+				}
+				appendContent(&result, "assistant", ContentBlock{
+					ToolUse: &ToolUse{
+						ToolUseID: input.ToolCall.CallID,
+						Name:      input.ToolCall.Name,
+						Input:     args,
+					},
+				})
+			}
+			if input.ToolCallResult != nil {
+				toolResult := &ToolResult{
+					ToolUseID: input.ToolCallResult.CallID,
+					Content:   toolResultContent(input.ToolCallResult.Output.Content),
+				}
+				if input.ToolCallResult.Output.IsError {
+					toolResult.Status = "error"
+				}
+				appendContent(&result, "user", ContentBlock{
+					ToolResult: toolResult,
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func toTool(name, description string, schema json.RawMessage) Tool {
+	if len(schema) == 0 || string(schema) == "null" {
+		schema = emptySchema
+	}
+	return Tool{
+		ToolSpec: ToolSpec{
+			Name:        name,
+			Description: description,
+			InputSchema: InputSchema{
+				JSON: schema,
+			},
+		},
+	}
+}
+
+// appendContent adds the content to the last message if it has the same role, because Bedrock requires
+// the roles of the messages to alternate.
+func appendContent(req *Request, role string, content ...ContentBlock) {
+	if len(content) == 0 {
+		return
+	}
+	if role != "assistant" {
+		role = "user"
+	}
+	if len(req.Messages) > 0 && req.Messages[len(req.Messages)-1].Role == role {
+		last := &req.Messages[len(req.Messages)-1]
+		last.Content = append(last.Content, content...)
+		return
+	}
+	req.Messages = append(req.Messages, Message{
+		Role:    role,
+		Content: content,
+	})
+}
+
+func contentToContent(content []mcp.Content) (result []ContentBlock) {
+	for _, item := range content {
+		switch {
+		case item.Type == "text" || item.Type == "":
+			if strings.TrimSpace(item.Text) != "" {
+				result = append(result, ContentBlock{
+					Text: &item.Text,
+				})
+			}
+		case item.Type == "image":
+			if image, ok := toImage(item.MIMEType, item.Data); ok {
+				result = append(result, ContentBlock{
+					Image: image,
+				})
+			}
+		case item.Type == "resource" && item.Resource != nil:
+			if block, ok := resourceToContent(item.Resource); ok {
+				result = append(result, block)
+			}
+		}
+	}
+	return
+}
+
+func toolResultContent(content []mcp.Content) (result []ToolResultContent) {
+	for _, item := range content {
+		switch {
+		case item.Type == "text" || item.Type == "":
+			if strings.TrimSpace(item.Text) != "" {
+				result = append(result, ToolResultContent{
+					Text: &item.Text,
+				})
+			}
+		case item.Type == "image":
+			if image, ok := toImage(item.MIMEType, item.Data); ok {
+				result = append(result, ToolResultContent{
+					Image: image,
+				})
+			}
+		case item.Type == "resource" && item.Resource != nil && item.Resource.Text != "":
+			result = append(result, ToolResultContent{
+				Text: &item.Resource.Text,
+			})
+		}
+	}
+	if len(result) == 0 {
+		// Bedrock rejects blank tool results
+		result = append(result, ToolResultContent{
+			Text: &[]string{"(no output)"}[0],
+		})
+	}
+	return
+}
+
+// toImage converts base64 images in the formats Bedrock reads: png, jpeg, gif, and webp.
+func toImage(mimeType, data string) (*ImageBlock, bool) {
+	format := strings.TrimPrefix(mimeType, "image/")
+	switch format {
+	case "png", "jpeg", "gif", "webp":
+	case "jpg":
+		format = "jpeg"
+	default:
+		return nil, false
+	}
+	return &ImageBlock{
+		Format: format,
+		Source: Source{
+			Bytes: data,
+		},
+	}, true
+}
+
+// resourceToContent converts embedded resources to document blocks, or images. Bedrock reads plain
+// text and PDF documents, other binary resources are left out.
+func resourceToContent(resource *mcp.EmbeddedResource) (ContentBlock, bool) {
+	switch {
+	case resource.Text != "":
+		return ContentBlock{
+			Text: &resource.Text,
+		}, true
+	case resource.Blob != "" && resource.MIMEType == "application/pdf":
+		return ContentBlock{
+			Document: &DocumentBlock{
+				Format: "pdf",
+				Name:   documentName(resource.URI),
+				Source: Source{
+					Bytes: resource.Blob,
+				},
+			},
+		}, true
+	case resource.Blob != "" && strings.HasPrefix(resource.MIMEType, "image/"):
+		if image, ok := toImage(resource.MIMEType, resource.Blob); ok {
+			return ContentBlock{
+				Image: image,
+			}, true
+		}
+	}
+	return ContentBlock{}, false
+}
+
+// documentName returns the URI with the characters document names can not have replaced, Bedrock
+// allows letters, digits, single spaces, hyphens, parentheses, and square brackets.
+func documentName(uri string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '-', r == '(', r == ')', r == '[', r == ']':
+			return r
+		}
+		return '-'
+	}, uri)
+	if name == "" {
+		return "document"
+	}
+	return name
+}
+
+// toResponse converts the response, a call of outputTool is converted to the text output of the model.
+func toResponse(resp *Response, created time.Time, outputTool string) *types.CompletionResponse {
+	result := &types.CompletionResponse{
+		Model: resp.Model,
+		Output: types.Message{
+			ID:      resp.ID,
+			Created: &created,
+			Role:    "assistant",
+		},
+	}
+
+	for contentIndex, content := range resp.Content {
+		id := fmt.Sprintf("%s-%d", resp.ID, contentIndex)
+		switch {
+		case content.ToolUse != nil && outputTool != "" && content.ToolUse.Name == outputTool:
+			args, _ := json.Marshal(content.ToolUse.Input)
+			result.Output.Items = append(result.Output.Items, types.CompletionItem{
+				ID: id,
+				Content: &mcp.Content{
+					Type: "text",
+					Text: string(args),
+				},
+			})
+		case content.ToolUse != nil:
+			args, _ := json.Marshal(content.ToolUse.Input)
+			result.Output.Items = append(result.Output.Items, types.CompletionItem{
+				ID: id,
+				ToolCall: &types.ToolCall{
+					CallID:    content.ToolUse.ToolUseID,
+					Name:      content.ToolUse.Name,
+					Arguments: string(args),
+				},
+			})
+		case content.Text != nil:
+			result.Output.Items = append(result.Output.Items, types.CompletionItem{
+				ID: id,
+				Content: &mcp.Content{
+					Type: "text",
+					Text: *content.Text,
+				},
+			})
+		}
+	}
+
+	result.Usage = toUsage(resp.Usage)
+
+	return result
+}
+
+func toUsage(usage *Usage) *types.Usage {
+	if usage == nil {
+		return nil
+	}
+	return &types.Usage{
+		InputTokens:  usage.InputTokens + usage.CacheReadInputTokens + usage.CacheWriteInputTokens,
+		OutputTokens: usage.OutputTokens,
+	}
+}
+
+// stopReason converts the stop reasons of Bedrock: end_turn, tool_use, max_tokens, stop_sequence,
+// guardrail_intervened, and content_filtered.
+func stopReason(reason string) string {
+	switch reason {
+	case "stop_sequence":
+		return types.StopReasonEndTurn
+	case "guardrail_intervened", "content_filtered":
+		return types.StopReasonContentFilter
+	}
+	return reason
+}
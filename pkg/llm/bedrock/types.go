@@ -0,0 +1,139 @@
+package bedrock
+
+import "encoding/json"
+
+// Request is the body of the Converse and ConverseStream APIs of Bedrock.
+type Request struct {
+	Messages        []Message        `json:"messages"`
+	System          []SystemContent  `json:"system,omitempty"`
+	InferenceConfig *InferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig      *ToolConfig      `json:"toolConfig,omitempty"`
+}
+
+type Message struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+type SystemContent struct {
+	Text string `json:"text"`
+}
+
+type ContentBlock struct {
+	Text       *string        `json:"text,omitempty"`
+	Image      *ImageBlock    `json:"image,omitempty"`
+	Document   *DocumentBlock `json:"document,omitempty"`
+	ToolUse    *ToolUse       `json:"toolUse,omitempty"`
+	ToolResult *ToolResult    `json:"toolResult,omitempty"`
+}
+
+type ImageBlock struct {
+	Format string `json:"format"`
+	Source Source `json:"source"`
+}
+
+type DocumentBlock struct {
+	Format string `json:"format"`
+	Name   string `json:"name"`
+	Source Source `json:"source"`
+}
+
+// Source is the base64 encoded content of an image or document.
+type Source struct {
+	Bytes string `json:"bytes"`
+}
+
+type ToolUse struct {
+	ToolUseID string `json:"toolUseId"`
+	Name      string `json:"name"`
+	Input     any    `json:"input,omitempty"`
+}
+
+type ToolResult struct {
+	ToolUseID string              `json:"toolUseId"`
+	Content   []ToolResultContent `json:"content"`
+	Status    string              `json:"status,omitempty"`
+}
+
+type ToolResultContent struct {
+	Text  *string     `json:"text,omitempty"`
+	Image *ImageBlock `json:"image,omitempty"`
+}
+
+type InferenceConfig struct {
+	MaxTokens     int          `json:"maxTokens,omitempty"`
+	Temperature   *json.Number `json:"temperature,omitempty"`
+	TopP          *json.Number `json:"topP,omitempty"`
+	StopSequences []string     `json:"stopSequences,omitempty"`
+}
+
+type ToolConfig struct {
+	Tools      []Tool      `json:"tools"`
+	ToolChoice *ToolChoice `json:"toolChoice,omitempty"`
+}
+
+type Tool struct {
+	ToolSpec ToolSpec `json:"toolSpec"`
+}
+
+type ToolSpec struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema InputSchema `json:"inputSchema"`
+}
+
+type InputSchema struct {
+	JSON json.RawMessage `json:"json"`
+}
+
+// ToolChoice has one of auto, any, or tool set.
+type ToolChoice struct {
+	Auto *struct{}       `json:"auto,omitempty"`
+	Any  *struct{}       `json:"any,omitempty"`
+	Tool *ToolChoiceTool `json:"tool,omitempty"`
+}
+
+type ToolChoiceTool struct {
+	Name string `json:"name"`
+}
+
+// StreamEvent is the payload of the events of ConverseStream: messageStart, contentBlockStart,
+// contentBlockDelta, contentBlockStop, messageStop, and metadata.
+type StreamEvent struct {
+	Role              string      `json:"role,omitempty"`
+	ContentBlockIndex int         `json:"contentBlockIndex"`
+	Start             *BlockStart `json:"start,omitempty"`
+	Delta             *BlockDelta `json:"delta,omitempty"`
+	StopReason        string      `json:"stopReason,omitempty"`
+	Usage             *Usage      `json:"usage,omitempty"`
+	Message           string      `json:"message,omitempty"`
+}
+
+type BlockStart struct {
+	ToolUse *ToolUse `json:"toolUse,omitempty"`
+}
+
+type BlockDelta struct {
+	Text    *string `json:"text,omitempty"`
+	ToolUse *struct {
+		Input string `json:"input"`
+	} `json:"toolUse,omitempty"`
+}
+
+type Usage struct {
+	InputTokens           int `json:"inputTokens"`
+	OutputTokens          int `json:"outputTokens"`
+	TotalTokens           int `json:"totalTokens"`
+	CacheReadInputTokens  int `json:"cacheReadInputTokens,omitempty"`
+	CacheWriteInputTokens int `json:"cacheWriteInputTokens,omitempty"`
+}
+
+// Response is the message assembled from the events of the stream.
+type Response struct {
+	ID         string         `json:"id"`
+	Model      string         `json:"model"`
+	Role       string         `json:"role"`
+	Content    []ContentBlock `json:"content"`
+	StopReason string         `json:"stopReason,omitempty"`
+	Usage      *Usage         `json:"usage,omitempty"`
+}
@@ -0,0 +1,204 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/llm/progress"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/metrics"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// maxCachedResponses limits the memory used by the response cache. When it is full and no entry has
+// expired an arbitrary entry is evicted.
+const maxCachedResponses = 1000
+
+// responseCache holds completions for the TTL configured in the responseCache field of the agent. It is
+// shared by all sessions so that reruns of evals and frequently asked questions do not reach the provider.
+type responseCache struct {
+	lock    sync.Mutex
+	entries map[string]responseCacheEntry
+}
+
+type responseCacheEntry struct {
+	response types.CompletionResponse
+	expires  time.Time
+}
+
+// responseCacheTTL returns how long completions of the agent are cached, zero if they are not.
+func responseCacheTTL(ctx context.Context, config types.Config, agent string) time.Duration {
+	ttl := config.Agents[agent].ResponseCache
+	if ttl == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		log.Errorf(ctx, "invalid responseCache TTL %q for agent %s: %v", ttl, agent, err)
+		return 0
+	}
+	return d
+}
+
+type cacheKeyMessage struct {
+	Role  string         `json:"role,omitempty"`
+	Items []cacheKeyItem `json:"items,omitempty"`
+}
+
+type cacheKeyItem struct {
+	Content        *mcp.Content          `json:"content,omitempty"`
+	ToolCall       *types.ToolCall       `json:"toolCall,omitempty"`
+	ToolCallResult *types.ToolCallResult `json:"toolCallResult,omitempty"`
+	Reasoning      *types.Reasoning      `json:"reasoning,omitempty"`
+}
+
+// responseCacheKey is the hash of the account of the session and of the request, which includes the
+// agent, system prompt and tools, and of the message history. IDs and timestamps of the messages are
+// left out, they differ between otherwise identical requests.
+func responseCacheKey(accountID string, req types.CompletionRequest) (string, bool) {
+	messages := make([]cacheKeyMessage, 0, len(req.Input))
+	for _, msg := range req.Input {
+		keyMsg := cacheKeyMessage{
+			Role: msg.Role,
+		}
+		for _, item := range msg.Items {
+			keyMsg.Items = append(keyMsg.Items, cacheKeyItem{
+				Content:        item.Content,
+				ToolCall:       item.ToolCall,
+				ToolCallResult: item.ToolCallResult,
+				Reasoning:      item.Reasoning,
+			})
+		}
+		messages = append(messages, keyMsg)
+	}
+
+	req.Input = nil
+	data, err := json.Marshal(struct {
+		AccountID string                  `json:"accountID"`
+		Request   types.CompletionRequest `json:"request"`
+		Messages  []cacheKeyMessage       `json:"messages"`
+	}{
+		AccountID: accountID,
+		Request:   req,
+		Messages:  messages,
+	})
+	if err != nil {
+		return "", false
+	}
+
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:]), true
+}
+
+func (c *responseCache) get(key string) (*types.CompletionResponse, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	// The response is stored in the thread of the session, so it gets new IDs each time it is returned.
+	// Tool calls get new call IDs so that their results do not collide with the results of the calls of
+	// the response returned before.
+	resp := entry.response
+	resp.Output.ID = uuid.String()
+	resp.Output.Items = make([]types.CompletionItem, 0, len(entry.response.Output.Items))
+	for _, item := range entry.response.Output.Items {
+		item.ID = uuid.String()
+		if item.ToolCall != nil {
+			toolCall := *item.ToolCall
+			toolCall.CallID = uuid.String()
+			item.ToolCall = &toolCall
+		}
+		resp.Output.Items = append(resp.Output.Items, item)
+	}
+	// Cached responses did not use any tokens.
+	resp.Usage = nil
+	return &resp, true
+}
+
+func (c *responseCache) set(key string, resp types.CompletionResponse, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]responseCacheEntry{}
+	}
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	for k := range c.entries {
+		if len(c.entries) < maxCachedResponses {
+			break
+		}
+		delete(c.entries, k)
+	}
+
+	resp.Output.Items = append([]types.CompletionItem(nil), resp.Output.Items...)
+	c.entries[key] = responseCacheEntry{
+		response: resp,
+		expires:  now.Add(ttl),
+	}
+}
+
+// completeCached returns the cached completion of the request if the agent has a response cache,
+// otherwise it calls complete and caches its response. Completions are only shared by the sessions of
+// an account.
+func (c Client) completeCached(ctx context.Context, req types.CompletionRequest, progressToken any,
+	complete func() (*types.CompletionResponse, error)) (*types.CompletionResponse, error) {
+	ttl := responseCacheTTL(ctx, types.ConfigFromContext(ctx), req.Agent)
+	if ttl <= 0 || types.NanobotContext(ctx).SkipResponseCache {
+		return complete()
+	}
+
+	var accountID string
+	if session := mcp.SessionFromContext(ctx); session != nil {
+		session.Get(types.AccountIDSessionKey, &accountID)
+	}
+
+	key, ok := responseCacheKey(accountID, req)
+	if !ok {
+		return complete()
+	}
+
+	if resp, ok := c.cache.get(key); ok {
+		metrics.ObserveResponseCache(req.Agent, true)
+		log.Debugf(ctx, "returning cached completion for agent %s", req.Agent)
+		if progressToken != nil {
+			for _, item := range resp.Output.Items {
+				progress.Send(ctx, &types.CompletionProgress{
+					Model:     resp.Model,
+					Agent:     req.Agent,
+					MessageID: resp.Output.ID,
+					Role:      resp.Output.Role,
+					Item:      item,
+				}, progressToken)
+			}
+		}
+		return resp, nil
+	}
+	metrics.ObserveResponseCache(req.Agent, false)
+
+	resp, err := complete()
+	if err != nil {
+		return nil, err
+	}
+	c.cache.set(key, *resp, ttl)
+	return resp, nil
+}
@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func TestCompleteCached(t *testing.T) {
+	c := Client{cache: &responseCache{}}
+	config := types.Config{
+		Agents: map[string]types.Agent{
+			"main": {ResponseCache: "1m"},
+		},
+	}
+	sessionCtx := func(accountID string) context.Context {
+		session := mcp.NewEmptySession(context.Background())
+		session.Set(types.ConfigSessionKey, config)
+		session.Set(types.AccountIDSessionKey, accountID)
+		return mcp.WithSession(context.Background(), session)
+	}
+	req := types.CompletionRequest{
+		Agent: "main",
+		Input: []types.Message{{Role: "user", Items: []types.CompletionItem{{Content: &mcp.Content{Type: "text", Text: "weather?"}}}}},
+	}
+
+	var completions int
+	complete := func() (*types.CompletionResponse, error) {
+		completions++
+		return &types.CompletionResponse{
+			Output: types.Message{
+				ID:   "response",
+				Role: "assistant",
+				Items: []types.CompletionItem{
+					{ID: "item", ToolCall: &types.ToolCall{CallID: "call", Name: "weather"}},
+				},
+			},
+		}, nil
+	}
+
+	alice := sessionCtx("alice")
+	first, err := c.completeCached(alice, req, nil, complete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := c.completeCached(alice, req, nil, complete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completions != 1 {
+		t.Fatalf("expected the second completion of the account to be cached, got %d completions", completions)
+	}
+	if firstID, cachedID := first.Output.Items[0].ToolCall.CallID, cached.Output.Items[0].ToolCall.CallID; firstID == cachedID {
+		t.Errorf("expected the cached tool call to get a new call ID, both are %q", cachedID)
+	}
+
+	if _, err := c.completeCached(sessionCtx("bob"), req, nil, complete); err != nil {
+		t.Fatal(err)
+	}
+	if completions != 2 {
+		t.Errorf("expected the completion of another account not to be cached, got %d completions", completions)
+	}
+
+	nctx := types.NanobotContext(alice)
+	nctx.SkipResponseCache = true
+	if _, err := c.completeCached(types.WithNanobotContext(alice, nctx), req, nil, complete); err != nil {
+		t.Fatal(err)
+	}
+	if completions != 3 {
+		t.Errorf("expected a regenerated completion to skip the cache, got %d completions", completions)
+	}
+}
@@ -2,12 +2,24 @@ package llm
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/envvar"
+	"github.com/nanobot-ai/nanobot/pkg/events"
 	"github.com/nanobot-ai/nanobot/pkg/llm/anthropic"
+	"github.com/nanobot-ai/nanobot/pkg/llm/azure"
+	"github.com/nanobot-ai/nanobot/pkg/llm/bedrock"
+	"github.com/nanobot-ai/nanobot/pkg/llm/gemini"
+	"github.com/nanobot-ai/nanobot/pkg/llm/ollama"
 	"github.com/nanobot-ai/nanobot/pkg/llm/progress"
 	"github.com/nanobot-ai/nanobot/pkg/llm/responses"
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/log"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
 	"github.com/nanobot-ai/nanobot/pkg/types"
 	"github.com/nanobot-ai/nanobot/pkg/uuid"
@@ -19,6 +31,8 @@ type Config struct {
 	DefaultModel string
 	Responses    responses.Config
 	Anthropic    anthropic.Config
+	Ollama       ollama.Config
+	Gemini       gemini.Config
 }
 
 func NewClient(cfg Config) *Client {
@@ -26,6 +40,10 @@ func NewClient(cfg Config) *Client {
 		defaultModel: cfg.DefaultModel,
 		responses:    responses.NewClient(cfg.Responses),
 		anthropic:    anthropic.NewClient(cfg.Anthropic),
+		ollama:       ollama.NewClient(cfg.Ollama),
+		gemini:       gemini.NewClient(cfg.Gemini),
+		cache:        &responseCache{},
+		providers:    &providerClients{},
 	}
 }
 
@@ -33,6 +51,61 @@ type Client struct {
 	defaultModel string
 	responses    *responses.Client
 	anthropic    *anthropic.Client
+	ollama       *ollama.Client
+	gemini       *gemini.Client
+	cache        *responseCache
+	providers    *providerClients
+}
+
+// providerCompleter is the client of the API of one of the providers of the config.
+type providerCompleter interface {
+	Complete(ctx context.Context, req types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error)
+	Check(ctx context.Context) error
+}
+
+// providerClients are the clients of the providers of the config, kept so that access tokens are
+// reused, and created again when the config of their provider changes.
+type providerClients struct {
+	lock    sync.Mutex
+	clients map[string]providerClient
+}
+
+type providerClient struct {
+	provider  types.Provider
+	completer providerCompleter
+}
+
+// providerClient returns the client of the named provider of the config of the session, false if the
+// config has no such provider.
+func (c Client) providerClient(ctx context.Context, name string) (providerClient, bool) {
+	provider, ok := types.ConfigFromContext(ctx).Providers[name]
+	if !ok {
+		return providerClient{}, false
+	}
+	if err := envvar.ReplaceObject(ctx, mcp.SessionFromContext(ctx).GetEnvMap(), &provider); err != nil {
+		log.Errorf(ctx, "failed to replace variables in provider %s: %v", name, err)
+	}
+
+	c.providers.lock.Lock()
+	defer c.providers.lock.Unlock()
+
+	if client, ok := c.providers.clients[name]; ok && reflect.DeepEqual(client.provider, provider) {
+		return client, true
+	}
+
+	client := providerClient{
+		provider: provider,
+	}
+	if provider.Type == types.ProviderTypeBedrock {
+		client.completer = bedrock.NewClient(provider)
+	} else {
+		client.completer = azure.NewClient(provider)
+	}
+	if c.providers.clients == nil {
+		c.providers.clients = map[string]providerClient{}
+	}
+	c.providers.clients[name] = client
+	return client, true
 }
 
 func (c *Client) handleAssistantRolesFromTools(req types.CompletionRequest) (_ types.CompletionRequest, resp *types.CompletionResponse) {
@@ -96,6 +169,7 @@ func (c Client) Complete(ctx context.Context, req types.CompletionRequest, opts
 	if req.Model == "default" || req.Model == "" {
 		req.Model = c.defaultModel
 	}
+	req.Model = types.ConfigFromContext(ctx).ResolveModel(req.Model)
 
 	req, resp := c.handleAssistantRolesFromTools(req)
 	if resp != nil {
@@ -117,8 +191,161 @@ func (c Client) Complete(ctx context.Context, req types.CompletionRequest, opts
 		}
 	}
 
-	if strings.HasPrefix(req.Model, "claude") {
+	return c.completeCached(ctx, req, opt.ProgressToken, func() (*types.CompletionResponse, error) {
+		return c.completeWithFallbacks(ctx, req, opts...)
+	})
+}
+
+// completeWithFallbacks tries the model and then the fallback models of the request, retrying each
+// according to the retry policy of its provider.
+func (c Client) completeWithFallbacks(ctx context.Context, req types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error) {
+	var (
+		config = types.ConfigFromContext(ctx)
+		models = append([]string{req.Model}, req.FallbackModels...)
+		errs   []error
+	)
+	for i, model := range models {
+		req.Model = config.ResolveModel(model)
+		provider := agentProvider(config, req.Agent, req.Model)
+
+		attempt := 0
+		resp, err := retry.Do(ctx, config.GetRetryPolicy(provider), func(ctx context.Context) (*types.CompletionResponse, error) {
+			attempt++
+			start := time.Now()
+			events.Publish(ctx, events.Event{
+				Type: events.ProviderRequest,
+				Data: map[string]any{
+					"provider": provider,
+					"model":    req.Model,
+					"attempt":  attempt,
+					"messages": len(req.Input),
+					"tools":    len(req.Tools),
+				},
+			})
+			resp, err := c.complete(ctx, provider, req, opts...)
+			publishResponse(ctx, provider, req.Model, start, resp, err)
+			return resp, err
+		})
+		if err == nil {
+			return resp, nil
+		}
+
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			return nil, errors.Join(errs...)
+		}
+		if i < len(models)-1 {
+			log.Infof(ctx, "completion with model %s failed, falling back to %s: %v", req.Model, models[i+1], err)
+			events.Publish(ctx, events.Event{
+				Type:    events.Fallback,
+				Message: err.Error(),
+				Data: map[string]any{
+					"model":    req.Model,
+					"fallback": models[i+1],
+				},
+			})
+		}
+	}
+
+	lastErr := errs[len(errs)-1]
+	retryable, retryAfter := retry.Retryable(lastErr)
+	return nil, &types.ProviderError{
+		Provider:   agentProvider(config, req.Agent, req.Model),
+		Model:      req.Model,
+		Code:       retry.ErrorCode(lastErr),
+		Retryable:  retryable,
+		RetryAfter: retryAfter,
+		Err:        errors.Join(errs...),
+	}
+}
+
+func publishResponse(ctx context.Context, provider, model string, start time.Time, resp *types.CompletionResponse, err error) {
+	if !events.Enabled() {
+		return
+	}
+	event := events.Event{
+		Type: events.ProviderResponse,
+		Data: map[string]any{
+			"provider":   provider,
+			"model":      model,
+			"durationMs": time.Since(start).Milliseconds(),
+		},
+	}
+	if err != nil {
+		event.Message = err.Error()
+	} else if resp != nil && resp.Usage != nil {
+		event.Data["inputTokens"] = resp.Usage.InputTokens
+		event.Data["outputTokens"] = resp.Usage.OutputTokens
+	}
+	if resp != nil {
+		var toolCalls []string
+		for _, item := range resp.Output.Items {
+			if item.ToolCall != nil {
+				toolCalls = append(toolCalls, item.ToolCall.Name)
+			}
+		}
+		if len(toolCalls) > 0 {
+			event.Data["toolCalls"] = toolCalls
+		}
+	}
+	events.Publish(ctx, event)
+}
+
+// Provider returns the LLM provider that completes requests for the model: "ollama", "gemini", "anthropic",
+// or "openai".
+func Provider(model string) string {
+	switch {
+	case strings.HasPrefix(model, ollama.ModelPrefix):
+		return "ollama"
+	case strings.HasPrefix(model, gemini.ModelPrefix):
+		return "gemini"
+	case strings.HasPrefix(model, "claude"):
+		return "anthropic"
+	default:
+		return "openai"
+	}
+}
+
+// agentProvider returns the provider of the agent, or the provider of the model if the agent has none.
+func agentProvider(config types.Config, agent, model string) string {
+	if provider := config.Agents[agent].Provider; provider != "" {
+		return provider
+	}
+	return Provider(model)
+}
+
+// Check verifies that the provider can be reached with the configured credentials, without running a
+// completion. The provider is openai, anthropic, ollama, gemini, or one of the providers of the config of the
+// session.
+func (c Client) Check(ctx context.Context, provider string) error {
+	if client, ok := c.providerClient(ctx, provider); ok {
+		return client.completer.Check(ctx)
+	}
+	switch provider {
+	case "ollama":
+		return c.ollama.Check(ctx)
+	case "gemini":
+		return c.gemini.Check(ctx)
+	case "anthropic":
+		return c.anthropic.Check(ctx)
+	default:
+		return c.responses.Check(ctx)
+	}
+}
+
+func (c Client) complete(ctx context.Context, provider string, req types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error) {
+	if client, ok := c.providerClient(ctx, provider); ok {
+		req.Model = client.provider.Deployment(req.Model)
+		return client.completer.Complete(ctx, req, opts...)
+	}
+	switch provider {
+	case "ollama":
+		return c.ollama.Complete(ctx, req, opts...)
+	case "gemini":
+		return c.gemini.Complete(ctx, req, opts...)
+	case "anthropic":
 		return c.anthropic.Complete(ctx, req, opts...)
+	default:
+		return c.responses.Complete(ctx, req, opts...)
 	}
-	return c.responses.Complete(ctx, req, opts...)
 }
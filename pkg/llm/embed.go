@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+var _ types.Embedder = (*Client)(nil)
+
+// Embed returns the embeddings of the input with the model, retried according to the retry policy of its provider.
+// Models of the providers of the config are given as provider/model, like corp-azure/text-embedding-3-small.
+func (c Client) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	config := types.ConfigFromContext(ctx)
+	model = config.ResolveModel(model)
+
+	provider, embedder, model, err := c.embedder(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+
+	return retry.Do(ctx, config.GetRetryPolicy(provider), func(ctx context.Context) ([][]float32, error) {
+		return embedder.Embed(ctx, model, input)
+	})
+}
+
+// embedder returns the provider of the model, the client that embeds with it, and the model as the
+// client expects it.
+func (c Client) embedder(ctx context.Context, model string) (string, types.Embedder, string, error) {
+	if name, deployment, ok := strings.Cut(model, "/"); ok {
+		if client, ok := c.providerClient(ctx, name); ok {
+			embedder, ok := client.completer.(types.Embedder)
+			if !ok {
+				return "", nil, "", fmt.Errorf("provider %s of type %s does not support embeddings", name, client.provider.Type)
+			}
+			return name, embedder, client.provider.Deployment(deployment), nil
+		}
+	}
+
+	provider := Provider(model)
+	switch provider {
+	case "ollama":
+		return provider, c.ollama, model, nil
+	case "openai":
+		return provider, c.responses, model, nil
+	case "gemini":
+		return provider, c.gemini, model, nil
+	default:
+		return "", nil, "", fmt.Errorf("model %s of provider %s does not support embeddings", model, provider)
+	}
+}
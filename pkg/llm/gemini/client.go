@@ -0,0 +1,216 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/llm/progress"
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// ModelPrefix selects the Gemini provider, for example "gemini/gemini-2.5-pro".
+const ModelPrefix = "gemini/"
+
+type Client struct {
+	Config
+}
+
+type Config struct {
+	APIKey  string
+	BaseURL string
+	Headers map[string]string
+}
+
+// NewClient creates a new Gemini client with the provided API key and base URL.
+func NewClient(cfg Config) *Client {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	}
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	if cfg.Headers == nil {
+		cfg.Headers = map[string]string{}
+	}
+	if _, ok := cfg.Headers["x-goog-api-key"]; !ok && cfg.APIKey != "" {
+		cfg.Headers["x-goog-api-key"] = cfg.APIKey
+	}
+	if _, ok := cfg.Headers["Content-Type"]; !ok {
+		cfg.Headers["Content-Type"] = "application/json"
+	}
+
+	return &Client{
+		Config: cfg,
+	}
+}
+
+// Check lists the models of the API, a request that costs nothing, to verify the API key and base URL.
+func (c *Client) Check(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/models", nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range c.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return retry.NewStatusError("Gemini API", httpResp)
+	}
+	return nil
+}
+
+func (c *Client) Complete(ctx context.Context, completionRequest types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error) {
+	req, err := toRequest(&completionRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := time.Now()
+	model := strings.TrimPrefix(completionRequest.Model, ModelPrefix)
+	resp, err := c.complete(ctx, completionRequest.Agent, model, req, completionRequest.Reasoning.Exposed(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputTool string
+	if completionRequest.OutputSchema != nil {
+		outputTool = completionRequest.OutputSchema.Name
+	}
+	return toResponse(resp, ts, outputTool), nil
+}
+
+func (c *Client) complete(ctx context.Context, agentName, model string, req Request, exposeReasoning bool, opts ...types.CompletionOptions) (*Response, error) {
+	opt := complete.Complete(opts...)
+
+	data, _ := json.Marshal(req)
+	log.Messages(ctx, "gemini-api", true, data)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.BaseURL+"/models/"+url.PathEscape(model)+":streamGenerateContent?alt=sse", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range c.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, retry.NewStatusError("Gemini API", httpResp)
+	}
+
+	var (
+		lines = bufio.NewScanner(httpResp.Body)
+		resp  = Response{
+			ResponseID:   uuid.String(),
+			ModelVersion: model,
+		}
+	)
+	// Chunks with inline images are larger than the default limit of a line
+	lines.Buffer(make([]byte, 0, 64*1024), 32*1024*1024)
+
+	for lines.Scan() {
+		header, body, ok := strings.Cut(lines.Text(), ":")
+		if !ok || strings.TrimSpace(header) != "data" {
+			continue
+		}
+
+		var chunk Response
+		body = strings.TrimSpace(body)
+		if err := json.Unmarshal([]byte(body), &chunk); err != nil {
+			log.Errorf(ctx, "failed to decode event: %v: %s", err, body)
+			continue
+		}
+
+		indexes := appendChunk(&resp, &chunk)
+		sendProgress(ctx, agentName, &resp, &chunk, indexes, exposeReasoning, opt.ProgressToken)
+
+		if len(chunk.Candidates) > 0 && chunk.Candidates[0].FinishReason != "" {
+			progress.SendUsage(ctx, types.CompletionProgress{
+				Model:     resp.ModelVersion,
+				Agent:     agentName,
+				MessageID: resp.ResponseID,
+			}, toUsage(resp.UsageMetadata), stopReason(&resp), opt.ProgressToken)
+		}
+	}
+
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	respData, err := json.Marshal(resp)
+	if err == nil {
+		log.Messages(ctx, "gemini-api", false, respData)
+	}
+
+	if len(resp.Candidates) == 0 && resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		return nil, fmt.Errorf("gemini blocked the prompt: %s", resp.PromptFeedback.BlockReason)
+	}
+
+	return &resp, nil
+}
+
+// sendProgress sends the text and function calls of the chunk, and its thoughts if exposeReasoning is true,
+// with the IDs of the parts of the response they were added to.
+func sendProgress(ctx context.Context, agentName string, resp, chunk *Response, indexes []int, exposeReasoning bool, progressToken any) {
+	if progressToken == nil || len(chunk.Candidates) == 0 {
+		return
+	}
+
+	for i, part := range chunk.Candidates[0].Content.Parts {
+		item := types.CompletionItem{
+			ID:      fmt.Sprintf("%s-%d", resp.ResponseID, indexes[i]),
+			Partial: true,
+			HasMore: true,
+		}
+		switch {
+		case part.Thought && exposeReasoning && part.Text != "":
+			item.ID += "-reasoning"
+			item.Reasoning = &types.Reasoning{
+				Summary: []types.SummaryText{{Text: part.Text}},
+			}
+		case part.Thought:
+			continue
+		case part.FunctionCall != nil:
+			args, _ := json.Marshal(part.FunctionCall.Args)
+			item.ToolCall = &types.ToolCall{
+				CallID:    part.FunctionCall.ID,
+				Name:      part.FunctionCall.Name,
+				Arguments: string(args),
+			}
+		case part.Text != "":
+			item.Content = &mcp.Content{
+				Type: "text",
+				Text: part.Text,
+			}
+		default:
+			continue
+		}
+		progress.Send(ctx, &types.CompletionProgress{
+			Model:     resp.ModelVersion,
+			Agent:     agentName,
+			MessageID: resp.ResponseID,
+			Item:      item,
+		}, progressToken)
+	}
+}
@@ -0,0 +1,82 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+)
+
+type embedRequest struct {
+	Model   string  `json:"model"`
+	Content Content `json:"content"`
+}
+
+type batchEmbedRequest struct {
+	Requests []embedRequest `json:"requests"`
+}
+
+type batchEmbedResponse struct {
+	Embeddings []struct {
+		Values []float32 `json:"values"`
+	} `json:"embeddings"`
+}
+
+// Embed returns the embeddings of the input from the batchEmbedContents API, in the order of the input.
+func (c *Client) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	model = strings.TrimPrefix(model, ModelPrefix)
+	req := batchEmbedRequest{
+		Requests: make([]embedRequest, 0, len(input)),
+	}
+	for _, text := range input {
+		req.Requests = append(req.Requests, embedRequest{
+			Model: "models/" + model,
+			Content: Content{
+				Parts: []Part{{Text: text}},
+			},
+		})
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.BaseURL+"/models/"+url.PathEscape(model)+":batchEmbedContents", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range c.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, retry.NewStatusError("Gemini Embeddings API", httpResp)
+	}
+
+	var resp batchEmbedResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode embeddings response: %w", err)
+	}
+	if len(resp.Embeddings) != len(input) {
+		return nil, fmt.Errorf("gemini returned %d embeddings for %d inputs", len(resp.Embeddings), len(input))
+	}
+
+	result := make([][]float32, len(input))
+	for i, embedding := range resp.Embeddings {
+		result[i] = embedding.Values
+	}
+	return result, nil
+}
@@ -0,0 +1,424 @@
+package gemini
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// thinkingBudgets are the thinking tokens of the reasoning efforts.
+var thinkingBudgets = map[string]int{
+	"minimal": 512,
+	"low":     1024,
+	"medium":  8192,
+	"high":    24576,
+}
+
+func toRequest(req *types.CompletionRequest) (Request, error) {
+	result := Request{}
+
+	if req.MaxTokens > 0 || req.Temperature != nil || req.TopP != nil || len(req.Stop) > 0 ||
+		req.FrequencyPenalty != nil || req.PresencePenalty != nil || req.Seed != nil {
+		result.GenerationConfig = &GenerationConfig{
+			MaxOutputTokens:  req.MaxTokens,
+			Temperature:      req.Temperature,
+			TopP:             req.TopP,
+			StopSequences:    req.Stop,
+			FrequencyPenalty: req.FrequencyPenalty,
+			PresencePenalty:  req.PresencePenalty,
+			Seed:             req.Seed,
+		}
+	}
+
+	if req.Reasoning != nil {
+		if result.GenerationConfig == nil {
+			result.GenerationConfig = &GenerationConfig{}
+		}
+		result.GenerationConfig.ThinkingConfig = &ThinkingConfig{
+			IncludeThoughts: true,
+		}
+		if budget, ok := thinkingBudgets[req.Reasoning.Effort]; ok {
+			result.GenerationConfig.ThinkingConfig.ThinkingBudget = &budget
+		}
+	}
+
+	if req.SystemPrompt != "" {
+		result.SystemInstruction = &Content{
+			Parts: []Part{
+				{
+					Text: req.SystemPrompt,
+				},
+			},
+		}
+	}
+
+	for _, category := range slices.Sorted(maps.Keys(req.SafetySettings)) {
+		result.SafetySettings = append(result.SafetySettings, SafetySetting{
+			Category:  category,
+			Threshold: req.SafetySettings[category],
+		})
+	}
+
+	var functions []FunctionDeclaration
+	for _, tool := range req.Tools {
+		functions = append(functions, toFunction(tool.Name, tool.Description, tool.Parameters))
+	}
+
+	switch req.ToolChoice {
+	case "":
+	case "auto":
+		result.ToolConfig = &ToolConfig{
+			FunctionCallingConfig: FunctionCallingConfig{
+				Mode: "AUTO",
+			},
+		}
+	case "none":
+		result.ToolConfig = &ToolConfig{
+			FunctionCallingConfig: FunctionCallingConfig{
+				Mode: "NONE",
+			},
+		}
+	default:
+		result.ToolConfig = &ToolConfig{
+			FunctionCallingConfig: FunctionCallingConfig{
+				Mode:                 "ANY",
+				AllowedFunctionNames: []string{req.ToolChoice},
+			},
+		}
+	}
+
+	if req.OutputSchema != nil && len(req.OutputSchema.ToSchema()) > 0 {
+		if len(functions) == 0 {
+			if result.GenerationConfig == nil {
+				result.GenerationConfig = &GenerationConfig{}
+			}
+			result.GenerationConfig.ResponseMIMEType = "application/json"
+			result.GenerationConfig.ResponseJSONSchema = req.OutputSchema.ToSchema()
+		} else {
+			// Gemini can not combine JSON responses with function calling, so structured output is
+			// done with a function whose arguments are the output of the model.
+			description := req.OutputSchema.Description
+			if description == "" {
+				description = "Respond with the final output by calling this tool."
+			}
+			functions = append(functions, toFunction(req.OutputSchema.Name, description, req.OutputSchema.ToSchema()))
+		}
+	}
+
+	if len(functions) > 0 {
+		result.Tools = []Tool{
+			{
+				FunctionDeclarations: functions,
+			},
+		}
+	}
+
+	// Function responses must have the name of the function, the results of calls only have the call ID.
+	callNames := map[string]string{}
+	for _, msg := range req.Input {
+		for _, input := range msg.Items {
+			if input.ToolCall != nil {
+				callNames[input.ToolCall.CallID] = input.ToolCall.Name
+			}
+		}
+	}
+
+	for _, msg := range req.Input {
+		// The thought signature of a reasoning item belongs to the part the model produced after it.
+		var signature string
+		for _, input := range msg.Items {
+			if input.Reasoning != nil && input.Reasoning.EncryptedContent != "" &&
+				!strings.HasPrefix(input.Reasoning.EncryptedContent, types.AnthropicReasoningPrefix) {
+				signature = input.Reasoning.EncryptedContent
+			}
+			if input.Content != nil {
+				parts := contentToParts([]mcp.Content{*input.Content})
+				if len(parts) > 0 && msg.Role == "assistant" {
+					parts[0].ThoughtSignature, signature = signature, ""
+				}
+				appendParts(&result, msg.Role, parts...)
+			}
+			if input.ToolCall != nil {
+				args := map[string]any{}
+				if input.ToolCall.Arguments != "" {
+					if err := json.Unmarshal([]byte(input.ToolCall.Arguments), &args); err != nil {
+						return Request{}, fmt.Errorf("failed to unmarshal tool call arguments: %w", err)
+					}
+				}
+				appendParts(&result, "assistant", Part{
+					ThoughtSignature: signature,
+					FunctionCall: &FunctionCall{
+						ID:   input.ToolCall.CallID,
+						Name: input.ToolCall.Name,
+						Args: args,
+					},
+				})
+				signature = ""
+			}
+			if input.ToolCallResult != nil {
+				appendParts(&result, "user", toolResultParts(input.ToolCallResult, callNames[input.ToolCallResult.CallID])...)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func toFunction(name, description string, schema json.RawMessage) FunctionDeclaration {
+	if string(schema) == "null" {
+		schema = nil
+	}
+	return FunctionDeclaration{
+		Name:                 name,
+		Description:          description,
+		ParametersJSONSchema: schema,
+	}
+}
+
+// appendParts adds the parts to the last content if it has the same role, Gemini expects the roles
+// of the contents to alternate.
+func appendParts(req *Request, role string, parts ...Part) {
+	if len(parts) == 0 {
+		return
+	}
+	if role == "assistant" {
+		role = "model"
+	} else {
+		role = "user"
+	}
+	if len(req.Contents) > 0 && req.Contents[len(req.Contents)-1].Role == role {
+		last := &req.Contents[len(req.Contents)-1]
+		last.Parts = append(last.Parts, parts...)
+		return
+	}
+	req.Contents = append(req.Contents, Content{
+		Role:  role,
+		Parts: parts,
+	})
+}
+
+func contentToParts(content []mcp.Content) (result []Part) {
+	for _, item := range content {
+		switch {
+		case item.Type == "text" || item.Type == "":
+			if item.Text != "" {
+				result = append(result, Part{
+					Text: item.Text,
+				})
+			}
+		case (item.Type == "image" || item.Type == "audio") && item.Data != "":
+			result = append(result, Part{
+				InlineData: &Blob{
+					MIMEType: item.MIMEType,
+					Data:     item.Data,
+				},
+			})
+		case item.Type == "resource" && item.Resource != nil:
+			if item.Resource.Text != "" {
+				result = append(result, Part{
+					Text: item.Resource.Text,
+				})
+			} else if item.Resource.Blob != "" && item.Resource.MIMEType != "" {
+				// Gemini reads PDFs, images, audio, and video inline
+				result = append(result, Part{
+					InlineData: &Blob{
+						MIMEType: item.Resource.MIMEType,
+						Data:     item.Resource.Blob,
+					},
+				})
+			}
+		}
+	}
+	return
+}
+
+// toolResultParts returns the function response of the result, with the text of the result as its
+// output or error. Images and other media follow as parts of their own.
+func toolResultParts(result *types.ToolCallResult, name string) []Part {
+	var (
+		texts []string
+		media []Part
+	)
+	for _, part := range contentToParts(result.Output.Content) {
+		if part.InlineData != nil {
+			media = append(media, part)
+		} else {
+			texts = append(texts, part.Text)
+		}
+	}
+
+	key := "output"
+	if result.Output.IsError {
+		key = "error"
+	}
+	return append([]Part{
+		{
+			FunctionResponse: &FunctionResponse{
+				ID:   result.CallID,
+				Name: name,
+				Response: map[string]any{
+					key: strings.Join(texts, "\n"),
+				},
+			},
+		},
+	}, media...)
+}
+
+// toResponse converts the response, a call of outputTool is converted to the text output of the model.
+func toResponse(resp *Response, created time.Time, outputTool string) *types.CompletionResponse {
+	result := &types.CompletionResponse{
+		Model: resp.ModelVersion,
+		Output: types.Message{
+			ID:      resp.ResponseID,
+			Created: &created,
+			Role:    "assistant",
+		},
+	}
+
+	if len(resp.Candidates) > 0 {
+		for i, part := range resp.Candidates[0].Content.Parts {
+			id := fmt.Sprintf("%s-%d", resp.ResponseID, i)
+			if part.ThoughtSignature != "" || part.Thought {
+				reasoning := &types.Reasoning{
+					EncryptedContent: part.ThoughtSignature,
+				}
+				if part.Thought && part.Text != "" {
+					reasoning.Summary = []types.SummaryText{{Text: part.Text}}
+				}
+				result.Output.Items = append(result.Output.Items, types.CompletionItem{
+					ID:        id + "-reasoning",
+					Reasoning: reasoning,
+				})
+				if part.Thought {
+					continue
+				}
+			}
+			switch {
+			case part.FunctionCall != nil && outputTool != "" && part.FunctionCall.Name == outputTool:
+				args, _ := json.Marshal(part.FunctionCall.Args)
+				result.Output.Items = append(result.Output.Items, types.CompletionItem{
+					ID: id,
+					Content: &mcp.Content{
+						Type: "text",
+						Text: string(args),
+					},
+				})
+			case part.FunctionCall != nil:
+				args, _ := json.Marshal(part.FunctionCall.Args)
+				result.Output.Items = append(result.Output.Items, types.CompletionItem{
+					ID: id,
+					ToolCall: &types.ToolCall{
+						CallID:    part.FunctionCall.ID,
+						Name:      part.FunctionCall.Name,
+						Arguments: string(args),
+					},
+				})
+			case part.InlineData != nil:
+				result.Output.Items = append(result.Output.Items, types.CompletionItem{
+					ID: id,
+					Content: &mcp.Content{
+						Type:     "image",
+						MIMEType: part.InlineData.MIMEType,
+						Data:     part.InlineData.Data,
+					},
+				})
+			case part.Text != "":
+				result.Output.Items = append(result.Output.Items, types.CompletionItem{
+					ID: id,
+					Content: &mcp.Content{
+						Type: "text",
+						Text: part.Text,
+					},
+				})
+			}
+		}
+	}
+
+	result.Usage = toUsage(resp.UsageMetadata)
+
+	return result
+}
+
+// appendChunk adds the parts of a chunk of the stream to the response and returns the index of the
+// part of the response each of them was added to. Text is streamed in pieces that are joined, function
+// calls come whole.
+func appendChunk(resp *Response, chunk *Response) (indexes []int) {
+	resp.ResponseID = cmp.Or(chunk.ResponseID, resp.ResponseID)
+	resp.ModelVersion = cmp.Or(chunk.ModelVersion, resp.ModelVersion)
+	if chunk.UsageMetadata != nil {
+		resp.UsageMetadata = chunk.UsageMetadata
+	}
+	if chunk.PromptFeedback != nil {
+		resp.PromptFeedback = chunk.PromptFeedback
+	}
+	if len(chunk.Candidates) == 0 {
+		return nil
+	}
+	if len(resp.Candidates) == 0 {
+		resp.Candidates = []Candidate{{Content: Content{Role: "model"}}}
+	}
+
+	candidate := &resp.Candidates[0]
+	candidate.FinishReason = cmp.Or(chunk.Candidates[0].FinishReason, candidate.FinishReason)
+	for _, part := range chunk.Candidates[0].Content.Parts {
+		if part.FunctionCall != nil && part.FunctionCall.ID == "" {
+			part.FunctionCall.ID = uuid.String()
+		}
+		parts := candidate.Content.Parts
+		if last := len(parts) - 1; last >= 0 && isText(parts[last]) && isText(part) &&
+			parts[last].Thought == part.Thought && part.ThoughtSignature == "" {
+			parts[last].Text += part.Text
+			indexes = append(indexes, last)
+			continue
+		}
+		candidate.Content.Parts = append(candidate.Content.Parts, part)
+		indexes = append(indexes, len(candidate.Content.Parts)-1)
+	}
+	return indexes
+}
+
+func isText(part Part) bool {
+	return part.FunctionCall == nil && part.FunctionResponse == nil && part.InlineData == nil
+}
+
+func toUsage(usage *UsageMetadata) *types.Usage {
+	if usage == nil {
+		return nil
+	}
+	return &types.Usage{
+		InputTokens:  usage.PromptTokenCount,
+		OutputTokens: usage.CandidatesTokenCount + usage.ThoughtsTokenCount,
+	}
+}
+
+// stopReason converts the finish reasons of Gemini: STOP, MAX_TOKENS, SAFETY, RECITATION, and others.
+func stopReason(resp *Response) string {
+	if len(resp.Candidates) == 0 {
+		return ""
+	}
+	candidate := resp.Candidates[0]
+	switch candidate.FinishReason {
+	case "":
+		return ""
+	case "STOP":
+		for _, part := range candidate.Content.Parts {
+			if part.FunctionCall != nil {
+				return types.StopReasonToolUse
+			}
+		}
+		return types.StopReasonEndTurn
+	case "MAX_TOKENS":
+		return types.StopReasonMaxTokens
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return types.StopReasonContentFilter
+	}
+	return strings.ToLower(candidate.FinishReason)
+}
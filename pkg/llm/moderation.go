@@ -0,0 +1,19 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+var _ types.Moderator = (*Client)(nil)
+
+// Moderate returns the moderation of the text, retried according to the retry policy of the openai
+// provider.
+func (c Client) Moderate(ctx context.Context, config types.Moderation, text string) (*types.ModerationResult, error) {
+	client := c.speechClient(config.BaseURL, config.APIKey)
+	return retry.Do(ctx, types.ConfigFromContext(ctx).GetRetryPolicy("openai"), func(ctx context.Context) (*types.ModerationResult, error) {
+		return client.Moderate(ctx, config.GetModel(), text)
+	})
+}
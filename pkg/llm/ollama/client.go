@@ -0,0 +1,240 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/llm/progress"
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// ModelPrefix selects the Ollama provider, for example "ollama/llama3.1".
+const ModelPrefix = "ollama/"
+
+type Client struct {
+	Config
+
+	pulled sync.Map
+}
+
+type Config struct {
+	BaseURL string
+	Headers map[string]string
+	// PullModels will pull a model that is not available locally the first time it is used.
+	PullModels bool
+}
+
+// NewClient creates a new Ollama client with the provided base URL.
+func NewClient(cfg Config) *Client {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "http://localhost:11434"
+	}
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	if cfg.Headers == nil {
+		cfg.Headers = map[string]string{}
+	}
+	if _, ok := cfg.Headers["Content-Type"]; !ok {
+		cfg.Headers["Content-Type"] = "application/json"
+	}
+
+	return &Client{
+		Config: cfg,
+	}
+}
+
+func (c *Client) Complete(ctx context.Context, completionRequest types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error) {
+	req, err := toRequest(&completionRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := c.BaseURL
+	if completionRequest.BaseURL != "" {
+		baseURL = strings.TrimSuffix(completionRequest.BaseURL, "/")
+	}
+
+	if c.PullModels {
+		if err := c.ensureModel(ctx, baseURL, req.Model); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		ts = time.Now()
+		id = uuid.String()
+	)
+	resp, err := c.complete(ctx, baseURL, id, completionRequest.Agent, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return toResponse(resp, id, ts), nil
+}
+
+// Check lists the local models of the Ollama server to verify it is running.
+func (c *Client) Check(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/tags", nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range c.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return retry.NewStatusError("Ollama API", httpResp)
+	}
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, url string, body any) (*http.Response, error) {
+	data, _ := json.Marshal(body)
+	log.Messages(ctx, "ollama-api", true, data)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range c.Headers {
+		httpReq.Header.Set(key, value)
+	}
+	return transport.Client.Do(httpReq)
+}
+
+// ensureModel pulls the model if the Ollama server does not have it yet.
+func (c *Client) ensureModel(ctx context.Context, baseURL, model string) error {
+	key := baseURL + "|" + model
+	if _, ok := c.pulled.Load(key); ok {
+		return nil
+	}
+
+	httpResp, err := c.post(ctx, baseURL+"/api/show", map[string]string{
+		"model": model,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check for ollama model %s: %w", model, err)
+	}
+	_ = httpResp.Body.Close()
+
+	if httpResp.StatusCode == http.StatusNotFound {
+		log.Infof(ctx, "Pulling ollama model %s, this may take a while...", model)
+		httpResp, err = c.post(ctx, baseURL+"/api/pull", PullRequest{
+			Model: model,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to pull ollama model %s: %w", model, err)
+		}
+		defer httpResp.Body.Close()
+
+		var pullResp PullResponse
+		if err := json.NewDecoder(httpResp.Body).Decode(&pullResp); err != nil {
+			return fmt.Errorf("failed to read pull response for ollama model %s: %w", model, err)
+		}
+		if httpResp.StatusCode != http.StatusOK || pullResp.Error != "" {
+			return fmt.Errorf("failed to pull ollama model %s: %s %s", model, httpResp.Status, pullResp.Error)
+		}
+		log.Infof(ctx, "Pulled ollama model %s", model)
+	} else if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to check for ollama model %s: %s", model, httpResp.Status)
+	}
+
+	c.pulled.Store(key, struct{}{})
+	return nil
+}
+
+func (c *Client) complete(ctx context.Context, baseURL, id, agentName string, req Request, opts ...types.CompletionOptions) (*Response, error) {
+	var (
+		opt = complete.Complete(opts...)
+	)
+
+	req.Stream = true
+
+	httpResp, err := c.post(ctx, baseURL+"/api/chat", req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, retry.NewStatusError("Ollama API", httpResp)
+	}
+
+	var (
+		lines = bufio.NewScanner(httpResp.Body)
+		resp  Response
+	)
+	lines.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for lines.Scan() {
+		var delta Response
+		if err := json.Unmarshal(lines.Bytes(), &delta); err != nil {
+			log.Errorf(ctx, "failed to decode event: %v: %s", err, lines.Text())
+			continue
+		}
+		if delta.Error != "" {
+			return nil, fmt.Errorf("ollama API error: %s", delta.Error)
+		}
+
+		resp.Model = delta.Model
+		resp.Message.Role = delta.Message.Role
+		resp.Message.Content += delta.Message.Content
+		resp.Message.ToolCalls = append(resp.Message.ToolCalls, delta.Message.ToolCalls...)
+
+		if delta.Message.Content != "" {
+			progress.Send(ctx, &types.CompletionProgress{
+				Model:     resp.Model,
+				Agent:     agentName,
+				MessageID: id,
+				Item: types.CompletionItem{
+					ID:      id + "-0",
+					Partial: true,
+					HasMore: true,
+					Content: &mcp.Content{
+						Type: "text",
+						Text: delta.Message.Content,
+					},
+				},
+			}, opt.ProgressToken)
+		}
+
+		if delta.Done {
+			resp.Done = true
+			resp.DoneReason = delta.DoneReason
+			resp.PromptEvalCount = delta.PromptEvalCount
+			resp.EvalCount = delta.EvalCount
+			progress.SendUsage(ctx, types.CompletionProgress{
+				Model:     resp.Model,
+				Agent:     agentName,
+				MessageID: id,
+			}, toUsage(&resp), stopReason(&resp), opt.ProgressToken)
+			break
+		}
+	}
+
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	respData, err := json.Marshal(resp)
+	if err == nil {
+		log.Messages(ctx, "ollama-api", false, respData)
+	}
+
+	return &resp, nil
+}
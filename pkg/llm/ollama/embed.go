@@ -0,0 +1,51 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+)
+
+type embedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Embed returns the embeddings of the input from the embed API of the Ollama server, in the order of the input.
+func (c *Client) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	model = strings.TrimPrefix(model, ModelPrefix)
+	if c.PullModels {
+		if err := c.ensureModel(ctx, c.BaseURL, model); err != nil {
+			return nil, err
+		}
+	}
+
+	httpResp, err := c.post(ctx, c.BaseURL+"/api/embed", embedRequest{
+		Model: model,
+		Input: input,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, retry.NewStatusError("Ollama API", httpResp)
+	}
+
+	var resp embedResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode embed response: %w", err)
+	}
+	if len(resp.Embeddings) != len(input) {
+		return nil, fmt.Errorf("ollama returned %d embeddings for %d inputs", len(resp.Embeddings), len(input))
+	}
+	return resp.Embeddings, nil
+}
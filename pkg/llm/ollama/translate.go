@@ -0,0 +1,179 @@
+package ollama
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+func toUsage(resp *Response) *types.Usage {
+	if resp.PromptEvalCount == 0 && resp.EvalCount == 0 {
+		return nil
+	}
+	return &types.Usage{
+		InputTokens:  resp.PromptEvalCount,
+		OutputTokens: resp.EvalCount,
+	}
+}
+
+// stopReason is why the response ended, with the names of the stop reasons of the other providers.
+func stopReason(resp *Response) string {
+	switch {
+	case len(resp.Message.ToolCalls) > 0:
+		return types.StopReasonToolUse
+	case resp.DoneReason == "stop":
+		return types.StopReasonEndTurn
+	case resp.DoneReason == "length":
+		return types.StopReasonMaxTokens
+	}
+	return resp.DoneReason
+}
+
+func toResponse(resp *Response, id string, created time.Time) *types.CompletionResponse {
+	result := &types.CompletionResponse{
+		Model: resp.Model,
+		Output: types.Message{
+			ID:      id,
+			Created: &created,
+			Role:    "assistant",
+		},
+	}
+
+	if resp.Message.Content != "" {
+		result.Output.Items = append(result.Output.Items, types.CompletionItem{
+			ID: id + "-0",
+			Content: &mcp.Content{
+				Type: "text",
+				Text: resp.Message.Content,
+			},
+		})
+	}
+
+	result.Usage = toUsage(resp)
+
+	for i, toolCall := range resp.Message.ToolCalls {
+		args, _ := json.Marshal(toolCall.Function.Arguments)
+		result.Output.Items = append(result.Output.Items, types.CompletionItem{
+			ID: fmt.Sprintf("%s-%d", id, i+1),
+			ToolCall: &types.ToolCall{
+				// Ollama does not assign IDs to tool calls
+				CallID:    uuid.String(),
+				Name:      toolCall.Function.Name,
+				Arguments: string(args),
+			},
+		})
+	}
+
+	return result
+}
+
+func toRequest(req *types.CompletionRequest) (Request, error) {
+	result := Request{
+		Model: strings.TrimPrefix(req.Model, ModelPrefix),
+	}
+
+	if req.Temperature != nil || req.TopP != nil || req.MaxTokens != 0 || len(req.Stop) > 0 ||
+		req.FrequencyPenalty != nil || req.PresencePenalty != nil || req.Seed != nil {
+		result.Options = &Options{
+			Temperature:      req.Temperature,
+			TopP:             req.TopP,
+			NumPredict:       req.MaxTokens,
+			Stop:             req.Stop,
+			FrequencyPenalty: req.FrequencyPenalty,
+			PresencePenalty:  req.PresencePenalty,
+			Seed:             req.Seed,
+		}
+	}
+
+	if req.OutputSchema != nil {
+		result.Format = req.OutputSchema.ToSchema()
+	}
+
+	if req.SystemPrompt != "" {
+		result.Messages = append(result.Messages, Message{
+			Role:    "system",
+			Content: req.SystemPrompt,
+		})
+	}
+
+	if req.ToolChoice != "none" {
+		for _, tool := range req.Tools {
+			result.Tools = append(result.Tools, Tool{
+				Type: "function",
+				Function: ToolFunction{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.Parameters,
+				},
+			})
+		}
+	}
+
+	// Ollama refers to tool results by the tool name, not an ID.
+	toolNames := map[string]string{}
+
+	for _, msg := range req.Input {
+		for _, input := range msg.Items {
+			if input.Content != nil {
+				result.Messages = append(result.Messages, contentToMessage(msg.Role, []mcp.Content{*input.Content}))
+			}
+			if input.ToolCall != nil {
+				args := map[string]any{}
+				if err := json.Unmarshal([]byte(input.ToolCall.Arguments), &args); err != nil {
+					return Request{}, fmt.Errorf("failed to unmarshal tool call arguments: %w", err)
+				}
+				toolNames[input.ToolCall.CallID] = input.ToolCall.Name
+				result.Messages = append(result.Messages, Message{
+					Role: "assistant",
+					ToolCalls: []ToolCall{
+						{
+							Function: ToolCallFunction{
+								Name:      input.ToolCall.Name,
+								Arguments: args,
+							},
+						},
+					},
+				})
+			}
+			if input.ToolCallResult != nil {
+				toolMsg := contentToMessage("tool", input.ToolCallResult.Output.Content)
+				toolMsg.ToolName = toolNames[input.ToolCallResult.CallID]
+				result.Messages = append(result.Messages, toolMsg)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func contentToMessage(role string, content []mcp.Content) Message {
+	var (
+		result = Message{
+			Role: role,
+		}
+		text []string
+	)
+
+	for _, item := range content {
+		if item.Type == "text" || item.Type == "" {
+			text = append(text, item.Text)
+		} else if item.Type == "image" {
+			result.Images = append(result.Images, item.Data)
+		} else if item.Type == "resource" && item.Resource != nil {
+			// Ollama only reads text and images, so binary resources other than images are left out.
+			if item.Resource.Text != "" {
+				text = append(text, item.Resource.Text)
+			} else if strings.HasPrefix(item.Resource.MIMEType, "image/") {
+				result.Images = append(result.Images, item.Resource.Blob)
+			}
+		}
+	}
+
+	result.Content = strings.Join(text, "\n")
+	return result
+}
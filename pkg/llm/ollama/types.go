@@ -0,0 +1,75 @@
+package ollama
+
+import (
+	"encoding/json"
+)
+
+type Request struct {
+	Model    string          `json:"model"`
+	Messages []Message       `json:"messages"`
+	Tools    []Tool          `json:"tools,omitempty"`
+	Format   json.RawMessage `json:"format,omitempty"`
+	Stream   bool            `json:"stream"`
+	Options  *Options        `json:"options,omitempty"`
+}
+
+type Options struct {
+	Temperature      *json.Number `json:"temperature,omitempty"`
+	TopP             *json.Number `json:"top_p,omitempty"`
+	NumPredict       int          `json:"num_predict,omitempty"`
+	Stop             []string     `json:"stop,omitempty"`
+	FrequencyPenalty *json.Number `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *json.Number `json:"presence_penalty,omitempty"`
+	Seed             *int         `json:"seed,omitempty"`
+}
+
+type Message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+}
+
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+type Tool struct {
+	// Type is always "function"
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitzero"`
+}
+
+// Response is a single line of the streamed chat response. The final line has Done set.
+type Response struct {
+	Model           string  `json:"model"`
+	CreatedAt       string  `json:"created_at"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason,omitempty"`
+	PromptEvalCount int     `json:"prompt_eval_count,omitempty"`
+	EvalCount       int     `json:"eval_count,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+type PullRequest struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+}
+
+type PullResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
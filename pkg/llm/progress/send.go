@@ -23,3 +23,16 @@ func Send(ctx context.Context, progress *types.CompletionProgress, progressToken
 		},
 	})
 }
+
+// SendUsage sends the usage of the completion of the message so far, and why the LLM stopped once it
+// is known, so clients can show live token and cost counters.
+func SendUsage(ctx context.Context, progress types.CompletionProgress, usage *types.Usage, stopReason string, progressToken any) {
+	if usage == nil && stopReason == "" {
+		return
+	}
+	progress.Item = types.CompletionItem{}
+	progress.Usage = usage
+	progress.CostUSD = types.ConfigFromContext(ctx).Cost(progress.Model, usage)
+	progress.StopReason = stopReason
+	Send(ctx, &progress, progressToken)
+}
@@ -0,0 +1,132 @@
+package responses
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+)
+
+type transcriptionResponse struct {
+	Text string `json:"text"`
+}
+
+type speechRequest struct {
+	Model          string `json:"model"`
+	Input          string `json:"input"`
+	Voice          string `json:"voice"`
+	ResponseFormat string `json:"response_format,omitempty"`
+}
+
+// audioExtensions are the file extensions the transcription API uses to detect the format of the audio.
+var audioExtensions = map[string]string{
+	"audio/mpeg":  ".mp3",
+	"audio/mp3":   ".mp3",
+	"audio/mp4":   ".m4a",
+	"audio/x-m4a": ".m4a",
+	"audio/wav":   ".wav",
+	"audio/x-wav": ".wav",
+	"audio/wave":  ".wav",
+	"audio/webm":  ".webm",
+	"audio/ogg":   ".ogg",
+	"audio/flac":  ".flac",
+}
+
+func audioFilename(mimeType string) string {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	if ext, ok := audioExtensions[mediaType]; ok {
+		return "audio" + ext
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return "audio" + exts[0]
+	}
+	return "audio.wav"
+}
+
+// Transcribe returns the text of the audio from the OpenAI transcription API.
+func (c *Client) Transcribe(ctx context.Context, model, language, mimeType string, audio []byte) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("model", model)
+	_ = writer.WriteField("response_format", "json")
+	if language != "" {
+		_ = writer.WriteField("language", language)
+	}
+	file, err := writer.CreateFormFile("file", audioFilename(mimeType))
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(audio); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/audio/transcriptions", &body)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range c.Headers {
+		httpReq.Header.Set(key, value)
+	}
+	httpReq.Header.Set("Content-Type", writer.FormDataContentType())
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return "", retry.NewStatusError("OpenAI Transcription API", httpResp)
+	}
+
+	var resp transcriptionResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return "", fmt.Errorf("failed to decode transcription response: %w", err)
+	}
+	return resp.Text, nil
+}
+
+// Synthesize returns the speech of the text from the OpenAI speech API.
+func (c *Client) Synthesize(ctx context.Context, model, voice, format, text string) ([]byte, error) {
+	data, err := json.Marshal(speechRequest{
+		Model:          model,
+		Input:          text,
+		Voice:          voice,
+		ResponseFormat: format,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/audio/speech", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range c.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, retry.NewStatusError("OpenAI Speech API", httpResp)
+	}
+
+	audio, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read speech response: %w", err)
+	}
+	return audio, nil
+}
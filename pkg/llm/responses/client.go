@@ -5,11 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 
 	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
 	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
 	"github.com/nanobot-ai/nanobot/pkg/types"
 )
 
@@ -21,6 +22,13 @@ type Config struct {
 	APIKey  string
 	BaseURL string
 	Headers map[string]string
+	// Query is added to the URL of requests, like the api-version of Azure OpenAI.
+	Query map[string]string
+	// Authorize adds credentials that change over time to requests, like short-lived access tokens.
+	Authorize func(*http.Request) error
+	// DeploymentPaths sends embeddings requests to /deployments/{model}/embeddings, the path of the
+	// api-version API of Azure OpenAI.
+	DeploymentPaths bool
 }
 
 // NewClient creates a new OpenAI client with the provided API key and base URL.
@@ -43,13 +51,58 @@ func NewClient(cfg Config) *Client {
 	}
 }
 
+// Check lists the models of the API, a request that costs nothing, to verify the API key and base URL.
+func (c *Client) Check(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/models", nil)
+	if err != nil {
+		return err
+	}
+	if err := c.prepare(httpReq); err != nil {
+		return err
+	}
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return retry.NewStatusError("OpenAI API", httpResp)
+	}
+	return nil
+}
+
+// prepare adds the headers, query parameters, and credentials of the config to the request.
+func (c *Client) prepare(httpReq *http.Request) error {
+	for key, value := range c.Headers {
+		httpReq.Header.Set(key, value)
+	}
+	if len(c.Query) > 0 {
+		query := httpReq.URL.Query()
+		for key, value := range c.Query {
+			query.Set(key, value)
+		}
+		httpReq.URL.RawQuery = query.Encode()
+	}
+	if c.Authorize != nil {
+		if err := c.Authorize(httpReq); err != nil {
+			return fmt.Errorf("failed to authorize request: %w", err)
+		}
+	}
+	return nil
+}
+
 func (c *Client) Complete(ctx context.Context, completionRequest types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error) {
 	req, err := toRequest(&completionRequest)
 	if err != nil {
 		return nil, err
 	}
+	if len(completionRequest.Stop) > 0 || completionRequest.FrequencyPenalty != nil || completionRequest.PresencePenalty != nil ||
+		completionRequest.Seed != nil {
+		log.Debugf(ctx, "the Responses API has no stop, penalties, or seed, ignoring them for %s", completionRequest.Model)
+	}
 
-	resp, err := c.complete(ctx, completionRequest.Agent, req, opts...)
+	resp, err := c.complete(ctx, completionRequest.Agent, req, completionRequest.Reasoning.Exposed(), opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +110,8 @@ func (c *Client) Complete(ctx context.Context, completionRequest types.Completio
 	return toResponse(&completionRequest, resp)
 }
 
-func (c *Client) complete(ctx context.Context, agentName string, req Request, opts ...types.CompletionOptions) (*Response, error) {
+// complete streams the response, the reasoning summaries are sent as progress if exposeReasoning is true.
+func (c *Client) complete(ctx context.Context, agentName string, req Request, exposeReasoning bool, opts ...types.CompletionOptions) (*Response, error) {
 	var (
 		response Response
 		opt      = complete.Complete(opts...)
@@ -72,21 +126,20 @@ func (c *Client) complete(ctx context.Context, agentName string, req Request, op
 	if err != nil {
 		return nil, err
 	}
-	for key, value := range c.Headers {
-		httpReq.Header.Set(key, value)
+	if err := c.prepare(httpReq); err != nil {
+		return nil, err
 	}
 
-	httpResp, err := http.DefaultClient.Do(httpReq)
+	httpResp, err := transport.Client.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
 	defer httpResp.Body.Close()
 	if httpResp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(httpResp.Body)
-		return nil, fmt.Errorf("failed to get response from OpenAI Responses API: %s %q", httpResp.Status, string(body))
+		return nil, retry.NewStatusError("OpenAI Responses API", httpResp)
 	}
 
-	response, ok, err := progressResponse(ctx, agentName, req.Model, httpResp, opt.ProgressToken)
+	response, ok, err := progressResponse(ctx, agentName, req.Model, httpResp, exposeReasoning, opt.ProgressToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
@@ -0,0 +1,72 @@
+package responses
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+)
+
+type embeddingsRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed returns the embeddings of the input from the OpenAI embeddings API, in the order of the input.
+func (c *Client) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	data, err := json.Marshal(embeddingsRequest{
+		Model: model,
+		Input: input,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/embeddings"
+	if c.DeploymentPaths {
+		path = "/deployments/" + url.PathEscape(model) + path
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.prepare(httpReq); err != nil {
+		return nil, err
+	}
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, retry.NewStatusError("OpenAI Embeddings API", httpResp)
+	}
+
+	var resp embeddingsResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode embeddings response: %w", err)
+	}
+
+	result := make([][]float32, len(input))
+	for _, embedding := range resp.Data {
+		if embedding.Index < 0 || embedding.Index >= len(result) {
+			return nil, fmt.Errorf("embeddings response has invalid index %d", embedding.Index)
+		}
+		result[embedding.Index] = embedding.Embedding
+	}
+	return result, nil
+}
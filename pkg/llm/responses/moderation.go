@@ -0,0 +1,59 @@
+package responses
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+type moderationRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type moderationResponse struct {
+	Results []types.ModerationResult `json:"results"`
+}
+
+// Moderate returns the result of the OpenAI moderation API for the text.
+func (c *Client) Moderate(ctx context.Context, model, text string) (*types.ModerationResult, error) {
+	data, err := json.Marshal(moderationRequest{
+		Model: model,
+		Input: text,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/moderations", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range c.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	httpResp, err := transport.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, retry.NewStatusError("OpenAI Moderation API", httpResp)
+	}
+
+	var resp moderationResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode moderation response: %w", err)
+	}
+	if len(resp.Results) == 0 {
+		return nil, fmt.Errorf("moderation response has no results")
+	}
+	return &resp.Results[0], nil
+}
@@ -13,7 +13,7 @@ import (
 	"github.com/nanobot-ai/nanobot/pkg/types"
 )
 
-func progressResponse(ctx context.Context, agentName, modelName string, resp *http.Response, progressToken any) (response Response, seen bool, err error) {
+func progressResponse(ctx context.Context, agentName, modelName string, resp *http.Response, exposeReasoning bool, progressToken any) (response Response, seen bool, err error) {
 	lines := bufio.NewScanner(resp.Body)
 	defer resp.Body.Close()
 
@@ -54,6 +54,15 @@ func progressResponse(ctx context.Context, agentName, modelName string, resp *ht
 							Name:   event.Item.Name,
 						},
 					}
+				} else if event.Item.Type == "reasoning" && exposeReasoning {
+					progress.Item = types.CompletionItem{
+						Partial: true,
+						HasMore: true,
+						ID:      event.Item.ID,
+						Reasoning: &types.Reasoning{
+							Summary: []types.SummaryText{{}},
+						},
+					}
 				} else if event.Item.Type == "message" {
 					progress.Item = types.CompletionItem{
 						Partial: true,
@@ -76,6 +85,17 @@ func progressResponse(ctx context.Context, agentName, modelName string, resp *ht
 					llmProgress.Send(ctx, &progress, progressToken)
 				}
 				progress.Item = types.CompletionItem{}
+			case "response.reasoning_summary_part.added":
+				// Parts of the summary are sent as paragraphs of one text
+				if progress.Item.Reasoning != nil && event.SummaryIndex > 0 {
+					progress.Item.Reasoning.Summary[0].Text = "\n\n"
+					llmProgress.Send(ctx, &progress, progressToken)
+				}
+			case "response.reasoning_summary_text.delta":
+				if progress.Item.Reasoning != nil {
+					progress.Item.Reasoning.Summary[0].Text = event.Delta
+					llmProgress.Send(ctx, &progress, progressToken)
+				}
 			case "response.output_text.delta":
 				if progress.Item.Content != nil {
 					progress.Item.Content.Text = event.Delta
@@ -87,6 +107,9 @@ func progressResponse(ctx context.Context, agentName, modelName string, resp *ht
 				log.Messages(ctx, "responses-api", false, data)
 				response = event.Response
 				seen = true
+				// The Responses API reports the usage only when the response is done
+				progress.MessageID = response.ID
+				llmProgress.SendUsage(ctx, progress, toUsage(response.Usage), stopReason(response), progressToken)
 			}
 		}
 	}
@@ -94,3 +117,25 @@ func progressResponse(ctx context.Context, agentName, modelName string, resp *ht
 	err = lines.Err()
 	return
 }
+
+// stopReason is why the response ended, with the names of the stop reasons of the other providers.
+func stopReason(resp Response) string {
+	switch resp.Status {
+	case StatusCompleted:
+		for _, output := range resp.Output {
+			if output.FunctionCall != nil {
+				return types.StopReasonToolUse
+			}
+		}
+		return types.StopReasonEndTurn
+	case StatusIncomplete:
+		if resp.IncompleteDetails == nil {
+			return ""
+		}
+		if resp.IncompleteDetails.Reason == "max_output_tokens" {
+			return types.StopReasonMaxTokens
+		}
+		return resp.IncompleteDetails.Reason
+	}
+	return ""
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
@@ -64,9 +66,21 @@ func toResponse(req *types.CompletionRequest, resp *Response) (*types.Completion
 		}
 	}
 
+	result.Usage = toUsage(resp.Usage)
+
 	return result, nil
 }
 
+func toUsage(usage Usage) *types.Usage {
+	if usage.InputTokens == 0 && usage.OutputTokens == 0 {
+		return nil
+	}
+	return &types.Usage{
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+	}
+}
+
 func toSamplingMessageFromOutputMessage(output *Message) (result []types.CompletionItem) {
 	for _, content := range output.Content {
 		if content.OutputText != nil {
@@ -96,7 +110,7 @@ func toRequest(completion *types.CompletionRequest) (req Request, _ error) {
 		Store: &[]bool{false}[0],
 	}
 
-	if reasoningPrefix.MatchString(req.Model) {
+	if reasoningPrefix.MatchString(req.Model) || completion.Reasoning != nil {
 		req.Include = append(req.Include, "reasoning.encrypted_content")
 		req.Reasoning = &ResponseReasoning{}
 		if completion.Reasoning != nil && completion.Reasoning.Summary != "" {
@@ -204,7 +218,8 @@ func toRequest(completion *types.CompletionRequest) (req Request, _ error) {
 			if input.ToolCallResult != nil {
 				req.Input.Items = append(req.Input.Items, toolCallResultToInputItems(completion, input.ToolCallResult)...)
 			}
-			if input.Reasoning != nil && input.Reasoning.EncryptedContent != "" {
+			if input.Reasoning != nil && input.Reasoning.EncryptedContent != "" &&
+				!strings.HasPrefix(input.Reasoning.EncryptedContent, types.AnthropicReasoningPrefix) {
 				// summary must not be nil
 				summary := make([]SummaryText, 0)
 				for _, s := range input.Reasoning.Summary {
@@ -270,7 +285,22 @@ func contentToInputItem(content mcp.Content) (InputItemContent, bool) {
 				FileData: &content.Data,
 			},
 		}, true
-	case "resources":
+	case "resource":
+		if content.Resource != nil && content.Resource.Text != "" {
+			return InputItemContent{
+				InputText: &InputText{
+					Text: resourceText(content.Resource),
+				},
+			}, true
+		}
+		if content.Resource != nil && strings.HasPrefix(content.Resource.MIMEType, "image/") {
+			url := "data:" + content.Resource.MIMEType + ";base64," + content.Resource.Blob
+			return InputItemContent{
+				InputImage: &InputImage{
+					ImageURL: &url,
+				},
+			}, true
+		}
 		if content.Resource != nil {
 			return InputItemContent{
 				InputFile: toInputFile(content.Resource),
@@ -428,18 +458,35 @@ func messageToInputItem(role string, content mcp.Content) (InputItem, bool) {
 	}, true
 }
 
+// resourceText is the text of the resource with its URI, so the model can refer tools to it.
+func resourceText(resource *mcp.EmbeddedResource) string {
+	if resource.URI == "" {
+		return resource.Text
+	}
+	return fmt.Sprintf("Contents of %s:\n%s", resource.URI, resource.Text)
+}
+
 func toInputFile(file *mcp.EmbeddedResource) *InputFile {
+	mimeType := file.MIMEType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	filename := path.Base(file.URI)
+	if filename == "." || filename == "/" {
+		filename = "attachment"
+	}
 	if file.Text != "" {
-		fileData := base64.StdEncoding.EncodeToString([]byte(file.Text))
+		fileData := "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString([]byte(file.Text))
 		return &InputFile{
 			FileData: &fileData,
-			Filename: file.URI,
+			Filename: filename,
 		}
 	}
 	if file.Blob != "" {
+		fileData := "data:" + mimeType + ";base64," + file.Blob
 		return &InputFile{
-			FileData: &file.Blob,
-			Filename: file.URI,
+			FileData: &fileData,
+			Filename: filename,
 		}
 	}
 	return &InputFile{}
@@ -1315,10 +1315,11 @@ func (r Response) MarshalJSON() ([]byte, error) {
 }
 
 type Progress struct {
-	Type     string       `json:"type,omitempty"`
-	Delta    string       `json:"delta,omitempty"`
-	Item     ProgressItem `json:"item,omitempty"`
-	Response Response     `json:"response"`
+	Type         string       `json:"type,omitempty"`
+	Delta        string       `json:"delta,omitempty"`
+	SummaryIndex int          `json:"summary_index,omitempty"`
+	Item         ProgressItem `json:"item,omitempty"`
+	Response     Response     `json:"response"`
 }
 
 type ProgressItem struct {
@@ -0,0 +1,147 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/events"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// StatusError is returned by the LLM providers when their API responds with an unexpected status.
+type StatusError struct {
+	API        string
+	StatusCode int
+	Status     string
+	Body       string
+	// RetryAfter is the wait the provider asked for before the next request, zero if it did not.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("failed to get response from %s: %s %q", e.API, e.Status, e.Body)
+}
+
+// NewStatusError reads the body of the response and returns the error for its status.
+func NewStatusError(api string, resp *http.Response) *StatusError {
+	body, _ := io.ReadAll(resp.Body)
+	return &StatusError{
+		API:        api,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+		RetryAfter: retryAfter(resp.Header),
+	}
+}
+
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// Retryable returns true if the request may succeed when it is sent again, and the wait the provider
+// asked for, if any.
+func Retryable(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) {
+		return false, 0
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+			// Anthropic responds with 529 when it is overloaded
+			529:
+			return true, statusErr.RetryAfter
+		}
+		return false, 0
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded), 0
+}
+
+// Do calls fn until it succeeds, fails with an error that is not retryable, or the attempts or the
+// timeout of the policy are used up. Waits between attempts back off exponentially with jitter, or
+// follow the Retry-After of the provider.
+func Do[T any](ctx context.Context, policy types.RetryPolicy, fn func(context.Context) (T, error)) (result T, err error) {
+	if timeout := policy.GetTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	backoff := policy.GetInitialBackoff()
+	for attempt := 1; ; attempt++ {
+		result, err = fn(ctx)
+		if err == nil || attempt >= policy.GetMaxAttempts() {
+			return result, err
+		}
+
+		retryable, wait := Retryable(err)
+		if !retryable || ctx.Err() != nil {
+			return result, err
+		}
+
+		if wait <= 0 && backoff > 0 {
+			// Full jitter keeps clients that failed at the same time from retrying at the same time.
+			wait = rand.N(backoff) + 1
+			// Doubling is capped so that many attempts do not overflow the backoff
+			backoff = min(backoff*2, max(policy.GetMaxBackoff(), backoff))
+		}
+		wait = min(wait, policy.GetMaxBackoff())
+
+		log.Infof(ctx, "retrying completion in %s after attempt %d failed: %v", wait.Round(time.Millisecond), attempt, err)
+		events.Publish(ctx, events.Event{
+			Type:    events.Retry,
+			Message: err.Error(),
+			Data: map[string]any{
+				"attempt": attempt,
+				"waitMs":  wait.Milliseconds(),
+			},
+		})
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// ErrorCode returns the code of the ErrorData of a completion that failed with err.
+func ErrorCode(err error) string {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return "request_failed"
+	}
+	switch statusErr.StatusCode {
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "unauthorized"
+	}
+	if statusErr.StatusCode >= http.StatusInternalServerError {
+		return "server_error"
+	}
+	return "bad_request"
+}
@@ -0,0 +1,167 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+		wait      time.Duration
+	}{
+		{name: "rate limit", err: &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 2 * time.Second}, retryable: true, wait: 2 * time.Second},
+		{name: "overloaded", err: &StatusError{StatusCode: 529}, retryable: true},
+		{name: "unavailable", err: fmt.Errorf("failed: %w", &StatusError{StatusCode: http.StatusServiceUnavailable}), retryable: true},
+		{name: "bad request", err: &StatusError{StatusCode: http.StatusBadRequest}},
+		{name: "unauthorized", err: &StatusError{StatusCode: http.StatusUnauthorized}},
+		{name: "canceled", err: context.Canceled},
+		{name: "deadline", err: context.DeadlineExceeded, retryable: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, retryable: true},
+		{name: "other", err: errors.New("invalid tool call")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retryable, wait := Retryable(tt.err)
+			if retryable != tt.retryable || wait != tt.wait {
+				t.Errorf("expected %v, %s, got %v, %s", tt.retryable, tt.wait, retryable, wait)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	header := http.Header{}
+	if wait := retryAfter(header); wait != 0 {
+		t.Errorf("expected no wait, got %s", wait)
+	}
+
+	header.Set("Retry-After", "3")
+	if wait := retryAfter(header); wait != 3*time.Second {
+		t.Errorf("expected 3s, got %s", wait)
+	}
+
+	header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if wait := retryAfter(header); wait <= 50*time.Second || wait > time.Minute {
+		t.Errorf("expected about a minute, got %s", wait)
+	}
+
+	header.Set("Retry-After", "soon")
+	if wait := retryAfter(header); wait != 0 {
+		t.Errorf("expected no wait, got %s", wait)
+	}
+}
+
+func TestDo(t *testing.T) {
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name     string
+		policy   types.RetryPolicy
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{
+			name:     "succeeds",
+			policy:   types.RetryPolicy{MaxAttempts: 3, InitialBackoff: "1ms"},
+			attempts: 1,
+		},
+		{
+			name:     "retries until it succeeds",
+			policy:   types.RetryPolicy{MaxAttempts: 3, InitialBackoff: "1ms"},
+			errs:     []error{unavailable, unavailable},
+			attempts: 3,
+		},
+		{
+			name:     "stops after max attempts",
+			policy:   types.RetryPolicy{MaxAttempts: 2, InitialBackoff: "1ms"},
+			errs:     []error{unavailable, unavailable, unavailable},
+			attempts: 2,
+			err:      unavailable,
+		},
+		{
+			name:     "does not retry without a policy",
+			errs:     []error{unavailable},
+			attempts: 1,
+			err:      unavailable,
+		},
+		{
+			name:     "does not retry errors that are not retryable",
+			policy:   types.RetryPolicy{MaxAttempts: 3, InitialBackoff: "1ms"},
+			errs:     []error{&StatusError{StatusCode: http.StatusBadRequest}},
+			attempts: 1,
+			err:      &StatusError{StatusCode: http.StatusBadRequest},
+		},
+		{
+			name:     "caps Retry-After at max backoff",
+			policy:   types.RetryPolicy{MaxAttempts: 2, MaxBackoff: "1ms"},
+			errs:     []error{&StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}},
+			attempts: 2,
+		},
+		{
+			name:     "zero backoff",
+			policy:   types.RetryPolicy{MaxAttempts: 3, InitialBackoff: "0s"},
+			errs:     []error{unavailable, unavailable},
+			attempts: 3,
+		},
+		{
+			name:     "many attempts",
+			policy:   types.RetryPolicy{MaxAttempts: 70, InitialBackoff: "1ns", MaxBackoff: "1ns"},
+			errs:     make([]error, 69),
+			attempts: 70,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.errs {
+				if tt.errs[i] == nil {
+					tt.errs[i] = unavailable
+				}
+			}
+
+			var attempts int
+			result, err := Do(context.Background(), tt.policy, func(context.Context) (string, error) {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return "", tt.errs[attempts-1]
+				}
+				return "ok", nil
+			})
+
+			if attempts != tt.attempts {
+				t.Errorf("expected %d attempts, got %d", tt.attempts, attempts)
+			}
+			if tt.err != nil {
+				if err == nil || err.Error() != tt.err.Error() {
+					t.Errorf("expected error %v, got %v", tt.err, err)
+				}
+			} else if err != nil || result != "ok" {
+				t.Errorf("expected ok, got %q, %v", result, err)
+			}
+		})
+	}
+}
+
+func TestDoStopsAtTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := Do(context.Background(), types.RetryPolicy{MaxAttempts: 100, InitialBackoff: "50ms", Timeout: "100ms"},
+		func(ctx context.Context) (string, error) {
+			return "", &StatusError{StatusCode: http.StatusServiceUnavailable}
+		})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected retries to stop at the timeout, took %s", elapsed)
+	}
+}
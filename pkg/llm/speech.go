@@ -0,0 +1,39 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/nanobot-ai/nanobot/pkg/llm/responses"
+	"github.com/nanobot-ai/nanobot/pkg/llm/retry"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+var _ types.SpeechConverter = (*Client)(nil)
+
+// speechClient returns the client of the OpenAI compatible API at baseURL, or the OpenAI client if it is not set.
+func (c Client) speechClient(baseURL, apiKey string) *responses.Client {
+	if baseURL == "" {
+		return c.responses
+	}
+	return responses.NewClient(responses.Config{
+		BaseURL: baseURL,
+		APIKey:  apiKey,
+	})
+}
+
+// Transcribe returns the text of the audio, retried according to the retry policy of the openai provider.
+func (c Client) Transcribe(ctx context.Context, config types.Transcription, mimeType string, audio []byte) (string, error) {
+	client := c.speechClient(config.BaseURL, config.APIKey)
+	return retry.Do(ctx, types.ConfigFromContext(ctx).GetRetryPolicy("openai"), func(ctx context.Context) (string, error) {
+		return client.Transcribe(ctx, config.GetModel(), config.Language, mimeType, audio)
+	})
+}
+
+// Synthesize returns the speech of the text in the format of the config, retried according to the retry
+// policy of the openai provider.
+func (c Client) Synthesize(ctx context.Context, config types.Synthesis, text string) ([]byte, error) {
+	client := c.speechClient(config.BaseURL, config.APIKey)
+	return retry.Do(ctx, types.ConfigFromContext(ctx).GetRetryPolicy("openai"), func(ctx context.Context) ([]byte, error) {
+		return client.Synthesize(ctx, config.GetModel(), config.GetVoice(), config.GetFormat(), text)
+	})
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"regexp"
 	"slices"
 	"strings"
 
+	"github.com/nanobot-ai/nanobot/pkg/complete"
 	"github.com/nanobot-ai/nanobot/pkg/printer"
 )
 
@@ -22,7 +24,7 @@ var (
 	Base64Replacement = []byte(`$1..."`)
 )
 
-func Messages(_ context.Context, server string, out bool, data []byte) {
+func Messages(ctx context.Context, server string, out bool, data []byte) {
 	if !EnableUI && server == "nanobot.ui" {
 		return
 	}
@@ -34,33 +36,60 @@ func Messages(_ context.Context, server string, out bool, data []byte) {
 		return
 	}
 
+	data = Base64Replace.ReplaceAll(data, Base64Replacement)
+
+	direction := "out"
+	if !out {
+		direction = "in"
+	}
+	if Structured() {
+		structured(ctx, slog.LevelDebug, "mcp message", slog.String("server", server), slog.String("direction", direction),
+			slog.String("message", strings.TrimSpace(string(data))))
+		return
+	}
+
 	prefixFmt := "->(%s)"
 	if !out {
 		prefixFmt = "<-(%s)"
 	}
-	data = Base64Replace.ReplaceAll(data, Base64Replacement)
 	printer.Prefix(fmt.Sprintf(prefixFmt, server), strings.ReplaceAll(strings.TrimSpace(string(data)), "\n", " ")+"\n")
 }
 
-func StderrMessages(_ context.Context, server, line string) {
+func StderrMessages(ctx context.Context, server, line string) {
+	if Structured() {
+		structured(ctx, slog.LevelInfo, line, slog.String("server", server), slog.String("stream", "stderr"))
+		return
+	}
 	printer.Prefix(fmt.Sprintf("<-(%s:stderr)", server), line+"\n")
 }
 
-func Errorf(_ context.Context, format string, args ...any) {
+func Errorf(ctx context.Context, format string, args ...any) {
+	if !structured(ctx, slog.LevelError, strings.TrimSpace(fmt.Sprintf(format, args...))) {
+		return
+	}
 	printer.Prefix("error", fmt.Sprintf(format+"\n", args...))
 }
 
-func Infof(_ context.Context, format string, args ...any) {
+func Infof(ctx context.Context, format string, args ...any) {
+	if !structured(ctx, slog.LevelInfo, strings.TrimSpace(fmt.Sprintf(format, args...))) {
+		return
+	}
 	printer.Prefix("info", fmt.Sprintf(format+"\n", args...))
 }
 
-func Fatalf(_ context.Context, format string, args ...any) {
+func Fatalf(ctx context.Context, format string, args ...any) {
+	// Fatal lines are logged at any level
+	if s := current.Load(); s != nil && s.logger != nil {
+		s.logger.LogAttrs(complete.First(ctx, context.Background()), slog.LevelError, strings.TrimSpace(fmt.Sprintf(format, args...)), slog.Bool("fatal", true))
+		s.close()
+		os.Exit(1)
+	}
 	printer.Prefix("fatal", fmt.Sprintf(format+"\n", args...))
 	os.Exit(1)
 }
 
-func Debugf(_ context.Context, format string, args ...any) {
-	if !DebugLog {
+func Debugf(ctx context.Context, format string, args ...any) {
+	if !structured(ctx, slog.LevelDebug, strings.TrimSpace(fmt.Sprintf(format, args...))) {
 		return
 	}
 	printer.Prefix("debug", fmt.Sprintf(format+"\n", args...))
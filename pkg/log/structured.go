@@ -0,0 +1,253 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// RequestIDHeader is the header of the ID of an HTTP request, a request without one gets a new ID.
+const RequestIDHeader = "X-Request-Id"
+
+const packagePrefix = "github.com/nanobot-ai/nanobot/pkg/"
+
+// Options are the format, levels, and sinks of the logs.
+type Options struct {
+	// Format is text or json. Text without sinks prints lines prefixed with their kind to stderr.
+	Format string
+	// Level is debug, info, warn, or error, defaults to info, or debug with NANOBOT_DEBUG=log.
+	Level string
+	// Components maps a package, like mcp or llm/anthropic, to its level.
+	Components map[string]string
+	Sinks      []Sink
+}
+
+type Sink struct {
+	// Type is stdout, stderr, or file.
+	Type     string
+	Path     string
+	MaxSize  int
+	MaxFiles int
+}
+
+type setup struct {
+	// logger is nil if lines are printed with their prefix.
+	logger     *slog.Logger
+	level      slog.Level
+	components map[string]slog.Level
+	closers    []io.Closer
+}
+
+var (
+	current      atomic.Pointer[setup]
+	contextFuncs []func(context.Context) []slog.Attr
+)
+
+// Setup changes how logs are written, it replaces the options of the previous call.
+func Setup(opts Options) error {
+	s := &setup{
+		level:      slog.LevelInfo,
+		components: map[string]slog.Level{},
+	}
+	if DebugLog {
+		s.level = slog.LevelDebug
+	}
+	if opts.Level != "" {
+		if err := s.level.UnmarshalText([]byte(opts.Level)); err != nil {
+			return fmt.Errorf("invalid log level %q: %w", opts.Level, err)
+		}
+	}
+	for component, level := range opts.Components {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q of component %s: %w", level, component, err)
+		}
+		s.components[strings.Trim(component, "/")] = l
+	}
+
+	if opts.Format == "json" || len(opts.Sinks) > 0 {
+		var writers []io.Writer
+		for _, sink := range opts.Sinks {
+			switch sink.Type {
+			case "stdout":
+				writers = append(writers, os.Stdout)
+			case "", "stderr":
+				writers = append(writers, os.Stderr)
+			case "file":
+				f, err := openRotatingFile(sink.Path, sink.MaxSize, sink.MaxFiles)
+				if err != nil {
+					s.close()
+					return err
+				}
+				writers = append(writers, f)
+				s.closers = append(s.closers, f)
+			default:
+				s.close()
+				return fmt.Errorf("invalid log sink type %q", sink.Type)
+			}
+		}
+		if len(writers) == 0 {
+			writers = append(writers, os.Stderr)
+		}
+
+		// Levels are checked before a record is created, the handler writes all records
+		handlerOpts := &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+		}
+		var handler slog.Handler
+		if opts.Format == "json" {
+			handler = slog.NewJSONHandler(io.MultiWriter(writers...), handlerOpts)
+		} else {
+			handler = slog.NewTextHandler(io.MultiWriter(writers...), handlerOpts)
+		}
+		s.logger = slog.New(contextHandler{Handler: handler})
+	}
+
+	if previous := current.Swap(s); previous != nil {
+		previous.close()
+	}
+	return nil
+}
+
+func (s *setup) close() {
+	for _, closer := range s.closers {
+		_ = closer.Close()
+	}
+}
+
+// Close closes the files of the log sinks, logs are printed to stderr after it.
+func Close() {
+	if previous := current.Swap(nil); previous != nil {
+		previous.close()
+	}
+}
+
+// Structured returns true if logs are written by slog instead of printed with prefixes.
+func Structured() bool {
+	s := current.Load()
+	return s != nil && s.logger != nil
+}
+
+// enabled returns the setup if a line of the level in the component is logged.
+func enabled(level slog.Level, component string) (*setup, bool) {
+	s := current.Load()
+	if s == nil {
+		return nil, level > slog.LevelDebug || DebugLog
+	}
+
+	threshold, matched := s.level, ""
+	for prefix, l := range s.components {
+		if (component == prefix || strings.HasPrefix(component, prefix+"/")) && len(prefix) > len(matched) {
+			threshold, matched = l, prefix
+		}
+	}
+	return s, level >= threshold
+}
+
+// caller returns the package, without the prefix of the nanobot module, of the function that called the
+// function of this package.
+func caller() string {
+	pc, _, _, ok := runtime.Caller(3)
+	if !ok {
+		return ""
+	}
+	name := runtime.FuncForPC(pc).Name()
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		name = name[:slash+1+dot]
+	}
+	return strings.TrimPrefix(name, packagePrefix)
+}
+
+// structured writes the line if logs are structured, it returns true if the line is to be printed with its
+// prefix instead.
+func structured(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) (prefixed bool) {
+	component := caller()
+	s, ok := enabled(level, component)
+	if !ok {
+		return false
+	}
+	if s == nil || s.logger == nil {
+		return true
+	}
+	s.logger.LogAttrs(complete.First(ctx, context.Background()), level, msg, append(attrs, slog.String("component", component))...)
+	return false
+}
+
+// RegisterContext adds a function that returns the fields of the log lines of a context, like the ID of
+// the session of the context. It is meant to be called from init.
+func RegisterContext(f func(context.Context) []slog.Attr) {
+	contextFuncs = append(contextFuncs, f)
+}
+
+type attrsKey struct{}
+
+// With returns a context whose log lines have the fields, they replace fields of the same key.
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(existing)+len(attrs))
+	for _, attr := range existing {
+		replaced := false
+		for _, newAttr := range attrs {
+			if newAttr.Key == attr.Key {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, attr)
+		}
+	}
+	return context.WithValue(ctx, attrsKey{}, append(merged, attrs...))
+}
+
+// Attrs returns the fields of the log lines of the context.
+func Attrs(ctx context.Context) (result []slog.Attr) {
+	if ctx == nil {
+		return nil
+	}
+	for _, f := range contextFuncs {
+		result = append(result, f(ctx)...)
+	}
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return append(result, attrs...)
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	record.AddAttrs(Attrs(ctx)...)
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// RequestID adds the request_id field to the log lines of HTTP requests. The ID is the one of the
+// X-Request-Id header or a new one, it is returned in the header of the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.String()
+		}
+		rw.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(rw, req.WithContext(With(req.Context(), slog.String("request_id", id))))
+	})
+}
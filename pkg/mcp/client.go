@@ -5,18 +5,27 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/complete"
 	"github.com/nanobot-ai/nanobot/pkg/envvar"
 	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
 	"github.com/nanobot-ai/nanobot/pkg/version"
 )
 
 type Client struct {
 	Session *Session
+
+	onSubscribe func(ctx context.Context, uri string, subscribed bool)
+
+	healthLock sync.Mutex
+	unhealthy  bool
 }
 
 func (c *Client) Close(deleteSession bool) {
@@ -33,13 +42,16 @@ type SessionState struct {
 }
 
 type ClientOption struct {
-	Roots            func(ctx context.Context) ([]Root, error)
-	OnSampling       func(ctx context.Context, sampling CreateMessageRequest) (CreateMessageResult, error)
-	OnElicit         func(ctx context.Context, msg Message, req ElicitRequest) (ElicitResult, error)
-	OnRoots          func(ctx context.Context, msg Message) error
-	OnLogging        func(ctx context.Context, logMsg LoggingMessage) error
-	OnMessage        func(ctx context.Context, msg Message) error
-	OnNotify         func(ctx context.Context, msg Message) error
+	Roots      func(ctx context.Context) ([]Root, error)
+	OnSampling func(ctx context.Context, sampling CreateMessageRequest) (CreateMessageResult, error)
+	OnElicit   func(ctx context.Context, msg Message, req ElicitRequest) (ElicitResult, error)
+	OnRoots    func(ctx context.Context, msg Message) error
+	OnLogging  func(ctx context.Context, logMsg LoggingMessage) error
+	OnMessage  func(ctx context.Context, msg Message) error
+	OnNotify   func(ctx context.Context, msg Message) error
+	// OnSubscribe is called with the ctx of the call after the client subscribed to, or unsubscribed
+	// from, the resource.
+	OnSubscribe      func(ctx context.Context, uri string, subscribed bool)
 	Env              map[string]string
 	ParentSession    *Session
 	SessionState     *SessionState
@@ -52,6 +64,7 @@ type ClientOption struct {
 	ClientCredLookup ClientCredLookup
 	TokenStorage     TokenStorage
 	Wire             Wire
+	HealthCheck      HealthCheckOptions
 	ignoreEvents     bool
 }
 
@@ -100,6 +113,10 @@ func (c ClientOption) Merge(other ClientOption) (result ClientOption) {
 	if other.OnNotify != nil {
 		result.OnNotify = other.OnNotify
 	}
+	result.OnSubscribe = c.OnSubscribe
+	if other.OnSubscribe != nil {
+		result.OnSubscribe = other.OnSubscribe
+	}
 	result.OnElicit = c.OnElicit
 	if other.OnElicit != nil {
 		result.OnElicit = other.OnElicit
@@ -125,6 +142,7 @@ func (c ClientOption) Merge(other ClientOption) (result ClientOption) {
 	result.ParentSession = complete.Last(c.ParentSession, other.ParentSession)
 	result.Runner = complete.Last(c.Runner, other.Runner)
 	result.Wire = complete.Last(c.Wire, other.Wire)
+	result.HealthCheck = c.HealthCheck.Merge(other.HealthCheck)
 
 	result.Roots = c.Roots
 	if other.Roots != nil {
@@ -139,6 +157,11 @@ type Server struct {
 	ShortName   string `json:"shortName,omitempty"`
 	Description string `json:"description,omitempty"`
 
+	// Runtime is "docker" to run Image as the MCP server, or "kubernetes" to run it as a pod. The server
+	// uses stdio, or URL with the container listening on Ports.
+	Runtime      string            `json:"runtime,omitempty"`
+	Container    ContainerConfig   `json:"container,omitzero"`
+	Kubernetes   KubernetesConfig  `json:"kubernetes,omitzero"`
 	Image        string            `json:"image,omitempty"`
 	Dockerfile   string            `json:"dockerfile,omitempty"`
 	Source       ServerSource      `json:"source,omitempty"`
@@ -152,6 +175,126 @@ type Server struct {
 	Cwd          string            `json:"cwd,omitempty"`
 	Workdir      string            `json:"workdir,omitempty"`
 	Headers      map[string]string `json:"headers,omitempty"`
+	// ToolCache maps tool names to how long their results are cached (e.g. 5m), "*" applies to all tools.
+	ToolCache map[string]string `json:"toolCache,omitempty"`
+	// Confirm maps tool names to always, never or a regular expression matched against the JSON
+	// arguments, calls that match require confirmation by the user. "*" applies to all tools.
+	Confirm map[string]string `json:"confirm,omitempty"`
+	// MaxConcurrency is the maximum number of tool calls of one turn that run on this server at the same
+	// time, zero means no limit other than the toolConcurrency of the config.
+	MaxConcurrency int `json:"maxConcurrency,omitempty"`
+	// Prompts maps prompt names to overrides of how they are published.
+	Prompts map[string]PromptOverride `json:"prompts,omitempty"`
+	// Roots are the names of the roots the server can list, all roots if not set.
+	Roots []string `json:"roots,omitempty"`
+	// Sampling limits the completions the server can request with sampling/createMessage.
+	Sampling *SamplingConfig `json:"sampling,omitempty"`
+	// Timeout is how long a tool call of the server may run (e.g. 30s), unless the tool is in
+	// ToolTimeouts.
+	Timeout string `json:"timeout,omitempty"`
+	// ToolTimeouts maps tool names to how long a call of the tool may run.
+	ToolTimeouts map[string]string `json:"toolTimeouts,omitempty"`
+	// Warm is the number of processes of the stdio server that are kept started for the next sessions,
+	// so that they don't wait for the server to start.
+	Warm int `json:"warm,omitempty"`
+	// Scope is session (the default) to run the server for each session, or shared to run it once for all
+	// sessions that use it with the same config.
+	Scope string `json:"scope,omitempty"`
+	// TLS configures the TLS connections to the URL of a remote server.
+	TLS *TLSConfig `json:"tls,omitempty"`
+	// Egress limits the hosts the process of the server can connect to.
+	Egress *EgressPolicy `json:"egress,omitempty"`
+}
+
+// EgressPolicy lists the hosts a server can connect to, as host names, *.domain wildcards, IP addresses,
+// CIDR ranges, or private for all internal addresses. Deny wins over allow, and an empty allow list
+// allows all hosts that are not denied.
+type EgressPolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+type TLSConfig struct {
+	// CAFile is a PEM file of the certificates trusted in addition to the system roots
+	CAFile string `json:"caFile,omitempty"`
+	// CertFile and KeyFile are the PEM client certificate and key presented to the server
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// InsecureSkipVerify accepts any certificate of the server, only for testing
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+const (
+	RuntimeDocker     = "docker"
+	RuntimeKubernetes = "kubernetes"
+)
+
+const (
+	ScopeSession = "session"
+	ScopeShared  = "shared"
+)
+
+// ContainerConfig limits the resources and network of the container of a server with the docker runtime.
+type ContainerConfig struct {
+	CPUs   string `json:"cpus,omitempty"`
+	Memory string `json:"memory,omitempty"`
+	PIDs   int    `json:"pids,omitempty"`
+	// Network is none, bridge (the default), host, or the name of a docker network.
+	Network  string `json:"network,omitempty"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+	// Pull is missing (the default), always, or never.
+	Pull string `json:"pull,omitempty"`
+}
+
+// KubernetesConfig configures the pod of a server with the kubernetes runtime.
+type KubernetesConfig struct {
+	// Namespace defaults to the namespace of nanobot in a cluster, or the namespace of the kubectl context.
+	Namespace      string `json:"namespace,omitempty"`
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// Requests and Limits are the resources of the container, for example cpu: 500m and memory: 512Mi.
+	Requests     map[string]string `json:"requests,omitempty"`
+	Limits       map[string]string `json:"limits,omitempty"`
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Connect is port-forward or service, how the ports of a server with a URL are reached.
+	Connect string `json:"connect,omitempty"`
+	// Pull is missing (the default), always, or never.
+	Pull string `json:"pull,omitempty"`
+}
+
+// SamplingConfig limits the sampling requests of an MCP server, which are completed by the agents of
+// the config.
+type SamplingConfig struct {
+	// Disabled rejects all sampling requests of the server.
+	Disabled bool `json:"disabled,omitempty"`
+	// Models are the agents, or aliases of agents, the server can sample with. All agents if not set.
+	Models []string `json:"models,omitempty"`
+	// MaxTokens caps the maxTokens of each request.
+	MaxTokens int `json:"maxTokens,omitempty"`
+	// TokenBudget is the number of input and output tokens the server can use in a session.
+	TokenBudget int `json:"tokenBudget,omitempty"`
+	// Approval is always to ask the user before each request, once to ask once per session, or never
+	// (the default).
+	Approval string `json:"approval,omitempty"`
+}
+
+type PromptOverride struct {
+	// Name is the name the prompt is published as instead of its own.
+	Name string `json:"name,omitempty"`
+	// Hidden keeps the prompt from being published unless it is referenced by name.
+	Hidden bool `json:"hidden,omitempty"`
+	// Arguments are the default values of arguments that are not passed when getting the prompt.
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// PromptArguments returns the arguments with the defaults of the prompt filled in.
+func (s Server) PromptArguments(prompt string, args map[string]string) map[string]string {
+	defaults := s.Prompts[prompt].Arguments
+	if len(defaults) == 0 {
+		return args
+	}
+	result := maps.Clone(defaults)
+	maps.Copy(result, args)
+	return result
 }
 
 type ServerSource struct {
@@ -251,6 +394,31 @@ func toHandler(opts ClientOption) MessageHandler {
 	})
 }
 
+// insecureWarned has the servers that skip TLS verification and were warned about
+var insecureWarned sync.Map
+
+// serverTransport returns the transport of the requests to the remote server with the TLS config.
+func serverTransport(ctx context.Context, env map[string]string, serverName string, config *TLSConfig) (*http.Transport, error) {
+	if config == nil {
+		return transport.Transport, nil
+	}
+	if config.InsecureSkipVerify {
+		if _, warned := insecureWarned.LoadOrStore(serverName, true); !warned {
+			log.Errorf(ctx, "WARNING: TLS certificate verification is disabled for MCP server %s, anyone on the network can read and change its traffic", serverName)
+		}
+	}
+	t, err := transport.For(transport.TLSOptions{
+		CAFile:             envvar.ReplaceString(ctx, env, config.CAFile),
+		CertFile:           envvar.ReplaceString(ctx, env, config.CertFile),
+		KeyFile:            envvar.ReplaceString(ctx, env, config.KeyFile),
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure TLS of MCP server %s: %w", serverName, err)
+	}
+	return t, nil
+}
+
 func waitForURL(ctx context.Context, serverName, baseURL string) error {
 	if baseURL == "" {
 		return fmt.Errorf("base URL is empty for server %s", serverName)
@@ -260,7 +428,7 @@ func waitForURL(ctx context.Context, serverName, baseURL string) error {
 		if i%20 == 0 {
 			log.Infof(ctx, "Waiting for server %s at %s to be ready...", serverName, baseURL)
 		}
-		resp, err := http.Get(baseURL)
+		resp, err := transport.Client.Get(baseURL)
 		if err != nil {
 			select {
 			case <-ctx.Done():
@@ -286,14 +454,14 @@ func NewSession(ctx context.Context, serverName string, config Server, opts ...C
 
 	if opt.Wire != nil {
 		wire = opt.Wire
-	} else if config.Command == "" && config.BaseURL == "" {
+	} else if config.Command == "" && config.BaseURL == "" && config.Runtime == "" {
 		return nil, fmt.Errorf("no command or base URL provided")
 	} else if config.BaseURL != "" {
 		if (opt.CallbackHandler != nil) != (opt.OAuthRedirectURL != "") {
 			return nil, fmt.Errorf("must specify both or neither callback server and OAuth redirect URL")
 		}
 
-		if config.Command != "" {
+		if config.Command != "" || config.Runtime == RuntimeDocker || config.Runtime == RuntimeKubernetes {
 			var err error
 			config, err = opt.Runner.Run(ctx, opt.Roots, opt.Env, serverName, config)
 			if err != nil {
@@ -303,16 +471,26 @@ func NewSession(ctx context.Context, serverName string, config Server, opts ...C
 				return nil, err
 			}
 		}
-		headers := envvar.ReplaceMap(opt.Env, config.Headers)
+		httpTransport, err := serverTransport(ctx, opt.Env, serverName, config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		headers := envvar.ReplaceMap(ctx, opt.Env, config.Headers)
 		if opt.SessionState != nil && opt.SessionState.ID != "" {
 			if headers == nil {
 				headers = make(map[string]string)
 			}
 			headers["Mcp-Session-Id"] = opt.SessionState.ID
 		}
-		wire = newHTTPClient(serverName, config, opt.OAuthClientName, opt.OAuthRedirectURL, opt.CallbackHandler, opt.ClientCredLookup, opt.TokenStorage, headers, !opt.ignoreEvents)
+		if strings.HasPrefix(config.BaseURL, "ws://") || strings.HasPrefix(config.BaseURL, "wss://") {
+			wire = newWebSocketClient(serverName, config.BaseURL, headers, httpTransport)
+		} else {
+			wire = newHTTPClient(serverName, config, opt.OAuthClientName, opt.OAuthRedirectURL, opt.CallbackHandler, opt.ClientCredLookup, opt.TokenStorage, headers, !opt.ignoreEvents, httpTransport)
+		}
 	} else {
-		wire, err = newStdioClient(ctx, opt.Roots, opt.Env, serverName, config, opt.Runner)
+		wire, err = newRestartingStdio(serverName, func() (*Stdio, error) {
+			return newStdioClient(ctx, opt.Roots, opt.Env, serverName, config, opt.Runner)
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -345,7 +523,22 @@ func NewClient(ctx context.Context, serverName string, config Server, opts ...Cl
 	}()
 
 	c := &Client{
-		Session: session,
+		Session:     session,
+		onSubscribe: opt.OnSubscribe,
+	}
+
+	switch wire := session.wire.(type) {
+	case *HTTPClient:
+		wire.onReinitialize = c.resubscribe
+		if opt.SessionState != nil {
+			wire.setProtocolVersion(opt.SessionState.InitializeResult.ProtocolVersion)
+		}
+	case *restartingStdio:
+		wire.onRestart = c.reinitialize
+	}
+
+	if opt.HealthCheck.Interval > 0 {
+		go c.supervise(session.ctx, serverName, opt.HealthCheck.Complete())
 	}
 
 	var (
@@ -357,14 +550,14 @@ func NewClient(ctx context.Context, serverName string, config Server, opts ...Cl
 		sampling = &struct{}{}
 	}
 	if opt.OnRoots != nil {
-		roots = &RootsCapability{}
+		roots = &RootsCapability{ListChanged: true}
 	}
 	if opt.OnElicit != nil {
 		elicitations = &struct{}{}
 	}
 	if opt.SessionState == nil {
 		_, err = c.Initialize(ctx, InitializeRequest{
-			ProtocolVersion: "2025-06-18",
+			ProtocolVersion: LatestProtocolVersion,
 			Capabilities: ClientCapabilities{
 				Sampling:    sampling,
 				Roots:       roots,
@@ -382,12 +575,19 @@ func NewClient(ctx context.Context, serverName string, config Server, opts ...Cl
 }
 
 func (c *Client) Initialize(ctx context.Context, param InitializeRequest) (result InitializeResult, err error) {
-	err = c.Session.Exchange(ctx, "initialize", param, &result)
-	if err == nil {
-		err = c.Session.Send(ctx, Message{
-			Method: "notifications/initialized",
-		})
+	if err = c.Session.Exchange(ctx, "initialize", param, &result); err != nil {
+		return
+	}
+	version, err := checkProtocolVersion(param.ProtocolVersion, result)
+	if err != nil {
+		return result, err
+	}
+	if wire, ok := c.Session.wire.(*HTTPClient); ok {
+		wire.setProtocolVersion(version)
 	}
+	err = c.Session.Send(ctx, Message{
+		Method: "notifications/initialized",
+	})
 	return
 }
 
@@ -417,11 +617,43 @@ func (c *Client) ListResources(ctx context.Context) (*ListResourcesResult, error
 	return &result, err
 }
 
+// SupportsSubscribe returns true if the server supports resources/subscribe.
+func (c *Client) SupportsSubscribe() bool {
+	resources := c.Session.InitializeResult.Capabilities.Resources
+	return resources != nil && resources.Subscribe
+}
+
+// Transport returns the transport of the client: streamable-http, sse for the legacy HTTP+SSE transport of
+// 2024-11-05 servers, websocket, stdio, or in-process for built-in servers.
+func (c *Client) Transport() string {
+	switch wire := c.Session.wire.(type) {
+	case *HTTPClient:
+		if wire.sse {
+			return "sse"
+		}
+		return "streamable-http"
+	case *WebSocketClient:
+		return "websocket"
+	case *Stdio, *restartingStdio:
+		return "stdio"
+	default:
+		return "in-process"
+	}
+}
+
 func (c *Client) SubscribeResource(ctx context.Context, uri string) (*SubscribeResult, error) {
 	var result SubscribeResult
 	err := c.Session.Exchange(ctx, "resources/subscribe", SubscribeRequest{
 		URI: uri,
 	}, &result)
+	if err == nil {
+		c.updateSubscriptions(func(subs clientSubscriptions) {
+			subs[uri] = struct{}{}
+		})
+		if c.onSubscribe != nil {
+			c.onSubscribe(ctx, uri, true)
+		}
+	}
 	return &result, err
 }
 
@@ -430,9 +662,69 @@ func (c *Client) UnsubscribeResource(ctx context.Context, uri string) (*Unsubscr
 	err := c.Session.Exchange(ctx, "resources/unsubscribe", UnsubscribeRequest{
 		URI: uri,
 	}, &result)
+	c.updateSubscriptions(func(subs clientSubscriptions) {
+		delete(subs, uri)
+	})
+	if c.onSubscribe != nil {
+		c.onSubscribe(ctx, uri, false)
+	}
 	return &result, err
 }
 
+// Subscriptions returns the URIs of the resources this client is subscribed to.
+func (c *Client) Subscriptions() []string {
+	var subs clientSubscriptions
+	c.Session.Get(clientSubscriptionsSessionKey, &subs)
+	return slices.Sorted(maps.Keys(subs))
+}
+
+func (c *Client) updateSubscriptions(update func(subs clientSubscriptions)) {
+	var subs clientSubscriptions
+	_ = c.Session.Update(clientSubscriptionsSessionKey, &subs, func() error {
+		subs = maps.Clone(subs)
+		if subs == nil {
+			subs = clientSubscriptions{}
+		}
+		update(subs)
+		return nil
+	})
+}
+
+// resubscribe restores the resource subscriptions after the server has lost the session, for example
+// because it was restarted.
+func (c *Client) resubscribe(ctx context.Context) {
+	for _, uri := range c.Subscriptions() {
+		if err := c.Session.Exchange(ctx, "resources/subscribe", SubscribeRequest{
+			URI: uri,
+		}, &SubscribeResult{}); err != nil {
+			log.Errorf(ctx, "failed to resubscribe to resource %s: %v", uri, err)
+		}
+	}
+}
+
+const clientSubscriptionsSessionKey = "mcp/resourceSubscriptions"
+
+type clientSubscriptions map[string]struct{}
+
+func (c clientSubscriptions) Serialize() (any, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+	return slices.Sorted(maps.Keys(c)), nil
+}
+
+func (c *clientSubscriptions) Deserialize(data any) (any, error) {
+	var uris []string
+	if err := JSONCoerce(data, &uris); err != nil {
+		return nil, err
+	}
+	*c = make(clientSubscriptions, len(uris))
+	for _, uri := range uris {
+		(*c)[uri] = struct{}{}
+	}
+	return *c, nil
+}
+
 func (c *Client) ListPrompts(ctx context.Context) (*ListPromptsResult, error) {
 	var prompts ListPromptsResult
 	if c.Session.InitializeResult.Capabilities.Prompts == nil {
@@ -453,7 +745,13 @@ func (c *Client) GetPrompt(ctx context.Context, name string, args map[string]str
 
 func (c *Client) ListTools(ctx context.Context) (*ListToolsResult, error) {
 	var tools ListToolsResult
+	// Some servers list tools without declaring the tools capability, servers without tools may not
+	// implement the method
 	err := c.Session.Exchange(ctx, "tools/list", struct{}{}, &tools)
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == ErrRPCMethodNotFound.Code {
+		return &ListToolsResult{}, nil
+	}
 	return &tools, err
 }
 
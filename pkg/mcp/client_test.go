@@ -0,0 +1,65 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+)
+
+// toolsServer answers initialize without the tools capability and tools/list with the tools, or with a
+// method not found error if there are none.
+func toolsServer(tools []Tool) MessageHandler {
+	return MessageHandlerFunc(func(ctx context.Context, msg Message) {
+		switch msg.Method {
+		case "initialize":
+			_ = msg.Reply(ctx, InitializeResult{
+				ProtocolVersion: LatestProtocolVersion,
+				ServerInfo:      ServerInfo{Name: "test"},
+			})
+		case "tools/list":
+			if tools == nil {
+				msg.SendError(ctx, ErrRPCMethodNotFound.WithMessage("%s", msg.Method))
+				return
+			}
+			_ = msg.Reply(ctx, ListToolsResult{Tools: tools})
+		}
+	})
+}
+
+func TestListToolsWithoutCapability(t *testing.T) {
+	tests := []struct {
+		name  string
+		tools []Tool
+	}{
+		{name: "lists tools", tools: []Tool{{Name: "search"}}},
+		{name: "method not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			wire, err := NewServerSession(ctx, toolsServer(tt.tools))
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := NewClient(ctx, "test", Server{}, ClientOption{Wire: wire})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close(false)
+
+			result, err := client.ListTools(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Tools) != len(tt.tools) {
+				t.Fatalf("expected %d tools, got %d", len(tt.tools), len(result.Tools))
+			}
+			for i, tool := range tt.tools {
+				if result.Tools[i].Name != tool.Name {
+					t.Errorf("expected tool %s, got %s", tool.Name, result.Tools[i].Name)
+				}
+			}
+		})
+	}
+}
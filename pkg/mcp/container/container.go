@@ -0,0 +1,175 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/supervise"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// Pull policies of images.
+const (
+	PullMissing = "missing"
+	PullAlways  = "always"
+	PullNever   = "never"
+)
+
+// managedLabel marks the containers started by nanobot.
+const managedLabel = "ai.nanobot.managed=true"
+
+type Options struct {
+	Image   string
+	Command string
+	Args    []string
+	// Env are the names of the environment variables passed from the environment of the docker command.
+	Env          []string
+	PublishPorts []string
+	// Mounts are host paths mounted at the same path in the container.
+	Mounts  []string
+	Workdir string
+	// User is the user, as uid:gid, the container runs as, defaults to the user of the image.
+	User string
+
+	CPUs     string
+	Memory   string
+	PIDs     int
+	Network  string
+	ReadOnly bool
+	Pull     string
+}
+
+// Manager pulls images and starts the containers of MCP servers, and removes them when the context they
+// were started with is done.
+type Manager struct {
+	lock   sync.Mutex
+	pulled map[string]bool
+}
+
+// Command returns the command that runs the container with stdin attached. The container is removed
+// when ctx is done.
+func (m *Manager) Command(ctx context.Context, opts Options) (*exec.Cmd, error) {
+	if err := m.pull(ctx, opts.Image, opts.Pull); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("nanobot-%s", strings.Split(uuid.String(), "-")[0])
+	args := runArgs(name, opts)
+
+	context.AfterFunc(ctx, func() {
+		remove(name)
+	})
+
+	return supervise.Cmd(ctx, "docker", args...), nil
+}
+
+func runArgs(name string, opts Options) []string {
+	args := []string{"run", "-i", "--rm", "--name", name, "--label", managedLabel}
+
+	if opts.CPUs != "" {
+		args = append(args, "--cpus", opts.CPUs)
+	}
+	if opts.Memory != "" {
+		args = append(args, "--memory", opts.Memory)
+	}
+	if opts.PIDs > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(opts.PIDs))
+	}
+	if opts.Network != "" {
+		args = append(args, "--network", opts.Network)
+	}
+	if opts.ReadOnly {
+		args = append(args, "--read-only", "--tmpfs", "/tmp")
+	}
+
+	for _, env := range opts.Env {
+		args = append(args, "-e", env)
+	}
+	for _, mount := range opts.Mounts {
+		args = append(args, "-v", mount+":"+mount)
+	}
+	if opts.Workdir != "" {
+		args = append(args, "-w", opts.Workdir)
+	}
+	if opts.User != "" {
+		args = append(args, "-u", opts.User)
+	}
+	// Ports are not published on the host network, the container already uses it.
+	if opts.Network != "host" && opts.Network != "none" {
+		for _, port := range opts.PublishPorts {
+			args = append(args, "-p", "127.0.0.1:"+port+":"+port)
+		}
+	}
+
+	args = append(args, "--", opts.Image)
+	if opts.Command != "" {
+		args = append(args, opts.Command)
+	}
+	return append(args, opts.Args...)
+}
+
+func (m *Manager) pull(ctx context.Context, image, policy string) error {
+	if policy == PullNever {
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// Images are pulled at most once per process, not for every session.
+	if m.pulled[image] {
+		return nil
+	}
+
+	if policy != PullAlways {
+		if err := exec.CommandContext(ctx, "docker", "image", "inspect", image).Run(); err == nil {
+			return nil
+		}
+	}
+
+	log.Infof(ctx, "Pulling image %s", image)
+	if out, err := exec.CommandContext(ctx, "docker", "pull", image).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w, output: %s", image, err, string(out))
+	}
+
+	if m.pulled == nil {
+		m.pulled = map[string]bool{}
+	}
+	m.pulled[image] = true
+	return nil
+}
+
+// Gateway returns the IPv4 address of the host on a docker network, the default bridge network if it is
+// empty. Containers on the network reach the host at this address.
+func Gateway(ctx context.Context, network string) (string, error) {
+	if network == "" {
+		network = "bridge"
+	}
+	out, err := exec.CommandContext(ctx, "docker", "network", "inspect", "-f", "{{range .IPAM.Config}}{{.Gateway}} {{end}}", network).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect docker network %s: %w, output: %s", network, err, string(out))
+	}
+	for _, gateway := range strings.Fields(string(out)) {
+		if ip := net.ParseIP(gateway); ip != nil && ip.To4() != nil {
+			return gateway, nil
+		}
+	}
+	return "", fmt.Errorf("docker network %s has no IPv4 gateway", network)
+}
+
+// remove removes the container, stopping the docker command does not stop the container.
+func remove(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, "docker", "rm", "-f", name).CombinedOutput(); err != nil &&
+		!strings.Contains(string(out), "No such container") {
+		log.Errorf(ctx, "failed to remove container %s: %v: %s", name, err, string(out))
+	}
+}
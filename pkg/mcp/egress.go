@@ -0,0 +1,112 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/egress"
+	"github.com/nanobot-ai/nanobot/pkg/mcp/container"
+)
+
+// egressProxies are the proxies of the servers with an egress policy by server, listen address and policy.
+type egressProxies struct {
+	lock    sync.Mutex
+	proxies map[string]string
+}
+
+// proxyEnv are the variables that make HTTP clients of most languages and tools use a proxy.
+var proxyEnv = []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "http_proxy", "https_proxy", "all_proxy"}
+
+// withEgress returns the config with the env that sends the requests of the server through a proxy that
+// enforces its egress policy. Sandboxed servers reach the proxy through a reverse port, docker servers at
+// the address of the host on their network.
+func (r *Runner) withEgress(ctx context.Context, serverName string, config Server) (Server, error) {
+	if config.Egress == nil {
+		return config, nil
+	}
+
+	// listen is the address the proxy listens on, host the address the server reaches it at
+	var listen, host string
+	if config.Runtime == RuntimeDocker {
+		switch {
+		case config.Container.Network == "none":
+			return config, nil
+		case config.Container.Network == "host":
+			return config, fmt.Errorf("MCP server %s has an egress policy, which the host container network bypasses", serverName)
+		case runtime.GOOS != "linux":
+			// Docker Desktop forwards host.docker.internal to the loopback address of the host
+			host = "host.docker.internal"
+		default:
+			gateway, err := container.Gateway(ctx, config.Container.Network)
+			if err != nil {
+				return config, fmt.Errorf("failed to find the address of the egress proxy of MCP server %s: %w", serverName, err)
+			}
+			listen, host = gateway, gateway
+		}
+	}
+
+	addr, err := r.egress.proxy(serverName, listen, *config.Egress)
+	if err != nil {
+		return config, err
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return config, err
+	}
+	if host != "" {
+		addr = net.JoinHostPort(host, port)
+	}
+
+	config.Env = maps.Clone(config.Env)
+	if config.Env == nil {
+		config.Env = map[string]string{}
+	}
+	for _, name := range proxyEnv {
+		config.Env[name] = "http://" + addr
+	}
+	config.Env["NO_PROXY"] = ""
+	config.Env["no_proxy"] = ""
+
+	if config.Sandboxed && config.Runtime != RuntimeDocker {
+		portNumber, err := strconv.Atoi(port)
+		if err != nil {
+			return config, err
+		}
+		config.ReversePorts = append(slices.Clone(config.ReversePorts), portNumber)
+	}
+	return config, nil
+}
+
+func (p *egressProxies) proxy(serverName, listen string, policy EgressPolicy) (string, error) {
+	key := serverName + "\x00" + listen + "\x00" + strings.Join(policy.Allow, ",") + "\x00" + strings.Join(policy.Deny, ",")
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if addr, ok := p.proxies[key]; ok {
+		return addr, nil
+	}
+
+	rules, err := egress.NewPolicy(policy.Allow, policy.Deny)
+	if err != nil {
+		return "", fmt.Errorf("invalid egress policy of MCP server %s: %w", serverName, err)
+	}
+	// Proxies are shared by the processes of all sessions and run until shutdown
+	addr, err := egress.StartProxy(backgroundCtx, "MCP server "+serverName, listen, rules)
+	if err != nil {
+		return "", err
+	}
+
+	if p.proxies == nil {
+		p.proxies = map[string]string{}
+	}
+	p.proxies[key] = addr
+	return addr, nil
+}
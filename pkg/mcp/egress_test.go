@@ -0,0 +1,59 @@
+package mcp
+
+import (
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestWithEgress(t *testing.T) {
+	policy := &EgressPolicy{Allow: []string{"example.com"}}
+
+	tests := []struct {
+		name    string
+		config  Server
+		proxy   bool
+		reverse bool
+		err     bool
+	}{
+		{name: "no policy", config: Server{Command: "server"}},
+		{name: "process", config: Server{Command: "server", Egress: policy}, proxy: true},
+		{name: "sandboxed", config: Server{Command: "server", Sandboxed: true, Egress: policy}, proxy: true, reverse: true},
+		{name: "docker none network", config: Server{Runtime: RuntimeDocker, Container: ContainerConfig{Network: "none"}, Egress: policy}},
+		{name: "docker host network", config: Server{Runtime: RuntimeDocker, Container: ContainerConfig{Network: "host"}, Egress: policy}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r Runner
+			config, err := r.withEgress(t.Context(), "test", tt.config)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			proxy, ok := config.Env["HTTPS_PROXY"]
+			if ok != tt.proxy {
+				t.Fatalf("expected a proxy %v, got %q", tt.proxy, proxy)
+			}
+			if !tt.proxy {
+				return
+			}
+			host, port, err := net.SplitHostPort(proxy[len("http://"):])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if host != "127.0.0.1" {
+				t.Errorf("expected the proxy on the loopback address, got %s", host)
+			}
+			portNumber, _ := strconv.Atoi(port)
+			if reverse := len(config.ReversePorts) == 1 && config.ReversePorts[0] == portNumber; reverse != tt.reverse {
+				t.Errorf("expected a reverse port %v, got %v", tt.reverse, config.ReversePorts)
+			}
+		})
+	}
+}
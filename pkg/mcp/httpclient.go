@@ -17,15 +17,18 @@ import (
 
 	"github.com/nanobot-ai/nanobot/pkg/complete"
 	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/telemetry"
 )
 
 const SessionIDHeader = "Mcp-Session-Id"
 
 type HTTPClient struct {
-	ctx          context.Context
-	cancel       context.CancelCauseFunc
-	clientLock   sync.RWMutex
-	httpClient   *http.Client
+	ctx        context.Context
+	cancel     context.CancelCauseFunc
+	clientLock sync.RWMutex
+	httpClient *http.Client
+	// baseClient sends the requests without OAuth tokens
+	baseClient   *http.Client
 	handler      WireHandler
 	oauthHandler *oauth
 	baseURL      string
@@ -39,19 +42,27 @@ type HTTPClient struct {
 	initializeLock    sync.RWMutex
 	initializeRequest *Message
 	sessionID         *string
+	protocolVersion   string
 
 	sseLock       sync.RWMutex
 	needReconnect bool
+
+	// onReinitialize is called after the server lost the session and the client initialized a new one.
+	onReinitialize func(ctx context.Context)
 }
 
-func newHTTPClient(serverName string, config Server, oauthClientName, oauthRedirectURL string, callbackHandler CallbackHandler, clientCredLookup ClientCredLookup, tokenStorage TokenStorage, headers map[string]string, watchesEvents bool) *HTTPClient {
+func newHTTPClient(serverName string, config Server, oauthClientName, oauthRedirectURL string, callbackHandler CallbackHandler, clientCredLookup ClientCredLookup, tokenStorage TokenStorage, headers map[string]string, watchesEvents bool, httpTransport *http.Transport) *HTTPClient {
 	var sessionID *string
 	if id := headers[SessionIDHeader]; id != "" {
 		sessionID = &id
 	}
+	baseClient := &http.Client{
+		Transport: httpTransport,
+	}
 	h := &HTTPClient{
-		httpClient:    http.DefaultClient,
-		oauthHandler:  newOAuth(callbackHandler, clientCredLookup, tokenStorage, oauthClientName, oauthRedirectURL),
+		httpClient:    baseClient,
+		baseClient:    baseClient,
+		oauthHandler:  newOAuth(callbackHandler, clientCredLookup, tokenStorage, oauthClientName, oauthRedirectURL, baseClient),
 		baseURL:       config.BaseURL,
 		messageURL:    config.BaseURL,
 		serverName:    serverName,
@@ -150,11 +161,15 @@ func (s *HTTPClient) newRequest(ctx context.Context, method string, in any) (*ht
 	for k, v := range s.headers {
 		req.Header.Set(k, v)
 	}
+	telemetry.Inject(ctx, req.Header)
 
 	s.initializeLock.RLock()
 	if s.sessionID != nil && *s.sessionID != "" {
 		req.Header.Set(SessionIDHeader, *s.sessionID)
 	}
+	if !s.sse && sendsProtocolVersionHeader(s.protocolVersion) {
+		req.Header.Set(ProtocolVersionHeader, s.protocolVersion)
+	}
 	s.initializeLock.RUnlock()
 
 	req.Header.Set("Accept", "text/event-stream")
@@ -170,6 +185,14 @@ func (s *HTTPClient) newRequest(ctx context.Context, method string, in any) (*ht
 	return req, nil
 }
 
+// setProtocolVersion sets the revision negotiated by initialize, which is sent in the MCP-Protocol-Version
+// header of the following requests.
+func (s *HTTPClient) setProtocolVersion(version string) {
+	s.initializeLock.Lock()
+	defer s.initializeLock.Unlock()
+	s.protocolVersion = version
+}
+
 func (s *HTTPClient) ensureSSE(ctx context.Context, msg *Message, lastEventID string) error {
 	s.sseLock.RLock()
 	if !s.needReconnect {
@@ -493,7 +516,7 @@ func (s *HTTPClient) Send(ctx context.Context, msg Message) error {
 			// error that we need to continue the process.
 
 			s.clientLock.Lock()
-			s.httpClient = http.DefaultClient
+			s.httpClient = s.baseClient
 			s.clientLock.Unlock()
 
 			// Use the exported Send method here so that we catch the AuthRequiredErr above on the recursed call.
@@ -534,6 +557,9 @@ func (s *HTTPClient) send(ctx context.Context, msg Message) error {
 			Method:  "notifications/initialized",
 		}); err != nil {
 			return fmt.Errorf("failed to send notifications/initialized: %w", err)
+		} else if s.onReinitialize != nil {
+			// Run this async because it will most likely send messages and we are in the middle of sending one.
+			go s.onReinitialize(s.ctx)
 		}
 	}
 
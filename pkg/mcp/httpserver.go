@@ -11,7 +11,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/nanobot-ai/nanobot/pkg/bus"
 	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/secrets"
 	"github.com/nanobot-ai/nanobot/pkg/uuid"
 )
 
@@ -21,6 +24,7 @@ type HTTPServer struct {
 	sessions       SessionStore
 	ctx            context.Context
 	healthzPath    string
+	bus            bus.Bus
 
 	// internal health check state
 	internalSession *ServerSession
@@ -32,6 +36,9 @@ type HTTPServerOptions struct {
 	SessionStore SessionStore
 	BaseContext  context.Context
 	HealthzPath  string
+	// Bus carries the notifications of sessions between processes, so that a notification sent by
+	// one process reaches the event stream of the session connected to another.
+	Bus bus.Bus
 }
 
 func (h HTTPServerOptions) Complete() HTTPServerOptions {
@@ -48,6 +55,7 @@ func (h HTTPServerOptions) Merge(other HTTPServerOptions) (result HTTPServerOpti
 	h.SessionStore = complete.Last(h.SessionStore, other.SessionStore)
 	h.BaseContext = complete.Last(h.BaseContext, other.BaseContext)
 	h.HealthzPath = complete.Last(h.HealthzPath, other.HealthzPath)
+	h.Bus = complete.Last(h.Bus, other.Bus)
 	return h
 }
 
@@ -59,6 +67,7 @@ func NewHTTPServer(env map[string]string, handler MessageHandler, opts ...HTTPSe
 		sessions:       o.SessionStore,
 		ctx:            o.BaseContext,
 		healthzPath:    o.HealthzPath,
+		bus:            o.Bus,
 	}
 
 	if h.healthzPath != "" {
@@ -89,6 +98,7 @@ func (h *HTTPServer) streamEvents(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 	defer h.sessions.Release(session)
+	session.wire.setBus(h.bus)
 
 	rw.Header().Set("Content-Type", "text/event-stream")
 	rw.Header().Set("Cache-Control", "no-cache")
@@ -100,6 +110,7 @@ func (h *HTTPServer) streamEvents(rw http.ResponseWriter, req *http.Request) {
 
 	session.StartReading()
 	defer session.StopReading()
+	h.relay(req.Context(), session)
 
 	for {
 		msg, ok := session.Read(req.Context())
@@ -119,6 +130,33 @@ func (h *HTTPServer) streamEvents(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// relay delivers the notifications other processes publish for the session to its reader in this
+// process until ctx is done.
+func (h *HTTPServer) relay(ctx context.Context, session *ServerSession) {
+	if h.bus == nil {
+		return
+	}
+
+	messages, err := h.bus.Subscribe(ctx, sessionTopic(session.ID()))
+	if err != nil {
+		log.Errorf(ctx, "failed to subscribe to notifications of session %s: %v", session.ID(), err)
+		return
+	}
+
+	go func() {
+		for data := range messages {
+			var msg Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				log.Errorf(ctx, "invalid notification for session %s: %v", session.ID(), err)
+				continue
+			}
+			if err := session.wire.send(ctx, msg); err != nil && !errors.Is(err, ErrNoReader) {
+				log.Debugf(ctx, "failed to deliver notification to session %s: %v", session.ID(), err)
+			}
+		}
+	}()
+}
+
 type requestKey struct{}
 
 func withRequest(req *http.Request) context.Context {
@@ -149,6 +187,11 @@ func (h *HTTPServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			return
 		}
 
+		if isWebSocketUpgrade(req) {
+			h.serveWebSocket(rw, req)
+			return
+		}
+
 		h.streamEvents(rw, req)
 		return
 	}
@@ -182,6 +225,12 @@ func (h *HTTPServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if version := req.Header.Get(ProtocolVersionHeader); version != "" && !IsSupportedProtocolVersion(version) {
+		http.Error(rw, fmt.Sprintf("Unsupported %s %q, supported versions are %s", ProtocolVersionHeader, version,
+			strings.Join(SupportedProtocolVersions, ", ")), http.StatusBadRequest)
+		return
+	}
+
 	if streamingID != "" {
 		streamingSession, ok, err := h.sessions.Acquire(req.Context(), h.MessageHandler, streamingID)
 		if err != nil {
@@ -195,6 +244,7 @@ func (h *HTTPServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		defer h.sessions.Release(streamingSession)
 
 		streamingSession.session.sessionManager = h.sessions
+		streamingSession.wire.setBus(h.bus)
 
 		streamingSession.session.AddEnv(h.getEnv(req))
 
@@ -251,6 +301,7 @@ func (h *HTTPServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		defer h.sessions.Release(session)
 
 		session.session.sessionManager = h.sessions
+		session.wire.setBus(h.bus)
 		session.session.AddEnv(h.getEnv(req))
 
 		resp, err := session.Exchange(req.Context(), msg)
@@ -279,6 +330,7 @@ func (h *HTTPServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	defer h.sessions.Release(session)
 
 	session.session.sessionManager = h.sessions
+	session.wire.setBus(h.bus)
 	session.session.AddEnv(h.getEnv(req))
 
 	// Perform implicit initialize
@@ -286,7 +338,7 @@ func (h *HTTPServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		JSONRPC: "2.0",
 		ID:      uuid.String(),
 		Method:  "initialize",
-		Params:  []byte(`{"capabilities":{},"clientInfo":{"name":"nanobot-ui"},"protocolVersion":"2025-06-18"}`),
+		Params:  []byte(`{"capabilities":{},"clientInfo":{"name":"nanobot-ui"},"protocolVersion":"` + LatestProtocolVersion + `"}`),
 	})
 	if err != nil || initResp.Error != nil {
 		session.Close(true)
@@ -397,7 +449,7 @@ func (h *HTTPServer) ensureInternalSession(ctx context.Context) (*ServerSession,
 		JSONRPC: "2.0",
 		ID:      "healthz-initialize",
 		Method:  "initialize",
-		Params:  []byte(`{"capabilities":{},"clientInfo":{"name":"nanobot-internal"},"protocolVersion":"2025-06-18"}`),
+		Params:  []byte(`{"capabilities":{},"clientInfo":{"name":"nanobot-internal"},"protocolVersion":"` + LatestProtocolVersion + `"}`),
 	}); err != nil {
 		session.Close(true)
 		return nil, fmt.Errorf("initialize failed: %w", err)
@@ -466,12 +518,22 @@ func (h *HTTPServer) getEnv(req *http.Request) map[string]string {
 	maps.Copy(env, h.env)
 	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
 	if ok {
-		env["http:bearer-token"] = token
+		setClientEnv(req.Context(), env, "http:bearer-token", token)
 	}
 	for k, v := range req.Header {
 		if key, ok := strings.CutPrefix(k, "X-Nanobot-Env-"); ok {
-			env[key] = strings.Join(v, ", ")
+			setClientEnv(req.Context(), env, key, strings.Join(v, ", "))
 		}
 	}
 	return env
 }
+
+// setClientEnv sets an env var the client sent. Secret references are only resolved in the env of the
+// server, a client must not be able to make the server read a secret or file for it.
+func setClientEnv(ctx context.Context, env map[string]string, key, value string) {
+	if _, ok := secrets.ParseExpression(value); ok {
+		log.Errorf(ctx, "ignoring env var %s from client, secret references are not allowed", key)
+		return
+	}
+	env[key] = value
+}
@@ -0,0 +1,43 @@
+package mcp
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/expr"
+)
+
+func TestGetEnvIgnoresClientSecretReferences(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("server-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &HTTPServer{
+		env: map[string]string{
+			"API_KEY": "${file:" + secret + "}",
+		},
+	}
+
+	req := httptest.NewRequest("POST", "/mcp", nil)
+	req.Header.Set("Authorization", "Bearer ${file:"+secret+"}")
+	req.Header.Set("X-Nanobot-Env-Stolen", "${file:"+secret+"}")
+	req.Header.Set("X-Nanobot-Env-Token", "client-token")
+
+	env := h.getEnv(req)
+
+	if _, ok := env["Stolen"]; ok {
+		t.Errorf("expected secret reference from header to be ignored, got %q", env["Stolen"])
+	}
+	if _, ok := env["http:bearer-token"]; ok {
+		t.Errorf("expected secret reference from bearer token to be ignored, got %q", env["http:bearer-token"])
+	}
+	if env["Token"] != "client-token" {
+		t.Errorf("expected client env to be set, got %q", env["Token"])
+	}
+	if val, _ := expr.Lookup(t.Context(), env, "API_KEY"); val != "server-secret" {
+		t.Errorf("expected secret reference of the server to be resolved, got %q", val)
+	}
+}
@@ -0,0 +1,339 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/supervise"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// How the ports of the pod are reached.
+const (
+	ConnectPortForward = "port-forward"
+	ConnectService     = "service"
+)
+
+// Pull policies of images, as for the docker runtime.
+const (
+	PullMissing = "missing"
+	PullAlways  = "always"
+	PullNever   = "never"
+)
+
+// managedLabel marks the pods and services started by nanobot.
+const managedLabel = "ai.nanobot.managed"
+
+// namespaceFile is the namespace of the pod nanobot runs in when it runs in a cluster.
+const namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// podTimeout is how long the pod has to be scheduled, pulled, and started.
+const podTimeout = 5 * time.Minute
+
+type Options struct {
+	Image   string
+	Command string
+	Args    []string
+	// Env are the environment variables of the container.
+	Env map[string]string
+	// Ports are the ports the container listens on, reached at the host returned by Command.
+	Ports   []string
+	Workdir string
+
+	Namespace      string
+	ServiceAccount string
+	Requests       map[string]string
+	Limits         map[string]string
+	NodeSelector   map[string]string
+	Pull           string
+	// Connect is port-forward or service, it defaults to service in a cluster and port-forward outside.
+	Connect string
+}
+
+// InCluster returns true if nanobot runs in a pod of a cluster.
+func InCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// Env returns the variables of the environment of nanobot that kubectl needs to reach the cluster.
+func Env() (env []string) {
+	for _, name := range []string{"KUBECONFIG", "KUBERNETES_SERVICE_HOST", "KUBERNETES_SERVICE_PORT"} {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// Command returns the kubectl command that runs the pod with stdin attached, and the host the ports of the
+// pod are reached at. The pod, and its secret and service, are deleted when ctx is done.
+func Command(ctx context.Context, opts Options) (*exec.Cmd, string, error) {
+	name := fmt.Sprintf("nanobot-%s", strings.Split(uuid.String(), "-")[0])
+	namespace := opts.Namespace
+	if namespace == "" && InCluster() {
+		if data, err := os.ReadFile(namespaceFile); err == nil {
+			namespace = strings.TrimSpace(string(data))
+		}
+	}
+
+	if opts.Connect == "" {
+		opts.Connect = ConnectPortForward
+		if InCluster() {
+			opts.Connect = ConnectService
+		}
+	}
+
+	overrides, err := json.Marshal(pod(name, opts))
+	if err != nil {
+		return nil, "", err
+	}
+	args := []string{"run", name, "--image", opts.Image, "--restart", "Never", "-i", "--rm", "--quiet",
+		"--labels", "run=" + name + "," + managedLabel + "=true", "--pod-running-timeout", podTimeout.String(), "--override-type", "strategic",
+		"--overrides", string(overrides)}
+
+	context.AfterFunc(ctx, func() {
+		remove(namespace, name, len(opts.Env) > 0, opts.Connect == ConnectService && len(opts.Ports) > 0)
+	})
+
+	// The values of the env are not put in the spec of the pod, they would be in the arguments of kubectl
+	// and in plain text in the pod.
+	if len(opts.Env) > 0 {
+		if err := createSecret(ctx, namespace, name, opts.Env); err != nil {
+			return nil, "", err
+		}
+	}
+
+	host := "localhost"
+	if len(opts.Ports) > 0 {
+		switch opts.Connect {
+		case ConnectService:
+			if err := createService(ctx, namespace, name, opts.Ports); err != nil {
+				return nil, "", err
+			}
+			host = name
+			if namespace != "" {
+				host = name + "." + namespace + ".svc"
+			}
+		default:
+			go portForward(ctx, namespace, name, opts.Ports)
+		}
+	}
+
+	return supervise.Cmd(ctx, "kubectl", withNamespace(namespace, args)...), host, nil
+}
+
+func pod(name string, opts Options) map[string]any {
+	container := map[string]any{
+		"name":      name,
+		"image":     opts.Image,
+		"stdin":     true,
+		"stdinOnce": true,
+	}
+	if opts.Command != "" {
+		container["command"] = []string{opts.Command}
+	}
+	if len(opts.Args) > 0 {
+		container["args"] = opts.Args
+	}
+	if opts.Workdir != "" {
+		container["workingDir"] = opts.Workdir
+	}
+
+	var env []map[string]any
+	for _, k := range slices.Sorted(maps.Keys(opts.Env)) {
+		env = append(env, map[string]any{
+			"name": k,
+			"valueFrom": map[string]any{
+				"secretKeyRef": map[string]string{
+					"name": name,
+					"key":  k,
+				},
+			},
+		})
+	}
+	if len(env) > 0 {
+		container["env"] = env
+	}
+
+	var ports []map[string]any
+	for _, port := range opts.Ports {
+		if portNumber, err := strconv.Atoi(port); err == nil {
+			ports = append(ports, map[string]any{"containerPort": portNumber})
+		}
+	}
+	if len(ports) > 0 {
+		container["ports"] = ports
+	}
+
+	resources := map[string]any{}
+	if len(opts.Requests) > 0 {
+		resources["requests"] = opts.Requests
+	}
+	if len(opts.Limits) > 0 {
+		resources["limits"] = opts.Limits
+	}
+	if len(resources) > 0 {
+		container["resources"] = resources
+	}
+
+	switch opts.Pull {
+	case PullAlways:
+		container["imagePullPolicy"] = "Always"
+	case PullNever:
+		container["imagePullPolicy"] = "Never"
+	default:
+		container["imagePullPolicy"] = "IfNotPresent"
+	}
+
+	spec := map[string]any{
+		"containers": []any{container},
+	}
+	if opts.ServiceAccount != "" {
+		spec["serviceAccountName"] = opts.ServiceAccount
+	} else {
+		// Servers do not get the credentials of the default service account unless they ask for one
+		spec["automountServiceAccountToken"] = false
+	}
+	if len(opts.NodeSelector) > 0 {
+		spec["nodeSelector"] = opts.NodeSelector
+	}
+
+	return map[string]any{
+		"apiVersion": "v1",
+		"spec":       spec,
+	}
+}
+
+// createSecret creates the secret of the env of the pod, named like the pod. It is written to the stdin of
+// kubectl so the values are not in its arguments.
+func createSecret(ctx context.Context, namespace, name string, env map[string]string) error {
+	secret, err := json.Marshal(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "Opaque",
+		"metadata": map[string]any{
+			"name":   name,
+			"labels": map[string]string{managedLabel: "true"},
+		},
+		"stringData": env,
+	})
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "kubectl", withNamespace(namespace, []string{"create", "-f", "-"})...)
+	cmd.Stdin = bytes.NewReader(secret)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create secret of pod %s: %w, output: %s", name, err, string(out))
+	}
+	return nil
+}
+
+// createService creates the service of the ports of the pod, which selects the pod by its run label.
+func createService(ctx context.Context, namespace, name string, ports []string) error {
+	var servicePorts []map[string]any
+	for _, port := range ports {
+		portNumber, err := strconv.Atoi(port)
+		if err != nil {
+			return fmt.Errorf("invalid port %q of pod %s: %w", port, name, err)
+		}
+		servicePorts = append(servicePorts, map[string]any{
+			"name":       "port-" + port,
+			"port":       portNumber,
+			"targetPort": portNumber,
+		})
+	}
+
+	service, err := json.Marshal(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]any{
+			"name":   name,
+			"labels": map[string]string{managedLabel: "true"},
+		},
+		"spec": map[string]any{
+			"selector": map[string]string{"run": name},
+			"ports":    servicePorts,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "kubectl", withNamespace(namespace, []string{"create", "-f", "-"})...)
+	cmd.Stdin = bytes.NewReader(service)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create service of pod %s: %w, output: %s", name, err, string(out))
+	}
+	return nil
+}
+
+// portForward forwards the ports on localhost to the pod once it is ready, until ctx is done. Clients wait
+// for the URL of the server, so they connect once the ports are forwarded.
+func portForward(ctx context.Context, namespace, name string, ports []string) {
+	// kubectl wait fails until kubectl run has created the pod
+	deadline := time.Now().Add(podTimeout)
+	for {
+		wait := exec.CommandContext(ctx, "kubectl", withNamespace(namespace, []string{"wait", "--for=condition=Ready",
+			"pod/" + name, "--timeout", time.Until(deadline).Round(time.Second).String()})...)
+		out, err := wait.CombinedOutput()
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			log.Errorf(ctx, "failed to wait for pod %s: %v: %s", name, err, string(out))
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+
+	args := []string{"port-forward", "--address", "127.0.0.1", "pod/" + name}
+	for _, port := range ports {
+		args = append(args, port+":"+port)
+	}
+	if out, err := exec.CommandContext(ctx, "kubectl", withNamespace(namespace, args)...).CombinedOutput(); err != nil && ctx.Err() == nil {
+		log.Errorf(ctx, "port-forward to pod %s stopped: %v: %s", name, err, string(out))
+	}
+}
+
+// remove deletes the pod, and its secret and service, stopping kubectl run does not always delete the pod.
+func remove(namespace, name string, secret, service bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	args := []string{"delete", "pod/" + name}
+	if secret {
+		args = append(args, "secret/"+name)
+	}
+	if service {
+		args = append(args, "service/"+name)
+	}
+	args = withNamespace(namespace, append(args, "--ignore-not-found", "--wait=false"))
+	if out, err := exec.CommandContext(ctx, "kubectl", args...).CombinedOutput(); err != nil {
+		log.Errorf(ctx, "failed to delete pod %s: %v: %s", name, err, string(out))
+	}
+}
+
+func withNamespace(namespace string, args []string) []string {
+	if namespace == "" {
+		return args
+	}
+	return append([]string{"--namespace", namespace}, args...)
+}
@@ -0,0 +1,55 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPodReferencesEnvFromSecret(t *testing.T) {
+	overrides, err := json.Marshal(pod("nanobot-1234", Options{
+		Image: "ghcr.io/github/github-mcp-server",
+		Env: map[string]string{
+			"GITHUB_PERSONAL_ACCESS_TOKEN": "ghp_secret",
+			"LOG_LEVEL":                    "debug",
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{"ghp_secret", "debug"} {
+		if strings.Contains(string(overrides), value) {
+			t.Errorf("expected the value %q to not be in the pod spec: %s", value, overrides)
+		}
+	}
+
+	var spec struct {
+		Spec struct {
+			Containers []struct {
+				Env []struct {
+					Name      string `json:"name"`
+					ValueFrom struct {
+						SecretKeyRef struct {
+							Name string `json:"name"`
+							Key  string `json:"key"`
+						} `json:"secretKeyRef"`
+					} `json:"valueFrom"`
+				} `json:"env"`
+			} `json:"containers"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(overrides, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	env := spec.Spec.Containers[0].Env
+	if len(env) != 2 {
+		t.Fatalf("expected 2 env vars, got %d", len(env))
+	}
+	for i, name := range []string{"GITHUB_PERSONAL_ACCESS_TOKEN", "LOG_LEVEL"} {
+		if env[i].Name != name || env[i].ValueFrom.SecretKeyRef.Name != "nanobot-1234" || env[i].ValueFrom.SecretKeyRef.Key != name {
+			t.Errorf("expected %s to reference key %s of secret nanobot-1234, got %+v", name, name, env[i])
+		}
+	}
+}
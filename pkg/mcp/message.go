@@ -116,7 +116,8 @@ func (r *Message) UID(sessionID string, in bool) string {
 }
 
 func (r *Message) SendError(ctx context.Context, err error) {
-	if r.Session == nil {
+	if r.Session == nil || errors.Is(context.Cause(ctx), ErrRequestCancelled) {
+		// No one is waiting for the error of a request the client canceled
 		return
 	}
 	var data *RPCError
@@ -132,7 +133,9 @@ func (r *Message) SendError(ctx context.Context, err error) {
 		Error:   data,
 	}
 
-	if err := r.Session.Send(ctx, resp); err != nil {
+	if err := r.Session.Send(ctx, resp); err != nil && ctx.Err() != nil {
+		log.Debugf(ctx, "failed to send error response after the request ended: %v", err)
+	} else if err != nil {
 		log.Errorf(ctx, "failed to send error response: %v", err)
 	}
 }
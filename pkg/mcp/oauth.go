@@ -22,19 +22,22 @@ var resourceMetadataRegex = regexp.MustCompile(`resource_metadata="([^"]*)"`)
 type oauth struct {
 	redirectURL, clientName string
 	currentToken            oauth2.Token
+	baseClient              *http.Client
 	metadataClient          *http.Client
 	callbackHandler         CallbackHandler
 	clientLookup            ClientCredLookup
 	tokenStorage            TokenStorage
 }
 
-func newOAuth(callbackHandler CallbackHandler, clientLookup ClientCredLookup, tokenStorage TokenStorage, clientName, redirectURL string) *oauth {
+func newOAuth(callbackHandler CallbackHandler, clientLookup ClientCredLookup, tokenStorage TokenStorage, clientName, redirectURL string, baseClient *http.Client) *oauth {
 	return &oauth{
 		clientName:      clientName,
 		redirectURL:     redirectURL,
 		callbackHandler: callbackHandler,
+		baseClient:      baseClient,
 		metadataClient: &http.Client{
-			Timeout: 5 * time.Second,
+			Transport: baseClient.Transport,
+			Timeout:   5 * time.Second,
 		},
 		clientLookup: clientLookup,
 		tokenStorage: tokenStorage,
@@ -45,6 +48,7 @@ func (o *oauth) loadFromStorage(ctx context.Context, connectURL string) *http.Cl
 	if o.tokenStorage == nil {
 		return nil
 	}
+	ctx = o.oauthContext(ctx)
 
 	// Read the token config from storage to see if we have valid auth
 	conf, tok, err := o.tokenStorage.GetTokenConfig(ctx, connectURL)
@@ -73,6 +77,7 @@ func (o *oauth) oauthClient(ctx context.Context, c *HTTPClient, connectURL, auth
 	if o.callbackHandler == nil || o.redirectURL == "" {
 		return nil, fmt.Errorf("oauth callback server is not configured")
 	}
+	ctx = o.oauthContext(ctx)
 
 	u, err := url.Parse(c.baseURL)
 	if err != nil {
@@ -633,6 +638,12 @@ type tokenSource struct {
 	tokenSource  oauth2.TokenSource
 }
 
+// oauthContext makes the oauth2 package send token requests, and the requests of the clients it returns,
+// with the transport of the server.
+func (o *oauth) oauthContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, o.baseClient)
+}
+
 func newTokenSource(ctx context.Context, tokenStorage TokenStorage, connectURL string, conf *oauth2.Config, tok *oauth2.Token) oauth2.TokenSource {
 	return oauth2.ReuseTokenSource(tok, &tokenSource{
 		ctx:          ctx,
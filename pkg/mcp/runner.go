@@ -6,6 +6,7 @@ import (
 	"io"
 	"maps"
 	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"slices"
@@ -14,14 +15,50 @@ import (
 
 	"github.com/nanobot-ai/nanobot/pkg/envvar"
 	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp/container"
+	"github.com/nanobot-ai/nanobot/pkg/mcp/kubernetes"
 	"github.com/nanobot-ai/nanobot/pkg/mcp/sandbox"
 	"github.com/nanobot-ai/nanobot/pkg/supervise"
 	"github.com/nanobot-ai/nanobot/pkg/system"
 )
 
+// processes are the commands of MCP servers that have not exited yet.
+var processes sync.WaitGroup
+
+// backgroundCtx is the context of processes that are not used by one session, like warm processes or
+// shared servers. It is canceled on shutdown.
+var backgroundCtx, stopBackground = context.WithCancel(context.Background())
+
+// BackgroundContext returns the context of processes that outlive the session that starts them.
+func BackgroundContext() context.Context {
+	return backgroundCtx
+}
+
+// WaitForProcesses stops the processes that are not used by one session and waits for the commands of MCP
+// servers to exit, for example after their sessions were closed on shutdown. It returns the error of ctx
+// if it is done first.
+func WaitForProcesses(ctx context.Context) error {
+	stopBackground()
+
+	done := make(chan struct{})
+	go func() {
+		processes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
 type Runner struct {
-	lock    sync.Mutex
-	running map[string]Server
+	lock       sync.Mutex
+	running    map[string]Server
+	containers container.Manager
+	warm       warmPool
+	egress     egressProxies
 }
 
 type streamResult struct {
@@ -31,7 +68,7 @@ type streamResult struct {
 	Close  func()
 }
 
-func (r *Runner) newCommand(ctx context.Context, currentEnv map[string]string, root func(context.Context) ([]Root, error), config Server) (Server, *sandbox.Cmd, error) {
+func (r *Runner) newCommand(ctx context.Context, currentEnv map[string]string, root func(context.Context) ([]Root, error), serverName string, config Server) (Server, *sandbox.Cmd, error) {
 	var publishPorts []string
 	ports := config.Ports
 	if len(ports) == 0 {
@@ -43,6 +80,11 @@ func (r *Runner) newCommand(ctx context.Context, currentEnv map[string]string, r
 	} else {
 		currentEnv = maps.Clone(currentEnv)
 	}
+	config, err := r.withEgress(ctx, serverName, config)
+	if err != nil {
+		return config, nil, err
+	}
+
 	for _, port := range ports {
 		l, err := net.Listen("tcp4", "localhost:0")
 		if err != nil {
@@ -62,15 +104,41 @@ func (r *Runner) newCommand(ctx context.Context, currentEnv map[string]string, r
 		currentEnv["nanobot:port:"+port] = portStr
 	}
 
-	config.BaseURL = envvar.ReplaceString(currentEnv, config.BaseURL)
+	config.BaseURL = envvar.ReplaceString(ctx, currentEnv, config.BaseURL)
+
+	command, args, env := envvar.ReplaceEnv(ctx, currentEnv, config.Command, config.Args, config.Env)
+	if config.Runtime == RuntimeDocker {
+		if config.BaseURL == "" {
+			// Servers on stdio do not listen on ports.
+			publishPorts = nil
+		}
+		cmd, err := r.newContainerCommand(ctx, root, config, command, args, publishPorts)
+		if err != nil {
+			return config, nil, err
+		}
+		cmd.Env = append(cleanOSEnv(), env...)
+		return config, cmd, nil
+	}
+
+	if config.Runtime == RuntimeKubernetes {
+		if config.BaseURL == "" {
+			publishPorts = nil
+		}
+		cmd, err := r.newPodCommand(ctx, &config, command, args, env, publishPorts)
+		if err != nil {
+			return config, nil, err
+		}
+		// The env of the server is in the pod spec, kubectl only needs to reach the cluster
+		cmd.Env = append(cleanOSEnv(), kubernetes.Env()...)
+		return config, cmd, nil
+	}
 
-	command, args, env := envvar.ReplaceEnv(currentEnv, config.Command, config.Args, config.Env)
 	if !config.Sandboxed || command == "nanobot" {
 		if command == "nanobot" {
 			command = system.Bin()
 		}
 		cmd := supervise.Cmd(ctx, command, args...)
-		cmd.Dir = envvar.ReplaceString(currentEnv, config.Cwd)
+		cmd.Dir = envvar.ReplaceString(ctx, currentEnv, config.Cwd)
 		cmd.Env = append(cleanOSEnv(), env...)
 		return config, &sandbox.Cmd{
 			Cmd: cmd,
@@ -80,7 +148,6 @@ func (r *Runner) newCommand(ctx context.Context, currentEnv map[string]string, r
 	var (
 		rootPaths []sandbox.Root
 		roots     []Root
-		err       error
 	)
 
 	if root != nil {
@@ -104,7 +171,7 @@ func (r *Runner) newCommand(ctx context.Context, currentEnv map[string]string, r
 		ReversePorts: config.ReversePorts,
 		Roots:        rootPaths,
 		Command:      command,
-		Workdir:      envvar.ReplaceString(config.Env, config.Workdir),
+		Workdir:      envvar.ReplaceString(ctx, config.Env, config.Workdir),
 		Args:         args,
 		Env:          slices.Collect(maps.Keys(config.Env)),
 		BaseImage:    config.Image,
@@ -119,6 +186,92 @@ func (r *Runner) newCommand(ctx context.Context, currentEnv map[string]string, r
 	return config, cmd, nil
 }
 
+// newContainerCommand returns the command that runs the image of a server with the docker runtime. The
+// container is removed when ctx is done, which is when the session of the server is closed.
+func (r *Runner) newContainerCommand(ctx context.Context, root func(context.Context) ([]Root, error), config Server, command string, args, publishPorts []string) (*sandbox.Cmd, error) {
+	var mounts []string
+	if root != nil {
+		roots, err := root(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get roots: %w", err)
+		}
+		for _, root := range roots {
+			if path, ok := strings.CutPrefix(root.URI, "file://"); ok {
+				mounts = append(mounts, path)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmd, err := r.containers.Command(ctx, container.Options{
+		Image:        config.Image,
+		Command:      command,
+		Args:         args,
+		Env:          slices.Collect(maps.Keys(config.Env)),
+		PublishPorts: publishPorts,
+		Mounts:       mounts,
+		Workdir:      envvar.ReplaceString(ctx, config.Env, config.Workdir),
+		CPUs:         config.Container.CPUs,
+		Memory:       config.Container.Memory,
+		PIDs:         config.Container.PIDs,
+		Network:      config.Container.Network,
+		ReadOnly:     config.Container.ReadOnly,
+		Pull:         config.Container.Pull,
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create container command: %w", err)
+	}
+	return sandbox.WrapCmd(cmd, cancel), nil
+}
+
+// newPodCommand returns the command that runs the image of a server with the kubernetes runtime as a pod,
+// and points the URL of the config at the host its ports are reached at. The pod is deleted when ctx is
+// done. Roots are not mounted in the pod, it runs on another node.
+func (r *Runner) newPodCommand(ctx context.Context, config *Server, command string, args, env, ports []string) (*sandbox.Cmd, error) {
+	envMap := make(map[string]string, len(env))
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		envMap[k] = v
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmd, host, err := kubernetes.Command(ctx, kubernetes.Options{
+		Image:          config.Image,
+		Command:        command,
+		Args:           args,
+		Env:            envMap,
+		Ports:          ports,
+		Workdir:        envvar.ReplaceString(ctx, config.Env, config.Workdir),
+		Namespace:      config.Kubernetes.Namespace,
+		ServiceAccount: config.Kubernetes.ServiceAccount,
+		Requests:       config.Kubernetes.Requests,
+		Limits:         config.Kubernetes.Limits,
+		NodeSelector:   config.Kubernetes.NodeSelector,
+		Pull:           config.Kubernetes.Pull,
+		Connect:        config.Kubernetes.Connect,
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create pod command: %w", err)
+	}
+
+	if config.BaseURL != "" && host != "localhost" {
+		u, err := url.Parse(config.BaseURL)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid url %q: %w", config.BaseURL, err)
+		}
+		if port := u.Port(); port != "" {
+			u.Host = net.JoinHostPort(host, port)
+		} else {
+			u.Host = host
+		}
+		config.BaseURL = u.String()
+	}
+	return sandbox.WrapCmd(cmd, cancel), nil
+}
+
 var allowedEnv = map[string]bool{
 	"PATH": true,
 	"HOME": true,
@@ -157,6 +310,7 @@ func (r *Runner) doRun(ctx context.Context, serverName string, config Server, cm
 	if err := cmd.Start(); err != nil {
 		return config, fmt.Errorf("failed to start command: %w", err)
 	}
+	processes.Add(1)
 
 	if r.running == nil {
 		r.running = make(map[string]Server)
@@ -177,6 +331,7 @@ func (r *Runner) doRun(ctx context.Context, serverName string, config Server, cm
 	}()
 
 	go func() {
+		defer processes.Done()
 		wg.Wait()
 		err := cmd.Wait()
 		if err != nil {
@@ -207,8 +362,10 @@ func (r *Runner) doStream(ctx context.Context, serverName string, cmd *sandbox.C
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("failed to start command: %w", err)
 	}
+	processes.Add(1)
 
 	go func() {
+		defer processes.Done()
 		sandbox.PipeOut(ctx, stderrPipe, serverName)
 		if err := cmd.Wait(); err != nil {
 			log.Errorf(ctx, "Command %s exited with error: %v\n", serverName, err)
@@ -230,7 +387,7 @@ func (r *Runner) Run(ctx context.Context, roots func(ctx context.Context) ([]Roo
 		return c, nil
 	}
 
-	newConfig, cmd, err := r.newCommand(ctx, env, roots, config)
+	newConfig, cmd, err := r.newCommand(ctx, env, roots, serverName, config)
 	if err != nil {
 		return config, err
 	}
@@ -239,8 +396,12 @@ func (r *Runner) Run(ctx context.Context, roots func(ctx context.Context) ([]Roo
 }
 
 func (r *Runner) Stream(ctx context.Context, roots func(context.Context) ([]Root, error), env map[string]string, serverName string, config Server) (*streamResult, error) {
+	if canWarm(config) {
+		return r.streamWarm(ctx, roots, env, serverName, config)
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
-	_, cmd, err := r.newCommand(ctx, env, roots, config)
+	_, cmd, err := r.newCommand(ctx, env, roots, serverName, config)
 	if err != nil {
 		cancel()
 		return nil, err
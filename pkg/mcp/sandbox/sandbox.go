@@ -58,6 +58,14 @@ type Cmd struct {
 	postStart func() error
 }
 
+// WrapCmd returns the command that calls cancel when it exits.
+func WrapCmd(cmd *exec.Cmd, cancel func()) *Cmd {
+	return &Cmd{
+		Cmd:    cmd,
+		cancel: cancel,
+	}
+}
+
 func (c *Cmd) Wait() error {
 	if c.cancel != nil {
 		defer c.cancel()
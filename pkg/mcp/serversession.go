@@ -2,10 +2,12 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
 
+	"github.com/nanobot-ai/nanobot/pkg/bus"
 	"github.com/nanobot-ai/nanobot/pkg/uuid"
 )
 
@@ -36,15 +38,20 @@ func NewExistingServerSession(ctx context.Context, state SessionState, handler M
 	for k, v := range state.Attributes {
 		session.Set(k, v)
 	}
-	return &ServerSession{
+	serverSession := &ServerSession{
 		session: session,
 		wire:    s,
-	}, nil
+	}
+	session.serverSession = serverSession
+	return serverSession, nil
 }
 
 type ServerSession struct {
 	session *Session
 	wire    *serverWire
+	// inFlight holds the cancel functions of the requests of the client that are being handled, by
+	// request ID.
+	inFlight sync.Map
 }
 
 func (s *ServerSession) Wait() {
@@ -90,6 +97,8 @@ func (s *ServerSession) ID() string {
 var (
 	ErrNoResponse = errors.New("no response")
 	ErrNoReader   = errors.New("no reader")
+	// ErrRequestCancelled is the cause of the context of a request the client canceled.
+	ErrRequestCancelled = errors.New("request canceled by the client")
 )
 
 func (s *ServerSession) GetSession() *Session {
@@ -97,12 +106,41 @@ func (s *ServerSession) GetSession() *Session {
 }
 
 func (s *ServerSession) Exchange(ctx context.Context, msg Message) (Message, error) {
+	if msg.Method == "notifications/cancelled" {
+		s.cancelRequest(msg)
+		return Message{}, ErrNoResponse
+	}
+
 	isInit, err := s.session.preInit(&msg)
 	if err != nil {
 		return Message{}, err
 	}
+
+	// A request ends when the client cancels it or disconnects, which cancels ctx, and its handler
+	// cancels the requests it sent to other servers in turn.
+	if msg.ID != nil && !isInit {
+		var (
+			parent = ctx
+			cancel context.CancelCauseFunc
+		)
+		ctx, cancel = context.WithCancelCause(context.WithoutCancel(parent))
+		stop := context.AfterFunc(parent, func() {
+			cancel(fmt.Errorf("%w: the client disconnected", ErrRequestCancelled))
+		})
+		key := inFlightKey(msg.ID)
+		s.inFlight.Store(key, cancel)
+		defer func() {
+			stop()
+			s.inFlight.Delete(key)
+			cancel(nil)
+		}()
+	}
+
 	resp, err := s.wire.exchange(ctx, msg)
-	if err != nil {
+	if err != nil && errors.Is(context.Cause(ctx), ErrRequestCancelled) {
+		// The client is not waiting for a response to a request it canceled
+		return Message{}, ErrNoResponse
+	} else if err != nil {
 		return Message{}, err
 	}
 	if isInit {
@@ -113,6 +151,30 @@ func (s *ServerSession) Exchange(ctx context.Context, msg Message) (Message, err
 	return resp, nil
 }
 
+// inFlightKey is the JSON encoding of a request ID so that the number 1 and the string "1" are
+// different requests.
+func inFlightKey(id any) string {
+	data, err := json.Marshal(id)
+	if err != nil {
+		return fmt.Sprintf("%T:%v", id, id)
+	}
+	return string(data)
+}
+
+func (s *ServerSession) cancelRequest(msg Message) {
+	var cancelled NotificationCancelled
+	if err := json.Unmarshal(msg.Params, &cancelled); err != nil || cancelled.RequestID == nil {
+		return
+	}
+	if cancel, ok := s.inFlight.Load(inFlightKey(cancelled.RequestID)); ok {
+		reason := cancelled.Reason
+		if reason == "" {
+			reason = "no reason given"
+		}
+		cancel.(context.CancelCauseFunc)(fmt.Errorf("%w: %s", ErrRequestCancelled, reason))
+	}
+}
+
 func (s *ServerSession) Read(ctx context.Context) (Message, bool) {
 	select {
 	case msg, ok := <-s.wire.read:
@@ -161,6 +223,14 @@ type serverWire struct {
 	noReader   chan struct{}
 	handler    WireHandler
 	sessionID  string
+	// bus is where notifications are published when this process has no reader for them, so that
+	// a stream of the session connected to another process gets them.
+	bus bus.Bus
+}
+
+// sessionTopic is the topic of the bus notifications of the session are published on.
+func sessionTopic(sessionID string) string {
+	return "session/" + sessionID
 }
 
 func (s *serverWire) SessionID() string {
@@ -209,6 +279,27 @@ func (s *serverWire) Start(ctx context.Context, handler WireHandler) error {
 }
 
 func (s *serverWire) Send(ctx context.Context, req Message) error {
+	err := s.send(ctx, req)
+	if !errors.Is(err, ErrNoReader) || req.ID != nil || req.Method == "" {
+		return err
+	}
+
+	s.readerLock.RLock()
+	b := s.bus
+	s.readerLock.RUnlock()
+	if b == nil {
+		return err
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	return b.Publish(ctx, sessionTopic(s.sessionID), data)
+}
+
+// send delivers the message to the reader of this process.
+func (s *serverWire) send(ctx context.Context, req Message) error {
 	if s.pending.Notify(req) {
 		return nil
 	}
@@ -224,6 +315,13 @@ func (s *serverWire) Send(ctx context.Context, req Message) error {
 	}
 }
 
+func (s *serverWire) setBus(b bus.Bus) {
+	s.readerLock.Lock()
+	defer s.readerLock.Unlock()
+
+	s.bus = b
+}
+
 func (s *serverWire) startReading() {
 	s.readerLock.Lock()
 	defer s.readerLock.Unlock()
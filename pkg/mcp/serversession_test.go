@@ -0,0 +1,33 @@
+package mcp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInFlightKey(t *testing.T) {
+	var decoded struct {
+		ID any `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(`{"id": 1}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		id    any
+		other any
+		same  bool
+	}{
+		{name: "number and string", id: 1, other: "1"},
+		{name: "decoded number", id: 1, other: decoded.ID, same: true},
+		{name: "strings", id: "abc", other: "abc", same: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := inFlightKey(tt.id) == inFlightKey(tt.other); same != tt.same {
+				t.Errorf("expected the keys of %#v and %#v to be the same %v, got %v", tt.id, tt.other, tt.same, same)
+			}
+		})
+	}
+}
@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"maps"
 	"reflect"
 	"slices"
 	"sync"
+	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/telemetry"
 )
 
 var ErrNoResult = errors.New("no result in response")
@@ -50,6 +54,17 @@ func SessionFromContext(ctx context.Context) *Session {
 	return s
 }
 
+func init() {
+	// Log lines of a session have the ID of its root session, the one of the client
+	log.RegisterContext(func(ctx context.Context) []slog.Attr {
+		session := SessionFromContext(ctx).Root()
+		if id := session.ID(); id != "" {
+			return []slog.Attr{slog.String("session_id", id)}
+		}
+		return nil
+	})
+}
+
 func WithSession(ctx context.Context, s *Session) context.Context {
 	if s == nil {
 		return ctx
@@ -72,8 +87,15 @@ type Session struct {
 	filters           []filterRegistration
 	filterID          int
 	sessionManager    SessionStore
+	serverSession     *ServerSession
+	closeHooks        []func(deleted bool)
+	elicitHandler     ElicitHandler
 }
 
+// ElicitHandler answers the elicitation requests of a session in process, for sessions without a
+// client that can answer them, like the sessions of the CLI.
+type ElicitHandler func(ctx context.Context, req ElicitRequest) (ElicitResult, error)
+
 type filterRegistration struct {
 	filter MessageFilter
 	id     int
@@ -81,15 +103,20 @@ type filterRegistration struct {
 
 const SessionEnvMapKey = "env"
 
+// Root returns the session of the client that s belongs to, s itself if it has no parent.
+func (s *Session) Root() *Session {
+	for s != nil && s.Parent != nil {
+		s = s.Parent
+	}
+	return s
+}
+
 func (s *Session) Context() context.Context {
 	return s.ctx
 }
 
 func (s *Session) Go(ctx context.Context, f func(ctx context.Context)) {
-	parentSession := s
-	for parentSession.Parent != nil {
-		parentSession = parentSession.Parent
-	}
+	parentSession := s.Root()
 
 	sm := parentSession.sessionManager
 	id := parentSession.ID()
@@ -108,6 +135,24 @@ func (s *Session) Go(ctx context.Context, f func(ctx context.Context)) {
 	f(ctx)
 }
 
+// Persist stores the state of the session in its session store now, instead of after the request that
+// changed it. Sessions that are not served over HTTP are not stored.
+func (s *Session) Persist(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	root := s.Root()
+
+	root.lock.Lock()
+	sm, serverSession := root.sessionManager, root.serverSession
+	root.lock.Unlock()
+
+	if sm == nil || serverSession == nil || root.ID() == "" {
+		return nil
+	}
+	return sm.Store(ctx, root.ID(), serverSession)
+}
+
 func (s *Session) ID() string {
 	if s == nil || s.wire == nil {
 		return ""
@@ -218,6 +263,31 @@ func (s *Session) AddFilter(filter MessageFilter) (remove func()) {
 	}
 }
 
+// SetElicitHandler answers the elicitation requests of the session with the handler instead of sending
+// them to the client, and marks the session as supporting elicitation.
+func (s *Session) SetElicitHandler(handler ElicitHandler) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.elicitHandler = handler
+	s.InitializeRequest.Capabilities.Elicitation = &struct{}{}
+}
+
+func (s *Session) elicit(ctx context.Context, handler ElicitHandler, in, out any) error {
+	var req ElicitRequest
+	if err := JSONCoerce(in, &req); err != nil {
+		return fmt.Errorf("failed to marshal elicitation request: %w", err)
+	}
+	result, err := handler(WithSession(ctx, s), req)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal elicitation result: %w", err)
+	}
+	return json.Unmarshal(data, out)
+}
+
 func (s *Session) Delete(key string) {
 	if s == nil {
 		return
@@ -242,6 +312,40 @@ func (s *Session) Set(key string, value any) {
 	s.attributes[key] = value
 }
 
+// Update reads the value of the key into out, a pointer as for Get, calls update, and sets the key to the
+// value out points to unless update returns an error. Other updates and sets of the session wait until it
+// is done, so that concurrent updates of the key are not lost. The value that was read is still used by
+// earlier readers, so update replaces its maps and slices instead of changing them, and it must not call
+// other methods of the session. Unlike Get, the value of the parent session is not read.
+func (s *Session) Update(key string, out any, update func() error) error {
+	if s == nil {
+		return update()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if v := s.attributes[key]; v != nil && !s.copyInto(out, v) {
+		deserializable, ok := out.(Deserializable)
+		if !ok {
+			panic(fmt.Sprintf("can not marshal %T to type: %T", v, out))
+		}
+		if _, err := deserializable.Deserialize(v); err != nil {
+			// A value that can not be read is replaced, as Get drops it
+			reflect.ValueOf(out).Elem().SetZero()
+		}
+	}
+
+	if err := update(); err != nil {
+		return err
+	}
+	if s.attributes == nil {
+		s.attributes = make(map[string]any)
+	}
+	s.attributes[key] = reflect.ValueOf(out).Elem().Interface()
+	return nil
+}
+
 func (s *Session) copyInto(out, in any) bool {
 	dstVal := reflect.ValueOf(out)
 	srcVal := reflect.ValueOf(in)
@@ -340,12 +444,29 @@ func (s *Session) Attributes() map[string]any {
 	return attributes
 }
 
+// OnClose registers a function that is called when the session is closed. deleted is true if the session
+// ends and will not be resumed.
+func (s *Session) OnClose(hook func(deleted bool)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closeHooks = append(s.closeHooks, hook)
+}
+
 func (s *Session) Close(deleteSession bool) {
 	if s.wire != nil {
 		s.wire.Close(deleteSession)
 	}
 	s.pendingRequest.Close()
 	s.cancel(fmt.Errorf("session closed: %s, delete=%v", s.ID(), deleteSession))
+
+	s.lock.Lock()
+	hooks := s.closeHooks
+	s.closeHooks = nil
+	s.lock.Unlock()
+
+	for _, hook := range hooks {
+		hook(deleteSession)
+	}
 }
 
 func (s *Session) Wait() {
@@ -406,14 +527,12 @@ func (s *Session) SendPayload(ctx context.Context, method string, payload any) e
 }
 
 func (s *Session) Send(ctx context.Context, req Message) error {
-	if s.wire == nil {
-		return fmt.Errorf("empty session: wire is not initialized")
-	}
-
 	s.lock.Lock()
 	f := slices.Clone(s.filters)
 	s.lock.Unlock()
 
+	// Filters run even without a wire so that in process callers of an empty session can observe
+	// notifications like progress.
 	for _, filter := range f {
 		newReq, err := filter.filter(ctx, &req)
 		if err != nil || newReq == nil {
@@ -422,6 +541,10 @@ func (s *Session) Send(ctx context.Context, req Message) error {
 		req = *newReq
 	}
 
+	if s.wire == nil {
+		return fmt.Errorf("empty session: wire is not initialized")
+	}
+
 	req.JSONRPC = "2.0"
 	s.recorder.save(ctx, s.wire.SessionID(), true, req)
 	return s.wire.Send(ctx, req)
@@ -461,13 +584,33 @@ func (s *Session) postInit(msg *Message) error {
 	return nil
 }
 
+// ServerError is returned for requests the server responded to with an error.
+type ServerError struct {
+	Err *RPCError
+}
+
+func (e *ServerError) Error() string {
+	return "error from server: " + e.Err.Message
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// RPCError keeps the data of the error of the server when the error is sent on to a client.
+func (e *ServerError) RPCError() *RPCError {
+	result := ErrRPCInternal.WithMessage("%s", e.Error())
+	result.Data = e.Err.Data
+	return result
+}
+
 func (s *Session) marshalResponse(m Message, out any) error {
 	if mOut, ok := out.(*Message); ok {
 		*mOut = m
 		return nil
 	}
 	if m.Error != nil {
-		return fmt.Errorf("error from server: %s", m.Error.Message)
+		return &ServerError{Err: m.Error}
 	}
 	if m.Result == nil {
 		return ErrNoResult
@@ -503,7 +646,24 @@ func (s *Session) toRequest(method string, in any, opt ExchangeOption) (*Message
 	return req, nil
 }
 
-func (s *Session) Exchange(ctx context.Context, method string, in, out any, opts ...ExchangeOption) error {
+func (s *Session) Exchange(ctx context.Context, method string, in, out any, opts ...ExchangeOption) (err error) {
+	ctx, span := telemetry.Start(ctx, "mcp."+method, telemetry.Method.String(method))
+	if s.wire != nil {
+		span.SetAttributes(telemetry.SessionID.String(s.wire.SessionID()))
+	}
+	defer func() {
+		telemetry.End(span, err)
+	}()
+
+	if method == "elicitation/create" {
+		s.lock.Lock()
+		handler := s.elicitHandler
+		s.lock.Unlock()
+		if handler != nil {
+			return s.elicit(ctx, handler, in, out)
+		}
+	}
+
 	opt := complete.Complete(opts...)
 	req, err := s.toRequest(method, in, opt)
 	if err != nil {
@@ -535,6 +695,9 @@ func (s *Session) Exchange(ctx context.Context, method string, in, out any, opts
 	for {
 		select {
 		case <-ctx.Done():
+			if !isInit {
+				s.sendCancelled(ctx, req.ID)
+			}
 			return ctx.Err()
 		case err = <-errChan:
 			if err != nil {
@@ -554,6 +717,24 @@ func (s *Session) Exchange(ctx context.Context, method string, in, out any, opts
 	}
 }
 
+// sendCancelled tells the other side that the request is canceled, so that it stops working on it.
+func (s *Session) sendCancelled(ctx context.Context, id any) {
+	if s.wire == nil {
+		return
+	}
+	reason := "request canceled"
+	if cause := context.Cause(ctx); cause != nil {
+		reason = cause.Error()
+	}
+	// The context of the request is done, the notification gets a short time of its own.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	_ = s.SendPayload(ctx, "notifications/cancelled", NotificationCancelled{
+		RequestID: id,
+		Reason:    reason,
+	})
+}
+
 func (s *Session) onWire(ctx context.Context, message Message) {
 	s.recorder.save(s.ctx, s.wire.SessionID(), false, message)
 	message.Session = s
@@ -0,0 +1,42 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestSessionUpdate(t *testing.T) {
+	session := NewEmptySession(context.Background())
+
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var count int
+			_ = session.Update("count", &count, func() error {
+				count++
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	var count int
+	if !session.Get("count", &count) || count != 100 {
+		t.Errorf("expected 100 updates, got %d", count)
+	}
+
+	failed := errors.New("failed")
+	if err := session.Update("count", &count, func() error {
+		count = 0
+		return failed
+	}); !errors.Is(err, failed) {
+		t.Errorf("expected %v, got %v", failed, err)
+	}
+	if session.Get("count", &count); count != 100 {
+		t.Errorf("expected the failed update not to be set, got %d", count)
+	}
+}
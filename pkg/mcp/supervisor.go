@@ -0,0 +1,290 @@
+package mcp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+)
+
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+)
+
+// restartingStdio is a stdio Wire that restarts the server process with exponential backoff when it
+// exits without the session being closed. Requests that were in flight when the process exited fail
+// with an error.
+type restartingStdio struct {
+	serverName string
+	newStdio   func() (*Stdio, error)
+	// onRestart is called after a new process was started, it is responsible for initializing it.
+	onRestart func(ctx context.Context)
+
+	lock     sync.Mutex
+	current  *Stdio
+	inFlight map[any]struct{}
+	closed   bool
+	waiter   *waiter
+}
+
+func newRestartingStdio(serverName string, newStdio func() (*Stdio, error)) (*restartingStdio, error) {
+	current, err := newStdio()
+	if err != nil {
+		return nil, err
+	}
+	return &restartingStdio{
+		serverName: serverName,
+		newStdio:   newStdio,
+		current:    current,
+		inFlight:   map[any]struct{}{},
+		waiter:     newWaiter(),
+	}, nil
+}
+
+func (r *restartingStdio) Start(ctx context.Context, handler WireHandler) error {
+	wrapped := func(ctx context.Context, msg Message) {
+		if msg.ID != nil && msg.Method == "" {
+			r.lock.Lock()
+			delete(r.inFlight, msg.ID)
+			r.lock.Unlock()
+		}
+		handler(ctx, msg)
+	}
+
+	r.lock.Lock()
+	current := r.current
+	r.lock.Unlock()
+
+	if err := current.Start(ctx, wrapped); err != nil {
+		return err
+	}
+
+	go r.supervise(ctx, current, wrapped)
+	return nil
+}
+
+func (r *restartingStdio) supervise(ctx context.Context, current *Stdio, handler WireHandler) {
+	defer r.waiter.Close()
+
+	backoff := minRestartBackoff
+	for {
+		started := time.Now()
+		current.Wait()
+
+		if r.isClosed() || ctx.Err() != nil {
+			return
+		}
+
+		r.failInFlight(ctx, handler)
+
+		if time.Since(started) > maxRestartBackoff {
+			// The process was healthy for a while, so start over with a short backoff
+			backoff = minRestartBackoff
+		}
+
+		for {
+			log.Errorf(ctx, "MCP server %s exited, restarting in %s", r.serverName, backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxRestartBackoff)
+
+			next, err := r.newStdio()
+			if err == nil {
+				err = next.Start(ctx, handler)
+			}
+			if err != nil {
+				log.Errorf(ctx, "failed to restart MCP server %s: %v", r.serverName, err)
+				continue
+			}
+
+			r.lock.Lock()
+			if r.closed {
+				r.lock.Unlock()
+				next.Close(false)
+				return
+			}
+			r.current = next
+			r.lock.Unlock()
+
+			current = next
+			break
+		}
+
+		log.Infof(ctx, "MCP server %s restarted", r.serverName)
+		if r.onRestart != nil {
+			go r.onRestart(ctx)
+		}
+	}
+}
+
+func (r *restartingStdio) failInFlight(ctx context.Context, handler WireHandler) {
+	r.lock.Lock()
+	ids := r.inFlight
+	r.inFlight = map[any]struct{}{}
+	r.lock.Unlock()
+
+	for id := range ids {
+		handler(ctx, Message{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error:   ErrRPCInternal.WithMessage("MCP server %s exited before responding", r.serverName),
+		})
+	}
+}
+
+func (r *restartingStdio) isClosed() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.closed
+}
+
+// restart stops the current process, which will cause a new one to be started.
+func (r *restartingStdio) restart() {
+	r.lock.Lock()
+	current := r.current
+	r.lock.Unlock()
+	current.Close(false)
+}
+
+func (r *restartingStdio) Send(ctx context.Context, msg Message) error {
+	r.lock.Lock()
+	current := r.current
+	if msg.ID != nil && msg.Method != "" {
+		r.inFlight[msg.ID] = struct{}{}
+	}
+	r.lock.Unlock()
+	return current.Send(ctx, msg)
+}
+
+func (r *restartingStdio) SessionID() string {
+	return ""
+}
+
+func (r *restartingStdio) Wait() {
+	r.waiter.Wait()
+}
+
+func (r *restartingStdio) Close(deleteSession bool) {
+	r.lock.Lock()
+	r.closed = true
+	current := r.current
+	r.lock.Unlock()
+
+	current.Close(deleteSession)
+	r.waiter.Close()
+}
+
+// HealthCheckOptions configures how a client checks that the server is still responding.
+type HealthCheckOptions struct {
+	// Interval between pings, zero disables health checks
+	Interval time.Duration
+	// Timeout for a single ping
+	Timeout time.Duration
+	// FailureThreshold is the number of failed pings after which the server is considered unhealthy.
+	FailureThreshold int
+}
+
+func (h HealthCheckOptions) Merge(other HealthCheckOptions) (result HealthCheckOptions) {
+	result.Interval = other.Interval
+	if result.Interval == 0 {
+		result.Interval = h.Interval
+	}
+	result.Timeout = other.Timeout
+	if result.Timeout == 0 {
+		result.Timeout = h.Timeout
+	}
+	result.FailureThreshold = other.FailureThreshold
+	if result.FailureThreshold == 0 {
+		result.FailureThreshold = h.FailureThreshold
+	}
+	return
+}
+
+func (h HealthCheckOptions) Complete() HealthCheckOptions {
+	if h.Timeout == 0 {
+		h.Timeout = 10 * time.Second
+	}
+	if h.FailureThreshold == 0 {
+		h.FailureThreshold = 3
+	}
+	return h
+}
+
+// Healthy returns false if the server did not respond to the last health checks.
+func (c *Client) Healthy() bool {
+	c.healthLock.Lock()
+	defer c.healthLock.Unlock()
+	return !c.unhealthy
+}
+
+func (c *Client) setHealthy(healthy bool) {
+	c.healthLock.Lock()
+	defer c.healthLock.Unlock()
+	c.unhealthy = !healthy
+}
+
+// supervise pings the server until the session is closed. After enough consecutive failures the server
+// is marked unhealthy and, if it is a local process, restarted.
+func (c *Client) supervise(ctx context.Context, serverName string, opts HealthCheckOptions) {
+	var (
+		ticker   = time.NewTicker(opts.Interval)
+		failures int
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.ping(ctx, opts.Timeout); err != nil {
+			failures++
+			log.Debugf(ctx, "health check of MCP server %s failed (%d/%d): %v", serverName, failures, opts.FailureThreshold, err)
+			if failures < opts.FailureThreshold {
+				continue
+			}
+			if c.Healthy() {
+				log.Errorf(ctx, "MCP server %s is unhealthy: %v", serverName, err)
+			}
+			c.setHealthy(false)
+			failures = 0
+			if wire, ok := c.Session.wire.(*restartingStdio); ok {
+				wire.restart()
+			}
+			continue
+		}
+
+		failures = 0
+		if !c.Healthy() {
+			log.Infof(ctx, "MCP server %s is healthy again", serverName)
+		}
+		c.setHealthy(true)
+	}
+}
+
+func (c *Client) ping(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Any response, even an error because the server does not implement ping, means it is alive.
+	var resp Message
+	return c.Session.Exchange(ctx, "ping", PingRequest{}, &resp)
+}
+
+// reinitialize initializes a restarted server with the same request as the original initialization
+// and restores the resource subscriptions.
+func (c *Client) reinitialize(ctx context.Context) {
+	if _, err := c.Initialize(ctx, c.Session.InitializeRequest); err != nil {
+		log.Errorf(ctx, "failed to initialize restarted MCP server: %v", err)
+		return
+	}
+	c.setHealthy(true)
+	c.resubscribe(ctx)
+}
@@ -81,6 +81,7 @@ type PrimitiveSchema struct {
 	// Type must be "object" only
 	Type       string                       `json:"type"`
 	Properties map[string]PrimitiveProperty `json:"properties"`
+	Required   []string                     `json:"required,omitempty"`
 }
 
 type PrimitiveProperty struct {
@@ -249,6 +250,8 @@ func (t ToolAnnotations) IsDestructive() bool {
 type CallToolResult struct {
 	IsError bool      `json:"isError"`
 	Content []Content `json:"content,omitzero"`
+	// StructuredContent is the result as a JSON object, it matches the output schema of the tool if it has one.
+	StructuredContent any `json:"structuredContent,omitempty"`
 }
 
 type CallToolRequest struct {
@@ -378,6 +381,13 @@ type PromptArgument struct {
 type Notification struct {
 }
 
+// NotificationCancelled is the params of notifications/cancelled, sent for a request that is no
+// longer needed.
+type NotificationCancelled struct {
+	RequestID any    `json:"requestId"`
+	Reason    string `json:"reason,omitempty"`
+}
+
 type NotificationProgressRequest struct {
 	ProgressToken any            `json:"progressToken"`
 	Progress      json.Number    `json:"progress"`
@@ -0,0 +1,53 @@
+package mcp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// LatestProtocolVersion is the MCP revision clients request and servers answer with if they do not
+// support the revision of the client.
+const LatestProtocolVersion = "2025-06-18"
+
+// ProtocolVersionHeader is sent on the HTTP requests after initialize by clients of revisions that have it.
+const ProtocolVersionHeader = "MCP-Protocol-Version"
+
+// SupportedProtocolVersions are the MCP revisions nanobot talks, newest first.
+var SupportedProtocolVersions = []string{
+	LatestProtocolVersion,
+	"2025-03-26",
+	"2024-11-05",
+}
+
+// NegotiateProtocolVersion returns the revision a server answers the initialize request of a client with,
+// the revision of the client if it is supported, otherwise the latest revision.
+func NegotiateProtocolVersion(requested string) string {
+	if IsSupportedProtocolVersion(requested) {
+		return requested
+	}
+	return LatestProtocolVersion
+}
+
+func IsSupportedProtocolVersion(version string) bool {
+	return slices.Contains(SupportedProtocolVersions, version)
+}
+
+// checkProtocolVersion returns the revision negotiated by the initialize result. Servers that leave the
+// version out of their result are assumed to talk the revision the client requested.
+func checkProtocolVersion(requested string, result InitializeResult) (string, error) {
+	if result.ProtocolVersion == "" {
+		return requested, nil
+	}
+	if !IsSupportedProtocolVersion(result.ProtocolVersion) {
+		return "", fmt.Errorf("server answered with unsupported MCP protocol version %q, supported versions are %s",
+			result.ProtocolVersion, strings.Join(SupportedProtocolVersions, ", "))
+	}
+	return result.ProtocolVersion, nil
+}
+
+// sendsProtocolVersionHeader returns whether the revision has the MCP-Protocol-Version header, which
+// was added in 2025-06-18. The revisions are dates, so they compare as strings.
+func sendsProtocolVersionHeader(version string) bool {
+	return version >= "2025-06-18"
+}
@@ -0,0 +1,122 @@
+package mcp
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+)
+
+// warmPool holds started processes of the stdio servers with warm set, so that new sessions don't wait
+// for the server to start. Processes are only used by sessions that run the same command with the same
+// env, others are replaced.
+type warmPool struct {
+	lock     sync.Mutex
+	idle     map[string][]warmProcess
+	starting map[string]int
+}
+
+type warmProcess struct {
+	key    string
+	stream *streamResult
+}
+
+// canWarm returns true for servers whose processes don't depend on the session that runs them.
+func canWarm(config Server) bool {
+	return config.Warm > 0 && config.Runtime == "" && !config.Sandboxed && config.BaseURL == ""
+}
+
+// warmKey identifies the processes of a server that are the same, the command, args, env and directory.
+func warmKey(cmd []string, env []string, dir string) string {
+	return strings.Join(cmd, "\x00") + "\x01" + strings.Join(env, "\x00") + "\x01" + dir
+}
+
+func (p *warmPool) init() {
+	if p.idle == nil {
+		p.idle = map[string][]warmProcess{}
+		p.starting = map[string]int{}
+	}
+}
+
+// take returns an idle process of the server for the key, idle processes for other keys are stopped.
+func (p *warmPool) take(serverName, key string) *streamResult {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.init()
+
+	var result *streamResult
+	for _, process := range p.idle[serverName] {
+		if process.key == key && result == nil {
+			result = process.stream
+		} else if process.key != key {
+			process.stream.Close()
+		}
+	}
+	p.idle[serverName] = slices.DeleteFunc(p.idle[serverName], func(process warmProcess) bool {
+		return process.key != key || process.stream == result
+	})
+	return result
+}
+
+// fill starts processes in the background until the server has warm idle processes for the key.
+func (p *warmPool) fill(serverName, key string, warm int, start func() (*streamResult, error)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.init()
+
+	for len(p.idle[serverName])+p.starting[serverName] < warm {
+		p.starting[serverName]++
+		go func() {
+			stream, err := start()
+
+			p.lock.Lock()
+			defer p.lock.Unlock()
+			p.starting[serverName]--
+			if err != nil {
+				log.Errorf(backgroundCtx, "failed to start warm process of MCP server %s: %v", serverName, err)
+				return
+			}
+			p.idle[serverName] = append(p.idle[serverName], warmProcess{
+				key:    key,
+				stream: stream,
+			})
+		}()
+	}
+}
+
+// streamWarm returns an idle process of the server if there is one for the command the session runs and
+// starts another one for the next session. The process is stopped when ctx is done.
+func (r *Runner) streamWarm(ctx context.Context, roots func(context.Context) ([]Root, error), env map[string]string, serverName string, config Server) (*streamResult, error) {
+	start := func() (*streamResult, error) {
+		return r.Stream(backgroundCtx, roots, env, serverName, noWarm(config))
+	}
+
+	_, cmd, err := r.newCommand(backgroundCtx, env, roots, serverName, config)
+	if err != nil {
+		return nil, err
+	}
+	key := warmKey(cmd.Args, cmd.Env, cmd.Dir)
+
+	result := r.warm.take(serverName, key)
+	r.warm.fill(serverName, key, config.Warm, start)
+	if result == nil {
+		if result, err = start(); err != nil {
+			return nil, err
+		}
+	}
+
+	stop := context.AfterFunc(ctx, result.Close)
+	closeStream := result.Close
+	result.Close = func() {
+		stop()
+		closeStream()
+	}
+	return result, nil
+}
+
+func noWarm(config Server) Server {
+	config.Warm = 0
+	return config
+}
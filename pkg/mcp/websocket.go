@@ -0,0 +1,266 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+)
+
+// WebSocketSubprotocol is the subprotocol negotiated for MCP over WebSocket. Each WebSocket text message
+// is one JSON-RPC message.
+const WebSocketSubprotocol = "mcp"
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{WebSocketSubprotocol},
+}
+
+func isWebSocketUpgrade(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Upgrade"), "websocket")
+}
+
+// serveWebSocket handles a WebSocket connection for a session. If the request has a session ID the
+// existing session is resumed, otherwise a new session is created and its ID is returned in the
+// Mcp-Session-Id header of the upgrade response.
+func (h *HTTPServer) serveWebSocket(rw http.ResponseWriter, req *http.Request) {
+	id := h.sessions.ExtractID(req)
+	if id == "" {
+		id = req.URL.Query().Get("id")
+	}
+
+	var (
+		session *ServerSession
+		isNew   bool
+		err     error
+	)
+
+	if id != "" {
+		var ok bool
+		session, ok, err = h.sessions.Acquire(req.Context(), h.MessageHandler, id)
+		if err != nil {
+			http.Error(rw, "Failed to load session: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(rw, "Session not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		session, err = NewServerSession(h.ctx, h.MessageHandler)
+		if err != nil {
+			http.Error(rw, "Failed to create session: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		isNew = true
+	}
+	defer h.sessions.Release(session)
+
+	session.session.sessionManager = h.sessions
+	session.wire.setBus(h.bus)
+	session.session.AddEnv(h.getEnv(req))
+
+	conn, err := upgrader.Upgrade(rw, req, http.Header{
+		"Mcp-Session-Id": []string{session.ID()},
+	})
+	if err != nil {
+		// The upgrader already wrote the error response
+		if isNew {
+			session.Close(true)
+		}
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	var writeLock sync.Mutex
+	write := func(msg Message) error {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		return conn.WriteJSON(msg)
+	}
+
+	session.StartReading()
+	defer session.StopReading()
+	h.relay(ctx, session)
+
+	go func() {
+		defer cancel()
+		for {
+			msg, ok := session.Read(ctx)
+			if !ok {
+				return
+			}
+			if err := write(msg); err != nil {
+				log.Debugf(ctx, "failed to write websocket message: %v", err)
+				return
+			}
+		}
+	}()
+
+	initialized := !isNew
+	for {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && ctx.Err() == nil {
+				log.Debugf(ctx, "failed to read websocket message: %v", err)
+			}
+			break
+		}
+
+		if msg.Method == "initialize" && !initialized {
+			initialized = true
+			// Store the session once it is initialized so that it can be resumed.
+			resp, err := session.Exchange(ctx, msg)
+			if err == nil {
+				err = h.sessions.Store(ctx, session.ID(), session)
+			}
+			if err != nil {
+				resp = Message{
+					JSONRPC: msg.JSONRPC,
+					ID:      msg.ID,
+					Error:   ErrRPCInternal.WithMessage("%v", err),
+				}
+			}
+			if err := write(resp); err != nil {
+				break
+			}
+			continue
+		}
+
+		go func() {
+			resp, err := session.Exchange(ctx, msg)
+			if errors.Is(err, ErrNoResponse) {
+				return
+			} else if err != nil {
+				resp = Message{
+					JSONRPC: msg.JSONRPC,
+					ID:      msg.ID,
+					Error:   ErrRPCInternal.WithMessage("%v", err),
+				}
+			}
+			if err := write(resp); err != nil {
+				log.Debugf(ctx, "failed to write websocket message: %v", err)
+			}
+			_ = h.sessions.Store(ctx, session.ID(), session)
+		}()
+	}
+
+	if !initialized {
+		session.Close(true)
+	}
+}
+
+// WebSocketClient is a Wire that talks to an MCP server over a WebSocket connection.
+type WebSocketClient struct {
+	serverName string
+	url        string
+	headers    map[string]string
+	sessionID  string
+	transport  *http.Transport
+
+	conn      *websocket.Conn
+	writeLock sync.Mutex
+	waiter    *waiter
+}
+
+func newWebSocketClient(serverName, url string, headers map[string]string, httpTransport *http.Transport) *WebSocketClient {
+	return &WebSocketClient{
+		serverName: serverName,
+		url:        url,
+		headers:    headers,
+		transport:  httpTransport,
+		sessionID:  headers["Mcp-Session-Id"],
+		waiter:     newWaiter(),
+	}
+}
+
+func (w *WebSocketClient) Start(ctx context.Context, handler WireHandler) error {
+	header := http.Header{}
+	for k, v := range w.headers {
+		header.Set(k, v)
+	}
+
+	dialer := websocket.Dialer{
+		Subprotocols:    []string{WebSocketSubprotocol},
+		Proxy:           w.transport.Proxy,
+		TLSClientConfig: w.transport.TLSClientConfig,
+	}
+	conn, resp, err := dialer.DialContext(ctx, w.url, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("failed to connect to %s: %s: %w", w.url, resp.Status, err)
+		}
+		return fmt.Errorf("failed to connect to %s: %w", w.url, err)
+	}
+
+	w.conn = conn
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		w.sessionID = id
+	}
+
+	context.AfterFunc(ctx, func() {
+		w.Close(false)
+	})
+
+	go func() {
+		defer w.Close(false)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure) && ctx.Err() == nil {
+					log.Errorf(ctx, "websocket connection to %s closed: %v", w.serverName, err)
+				}
+				return
+			}
+			log.Messages(ctx, w.serverName, false, data)
+
+			var msg Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				log.Errorf(ctx, "failed to unmarshal message: %v", err)
+				continue
+			}
+			go handler(ctx, msg)
+		}
+	}()
+
+	return nil
+}
+
+func (w *WebSocketClient) Send(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	log.Messages(ctx, w.serverName, true, data)
+	return w.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (w *WebSocketClient) SessionID() string {
+	return w.sessionID
+}
+
+func (w *WebSocketClient) Wait() {
+	w.waiter.Wait()
+}
+
+func (w *WebSocketClient) Close(bool) {
+	if w.conn != nil {
+		w.writeLock.Lock()
+		_ = w.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		w.writeLock.Unlock()
+		_ = w.conn.Close()
+	}
+	w.waiter.Close()
+}
@@ -0,0 +1,161 @@
+package memory
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// databaseStore keeps the records in a table of a gorm database and searches them by computing the
+// similarity of every record of the namespace. It needs no extension of the database, which makes it a
+// good fit for the sqlite database of nanobot and namespaces with up to a few thousand records.
+type databaseStore struct {
+	db *gorm.DB
+}
+
+type memoryRecord struct {
+	ID        string `gorm:"primaryKey"`
+	Namespace string `gorm:"index"`
+	Text      string
+	Vector    []byte
+	CreatedAt time.Time
+}
+
+func (memoryRecord) TableName() string {
+	return "memories"
+}
+
+func newDatabaseStore(db *gorm.DB) (*databaseStore, error) {
+	if err := db.AutoMigrate(&memoryRecord{}); err != nil {
+		return nil, err
+	}
+	return &databaseStore{db: db}, nil
+}
+
+func (d *databaseStore) Add(ctx context.Context, records ...Record) error {
+	rows := make([]memoryRecord, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, memoryRecord{
+			ID:        record.ID,
+			Namespace: record.Namespace,
+			Text:      record.Text,
+			Vector:    encodeVector(record.Vector),
+			CreatedAt: record.Created,
+		})
+	}
+	return d.db.WithContext(ctx).Create(&rows).Error
+}
+
+func (d *databaseStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return d.db.WithContext(ctx).Where("id IN ?", ids).Delete(&memoryRecord{}).Error
+}
+
+func (d *databaseStore) Search(ctx context.Context, namespace string, vector []float32, k int, minScore float64) ([]Match, error) {
+	var rows []memoryRecord
+	if err := d.db.WithContext(ctx).Where("namespace = ?", namespace).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	matches := make([]Match, 0, len(rows))
+	for _, row := range rows {
+		score := Cosine(vector, decodeVector(row.Vector))
+		if score < minScore {
+			continue
+		}
+		matches = append(matches, Match{
+			Record: Record{
+				ID:        row.ID,
+				Namespace: row.Namespace,
+				Text:      row.Text,
+				Created:   row.CreatedAt,
+			},
+			Score: score,
+		})
+	}
+
+	slices.SortFunc(matches, func(a, b Match) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
+func encodeVector(vector []float32) []byte {
+	data := make([]byte, 0, len(vector)*4)
+	for _, v := range vector {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+	}
+	return data
+}
+
+func decodeVector(data []byte) []float32 {
+	vector := make([]float32, 0, len(data)/4)
+	for i := 0; i+4 <= len(data); i += 4 {
+		vector = append(vector, math.Float32frombits(binary.LittleEndian.Uint32(data[i:])))
+	}
+	return vector
+}
+
+// SessionRecords returns the memories scoped to the session that are kept in the database, which is the
+// default store.
+func SessionRecords(ctx context.Context, db *gorm.DB, sessionID string) ([]Record, error) {
+	if !db.Migrator().HasTable(&memoryRecord{}) {
+		return nil, nil
+	}
+
+	var rows []memoryRecord
+	if err := db.WithContext(ctx).Where("namespace LIKE ?", "%"+sessionNamespace+sessionID).Order("created_at").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(rows))
+	for _, row := range rows {
+		if !strings.HasSuffix(row.Namespace, sessionNamespace+sessionID) {
+			continue
+		}
+		records = append(records, Record{
+			ID:        row.ID,
+			Namespace: row.Namespace,
+			Text:      row.Text,
+			Vector:    decodeVector(row.Vector),
+			Created:   row.CreatedAt,
+		})
+	}
+	return records, nil
+}
+
+// AddSessionRecords adds the records to the memories of the session kept in the database. The namespace
+// of each record is moved to the session, keeping its agent, so that records can not be added to the
+// memories of other sessions or users.
+func AddSessionRecords(ctx context.Context, db *gorm.DB, sessionID string, records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	records = slices.Clone(records)
+	for i, record := range records {
+		agentName, _, _ := strings.Cut(record.Namespace, "/")
+		records[i].Namespace = agentName + sessionNamespace + sessionID
+	}
+	store, err := newDatabaseStore(db)
+	if err != nil {
+		return fmt.Errorf("failed to migrate memories table: %w", err)
+	}
+	return store.Add(ctx, records...)
+}
@@ -0,0 +1,197 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/gormdsn"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+// maxTextLength limits the remembered text of one part of a turn, longer texts are cut, so that they
+// stay within the input limit of embedding models.
+const maxTextLength = 4000
+
+type Options struct {
+	// DSN is the database of the default store.
+	DSN       string
+	DBOptions gormdsn.Options
+}
+
+func (o Options) Merge(other Options) (result Options) {
+	result.DSN = complete.Last(o.DSN, other.DSN)
+	result.DBOptions = o.DBOptions.Merge(other.DBOptions)
+	return
+}
+
+// Service remembers turns of agents with a memory config and recalls the ones relevant to a new turn.
+type Service struct {
+	embedder types.Embedder
+	opt      Options
+
+	lock   sync.Mutex
+	stores map[string]Store
+}
+
+func New(embedder types.Embedder, opts ...Options) *Service {
+	return &Service{
+		embedder: embedder,
+		opt:      complete.Complete(opts...),
+		stores:   map[string]Store{},
+	}
+}
+
+// Part is a part of a turn to remember, Kind is one of types.RememberUser, RememberAssistant, or RememberTools.
+type Part struct {
+	Kind string
+	Text string
+}
+
+// Embed returns the embeddings of the input with the model.
+func (s *Service) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	return s.embedder.Embed(ctx, model, input)
+}
+
+// Store returns the store with the name in memoryStores of the config, or the default store if the name is empty.
+func (s *Service) Store(config types.Config, name string) (Store, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if store, ok := s.stores[name]; ok {
+		return store, nil
+	}
+
+	store, err := newStore(config.MemoryStores[name], s.opt.DSN, s.opt.DBOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create memory store %q: %w", name, err)
+	}
+	s.stores[name] = store
+	return store, nil
+}
+
+// sessionNamespace separates the agent and the session ID in the namespace of memories scoped to a session.
+const sessionNamespace = "/session/"
+
+// namespace returns the namespace of the memories of the agent, according to the scope of its memory.
+// Memories of users without an ID are kept in the session, it returns false if there is no session either.
+func namespace(ctx context.Context, agentName string, memory types.Memory) (string, bool) {
+	switch memory.GetScope() {
+	case types.MemoryScopeAgent:
+		return agentName, true
+	case types.MemoryScopeUser:
+		if userID := types.NanobotContext(ctx).User.ID; userID != "" {
+			return agentName + "/user/" + userID, true
+		}
+	}
+
+	session := mcp.SessionFromContext(ctx).Root()
+	if session == nil || session.ID() == "" {
+		return "", false
+	}
+	return agentName + sessionNamespace + session.ID(), true
+}
+
+// Recall returns the memories of the agent most relevant to the query, formatted to be added to the system
+// prompt. It returns an empty string if the agent has no memory or nothing relevant is remembered.
+func (s *Service) Recall(ctx context.Context, config types.Config, agentName, query string) (string, error) {
+	memory := config.Agents[agentName].Memory
+	if memory == nil || strings.TrimSpace(query) == "" {
+		return "", nil
+	}
+
+	ns, ok := namespace(ctx, agentName, *memory)
+	if !ok {
+		return "", nil
+	}
+
+	store, err := s.Store(config, memory.Store)
+	if err != nil {
+		return "", err
+	}
+
+	vectors, err := s.embedder.Embed(ctx, memory.GetEmbeddingModel(), []string{truncate(query)})
+	if err != nil {
+		return "", fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	matches, err := store.Search(ctx, ns, vectors[0], memory.GetTopK(), memory.MinScore)
+	if err != nil {
+		return "", fmt.Errorf("failed to search memories: %w", err)
+	}
+	if len(matches) == 0 {
+		return "", nil
+	}
+
+	var buf strings.Builder
+	buf.WriteString("Memories from previous conversations that may be relevant, most relevant first:\n")
+	for _, match := range matches {
+		buf.WriteString("\n- ")
+		buf.WriteString(match.Created.Format(time.DateOnly))
+		buf.WriteString(" ")
+		buf.WriteString(strings.ReplaceAll(match.Text, "\n", "\n  "))
+	}
+	return buf.String(), nil
+}
+
+// Remember stores the parts of a turn of the agent that its memory config selects.
+func (s *Service) Remember(ctx context.Context, config types.Config, agentName string, parts []Part) error {
+	memory := config.Agents[agentName].Memory
+	if memory == nil {
+		return nil
+	}
+
+	var texts []string
+	for _, part := range parts {
+		text := strings.TrimSpace(part.Text)
+		if text == "" || !memory.Remembers(part.Kind) {
+			continue
+		}
+		texts = append(texts, truncate(part.Kind+": "+text))
+	}
+	ns, ok := namespace(ctx, agentName, *memory)
+	if len(texts) == 0 || !ok {
+		return nil
+	}
+
+	store, err := s.Store(config, memory.Store)
+	if err != nil {
+		return err
+	}
+
+	vectors, err := s.embedder.Embed(ctx, memory.GetEmbeddingModel(), texts)
+	if err != nil {
+		return fmt.Errorf("failed to embed memories: %w", err)
+	}
+
+	var (
+		now     = time.Now()
+		records = make([]Record, 0, len(texts))
+	)
+	for i, text := range texts {
+		records = append(records, Record{
+			ID:        uuid.String(),
+			Namespace: ns,
+			Text:      text,
+			Vector:    vectors[i],
+			Created:   now,
+		})
+	}
+
+	if err := store.Add(ctx, records...); err != nil {
+		return fmt.Errorf("failed to store memories: %w", err)
+	}
+	return nil
+}
+
+func truncate(text string) string {
+	if len(text) <= maxTextLength {
+		return text
+	}
+	return strings.ToValidUTF8(text[:maxTextLength], "")
+}
@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func TestNamespace(t *testing.T) {
+	serverSession, err := mcp.NewExistingServerSession(context.Background(), mcp.SessionState{ID: "s1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionCtx := mcp.WithSession(context.Background(), serverSession.GetSession())
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		scope     string
+		namespace string
+		ok        bool
+	}{
+		{name: "user", ctx: types.WithNanobotContext(sessionCtx, types.Context{User: types.User{ID: "alice"}}), namespace: "agent/user/alice", ok: true},
+		{name: "anonymous user", ctx: sessionCtx, namespace: "agent/session/s1", ok: true},
+		{name: "anonymous user without session", ctx: context.Background()},
+		{name: "agent", ctx: context.Background(), scope: types.MemoryScopeAgent, namespace: "agent", ok: true},
+		{name: "session", ctx: types.WithNanobotContext(sessionCtx, types.Context{User: types.User{ID: "alice"}}), scope: types.MemoryScopeSession, namespace: "agent/session/s1", ok: true},
+		{name: "without session", ctx: types.WithNanobotContext(context.Background(), types.Context{User: types.User{ID: "alice"}}), scope: types.MemoryScopeSession},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace, ok := namespace(tt.ctx, "agent", types.Memory{Scope: tt.scope})
+			if namespace != tt.namespace || ok != tt.ok {
+				t.Errorf("expected %q, %v, got %q, %v", tt.namespace, tt.ok, namespace, ok)
+			}
+		})
+	}
+}
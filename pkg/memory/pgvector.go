@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// pgvectorStore keeps the records in a postgres table with a vector column of the pgvector extension,
+// which computes the similarity in the database.
+type pgvectorStore struct {
+	db *gorm.DB
+}
+
+func newPGVectorStore(db *gorm.DB) (*pgvectorStore, error) {
+	for _, stmt := range []string{
+		`CREATE EXTENSION IF NOT EXISTS vector`,
+		`CREATE TABLE IF NOT EXISTS memory_vectors (
+			id text PRIMARY KEY,
+			namespace text NOT NULL,
+			text text NOT NULL,
+			embedding vector NOT NULL,
+			created_at timestamptz NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_memory_vectors_namespace ON memory_vectors (namespace)`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			return nil, fmt.Errorf("failed to initialize pgvector memory store: %w", err)
+		}
+	}
+	return &pgvectorStore{db: db}, nil
+}
+
+func (p *pgvectorStore) Add(ctx context.Context, records ...Record) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, record := range records {
+			err := tx.Exec(`INSERT INTO memory_vectors (id, namespace, text, embedding, created_at) VALUES (?, ?, ?, ?::vector, ?)`,
+				record.ID, record.Namespace, record.Text, vectorLiteral(record.Vector), record.Created).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *pgvectorStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return p.db.WithContext(ctx).Exec(`DELETE FROM memory_vectors WHERE id IN ?`, ids).Error
+}
+
+func (p *pgvectorStore) Search(ctx context.Context, namespace string, vector []float32, k int, minScore float64) ([]Match, error) {
+	var rows []struct {
+		ID        string
+		Namespace string
+		Text      string
+		CreatedAt time.Time
+		Score     float64
+	}
+	literal := vectorLiteral(vector)
+	err := p.db.WithContext(ctx).Raw(`SELECT id, namespace, text, created_at, 1 - (embedding <=> ?::vector) AS score
+		FROM memory_vectors
+		WHERE namespace = ? AND 1 - (embedding <=> ?::vector) >= ?
+		ORDER BY embedding <=> ?::vector
+		LIMIT ?`, literal, namespace, literal, minScore, literal, k).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]Match, 0, len(rows))
+	for _, row := range rows {
+		matches = append(matches, Match{
+			Record: Record{
+				ID:        row.ID,
+				Namespace: row.Namespace,
+				Text:      row.Text,
+				Created:   row.CreatedAt,
+			},
+			Score: row.Score,
+		})
+	}
+	return matches, nil
+}
+
+// vectorLiteral formats the vector in the text format of pgvector, for example "[1,2.5,3]".
+func vectorLiteral(vector []float32) string {
+	var buf strings.Builder
+	buf.WriteByte('[')
+	for i, v := range vector {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	}
+	buf.WriteByte(']')
+	return buf.String()
+}
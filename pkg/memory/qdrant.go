@@ -0,0 +1,203 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const defaultQdrantCollection = "nanobot_memories"
+
+// qdrantStore keeps the records as points of a Qdrant collection, which is created with the size of the
+// first vector that is added.
+type qdrantStore struct {
+	url        string
+	apiKey     string
+	collection string
+
+	lock    sync.Mutex
+	created bool
+}
+
+func newQdrantStore(cfg types.MemoryStore) *qdrantStore {
+	collection := cfg.Collection
+	if collection == "" {
+		collection = defaultQdrantCollection
+	}
+	return &qdrantStore{
+		url:        strings.TrimSuffix(cfg.URL, "/"),
+		apiKey:     cfg.APIKey,
+		collection: collection,
+	}
+}
+
+type qdrantPayload struct {
+	Namespace string    `json:"namespace"`
+	Text      string    `json:"text"`
+	Created   time.Time `json:"created"`
+}
+
+type qdrantPoint struct {
+	ID      string        `json:"id"`
+	Vector  []float32     `json:"vector"`
+	Payload qdrantPayload `json:"payload"`
+}
+
+type qdrantScoredPoint struct {
+	ID      string        `json:"id"`
+	Score   float64       `json:"score"`
+	Payload qdrantPayload `json:"payload"`
+}
+
+func (q *qdrantStore) do(ctx context.Context, method, path string, body, out any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, q.url+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if q.apiKey != "" {
+		req.Header.Set("api-key", q.apiKey)
+	}
+
+	resp, err := transport.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, fmt.Errorf("qdrant %s %s failed: %s %q", method, path, resp.Status, string(data))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode qdrant response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func (q *qdrantStore) ensureCollection(ctx context.Context, size int) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.created {
+		return nil
+	}
+
+	path := "/collections/" + url.PathEscape(q.collection)
+	status, err := q.do(ctx, http.MethodGet, path, nil, nil)
+	if status == http.StatusNotFound {
+		_, err = q.do(ctx, http.MethodPut, path, map[string]any{
+			"vectors": map[string]any{
+				"size":     size,
+				"distance": "Cosine",
+			},
+		}, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create qdrant collection %s: %w", q.collection, err)
+	}
+
+	q.created = true
+	return nil
+}
+
+func (q *qdrantStore) Add(ctx context.Context, records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := q.ensureCollection(ctx, len(records[0].Vector)); err != nil {
+		return err
+	}
+
+	points := make([]qdrantPoint, 0, len(records))
+	for _, record := range records {
+		points = append(points, qdrantPoint{
+			ID:     record.ID,
+			Vector: record.Vector,
+			Payload: qdrantPayload{
+				Namespace: record.Namespace,
+				Text:      record.Text,
+				Created:   record.Created,
+			},
+		})
+	}
+
+	_, err := q.do(ctx, http.MethodPut, "/collections/"+url.PathEscape(q.collection)+"/points?wait=true", map[string]any{
+		"points": points,
+	}, nil)
+	return err
+}
+
+func (q *qdrantStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	status, err := q.do(ctx, http.MethodPost, "/collections/"+url.PathEscape(q.collection)+"/points/delete?wait=true", map[string]any{
+		"points": ids,
+	}, nil)
+	if status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (q *qdrantStore) Search(ctx context.Context, namespace string, vector []float32, k int, minScore float64) ([]Match, error) {
+	var resp struct {
+		Result []qdrantScoredPoint `json:"result"`
+	}
+	status, err := q.do(ctx, http.MethodPost, "/collections/"+url.PathEscape(q.collection)+"/points/search", map[string]any{
+		"vector":          vector,
+		"limit":           k,
+		"with_payload":    true,
+		"score_threshold": minScore,
+		"filter": map[string]any{
+			"must": []any{
+				map[string]any{
+					"key":   "namespace",
+					"match": map[string]any{"value": namespace},
+				},
+			},
+		},
+	}, &resp)
+	if status == http.StatusNotFound {
+		// Nothing was remembered yet
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	matches := make([]Match, 0, len(resp.Result))
+	for _, point := range resp.Result {
+		matches = append(matches, Match{
+			Record: Record{
+				ID:        point.ID,
+				Namespace: point.Payload.Namespace,
+				Text:      point.Payload.Text,
+				Created:   point.Payload.Created,
+			},
+			Score: point.Score,
+		})
+	}
+	return matches, nil
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/gormdsn"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// Record is a remembered text and its embedding.
+type Record struct {
+	ID string `json:"id"`
+	// Namespace separates the memories of agents, users, and sessions, see the scope of types.Memory.
+	Namespace string    `json:"namespace"`
+	Text      string    `json:"text"`
+	Vector    []float32 `json:"vector,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// Match is a record found by Search with its cosine similarity to the query.
+type Match struct {
+	Record
+	Score float64
+}
+
+// Store is a vector store of records.
+type Store interface {
+	Add(ctx context.Context, records ...Record) error
+	// Search returns at most k records of the namespace with a score of at least minScore, from the
+	// most to the least similar.
+	Search(ctx context.Context, namespace string, vector []float32, k int, minScore float64) ([]Match, error)
+	Delete(ctx context.Context, ids ...string) error
+}
+
+func newStore(cfg types.MemoryStore, dsn string, dbOptions gormdsn.Options) (Store, error) {
+	switch cfg.Type {
+	case "", "database":
+		if cfg.DSN != "" {
+			dsn = cfg.DSN
+		}
+		if dsn == "" {
+			return nil, fmt.Errorf("memory store of type database requires a dsn")
+		}
+		db, err := gormdsn.NewDBFromDSN(dsn, dbOptions)
+		if err != nil {
+			return nil, err
+		}
+		return newDatabaseStore(db)
+	case "pgvector":
+		db, err := gormdsn.NewDBFromDSN(cfg.DSN, dbOptions)
+		if err != nil {
+			return nil, err
+		}
+		return newPGVectorStore(db)
+	case "qdrant":
+		return newQdrantStore(cfg), nil
+	default:
+		return nil, fmt.Errorf("unsupported memory store type %q", cfg.Type)
+	}
+}
+
+// Cosine returns the cosine similarity of the vectors, zero if their lengths differ.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	llmDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "nanobot",
+		Name:      "llm_request_duration_seconds",
+		Help:      "Latency of LLM completion requests.",
+		Buckets:   []float64{0.25, 0.5, 1, 2.5, 5, 10, 20, 40, 80, 160},
+	}, []string{"model"})
+
+	toolDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "nanobot",
+		Name:      "tool_call_duration_seconds",
+		Help:      "Latency of tool calls.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"server", "tool"})
+
+	tokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nanobot",
+		Name:      "tokens_total",
+		Help:      "Tokens used by LLM completions.",
+	}, []string{"model", "type"})
+
+	responseCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nanobot",
+		Name:      "llm_response_cache_total",
+		Help:      "Lookups of cached LLM completions by result, hit or miss.",
+	}, []string{"agent", "result"})
+
+	errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nanobot",
+		Name:      "errors_total",
+		Help:      "Errors by type.",
+	}, []string{"type"})
+)
+
+// Error types used for the errors_total counter.
+const (
+	ErrorLLM           = "llm"
+	ErrorTool          = "tool"
+	ErrorToolResult    = "tool_result"
+	ErrorLimitExceeded = "limit_exceeded"
+	ErrorCanceled      = "canceled"
+)
+
+// Handler returns the handler serving the metrics in the Prometheus text format. activeSessions, if
+// not nil, is called on every scrape to report the number of active sessions.
+func Handler(activeSessions func() int) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		llmDuration,
+		toolDuration,
+		tokens,
+		responseCache,
+		errorsTotal,
+	)
+	if activeSessions != nil {
+		registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "nanobot",
+			Name:      "active_sessions",
+			Help:      "Sessions currently loaded in memory.",
+		}, func() float64 {
+			return float64(activeSessions())
+		}))
+	}
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveCompletion records the latency, token usage and error of an LLM completion.
+func ObserveCompletion(model string, start time.Time, resp *types.CompletionResponse, err error) {
+	llmDuration.WithLabelValues(model).Observe(time.Since(start).Seconds())
+	if resp != nil && resp.Usage != nil {
+		tokens.WithLabelValues(model, "input").Add(float64(resp.Usage.InputTokens))
+		tokens.WithLabelValues(model, "output").Add(float64(resp.Usage.OutputTokens))
+	}
+	if err != nil {
+		Error(ErrorLLM, err)
+	}
+}
+
+// ObserveResponseCache records whether a completion of the agent was returned from the response cache.
+func ObserveResponseCache(agent string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	responseCache.WithLabelValues(agent, result).Inc()
+}
+
+// ObserveToolCall records the latency and error of a tool call.
+func ObserveToolCall(server, tool string, start time.Time, ret *types.CallResult, err error) {
+	toolDuration.WithLabelValues(server, tool).Observe(time.Since(start).Seconds())
+	if err != nil {
+		Error(ErrorTool, err)
+	} else if ret != nil && ret.IsError {
+		errorsTotal.WithLabelValues(ErrorToolResult).Inc()
+	}
+}
+
+// Error counts err under errType, unless it is a more specific error like a cancellation or an exceeded limit.
+func Error(errType string, err error) {
+	var limitErr *types.LimitExceededError
+	switch {
+	case errors.Is(err, context.Canceled):
+		errType = ErrorCanceled
+	case errors.As(err, &limitErr):
+		errType = ErrorLimitExceeded
+	}
+	errorsTotal.WithLabelValues(errType).Inc()
+}
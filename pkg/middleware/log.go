@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func init() {
+	Register("log", func(map[string]any) (Middleware, error) {
+		return logger{}, nil
+	})
+}
+
+// logger logs the completions and tool calls of agents.
+type logger struct {
+	Base
+}
+
+func (logger) BeforeCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	log.Infof(ctx, "agent %s: completion with model %s, %d messages and %d tools", req.Agent, req.Model, len(req.Input), len(req.Tools))
+	return nil, nil
+}
+
+func (logger) BeforeToolCall(ctx context.Context, call *ToolCall) (*types.CallResult, error) {
+	log.Infof(ctx, "agent %s: calling tool %s (%s/%s) with %s", call.Agent, call.Name, call.Server, call.Tool, call.Arguments)
+	return nil, nil
+}
+
+func (logger) AfterCompletion(ctx context.Context, req types.CompletionRequest, resp *types.CompletionResponse) error {
+	log.Infof(ctx, "agent %s: response with %d items and %d tokens", req.Agent, len(resp.Output.Items), resp.Usage.TotalTokens())
+	return nil
+}
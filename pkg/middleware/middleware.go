@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// Middleware runs on every turn of an agent. Embed Base to implement only some of the methods.
+type Middleware interface {
+	// BeforeCompletion runs before the request is sent to the LLM and may modify it, changes to the input
+	// are kept in the thread. Returning a response skips the LLM and the rest of the chain.
+	BeforeCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error)
+	// BeforeToolCall runs before a tool call of the LLM is dispatched and may modify its arguments.
+	// Returning a result skips the call and the rest of the chain, the result is given to the LLM.
+	BeforeToolCall(ctx context.Context, call *ToolCall) (*types.CallResult, error)
+	// AfterCompletion runs on the response of the LLM and may modify it.
+	AfterCompletion(ctx context.Context, req types.CompletionRequest, resp *types.CompletionResponse) error
+}
+
+type ToolCall struct {
+	types.ToolCall
+	// Agent is the agent that made the call.
+	Agent string
+	// Server and Tool are the target of the call, an MCP server, agent, or flow and its tool.
+	Server string
+	Tool   string
+}
+
+// Base implements Middleware without changing anything.
+type Base struct{}
+
+func (Base) BeforeCompletion(context.Context, *types.CompletionRequest) (*types.CompletionResponse, error) {
+	return nil, nil
+}
+
+func (Base) BeforeToolCall(context.Context, *ToolCall) (*types.CallResult, error) {
+	return nil, nil
+}
+
+func (Base) AfterCompletion(context.Context, types.CompletionRequest, *types.CompletionResponse) error {
+	return nil
+}
+
+// Factory returns the middleware for the config given in the nanobot config.
+type Factory func(config map[string]any) (Middleware, error)
+
+var (
+	lock      sync.Mutex
+	factories = map[string]Factory{}
+	instances = map[string]Middleware{}
+)
+
+// Register makes a middleware available to the config by name. It is meant to be called from init and
+// panics if the name is already registered.
+func Register(name string, factory Factory) {
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("middleware %s is already registered", name))
+	}
+	factories[name] = factory
+}
+
+// Load returns the chain of the middleware of the config. Middleware with the same name and config is
+// only created once.
+func Load(refs []types.Middleware) (Chain, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	var chain Chain
+	for _, ref := range refs {
+		config, err := json.Marshal(ref.Config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal config of middleware %s: %w", ref.Name, err)
+		}
+
+		key := ref.Name + "/" + string(config)
+		if m, ok := instances[key]; ok {
+			chain = append(chain, m)
+			continue
+		}
+
+		factory, ok := factories[ref.Name]
+		if !ok {
+			return nil, fmt.Errorf("middleware %s is not registered", ref.Name)
+		}
+		m, err := factory(ref.Config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create middleware %s: %w", ref.Name, err)
+		}
+		instances[key] = m
+		chain = append(chain, m)
+	}
+	return chain, nil
+}
+
+// Chain runs middleware in order before the completion and tool calls, and in reverse order after the
+// completion.
+type Chain []Middleware
+
+func (c Chain) BeforeCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	for _, m := range c {
+		if resp, err := m.BeforeCompletion(ctx, req); err != nil || resp != nil {
+			return resp, err
+		}
+	}
+	return nil, nil
+}
+
+func (c Chain) BeforeToolCall(ctx context.Context, call *ToolCall) (*types.CallResult, error) {
+	for _, m := range c {
+		if result, err := m.BeforeToolCall(ctx, call); err != nil || result != nil {
+			return result, err
+		}
+	}
+	return nil, nil
+}
+
+func (c Chain) AfterCompletion(ctx context.Context, req types.CompletionRequest, resp *types.CompletionResponse) error {
+	for _, m := range slices.Backward(c) {
+		if err := m.AfterCompletion(ctx, req, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
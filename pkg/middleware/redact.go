@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// Detectors of the redact middleware. A named group "value" limits the redaction to that part of the
+// match.
+var detectors = map[string][]*regexp.Regexp{
+	"secrets": {
+		regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+		regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+		regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+		regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`),
+		regexp.MustCompile(`\b[rs]k_(?:live|test)_[0-9A-Za-z]{16,}\b`),
+		regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+		regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`),
+		regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+		regexp.MustCompile(`(?i)\bbearer\s+(?P<value>[A-Za-z0-9._~+/-]{20,}=*)`),
+		regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret|token|password|passwd)["']?\s*[:=]\s*["']?(?P<value>[^\s"',;]{8,})`),
+	},
+	"emails": {
+		regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+	},
+	"phones": {
+		regexp.MustCompile(`\+\d{1,3}[\s.-]?\(?\d{1,4}\)?(?:[\s.-]?\d{2,4}){2,3}\b`),
+		regexp.MustCompile(`(?:\(\d{3}\)\s?|\b\d{3}[\s.-])\d{3}[\s.-]\d{4}\b`),
+	},
+}
+
+func init() {
+	Register("redact", newRedactor)
+}
+
+type redactConfig struct {
+	// Detect are the built-in detectors to use, secrets, emails, and phones. Defaults to all of them.
+	Detect []string `json:"detect,omitempty"`
+	// Patterns are custom regular expressions by name, the name is used in the replacement text.
+	Patterns map[string]string `json:"patterns,omitempty"`
+	// Allow are regular expressions of matches that are not redacted.
+	Allow []string `json:"allow,omitempty"`
+}
+
+type rule struct {
+	name   string
+	regexp *regexp.Regexp
+}
+
+// redactor replaces secrets, emails, and phone numbers in the messages and tool results sent to the
+// LLM with a placeholder.
+type redactor struct {
+	Base
+	rules []rule
+	allow []*regexp.Regexp
+}
+
+func newRedactor(config map[string]any) (Middleware, error) {
+	var cfg redactConfig
+	if err := mcp.JSONCoerce(config, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	detect := cfg.Detect
+	if len(detect) == 0 {
+		detect = slices.Sorted(maps.Keys(detectors))
+	}
+	return buildRedactor(detect, cfg.Patterns, cfg.Allow)
+}
+
+// TextRedactor returns a function that replaces the matches of the detectors and of the patterns, by
+// name, in text like the redact middleware does in the messages sent to the LLM.
+func TextRedactor(detect []string, patterns map[string]string) (func(string) string, error) {
+	r, err := buildRedactor(detect, patterns, nil)
+	if err != nil {
+		return nil, err
+	}
+	return func(text string) string {
+		text, _ = r.redact(text)
+		return text
+	}, nil
+}
+
+func buildRedactor(detect []string, patterns map[string]string, allowPatterns []string) (*redactor, error) {
+	r := &redactor{}
+	for _, name := range detect {
+		regexps, ok := detectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown detector %q, must be one of secrets, emails, or phones", name)
+		}
+		for _, re := range regexps {
+			// The replacement of emails is "[REDACTED email]"
+			r.rules = append(r.rules, rule{name: strings.TrimSuffix(name, "s"), regexp: re})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(patterns)) {
+		re, err := regexp.Compile(patterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", name, err)
+		}
+		r.rules = append(r.rules, rule{name: name, regexp: re})
+	}
+
+	for _, allow := range allowPatterns {
+		re, err := regexp.Compile("^(?:" + allow + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow pattern %q: %w", allow, err)
+		}
+		r.allow = append(r.allow, re)
+	}
+
+	return r, nil
+}
+
+func (r *redactor) BeforeCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	var count int
+	input := make([]types.Message, len(req.Input))
+	for i, msg := range req.Input {
+		// Copy the items so the messages of the caller are not changed
+		msg.Items = slices.Clone(msg.Items)
+		for j, item := range msg.Items {
+			if item.Content != nil {
+				content, n := r.redactContent(*item.Content)
+				if n > 0 {
+					item.Content = &content
+					count += n
+				}
+			}
+			if item.ToolCallResult != nil {
+				result := *item.ToolCallResult
+				result.Output.Content = slices.Clone(result.Output.Content)
+				var changed bool
+				for k, content := range result.Output.Content {
+					var n int
+					result.Output.Content[k], n = r.redactContent(content)
+					changed = changed || n > 0
+					count += n
+				}
+				if changed {
+					item.ToolCallResult = &result
+				}
+			}
+			msg.Items[j] = item
+		}
+		input[i] = msg
+	}
+	req.Input = input
+
+	if count > 0 {
+		log.Debugf(ctx, "redacted %d values in the request of agent %s", count, req.Agent)
+	}
+	return nil, nil
+}
+
+func (r *redactor) redactContent(content mcp.Content) (mcp.Content, int) {
+	var count, n int
+	content.Text, n = r.redact(content.Text)
+	count += n
+	if content.Resource != nil && content.Resource.Text != "" {
+		resource := *content.Resource
+		resource.Text, n = r.redact(resource.Text)
+		if n > 0 {
+			content.Resource = &resource
+			count += n
+		}
+	}
+	return content, count
+}
+
+// redact returns the text with the matches of the rules replaced, and the number of replacements.
+func (r *redactor) redact(text string) (string, int) {
+	if text == "" {
+		return text, 0
+	}
+
+	var count int
+	for _, rule := range r.rules {
+		value := rule.regexp.SubexpIndex("value")
+		matches := rule.regexp.FindAllStringSubmatchIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		var (
+			result []byte
+			last   int
+		)
+		for _, match := range matches {
+			start, end := match[0], match[1]
+			if value > 0 && match[2*value] >= 0 {
+				start, end = match[2*value], match[2*value+1]
+			}
+			if r.allowed(text[start:end]) {
+				continue
+			}
+			result = append(result, text[last:start]...)
+			result = append(result, "[REDACTED "+rule.name+"]"...)
+			last = end
+			count++
+		}
+		text = string(append(result, text[last:]...))
+	}
+	return text, count
+}
+
+func (r *redactor) allowed(value string) bool {
+	for _, allow := range r.allow {
+		if allow.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package nanobot
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/config"
+	"github.com/nanobot-ai/nanobot/pkg/events"
+	"github.com/nanobot-ai/nanobot/pkg/llm"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/middleware"
+	"github.com/nanobot-ai/nanobot/pkg/runtime"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/usage"
+)
+
+// DefaultModel is the model of agents without one if Options.LLM has no default model, as for the CLI.
+const DefaultModel = "gpt-4.1"
+
+// Options configure a Client.
+type Options struct {
+	// LLM configures the providers. Unset API keys and base URLs default to the variables of Env the CLI
+	// reads them from, such as OPENAI_API_KEY and ANTHROPIC_API_KEY.
+	LLM *llm.Config
+	// Env is the environment the config is expanded with, it defaults to the environment of the process.
+	Env map[string]string
+	// Profiles are the profiles of the config to apply.
+	Profiles []string
+	// DSN is the database sessions, OAuth tokens, memories, and the wire log are stored in. Without one
+	// nothing is stored.
+	DSN            string
+	MaxConcurrency int
+	// Roots are the roots MCP servers are given.
+	Roots []mcp.Root
+	// Middleware runs on every turn of all agents, before the middleware of the config.
+	Middleware []middleware.Middleware
+}
+
+func (o Options) Merge(other Options) (result Options) {
+	result.LLM = complete.Last(o.LLM, other.LLM)
+	result.Env = complete.MergeMap(o.Env, other.Env)
+	result.Profiles = append(o.Profiles, other.Profiles...)
+	result.DSN = complete.Last(o.DSN, other.DSN)
+	result.MaxConcurrency = complete.Last(o.MaxConcurrency, other.MaxConcurrency)
+	result.Roots = append(o.Roots, other.Roots...)
+	result.Middleware = append(o.Middleware, other.Middleware...)
+	return
+}
+
+func (o Options) Complete() Options {
+	if o.Env == nil {
+		o.Env = map[string]string{}
+		for _, kv := range os.Environ() {
+			k, v, _ := strings.Cut(kv, "=")
+			o.Env[k] = v
+		}
+	}
+	var cfg llm.Config
+	if o.LLM != nil {
+		cfg = *o.LLM
+	}
+	cfg.DefaultModel = complete.First(cfg.DefaultModel, o.Env["NANOBOT_DEFAULT_MODEL"], DefaultModel)
+	cfg.Responses.APIKey = complete.First(cfg.Responses.APIKey, o.Env["OPENAI_API_KEY"])
+	cfg.Responses.BaseURL = complete.First(cfg.Responses.BaseURL, o.Env["OPENAI_BASE_URL"])
+	cfg.Anthropic.APIKey = complete.First(cfg.Anthropic.APIKey, o.Env["ANTHROPIC_API_KEY"])
+	cfg.Anthropic.BaseURL = complete.First(cfg.Anthropic.BaseURL, o.Env["ANTHROPIC_BASE_URL"])
+	cfg.Gemini.APIKey = complete.First(cfg.Gemini.APIKey, o.Env["GEMINI_API_KEY"])
+	cfg.Gemini.BaseURL = complete.First(cfg.Gemini.BaseURL, o.Env["GEMINI_BASE_URL"])
+	cfg.Ollama.BaseURL = complete.First(cfg.Ollama.BaseURL, o.Env["OLLAMA_BASE_URL"], "http://localhost:11434")
+	o.LLM = &cfg
+	return o
+}
+
+// Client runs the agents of a config in the process, as nanobot call does. It is safe for concurrent use.
+type Client struct {
+	config  *types.Config
+	env     map[string]string
+	runtime *runtime.Runtime
+}
+
+// New returns a client of the config. The config is completed and validated as if it was loaded from a
+// file, except that it can not have local sources.
+func New(cfg types.Config, opts ...Options) (*Client, error) {
+	opt := complete.Complete(opts...)
+	loaded, _, err := config.LoadFromConfig(context.Background(), cfg, opt.Profiles...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return newClient(loaded, opt)
+}
+
+// Load returns a client of the config at path, which is anything nanobot run accepts: a file, a
+// directory, or a remote config.
+func Load(ctx context.Context, path string, opts ...Options) (*Client, error) {
+	opt := complete.Complete(opts...)
+	loaded, _, err := config.Load(ctx, path, opt.Profiles...)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(loaded, opt)
+}
+
+func newClient(cfg *types.Config, opt Options) (*Client, error) {
+	r, err := runtime.NewRuntime(*opt.LLM, runtime.Options{
+		Roots:          opt.Roots,
+		MaxConcurrency: opt.MaxConcurrency,
+		DSN:            opt.DSN,
+		Middleware:     opt.Middleware,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		config:  cfg,
+		env:     opt.Env,
+		runtime: r,
+	}, nil
+}
+
+// Config returns the loaded config of the client.
+func (c *Client) Config() types.Config {
+	return *c.config
+}
+
+// Run runs the agent with the input in a new session that is closed when the run is done.
+func (c *Client) Run(ctx context.Context, agent, input string, opts ...RunOptions) (*Result, error) {
+	session := c.NewSession(ctx)
+	defer session.Close()
+	return session.Run(ctx, agent, input, opts...)
+}
+
+// SessionOptions configure a Session.
+type SessionOptions struct {
+	// Env is added to the environment of the client for the session.
+	Env map[string]string
+	// OnElicit answers the elicitations of MCP servers and the confirmations of tool calls. By default
+	// they are answered from the elicitation section of the config, or declined.
+	OnElicit mcp.ElicitHandler
+}
+
+func (s SessionOptions) Merge(other SessionOptions) (result SessionOptions) {
+	result.Env = complete.MergeMap(s.Env, other.Env)
+	result.OnElicit = s.OnElicit
+	if other.OnElicit != nil {
+		result.OnElicit = other.OnElicit
+	}
+	return
+}
+
+// Session is a conversation, each run of an agent continues the previous run of the agent in the session.
+// Runs of a session are run one at a time.
+type Session struct {
+	client  *Client
+	session *mcp.Session
+	lock    sync.Mutex
+}
+
+// NewSession returns a new session that is not stored. It is closed with Close or when ctx is done.
+func (c *Client) NewSession(ctx context.Context, opts ...SessionOptions) *Session {
+	opt := complete.Complete(opts...)
+	env := maps.Clone(c.env)
+	if env == nil {
+		env = map[string]string{}
+	}
+	maps.Copy(env, opt.Env)
+
+	ctx = runtime.WithTempSession(ctx, c.config, env)
+	session := mcp.SessionFromContext(ctx)
+	if opt.OnElicit != nil {
+		session.SetElicitHandler(opt.OnElicit)
+	}
+	return &Session{
+		client:  c,
+		session: session,
+	}
+}
+
+// Close closes the MCP servers the session started.
+func (s *Session) Close() {
+	s.session.Close(false)
+}
+
+// Usage returns the token usage and cost of the runs of the session, or nil if it has none.
+func (s *Session) Usage() *usage.Totals {
+	return usage.SessionTotals(s.session)
+}
+
+// RunOptions configure a run of an agent.
+type RunOptions struct {
+	// Attachments are sent with the input, by URL or as data URLs.
+	Attachments []types.Attachment
+	// OnEvent is called with the events of the run as they happen: provider requests and responses,
+	// retries, fallbacks, tool calls and their results, and guardrail decisions. The run waits for it.
+	OnEvent func(events.Event)
+	// DryRun returns the tool calls the agent plans to make instead of running them.
+	DryRun bool
+}
+
+func (r RunOptions) Merge(other RunOptions) (result RunOptions) {
+	result.Attachments = append(r.Attachments, other.Attachments...)
+	result.OnEvent = r.OnEvent
+	if other.OnEvent != nil {
+		result.OnEvent = other.OnEvent
+	}
+	result.DryRun = r.DryRun || other.DryRun
+	return
+}
+
+// Result is the final response of an agent.
+type Result struct {
+	// Output is the text of the response.
+	Output string `json:"output"`
+	// Content is the content of the response that is not text, such as images.
+	Content []mcp.Content `json:"content,omitempty"`
+	// StructuredContent is the JSON of the response of agents with an output schema.
+	StructuredContent any  `json:"structuredContent,omitempty"`
+	IsError           bool `json:"isError,omitempty"`
+}
+
+// Run runs the agent with the input. The run is canceled when ctx is done or the session is closed.
+func (s *Session) Run(ctx context.Context, agent, input string, opts ...RunOptions) (*Result, error) {
+	opt := complete.Complete(opts...)
+	if _, ok := s.client.config.Agents[agent]; !ok {
+		return nil, fmt.Errorf("agent %q not found in config", agent)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ctx, cancel := context.WithCancel(mcp.WithSession(ctx, s.session))
+	defer cancel()
+	stop := context.AfterFunc(s.session.Context(), cancel)
+	defer stop()
+
+	if opt.OnEvent != nil {
+		defer events.Watch(s.session, opt.OnEvent)()
+	}
+	if opt.DryRun {
+		nctx := types.NanobotContext(ctx)
+		nctx.DryRun = true
+		ctx = types.WithNanobotContext(ctx, nctx)
+	}
+
+	ret, err := s.client.runtime.Call(ctx, agent, types.AgentTool, types.SampleCallRequest{
+		Prompt:      input,
+		Attachments: opt.Attachments,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		IsError:           ret.IsError,
+		StructuredContent: ret.StructuredContent,
+	}
+	for _, content := range ret.Content {
+		if content.Type == "text" {
+			result.Output += content.Text
+		} else {
+			result.Content = append(result.Content, content)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,284 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+)
+
+const (
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	// annotationTitle is the file name of a layer, set by tools like oras.
+	annotationTitle = "org.opencontainers.image.title"
+	// maxBlobSize limits the size of the files of a config artifact.
+	maxBlobSize = 32 << 20
+)
+
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type Manifest struct {
+	MediaType   string            `json:"mediaType"`
+	Config      Descriptor        `json:"config"`
+	Layers      []Descriptor      `json:"layers"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// client talks to registries with the distribution API. It logs in with the credentials of the
+// Docker config, or anonymously.
+type client struct {
+	lock   sync.Mutex
+	tokens map[string]string
+}
+
+func newClient() *client {
+	return &client{
+		tokens: map[string]string{},
+	}
+}
+
+// manifest returns the manifest of the reference and its digest.
+func (c *client) manifest(ctx context.Context, ref Reference) (Manifest, string, error) {
+	var manifest Manifest
+
+	resp, err := c.get(ctx, ref, ref.baseURL()+"/manifests/"+ref.manifestRef(), mediaTypeOCIManifest+", "+mediaTypeDockerManifest)
+	if err != nil {
+		return manifest, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBlobSize))
+	if err != nil {
+		return manifest, "", fmt.Errorf("failed to read manifest of %s: %w", ref, err)
+	}
+
+	digest := "sha256:" + sha256Hex(data)
+	if ref.Digest != "" && digest != ref.Digest {
+		return manifest, "", fmt.Errorf("manifest of %s has digest %s", ref, digest)
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, "", fmt.Errorf("failed to parse manifest of %s: %w", ref, err)
+	}
+	if manifest.MediaType != "" && manifest.MediaType != mediaTypeOCIManifest && manifest.MediaType != mediaTypeDockerManifest {
+		return manifest, "", fmt.Errorf("%s is a %s, not an artifact manifest", ref, manifest.MediaType)
+	}
+	return manifest, digest, nil
+}
+
+// blob returns the content of the blob, after checking it has the digest.
+func (c *client) blob(ctx context.Context, ref Reference, desc Descriptor) ([]byte, error) {
+	if !digestPattern.MatchString(desc.Digest) {
+		return nil, fmt.Errorf("unsupported digest %q", desc.Digest)
+	}
+	if desc.Size > maxBlobSize {
+		return nil, fmt.Errorf("blob %s of %s is larger than %d bytes", desc.Digest, ref, maxBlobSize)
+	}
+
+	resp, err := c.get(ctx, ref, ref.baseURL()+"/blobs/"+desc.Digest, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBlobSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s of %s: %w", desc.Digest, ref, err)
+	}
+	if "sha256:"+sha256Hex(data) != desc.Digest {
+		return nil, fmt.Errorf("blob %s of %s does not match its digest", desc.Digest, ref)
+	}
+	return data, nil
+}
+
+func (c *client) get(ctx context.Context, ref Reference, u, accept string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		c.lock.Lock()
+		authorization := c.tokens[ref.Registry+"/"+ref.Repository]
+		c.lock.Unlock()
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		resp, err := transport.Client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", u, err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		challenge := resp.Header.Get("WWW-Authenticate")
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return nil, fmt.Errorf("failed to get %s: %s %s", u, resp.Status, strings.TrimSpace(string(body)))
+		}
+
+		authorization, err = c.login(ctx, ref, challenge)
+		if err != nil {
+			return nil, fmt.Errorf("failed to log in to %s: %w", ref.Registry, err)
+		}
+		c.lock.Lock()
+		c.tokens[ref.Registry+"/"+ref.Repository] = authorization
+		c.lock.Unlock()
+	}
+}
+
+// login answers the challenge of a registry and returns the Authorization header to send.
+func (c *client) login(ctx context.Context, ref Reference, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	username, password := credentials(ref.Registry)
+
+	if strings.EqualFold(scheme, "basic") {
+		if username == "" {
+			return "", fmt.Errorf("registry requires credentials, log in with docker login %s", ref.Registry)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)), nil
+	}
+	if !strings.EqualFold(scheme, "bearer") {
+		return "", fmt.Errorf("unsupported authentication %q", challenge)
+	}
+
+	values := parseChallenge(params)
+	realm, err := url.Parse(values["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("invalid realm in %q", challenge)
+	}
+	query := realm.Query()
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	scope := values["scope"]
+	if scope == "" {
+		scope = "repository:" + ref.Repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := transport.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("token request failed: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", errors.New("token response has no token")
+	}
+	return "Bearer " + token.Token, nil
+}
+
+func parseChallenge(params string) map[string]string {
+	result := map[string]string{}
+	for params != "" {
+		var key, value string
+		key, params, _ = strings.Cut(params, "=")
+		key = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(key), ","))
+		if strings.HasPrefix(params, `"`) {
+			value, params, _ = strings.Cut(params[1:], `"`)
+		} else {
+			value, params, _ = strings.Cut(params, ",")
+		}
+		result[strings.ToLower(key)] = value
+	}
+	return result
+}
+
+// credentials returns the username and password of the registry from the Docker config, set by docker
+// login. Credential helpers are not supported.
+func credentials(registry string) (string, string) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", ""
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", ""
+	}
+
+	keys := []string{registry, "https://" + registry}
+	if registry == "docker.io" {
+		keys = append(keys, "https://index.docker.io/v1/", "index.docker.io")
+	}
+	for _, key := range keys {
+		auth, ok := config.Auths[key]
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			continue
+		}
+		username, password, _ := strings.Cut(string(decoded), ":")
+		return username, password
+	}
+	return "", ""
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,239 @@
+package oci
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+)
+
+type Options struct {
+	// KeyFile is the path of a PEM public key. If set, artifacts must be signed by its private key.
+	KeyFile string
+	// CacheDir is where pulled artifacts are kept, it defaults to nanobot/configs in the user cache
+	// directory.
+	CacheDir string
+}
+
+func (o Options) Merge(other Options) (result Options) {
+	result.KeyFile = complete.Last(o.KeyFile, other.KeyFile)
+	result.CacheDir = complete.Last(o.CacheDir, other.CacheDir)
+	return
+}
+
+func (o Options) Complete() Options {
+	if o.CacheDir == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			o.CacheDir = filepath.Join(dir, "nanobot", "configs")
+		} else {
+			o.CacheDir = filepath.Join(os.TempDir(), "nanobot", "configs")
+		}
+	}
+	return o
+}
+
+// Key returns the public key of the KeyFile, or nil if no KeyFile is set.
+func (o Options) Key() (crypto.PublicKey, error) {
+	if o.KeyFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key %s: %w", o.KeyFile, err)
+	}
+	key, err := ParsePublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key %s: %w", o.KeyFile, err)
+	}
+	return key, nil
+}
+
+// Pull downloads the files of the artifact at the reference, like one pushed with oras push, and
+// returns the directory they are in. Each layer is written to the file named by its title annotation.
+// Artifacts are cached by digest, so a reference pinned by digest is only downloaded once and a
+// reference by tag falls back to the last pulled digest if the registry can not be reached.
+func Pull(ctx context.Context, ref Reference, opts ...Options) (string, error) {
+	opt := complete.Complete(opts...)
+
+	key, err := opt.Key()
+	if err != nil {
+		return "", err
+	}
+
+	c := cache{dir: filepath.Join(opt.CacheDir, "oci"), keyFile: opt.KeyFile}
+	if ref.Digest != "" {
+		if dir, ok := c.get(ref.Digest, key != nil); ok {
+			return dir, nil
+		}
+	}
+
+	client := newClient()
+	manifest, digest, err := client.manifest(ctx, ref)
+	if err != nil {
+		if ref.Digest == "" {
+			if digest, ok := c.getTag(ref); ok {
+				if dir, ok := c.get(digest, key != nil); ok {
+					log.Errorf(ctx, "failed to pull %s, using cached %s: %v", ref, digest, err)
+					return dir, nil
+				}
+			}
+		}
+		return "", err
+	}
+
+	if key != nil {
+		if err := client.verify(ctx, ref, digest, key); err != nil {
+			return "", err
+		}
+	}
+
+	if dir, ok := c.get(digest, key != nil); ok {
+		return dir, c.setTag(ref, digest)
+	}
+
+	files := map[string][]byte{}
+	for _, layer := range manifest.Layers {
+		name := layer.Annotations[annotationTitle]
+		if name == "" {
+			continue
+		}
+		if err := validFileName(name); err != nil {
+			return "", fmt.Errorf("invalid file %q in %s: %w", name, ref, err)
+		}
+		data, err := client.blob(ctx, ref, layer)
+		if err != nil {
+			return "", err
+		}
+		files[name] = data
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("%s has no files, push the config with oras push %s nanobot.yaml", ref, ref)
+	}
+
+	dir, err := c.put(digest, files, key != nil)
+	if err != nil {
+		return "", err
+	}
+	return dir, c.setTag(ref, digest)
+}
+
+func validFileName(name string) error {
+	if path.IsAbs(name) || filepath.IsAbs(name) || strings.Contains(name, "\\") {
+		return errors.New("file names must be relative")
+	}
+	if strings.HasPrefix(name, ".verified-") {
+		return errors.New("file names must not start with .verified-")
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return errors.New("file names must not contain ..")
+		}
+	}
+	return nil
+}
+
+// cache stores the files of artifacts in blobs/<digest> and the digests of tags in refs/ . A verified
+// marker file records that the artifact was verified with the key, so a digest pulled without a
+// key is not trusted later when a key is set.
+type cache struct {
+	dir     string
+	keyFile string
+}
+
+func (c cache) blobDir(digest string) string {
+	return filepath.Join(c.dir, "blobs", strings.Replace(digest, ":", "-", 1))
+}
+
+func (c cache) verifiedMarker(digest string) string {
+	abs, err := filepath.Abs(c.keyFile)
+	if err != nil {
+		abs = c.keyFile
+	}
+	return filepath.Join(c.blobDir(digest), ".verified-"+sha256Hex([]byte(abs))[:16])
+}
+
+func (c cache) get(digest string, verified bool) (string, bool) {
+	dir := c.blobDir(digest)
+	if _, err := os.Stat(dir); err != nil {
+		return "", false
+	}
+	if verified {
+		if _, err := os.Stat(c.verifiedMarker(digest)); err != nil {
+			return "", false
+		}
+	}
+	return dir, true
+}
+
+func (c cache) put(digest string, files map[string][]byte, verified bool) (string, error) {
+	dir := c.blobDir(digest)
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		tmp, err := os.MkdirTemp(filepath.Dir(dir), ".pull-")
+		if err != nil {
+			return "", fmt.Errorf("failed to create cache directory: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+
+		for name, data := range files {
+			target := filepath.Join(tmp, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return "", fmt.Errorf("failed to create directory of %s: %w", name, err)
+			}
+			if err := os.WriteFile(target, data, 0o644); err != nil {
+				return "", fmt.Errorf("failed to write %s: %w", name, err)
+			}
+		}
+		// Another process may have pulled the same digest, then its copy is used
+		if err := os.Rename(tmp, dir); err != nil {
+			if _, statErr := os.Stat(dir); statErr != nil {
+				return "", fmt.Errorf("failed to write cache directory %s: %w", dir, err)
+			}
+		}
+	}
+
+	if verified {
+		if err := os.WriteFile(c.verifiedMarker(digest), nil, 0o644); err != nil {
+			return "", fmt.Errorf("failed to write cache directory %s: %w", dir, err)
+		}
+	}
+	return dir, nil
+}
+
+func (c cache) tagFile(ref Reference) string {
+	return filepath.Join(c.dir, "refs", ref.Registry, filepath.FromSlash(ref.Repository), ref.Tag)
+}
+
+func (c cache) getTag(ref Reference) (string, bool) {
+	data, err := os.ReadFile(c.tagFile(ref))
+	if err != nil {
+		return "", false
+	}
+	digest := strings.TrimSpace(string(data))
+	return digest, digestPattern.MatchString(digest)
+}
+
+func (c cache) setTag(ref Reference, digest string) error {
+	if ref.Tag == "" {
+		return nil
+	}
+	file := c.tagFile(ref)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := os.WriteFile(file, []byte(digest+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write cache of %s: %w", ref, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package oci
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// Reference is an artifact in a registry, by tag or by digest.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses references like ghcr.io/org/agent:v1 or ghcr.io/org/agent@sha256:... . A
+// reference without a registry is in Docker Hub, one without tag or digest is latest.
+func ParseReference(ref string) (Reference, error) {
+	var result Reference
+
+	name, digest, hasDigest := strings.Cut(ref, "@")
+	if hasDigest {
+		if !digestPattern.MatchString(digest) {
+			return result, fmt.Errorf("invalid digest %q in %q, must be sha256:<64 hex characters>", digest, ref)
+		}
+		result.Digest = digest
+	}
+
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, result.Tag = name[:i], name[i+1:]
+	}
+
+	registry, repository, ok := strings.Cut(name, "/")
+	if !ok || !strings.ContainsAny(registry, ".:") && registry != "localhost" {
+		registry, repository = "docker.io", name
+	}
+	if registry == "docker.io" && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	if repository == "" {
+		return result, fmt.Errorf("invalid reference %q, must be registry/repository[:tag][@digest]", ref)
+	}
+	if result.Tag == "" && result.Digest == "" {
+		result.Tag = "latest"
+	}
+
+	result.Registry = registry
+	result.Repository = repository
+	return result, nil
+}
+
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// manifestRef is the digest if the reference is pinned, otherwise the tag.
+func (r Reference) manifestRef() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r Reference) baseURL() string {
+	host := r.Registry
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	scheme := "https"
+	if hostname, _, _ := strings.Cut(host, ":"); hostname == "localhost" || hostname == "127.0.0.1" {
+		scheme = "http"
+	}
+	return scheme + "://" + host + "/v2/" + r.Repository
+}
@@ -0,0 +1,119 @@
+package oci
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// annotationSignature holds the signature of a layer of a cosign signature artifact.
+const annotationSignature = "dev.cosignproject.cosign/signature"
+
+// ParsePublicKey parses a PEM public key as written by cosign generate-key-pair. ECDSA, RSA, and
+// Ed25519 keys are supported.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// VerifyBlob checks the base64 signature of data, as written by cosign sign-blob.
+func VerifyBlob(key crypto.PublicKey, data []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+
+	digest := sha256.Sum256(data)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+			return errors.New("invalid signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, data, sig) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	return nil
+}
+
+// verify checks that the manifest with the digest is signed with cosign sign by the key. Cosign
+// stores signatures in the repository under the tag sha256-<hex>.sig, each layer is a payload that
+// names the manifest digest and is annotated with its signature.
+func (c *client) verify(ctx context.Context, ref Reference, digest string, key crypto.PublicKey) error {
+	sigRef := ref
+	sigRef.Digest = ""
+	sigRef.Tag = strings.Replace(digest, ":", "-", 1) + ".sig"
+
+	manifest, _, err := c.manifest(ctx, sigRef)
+	if err != nil {
+		return fmt.Errorf("failed to get signature of %s: %w", ref, err)
+	}
+
+	var errs []error
+	for _, layer := range manifest.Layers {
+		signature, ok := layer.Annotations[annotationSignature]
+		if !ok {
+			continue
+		}
+		payload, err := c.blob(ctx, sigRef, layer)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := VerifyBlob(key, payload, signature); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		var simpleSigning struct {
+			Critical struct {
+				Image struct {
+					DockerManifestDigest string `json:"docker-manifest-digest"`
+				} `json:"image"`
+			} `json:"critical"`
+		}
+		if err := json.Unmarshal(payload, &simpleSigning); err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse signature payload: %w", err))
+			continue
+		}
+		if simpleSigning.Critical.Image.DockerManifestDigest != digest {
+			errs = append(errs, fmt.Errorf("signature is for %s", simpleSigning.Critical.Image.DockerManifestDigest))
+			continue
+		}
+		return nil
+	}
+
+	if len(errs) == 0 {
+		return fmt.Errorf("%s has no signatures", ref)
+	}
+	return fmt.Errorf("%s is not signed by the key: %w", ref, errors.Join(errs...))
+}
@@ -0,0 +1,240 @@
+package orchestration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/sampling"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+const (
+	// ToolPrefix is the prefix of the tool names the handoff targets are exposed as.
+	ToolPrefix = "handoff_to_"
+	// HandoffTool is the target name of the tool mappings of handoff tools.
+	HandoffTool = "handoff"
+	// DefaultMaxDepth is the number of nested handoffs allowed if not configured
+	DefaultMaxDepth = 3
+)
+
+var inputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "task": {
+      "type": "string",
+      "description": "The task to hand off, including everything the agent needs to know to complete it"
+    },
+    "context": {
+      "type": "string",
+      "description": "Additional context that is relevant to the task"
+    }
+  },
+  "required": ["task"]
+}`)
+
+const summaryPrompt = `You summarize the result of a task that was handed off to another agent. Keep all facts, ` +
+	`numbers, names, links and decisions that are relevant to the task, drop everything else. Respond with the ` +
+	`summary only.`
+
+// Args are the arguments of a handoff tool call.
+type Args struct {
+	Task    string `json:"task"`
+	Context string `json:"context,omitempty"`
+}
+
+// ToolMappings returns the tools for the handoff targets configured for an agent.
+func ToolMappings(config types.Config, handoff *types.Handoff) types.ToolMappings {
+	result := types.ToolMappings{}
+	if handoff == nil {
+		return result
+	}
+
+	for _, target := range handoff.Agents {
+		agent, ok := config.Agents[target]
+		if !ok {
+			continue
+		}
+
+		description := fmt.Sprintf("Hand off a task to the %s agent and wait for its result.", target)
+		if agent.Description != "" {
+			description += " " + agent.Description
+		}
+
+		name := ToolPrefix + target
+		result[name] = types.TargetMapping[mcp.Tool]{
+			MCPServer:  target,
+			TargetName: HandoffTool,
+			Target: mcp.Tool{
+				Name:        name,
+				Description: description,
+				InputSchema: inputSchema,
+			},
+		}
+	}
+
+	return result
+}
+
+type depthKey struct{}
+
+// Depth returns the number of handoffs that led to the current completion.
+func Depth(ctx context.Context) int {
+	depth, _ := ctx.Value(depthKey{}).(int)
+	return depth
+}
+
+// Orchestrator runs handoffs from one agent to another.
+type Orchestrator struct {
+	agents types.Completer
+	llm    types.Completer
+}
+
+// New returns an Orchestrator that runs the target agents with agents and summarizes results with llm.
+func New(agents, llm types.Completer) *Orchestrator {
+	return &Orchestrator{
+		agents: agents,
+		llm:    llm,
+	}
+}
+
+// Handoff runs the task with the target agent and returns its result. history is the conversation of
+// the calling agent that is forwarded to the target if configured.
+func (o *Orchestrator) Handoff(ctx context.Context, config types.Config, from, to string, args Args, history []types.Message, opts ...types.CompletionOptions) (*types.CallResult, error) {
+	handoff := config.Agents[from].Handoff
+	if handoff == nil {
+		handoff = &types.Handoff{}
+	}
+
+	maxDepth := handoff.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	depth := Depth(ctx)
+	if depth >= maxDepth {
+		return nil, fmt.Errorf("handoff from %s to %s exceeds the maximum handoff depth of %d", from, to, maxDepth)
+	}
+
+	if strings.TrimSpace(args.Task) == "" {
+		return nil, fmt.Errorf("handoff to %s requires a task", to)
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "The agent %q handed off a task to you.\n\n", from)
+	if handoff.ForwardContext {
+		if transcript := Transcript(history); transcript != "" {
+			fmt.Fprintf(&prompt, "<conversation>\n%s</conversation>\n\n", transcript)
+		}
+	}
+	if args.Context != "" {
+		fmt.Fprintf(&prompt, "<context>\n%s\n</context>\n\n", args.Context)
+	}
+	fmt.Fprintf(&prompt, "Task: %s", args.Task)
+
+	var (
+		chat     = false
+		progress any
+	)
+	for _, opt := range opts {
+		if opt.ProgressToken != nil {
+			progress = opt.ProgressToken
+		}
+	}
+
+	resp, err := o.agents.Complete(context.WithValue(ctx, depthKey{}, depth+1), types.CompletionRequest{
+		Model: to,
+		Input: []types.Message{userMessage(prompt.String())},
+	}, types.CompletionOptions{
+		Chat:          &chat,
+		ProgressToken: progress,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to hand off to %s: %w", to, err)
+	}
+
+	result, err := sampling.CompletionResponseToCallResult(resp, false)
+	if err != nil {
+		return nil, err
+	}
+	result.Agent = to
+
+	if !handoff.Summarize || result.IsError {
+		return result, nil
+	}
+
+	summaryAgent := handoff.SummaryAgent
+	if summaryAgent == "" {
+		summaryAgent = from
+	}
+	return o.summarize(ctx, config.Agents[summaryAgent], args.Task, result)
+}
+
+func (o *Orchestrator) summarize(ctx context.Context, agent types.Agent, task string, result *types.CallResult) (*types.CallResult, error) {
+	var text strings.Builder
+	for _, content := range result.Content {
+		if content.Type == "text" {
+			text.WriteString(content.Text)
+			text.WriteString("\n")
+		}
+	}
+	if text.Len() == 0 {
+		return result, nil
+	}
+
+	resp, err := o.llm.Complete(ctx, types.CompletionRequest{
+		Model:          agent.Model.Primary(),
+		FallbackModels: agent.Model.Fallbacks(),
+		BaseURL:        agent.BaseURL,
+		SystemPrompt:   summaryPrompt,
+		Input:          []types.Message{userMessage(fmt.Sprintf("Task: %s\n\nResult:\n%s", task, text.String()))},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize handoff result: %w", err)
+	}
+
+	summary, err := sampling.CompletionResponseToCallResult(resp, false)
+	if err != nil {
+		return nil, err
+	}
+	summary.Agent = result.Agent
+	return summary, nil
+}
+
+// Transcript renders the text of a conversation, tool calls are included by name only.
+func Transcript(messages []types.Message) string {
+	var buf strings.Builder
+	for _, msg := range messages {
+		for _, item := range msg.Items {
+			switch {
+			case item.Content != nil && item.Content.Type == "text" && item.Content.Text != "":
+				fmt.Fprintf(&buf, "%s: %s\n", msg.Role, item.Content.Text)
+			case item.ToolCall != nil:
+				fmt.Fprintf(&buf, "%s: [called tool %s]\n", msg.Role, item.ToolCall.Name)
+			}
+		}
+	}
+	return buf.String()
+}
+
+func userMessage(text string) types.Message {
+	now := time.Now()
+	id := uuid.String()
+	return types.Message{
+		ID:      id,
+		Created: &now,
+		Role:    "user",
+		Items: []types.CompletionItem{
+			{
+				ID: id + "_0",
+				Content: &mcp.Content{
+					Type: "text",
+					Text: text,
+				},
+			},
+		},
+	}
+}
@@ -3,6 +3,7 @@ package printer
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"sync"
@@ -37,11 +38,20 @@ var (
 	}
 	lastColorIndex = 0
 	prefixToColor  = map[string]string{}
+
+	output io.Writer = os.Stderr
 )
 
+// SetOutput changes where lines are printed, they go to stderr by default.
+func SetOutput(w io.Writer) {
+	printLock.Lock()
+	defer printLock.Unlock()
+	output = w
+}
+
 func appendToLine(prefix, content string) {
 	width, _, err := term.GetSize(int(os.Stdout.Fd()))
-	if err == nil {
+	if err == nil && output == os.Stderr {
 		if remaining := width - len(currentLine); len(content) > remaining {
 			appendToLine(prefix, content[:remaining])
 			newline()
@@ -50,12 +60,12 @@ func appendToLine(prefix, content string) {
 		}
 	}
 
-	_, _ = fmt.Fprint(os.Stderr, content)
+	_, _ = fmt.Fprint(output, content)
 	currentLine += content
 }
 
 func newline() {
-	_, _ = fmt.Fprint(os.Stderr, "\n")
+	_, _ = fmt.Fprint(output, "\n")
 	currentLine = ""
 	lastPrefix = ""
 }
@@ -0,0 +1,237 @@
+package replay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const (
+	KindCompletion = "completion"
+	KindToolCall   = "tools/call"
+	KindToolList   = "tools/list"
+)
+
+// volatileFields are left out of the key of a request because they differ between runs.
+var volatileFields = map[string]bool{
+	"id":       true,
+	"created":  true,
+	"metadata": true,
+	"_meta":    true,
+}
+
+// Cassette is a file of recorded LLM and tool traffic. A recording cassette appends every interaction
+// and writes the file after each one, a replaying cassette serves the recorded responses back.
+type Cassette struct {
+	path      string
+	recording bool
+	lock      sync.Mutex
+	used      []bool
+
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Kind     string          `json:"kind"`
+	Key      string          `json:"key"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// NewRecorder returns a cassette that records to path, replacing the file if it exists.
+func NewRecorder(path string) (*Cassette, error) {
+	c := &Cassette{
+		path:      path,
+		recording: true,
+	}
+	return c, c.save()
+}
+
+// Load returns a cassette that replays the interactions recorded in path.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+	}
+
+	c := &Cassette{
+		path: path,
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	c.used = make([]bool, len(c.Interactions))
+	return c, nil
+}
+
+func (c *Cassette) Recording() bool {
+	return c != nil && c.recording
+}
+
+func (c *Cassette) Replaying() bool {
+	return c != nil && !c.recording
+}
+
+func (c *Cassette) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write cassette %s: %w", c.path, err)
+	}
+	return nil
+}
+
+// Record adds an interaction to the cassette.
+func (c *Cassette) Record(ctx context.Context, kind string, req, resp any, respErr error) {
+	key, reqData, err := Key(kind, req)
+	if err != nil {
+		log.Errorf(ctx, "failed to record %s: %v", kind, err)
+		return
+	}
+
+	interaction := Interaction{
+		Kind:    kind,
+		Key:     key,
+		Request: reqData,
+	}
+	if respErr != nil {
+		interaction.Error = respErr.Error()
+	} else if interaction.Response, err = json.Marshal(resp); err != nil {
+		log.Errorf(ctx, "failed to record %s: %v", kind, err)
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.Interactions = append(c.Interactions, interaction)
+	if err := c.save(); err != nil {
+		log.Errorf(ctx, "failed to record %s: %v", kind, err)
+	}
+}
+
+// Replay decodes the recorded response for the request into resp. Interactions are matched by the key
+// of the request, if none matches the next unused interaction of the same kind is used so that requests
+// with content that changes between runs still replay in order.
+func (c *Cassette) Replay(ctx context.Context, kind string, req, resp any) error {
+	key, _, err := Key(kind, req)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	i := c.find(kind, key)
+	if i < 0 {
+		return fmt.Errorf("no recorded %s left in cassette %s", kind, c.path)
+	}
+	c.used[i] = true
+
+	interaction := c.Interactions[i]
+	if interaction.Key != key {
+		log.Debugf(ctx, "replaying %s out of order, the request does not match the recording", kind)
+	}
+	if interaction.Error != "" {
+		return errors.New(interaction.Error)
+	}
+	if err := json.Unmarshal(interaction.Response, resp); err != nil {
+		return fmt.Errorf("failed to decode recorded %s: %w", kind, err)
+	}
+	return nil
+}
+
+func (c *Cassette) find(kind, key string) int {
+	next := -1
+	for i, interaction := range c.Interactions {
+		if c.used[i] || interaction.Kind != kind {
+			continue
+		}
+		if interaction.Key == key {
+			return i
+		}
+		if next == -1 {
+			next = i
+		}
+	}
+	return next
+}
+
+// Key returns the hash of the request without its volatile fields, and the request as JSON.
+func Key(kind string, req any) (string, json.RawMessage, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal %s: %w", kind, err)
+	}
+
+	var obj any
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return "", nil, fmt.Errorf("failed to unmarshal %s: %w", kind, err)
+	}
+	canonical, err := json.Marshal(stripVolatile(obj))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal %s: %w", kind, err)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil)), data, nil
+}
+
+func stripVolatile(obj any) any {
+	switch v := obj.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if volatileFields[k] {
+				delete(v, k)
+			} else {
+				v[k] = stripVolatile(val)
+			}
+		}
+	case []any:
+		for i, val := range v {
+			v[i] = stripVolatile(val)
+		}
+	}
+	return obj
+}
+
+// Completer records or replays the completions of next.
+func (c *Cassette) Completer(next types.Completer) types.Completer {
+	return &completer{
+		cassette: c,
+		next:     next,
+	}
+}
+
+type completer struct {
+	cassette *Cassette
+	next     types.Completer
+}
+
+func (c *completer) Complete(ctx context.Context, req types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error) {
+	if c.cassette.Replaying() {
+		var resp types.CompletionResponse
+		if err := c.cassette.Replay(ctx, KindCompletion, req, &resp); err != nil {
+			return nil, err
+		}
+		return &resp, nil
+	}
+
+	resp, err := c.next.Complete(ctx, req, opts...)
+	c.cassette.Record(ctx, KindCompletion, req, resp, err)
+	return resp, err
+}
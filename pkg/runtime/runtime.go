@@ -7,26 +7,39 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/agents"
 	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/elicit"
+	"github.com/nanobot-ai/nanobot/pkg/gormdsn"
+	"github.com/nanobot-ai/nanobot/pkg/knowledge"
 	"github.com/nanobot-ai/nanobot/pkg/llm"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/memory"
+	"github.com/nanobot-ai/nanobot/pkg/middleware"
+	"github.com/nanobot-ai/nanobot/pkg/replay"
 	"github.com/nanobot-ai/nanobot/pkg/sampling"
+	"github.com/nanobot-ai/nanobot/pkg/servers/a2a"
 	"github.com/nanobot-ai/nanobot/pkg/servers/agent"
 	"github.com/nanobot-ai/nanobot/pkg/servers/agentui"
 	"github.com/nanobot-ai/nanobot/pkg/servers/meta"
 	"github.com/nanobot-ai/nanobot/pkg/servers/resources"
+	"github.com/nanobot-ai/nanobot/pkg/servers/tool"
 	"github.com/nanobot-ai/nanobot/pkg/session"
 	"github.com/nanobot-ai/nanobot/pkg/sessiondata"
 	"github.com/nanobot-ai/nanobot/pkg/tools"
 	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/wasm"
+	"github.com/nanobot-ai/nanobot/pkg/wirelog"
 )
 
 type Runtime struct {
 	*tools.Service
 	llmConfig llm.Config
 	opt       Options
+	knowledge *knowledge.Service
+	agents    *agents.Agents
 }
 
 type Options struct {
@@ -37,6 +50,13 @@ type Options struct {
 	TokenStorage     mcp.TokenStorage
 	OAuthRedirectURL string
 	DSN              string
+	DBOptions        gormdsn.Options
+	// HealthCheckInterval is how often MCP servers are pinged, zero disables health checks.
+	HealthCheckInterval time.Duration
+	// Cassette records or replays the LLM and tool traffic.
+	Cassette *replay.Cassette
+	// Middleware runs on every turn of all agents, before the middleware of the config.
+	Middleware []middleware.Middleware
 }
 
 func (o Options) Merge(other Options) (result Options) {
@@ -47,6 +67,10 @@ func (o Options) Merge(other Options) (result Options) {
 	result.OAuthRedirectURL = complete.Last(o.OAuthRedirectURL, other.OAuthRedirectURL)
 	result.TokenStorage = complete.Last(o.TokenStorage, other.TokenStorage)
 	result.DSN = complete.Last(o.DSN, other.DSN)
+	result.DBOptions = o.DBOptions.Merge(other.DBOptions)
+	result.HealthCheckInterval = complete.Last(o.HealthCheckInterval, other.HealthCheckInterval)
+	result.Cassette = complete.Last(o.Cassette, other.Cassette)
+	result.Middleware = append(o.Middleware, other.Middleware...)
 	return
 }
 
@@ -55,21 +79,38 @@ func NewRuntime(cfg llm.Config, opts ...Options) (*Runtime, error) {
 
 	if opt.TokenStorage == nil && opt.DSN != "" {
 		var err error
-		opt.TokenStorage, err = session.NewStoreFromDSN(opt.DSN)
+		opt.TokenStorage, err = session.NewStoreFromDSN(opt.DSN, opt.DBOptions)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create session store: %w", err)
 		}
 	}
 
-	completer := llm.NewClient(cfg)
+	llmClient := llm.NewClient(cfg)
+	var completer types.Completer = wirelog.New(wirelog.Options{
+		DSN:       opt.DSN,
+		DBOptions: opt.DBOptions,
+	}).Completer(llmClient)
+	if opt.Cassette != nil {
+		completer = opt.Cassette.Completer(completer)
+	}
 	registry := tools.NewToolsService(tools.Options{
-		Roots:            opt.Roots,
-		Concurrency:      opt.MaxConcurrency,
-		CallbackHandler:  opt.CallbackHandler,
-		OAuthRedirectURL: opt.OAuthRedirectURL,
-		TokenStorage:     opt.TokenStorage,
+		Roots:               opt.Roots,
+		Concurrency:         opt.MaxConcurrency,
+		CallbackHandler:     opt.CallbackHandler,
+		OAuthRedirectURL:    opt.OAuthRedirectURL,
+		TokenStorage:        opt.TokenStorage,
+		HealthCheckInterval: opt.HealthCheckInterval,
+		Cassette:            opt.Cassette,
+	})
+	memories := memory.New(llmClient, memory.Options{
+		DSN:       opt.DSN,
+		DBOptions: opt.DBOptions,
+	})
+	knowledgeService := knowledge.New(memories, knowledge.Options{
+		DSN:       opt.DSN,
+		DBOptions: opt.DBOptions,
 	})
-	agents := agents.New(completer, registry)
+	agents := agents.New(completer, registry, memories, knowledgeService, llmClient, llmClient, opt.Middleware)
 	sampler := sampling.NewSampler(agents)
 
 	// This is a circular dependency. Oh well, so much for good design.
@@ -79,6 +120,8 @@ func NewRuntime(cfg llm.Config, opts ...Options) (*Runtime, error) {
 		Service:   registry,
 		llmConfig: cfg,
 		opt:       opt,
+		knowledge: knowledgeService,
+		agents:    agents,
 	}
 
 	registry.AddServer("nanobot.meta", func(string) mcp.MessageHandler {
@@ -93,6 +136,15 @@ func NewRuntime(cfg llm.Config, opts ...Options) (*Runtime, error) {
 		return agentui.NewServer(sessiondata.NewData(r), r)
 	})
 
+	wasmRuntime := wasm.NewRuntime()
+	registry.AddServer("nanobot.tool", func(name string) mcp.MessageHandler {
+		return tool.NewServer(name, wasmRuntime)
+	})
+
+	registry.AddServer("nanobot.a2a", func(name string) mcp.MessageHandler {
+		return a2a.NewServer(name)
+	})
+
 	if opt.DSN != "" {
 		var (
 			once  = &sync.Once{}
@@ -101,7 +153,7 @@ func NewRuntime(cfg llm.Config, opts ...Options) (*Runtime, error) {
 		registry.AddServer("nanobot.resources", func(string) mcp.MessageHandler {
 			once.Do(func() {
 				var err error
-				store, err = resources.NewStoreFromDSN(opt.DSN)
+				store, err = resources.NewStoreFromDSN(opt.DSN, opt.DBOptions)
 				if err != nil {
 					panic(fmt.Errorf("failed to create resources store: %w", err))
 				}
@@ -113,9 +165,30 @@ func NewRuntime(cfg llm.Config, opts ...Options) (*Runtime, error) {
 	return r, nil
 }
 
-func (r *Runtime) WithTempSession(ctx context.Context, config *types.Config) context.Context {
+// IndexKnowledge indexes the knowledge sources of the agents of the config, so that the first search does
+// not have to wait for it.
+func (r *Runtime) IndexKnowledge(ctx context.Context, config types.Config) {
+	r.knowledge.IndexAll(ctx, config)
+}
+
+// Complete runs the agent of the request with the input of the request as the conversation.
+func (r *Runtime) Complete(ctx context.Context, req types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error) {
+	return r.agents.Complete(ctx, req, opts...)
+}
+
+// WithTempSession returns ctx with a new session of the config and env that is not stored, as used by the
+// commands of the CLI and by programs that embed nanobot.
+func WithTempSession(ctx context.Context, config *types.Config, env map[string]string) context.Context {
 	session := mcp.NewEmptySession(ctx)
 	session.Set(types.ConfigSessionKey, config)
+	// Use the local account so OAuth tokens are shared with sessions of nanobot run.
+	session.Set(types.AccountIDSessionKey, "")
+	if env != nil {
+		session.AddEnv(env)
+	}
+	// There is no client to ask, elicitations are answered from the config until a command that can
+	// ask the user replaces the handler.
+	session.SetElicitHandler(elicit.Headless)
 	return mcp.WithSession(ctx, session)
 }
 
@@ -128,7 +201,7 @@ func (r *Runtime) getToolFromRef(ctx context.Context, config types.Config, serve
 	if len(toolRef) == 1 {
 		_, ok := config.Agents[toolRef[0]]
 		if ok {
-			server, tool = toolRef[0], toolRef[0]
+			server, tool = toolRef[0], types.AgentTool
 		} else {
 			server, tool = "", toolRef[0]
 		}
@@ -208,7 +281,8 @@ func (r *Runtime) CallFromCLI(ctx context.Context, serverRef string, args ...str
 		return nil, err
 	}
 	return &mcp.CallToolResult{
-		IsError: callResult.IsError,
-		Content: callResult.Content,
+		IsError:           callResult.IsError,
+		Content:           callResult.Content,
+		StructuredContent: callResult.StructuredContent,
 	}, nil
 }
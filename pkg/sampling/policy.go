@@ -0,0 +1,195 @@
+package sampling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/audit"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const (
+	// ApprovalAlways asks the user before each sampling request of the server
+	ApprovalAlways = "always"
+	// ApprovalOnce asks the user before the first sampling request of the server in a session
+	ApprovalOnce = "once"
+	// ApprovalNever samples without asking, this is the default
+	ApprovalNever = "never"
+
+	serversSessionKey = "sampling/servers"
+)
+
+// serverState is what the session keeps of the sampling requests of an MCP server.
+type serverState struct {
+	Tokens   int  `json:"tokens,omitempty"`
+	Approved bool `json:"approved,omitempty"`
+}
+
+type servers map[string]serverState
+
+func (s servers) Serialize() (any, error) {
+	return s, nil
+}
+
+func (s *servers) Deserialize(data any) (any, error) {
+	if err := mcp.JSONCoerce(data, s); err != nil {
+		return nil, err
+	}
+	return *s, nil
+}
+
+func getState(session *mcp.Session, server string) serverState {
+	var state servers
+	session.Get(serversSessionKey, &state)
+	return state[server]
+}
+
+func updateState(session *mcp.Session, server string, update func(*serverState)) {
+	var state servers
+	_ = session.Update(serversSessionKey, &state, func() error {
+		state = maps.Clone(state)
+		if state == nil {
+			state = servers{}
+		}
+		serverState := state[server]
+		update(&serverState)
+		state[server] = serverState
+		return nil
+	})
+}
+
+// allowedAgents returns the agents of the config the policy allows, by name or alias.
+func allowedAgents(config types.Config, policy *mcp.SamplingConfig) map[string]types.Agent {
+	if policy == nil || policy.Models == nil {
+		return config.Agents
+	}
+	agents := map[string]types.Agent{}
+	for name, agent := range config.Agents {
+		if slices.Contains(policy.Models, name) || slices.ContainsFunc(agent.Aliases, func(alias string) bool {
+			return slices.Contains(policy.Models, alias)
+		}) {
+			agents[name] = agent
+		}
+	}
+	return agents
+}
+
+// checkPolicy rejects the request if the server can not sample, and caps its maxTokens to the
+// limits of the policy. With a token budget the maxTokens of the request are reserved from the
+// budget, so that concurrent requests can not go over it, and returned.
+func checkPolicy(ctx context.Context, server string, policy *mcp.SamplingConfig, req *mcp.CreateMessageRequest) (reserved int, _ error) {
+	if policy.Disabled {
+		return 0, fmt.Errorf("sampling is disabled for MCP server %s", server)
+	}
+
+	capTokens := func(maxTokens int) {
+		if maxTokens > 0 && (req.MaxTokens == 0 || req.MaxTokens > maxTokens) {
+			req.MaxTokens = maxTokens
+		}
+	}
+
+	session := mcp.SessionFromContext(ctx).Root()
+	if policy.TokenBudget <= 0 || session == nil {
+		capTokens(policy.MaxTokens)
+		return 0, nil
+	}
+
+	var err error
+	updateState(session, server, func(state *serverState) {
+		remaining := policy.TokenBudget - state.Tokens
+		if remaining <= 0 {
+			err = fmt.Errorf("MCP server %s used its sampling budget of %d tokens in this session", server, policy.TokenBudget)
+			return
+		}
+		capTokens(policy.MaxTokens)
+		capTokens(remaining)
+		reserved = req.MaxTokens
+		state.Tokens += reserved
+	})
+	return reserved, err
+}
+
+// approve asks the user to allow the sampling request if the policy requires it.
+func approve(ctx context.Context, server, agent string, policy *mcp.SamplingConfig, req mcp.CreateMessageRequest) error {
+	switch policy.Approval {
+	case "", ApprovalNever:
+		return nil
+	}
+
+	session := mcp.SessionFromContext(ctx).Root()
+	if session == nil || session.InitializeRequest.Capabilities.Elicitation == nil {
+		return fmt.Errorf("sampling by MCP server %s requires approval but the client does not support elicitation", server)
+	}
+	if policy.Approval == ApprovalOnce && getState(session, server).Approved {
+		return nil
+	}
+
+	meta, _ := json.Marshal(map[string]any{
+		types.MetaPrefix + "server-name": server,
+	})
+	message := fmt.Sprintf("Allow MCP server %s to request a completion from %s?", server, agent)
+	if prompt := promptText(req); prompt != "" {
+		message += "\n\n" + prompt
+	}
+
+	var result mcp.ElicitResult
+	if err := session.Exchange(ctx, "elicitation/create", mcp.ElicitRequest{
+		Message: message,
+		RequestedSchema: mcp.PrimitiveSchema{
+			Type:       "object",
+			Properties: map[string]mcp.PrimitiveProperty{},
+		},
+		Meta: meta,
+	}, &result); err != nil {
+		return fmt.Errorf("failed to elicit approval of sampling: %w", err)
+	}
+
+	audit.Record(ctx, audit.Event{
+		Time:    time.Now(),
+		Type:    audit.Approval,
+		Server:  server,
+		Agent:   agent,
+		Action:  result.Action,
+		Message: "sampling",
+	})
+
+	if result.Action != "accept" {
+		return fmt.Errorf("the user did not approve sampling by MCP server %s (%s)", server, result.Action)
+	}
+	if policy.Approval == ApprovalOnce {
+		updateState(session, server, func(state *serverState) {
+			state.Approved = true
+		})
+	}
+	return nil
+}
+
+// promptText is the text of the last message of the request, shortened to be shown to the user.
+func promptText(req mcp.CreateMessageRequest) string {
+	if len(req.Messages) == 0 {
+		return ""
+	}
+	text := strings.TrimSpace(req.Messages[len(req.Messages)-1].Content.Text)
+	if runes := []rune(text); len(runes) > 500 {
+		text = string(runes[:500]) + "..."
+	}
+	return text
+}
+
+// recordTokens replaces the tokens reserved for a sampling request with the tokens it used in the
+// budget of the server.
+func recordTokens(ctx context.Context, server string, reserved, tokens int) {
+	session := mcp.SessionFromContext(ctx).Root()
+	if session == nil || tokens == reserved {
+		return
+	}
+	updateState(session, server, func(state *serverState) {
+		state.Tokens += tokens - reserved
+	})
+}
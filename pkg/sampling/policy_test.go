@@ -0,0 +1,53 @@
+package sampling
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+)
+
+func TestCheckPolicyReservesBudget(t *testing.T) {
+	ctx := mcp.WithSession(context.Background(), mcp.NewEmptySession(context.Background()))
+	policy := &mcp.SamplingConfig{TokenBudget: 1000, MaxTokens: 300}
+
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		accepted int
+	)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := mcp.CreateMessageRequest{}
+			reserved, err := checkPolicy(ctx, "server", policy, &req)
+			if err != nil {
+				return
+			}
+			if reserved != req.MaxTokens {
+				t.Errorf("expected the maxTokens %d to be reserved, got %d", req.MaxTokens, reserved)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			accepted += reserved
+		}()
+	}
+	wg.Wait()
+
+	if accepted != policy.TokenBudget {
+		t.Errorf("expected the concurrent requests to reserve the budget of %d tokens, got %d", policy.TokenBudget, accepted)
+	}
+
+	session := mcp.SessionFromContext(ctx)
+	recordTokens(ctx, "server", 300, 100)
+	if tokens := getState(session, "server").Tokens; tokens != 800 {
+		t.Errorf("expected 800 tokens after the reservation was reconciled, got %d", tokens)
+	}
+
+	req := mcp.CreateMessageRequest{MaxTokens: 150}
+	if reserved, err := checkPolicy(ctx, "server", policy, &req); err != nil || reserved != 150 {
+		t.Errorf("expected 150 tokens reserved, got %d, %v", reserved, err)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/nanobot-ai/nanobot/pkg/complete"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
 	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/usage"
 	"github.com/nanobot-ai/nanobot/pkg/uuid"
 )
 
@@ -97,12 +98,18 @@ type SamplerOptions struct {
 	ProgressToken any
 	Continue      bool
 	AgentOverride types.AgentCall
+	// Server is the MCP server that sent the sampling request, its sampling config applies to it.
+	Server string
+	// Resume continues the interrupted turn of the agent instead of starting a new one.
+	Resume bool
 }
 
 func (s SamplerOptions) Merge(other SamplerOptions) (result SamplerOptions) {
 	result.ProgressToken = complete.Last(s.ProgressToken, other.ProgressToken)
 	result.Continue = complete.Last(s.Continue, other.Continue)
 	result.AgentOverride = complete.Merge(s.AgentOverride, other.AgentOverride)
+	result.Server = complete.Last(s.Server, other.Server)
+	result.Resume = s.Resume || other.Resume
 	return
 }
 
@@ -110,11 +117,37 @@ func (s *Sampler) Sample(ctx context.Context, req mcp.CreateMessageRequest, opts
 	opt := complete.Complete(opts...)
 	config := types.ConfigFromContext(ctx)
 
-	model, ok := s.getMatchingModel(config, &req)
-	if !ok {
+	var policy *mcp.SamplingConfig
+	if opt.Server != "" {
+		policy = config.MCPServers[opt.Server].Sampling
+	}
+	if policy != nil {
+		reserved, err := checkPolicy(ctx, opt.Server, policy, &req)
+		if err != nil {
+			return nil, err
+		}
+		counter := &usage.Counter{}
+		ctx = usage.WithCounter(ctx, counter)
+		defer func() {
+			recordTokens(ctx, opt.Server, reserved, counter.Tokens())
+		}()
+	}
+
+	matchConfig := config
+	matchConfig.Agents = allowedAgents(config, policy)
+	model, ok := s.getMatchingModel(matchConfig, &req)
+	if !ok && policy != nil && policy.Models != nil {
+		return nil, fmt.Errorf("MCP server %s can only sample with %s, which are not agents of the config", opt.Server, strings.Join(policy.Models, ", "))
+	} else if !ok {
 		return nil, ErrNoMatchingModel
 	}
 
+	if policy != nil {
+		if err := approve(ctx, opt.Server, model, policy, req); err != nil {
+			return nil, err
+		}
+	}
+
 	request := types.CompletionRequest{
 		Model:             model,
 		ToolChoice:        opt.AgentOverride.ToolChoice,
@@ -123,9 +156,17 @@ func (s *Sampler) Sample(ctx context.Context, req mcp.CreateMessageRequest, opts
 		TopP:              opt.AgentOverride.TopP,
 		NewThread:         opt.AgentOverride.NewThread != nil && *opt.AgentOverride.NewThread,
 		InputAsToolResult: opt.AgentOverride.InputAsToolResult,
+		ModelOverride:     opt.AgentOverride.Model,
+		MaxTokens:         opt.AgentOverride.MaxTokens,
+		Stop:              opt.AgentOverride.Stop,
+		FrequencyPenalty:  opt.AgentOverride.FrequencyPenalty,
+		PresencePenalty:   opt.AgentOverride.PresencePenalty,
+		Seed:              opt.AgentOverride.Seed,
+		Reasoning:         opt.AgentOverride.Reasoning,
+		Resume:            opt.Resume,
 	}
 
-	if req.MaxTokens != 0 {
+	if req.MaxTokens != 0 && request.MaxTokens == 0 {
 		request.MaxTokens = req.MaxTokens
 	}
 	if req.SystemPrompt != "" {
@@ -134,6 +175,9 @@ func (s *Sampler) Sample(ctx context.Context, req mcp.CreateMessageRequest, opts
 	if req.Temperature != nil {
 		request.Temperature = req.Temperature
 	}
+	if len(req.StopSequences) > 0 {
+		request.Stop = req.StopSequences
+	}
 
 	var currentRole string
 	for _, content := range req.Messages {
@@ -215,6 +259,18 @@ func CompletionResponseToCallResult(resp *types.CompletionResponse, includeMessa
 		result.Content = append(result.Content, *output.Content)
 	}
 
+	if len(resp.PlannedToolCalls) > 0 {
+		result.PlannedToolCalls = resp.PlannedToolCalls
+		planned, err := json.MarshalIndent(resp.PlannedToolCalls, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal planned tool calls: %w", err)
+		}
+		result.Content = append(result.Content, mcp.Content{
+			Type: "text",
+			Text: "Dry run, the following tool calls were planned but not run:\n" + string(planned),
+		})
+	}
+
 	if resp.Error != "" {
 		result.IsError = true
 		result.Content = append(result.Content, mcp.Content{
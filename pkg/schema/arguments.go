@@ -0,0 +1,282 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// compiledSchemas caches the compiled input schemas of tools and output schemas by their JSON, with the
+// error of schemas that do not compile.
+var (
+	compiledSchemas     = map[string]compiledSchema{}
+	compiledSchemasLock sync.Mutex
+)
+
+type compiledSchema struct {
+	schema *jsonschema.Schema
+	err    error
+}
+
+// CoerceArguments parses the JSON arguments of a call of the tool and validates them against the input
+// schema of the tool. Values that have another type than the schema requires are converted first when
+// that is safe, like "3" to 3 for a number or a JSON encoded array to the array. It returns an
+// ArgumentsError if the arguments are not valid.
+func CoerceArguments(tool string, inputSchema json.RawMessage, arguments string) (map[string]any, error) {
+	var data map[string]any
+	if strings.TrimSpace(arguments) != "" {
+		dec := json.NewDecoder(strings.NewReader(arguments))
+		dec.UseNumber()
+		if err := dec.Decode(&data); err != nil {
+			return nil, &types.ArgumentsError{
+				Tool: tool,
+				Errors: []types.ArgumentError{{
+					Message: "the arguments are not a JSON object: " + err.Error(),
+				}},
+			}
+		}
+	}
+
+	if len(inputSchema) == 0 {
+		return plain(data), nil
+	}
+
+	var schemaObj map[string]any
+	if err := json.Unmarshal(inputSchema, &schemaObj); err != nil {
+		return plain(data), nil
+	}
+	if data != nil {
+		data, _ = coerce(data, schemaObj).(map[string]any)
+	}
+
+	compiled, err := compileSchema(inputSchema)
+	if err != nil {
+		// Schemas that do not compile are not validated
+		return plain(data), nil
+	}
+
+	var doc any = map[string]any{}
+	if data != nil {
+		doc = data
+	}
+	err = compiled.Validate(doc)
+	if err == nil {
+		return plain(data), nil
+	}
+
+	result := &types.ArgumentsError{
+		Tool: tool,
+	}
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		for _, unit := range validationErr.BasicOutput().Errors {
+			if unit.Error != nil {
+				result.Errors = append(result.Errors, types.ArgumentError{
+					Path:    unit.InstanceLocation,
+					Message: unit.Error.String(),
+				})
+			}
+		}
+	}
+	if len(result.Errors) == 0 {
+		result.Errors = append(result.Errors, types.ArgumentError{
+			Message: err.Error(),
+		})
+	}
+	return nil, result
+}
+
+func compileSchema(schema json.RawMessage) (*jsonschema.Schema, error) {
+	compiledSchemasLock.Lock()
+	defer compiledSchemasLock.Unlock()
+
+	key := string(schema)
+	if compiled, ok := compiledSchemas[key]; ok {
+		return compiled.schema, compiled.err
+	}
+
+	var compiled compiledSchema
+	schemaDoc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schema))
+	if err == nil {
+		c := jsonschema.NewCompiler()
+		if err = c.AddResource("schema.json", schemaDoc); err == nil {
+			compiled.schema, err = c.Compile("schema.json")
+		}
+	}
+	compiled.err = err
+	compiledSchemas[key] = compiled
+	return compiled.schema, compiled.err
+}
+
+// coerce converts the value to a type of the schema if it has none of them. Schemas that combine other
+// schemas are left to the validation.
+func coerce(value any, schemaObj map[string]any) any {
+	allowed := schemaTypes(schemaObj)
+	if len(allowed) > 0 && !hasType(value, allowed) {
+		for _, t := range allowed {
+			if converted, ok := convert(value, t); ok {
+				value = converted
+				break
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schemaObj["properties"].(map[string]any)
+		additional, _ := schemaObj["additionalProperties"].(map[string]any)
+		for key, field := range v {
+			if propSchema, ok := properties[key].(map[string]any); ok {
+				v[key] = coerce(field, propSchema)
+			} else if additional != nil {
+				v[key] = coerce(field, additional)
+			}
+		}
+	case []any:
+		if items, ok := schemaObj["items"].(map[string]any); ok {
+			for i, item := range v {
+				v[i] = coerce(item, items)
+			}
+		}
+	}
+	return value
+}
+
+func schemaTypes(schemaObj map[string]any) []string {
+	switch t := schemaObj["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var result []string
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func hasType(value any, allowed []string) bool {
+	for _, t := range allowed {
+		switch v := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case json.Number:
+			if t == "number" {
+				return true
+			}
+			if _, err := v.Int64(); err == nil && t == "integer" {
+				return true
+			}
+		case []any:
+			if t == "array" {
+				return true
+			}
+		case map[string]any:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// convert returns the value as the type of the schema if it can be converted without guessing.
+func convert(value any, t string) (any, bool) {
+	switch v := value.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		switch t {
+		case "integer":
+			if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return json.Number(s), true
+			}
+		case "number":
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), true
+			}
+		case "boolean":
+			if strings.EqualFold(s, "true") || strings.EqualFold(s, "false") {
+				return strings.EqualFold(s, "true"), true
+			}
+		case "null":
+			if s == "null" {
+				return nil, true
+			}
+		case "array":
+			if strings.HasPrefix(s, "[") {
+				var result []any
+				if decodeNumbers(s, &result) == nil {
+					return result, true
+				}
+			}
+		case "object":
+			if strings.HasPrefix(s, "{") {
+				var result map[string]any
+				if decodeNumbers(s, &result) == nil {
+					return result, true
+				}
+			}
+		}
+	case json.Number:
+		switch t {
+		case "integer":
+			// 3.0 is an integer, 3.5 is not
+			if f, err := v.Float64(); err == nil && f == float64(int64(f)) {
+				return json.Number(strconv.FormatInt(int64(f), 10)), true
+			}
+		case "string":
+			return v.String(), true
+		}
+	case bool:
+		if t == "string" {
+			return strconv.FormatBool(v), true
+		}
+	}
+	if t == "array" && value != nil {
+		if _, ok := value.([]any); !ok {
+			return []any{value}, true
+		}
+	}
+	return nil, false
+}
+
+func decodeNumbers(data string, out any) error {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(out)
+}
+
+// plain returns the arguments with float64 numbers, as tools got them before they were validated.
+func plain(data map[string]any) map[string]any {
+	if data == nil {
+		return nil
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	var result map[string]any
+	if err := json.Unmarshal(encoded, &result); err != nil {
+		return data
+	}
+	return result
+}
@@ -2,9 +2,12 @@ package schema
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
 	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/santhosh-tekuri/jsonschema/v6"
 )
 
 // ValidateAndFixToolSchema validates and fixes tool input schemas to ensure they meet
@@ -53,3 +56,17 @@ func ValidateToolMappings(toolMappings types.ToolMappings) types.ToolMappings {
 	}
 	return validated
 }
+
+// ValidateJSON validates that data is JSON matching the JSON schema.
+func ValidateJSON(schema json.RawMessage, data string) error {
+	compiled, err := compileSchema(schema)
+	if err != nil {
+		return fmt.Errorf("invalid output schema: %w", err)
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(strings.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("output is not valid JSON: %w", err)
+	}
+	return compiled.Validate(doc)
+}
@@ -0,0 +1,36 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateJSON(t *testing.T) {
+	outputSchema := json.RawMessage(`{"type": "object", "properties": {"count": {"type": "integer"}}, "required": ["count"]}`)
+
+	tests := []struct {
+		name   string
+		schema json.RawMessage
+		data   string
+		valid  bool
+	}{
+		{name: "valid", schema: outputSchema, data: `{"count": 1}`, valid: true},
+		{name: "missing property", schema: outputSchema, data: `{}`},
+		{name: "not JSON", schema: outputSchema, data: `count: 1`},
+		{name: "invalid schema", schema: json.RawMessage(`{"type": 1}`), data: `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The second validation uses the cached schema
+			for range 2 {
+				if err := ValidateJSON(tt.schema, tt.data); (err == nil) != tt.valid {
+					t.Errorf("expected valid %v, got %v", tt.valid, err)
+				}
+			}
+		})
+	}
+
+	if _, ok := compiledSchemas[string(outputSchema)]; !ok {
+		t.Error("expected the compiled schema to be cached")
+	}
+}
@@ -0,0 +1,167 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+const (
+	JavaScript = "javascript"
+	Starlark   = "starlark"
+)
+
+// maxStarlarkSteps keeps a script that loops forever from spinning until the timeout when it is long.
+const maxStarlarkSteps = 100_000_000
+
+// Error is an error raised by the script, returned to the model so it can correct the call.
+type Error struct {
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Run runs the source as the body of a function with the parameters and args, a map of all arguments, as
+// its arguments, and returns the value the function returns.
+func Run(ctx context.Context, language, source string, params []string, args map[string]any, timeout time.Duration) (any, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	switch language {
+	case "", JavaScript:
+		return runJavaScript(ctx, source, params, args)
+	case Starlark:
+		return runStarlark(ctx, source, params, args)
+	default:
+		return nil, fmt.Errorf("unsupported script language %q", language)
+	}
+}
+
+func runJavaScript(ctx context.Context, source string, params []string, args map[string]any) (any, error) {
+	vm := goja.New()
+	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+
+	stop := context.AfterFunc(ctx, func() {
+		vm.Interrupt(ctx.Err())
+	})
+	defer stop()
+
+	fn, err := vm.RunString("(function(" + strings.Join(slices.Concat([]string{"args"}, params), ", ") + ") {\n" + source + "\n})")
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile script: %w", err)
+	}
+	call, ok := goja.AssertFunction(fn)
+	if !ok {
+		return nil, fmt.Errorf("failed to compile script: not a function")
+	}
+
+	values := []goja.Value{vm.ToValue(args)}
+	for _, param := range params {
+		values = append(values, vm.ToValue(args[param]))
+	}
+
+	ret, err := call(goja.Undefined(), values...)
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		return nil, fmt.Errorf("script did not finish: %w", ctx.Err())
+	} else if err != nil {
+		return nil, &Error{Err: err}
+	}
+	if goja.IsUndefined(ret) || goja.IsNull(ret) {
+		return nil, nil
+	}
+	return ret.Export(), nil
+}
+
+func runStarlark(ctx context.Context, source string, params []string, args map[string]any) (any, error) {
+	var body strings.Builder
+	body.WriteString("def _tool(" + strings.Join(slices.Concat([]string{"args"}, params), ", ") + "):\n")
+	for line := range strings.SplitSeq(source, "\n") {
+		body.WriteString("    " + line + "\n")
+	}
+
+	thread := &starlark.Thread{Name: "tool"}
+	thread.SetMaxExecutionSteps(maxStarlarkSteps)
+	stop := context.AfterFunc(ctx, func() {
+		thread.Cancel(ctx.Err().Error())
+	})
+	defer stop()
+
+	predeclared := starlark.StringDict{
+		"json": starlarkjson.Module,
+	}
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "tool.star", body.String(), predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile script: %w", err)
+	}
+
+	values := make(starlark.Tuple, 0, len(params)+1)
+	argsValue, err := toStarlark(args)
+	if err != nil {
+		return nil, err
+	}
+	values = append(values, argsValue)
+	for _, param := range params {
+		value, err := toStarlark(args[param])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	ret, err := starlark.Call(thread, globals["_tool"], values, nil)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("script did not finish: %w", ctx.Err())
+	} else if err != nil {
+		return nil, &Error{Err: err}
+	}
+	return fromStarlark(thread, ret)
+}
+
+// toStarlark converts the JSON value to starlark through the json module of starlark.
+func toStarlark(value any) (starlark.Value, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal arguments: %w", err)
+	}
+	decode := starlarkjson.Module.Members["decode"]
+	return starlark.Call(&starlark.Thread{}, decode, starlark.Tuple{starlark.String(data)}, nil)
+}
+
+func fromStarlark(thread *starlark.Thread, value starlark.Value) (any, error) {
+	switch value := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.String:
+		return string(value), nil
+	}
+
+	encode := starlarkjson.Module.Members["encode"]
+	data, err := starlark.Call(thread, encode, starlark.Tuple{value}, nil)
+	if err != nil {
+		return nil, &Error{Err: fmt.Errorf("failed to encode the result of the script: %w", err)}
+	}
+	var result any
+	if err := json.Unmarshal([]byte(string(data.(starlark.String))), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+)
+
+// awsSecretsManagerProvider reads secrets from AWS Secrets Manager using the standard AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and AWS_REGION environment variables. The reference is the
+// secret name or ARN, optionally followed by "#key" to read a field of a JSON secret.
+type awsSecretsManagerProvider struct{}
+
+func (awsSecretsManagerProvider) Get(ctx context.Context, ref string) (string, error) {
+	name, key := splitKey(ref)
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return "", fmt.Errorf("AWS_REGION is not set")
+	}
+
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return "", fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"SecretId": name,
+	})
+
+	host := "secretsmanager." + region + ".amazonaws.com"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signV4(req, body, host, region, "secretsmanager", accessKey, secretKey, time.Now().UTC())
+
+	resp, err := transport.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status from AWS Secrets Manager: %s %s", resp.Status, respBody)
+	}
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(respBody, &secret); err != nil {
+		return "", fmt.Errorf("failed to parse AWS Secrets Manager response: %w", err)
+	}
+
+	if key == "" {
+		return secret.SecretString, nil
+	}
+	return jsonField([]byte(secret.SecretString), key)
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header to the request.
+func signV4(req *http.Request, body []byte, host, region, service, accessKey, secretKey string, now time.Time) {
+	var (
+		amzDate = now.Format("20060102T150405Z")
+		date    = now.Format("20060102")
+		scope   = date + "/" + region + "/" + service + "/aws4_request"
+		headers = map[string]string{
+			"content-type": req.Header.Get("Content-Type"),
+			"host":         host,
+			"x-amz-date":   amzDate,
+			"x-amz-target": req.Header.Get("X-Amz-Target"),
+		}
+		canonical string
+	)
+
+	if token := req.Header.Get("X-Amz-Security-Token"); token != "" {
+		headers["x-amz-security-token"] = token
+	}
+
+	names := slices.Sorted(maps.Keys(headers))
+	for _, name := range names {
+		canonical += name + ":" + headers[name] + "\n"
+	}
+	signed := strings.Join(names, ";")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	canonicalRequest := req.Method + "\n/\n\n" + canonical + "\n" + signed + "\n" + sha256Hex(body)
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+signature)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+
+func TestSigningKey(t *testing.T) {
+	// The example of deriving a signing key in the AWS documentation
+	key := hmacSHA256([]byte("AWS4"+testSecretKey), "20120215")
+	key = hmacSHA256(key, "us-east-1")
+	key = hmacSHA256(key, "iam")
+	key = hmacSHA256(key, "aws4_request")
+	if expected := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"; hex.EncodeToString(key) != expected {
+		t.Errorf("expected signing key %s, got %x", expected, key)
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		signedHeaders string
+		signature     string
+	}{
+		{
+			name:          "access key",
+			signedHeaders: "content-type;host;x-amz-date;x-amz-target",
+			signature:     "ca7a376cafcb736144b73db77dfba8e8b2d67b3884ae0d9759295c4b52da2f1d",
+		},
+		{
+			name:          "session token",
+			token:         "session-token",
+			signedHeaders: "content-type;host;x-amz-date;x-amz-security-token;x-amz-target",
+			signature:     "c4c1a99fe66e7d4af7dbd9ee26bb1ea6179ccabe293b61e742e9ec67c8c3c12b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(`{"SecretId":"db"}`)
+			host := "secretsmanager.us-east-1.amazonaws.com"
+			req, err := http.NewRequest(http.MethodPost, "https://"+host+"/", strings.NewReader(string(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+			req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+			if tt.token != "" {
+				req.Header.Set("X-Amz-Security-Token", tt.token)
+			}
+
+			signV4(req, body, host, "us-east-1", "secretsmanager", "AKIDEXAMPLE", testSecretKey, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+			if date := req.Header.Get("X-Amz-Date"); date != "20150830T123600Z" {
+				t.Errorf("expected X-Amz-Date 20150830T123600Z, got %s", date)
+			}
+			expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/secretsmanager/aws4_request, " +
+				"SignedHeaders=" + tt.signedHeaders + ", Signature=" + tt.signature
+			if auth := req.Header.Get("Authorization"); auth != expected {
+				t.Errorf("expected Authorization\n%s\ngot\n%s", expected, auth)
+			}
+		})
+	}
+}
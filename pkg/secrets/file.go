@@ -0,0 +1,41 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// fileProvider reads secrets from files, such as docker or kubernetes secrets mounted at /run/secrets.
+// A "#key" suffix reads that field of a JSON file.
+type fileProvider struct{}
+
+func (fileProvider) Get(_ context.Context, ref string) (string, error) {
+	path, key := splitKey(ref)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return jsonField(data, key)
+}
+
+func jsonField(data []byte, key string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", fmt.Errorf("failed to parse secret as JSON to read key %q: %w", key, err)
+	}
+	val, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found in secret", key)
+	}
+	if s, ok := val.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(val)
+	return string(data), err
+}
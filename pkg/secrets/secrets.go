@@ -0,0 +1,110 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+)
+
+// Provider resolves a secret reference, the part after "<provider>:", to its value.
+type Provider interface {
+	Get(ctx context.Context, ref string) (string, error)
+}
+
+var (
+	providers = map[string]Provider{
+		"file":   fileProvider{},
+		"vault":  vaultProvider{},
+		"aws-sm": awsSecretsManagerProvider{},
+	}
+
+	// CacheTTL is how long a resolved secret is used before it is fetched again.
+	CacheTTL = 5 * time.Minute
+
+	cache     = map[string]cachedSecret{}
+	cacheLock sync.Mutex
+)
+
+type cachedSecret struct {
+	value   string
+	fetched time.Time
+}
+
+// IsReference returns true if name refers to a secret, for example "vault:secret/app#password",
+// "aws-sm:prod/app" or "file:/run/secrets/token".
+func IsReference(name string) bool {
+	provider, _, ok := strings.Cut(name, ":")
+	if !ok {
+		return false
+	}
+	_, ok = providers[provider]
+	return ok
+}
+
+// ParseExpression returns the secret reference if s is exactly one "${...}" expression of a secret.
+func ParseExpression(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "${") || !strings.HasSuffix(s, "}") {
+		return "", false
+	}
+	ref := s[2 : len(s)-1]
+	return ref, IsReference(ref)
+}
+
+// Resolve returns the value of the secret reference. Values are cached for CacheTTL. If refreshing an
+// expired value fails the previous value is returned.
+func Resolve(ctx context.Context, name string) (string, error) {
+	providerName, ref, _ := strings.Cut(name, ":")
+	provider, ok := providers[providerName]
+	if !ok {
+		return "", fmt.Errorf("unknown secrets provider %q", providerName)
+	}
+
+	cacheLock.Lock()
+	cached, ok := cache[name]
+	cacheLock.Unlock()
+
+	if ok && time.Since(cached.fetched) < CacheTTL {
+		return cached.value, nil
+	}
+
+	value, err := provider.Get(ctx, ref)
+	if err != nil {
+		if ok {
+			log.Errorf(ctx, "failed to refresh secret %s, using cached value: %v", name, err)
+			return cached.value, nil
+		}
+		return "", fmt.Errorf("failed to resolve secret %s: %w", name, err)
+	}
+
+	cacheLock.Lock()
+	cache[name] = cachedSecret{
+		value:   value,
+		fetched: time.Now(),
+	}
+	cacheLock.Unlock()
+
+	return value, nil
+}
+
+// Values returns the values of the secrets resolved so far, so that they can be redacted.
+func Values() []string {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	values := make([]string, 0, len(cache))
+	for _, cached := range cache {
+		values = append(values, cached.value)
+	}
+	return values
+}
+
+// splitKey splits "name#key" in to the name and the key of a JSON object field.
+func splitKey(ref string) (string, string) {
+	name, key, _ := strings.Cut(ref, "#")
+	return name, key
+}
@@ -223,6 +223,10 @@ func (s *Server) handleCallTool(ctx context.Context, msg mcp.Message, payload mc
 		}
 	}
 
+	if !types.NanobotContext(ctx).ToolAllowed(payload.Name, toolMapping.MCPServer, toolMapping.TargetName) {
+		return fmt.Errorf("not allowed to call tool %s", payload.Name)
+	}
+
 	result, err := s.runtime.Call(ctx, toolMapping.MCPServer, toolMapping.TargetName, payload.Arguments, tools.CallOptions{
 		ProgressToken: msg.ProgressToken(),
 		LogData: map[string]any{
@@ -235,8 +239,9 @@ func (s *Server) handleCallTool(ctx context.Context, msg mcp.Message, payload mc
 	}
 
 	mcpResult := mcp.CallToolResult{
-		IsError: result.IsError,
-		Content: result.Content,
+		IsError:           result.IsError,
+		Content:           result.Content,
+		StructuredContent: result.StructuredContent,
 	}
 
 	return msg.Reply(ctx, mcpResult)
@@ -252,8 +257,11 @@ func (s *Server) handleListTools(ctx context.Context, msg mcp.Message, _ mcp.Lis
 		return err
 	}
 
+	nctx := types.NanobotContext(ctx)
 	for _, k := range slices.Sorted(maps.Keys(toolMappings)) {
-		result.Tools = append(result.Tools, toolMappings[k].Target)
+		if nctx.ToolAllowed(k, toolMappings[k].MCPServer, toolMappings[k].TargetName) {
+			result.Tools = append(result.Tools, toolMappings[k].Target)
+		}
 	}
 
 	return msg.Reply(ctx, result)
@@ -268,8 +276,8 @@ type templateMatch struct {
 	resource mcp.ResourceTemplate
 }
 
-func getEnvVal(envMap map[string]string, envKey string, envDef types.EnvDef) string {
-	val, ok := expr.Lookup(envMap, envKey)
+func getEnvVal(ctx context.Context, envMap map[string]string, envKey string, envDef types.EnvDef) string {
+	val, ok := expr.Lookup(ctx, envMap, envKey)
 	if ok {
 		return val
 	}
@@ -288,11 +296,11 @@ func getEnvVal(envMap map[string]string, envKey string, envDef types.EnvDef) str
 	return envDef.Default
 }
 
-func reconcileEnv(session *mcp.Session, c types.Config) error {
+func reconcileEnv(ctx context.Context, session *mcp.Session, c types.Config) error {
 	envMap := session.GetEnvMap()
 	var missing []string
 	for envKey, envDef := range c.Env {
-		envVal := getEnvVal(envMap, envKey, envDef)
+		envVal := getEnvVal(ctx, envMap, envKey, envDef)
 		if envVal == "" && !envDef.Optional {
 			missing = append(missing, envKey)
 			continue
@@ -333,7 +341,7 @@ func (s *Server) handleInitialize(ctx context.Context, msg mcp.Message, payload
 	session := mcp.SessionFromContext(ctx)
 	c := types.ConfigFromContext(ctx)
 
-	if err := reconcileEnv(session, c); err != nil {
+	if err := reconcileEnv(ctx, session, c); err != nil {
 		return err
 	}
 
@@ -351,7 +359,7 @@ func (s *Server) handleInitialize(ctx context.Context, msg mcp.Message, payload
 	}
 
 	return msg.Reply(ctx, mcp.InitializeResult{
-		ProtocolVersion: payload.ProtocolVersion,
+		ProtocolVersion: mcp.NegotiateProtocolVersion(payload.ProtocolVersion),
 		Capabilities: mcp.ServerCapabilities{
 			Experimental: experimental,
 			//Logging:      &struct{}{},
@@ -371,7 +379,7 @@ func (s *Server) handleInitialize(ctx context.Context, msg mcp.Message, payload
 
 func (s *Server) OnMessage(ctx context.Context, msg mcp.Message) {
 	if err := s.data.Sync(ctx, s.config); err != nil {
-		msg.SendError(ctx, err)
+		msg.SendError(ctx, types.NewRPCError(err))
 		return
 	}
 
@@ -380,7 +388,7 @@ func (s *Server) OnMessage(ctx context.Context, msg mcp.Message) {
 	for _, h := range s.handlers {
 		ok, err := h(ctx, msg)
 		if err != nil {
-			msg.SendError(ctx, err)
+			msg.SendError(ctx, types.NewRPCError(err))
 			return
 		} else if ok {
 			return
@@ -0,0 +1,278 @@
+package a2a
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/a2a"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/version"
+)
+
+const pollInterval = time.Second
+
+var inputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "prompt": {
+      "type": "string",
+      "description": "The message to send to the agent"
+    }
+  },
+  "required": ["prompt"]
+}`)
+
+// Server serves one of the remote agents in the a2a of the config as an MCP server with a single tool of
+// the same name. The calls of a session continue the same A2A context.
+type Server struct {
+	name string
+
+	lock   sync.Mutex
+	client *a2a.Client
+}
+
+func NewServer(name string) *Server {
+	return &Server{
+		name: name,
+	}
+}
+
+// conversation is the A2A context of a session, and the task waiting for input if there is one.
+type conversation struct {
+	ContextID string `json:"contextId,omitempty"`
+	TaskID    string `json:"taskId,omitempty"`
+}
+
+func (s *Server) OnMessage(ctx context.Context, msg mcp.Message) {
+	switch msg.Method {
+	case "initialize":
+		mcp.Invoke(ctx, msg, s.initialize)
+	case "notifications/initialized":
+		// nothing to do
+	case "tools/list":
+		mcp.Invoke(ctx, msg, s.listTools)
+	case "tools/call":
+		mcp.Invoke(ctx, msg, s.call)
+	default:
+		msg.SendError(ctx, mcp.ErrRPCMethodNotFound.WithMessage("%s", msg.Method))
+	}
+}
+
+func (s *Server) initialize(_ context.Context, _ mcp.Message, params mcp.InitializeRequest) (*mcp.InitializeResult, error) {
+	return &mcp.InitializeResult{
+		ProtocolVersion: mcp.NegotiateProtocolVersion(params.ProtocolVersion),
+		Capabilities: mcp.ServerCapabilities{
+			Tools: &mcp.ToolsServerCapability{},
+		},
+		ServerInfo: mcp.ServerInfo{
+			Name:    version.Name,
+			Version: version.Get().String(),
+		},
+	}, nil
+}
+
+func (s *Server) agent(ctx context.Context) (types.A2AAgent, *a2a.Client, error) {
+	agent, ok := types.ConfigFromContext(ctx).A2A[s.name]
+	if !ok {
+		return agent, nil, fmt.Errorf("a2a agent %s not found in config", s.name)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.client == nil {
+		s.client = a2a.NewClient(agent.URL, agent.Headers)
+	}
+	return agent, s.client, nil
+}
+
+func (s *Server) listTools(ctx context.Context, _ mcp.Message, _ mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	agent, client, err := s.agent(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	description := agent.Description
+	if description == "" {
+		card, err := client.Card(ctx)
+		if err != nil {
+			return nil, err
+		}
+		description = card.Description
+	}
+
+	return &mcp.ListToolsResult{
+		Tools: []mcp.Tool{
+			{
+				Name:        s.name,
+				Description: description,
+				InputSchema: inputSchema,
+			},
+		},
+	}, nil
+}
+
+func (s *Server) call(ctx context.Context, _ mcp.Message, payload struct {
+	Name      string `json:"name"`
+	Arguments struct {
+		Prompt string `json:"prompt"`
+	} `json:"arguments"`
+}) (*mcp.CallToolResult, error) {
+	if payload.Name != s.name {
+		return nil, fmt.Errorf("unknown tool %s", payload.Name)
+	}
+
+	_, client, err := s.agent(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	session := mcp.SessionFromContext(ctx).Root()
+
+	var (
+		key  = "a2a/" + s.name
+		conv conversation
+	)
+	session.Get(key, &conv)
+
+	msg, task, err := client.SendMessage(ctx, a2a.MessageSendParams{
+		Message: a2a.Message{
+			Role: "user",
+			Parts: []a2a.Part{
+				{
+					Kind: "text",
+					Text: payload.Arguments.Prompt,
+				},
+			},
+			ContextID: conv.ContextID,
+			TaskID:    conv.TaskID,
+		},
+		Configuration: &a2a.MessageSendConfiguration{
+			AcceptedOutputModes: []string{"text/plain"},
+			Blocking:            true,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if msg != nil {
+		session.Set(key, conversation{
+			ContextID: msg.ContextID,
+		})
+		return toResult(msg.Parts, false), nil
+	}
+
+	task, err = wait(ctx, client, task)
+	if err != nil {
+		return nil, err
+	}
+
+	conv = conversation{
+		ContextID: task.ContextID,
+	}
+	if task.Status.State == a2a.TaskStateInputRequired {
+		conv.TaskID = task.ID
+	}
+	session.Set(key, conv)
+
+	return taskResult(task), nil
+}
+
+// wait polls the task until it is final, the task is canceled if ctx is done first.
+func wait(ctx context.Context, client *a2a.Client, task *a2a.Task) (*a2a.Task, error) {
+	for !task.Status.Final() {
+		select {
+		case <-ctx.Done():
+			_, _ = client.CancelTask(context.WithoutCancel(ctx), task.ID)
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+
+		next, err := client.GetTask(ctx, task.ID)
+		if err != nil {
+			return nil, err
+		}
+		task = next
+	}
+	return task, nil
+}
+
+func taskResult(task *a2a.Task) *mcp.CallToolResult {
+	var parts []a2a.Part
+	for _, artifact := range task.Artifacts {
+		parts = append(parts, artifact.Parts...)
+	}
+	if len(parts) == 0 && task.Status.Message != nil {
+		parts = task.Status.Message.Parts
+	}
+
+	switch task.Status.State {
+	case a2a.TaskStateFailed, a2a.TaskStateRejected, a2a.TaskStateCanceled, a2a.TaskStateAuthRequired:
+		if task.Status.Message != nil {
+			parts = task.Status.Message.Parts
+		}
+		if len(parts) == 0 {
+			parts = []a2a.Part{{Kind: "text", Text: "task " + task.Status.State}}
+		}
+		return toResult(parts, true)
+	case a2a.TaskStateInputRequired:
+		if task.Status.Message != nil {
+			parts = task.Status.Message.Parts
+		}
+	}
+	return toResult(parts, false)
+}
+
+func toResult(parts []a2a.Part, isError bool) *mcp.CallToolResult {
+	result := &mcp.CallToolResult{
+		IsError: isError,
+		Content: []mcp.Content{},
+	}
+	for _, part := range parts {
+		switch {
+		case part.Kind == "text":
+			result.Content = append(result.Content, mcp.Content{
+				Type: "text",
+				Text: part.Text,
+			})
+		case part.Kind == "data":
+			data, err := json.Marshal(part.Data)
+			if err != nil {
+				continue
+			}
+			result.Content = append(result.Content, mcp.Content{
+				Type: "text",
+				Text: string(data),
+			})
+		case part.Kind == "file" && part.File != nil && part.File.Bytes != "":
+			content := mcp.Content{
+				Type: "resource",
+				Resource: &mcp.EmbeddedResource{
+					URI:      part.File.Name,
+					MIMEType: part.File.MIMEType,
+					Blob:     part.File.Bytes,
+				},
+			}
+			if strings.HasPrefix(part.File.MIMEType, "image/") {
+				content = mcp.Content{
+					Type:     "image",
+					MIMEType: part.File.MIMEType,
+					Data:     part.File.Bytes,
+				}
+			}
+			result.Content = append(result.Content, content)
+		case part.Kind == "file" && part.File != nil:
+			result.Content = append(result.Content, mcp.Content{
+				Type: "resource_link",
+				URI:  part.File.URI,
+				Name: part.File.Name,
+			})
+		}
+	}
+	return result
+}
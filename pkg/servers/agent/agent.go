@@ -37,6 +37,7 @@ func NewServer(d *sessiondata.Data, r Caller, name string) *Server {
 
 	s.tools = mcp.NewServerTools(
 		chatCall{s: s},
+		resumeCall{s: s},
 	)
 
 	return s
@@ -104,12 +105,16 @@ func (s *Server) readProgress(ctx context.Context) (ret []mcp.ResourceContent, _
 		return nil, err
 	}
 
+	var usage progressUsage
+	session.Get(progressUsageSessionKey, &usage)
+
 	data, err := json.Marshal(types.AsyncCallResult{
 		IsError:       callResult.IsError,
 		Content:       callResult.Content,
 		InProgress:    progress.HasMore,
 		ToolName:      types.AgentTool,
 		ProgressToken: progress.ProgressToken,
+		Usage:         usage.total(),
 	})
 	if err != nil {
 		return nil, err
@@ -232,7 +237,7 @@ func (s *Server) initialize(ctx context.Context, _ mcp.Message, params mcp.Initi
 	}
 
 	return &mcp.InitializeResult{
-		ProtocolVersion: params.ProtocolVersion,
+		ProtocolVersion: mcp.NegotiateProtocolVersion(params.ProtocolVersion),
 		Capabilities: mcp.ServerCapabilities{
 			Tools:     &mcp.ToolsServerCapability{},
 			Prompts:   &mcp.PromptsServerCapability{},
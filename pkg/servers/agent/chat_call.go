@@ -7,11 +7,62 @@ import (
 	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tokens"
 	"github.com/nanobot-ai/nanobot/pkg/tools"
 	"github.com/nanobot-ai/nanobot/pkg/types"
 )
 
-const progressSessionKey = "progress"
+const (
+	progressSessionKey      = "progress"
+	progressUsageSessionKey = "progress/usage"
+)
+
+// progressUsage is the usage the providers reported for the completions of the running chat call.
+type progressUsage struct {
+	// Messages are the last usage of each completion, by message ID, the usage of a completion is
+	// cumulative.
+	Messages   map[string]types.CompletionProgress `json:"messages,omitempty"`
+	StopReason string                              `json:"stopReason,omitempty"`
+}
+
+func (p progressUsage) total() *types.UsageProgress {
+	if len(p.Messages) == 0 && p.StopReason == "" {
+		return nil
+	}
+	total := &types.UsageProgress{
+		StopReason: p.StopReason,
+	}
+	for _, progress := range p.Messages {
+		if progress.Usage != nil {
+			total.InputTokens += progress.Usage.InputTokens
+			total.OutputTokens += progress.Usage.OutputTokens
+		}
+		total.CostUSD += progress.CostUSD
+	}
+	return total
+}
+
+// appendUsage records the usage of a completion. The progress is passed on, so that clients of the
+// chat call get the usage as it is reported.
+func appendUsage(ctx context.Context, session *mcp.Session, progressMessage *mcp.Message, progress types.CompletionProgress) (*mcp.Message, error) {
+	var usage progressUsage
+	session.Get(progressUsageSessionKey, &usage)
+	if usage.Messages == nil {
+		usage.Messages = map[string]types.CompletionProgress{}
+	}
+	if progress.Usage != nil {
+		usage.Messages[progress.MessageID] = progress
+	}
+	if progress.StopReason != "" {
+		usage.StopReason = progress.StopReason
+	}
+	session.Set(progressUsageSessionKey, &usage)
+
+	_ = session.SendPayload(ctx, "notifications/resources/updated", map[string]any{
+		"uri": types.ProgressURI,
+	})
+	return progressMessage, nil
+}
 
 type chatCall struct {
 	s *Server
@@ -61,6 +112,10 @@ func appendProgress(ctx context.Context, session *mcp.Session, progressMessage *
 		return progressMessage, nil
 	}
 
+	if event.Meta.Progress.Usage != nil || event.Meta.Progress.StopReason != "" {
+		return appendUsage(ctx, session, progressMessage, *event.Meta.Progress)
+	}
+
 	progressItem := event.Meta.Progress.Item
 	session.Get(progressSessionKey, &response)
 	defer session.Set(progressSessionKey, &response)
@@ -77,7 +132,7 @@ func appendProgress(ctx context.Context, session *mcp.Session, progressMessage *
 			for itemIndex, item := range msg.Items {
 				if item.ToolCall != nil {
 					if item.ToolCall.CallID == progressItem.ToolCallResult.CallID {
-						response.InternalMessages[msgIndex].Items[itemIndex].ToolCallResult = progressItem.ToolCallResult
+						appendToolCallResult(&response.InternalMessages[msgIndex].Items[itemIndex], progressItem)
 					}
 				}
 			}
@@ -152,6 +207,23 @@ func appendProgress(ctx context.Context, session *mcp.Session, progressMessage *
 	return nil, nil
 }
 
+func appendToolCallResult(item *types.CompletionItem, progressItem types.CompletionItem) {
+	if !progressItem.Partial || item.ToolCallResult == nil {
+		item.ToolCallResult = progressItem.ToolCallResult
+		return
+	}
+
+	// Partial output streamed while the tool is running, the final result will replace it.
+	output := &item.ToolCallResult.Output
+	for _, content := range progressItem.ToolCallResult.Output.Content {
+		if last := len(output.Content) - 1; last >= 0 && output.Content[last].Type == "text" && content.Type == "text" {
+			output.Content[last].Text += content.Text
+		} else {
+			output.Content = append(output.Content, content)
+		}
+	}
+}
+
 func (c chatCall) Invoke(ctx context.Context, msg mcp.Message, payload mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	async := msg.Meta()[types.AsyncMetaKey]
 	if (async == "true" || async == true) && msg.ProgressToken() != nil {
@@ -178,7 +250,7 @@ func (c chatCall) Invoke(ctx context.Context, msg mcp.Message, payload mcp.CallT
 	return c.chatInvoke(ctx, msg, payload)
 }
 
-func (c chatCall) chatInvoke(ctx context.Context, msg mcp.Message, payload mcp.CallToolRequest) (_ *mcp.CallToolResult, retErr error) {
+func (c chatCall) chatInvoke(ctx context.Context, msg mcp.Message, payload mcp.CallToolRequest, opts ...tools.CallOptions) (_ *mcp.CallToolResult, retErr error) {
 	session := mcp.SessionFromContext(ctx).Parent
 
 	defer func() {
@@ -191,13 +263,14 @@ func (c chatCall) chatInvoke(ctx context.Context, msg mcp.Message, payload mcp.C
 	session.Set(progressSessionKey, &types.CompletionResponse{
 		ProgressToken: msg.ProgressToken(),
 	})
+	session.Set(progressUsageSessionKey, &progressUsage{})
 
-	result, err := c.s.runtime.Call(ctx, c.s.agentName, c.s.agentName, payload.Arguments, tools.CallOptions{
+	result, err := c.s.runtime.Call(ctx, c.s.agentName, c.s.agentName, payload.Arguments, append([]tools.CallOptions{{
 		ProgressToken: msg.ProgressToken(),
 		LogData: map[string]any{
 			"mcpToolName": payload.Name,
 		},
-	})
+	}}, opts...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -207,8 +280,9 @@ func (c chatCall) chatInvoke(ctx context.Context, msg mcp.Message, payload mcp.C
 	}
 
 	mcpResult := mcp.CallToolResult{
-		IsError: result.IsError,
-		Content: result.Content,
+		IsError:           result.IsError,
+		Content:           result.Content,
+		StructuredContent: result.StructuredContent,
 	}
 
 	err = msg.Reply(ctx, mcpResult)
@@ -219,6 +293,7 @@ func getMessages(ctx context.Context) ([]types.Message, error) {
 	var (
 		run         types.Execution
 		allMessages []types.Message
+		model       string
 	)
 
 	session := mcp.SessionFromContext(ctx)
@@ -226,12 +301,13 @@ func getMessages(ctx context.Context) ([]types.Message, error) {
 
 	if run.PopulatedRequest != nil {
 		allMessages = run.PopulatedRequest.Input
+		model = run.PopulatedRequest.Model
 	}
 	if run.Response != nil {
 		allMessages = append(allMessages, run.Response.Output)
 	}
 
-	return types.ConsolidateTools(allMessages), nil
+	return tokens.Annotate(model, types.ConsolidateTools(allMessages)), nil
 }
 
 type progressPayload struct {
@@ -0,0 +1,30 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tools"
+)
+
+// resumeCall continues the turn of the chat that was interrupted by a crash or restart of nanobot from its
+// checkpoint, for agents with checkpoint set.
+type resumeCall struct {
+	s *Server
+}
+
+func (c resumeCall) Definition() mcp.Tool {
+	return mcp.Tool{
+		Name:        "resume",
+		Description: "Resume the turn of the current agent that was interrupted by a restart, from its last completed tool call",
+		InputSchema: json.RawMessage(`{"type": "object", "properties": {}}`),
+	}
+}
+
+func (c resumeCall) Invoke(ctx context.Context, msg mcp.Message, payload mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	payload.Arguments = map[string]any{}
+	return chatCall{s: c.s}.chatInvoke(ctx, msg, payload, tools.CallOptions{
+		Resume: true,
+	})
+}
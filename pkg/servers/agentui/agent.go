@@ -30,6 +30,7 @@ func NewServer(d *sessiondata.Data, r Caller) *Server {
 	s.tools = mcp.NewServerTools(
 		setCurrentAgentCall{s: s},
 		chatCall{s: s},
+		regenerateCall{s: s},
 	)
 
 	return s
@@ -107,7 +108,7 @@ func (s *Server) initialize(ctx context.Context, _ mcp.Message, params mcp.Initi
 	//}
 	//
 	return &mcp.InitializeResult{
-		ProtocolVersion: params.ProtocolVersion,
+		ProtocolVersion: mcp.NegotiateProtocolVersion(params.ProtocolVersion),
 		Capabilities: mcp.ServerCapabilities{
 			Tools: &mcp.ToolsServerCapability{},
 		},
@@ -0,0 +1,116 @@
+package agentui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonschema"
+	"github.com/nanobot-ai/nanobot/pkg/branch"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tools"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+var regenerateInputSchema json.RawMessage
+
+type regenerateArgs struct {
+	MessageIndex *int     `json:"messageIndex,omitempty" jsonschema:"The index of a message of the response to regenerate, defaults to the last response"`
+	Model        string   `json:"model,omitempty" jsonschema:"The model to regenerate the response with, defaults to the model of the agent"`
+	Temperature  *float64 `json:"temperature,omitempty" jsonschema:"The temperature to regenerate the response with"`
+	TopP         *float64 `json:"topP,omitempty" jsonschema:"The top P value to regenerate the response with"`
+	MaxTokens    int      `json:"maxTokens,omitempty" jsonschema:"The maximum number of tokens of the regenerated response"`
+}
+
+func init() {
+	schema, err := jsonschema.For[regenerateArgs]()
+	if err != nil {
+		panic(fmt.Sprintf("failed to create regenerate input schema: %v", err))
+	}
+	regenerateInputSchema, err = json.Marshal(schema)
+	if err != nil {
+		panic(fmt.Sprintf("failed to marshal regenerate input schema: %v", err))
+	}
+}
+
+// regenerateCall forks the chat before a response of the current agent and generates the response again
+// on the new branch, so that clients can compare responses and switch back to the previous one.
+type regenerateCall struct {
+	s *Server
+}
+
+func (c regenerateCall) Definition() mcp.Tool {
+	return mcp.Tool{
+		Name:        "regenerate",
+		Description: "Generate a response of the current agent again on a new branch of the chat, optionally with another model or parameters",
+		InputSchema: regenerateInputSchema,
+	}
+}
+
+func (c regenerateCall) Invoke(ctx context.Context, msg mcp.Message, payload mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var args regenerateArgs
+	if err := mcp.JSONCoerce(payload.Arguments, &args); err != nil {
+		return nil, mcp.ErrRPCInvalidParams.WithMessage("invalid arguments: %v", err)
+	}
+
+	var run types.Execution
+	mcp.SessionFromContext(ctx).Get(types.PreviousExecutionKey, &run)
+	transcript := branch.Transcript(&run)
+
+	messageIndex := len(transcript)
+	if args.MessageIndex != nil {
+		messageIndex = *args.MessageIndex
+	}
+	if messageIndex < 0 || messageIndex > len(transcript) {
+		return nil, mcp.ErrRPCInvalidParams.WithMessage("message index %d is out of range, the chat has %d messages", messageIndex, len(transcript))
+	}
+
+	forked, err := branch.Fork(mcp.SessionFromContext(ctx), branch.TurnStart(transcript, messageIndex))
+	if err != nil {
+		return nil, mcp.ErrRPCInvalidParams.WithMessage("%v", err)
+	}
+
+	nctx := types.NanobotContext(ctx)
+	nctx.SkipResponseCache = true
+	ctx = types.WithNanobotContext(ctx, nctx)
+
+	currentAgent := c.s.data.CurrentAgent(ctx)
+	result, err := c.s.runtime.Call(ctx, currentAgent, currentAgent, types.SampleCallRequest{}, tools.CallOptions{
+		ProgressToken: msg.ProgressToken(),
+		AgentOverride: types.AgentCall{
+			Model:       args.Model,
+			Temperature: number(args.Temperature),
+			TopP:        number(args.TopP),
+			MaxTokens:   args.MaxTokens,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to regenerate response on branch %s: %w", forked.ID, err)
+	}
+
+	mcpResult := mcp.CallToolResult{
+		IsError: result.IsError,
+		Content: result.Content,
+	}
+	for i := range mcpResult.Content {
+		meta := maps.Clone(mcpResult.Content[i].Meta)
+		if meta == nil {
+			meta = map[string]any{}
+		}
+		meta[types.MetaPrefix+"branch"] = forked.ID
+		mcpResult.Content[i].Meta = meta
+	}
+
+	err = msg.Reply(ctx, mcpResult)
+	return &mcpResult, err
+}
+
+func number(value *float64) *json.Number {
+	if value == nil {
+		return nil
+	}
+	n := json.Number(strconv.FormatFloat(*value, 'f', -1, 64))
+	return &n
+}
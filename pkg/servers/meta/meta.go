@@ -23,7 +23,19 @@ func NewServer(data *sessiondata.Data) *Server {
 		mcp.NewServerTool("update_chat", "Update fields of a give chat thread", s.updateChat),
 		mcp.NewServerTool("create_chat", "Create a new chat thread", s.createChat),
 		mcp.NewServerTool("delete_chat", "Delete an existing chat thread", s.deleteChat),
+		mcp.NewServerTool("share_chat", "Create a link to a read-only view of a chat thread that expires", s.shareChat),
+		mcp.NewServerTool("unshare_chat", "Revoke all links to the read-only view of a chat thread", s.unshareChat),
 		mcp.NewServerTool("list_agents", "List available agents and their meta data", s.listAgents),
+		mcp.NewServerTool("flush_tool_cache", "Remove the cached tool results of the current session", s.flushToolCache),
+		mcp.NewServerTool("list_approvals", "List the tool calls the user approved or denied in the current session", s.listApprovals),
+		mcp.NewServerTool("rate_message", "Rate the response of a turn of the current session with a thumbs up or down, a comment and tags", s.rateMessage),
+		mcp.NewServerTool("list_guardrail_decisions", "List the guardrail decisions of the current session", s.listGuardrailDecisions),
+		mcp.NewServerTool("fork_chat", "Start a new branch of the current chat with the messages before a message index", s.forkChat),
+		mcp.NewServerTool("list_branches", "List the branches of the current chat", s.listBranches),
+		mcp.NewServerTool("switch_branch", "Make a branch of the current chat the current branch", s.switchBranch),
+		mcp.NewServerTool("list_conversations", "List the conversations that were started with a conversation ID", s.listConversations),
+		mcp.NewServerTool("resume_conversation", "Return the session, transcript and pending approvals of a conversation so it can be resumed", s.resumeConversation),
+		mcp.NewServerTool("delete_conversation", "Delete a conversation and its session", s.deleteConversation),
 		//mcp.NewServerTool("set_visibility", "Make the current thread public or private", s.setVisibility),
 		//mcp.NewServerTool("clone", "Clone the current session and return a new session ID", s.clone),
 	)
@@ -48,7 +60,7 @@ func (s *Server) OnMessage(ctx context.Context, msg mcp.Message) {
 
 func (s *Server) initialize(_ context.Context, _ mcp.Message, params mcp.InitializeRequest) (*mcp.InitializeResult, error) {
 	return &mcp.InitializeResult{
-		ProtocolVersion: params.ProtocolVersion,
+		ProtocolVersion: mcp.NegotiateProtocolVersion(params.ProtocolVersion),
 		Capabilities: mcp.ServerCapabilities{
 			Tools: &mcp.ToolsServerCapability{},
 		},
@@ -2,12 +2,19 @@ package meta
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/nanobot-ai/nanobot/pkg/analytics"
+	"github.com/nanobot-ai/nanobot/pkg/approval"
+	"github.com/nanobot-ai/nanobot/pkg/branch"
+	"github.com/nanobot-ai/nanobot/pkg/guardrails"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
 	"github.com/nanobot-ai/nanobot/pkg/session"
 	"github.com/nanobot-ai/nanobot/pkg/types"
 	"github.com/nanobot-ai/nanobot/pkg/uuid"
+	"gorm.io/gorm"
 )
 
 func (s *Server) deleteChat(ctx context.Context, data struct {
@@ -32,6 +39,65 @@ func (s *Server) deleteChat(ctx context.Context, data struct {
 	return &chat, nil
 }
 
+func (s *Server) shareChat(ctx context.Context, data struct {
+	ID        string `json:"chatId"`
+	ExpiresIn string `json:"expiresIn,omitempty"`
+}) (*session.Share, error) {
+	manager, accountID, err := s.getManagerAndAccountID(mcp.SessionFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var ttl time.Duration
+	if data.ExpiresIn != "" {
+		ttl, err = time.ParseDuration(data.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			return nil, mcp.ErrRPCInvalidParams.WithMessage("invalid expiresIn %q, expected a duration like 24h", data.ExpiresIn)
+		}
+	}
+
+	chatSession, err := manager.DB.GetByIDByAccountID(ctx, data.ID, accountID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, mcp.ErrRPCInvalidParams.WithMessage("chat %s not found", data.ID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	share, err := manager.Share(ctx, chatSession.SessionID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+type unshareChatResult struct {
+	Revoked int64 `json:"revoked"`
+}
+
+func (s *Server) unshareChat(ctx context.Context, data struct {
+	ID string `json:"chatId"`
+}) (*unshareChatResult, error) {
+	manager, accountID, err := s.getManagerAndAccountID(mcp.SessionFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	chatSession, err := manager.DB.GetByIDByAccountID(ctx, data.ID, accountID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, mcp.ErrRPCInvalidParams.WithMessage("chat %s not found", data.ID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	revoked, err := manager.Unshare(ctx, chatSession.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &unshareChatResult{
+		Revoked: revoked,
+	}, nil
+}
+
 func (s *Server) createChat(ctx context.Context, _ struct{}) (*types.Chat, error) {
 	mcpSession := mcp.SessionFromContext(ctx)
 	var (
@@ -114,6 +180,18 @@ func (s *Server) getManagerAndAccountID(mcpSession *mcp.Session) (*session.Manag
 	return &manager, accountID, nil
 }
 
+// ownerAccount returns the account of the owner of a session, which admins set to act on the sessions of
+// other users.
+func ownerAccount(ctx context.Context, accountID, owner string) (string, error) {
+	if owner == "" || owner == accountID {
+		return accountID, nil
+	}
+	if !types.NanobotContext(ctx).Admin {
+		return "", mcp.ErrRPCInvalidParams.WithMessage("only admins can access the conversations of other users")
+	}
+	return owner, nil
+}
+
 func (s *Server) listAgents(ctx context.Context, _ struct{}) (*types.AgentList, error) {
 	agents, err := s.data.Agents(ctx)
 	if err != nil {
@@ -124,7 +202,195 @@ func (s *Server) listAgents(ctx context.Context, _ struct{}) (*types.AgentList,
 	}, nil
 }
 
-func (s *Server) listChats(ctx context.Context, _ struct{}) (*types.ChatList, error) {
+type flushToolCacheResult struct {
+	Flushed int `json:"flushed"`
+}
+
+func (s *Server) flushToolCache(ctx context.Context, data struct {
+	Servers []string `json:"servers,omitempty"`
+}) (*flushToolCacheResult, error) {
+	return &flushToolCacheResult{
+		Flushed: s.data.FlushToolCache(ctx, data.Servers...),
+	}, nil
+}
+
+type listApprovalsResult struct {
+	Approvals approval.Audit   `json:"approvals"`
+	Pending   approval.Pending `json:"pending,omitempty"`
+}
+
+func (s *Server) listApprovals(ctx context.Context, _ struct{}) (*listApprovalsResult, error) {
+	return &listApprovalsResult{
+		Approvals: approval.GetAudit(mcp.SessionFromContext(ctx)),
+		Pending:   approval.GetPending(mcp.SessionFromContext(ctx)),
+	}, nil
+}
+
+func (s *Server) rateMessage(ctx context.Context, data struct {
+	MessageID string   `json:"messageId"`
+	Rating    string   `json:"rating"`
+	Comment   string   `json:"comment,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+}) (*analytics.Feedback, error) {
+	var accountID string
+	mcpSession := mcp.SessionFromContext(ctx)
+	mcpSession.Get(types.AccountIDSessionKey, &accountID)
+
+	feedback, err := analytics.AddFeedback(mcpSession, analytics.Feedback{
+		MessageID: data.MessageID,
+		Rating:    data.Rating,
+		Comment:   data.Comment,
+		Tags:      data.Tags,
+		UserID:    accountID,
+	})
+	if err != nil {
+		return nil, mcp.ErrRPCInvalidParams.WithMessage("%v", err)
+	}
+	return &feedback, nil
+}
+
+type listGuardrailDecisionsResult struct {
+	Decisions guardrails.Decisions `json:"decisions"`
+}
+
+func (s *Server) listGuardrailDecisions(ctx context.Context, _ struct{}) (*listGuardrailDecisionsResult, error) {
+	return &listGuardrailDecisionsResult{
+		Decisions: guardrails.GetDecisions(mcp.SessionFromContext(ctx)),
+	}, nil
+}
+
+type branchResult struct {
+	Branch   branch.Branch   `json:"branch"`
+	Messages []types.Message `json:"messages,omitempty"`
+}
+
+func (s *Server) forkChat(ctx context.Context, data struct {
+	MessageIndex int `json:"messageIndex"`
+}) (*branchResult, error) {
+	forked, err := branch.Fork(mcp.SessionFromContext(ctx), data.MessageIndex)
+	if err != nil {
+		return nil, mcp.ErrRPCInvalidParams.WithMessage("%v", err)
+	}
+	return branchResultOf(ctx, forked), nil
+}
+
+func (s *Server) switchBranch(ctx context.Context, data struct {
+	ID string `json:"branchId"`
+}) (*branchResult, error) {
+	current, err := branch.Switch(mcp.SessionFromContext(ctx), data.ID)
+	if err != nil {
+		return nil, mcp.ErrRPCInvalidParams.WithMessage("%v", err)
+	}
+	return branchResultOf(ctx, current), nil
+}
+
+func branchResultOf(ctx context.Context, current branch.Branch) *branchResult {
+	var run types.Execution
+	mcp.SessionFromContext(ctx).Get(types.PreviousExecutionKey, &run)
+	return &branchResult{
+		Branch:   current,
+		Messages: branch.Transcript(&run),
+	}
+}
+
+type listBranchesResult struct {
+	Branches []branch.Branch `json:"branches"`
+}
+
+func (s *Server) listBranches(ctx context.Context, _ struct{}) (*listBranchesResult, error) {
+	return &listBranchesResult{
+		Branches: branch.List(mcp.SessionFromContext(ctx)),
+	}, nil
+}
+
+func (s *Server) listConversations(ctx context.Context, data struct {
+	All bool `json:"all,omitempty"`
+}) (*types.ConversationList, error) {
+	manager, accountID, err := s.getManagerAndAccountID(mcp.SessionFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if data.All {
+		if !types.NanobotContext(ctx).Admin {
+			return nil, mcp.ErrRPCInvalidParams.WithMessage("only admins can list the conversations of all users")
+		}
+		accountID = ""
+	}
+
+	sessions, err := manager.DB.FindConversations(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := make([]types.Conversation, 0, len(sessions))
+	for _, s := range sessions {
+		conversations = append(conversations, s.Conversation())
+	}
+
+	return &types.ConversationList{
+		Conversations: conversations,
+	}, nil
+}
+
+// resumeConversation returns the state of a conversation. Clients resume it by sending the session ID in
+// the Mcp-Session-Id header or the conversation ID in the X-Nanobot-Conversation-Id header.
+func (s *Server) resumeConversation(ctx context.Context, data struct {
+	ID    string `json:"conversationId"`
+	Owner string `json:"owner,omitempty"`
+}) (*session.ResumedConversation, error) {
+	manager, accountID, err := s.getManagerAndAccountID(mcp.SessionFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	accountID, err = ownerAccount(ctx, accountID, data.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := manager.DB.GetByConversationID(ctx, accountID, data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, mcp.ErrRPCInvalidParams.WithMessage("conversation %s not found", data.ID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return stored.Resume()
+}
+
+func (s *Server) deleteConversation(ctx context.Context, data struct {
+	ID    string `json:"conversationId"`
+	Owner string `json:"owner,omitempty"`
+}) (*types.Conversation, error) {
+	manager, accountID, err := s.getManagerAndAccountID(mcp.SessionFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	accountID, err = ownerAccount(ctx, accountID, data.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := manager.DB.GetByConversationID(ctx, accountID, data.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, mcp.ErrRPCInvalidParams.WithMessage("conversation %s not found", data.ID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := manager.DB.Delete(ctx, stored.SessionID); err != nil {
+		return nil, err
+	}
+
+	conversation := stored.Conversation()
+	return &conversation, nil
+}
+
+func (s *Server) listChats(ctx context.Context, data struct {
+	All bool `json:"all,omitempty"`
+}) (*types.ChatList, error) {
 	mcpSession := mcp.SessionFromContext(ctx)
 
 	manager, accountID, err := s.getManagerAndAccountID(mcpSession)
@@ -132,7 +398,15 @@ func (s *Server) listChats(ctx context.Context, _ struct{}) (*types.ChatList, er
 		return nil, err
 	}
 
-	sessions, err := manager.DB.FindByAccount(ctx, "thread", accountID)
+	var sessions []session.Session
+	if data.All {
+		if !types.NanobotContext(ctx).Admin {
+			return nil, mcp.ErrRPCInvalidParams.WithMessage("only admins can list the chats of all users")
+		}
+		sessions, err = manager.DB.FindByType(ctx, "thread")
+	} else {
+		sessions, err = manager.DB.FindByAccount(ctx, "thread", accountID)
+	}
 	if err != nil {
 		return nil, err
 	}
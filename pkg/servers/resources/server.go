@@ -151,7 +151,7 @@ func (s *Server) OnMessage(ctx context.Context, msg mcp.Message) {
 
 func (s *Server) initialize(_ context.Context, _ mcp.Message, params mcp.InitializeRequest) (*mcp.InitializeResult, error) {
 	return &mcp.InitializeResult{
-		ProtocolVersion: params.ProtocolVersion,
+		ProtocolVersion: mcp.NegotiateProtocolVersion(params.ProtocolVersion),
 		Capabilities: mcp.ServerCapabilities{
 			Tools:     &mcp.ToolsServerCapability{},
 			Resources: &mcp.ResourcesServerCapability{},
@@ -17,8 +17,8 @@ func NewStore(db *gorm.DB) *Store {
 	return &Store{db: db}
 }
 
-func NewStoreFromDSN(dsn string) (*Store, error) {
-	db, err := gormdsn.NewDBFromDSN(dsn)
+func NewStoreFromDSN(dsn string, opts ...gormdsn.Options) (*Store, error) {
+	db, err := gormdsn.NewDBFromDSN(dsn, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,190 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/script"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/version"
+	"github.com/nanobot-ai/nanobot/pkg/wasm"
+)
+
+var defaultInputSchema = json.RawMessage(`{"type": "object"}`)
+
+// Server serves one of the tools in the tools of the config as an MCP server with a single tool of the
+// same name.
+type Server struct {
+	name string
+	wasm *wasm.Runtime
+}
+
+func NewServer(name string, wasm *wasm.Runtime) *Server {
+	return &Server{
+		name: name,
+		wasm: wasm,
+	}
+}
+
+func (s *Server) OnMessage(ctx context.Context, msg mcp.Message) {
+	switch msg.Method {
+	case "initialize":
+		mcp.Invoke(ctx, msg, s.initialize)
+	case "notifications/initialized":
+		// nothing to do
+	case "tools/list":
+		mcp.Invoke(ctx, msg, s.listTools)
+	case "tools/call":
+		mcp.Invoke(ctx, msg, s.call)
+	default:
+		msg.SendError(ctx, mcp.ErrRPCMethodNotFound.WithMessage("%s", msg.Method))
+	}
+}
+
+func (s *Server) initialize(_ context.Context, _ mcp.Message, params mcp.InitializeRequest) (*mcp.InitializeResult, error) {
+	return &mcp.InitializeResult{
+		ProtocolVersion: mcp.NegotiateProtocolVersion(params.ProtocolVersion),
+		Capabilities: mcp.ServerCapabilities{
+			Tools: &mcp.ToolsServerCapability{},
+		},
+		ServerInfo: mcp.ServerInfo{
+			Name:    version.Name,
+			Version: version.Get().String(),
+		},
+	}, nil
+}
+
+func (s *Server) tool(ctx context.Context) (types.Tool, error) {
+	tool, ok := types.ConfigFromContext(ctx).Tools[s.name]
+	if !ok {
+		return tool, fmt.Errorf("tool %s not found in config", s.name)
+	}
+	return tool, nil
+}
+
+func (s *Server) listTools(ctx context.Context, _ mcp.Message, _ mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	tool, err := s.tool(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := tool.Input.ToSchema()
+	if len(schema) == 0 {
+		schema = defaultInputSchema
+	}
+
+	return &mcp.ListToolsResult{
+		Tools: []mcp.Tool{
+			{
+				Name:        s.name,
+				Description: tool.Description,
+				InputSchema: schema,
+			},
+		},
+	}, nil
+}
+
+func (s *Server) call(ctx context.Context, _ mcp.Message, payload mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if payload.Name != s.name {
+		return nil, fmt.Errorf("unknown tool %s", payload.Name)
+	}
+
+	tool, err := s.tool(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	args := payload.Arguments
+	if args == nil {
+		args = map[string]any{}
+	}
+
+	if tool.Script != "" {
+		return s.runScript(ctx, tool, args)
+	}
+
+	input, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal arguments: %w", err)
+	}
+
+	output, err := s.wasm.Run(ctx, tool.WASM, wasm.RunOptions{
+		Name:      s.name,
+		Env:       tool.Env,
+		Stdin:     input,
+		Timeout:   tool.GetTimeout(),
+		MaxMemory: tool.GetMaxMemory(),
+	})
+	var exitErr *wasm.ExitError
+	if errors.As(err, &exitErr) {
+		// The tool failed, the model gets the error to correct the call.
+		return errorResult(exitErr.Error()), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return toResult(output), nil
+}
+
+func (s *Server) runScript(ctx context.Context, tool types.Tool, args map[string]any) (*mcp.CallToolResult, error) {
+	ret, err := script.Run(ctx, tool.Language, tool.Script, tool.Params(), args, tool.GetTimeout())
+	var scriptErr *script.Error
+	if errors.As(err, &scriptErr) {
+		return errorResult(scriptErr.Error()), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to run script of tool %s: %w", s.name, err)
+	}
+
+	switch ret := ret.(type) {
+	case nil:
+		return toResult(nil), nil
+	case string:
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				{
+					Type: "text",
+					Text: ret,
+				},
+			},
+		}, nil
+	}
+
+	output, err := json.Marshal(ret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the result of tool %s: %w", s.name, err)
+	}
+	return toResult(output), nil
+}
+
+// toResult returns the output of the tool as the result of the call. Tools can write a JSON call result
+// with content to return images and structured content, any other output is returned as text.
+func toResult(output []byte) *mcp.CallToolResult {
+	var result mcp.CallToolResult
+	if err := json.Unmarshal(output, &result); err == nil && len(result.Content) > 0 {
+		return &result
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			{
+				Type: "text",
+				Text: string(output),
+			},
+		},
+	}
+}
+
+func errorResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		IsError: true,
+		Content: []mcp.Content{
+			{
+				Type: "text",
+				Text: text,
+			},
+		},
+	}
+}
@@ -0,0 +1,278 @@
+package session
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/memory"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/workdir"
+	"gorm.io/gorm"
+)
+
+// ArchiveVersion is the version of the format of session archives.
+const ArchiveVersion = 1
+
+const (
+	manifestFile = "manifest.json"
+	sessionFile  = "session.json"
+	memoriesFile = "memories.json"
+	workdirDir   = "workdir/"
+)
+
+// Manifest describes a session archive.
+type Manifest struct {
+	Version   int       `json:"version"`
+	SessionID string    `json:"sessionID"`
+	Exported  time.Time `json:"exported"`
+	Memories  int       `json:"memories"`
+	Files     int       `json:"files"`
+}
+
+func workdirConfig(stored *Session) *types.Workdir {
+	if config := types.Config(stored.Config).Session.GetWorkdir(); config != nil {
+		return config
+	}
+	return &types.Workdir{}
+}
+
+// Export writes the session, its memories in the database, and the files of its working directory to w
+// as a tar archive.
+func (s *Store) Export(ctx context.Context, w io.Writer, stored *Session) (*Manifest, error) {
+	memories, err := memory.SessionRecords(ctx, s.db, stored.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memories of session %s: %w", stored.SessionID, err)
+	}
+
+	dir := workdir.Path(workdirConfig(stored), stored.SessionID)
+	var files []string
+	err = filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list working directory of session %s: %w", stored.SessionID, err)
+	}
+
+	manifest := &Manifest{
+		Version:   ArchiveVersion,
+		SessionID: stored.SessionID,
+		Exported:  time.Now().UTC(),
+		Memories:  len(memories),
+		Files:     len(files),
+	}
+
+	tw := tar.NewWriter(w)
+	for _, entry := range []struct {
+		name string
+		data any
+	}{
+		{manifestFile, manifest},
+		{sessionFile, stored},
+		{memoriesFile, memories},
+	} {
+		data, err := json.MarshalIndent(entry.data, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", entry.name, err)
+		}
+		if err := writeTarFile(tw, entry.name, manifest.Exported, data); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, file := range files {
+		if err := addTarFile(tw, dir, file); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write session archive: %w", err)
+	}
+	return manifest, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, modTime time.Time, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}); err != nil {
+		return fmt.Errorf("failed to write %s to session archive: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s to session archive: %w", name, err)
+	}
+	return nil
+}
+
+func addTarFile(tw *tar.Writer, dir, file string) error {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		return err
+	}
+	name := workdirDir + filepath.ToSlash(rel)
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s to session archive: %w", name, err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to write %s to session archive: %w", name, err)
+	}
+	return nil
+}
+
+// Import creates the session of an archive written by Export, with its memories and the files of its
+// working directory, which are extracted to the directory of the session in target. The session
+// keeps its ID, so it must not exist in the store.
+func (s *Store) Import(ctx context.Context, r io.Reader, target *types.Workdir) (*Session, *Manifest, error) {
+	if target == nil {
+		target = &types.Workdir{}
+	}
+
+	var (
+		tr       = tar.NewReader(r)
+		manifest *Manifest
+		stored   *Session
+		memories []memory.Record
+		dir      string
+	)
+
+	imported := false
+	defer func() {
+		// Files of an archive that could not be imported are removed
+		if !imported && dir != "" {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("failed to read session archive: %w", err)
+		}
+
+		switch {
+		case header.Name == manifestFile:
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, nil, fmt.Errorf("failed to read %s: %w", manifestFile, err)
+			}
+			if manifest.Version > ArchiveVersion {
+				return nil, nil, fmt.Errorf("session archive version %d is newer than the supported version %d", manifest.Version, ArchiveVersion)
+			}
+		case header.Name == sessionFile:
+			stored = &Session{}
+			if err := json.NewDecoder(tr).Decode(stored); err != nil {
+				return nil, nil, fmt.Errorf("failed to read %s: %w", sessionFile, err)
+			}
+			if !workdir.ValidID(stored.SessionID) {
+				return nil, nil, fmt.Errorf("%s has invalid session ID %q", sessionFile, stored.SessionID)
+			}
+			if _, err := s.Get(ctx, stored.SessionID); err == nil {
+				return nil, nil, fmt.Errorf("session %s already exists", stored.SessionID)
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, err
+			}
+		case header.Name == memoriesFile:
+			if err := json.NewDecoder(tr).Decode(&memories); err != nil {
+				return nil, nil, fmt.Errorf("failed to read %s: %w", memoriesFile, err)
+			}
+		case strings.HasPrefix(header.Name, workdirDir) && header.Typeflag == tar.TypeReg:
+			if stored == nil {
+				return nil, nil, fmt.Errorf("session archive has files before %s", sessionFile)
+			}
+			rel := strings.TrimPrefix(header.Name, workdirDir)
+			if !filepath.IsLocal(filepath.FromSlash(rel)) || path.Clean(rel) != rel {
+				return nil, nil, fmt.Errorf("session archive has invalid file name %q", header.Name)
+			}
+			if dir == "" {
+				dir = workdir.Path(target, stored.SessionID)
+			}
+			if err := extractTarFile(tr, header, filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if manifest == nil || stored == nil {
+		return nil, nil, fmt.Errorf("not a session archive, %s or %s is missing", manifestFile, sessionFile)
+	}
+
+	// The record is new in this store, and the replica that had it loaded is not known here
+	stored.Model = gorm.Model{
+		CreatedAt: stored.CreatedAt,
+		UpdatedAt: stored.UpdatedAt,
+	}
+	stored.Replica = ""
+	if config := types.Config(stored.Config); config.Session.GetWorkdir() != nil {
+		// The session finds its files in the working directory of this nanobot
+		sessionConfig := *config.Session
+		sessionConfig.Workdir = target
+		config.Session = &sessionConfig
+		stored.Config = ConfigWrapper(config)
+	}
+	if err := s.Create(ctx, stored); err != nil {
+		return nil, nil, fmt.Errorf("failed to create session %s: %w", stored.SessionID, err)
+	}
+
+	imported = true
+
+	if err := memory.AddSessionRecords(ctx, s.db, stored.SessionID, memories...); err != nil {
+		return nil, nil, fmt.Errorf("failed to import memories of session %s: %w", stored.SessionID, err)
+	}
+	return stored, manifest, nil
+}
+
+func extractTarFile(tr *tar.Reader, header *tar.Header, file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return fmt.Errorf("failed to create directory of %s: %w", file, err)
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, header.FileInfo().Mode().Perm()|0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", file, err)
+	}
+	if _, err := io.Copy(f, tr); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return os.Chtimes(file, header.ModTime, header.ModTime)
+}
@@ -0,0 +1,234 @@
+package session
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/memory"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/workdir"
+)
+
+func newArchiveStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := NewStoreFromDSN(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestArchive(t *testing.T) {
+	ctx := context.Background()
+	config := &types.Workdir{Dir: t.TempDir()}
+	stored := &Session{
+		SessionID: "s1",
+		Config:    ConfigWrapper(types.Config{Session: &types.SessionConfig{Workdir: config}}),
+	}
+
+	dir := workdir.Path(config, "s1")
+	if err := os.MkdirAll(filepath.Join(dir, "notes"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes", "todo.txt"), []byte("todo"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	source := newArchiveStore(t)
+	if err := source.Create(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	manifest, err := source.Export(ctx, &archive, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Files != 1 {
+		t.Errorf("expected 1 file, got %d", manifest.Files)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	target := newArchiveStore(t)
+	imported, _, err := target.Import(ctx, bytes.NewReader(archive.Bytes()), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.SessionID != "s1" {
+		t.Errorf("expected session s1, got %s", imported.SessionID)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "notes", "todo.txt")); err != nil || string(data) != "todo" {
+		t.Errorf("expected the file of the working directory, got %q, %v", data, err)
+	}
+
+	if _, _, err := target.Import(ctx, bytes.NewReader(archive.Bytes()), config); err == nil {
+		t.Error("expected an error importing an existing session")
+	}
+}
+
+// writeArchive writes a session archive with the manifest, the session, and the other files.
+func writeArchive(t *testing.T, session *Session, files map[string][]byte) *bytes.Buffer {
+	t.Helper()
+	data, err := json.Marshal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	write := func(name string, data []byte) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(manifestFile, []byte(`{"version":1}`))
+	write(sessionFile, data)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		write(name, files[name])
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &archive
+}
+
+func TestImportFileNames(t *testing.T) {
+	config := &types.Workdir{Dir: t.TempDir()}
+
+	tests := []struct {
+		name  string
+		file  string
+		valid bool
+	}{
+		{name: "file", file: "workdir/notes/todo.txt", valid: true},
+		{name: "parent", file: "workdir/../escaped.txt"},
+		{name: "nested parent", file: "workdir/notes/../../escaped.txt"},
+		{name: "absolute", file: "workdir//tmp/escaped.txt"},
+		{name: "not clean", file: "workdir/notes/./todo.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := writeArchive(t, &Session{SessionID: "s1"}, map[string][]byte{tt.file: []byte("data")})
+
+			_, _, err := newArchiveStore(t).Import(context.Background(), archive, config)
+			if tt.valid && err != nil {
+				t.Errorf("expected %s to be imported, got %v", tt.file, err)
+			} else if !tt.valid && err == nil {
+				t.Errorf("expected %s to be rejected", tt.file)
+			}
+			if _, err := os.Stat(filepath.Join(config.Dir, "escaped.txt")); err == nil {
+				t.Errorf("expected no file outside of the working directory")
+			}
+			if !tt.valid {
+				if _, err := os.Stat(workdir.Path(config, "s1")); err == nil {
+					t.Errorf("expected the files of the rejected archive to be removed")
+				}
+			}
+			_ = os.RemoveAll(workdir.Path(config, "s1"))
+		})
+	}
+}
+
+func TestImportSessionID(t *testing.T) {
+	parent := t.TempDir()
+	config := &types.Workdir{Dir: filepath.Join(parent, "sessions")}
+	if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	archiveConfig := &types.Workdir{Dir: filepath.Join(parent, "other")}
+
+	tests := []struct {
+		name      string
+		sessionID string
+	}{
+		{name: "empty"},
+		{name: "current", sessionID: "."},
+		{name: "parent", sessionID: ".."},
+		{name: "path", sessionID: "../other"},
+		{name: "changed by the sanitizer", sessionID: "s 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := writeArchive(t, &Session{
+				SessionID: tt.sessionID,
+				Config:    ConfigWrapper(types.Config{Session: &types.SessionConfig{Workdir: archiveConfig}}),
+			}, map[string][]byte{"workdir/escaped.txt": []byte("data")})
+
+			if _, _, err := newArchiveStore(t).Import(context.Background(), archive, config); err == nil {
+				t.Errorf("expected session ID %q to be rejected", tt.sessionID)
+			}
+			for _, file := range []string{filepath.Join(parent, "escaped.txt"), filepath.Join(config.Dir, "escaped.txt"), archiveConfig.Dir} {
+				if _, err := os.Stat(file); err == nil {
+					t.Errorf("expected no %s", file)
+				}
+			}
+			if _, err := os.Stat(config.Dir); err != nil {
+				t.Errorf("expected the sessions directory to be kept, got %v", err)
+			}
+		})
+	}
+
+	t.Run("workdir of the archive", func(t *testing.T) {
+		archive := writeArchive(t, &Session{
+			SessionID: "s1",
+			Config:    ConfigWrapper(types.Config{Session: &types.SessionConfig{Workdir: archiveConfig}}),
+		}, map[string][]byte{"workdir/todo.txt": []byte("data")})
+
+		imported, _, err := newArchiveStore(t).Import(context.Background(), archive, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(workdir.Path(config, "s1"), "todo.txt")); err != nil {
+			t.Errorf("expected the file in the working directory of the importing config, got %v", err)
+		}
+		if _, err := os.Stat(archiveConfig.Dir); err == nil {
+			t.Errorf("expected nothing in the working directory of the archive")
+		}
+		if dir := types.Config(imported.Config).Session.GetWorkdir().Dir; dir != config.Dir {
+			t.Errorf("expected the session to use the working directory %s, got %s", config.Dir, dir)
+		}
+	})
+}
+
+func TestImportMemoryNamespaces(t *testing.T) {
+	ctx := context.Background()
+	records, err := json.Marshal([]memory.Record{
+		{ID: "m1", Namespace: "agent/session/s1", Text: "own"},
+		{ID: "m2", Namespace: "agent/session/other", Text: "other session"},
+		{ID: "m3", Namespace: "agent/user/bob", Text: "other user"},
+		{ID: "m4", Namespace: "agent", Text: "all users"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newArchiveStore(t)
+	archive := writeArchive(t, &Session{SessionID: "s1"}, map[string][]byte{memoriesFile: records})
+	if _, _, err := store.Import(ctx, archive, &types.Workdir{Dir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+
+	var namespaces []string
+	if err := store.db.Table("memories").Order("id").Pluck("namespace", &namespaces).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces) != 4 {
+		t.Fatalf("expected 4 memories, got %v", namespaces)
+	}
+	for _, namespace := range namespaces {
+		if namespace != "agent/session/s1" {
+			t.Errorf("expected the memory in the namespace of the session, got %s", namespace)
+		}
+	}
+}
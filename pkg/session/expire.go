@@ -0,0 +1,155 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// EvictHook is called before an expired session is removed. The live session is nil if the
+// session is not currently loaded in this process. Returning an error keeps the session
+// around until the next reap.
+type EvictHook func(ctx context.Context, stored *Session, live *mcp.ServerSession) error
+
+type evictHooks struct {
+	lock  sync.RWMutex
+	hooks []EvictHook
+}
+
+// OnEvict registers a hook that is called before an expired session is removed, giving
+// callers a chance to persist or flush state held for the session.
+func (m *Manager) OnEvict(hook EvictHook) {
+	m.evictHooks.lock.Lock()
+	defer m.evictHooks.lock.Unlock()
+	m.evictHooks.hooks = append(m.evictHooks.hooks, hook)
+}
+
+func (m *Manager) Close() {
+	m.close()
+}
+
+// Shutdown stores the state of the sessions loaded in memory and closes them, which stops the MCP
+// servers they started. The sessions are not deleted, they are loaded again from the database by the
+// next request for them.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.liveSessionsLock.Lock()
+	live := m.liveSessions
+	m.liveSessions = make(map[string]liveSession)
+	m.liveSessionsLock.Unlock()
+
+	var errs []error
+	for id, session := range live {
+		if session.session == nil {
+			continue
+		}
+		if err := m.Store(ctx, id, session.session); err != nil {
+			errs = append(errs, fmt.Errorf("failed to store session %s: %w", id, err))
+		}
+		session.session.Close(false)
+	}
+
+	m.close()
+	return errors.Join(errs...)
+}
+
+func (m *Manager) sessionTTL(session *mcp.ServerSession) (time.Duration, error) {
+	var (
+		ttl    string
+		config types.Config
+	)
+
+	if session.GetSession().Get(types.SessionTTLSessionKey, &ttl) && ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return 0, fmt.Errorf("invalid session ttl %q: %w", ttl, err)
+		}
+		return d, nil
+	}
+
+	if session.GetSession().Get(types.ConfigSessionKey, &config) && config.Session != nil {
+		if d, err := config.Session.GetTTL(); err != nil || d > 0 {
+			return d, err
+		}
+	}
+
+	return m.ttl, nil
+}
+
+func (m *Manager) reap(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := m.evictExpired(m.ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Errorf(m.ctx, "failed to evict expired sessions: %v", err)
+		}
+	}
+}
+
+func (m *Manager) evictExpired(ctx context.Context) error {
+	if err := m.DB.DeleteExpiredShareLinks(ctx, time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired share links: %w", err)
+	}
+
+	expired, err := m.DB.FindExpired(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, stored := range expired {
+		if err := m.evict(ctx, &stored); err != nil {
+			errs = append(errs, fmt.Errorf("failed to evict session %s: %w", stored.SessionID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *Manager) evict(ctx context.Context, stored *Session) error {
+	m.liveSessionsLock.Lock()
+	live, ok := m.liveSessions[stored.SessionID]
+	if ok && live.count > 0 {
+		// The session is in use, it will get a new expiration when it is stored again.
+		m.liveSessionsLock.Unlock()
+		return nil
+	}
+	m.liveSessionsLock.Unlock()
+
+	m.evictHooks.lock.RLock()
+	hooks := m.evictHooks.hooks
+	m.evictHooks.lock.RUnlock()
+
+	for _, hook := range hooks {
+		if err := hook(ctx, stored, live.session); err != nil {
+			return err
+		}
+	}
+
+	if err := m.DB.Delete(ctx, stored.SessionID); err != nil {
+		return err
+	}
+
+	m.liveSessionsLock.Lock()
+	live, ok = m.liveSessions[stored.SessionID]
+	if ok && live.count == 0 {
+		delete(m.liveSessions, stored.SessionID)
+		live.session.Close(true)
+	}
+	m.liveSessionsLock.Unlock()
+
+	log.Debugf(ctx, "evicted expired session %s", stored.SessionID)
+	return nil
+}
@@ -12,25 +12,75 @@ import (
 	"sync"
 	"time"
 
+	"github.com/nanobot-ai/nanobot/pkg/approval"
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/gormdsn"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
 	"github.com/nanobot-ai/nanobot/pkg/types"
 	"gorm.io/gorm"
 )
 
-func NewManager(dsn string) (*Manager, error) {
-	store, err := NewStoreFromDSN(dsn)
+// ConversationIDHeader is the header clients set to a conversation ID of their own choosing. A request
+// with a known conversation ID resumes its session, otherwise the new session is stored with the ID.
+const ConversationIDHeader = "X-Nanobot-Conversation-Id"
+
+type ManagerOptions struct {
+	DBOptions gormdsn.Options
+	// TTL is the default time an idle session is kept before it expires. It can be overridden by
+	// the session config or per session. Zero means sessions never expire.
+	TTL time.Duration
+	// ReapInterval is how often expired sessions are looked for. Defaults to one minute.
+	ReapInterval time.Duration
+	// ReplicaURL is the URL other replicas reach this process at. When set, requests of sessions that
+	// another replica has loaded are forwarded to it.
+	ReplicaURL string
+	// ShareKey signs the share links of chats. Without a key a random one is used, so links are only
+	// valid until the process restarts. It is required with a ReplicaURL, all replicas must use the
+	// same key.
+	ShareKey string
+}
+
+func (m ManagerOptions) Merge(other ManagerOptions) (result ManagerOptions) {
+	result.DBOptions = m.DBOptions.Merge(other.DBOptions)
+	result.TTL = complete.Last(m.TTL, other.TTL)
+	result.ReapInterval = complete.Last(m.ReapInterval, other.ReapInterval)
+	result.ReplicaURL = complete.Last(m.ReplicaURL, other.ReplicaURL)
+	result.ShareKey = complete.Last(m.ShareKey, other.ShareKey)
+	return
+}
+
+func (m ManagerOptions) Complete() ManagerOptions {
+	if m.ReapInterval == 0 {
+		m.ReapInterval = time.Minute
+	}
+	return m
+}
+
+func NewManager(dsn string, opts ...ManagerOptions) (*Manager, error) {
+	opt := complete.Complete(opts...)
+	if opt.ReplicaURL != "" && opt.ShareKey == "" {
+		return nil, fmt.Errorf("a share key is required with a replica URL, so that share links are valid on all replicas")
+	}
+
+	store, err := NewStoreFromDSN(dsn, opt.DBOptions)
 	if err != nil {
 		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Manager{
+	m := &Manager{
 		ctx:          ctx,
 		close:        cancel,
 		DB:           store,
 		root:         &Session{},
 		liveSessions: make(map[string]liveSession),
-	}, nil
+		ttl:          opt.TTL,
+		evictHooks:   &evictHooks{},
+		replicaURL:   strings.TrimSuffix(opt.ReplicaURL, "/"),
+		shareKey:     newShareKey(opt.ShareKey),
+	}
+	go m.reap(opt.ReapInterval)
+	return m, nil
 }
 
 type Manager struct {
@@ -38,9 +88,14 @@ type Manager struct {
 	close context.CancelFunc
 	DB    *Store
 	root  *Session
+	ttl   time.Duration
+	// replicaURL is the URL of this replica, empty if it is the only one.
+	replicaURL string
+	shareKey   []byte
 
 	liveSessionsLock sync.Mutex
 	liveSessions     map[string]liveSession
+	evictHooks       *evictHooks
 }
 
 type liveSession struct {
@@ -64,6 +119,8 @@ func (m *Manager) loadAttributesFromRecord(stored *Session, session *mcp.ServerS
 	session.GetSession().Set(types.DescriptionSessionKey, stored.Description)
 	session.GetSession().Set(types.PublicSessionKey, stored.IsPublic)
 	session.GetSession().Set(types.AccountIDSessionKey, stored.AccountID)
+	session.GetSession().Set(types.ConversationIDSessionKey, stored.ConversationID)
+	session.GetSession().Set(types.WorkspaceSessionKey, stored.Workspace)
 }
 
 func (m *Manager) saveAttributesToRecord(stored *Session, session *mcp.ServerSession) error {
@@ -71,6 +128,7 @@ func (m *Manager) saveAttributesToRecord(stored *Session, session *mcp.ServerSes
 
 	session.GetSession().Get(types.DescriptionSessionKey, &stored.Description)
 	session.GetSession().Get(types.PublicSessionKey, &stored.IsPublic)
+	session.GetSession().Get(types.WorkspaceSessionKey, &stored.Workspace)
 	session.GetSession().Get(types.ConfigSessionKey, &config)
 
 	stored.Config = ConfigWrapper(config)
@@ -89,6 +147,9 @@ func (m *Manager) Store(ctx context.Context, id string, session *mcp.ServerSessi
 	stored, err := m.DB.Get(ctx, id)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		stored = m.newRecord(id, accountID)
+		if req := mcp.RequestFromContext(ctx); req != nil {
+			stored.ConversationID = req.Header.Get(ConversationIDHeader)
+		}
 		create = true
 	} else if err != nil {
 		return err
@@ -107,6 +168,20 @@ func (m *Manager) Store(ctx context.Context, id string, session *mcp.ServerSessi
 		return fmt.Errorf("failed to get session state: %w", err)
 	}
 	stored.State = *(*State)(state)
+	if m.replicaURL != "" {
+		stored.Replica = m.replicaURL
+	}
+
+	ttl, err := m.sessionTTL(session)
+	if err != nil {
+		return err
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		stored.ExpiresAt = &expiresAt
+	} else {
+		stored.ExpiresAt = nil
+	}
 
 	if create {
 		if err := m.DB.Create(ctx, stored); err != nil {
@@ -149,6 +224,14 @@ func (m *Manager) ExtractID(req *http.Request) string {
 	if id != "" {
 		return id
 	}
+	if conversationID := req.Header.Get(ConversationIDHeader); conversationID != "" {
+		stored, err := m.DB.GetByConversationID(req.Context(), types.NanobotContext(req.Context()).User.ID, conversationID)
+		if err != nil {
+			// Unknown conversations start a new session
+			return ""
+		}
+		return stored.SessionID
+	}
 	parts := strings.Split(req.URL.Path, "/")
 	for i, part := range parts {
 		if i > 0 && parts[i-1] == "agents" {
@@ -161,6 +244,12 @@ func (m *Manager) ExtractID(req *http.Request) string {
 	return ""
 }
 
+// IsNewSession returns true if the request does not refer to a session, by a header, its path or the
+// cookie of the UI.
+func (m *Manager) IsNewSession(req *http.Request) bool {
+	return getCookieID(req) == "" && m.ExtractID(req) == ""
+}
+
 func checkAccount(ctx context.Context, serverSession *mcp.ServerSession) bool {
 	var (
 		account        string
@@ -227,6 +316,13 @@ func (m *Manager) Acquire(ctx context.Context, server mcp.MessageHandler, id str
 	return serverSession, true, err
 }
 
+// LiveSessions returns the number of sessions currently loaded in memory.
+func (m *Manager) LiveSessions() int {
+	m.liveSessionsLock.Lock()
+	defer m.liveSessionsLock.Unlock()
+	return len(m.liveSessions)
+}
+
 func (m *Manager) Release(session *mcp.ServerSession) {
 	m.liveSessionsLock.Lock()
 	defer m.liveSessionsLock.Unlock()
@@ -266,6 +362,8 @@ func (m *Manager) loadSessionFromDatabase(ctx context.Context, server mcp.Messag
 	if storedSession.State.Attributes == nil {
 		storedSession.State.Attributes = make(map[string]any)
 	} else {
+		// No call of this process waits for the approvals that were pending when the session was stored.
+		delete(storedSession.State.Attributes, approval.PendingSessionKey)
 		storedSession.State.Attributes[".keys"] = slices.Collect(maps.Keys(storedSession.State.Attributes))
 	}
 
@@ -0,0 +1,122 @@
+package session
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+)
+
+const (
+	// ReplicaHeader is set on responses to the URL of the replica that served them. Load balancers can
+	// use it to send the following requests of a session to the same replica.
+	ReplicaHeader = "X-Nanobot-Replica"
+	// forwardedHeader marks requests a replica forwarded to the replica of their session, they are
+	// served without being forwarded again.
+	forwardedHeader = "X-Nanobot-Forwarded-By"
+)
+
+// forwardTransport fails fast on replicas that are gone, so that their sessions are taken over quickly.
+var forwardTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   3 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConnsPerHost: 16,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// Route forwards the requests of sessions that another replica stored last to that replica, so that a
+// session is only loaded by one replica at a time and its event streams and pending requests stay in
+// one process. If the replica can not be reached the session is served, and so taken over, by this
+// replica. Without a replica URL requests are always served by next.
+func (m *Manager) Route(next http.Handler) http.Handler {
+	if m.replicaURL == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		owner := m.replicaOf(req)
+		if owner == "" {
+			rw.Header().Set(ReplicaHeader, m.replicaURL)
+			next.ServeHTTP(rw, req)
+			return
+		}
+		m.forward(rw, req, owner, next)
+	})
+}
+
+// replicaOf returns the URL of the other replica that has the session of the request, or an empty
+// string if this replica serves it.
+func (m *Manager) replicaOf(req *http.Request) string {
+	if req.Header.Get(forwardedHeader) != "" {
+		return ""
+	}
+
+	id := m.ExtractID(req)
+	if id == "" {
+		id = getCookieID(req)
+	}
+	if id == "" {
+		return ""
+	}
+
+	m.liveSessionsLock.Lock()
+	_, live := m.liveSessions[id]
+	m.liveSessionsLock.Unlock()
+	if live {
+		return ""
+	}
+
+	stored, err := m.DB.Get(req.Context(), id)
+	if err != nil || stored.Replica == m.replicaURL {
+		return ""
+	}
+	return stored.Replica
+}
+
+func (m *Manager) forward(rw http.ResponseWriter, req *http.Request, owner string, next http.Handler) {
+	target, err := url.Parse(owner)
+	if err != nil {
+		log.Errorf(req.Context(), "invalid replica URL %q, serving the request here: %v", owner, err)
+		rw.Header().Set(ReplicaHeader, m.replicaURL)
+		next.ServeHTTP(rw, req)
+		return
+	}
+
+	// Keep the body so the request can still be served here if the replica is gone
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(rw, "failed to read body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.Host = r.In.Host
+			r.Out.Header.Set(forwardedHeader, m.replicaURL)
+		},
+		Transport: forwardTransport,
+		// Event streams are written as they come
+		FlushInterval: -1,
+		// The request passed to the error handler is the forwarded one, serve the original
+		ErrorHandler: func(rw http.ResponseWriter, _ *http.Request, err error) {
+			log.Infof(req.Context(), "replica %s is not reachable, taking over its session: %v", owner, err)
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			rw.Header().Set(ReplicaHeader, m.replicaURL)
+			next.ServeHTTP(rw, req)
+		},
+	}
+	proxy.ServeHTTP(rw, req)
+}
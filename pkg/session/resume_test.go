@@ -0,0 +1,49 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/approval"
+)
+
+func TestPendingApprovals(t *testing.T) {
+	ctx := context.Background()
+	m := newShareManager(t, filepath.Join(t.TempDir(), "sessions.db"), "key")
+
+	if err := m.DB.Create(ctx, &Session{
+		SessionID: "s1",
+		State: State{
+			Attributes: map[string]any{
+				approval.PendingSessionKey: approval.Pending{
+					{ID: "waiting", Tool: "deploy", Time: time.Now()},
+					{ID: "expired", Tool: "deploy", Time: time.Now().Add(-approval.ConfirmTimeout)},
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := m.DB.Get(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := stored.Resume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed.PendingApprovals) != 1 || resumed.PendingApprovals[0].ID != "waiting" {
+		t.Errorf("expected only the unexpired approval, got %+v", resumed.PendingApprovals)
+	}
+
+	loaded, found, err := m.loadSessionFromDatabase(ctx, nil, "s1")
+	if err != nil || !found {
+		t.Fatalf("expected the session to load, got %v", err)
+	}
+	if pending := approval.GetPending(loaded.GetSession()); len(pending) != 0 {
+		t.Errorf("expected no pending approvals in the loaded session, got %+v", pending)
+	}
+}
@@ -0,0 +1,186 @@
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+	"gorm.io/gorm"
+)
+
+// SharePathPrefix is the path of the read-only views of shared chats, followed by the share token.
+const SharePathPrefix = "/api/shares/"
+
+// DefaultShareTTL is how long a share link is valid if no expiry is requested.
+const DefaultShareTTL = 7 * 24 * time.Hour
+
+var errInvalidShareToken = errors.New("invalid or expired share link")
+
+// Share is a link to the read-only view of a chat.
+type Share struct {
+	Token     string    `json:"token"`
+	Path      string    `json:"path"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// SharedChat is the read-only view of a chat that a share link returns.
+type SharedChat struct {
+	Title     string          `json:"title,omitempty"`
+	Agent     string          `json:"agent,omitempty"`
+	Created   time.Time       `json:"created"`
+	Updated   time.Time       `json:"updated"`
+	ExpiresAt time.Time       `json:"expiresAt"`
+	Messages  []types.Message `json:"messages,omitempty"`
+}
+
+type shareClaims struct {
+	// ID is the ShareID of the ShareLink of the token, deleting the link revokes the token.
+	ID        string `json:"id"`
+	SessionID string `json:"sid"`
+	Expires   int64  `json:"exp"`
+}
+
+func newShareKey(key string) []byte {
+	if key != "" {
+		return []byte(key)
+	}
+	random := make([]byte, 32)
+	_, _ = rand.Read(random)
+	return random
+}
+
+// Share returns a link to the read-only view of the session that is valid for ttl, or until the links of
+// the session are revoked with Unshare.
+func (m *Manager) Share(ctx context.Context, sessionID string, ttl time.Duration) (Share, error) {
+	if ttl <= 0 {
+		ttl = DefaultShareTTL
+	}
+	expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+
+	link := &ShareLink{
+		ShareID:   uuid.String(),
+		SessionID: sessionID,
+		ExpiresAt: expiresAt,
+	}
+	if err := m.DB.CreateShareLink(ctx, link); err != nil {
+		return Share{}, fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	payload, err := json.Marshal(shareClaims{
+		ID:        link.ShareID,
+		SessionID: sessionID,
+		Expires:   expiresAt.Unix(),
+	})
+	if err != nil {
+		return Share{}, fmt.Errorf("failed to marshal share token: %w", err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(m.signShare(payload))
+	return Share{
+		Token:     token,
+		Path:      SharePathPrefix + token,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (m *Manager) signShare(payload []byte) []byte {
+	mac := hmac.New(sha256.New, m.shareKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// GetShared returns the read-only view of the session of a share token.
+func (m *Manager) GetShared(ctx context.Context, token string) (*SharedChat, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errInvalidShareToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, errInvalidShareToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, m.signShare(payload)) {
+		return nil, errInvalidShareToken
+	}
+
+	var claims shareClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.SessionID == "" || claims.ID == "" {
+		return nil, errInvalidShareToken
+	}
+	expiresAt := time.Unix(claims.Expires, 0).UTC()
+	if time.Now().After(expiresAt) {
+		return nil, errInvalidShareToken
+	}
+
+	link, err := m.DB.GetShareLink(ctx, claims.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && link.SessionID != claims.SessionID {
+		return nil, errInvalidShareToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	stored, err := m.DB.Get(ctx, claims.SessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidShareToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	messages, err := stored.Transcript()
+	if err != nil {
+		return nil, err
+	}
+
+	conversation := stored.Conversation()
+	return &SharedChat{
+		Title:     conversation.Title,
+		Agent:     conversation.Agent,
+		Created:   conversation.Created,
+		Updated:   conversation.Updated,
+		ExpiresAt: expiresAt,
+		Messages:  messages,
+	}, nil
+}
+
+// Unshare revokes all share links of the session and returns how many were revoked.
+func (m *Manager) Unshare(ctx context.Context, sessionID string) (int64, error) {
+	revoked, err := m.DB.DeleteShareLinks(ctx, sessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke share links: %w", err)
+	}
+	return revoked, nil
+}
+
+// ShareHandler serves the read-only views of shared chats. The signed token in the path is the only
+// credential, the view can not run tools or start turns.
+func ShareHandler(m *Manager) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		shared, err := m.GetShared(req.Context(), req.PathValue("token"))
+		if errors.Is(err, errInvalidShareToken) {
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Cache-Control", "private, no-store")
+		rw.Header().Set("Referrer-Policy", "no-referrer")
+		if err := json.NewEncoder(rw).Encode(shared); err != nil {
+			log.Errorf(req.Context(), "failed to write shared chat: %v", err)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newShareManager(t *testing.T, dsn, key string) *Manager {
+	t.Helper()
+	m, err := NewManager(dsn, ManagerOptions{ShareKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestShare(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "sessions.db")
+	m := newShareManager(t, dsn, "key")
+
+	if err := m.DB.Create(ctx, &Session{SessionID: "s1", AccountID: "alice", Description: "A chat"}); err != nil {
+		t.Fatal(err)
+	}
+
+	share, err := m.Share(ctx, "s1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if share.Path != SharePathPrefix+share.Token {
+		t.Errorf("expected path %s, got %s", SharePathPrefix+share.Token, share.Path)
+	}
+
+	shared, err := m.GetShared(ctx, share.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared.Title != "A chat" {
+		t.Errorf("expected title %q, got %q", "A chat", shared.Title)
+	}
+
+	payload, signature, _ := strings.Cut(share.Token, ".")
+	claims, _ := base64.RawURLEncoding.DecodeString(payload)
+	otherSession := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(claims), `"sid":"s1"`, `"sid":"s2"`, 1)))
+
+	expired, err := json.Marshal(shareClaims{ID: "expired", SessionID: "s1", Expires: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		manager *Manager
+		token   string
+	}{
+		{name: "altered", manager: m, token: otherSession + "." + signature},
+		{name: "not signed", manager: m, token: payload},
+		{name: "other key", manager: newShareManager(t, dsn, "other key"), token: share.Token},
+		{name: "expired", manager: m, token: base64.RawURLEncoding.EncodeToString(expired) + "." + base64.RawURLEncoding.EncodeToString(m.signShare(expired))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.manager.GetShared(ctx, tt.token); !errors.Is(err, errInvalidShareToken) {
+				t.Errorf("expected %v, got %v", errInvalidShareToken, err)
+			}
+		})
+	}
+
+	t.Run("same key", func(t *testing.T) {
+		if _, err := newShareManager(t, dsn, "key").GetShared(ctx, share.Token); err != nil {
+			t.Errorf("expected the link to be valid with the same key, got %v", err)
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		revoked, err := m.Unshare(ctx, "s1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked != 1 {
+			t.Errorf("expected 1 revoked link, got %d", revoked)
+		}
+		if _, err := m.GetShared(ctx, share.Token); !errors.Is(err, errInvalidShareToken) {
+			t.Errorf("expected %v, got %v", errInvalidShareToken, err)
+		}
+	})
+}
+
+func TestShareKeyRequiredWithReplicas(t *testing.T) {
+	_, err := NewManager(filepath.Join(t.TempDir(), "sessions.db"), ManagerOptions{ReplicaURL: "http://replica1:8080"})
+	if err == nil {
+		t.Fatal("expected an error without a share key")
+	}
+}
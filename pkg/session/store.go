@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/gormdsn"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
@@ -26,13 +27,13 @@ func NewStore(db *gorm.DB) *Store {
 	return &Store{db: db}
 }
 
-func NewStoreFromDSN(dsn string) (*Store, error) {
-	db, err := gormdsn.NewDBFromDSN(dsn)
+func NewStoreFromDSN(dsn string, opts ...gormdsn.Options) (*Store, error) {
+	db, err := gormdsn.NewDBFromDSN(dsn, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create database connection: %w", err)
 	}
 
-	if err := db.AutoMigrate(&Session{}, &Token{}); err != nil {
+	if err := db.AutoMigrate(&Session{}, &Token{}, &ShareLink{}); err != nil {
 		return nil, fmt.Errorf("failed to migrate schema: %w", err)
 	}
 
@@ -77,9 +78,32 @@ func (s *Store) Delete(ctx context.Context, id string) error {
 	if id == "" {
 		return fmt.Errorf("session ID cannot be empty")
 	}
+	if err := s.db.WithContext(ctx).Where("session_id = ?", id).Delete(&ShareLink{}).Error; err != nil {
+		return err
+	}
 	return s.db.WithContext(ctx).Where("session_id = ?", id).Delete(&Session{}).Error
 }
 
+func (s *Store) CreateShareLink(ctx context.Context, link *ShareLink) error {
+	return s.db.WithContext(ctx).Create(link).Error
+}
+
+func (s *Store) GetShareLink(ctx context.Context, shareID string) (*ShareLink, error) {
+	var link ShareLink
+	err := s.db.WithContext(ctx).Where("share_id = ?", shareID).First(&link).Error
+	return &link, err
+}
+
+// DeleteShareLinks revokes the share links of the session.
+func (s *Store) DeleteShareLinks(ctx context.Context, sessionID string) (int64, error) {
+	result := s.db.WithContext(ctx).Where("session_id = ?", sessionID).Delete(&ShareLink{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *Store) DeleteExpiredShareLinks(ctx context.Context, now time.Time) error {
+	return s.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&ShareLink{}).Error
+}
+
 func (s *Store) Get(ctx context.Context, id string) (*Session, error) {
 	var session Session
 	err := s.db.WithContext(ctx).Where("session_id = ?", id).First(&session).Error
@@ -102,6 +126,61 @@ func (s *Store) FindByAccount(ctx context.Context, sessionType, accountID string
 	return sessions, nil
 }
 
+// FindByType returns the sessions of the type of all accounts.
+func (s *Store) FindByType(ctx context.Context, sessionType string) ([]Session, error) {
+	var sessions []Session
+	err := s.db.WithContext(ctx).Where("type = ?", sessionType).Order("created_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+func (s *Store) FindByAccountID(ctx context.Context, accountID string) ([]Session, error) {
+	var sessions []Session
+	err := s.db.WithContext(ctx).Where("account_id = ?", accountID).Order("created_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// GetByConversationID returns the most recently updated session of the account with the conversation ID.
+func (s *Store) GetByConversationID(ctx context.Context, accountID, conversationID string) (*Session, error) {
+	var session Session
+	err := s.db.WithContext(ctx).Where("conversation_id = ? and account_id = ?", conversationID, accountID).
+		Order("updated_at desc").First(&session).Error
+	return &session, err
+}
+
+// FindConversations returns the sessions that have a conversation ID, for all accounts if accountID is empty.
+func (s *Store) FindConversations(ctx context.Context, accountID string) ([]Session, error) {
+	var sessions []Session
+	query := s.db.WithContext(ctx).Where("conversation_id <> ''")
+	if accountID != "" {
+		query = query.Where("account_id = ?", accountID)
+	}
+	err := query.Order("updated_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+func (s *Store) FindExpired(ctx context.Context, now time.Time) ([]Session, error) {
+	var sessions []Session
+	err := s.db.WithContext(ctx).Where("expires_at IS NOT NULL and expires_at < ?", now).Find(&sessions).Error
+	return sessions, err
+}
+
+// FindInBatches calls fn with the sessions of the account, or of all accounts if accountID is empty, that
+// were updated since the time, a batch of sessions at a time so that they are not all loaded at once.
+func (s *Store) FindInBatches(ctx context.Context, accountID string, since time.Time, fn func([]Session) error) error {
+	query := s.db.WithContext(ctx)
+	if accountID != "" {
+		query = query.Where("account_id = ?", accountID)
+	}
+	if !since.IsZero() {
+		query = query.Where("updated_at >= ?", since)
+	}
+
+	var sessions []Session
+	return query.FindInBatches(&sessions, 100, func(*gorm.DB, int) error {
+		return fn(sessions)
+	}).Error
+}
+
 func (s *Store) List(ctx context.Context) ([]Session, error) {
 	var sessions []Session
 	err := s.db.WithContext(ctx).Order("updated_at desc").Find(&sessions).Error
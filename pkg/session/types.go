@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/nanobot-ai/nanobot/pkg/approval"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tokens"
 	"github.com/nanobot-ai/nanobot/pkg/types"
 	"github.com/nanobot-ai/nanobot/pkg/uuid"
 	"gorm.io/gorm"
@@ -65,6 +68,14 @@ type Session struct {
 	Config      ConfigWrapper `json:"config,omitempty" gorm:"type:json"`
 	Cwd         string        `json:"cwd,omitempty"`
 	IsPublic    bool          `json:"isPublic"`
+	ExpiresAt   *time.Time    `json:"expiresAt,omitempty" gorm:"index"`
+	// ConversationID is the ID supplied by the client to resume the session later.
+	ConversationID string `json:"conversationID,omitempty" gorm:"index"`
+	// Replica is the URL of the replica that last stored the session, requests of the session are
+	// forwarded to it.
+	Replica string `json:"replica,omitempty"`
+	// Workspace is the workspace of the account the session was created in.
+	Workspace string `json:"workspace,omitempty" gorm:"index"`
 }
 
 type Token struct {
@@ -74,11 +85,86 @@ type Token struct {
 	Data      string `json:"data,omitempty"`
 }
 
+// ShareLink is a share link of a session that was created and not revoked.
+type ShareLink struct {
+	gorm.Model
+	ShareID   string    `json:"shareID" gorm:"uniqueIndex;not null"`
+	SessionID string    `json:"sessionID" gorm:"index"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"index"`
+}
+
+// Conversation returns the conversation of a session that has a conversation ID.
+func (s *Session) Conversation() types.Conversation {
+	agent, _ := s.State.Attributes[types.CurrentAgentSessionKey].(string)
+	return types.Conversation{
+		ID:        s.ConversationID,
+		SessionID: s.SessionID,
+		Title:     s.Description,
+		Agent:     agent,
+		Owner:     s.AccountID,
+		Workspace: s.Workspace,
+		Created:   s.CreatedAt,
+		Updated:   s.UpdatedAt,
+	}
+}
+
+// Transcript returns the messages of the last completion of the session.
+func (s *Session) Transcript() ([]types.Message, error) {
+	var run types.Execution
+	if thread, ok := s.State.Attributes[types.PreviousExecutionKey]; ok {
+		if err := mcp.JSONCoerce(thread, &run); err != nil {
+			return nil, fmt.Errorf("failed to read transcript of session %s: %w", s.SessionID, err)
+		}
+	}
+
+	var (
+		messages []types.Message
+		model    string
+	)
+	if run.PopulatedRequest != nil {
+		messages = run.PopulatedRequest.Input
+		model = run.PopulatedRequest.Model
+	}
+	if run.Response != nil {
+		messages = append(messages, run.Response.Output)
+	}
+	return tokens.Annotate(model, types.ConsolidateTools(messages)), nil
+}
+
+// ResumedConversation is the context a client needs to continue a conversation.
+type ResumedConversation struct {
+	types.Conversation
+	Messages         []types.Message  `json:"messages,omitempty"`
+	PendingApprovals approval.Pending `json:"pendingApprovals,omitempty"`
+}
+
+// Resume returns the transcript and the tool calls waiting for approval of the conversation of the session.
+func (s *Session) Resume() (*ResumedConversation, error) {
+	messages, err := s.Transcript()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ResumedConversation{
+		Conversation: s.Conversation(),
+		Messages:     messages,
+	}
+	if pending, ok := s.State.Attributes[approval.PendingSessionKey]; ok {
+		if err := mcp.JSONCoerce(pending, &result.PendingApprovals); err != nil {
+			return nil, fmt.Errorf("failed to read pending approvals of session %s: %w", s.SessionID, err)
+		}
+		result.PendingApprovals = result.PendingApprovals.Unexpired(time.Now())
+	}
+	return result, nil
+}
+
 func (s *Session) Clone(accountID string) *Session {
 	newSession := *s
 	newSession.SessionID = uuid.String()
 	newSession.AccountID = accountID
 	newSession.IsPublic = false
+	newSession.ExpiresAt = nil
+	newSession.ConversationID = ""
 	newSession.Model = gorm.Model{}
 	newSession.State.ID = newSession.SessionID
 	newSession.State.Attributes = make(map[string]any, len(s.State.Attributes))
@@ -4,13 +4,18 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"reflect"
 	"slices"
 	"strings"
 
 	"github.com/nanobot-ai/nanobot/pkg/complete"
 	"github.com/nanobot-ai/nanobot/pkg/config"
+	"github.com/nanobot-ai/nanobot/pkg/envvar"
+	"github.com/nanobot-ai/nanobot/pkg/log"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
 	"github.com/nanobot-ai/nanobot/pkg/schema"
 	"github.com/nanobot-ai/nanobot/pkg/types"
@@ -38,6 +43,9 @@ func NewData(runtime RuntimeMeta) *Data {
 type RuntimeMeta interface {
 	BuildToolMappings(ctx context.Context, toolList []string, opts ...types.BuildToolMappingsOptions) (types.ToolMappings, error)
 	GetClient(ctx context.Context, name string) (*mcp.Client, error)
+	CloseClient(ctx context.Context, name string)
+	NotifyRootsChanged(ctx context.Context, names ...string)
+	FlushToolCache(ctx context.Context, servers ...string) int
 }
 
 type GetOption struct {
@@ -56,8 +64,17 @@ func WithAllowMissing() GetOption {
 }
 
 func (d *Data) getEntrypoints(ctx context.Context) []string {
-	c := types.ConfigFromContext(ctx)
-	return c.Publish.Entrypoint
+	var (
+		c           = types.ConfigFromContext(ctx)
+		nctx        = types.NanobotContext(ctx)
+		entrypoints []string
+	)
+	for _, entrypoint := range c.Publish.Entrypoint {
+		if nctx.AgentAllowed(entrypoint) {
+			entrypoints = append(entrypoints, entrypoint)
+		}
+	}
+	return entrypoints
 }
 
 func (d *Data) SetCurrentAgent(ctx context.Context, newAgent string) error {
@@ -66,10 +83,7 @@ func (d *Data) SetCurrentAgent(ctx context.Context, newAgent string) error {
 	}
 
 	entrypoints := d.getEntrypoints(ctx)
-	session := mcp.SessionFromContext(ctx)
-	for session.Parent != nil {
-		session = session.Parent
-	}
+	session := mcp.SessionFromContext(ctx).Root()
 
 	d.Refresh(ctx)
 	if newAgent == "" {
@@ -148,8 +162,12 @@ func (d *Data) CurrentAgent(ctx context.Context) string {
 	)
 	if !session.Get(types.CurrentAgentSessionKey, &currentAgent) {
 		session.Get(types.ConfigSessionKey, &c)
-		if len(c.Publish.Entrypoint) > 0 {
-			currentAgent = c.Publish.Entrypoint[0]
+		nctx := types.NanobotContext(ctx)
+		for _, entrypoint := range c.Publish.Entrypoint {
+			if nctx.AgentAllowed(entrypoint) {
+				currentAgent = entrypoint
+				break
+			}
 		}
 	}
 	return currentAgent
@@ -262,11 +280,28 @@ func initSubscriptions(session *mcp.Session) {
 		}
 
 		subs := resourceSubscriptions{}
-		if session.Get(types.ResourceSubscriptionsSessionKey, &subs) {
-			_, ok := subs[uri]
-			if ok {
-				return msg, nil
+		if !session.Get(types.ResourceSubscriptionsSessionKey, &subs) {
+			return nil, nil
+		}
+
+		if _, ok := subs[uri]; ok {
+			return msg, nil
+		}
+
+		// Updates from MCP servers use the URI known to that server, rewrite it to the published URI.
+		for publishedURI, sub := range subs {
+			if sub.TargetURI != uri {
+				continue
 			}
+			params, err := json.Marshal(map[string]any{
+				"uri": publishedURI,
+			})
+			if err != nil {
+				return nil, err
+			}
+			newMsg := *msg
+			newMsg.Params = params
+			return &newMsg, nil
 		}
 
 		return nil, nil
@@ -275,52 +310,130 @@ func initSubscriptions(session *mcp.Session) {
 	session.Set("_subscriptions_initialized", true)
 }
 
-type resourceSubscriptions map[string]struct{}
+type resourceSubscription struct {
+	MCPServer string `json:"mcpServer,omitempty"`
+	TargetURI string `json:"targetURI,omitempty"`
+}
 
-func (r resourceSubscriptions) Deserialize(v any) (any, error) {
-	r = resourceSubscriptions{}
-	return r, mcp.JSONCoerce(v, &r)
+type resourceSubscriptions map[string]resourceSubscription
+
+func (r *resourceSubscriptions) Deserialize(v any) (any, error) {
+	*r = resourceSubscriptions{}
+	return *r, mcp.JSONCoerce(v, r)
 }
 
 func (r resourceSubscriptions) Serialize() (any, error) {
-	return (map[string]struct{})(r), nil
+	return (map[string]resourceSubscription)(r), nil
+}
+
+func (d *Data) getSubscriptions(session *mcp.Session) resourceSubscriptions {
+	var subs resourceSubscriptions
+	session.Get(types.ResourceSubscriptionsSessionKey, &subs)
+
+	// Copy so that the filter reading the previous value is not racing with the update.
+	result := make(resourceSubscriptions, len(subs)+1)
+	maps.Copy(result, subs)
+	return result
 }
 
 func (d *Data) UnsubscribeFromResources(ctx context.Context, uris ...string) error {
 	var (
 		session = mcp.SessionFromContext(ctx)
-		subs    resourceSubscriptions
+		subs    = d.getSubscriptions(session)
+		errs    []error
 	)
-	session.Get(types.ResourceSubscriptionsSessionKey, &subs)
-	if subs == nil {
-		subs = resourceSubscriptions{}
-	}
+
 	for _, uri := range uris {
+		sub, ok := subs[uri]
 		delete(subs, uri)
+		if !ok || sub.MCPServer == "" {
+			continue
+		}
+
+		c, err := d.runtime.GetClient(ctx, sub.MCPServer)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := c.UnsubscribeResource(ctx, sub.TargetURI); err != nil {
+			errs = append(errs, fmt.Errorf("failed to unsubscribe from resource %s: %w", uri, err))
+		}
 	}
 
 	session.Set(types.ResourceSubscriptionsSessionKey, subs)
-	return nil
+	return errors.Join(errs...)
 }
 
 func (d *Data) SubscribeToResources(ctx context.Context, uris ...string) error {
 	var (
 		session = mcp.SessionFromContext(ctx)
-		subs    resourceSubscriptions
+		subs    = d.getSubscriptions(session)
 	)
-	session.Get(types.ResourceSubscriptionsSessionKey, &subs)
-	if subs == nil {
-		subs = resourceSubscriptions{}
-	}
 
 	for _, uri := range uris {
-		subs[uri] = struct{}{}
+		sub, err := d.resolveSubscription(ctx, uri)
+		if err != nil {
+			return err
+		}
+		subs[uri] = sub
 	}
 
 	session.Set(types.ResourceSubscriptionsSessionKey, subs)
 	return nil
 }
 
+// resolveSubscription finds the MCP server that provides the published resource and subscribes to it
+// there, if the server supports subscriptions. Resources that are not provided by an MCP server, such as
+// nanobot's own progress resources, are only recorded.
+func (d *Data) resolveSubscription(ctx context.Context, uri string) (resourceSubscription, error) {
+	var sub resourceSubscription
+
+	resourceMappings, err := d.ResourceMappings(ctx)
+	if err != nil {
+		// Still record the subscription so updates for nanobot's own resources are not lost.
+		log.Errorf(ctx, "failed to list resources to subscribe to %s: %v", uri, err)
+		return sub, nil
+	}
+
+	if mapping, ok := resourceMappings[uri]; ok {
+		sub.MCPServer = mapping.MCPServer
+		sub.TargetURI = mapping.TargetName
+	} else {
+		resourceTemplateMappings, err := d.ResourceTemplateMappings(ctx)
+		if err != nil {
+			log.Errorf(ctx, "failed to list resource templates to subscribe to %s: %v", uri, err)
+			return sub, nil
+		}
+		for _, key := range slices.Sorted(maps.Keys(resourceTemplateMappings)) {
+			mapping := resourceTemplateMappings[key]
+			if mapping.Target.Regexp.MatchString(uri) {
+				sub.MCPServer = mapping.MCPServer
+				sub.TargetURI = uri
+				break
+			}
+		}
+	}
+
+	if sub.MCPServer == "" {
+		return sub, nil
+	}
+
+	c, err := d.runtime.GetClient(ctx, sub.MCPServer)
+	if err != nil {
+		return sub, err
+	}
+
+	if !c.SupportsSubscribe() {
+		return sub, nil
+	}
+
+	if _, err := c.SubscribeResource(ctx, sub.TargetURI); err != nil {
+		return sub, fmt.Errorf("failed to subscribe to resource %s: %w", uri, err)
+	}
+
+	return sub, nil
+}
+
 func (d *Data) Sync(ctx context.Context, defaultConfig types.ConfigFactory) error {
 	var (
 		session      = mcp.SessionFromContext(ctx)
@@ -334,11 +447,18 @@ func (d *Data) Sync(ctx context.Context, defaultConfig types.ConfigFactory) erro
 
 	d.setURL(ctx)
 
+	var previous types.Config
+	session.Get(types.ConfigSessionKey, &previous)
+
 	config, err := d.getAndSetConfig(ctx, defaultConfig)
 	if err != nil {
 		return err
 	}
 
+	if err := setWorkspace(ctx, config); err != nil {
+		return err
+	}
+
 	session.Get(types.ConfigHashSessionKey, &existingHash)
 
 	digest := sha256.New()
@@ -347,12 +467,83 @@ func (d *Data) Sync(ctx context.Context, defaultConfig types.ConfigFactory) erro
 
 	if hash != existingHash {
 		d.Refresh(ctx)
+		d.closeChangedClients(ctx, previous, config)
 	}
 
 	session.Set(types.ConfigHashSessionKey, mcp.SavedString(hash))
 	return nil
 }
 
+// setWorkspace adds the env of the workspace of the session to its env. New sessions are created in the
+// workspace of the user, chosen with the workspace header if the user is a member of more than one.
+func setWorkspace(ctx context.Context, config types.Config) error {
+	var (
+		session   = mcp.SessionFromContext(ctx)
+		user      = types.NanobotContext(ctx).User
+		workspace string
+	)
+	if len(config.Workspaces) == 0 {
+		return nil
+	}
+
+	if session.Get(types.WorkspaceSessionKey, &workspace) && workspace != "" {
+		if !config.Workspaces[workspace].HasUser(user) {
+			return fmt.Errorf("user %s is not a member of workspace %q of the session", user.ID, workspace)
+		}
+	} else {
+		var requested string
+		if req := mcp.RequestFromContext(ctx); req != nil {
+			requested = req.Header.Get(types.WorkspaceHeader)
+		}
+		var err error
+		workspace, err = config.WorkspaceOf(user, requested)
+		if err != nil || workspace == "" {
+			return err
+		}
+		session.Set(types.WorkspaceSessionKey, workspace)
+	}
+
+	session.AddEnv(envvar.ReplaceMap(ctx, session.GetEnvMap(), config.Workspaces[workspace].Env))
+	return nil
+}
+
+// closeChangedClients closes the clients of MCP servers whose definition was changed or removed so
+// that they are recreated from the new config on next use.
+func (d *Data) closeChangedClients(ctx context.Context, previous, current types.Config) {
+	for name, server := range previous.MCPServers {
+		if newServer, ok := current.MCPServers[name]; !ok || !reflect.DeepEqual(server, newServer) {
+			log.Infof(ctx, "MCP server %s changed in config, closing client", name)
+			d.runtime.CloseClient(ctx, name)
+		}
+	}
+	d.notifyRootsChanged(ctx, previous, current)
+}
+
+// notifyRootsChanged tells the MCP servers whose clients were kept open that their roots changed.
+func (d *Data) notifyRootsChanged(ctx context.Context, previous, current types.Config) {
+	var changed []string
+	for name, server := range current.MCPServers {
+		if oldServer, ok := previous.MCPServers[name]; !ok || !reflect.DeepEqual(server, oldServer) {
+			continue
+		}
+		oldRoots, oldOK := previous.ServerRoots(name)
+		newRoots, newOK := current.ServerRoots(name)
+		if !maps.Equal(previous.Roots, current.Roots) || oldOK != newOK || !slices.Equal(oldRoots, newRoots) {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) > 0 {
+		slices.Sort(changed)
+		log.Infof(ctx, "roots changed in config, notifying MCP servers %s", strings.Join(changed, ", "))
+		d.runtime.NotifyRootsChanged(ctx, changed...)
+	}
+}
+
+// FlushToolCache removes the cached tool results of the session, optionally only for the given servers.
+func (d *Data) FlushToolCache(ctx context.Context, servers ...string) int {
+	return d.runtime.FlushToolCache(ctx, servers...)
+}
+
 func (d *Data) Refresh(ctx context.Context) {
 	session := mcp.SessionFromContext(ctx)
 	session.Delete(toolMappingKey)
@@ -467,6 +658,8 @@ func (d *Data) PublishedPromptMappings(ctx context.Context, opts ...GetOption) (
 	return promptMappings, nil
 }
 
+// BuildPromptMappings returns the prompts of the references. The reference "*" publishes the prompts of
+// all MCP servers of the config, namespaced as server/prompt.
 func (d *Data) BuildPromptMappings(ctx context.Context, refs ...string) (types.PromptMappings, error) {
 	var (
 		serverPrompts = map[string]*mcp.ListPromptsResult{}
@@ -480,6 +673,16 @@ func (d *Data) BuildPromptMappings(ctx context.Context, refs ...string) (types.P
 			continue
 		}
 
+		if toolRef.Server == "*" {
+			for _, server := range slices.Sorted(maps.Keys(c.MCPServers)) {
+				// One server that fails to start should not hide the prompts of all others.
+				if err := d.addPrompts(ctx, c, result, serverPrompts, types.ToolRef{Server: server}, true); err != nil {
+					log.Errorf(ctx, "failed to get prompts of server %s: %v", server, err)
+				}
+			}
+			continue
+		}
+
 		if inlinePrompt, ok := c.Prompts[toolRef.Server]; ok && toolRef.Tool == "" {
 			result[toolRef.PublishedName(toolRef.Server)] = types.TargetMapping[mcp.Prompt]{
 				MCPServer:  toolRef.Server,
@@ -489,32 +692,68 @@ func (d *Data) BuildPromptMappings(ctx context.Context, refs ...string) (types.P
 			continue
 		}
 
-		prompts, ok := serverPrompts[toolRef.Server]
-		if !ok {
-			c, err := d.runtime.GetClient(ctx, toolRef.Server)
-			if err != nil {
-				return nil, err
-			}
-			prompts, err = c.ListPrompts(ctx)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get prompts for server %s: %w", toolRef, err)
+		if err := d.addPrompts(ctx, c, result, serverPrompts, toolRef, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// addPrompts adds the prompts of the server of the reference to result, applying the prompt overrides of
+// the server config.
+func (d *Data) addPrompts(ctx context.Context, c types.Config, result types.PromptMappings, serverPrompts map[string]*mcp.ListPromptsResult, toolRef types.ToolRef, namespace bool) error {
+	prompts, ok := serverPrompts[toolRef.Server]
+	if !ok {
+		client, err := d.runtime.GetClient(ctx, toolRef.Server)
+		if err != nil {
+			return err
+		}
+		prompts, err = client.ListPrompts(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get prompts for server %s: %w", toolRef.Server, err)
+		}
+		serverPrompts[toolRef.Server] = prompts
+	}
+
+	server := c.MCPServers[toolRef.Server]
+	for _, prompt := range prompts.Prompts {
+		if toolRef.Tool != "" && prompt.Name != toolRef.Tool {
+			continue
+		}
+
+		override := server.Prompts[prompt.Name]
+		if override.Hidden && toolRef.Tool == "" {
+			continue
+		}
+
+		name := toolRef.As
+		if name == "" {
+			name = complete.First(override.Name, prompt.Name)
+			if namespace {
+				name = toolRef.Server + "/" + name
 			}
-			serverPrompts[toolRef.Server] = prompts
 		}
 
-		for _, prompt := range prompts.Prompts {
-			if prompt.Name == toolRef.Tool || toolRef.Tool == "" {
-				prompt.Name = toolRef.PublishedName(prompt.Name)
-				result[toolRef.PublishedName(prompt.Name)] = types.TargetMapping[mcp.Prompt]{
-					MCPServer:  toolRef.Server,
-					TargetName: prompt.Name,
-					Target:     prompt,
+		targetName := prompt.Name
+		prompt.Name = name
+		if len(override.Arguments) > 0 {
+			prompt.Arguments = slices.Clone(prompt.Arguments)
+			for i, arg := range prompt.Arguments {
+				if _, ok := override.Arguments[arg.Name]; ok {
+					prompt.Arguments[i].Required = false
 				}
 			}
 		}
+
+		result[name] = types.TargetMapping[mcp.Prompt]{
+			MCPServer:  toolRef.Server,
+			TargetName: targetName,
+			Target:     prompt,
+		}
 	}
 
-	return result, nil
+	return nil
 }
 
 func (d *Data) buildResourceMappings(ctx context.Context, config types.Config) (types.ResourceMappings, error) {
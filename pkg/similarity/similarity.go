@@ -0,0 +1,112 @@
+package similarity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/memory"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// Tool is the name of the tool agents compute similarity with, and the target name of its tool mapping.
+const Tool = "compute_similarity"
+
+// maxTexts limits the texts of one call, so that a call is one embeddings request of every provider.
+const maxTexts = 100
+
+var inputSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "query": {
+      "type": "string",
+      "description": "The text to compare the texts with"
+    },
+    "texts": {
+      "type": "array",
+      "items": {
+        "type": "string"
+      },
+      "description": "The texts to rank by their similarity to the query"
+    }
+  },
+  "required": ["query", "texts"]
+}`)
+
+// Args are the arguments of a similarity tool call.
+type Args struct {
+	Query string   `json:"query"`
+	Texts []string `json:"texts"`
+}
+
+// Score is the cosine similarity of one of the texts to the query, from -1 to 1.
+type Score struct {
+	Index int     `json:"index"`
+	Text  string  `json:"text"`
+	Score float64 `json:"score"`
+}
+
+// ToolMappings returns the similarity tool of the agent if it has similarity.
+func ToolMappings(agentName string, similarity *types.Similarity) types.ToolMappings {
+	result := types.ToolMappings{}
+	if similarity == nil {
+		return result
+	}
+
+	result[Tool] = types.TargetMapping[mcp.Tool]{
+		MCPServer:  agentName,
+		TargetName: Tool,
+		Target: mcp.Tool{
+			Name:        Tool,
+			Description: "Rank texts by their semantic similarity to a query, using embeddings. Returns the cosine similarity of each text, most similar first.",
+			InputSchema: inputSchema,
+		},
+	}
+	return result
+}
+
+// Compute embeds the query and the texts with the model and returns the scores of the texts, most similar first.
+func Compute(ctx context.Context, embedder types.Embedder, model string, args Args) ([]Score, error) {
+	if args.Query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if len(args.Texts) == 0 {
+		return nil, fmt.Errorf("texts are required")
+	}
+	if len(args.Texts) > maxTexts {
+		return nil, fmt.Errorf("at most %d texts can be compared at once, got %d", maxTexts, len(args.Texts))
+	}
+
+	vectors, err := embedder.Embed(ctx, model, append([]string{args.Query}, args.Texts...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed texts: %w", err)
+	}
+	if len(vectors) != len(args.Texts)+1 {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(vectors), len(args.Texts)+1)
+	}
+
+	scores := make([]Score, 0, len(args.Texts))
+	for i, text := range args.Texts {
+		scores = append(scores, Score{
+			Index: i,
+			Text:  text,
+			Score: memory.Cosine(vectors[0], vectors[i+1]),
+		})
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+	return scores, nil
+}
+
+// Format renders the scores as text for the LLM.
+func Format(scores []Score) string {
+	var buf strings.Builder
+	for _, score := range scores {
+		_, _ = fmt.Fprintf(&buf, "%.4f [%d] %s\n", score.Score, score.Index, score.Text)
+	}
+	return buf.String()
+}
@@ -6,10 +6,14 @@ import (
 	"context"
 	"os/exec"
 	"syscall"
+	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/system"
 )
 
+// KillGracePeriod is how long processes have to exit after SIGTERM before they are killed.
+var KillGracePeriod = 5 * time.Second
+
 func Cmd(ctx context.Context, command string, args ...string) *exec.Cmd {
 	args = append([]string{"_exec", command}, args...)
 	cmd := exec.CommandContext(ctx, system.Bin(), args...)
@@ -18,11 +22,15 @@ func Cmd(ctx context.Context, command string, args ...string) *exec.Cmd {
 		Setpgid: true,
 	}
 	cmd.Cancel = func() error {
-		if cmd.Process != nil {
-			// Kill the entire process group
-			return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		if cmd.Process == nil {
+			return nil
 		}
-		return nil
+		// Ask the entire process group to exit and kill it if it is still running after the grace period
+		pid := cmd.Process.Pid
+		time.AfterFunc(KillGracePeriod, func() {
+			_ = syscall.Kill(-pid, syscall.SIGKILL)
+		})
+		return syscall.Kill(-pid, syscall.SIGTERM)
 	}
 
 	return cmd
@@ -0,0 +1,111 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/nanobot-ai/nanobot"
+
+// Attribute keys used on the spans created by nanobot.
+const (
+	SessionID    = attribute.Key("nanobot.session.id")
+	AgentName    = attribute.Key("nanobot.agent")
+	Model        = attribute.Key("gen_ai.request.model")
+	InputTokens  = attribute.Key("gen_ai.usage.input_tokens")
+	OutputTokens = attribute.Key("gen_ai.usage.output_tokens")
+	ServerName   = attribute.Key("mcp.server")
+	ToolName     = attribute.Key("mcp.tool")
+	Method       = attribute.Key("mcp.method")
+)
+
+type Options struct {
+	// Endpoint of the OTLP/HTTP collector, for example http://localhost:4318. If empty tracing is disabled.
+	Endpoint string
+	// Headers sent with every export request
+	Headers map[string]string
+	// ServiceName reported in the trace resource, defaults to nanobot
+	ServiceName string
+}
+
+// Setup configures the global tracer provider to export spans to the OTLP endpoint. The returned function
+// flushes and stops the exporter.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = "nanobot"
+	}
+
+	exporterOpts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpointURL(endpointURL(opts.Endpoint)),
+	}
+	if len(opts.Headers) > 0 {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithHeaders(opts.Headers))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(opts.ServiceName),
+		semconv.ServiceVersion(version.Get().String()),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+func endpointURL(endpoint string) string {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "https://" + endpoint
+	}
+	if u := strings.TrimSuffix(endpoint, "/"); !strings.HasSuffix(u, "/v1/traces") {
+		return u + "/v1/traces"
+	}
+	return endpoint
+}
+
+// Start starts a span with the global tracer. If tracing is not configured the span is a no-op.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Inject adds the trace context of ctx to the headers of an outgoing request.
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// End records err on the span, if not nil, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,101 @@
+package tmpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Funcs are the functions of templates that need a session. Templates that use them fail if they are nil.
+type Funcs struct {
+	// Env returns the value of the variable of the environment of the session.
+	Env func(name string) (string, bool)
+	// Call calls the tool of the MCP server, as server/tool, and returns the text of its result.
+	Call func(target string, args map[string]any) (string, error)
+}
+
+// IsTemplate returns true if the text uses template actions.
+func IsTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// Parse parses the text and the partials it can include with {{ template "name" . }}.
+func Parse(name, text string, partials map[string]string, fn Funcs) (*template.Template, error) {
+	t := template.New(name).Option("missingkey=zero").Funcs(fn.funcMap())
+	for _, partial := range slices.Sorted(maps.Keys(partials)) {
+		if _, err := t.New(partial).Parse(partials[partial]); err != nil {
+			return nil, fmt.Errorf("failed to parse partial %s: %w", partial, err)
+		}
+	}
+	if _, err := t.Parse(text); err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// Render executes the text as a template with the data.
+func Render(name, text string, partials map[string]string, data any, fn Funcs) (string, error) {
+	t, err := Parse(name, text, partials, fn)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+func (f Funcs) funcMap() template.FuncMap {
+	return template.FuncMap{
+		"env": func(name string) (string, error) {
+			if f.Env == nil {
+				return "", fmt.Errorf("the environment is not available")
+			}
+			value, _ := f.Env(name)
+			return value, nil
+		},
+		"tool": func(target string, args ...map[string]any) (string, error) {
+			if f.Call == nil {
+				return "", fmt.Errorf("tool calls are not available")
+			}
+			var callArgs map[string]any
+			if len(args) > 0 {
+				callArgs = args[0]
+			}
+			return f.Call(target, callArgs)
+		},
+		"dict": func(pairs ...any) (map[string]any, error) {
+			if len(pairs)%2 != 0 {
+				return nil, fmt.Errorf("dict needs pairs of keys and values, got %d arguments", len(pairs))
+			}
+			result := make(map[string]any, len(pairs)/2)
+			for i := 0; i < len(pairs); i += 2 {
+				key, ok := pairs[i].(string)
+				if !ok {
+					return nil, fmt.Errorf("dict keys must be strings, got %T", pairs[i])
+				}
+				result[key] = pairs[i+1]
+			}
+			return result, nil
+		},
+		"default": func(def, value any) any {
+			if value == nil || value == "" {
+				return def
+			}
+			return value
+		},
+		"json": func(value any) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+		"join":  func(sep string, values []string) string { return strings.Join(values, sep) },
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"trim":  strings.TrimSpace,
+	}
+}
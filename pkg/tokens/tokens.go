@@ -0,0 +1,130 @@
+package tokens
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+const (
+	// messageOverhead is the tokens of the role and separators of a chat message.
+	messageOverhead = 3
+	// replyOverhead is the tokens that prime the reply of the assistant.
+	replyOverhead = 3
+	// imageTokens is the cost of an image of unknown size, a 1024x1024 image in high detail.
+	imageTokens = 765
+)
+
+type encoding struct {
+	once sync.Once
+	enc  *tiktoken.Tiktoken
+}
+
+var encodings = map[string]*encoding{
+	tiktoken.MODEL_O200K_BASE:  {},
+	tiktoken.MODEL_CL100K_BASE: {},
+}
+
+func init() {
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+}
+
+// encodingName returns the tiktoken encoding of the model. Models of other providers are estimated with
+// cl100k_base, which counts text of those models within a few percent.
+func encodingName(model string) string {
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	for _, prefix := range []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4", "chatgpt-", "gpt-oss"} {
+		if strings.HasPrefix(model, prefix) {
+			return tiktoken.MODEL_O200K_BASE
+		}
+	}
+	return tiktoken.MODEL_CL100K_BASE
+}
+
+func getEncoding(model string) *tiktoken.Tiktoken {
+	e := encodings[encodingName(model)]
+	e.once.Do(func() {
+		e.enc, _ = tiktoken.GetEncoding(encodingName(model))
+	})
+	return e.enc
+}
+
+// Count returns the number of tokens of the text for the model. Models are given as the agents give them
+// to providers, like gpt-4.1 or anthropic/claude-sonnet-4.
+func Count(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	enc := getEncoding(model)
+	if enc == nil {
+		return len(text) / 4
+	}
+	return len(enc.EncodeOrdinary(text))
+}
+
+// Message returns the number of tokens of the message for the model.
+func Message(model string, msg types.Message) int {
+	tokens := messageOverhead
+	for _, item := range msg.Items {
+		if item.Content != nil {
+			tokens += content(model, *item.Content)
+		}
+		if item.ToolCall != nil {
+			tokens += Count(model, item.ToolCall.Name) + Count(model, item.ToolCall.Arguments)
+		}
+		if item.ToolCallResult != nil {
+			for _, c := range item.ToolCallResult.Output.Content {
+				tokens += content(model, c)
+			}
+		}
+		if item.Reasoning != nil {
+			for _, summary := range item.Reasoning.Summary {
+				tokens += Count(model, summary.Text)
+			}
+		}
+	}
+	return tokens
+}
+
+// Request returns the number of input tokens of the request for the model, the system prompt, the
+// messages and the definitions of the tools.
+func Request(model string, req types.CompletionRequest) int {
+	tokens := replyOverhead
+	if req.SystemPrompt != "" {
+		tokens += messageOverhead + Count(model, req.SystemPrompt)
+	}
+	for _, msg := range req.Input {
+		tokens += Message(model, msg)
+	}
+	for _, tool := range req.Tools {
+		tokens += Count(model, tool.Name) + Count(model, tool.Description) + Count(model, string(tool.Parameters))
+	}
+	return tokens
+}
+
+// Annotate sets the tokens of the messages that were not counted when they were completed.
+func Annotate(model string, messages []types.Message) []types.Message {
+	for i := range messages {
+		if messages[i].Tokens == 0 {
+			messages[i].Tokens = Message(model, messages[i])
+		}
+	}
+	return messages
+}
+
+func content(model string, c mcp.Content) int {
+	switch {
+	case c.Type == "image":
+		return imageTokens
+	case c.Resource != nil:
+		return Count(model, c.Resource.Text) + len(c.Resource.Blob)/4
+	default:
+		return Count(model, c.Text) + len(c.Data)/4
+	}
+}
@@ -0,0 +1,210 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const (
+	resourcesServer           = "nanobot.resources"
+	sessionResourceURI        = "nanobot://resource/"
+	defaultAttachmentMimeType = "application/octet-stream"
+)
+
+// attachmentContent converts an attachment of the chat input to the content passed to the model. Data
+// URIs are stored as resources of the session, when the session has resources, and the model is told
+// the URI of the resource so that it can pass the attached file to tools.
+func (s *Service) attachmentContent(ctx context.Context, attachment types.Attachment) ([]mcp.Content, error) {
+	var (
+		uri      string
+		mimeType string
+		data     []byte
+		err      error
+	)
+
+	switch {
+	case strings.HasPrefix(attachment.URL, "data:"):
+		mimeType, data, err = parseDataURI(attachment.URL)
+		if err != nil {
+			return nil, err
+		}
+		if mimeType == "" {
+			mimeType = attachment.MimeType
+		}
+		uri, err = s.storeAttachment(ctx, attachment, mimeType, data)
+		if err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(attachment.URL, sessionResourceURI):
+		uri = attachment.URL
+		mimeType, data, err = s.readAttachment(ctx, uri)
+		if err != nil {
+			return nil, err
+		}
+		if mimeType == "" {
+			mimeType = attachment.MimeType
+		}
+	default:
+		return nil, fmt.Errorf("invalid attachment URL: %s, only data URIs and %s URIs are supported", attachment.URL, sessionResourceURI)
+	}
+
+	if mimeType == "" {
+		mimeType = defaultAttachmentMimeType
+	}
+
+	result := []mcp.Content{toAttachmentContent(uri, mimeType, data)}
+	if uri != "" {
+		name := attachment.Name
+		if name == "" {
+			name = "file"
+		}
+		result = append(result, mcp.Content{
+			Type: "text",
+			Text: fmt.Sprintf("The attached %s (%s) is available to tools as the resource %s", name, mimeType, uri),
+		})
+	}
+	return result, nil
+}
+
+func toAttachmentContent(uri, mimeType string, data []byte) mcp.Content {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return mcp.Content{
+			Type:     "image",
+			Data:     base64.StdEncoding.EncodeToString(data),
+			MIMEType: mimeType,
+		}
+	case strings.HasPrefix(mediaType, "audio/"):
+		return mcp.Content{
+			Type:     "audio",
+			Data:     base64.StdEncoding.EncodeToString(data),
+			MIMEType: mimeType,
+		}
+	}
+
+	resource := &mcp.EmbeddedResource{
+		URI:      uri,
+		MIMEType: mimeType,
+	}
+	if isTextMediaType(mediaType) && utf8.Valid(data) {
+		resource.Text = string(data)
+	} else {
+		resource.Blob = base64.StdEncoding.EncodeToString(data)
+	}
+	return mcp.Content{
+		Type:     "resource",
+		Resource: resource,
+	}
+}
+
+func isTextMediaType(mediaType string) bool {
+	switch mediaType {
+	case "application/json", "application/xml", "application/yaml", "application/x-yaml", "application/javascript":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+// parseDataURI parses data:[<mediatype>][;base64],<data>.
+func parseDataURI(uri string) (string, []byte, error) {
+	header, data, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok {
+		return "", nil, fmt.Errorf("invalid attachment URL: missing data in data URI")
+	}
+
+	mimeType, isBase64 := strings.CutSuffix(header, ";base64")
+	if !isBase64 {
+		decoded, err := url.PathUnescape(data)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to decode attachment data URI: %w", err)
+		}
+		return mimeType, []byte(decoded), nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode attachment data URI: %w", err)
+	}
+	return mimeType, decoded, nil
+}
+
+// storeAttachment creates a resource of the session for the attachment and returns its URI. It returns
+// an empty URI when nanobot runs without the resources server.
+func (s *Service) storeAttachment(ctx context.Context, attachment types.Attachment, mimeType string, data []byte) (string, error) {
+	if _, ok := s.serverFactories[resourcesServer]; !ok {
+		return "", nil
+	}
+
+	c, err := s.GetClient(ctx, resourcesServer)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := c.Call(ctx, "create_resource", map[string]any{
+		"name":     attachment.Name,
+		"blob":     base64.StdEncoding.EncodeToString(data),
+		"mimeType": mimeType,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store attachment: %w", err)
+	}
+
+	if result.IsError || len(result.Content) == 0 {
+		return "", fmt.Errorf("failed to store attachment: %s", callResultText(result))
+	}
+
+	var resource mcp.Resource
+	if err := json.Unmarshal([]byte(result.Content[0].Text), &resource); err != nil {
+		return "", fmt.Errorf("failed to read stored attachment: %w", err)
+	}
+	return resource.URI, nil
+}
+
+func (s *Service) readAttachment(ctx context.Context, uri string) (string, []byte, error) {
+	if _, ok := s.serverFactories[resourcesServer]; !ok {
+		return "", nil, fmt.Errorf("invalid attachment URL: %s, session resources are not available", uri)
+	}
+
+	c, err := s.GetClient(ctx, resourcesServer)
+	if err != nil {
+		return "", nil, err
+	}
+
+	result, err := c.ReadResource(ctx, uri)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read attachment %s: %w", uri, err)
+	}
+	if len(result.Contents) == 0 {
+		return "", nil, fmt.Errorf("attachment %s has no contents", uri)
+	}
+
+	content := result.Contents[0]
+	if content.Blob == "" {
+		return content.MIMEType, []byte(content.Text), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(content.Blob)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode attachment %s: %w", uri, err)
+	}
+	return content.MIMEType, data, nil
+}
+
+func callResultText(result *mcp.CallToolResult) string {
+	var text []string
+	for _, content := range result.Content {
+		if content.Text != "" {
+			text = append(text, content.Text)
+		}
+	}
+	return strings.Join(text, "\n")
+}
@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const resultCacheSessionKey = "tools/resultCache"
+
+// resultCache holds the results of tool calls of a session for the TTL configured in the toolCache
+// field of the MCP server. It is not persisted with the session.
+type resultCache struct {
+	lock    sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	server  string
+	result  types.CallResult
+	expires time.Time
+}
+
+func getResultCache(session *mcp.Session, create bool) *resultCache {
+	session = session.Root()
+	if session == nil {
+		return nil
+	}
+
+	var cache *resultCache
+	if session.Get(resultCacheSessionKey, &cache) && cache != nil || !create {
+		return cache
+	}
+	_ = session.Update(resultCacheSessionKey, &cache, func() error {
+		if cache == nil {
+			cache = &resultCache{
+				entries: map[string]cacheEntry{},
+			}
+		}
+		return nil
+	})
+	return cache
+}
+
+// cacheTTL returns how long results of the tool are cached. A "*" entry applies to all tools of the server.
+func cacheTTL(ctx context.Context, config types.Config, server, tool string) time.Duration {
+	ttls := config.MCPServers[server].ToolCache
+	ttl, ok := ttls[tool]
+	if !ok {
+		ttl, ok = ttls["*"]
+	}
+	if !ok || ttl == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		log.Errorf(ctx, "invalid toolCache TTL %q for %s/%s: %v", ttl, server, tool, err)
+		return 0
+	}
+	return d
+}
+
+// toolCacheKey is the hash of the server, tool and canonical JSON of the arguments. Arguments are
+// round-tripped through any so that map keys are sorted regardless of how they were built.
+func toolCacheKey(server, tool string, args any) (string, bool) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	var canonical any
+	if err := json.Unmarshal(data, &canonical); err != nil {
+		return "", false
+	}
+	data, err = json.Marshal(canonical)
+	if err != nil {
+		return "", false
+	}
+
+	h := sha256.New()
+	h.Write([]byte(server))
+	h.Write([]byte{0})
+	h.Write([]byte(tool))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+func (c *resultCache) get(key string) (*types.CallResult, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	result := entry.result
+	result.Content = append([]mcp.Content(nil), entry.result.Content...)
+	return &result, true
+}
+
+func (c *resultCache) set(key, server string, result types.CallResult, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	result.Content = append([]mcp.Content(nil), result.Content...)
+	c.entries[key] = cacheEntry{
+		server:  server,
+		result:  result,
+		expires: now.Add(ttl),
+	}
+}
+
+// FlushToolCache removes the cached tool results of the current session. If servers are given only the
+// results of those servers are removed. It returns the number of removed results.
+func (s *Service) FlushToolCache(ctx context.Context, servers ...string) int {
+	cache := getResultCache(mcp.SessionFromContext(ctx), false)
+	if cache == nil {
+		return 0
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	var count int
+	for k, entry := range cache.entries {
+		if len(servers) == 0 || slices.Contains(servers, entry.server) {
+			delete(cache.entries, k)
+			count++
+		}
+	}
+	return count
+}
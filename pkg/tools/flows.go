@@ -211,48 +211,95 @@ func (s *Service) runStepWhile(ctx flowContext, step types.Step) (ret *types.Cal
 	})
 }
 
+// errLoopFailed stops the loops of a step at the first loop that returned an error result.
+var errLoopFailed = errors.New("loop failed")
+
 func (s *Service) runStepEach(ctx flowContext, step types.Step, forEachData iter.Seq[any]) (ret *types.CallResult, err error) {
 	var (
-		results     = make([]map[string]any, 0)
-		itemVarName = "item"
-		resultLock  sync.Mutex
-		eg          errgroup.Group
+		results      = make([]map[string]any, 0)
+		itemVarName  = "item"
+		resultLock   sync.Mutex
+		iterations   int
+		failed       int
+		firstFailure *types.CallResult
 	)
 
-	if step.Parallel {
-		eg.SetLimit(s.concurrency)
-	} else {
-		eg.SetLimit(1)
-	}
+	eg, egCtx := errgroup.WithContext(ctx.ctx)
+	eg.SetLimit(complete.First(step.Concurrency, s.concurrency))
 
 	if step.ForEachVar != "" {
 		itemVarName = step.ForEachVar
 	}
 
 	oldVar, hadOldVar := ctx.data[itemVarName]
+	reduce := step.Reduce
 	step.ForEach = nil
 	step.While = ""
+	step.Reduce = types.AgentCall{}
+	if step.Parallel && step.Agent.Name != "" && step.Agent.Chat == nil {
+		// The parallel loops would otherwise add to, and overwrite, the same chat of the agent
+		step.Agent.Chat = new(bool)
+	}
 
 	for item := range forEachData {
+		if step.MaxIterations > 0 && iterations >= step.MaxIterations || egCtx.Err() != nil {
+			break
+		}
+		index := iterations
+		iterations++
+
+		resultLock.Lock()
+		results = append(results, nil)
+		resultLock.Unlock()
+
 		newCtx := ctx
 		if step.Parallel {
+			newCtx.ctx = egCtx
 			newCtx.data = maps.Clone(ctx.data)
 		}
-		ctx.data[itemVarName] = item
-		eg.Go(func() error {
+		newCtx.data[itemVarName] = item
+		run := func() error {
 			result, err := s.runStep(newCtx, step)
-			if err != nil {
+			if returnErr := (*ErrReturn)(nil); err != nil && (step.OnError != types.StepOnErrorContinue || errors.As(err, &returnErr)) {
 				return fmt.Errorf("failed to run forEach step %s: %w", step.ID, err)
+			} else if err != nil {
+				result = &types.CallResult{
+					IsError: true,
+					Content: []mcp.Content{
+						{
+							Text: err.Error(),
+						},
+					},
+				}
 			}
 
 			resultLock.Lock()
 			defer resultLock.Unlock()
-			results = append(results, toOutput(result))
+			results[index] = toOutput(result)
+			if result != nil && result.IsError {
+				failed++
+				if step.OnError != types.StepOnErrorContinue {
+					if firstFailure == nil {
+						firstFailure = result
+					}
+					return errLoopFailed
+				}
+			}
 			return nil
-		})
+		}
+		if !step.Parallel {
+			// The next item, or the condition of a while loop, can depend on the output of this loop
+			if err := run(); errors.Is(err, errLoopFailed) {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		eg.Go(run)
 	}
 
-	if err := eg.Wait(); err != nil {
+	if err := eg.Wait(); err != nil && !errors.Is(err, errLoopFailed) {
 		return nil, err
 	}
 
@@ -262,7 +309,16 @@ func (s *Service) runStepEach(ctx flowContext, step types.Step, forEachData iter
 		delete(ctx.data, itemVarName)
 	}
 
+	if firstFailure != nil {
+		return firstFailure, nil
+	}
+
+	if reduce.Name != "" {
+		return s.reduce(ctx, step.ID, reduce, results)
+	}
+
 	return &types.CallResult{
+		IsError: failed > 0 && failed == len(results),
 		Content: []mcp.Content{
 			{
 				StructuredContent: results,
@@ -271,6 +327,32 @@ func (s *Service) runStepEach(ctx flowContext, step types.Step, forEachData iter
 	}, nil
 }
 
+// reduce calls the agent with the outputs of the loops of the step, in the order of their items, and
+// returns its result as the result of the step.
+func (s *Service) reduce(ctx flowContext, stepID string, reduce types.AgentCall, results []map[string]any) (*types.CallResult, error) {
+	outputs := make([]map[string]any, 0, len(results))
+	for _, result := range results {
+		outputs = append(outputs, map[string]any{
+			"output":  result["output"],
+			"isError": result["isError"],
+		})
+	}
+	input, err := json.Marshal(outputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the results of step %s: %w", stepID, err)
+	}
+
+	ref := types.ParseToolRef(reduce.Name)
+	ret, err := s.Call(ctx.ctx, ref.Server, ref.Tool, string(input), CallOptions{
+		ProgressToken: ctx.opt.ProgressToken,
+		AgentOverride: reduce,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reduce the results of step %s with %s: %w", stepID, reduce.Name, err)
+	}
+	return ret, nil
+}
+
 func getCall(step types.Step) string {
 	if step.Agent.Name != "" {
 		return step.Agent.Name
@@ -304,6 +386,9 @@ func toOutput(ret *types.CallResult) map[string]any {
 			output["output"] = ret.Content[i].StructuredContent
 		}
 	}
+	if ret.StructuredContent != nil {
+		output["output"] = ret.StructuredContent
+	}
 	return output
 }
 
@@ -440,7 +525,7 @@ func (s *Service) runStep(ctx flowContext, step types.Step) (ret *types.CallResu
 	}
 
 	if step.If != "" {
-		isTrue, err := expr.EvalBool(ctx.ctx, ctx.env, ctx.data, step.ForEach)
+		isTrue, err := expr.EvalBool(ctx.ctx, ctx.env, ctx.data, step.If)
 		if err != nil {
 			return nil, fmt.Errorf("failed to evaluate if condition for step %s: %w", step.ID, err)
 		}
@@ -473,7 +558,7 @@ func (s *Service) runStep(ctx flowContext, step types.Step) (ret *types.CallResu
 	if step.Evaluate != nil {
 		evalStr, ok := step.Evaluate.(string)
 		if ok {
-			step.Evaluate = fmt.Sprintf("(function(){\n%s\n)()", evalStr)
+			step.Evaluate = fmt.Sprintf("${(function(){\n%s\n})()}", evalStr)
 		}
 
 		val, err := expr.EvalAny(ctx.ctx, ctx.env, ctx.data, step.Evaluate)
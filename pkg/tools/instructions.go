@@ -0,0 +1,183 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/envvar"
+	"github.com/nanobot-ai/nanobot/pkg/expr"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tmpl"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// renderInstructions executes the instructions as a Go template with the partials of the config. The
+// template gets the current time and the client and session of the request, and can read the
+// environment of the session and call tools.
+func (s *Service) renderInstructions(ctx context.Context, instruction types.DynamicInstructions) (string, error) {
+	var (
+		session = mcp.SessionFromContext(ctx)
+		env     = session.GetEnvMap()
+		now     = time.Now()
+	)
+	if tz, ok := env["TZ"]; ok {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			now = now.In(loc)
+		}
+	}
+
+	data := map[string]any{
+		"now":    now,
+		"date":   now.Format(time.DateOnly),
+		"client": clientInfo(session),
+		"session": map[string]string{
+			"id": session.ID(),
+		},
+	}
+
+	return tmpl.Render("instructions", instruction.Instructions, types.ConfigFromContext(ctx).Partials, data, tmpl.Funcs{
+		Env: func(name string) (string, bool) {
+			return expr.Lookup(ctx, env, name)
+		},
+		Call: func(target string, args map[string]any) (string, error) {
+			server, tool, _ := strings.Cut(target, "/")
+			ret, err := s.Call(ctx, server, tool, args)
+			if err != nil {
+				return "", err
+			}
+			var texts []string
+			for _, content := range ret.Content {
+				if content.Text != "" {
+					texts = append(texts, content.Text)
+				}
+			}
+			if ret.IsError {
+				return "", fmt.Errorf("tool %s failed: %s", target, strings.Join(texts, "\n"))
+			}
+			return strings.Join(texts, "\n"), nil
+		},
+	})
+}
+
+// clientInfo returns the name and version of the MCP client of the session, or of the first parent
+// session that has one.
+func clientInfo(session *mcp.Session) map[string]string {
+	for ; session != nil; session = session.Parent {
+		if info := session.InitializeRequest.ClientInfo; info.Name != "" {
+			return map[string]string{
+				"name":    info.Name,
+				"version": info.Version,
+			}
+		}
+	}
+	return map[string]string{}
+}
+
+// instructionsSessionKey prefixes the session attributes that keep the instructions fetched from a
+// URL or an MCP prompt, so that they do not change during a session.
+const instructionsSessionKey = "instructions/"
+
+// maxInstructionsSize limits how much of the response of an instructions URL is read.
+const maxInstructionsSize = 1 << 20
+
+type fetchedInstructions struct {
+	text    string
+	fetched time.Time
+}
+
+// instructionURLs are the instructions fetched for new sessions, by URL and headers.
+var instructionURLs = struct {
+	lock    sync.Mutex
+	entries map[string]fetchedInstructions
+}{
+	entries: map[string]fetchedInstructions{},
+}
+
+// fetchInstructions returns the instructions of the URL. A session gets the instructions that were
+// current when it first asked for them. New sessions reuse what was fetched until the refresh of the
+// instructions passed, then the URL is fetched again, falling back to the last instructions fetched
+// and then to the fallback of the instructions if that fails.
+func (s *Service) fetchInstructions(ctx context.Context, instruction types.DynamicInstructions) (string, error) {
+	var (
+		session = mcp.SessionFromContext(ctx)
+		env     = session.GetEnvMap()
+		target  = envvar.ReplaceString(ctx, env, instruction.URL)
+		headers = envvar.ReplaceMap(ctx, env, instruction.Headers)
+		pinned  string
+	)
+
+	sessionKey := instructionsSessionKey + target
+	if session.Get(sessionKey, &pinned) {
+		return pinned, nil
+	}
+
+	headerData, _ := json.Marshal(headers)
+	cacheKey := target + "\x00" + string(headerData)
+
+	instructionURLs.lock.Lock()
+	cached, ok := instructionURLs.entries[cacheKey]
+	instructionURLs.lock.Unlock()
+
+	text := cached.text
+	if !ok || time.Since(cached.fetched) >= instruction.GetRefresh() {
+		fetched, err := getInstructions(ctx, target, headers)
+		switch {
+		case err == nil:
+			text = fetched
+			instructionURLs.lock.Lock()
+			instructionURLs.entries[cacheKey] = fetchedInstructions{
+				text:    fetched,
+				fetched: time.Now(),
+			}
+			instructionURLs.lock.Unlock()
+		case ok:
+			log.Errorf(ctx, "failed to fetch instructions from %s, using the instructions fetched at %s: %v", target, cached.fetched.Format(time.RFC3339), err)
+		case instruction.Fallback != "":
+			// Not kept in the session, so that the next turn tries the URL again
+			log.Errorf(ctx, "failed to fetch instructions from %s, using the fallback: %v", target, err)
+			return instruction.Fallback, nil
+		default:
+			return "", err
+		}
+	}
+
+	session.Set(sessionKey, mcp.SavedString(text))
+	return text, nil
+}
+
+func getInstructions(ctx context.Context, target string, headers map[string]string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request for instructions %s: %w", target, err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := transport.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch instructions from %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch instructions from %s: %s", target, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxInstructionsSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read instructions from %s: %w", target, err)
+	}
+	return string(data), nil
+}
@@ -9,14 +9,26 @@ import (
 	"net/url"
 	"slices"
 	"strings"
+	"time"
 
+	"github.com/nanobot-ai/nanobot/pkg/approval"
+	"github.com/nanobot-ai/nanobot/pkg/audit"
 	"github.com/nanobot-ai/nanobot/pkg/complete"
 	"github.com/nanobot-ai/nanobot/pkg/envvar"
+	"github.com/nanobot-ai/nanobot/pkg/events"
 	"github.com/nanobot-ai/nanobot/pkg/expr"
+	"github.com/nanobot-ai/nanobot/pkg/log"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/metrics"
+	"github.com/nanobot-ai/nanobot/pkg/replay"
 	"github.com/nanobot-ai/nanobot/pkg/sampling"
+	"github.com/nanobot-ai/nanobot/pkg/telemetry"
+	"github.com/nanobot-ai/nanobot/pkg/tmpl"
 	"github.com/nanobot-ai/nanobot/pkg/types"
 	"github.com/nanobot-ai/nanobot/pkg/uuid"
+	"github.com/nanobot-ai/nanobot/pkg/workdir"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/sync/errgroup"
 )
 
 type Service struct {
@@ -27,7 +39,12 @@ type Service struct {
 	oauthRedirectURL string
 	tokenStorage     mcp.TokenStorage
 	concurrency      int
+	healthCheck      time.Duration
+	cassette         *replay.Cassette
 	serverFactories  map[string]func(name string) mcp.MessageHandler
+	toolLists        toolListCache
+	outputSchemas    outputSchemas
+	shared           sharedClients
 }
 
 type Sampler interface {
@@ -40,6 +57,10 @@ type Options struct {
 	CallbackHandler  mcp.CallbackHandler
 	OAuthRedirectURL string
 	TokenStorage     mcp.TokenStorage
+	// HealthCheckInterval is how often MCP servers are pinged, zero disables health checks.
+	HealthCheckInterval time.Duration
+	// Cassette records or replays the tool calls and tool lists of MCP servers.
+	Cassette *replay.Cassette
 }
 
 func (r Options) Merge(other Options) (result Options) {
@@ -48,6 +69,8 @@ func (r Options) Merge(other Options) (result Options) {
 	result.CallbackHandler = complete.Last(r.CallbackHandler, other.CallbackHandler)
 	result.OAuthRedirectURL = complete.Last(r.OAuthRedirectURL, other.OAuthRedirectURL)
 	result.TokenStorage = complete.Last(r.TokenStorage, other.TokenStorage)
+	result.HealthCheckInterval = complete.Last(r.HealthCheckInterval, other.HealthCheckInterval)
+	result.Cassette = complete.Last(r.Cassette, other.Cassette)
 	return result
 }
 
@@ -66,6 +89,8 @@ func NewToolsService(opts ...Options) *Service {
 		oauthRedirectURL: opt.OAuthRedirectURL,
 		callbackHandler:  opt.CallbackHandler,
 		tokenStorage:     opt.TokenStorage,
+		healthCheck:      opt.HealthCheckInterval,
+		cassette:         opt.Cassette,
 	}
 }
 
@@ -87,11 +112,38 @@ func (s *Service) GetDynamicInstruction(ctx context.Context, instruction types.D
 
 	session := mcp.SessionFromContext(ctx)
 
-	if !instruction.IsPrompt() {
+	if instruction.IsURL() {
+		return s.fetchInstructions(ctx, instruction)
+	} else if !instruction.IsPrompt() && tmpl.IsTemplate(instruction.Instructions) {
+		return s.renderInstructions(ctx, instruction)
+	} else if !instruction.IsPrompt() {
 		return expr.EvalString(ctx, session.GetEnvMap(), s.newGlobals(ctx, nil), instruction.Instructions)
 	}
 
-	prompt, err := s.GetPrompt(ctx, instruction.MCPServer, instruction.Prompt, envvar.ReplaceMap(session.GetEnvMap(), instruction.Args))
+	text, err := s.getPromptInstructions(ctx, instruction)
+	if err != nil && instruction.Fallback != "" {
+		log.Errorf(ctx, "failed to get prompt %s/%s for instructions, using the fallback: %v", instruction.MCPServer, instruction.Prompt, err)
+		return instruction.Fallback, nil
+	}
+	return text, err
+}
+
+// getPromptInstructions returns the instructions of the MCP prompt. Like the instructions of a URL, a
+// session keeps the instructions it got first.
+func (s *Service) getPromptInstructions(ctx context.Context, instruction types.DynamicInstructions) (string, error) {
+	var (
+		session = mcp.SessionFromContext(ctx)
+		args    = envvar.ReplaceMap(ctx, session.GetEnvMap(), instruction.Args)
+		pinned  string
+	)
+
+	argsData, _ := json.Marshal(args)
+	sessionKey := instructionsSessionKey + "mcp/" + instruction.MCPServer + "/" + instruction.Prompt + "?" + string(argsData)
+	if session.Get(sessionKey, &pinned) {
+		return pinned, nil
+	}
+
+	prompt, err := s.GetPrompt(ctx, instruction.MCPServer, instruction.Prompt, args)
 	if err != nil {
 		return "", fmt.Errorf("failed to get prompt: %w", err)
 	}
@@ -99,7 +151,10 @@ func (s *Service) GetDynamicInstruction(ctx context.Context, instruction types.D
 		return "", fmt.Errorf("prompt %s/%s returned %d messages, expected 1",
 			instruction.MCPServer, instruction.Prompt, len(prompt.Messages))
 	}
-	return prompt.Messages[0].Content.Text, nil
+
+	text := prompt.Messages[0].Content.Text
+	session.Set(sessionKey, mcp.SavedString(text))
+	return text, nil
 }
 
 func (s *Service) GetPrompt(ctx context.Context, target, prompt string, args map[string]string) (*mcp.GetPromptResult, error) {
@@ -136,7 +191,7 @@ func (s *Service) GetPrompt(ctx context.Context, target, prompt string, args map
 		return nil, err
 	}
 
-	return c.GetPrompt(ctx, prompt, args)
+	return c.GetPrompt(ctx, prompt, config.MCPServers[target].PromptArguments(prompt, args))
 }
 
 type clientFactory struct {
@@ -182,8 +237,12 @@ func (s *Service) GetClient(ctx context.Context, name string) (*mcp.Client, erro
 	if session == nil {
 		return nil, fmt.Errorf("session not found in context")
 	}
-	for session.Parent != nil {
-		session = session.Parent
+	session = session.Root()
+
+	if config, ok := types.ConfigFromContext(ctx).MCPServers[name]; ok && config.Scope == mcp.ScopeShared {
+		if _, builtin := s.serverFactories[name]; !builtin {
+			return s.getSharedClient(ctx, session, name, config)
+		}
 	}
 
 	sessionKey := "clients/" + name
@@ -205,14 +264,59 @@ func (s *Service) GetClient(ctx context.Context, name string) (*mcp.Client, erro
 	return factory.client, nil
 }
 
+// CloseClient closes the client of the named MCP server in the current session, if one was created,
+// so that the next use creates a new client from the current config.
+func (s *Service) CloseClient(ctx context.Context, name string) {
+	session := mcp.SessionFromContext(ctx)
+	if session == nil {
+		return
+	}
+	session = session.Root()
+
+	sessionKey := "clients/" + name
+	factory := clientFactory{
+		new: func(state *mcp.SessionState) (*mcp.Client, error) {
+			return s.newClient(ctx, name, state)
+		},
+	}
+
+	if session.Get(sessionKey, &factory) {
+		session.Delete(sessionKey)
+		factory.client.Close(true)
+	}
+	s.closeSharedClients(session, name)
+}
+
+// NotifyRootsChanged sends roots/list_changed to the running clients of the given MCP servers, so
+// that they list the roots again. Servers the session has no client for are skipped.
+func (s *Service) NotifyRootsChanged(ctx context.Context, names ...string) {
+	session := mcp.SessionFromContext(ctx)
+	if session == nil {
+		return
+	}
+	session = session.Root()
+
+	for _, name := range names {
+		factory := clientFactory{
+			new: func(state *mcp.SessionState) (*mcp.Client, error) {
+				return s.newClient(ctx, name, state)
+			},
+		}
+		if !session.Get("clients/"+name, &factory) || factory.client == nil {
+			continue
+		}
+		if err := factory.client.Session.SendPayload(ctx, "notifications/roots/list_changed", mcp.Notification{}); err != nil {
+			log.Errorf(ctx, "failed to notify MCP server %s that roots changed: %v", name, err)
+		}
+	}
+}
+
 func (s *Service) newClient(ctx context.Context, name string, state *mcp.SessionState) (*mcp.Client, error) {
 	session := mcp.SessionFromContext(ctx)
 	if session == nil {
 		return nil, fmt.Errorf("session not found in context")
 	}
-	for session.Parent != nil {
-		session = session.Parent
-	}
+	session = session.Root()
 
 	config := types.ConfigFromContext(ctx)
 
@@ -236,6 +340,20 @@ func (s *Service) newClient(ctx context.Context, name string, state *mcp.Session
 		}
 	}
 
+	if !ok {
+		_, ok = config.Tools[name]
+		if ok {
+			serverFactory, ok = s.serverFactories["nanobot.tool"]
+		}
+	}
+
+	if !ok {
+		_, ok = config.A2A[name]
+		if ok {
+			serverFactory, ok = s.serverFactories["nanobot.a2a"]
+		}
+	}
+
 	if !ok {
 		return nil, fmt.Errorf("MCP server %s not found in config", name)
 	}
@@ -248,6 +366,30 @@ func (s *Service) newClient(ctx context.Context, name string, state *mcp.Session
 		wire = serverSession
 	}
 
+	env := session.GetEnvMap()
+
+	var workdirRoot []mcp.Root
+	if workdirConfig := config.Session.GetWorkdir(); workdirConfig != nil && wire == nil && (mcpConfig.Command != "" || mcpConfig.Runtime == mcp.RuntimeDocker) {
+		dir, err := workdir.Ensure(ctx, workdirConfig, session)
+		if err != nil {
+			return nil, err
+		}
+		env = maps.Clone(env)
+		if env == nil {
+			env = map[string]string{}
+		}
+		env[workdir.EnvVar] = dir
+		mcpConfig.Env = maps.Clone(mcpConfig.Env)
+		if mcpConfig.Env == nil {
+			mcpConfig.Env = map[string]string{}
+		}
+		mcpConfig.Env[workdir.EnvVar] = dir
+		workdirRoot = append(workdirRoot, mcp.Root{
+			Name: workdir.RootName,
+			URI:  "file://" + dir,
+		})
+	}
+
 	roots := func(ctx context.Context) ([]mcp.Root, error) {
 		var roots mcp.ListRootsResult
 		if session.InitializeRequest.Capabilities.Roots != nil {
@@ -261,6 +403,23 @@ func (s *Service) newClient(ctx context.Context, name string, state *mcp.Session
 			roots.Roots = append(roots.Roots, s.roots...)
 		}
 
+		// The config is read on every call so that roots/list reflects a reloaded config
+		var current types.Config
+		session.Get(types.ConfigSessionKey, &current)
+		for _, rootName := range slices.Sorted(maps.Keys(current.Roots)) {
+			roots.Roots = append(roots.Roots, mcp.Root{
+				Name: rootName,
+				URI:  "file://" + current.Roots[rootName],
+			})
+		}
+		roots.Roots = append(roots.Roots, workdirRoot...)
+
+		if allowed, ok := current.ServerRoots(name); ok {
+			roots.Roots = slices.DeleteFunc(roots.Roots, func(root mcp.Root) bool {
+				return !slices.Contains(allowed, root.Name)
+			})
+		}
+
 		return roots.Roots, nil
 	}
 
@@ -277,7 +436,7 @@ func (s *Service) newClient(ctx context.Context, name string, state *mcp.Session
 
 	clientOpts := mcp.ClientOption{
 		Roots:         roots,
-		Env:           session.GetEnvMap(),
+		Env:           env,
 		ParentSession: session,
 		OnRoots: func(ctx context.Context, msg mcp.Message) error {
 			roots, err := roots(ctx)
@@ -292,24 +451,12 @@ func (s *Service) newClient(ctx context.Context, name string, state *mcp.Session
 			return session.Send(ctx, msg)
 		},
 		OnLogging: func(ctx context.Context, logMsg mcp.LoggingMessage) error {
-			data, err := json.Marshal(mcp.LoggingMessage{
-				Level:  logMsg.Level,
-				Logger: logMsg.Logger,
-				Data: map[string]any{
-					"server": name,
-					"data":   logMsg.Data,
-				},
-			})
+			msg, err := loggingNotification(name, logMsg)
 			if err != nil {
-				return fmt.Errorf("failed to marshal logging message: %w", err)
-			}
-			for session.Parent != nil {
-				session = session.Parent
+				return err
 			}
-			return session.Send(ctx, mcp.Message{
-				Method: "notifications/message",
-				Params: data,
-			})
+			session = session.Root()
+			return session.Send(ctx, msg)
 		},
 		Runner:           &s.runner,
 		CallbackHandler:  s.callbackHandler,
@@ -319,53 +466,110 @@ func (s *Service) newClient(ctx context.Context, name string, state *mcp.Session
 		TokenStorage:     s.tokenStorage,
 	}
 
-	if session.InitializeRequest.Capabilities.Elicitation == nil {
-		clientOpts.OnElicit = func(ctx context.Context, _ mcp.Message, elicitation mcp.ElicitRequest) (result mcp.ElicitResult, _ error) {
-			return mcp.ElicitResult{
-				Action: "cancel",
-			}, nil
-		}
-	} else {
-		clientOpts.OnElicit = func(ctx context.Context, _ mcp.Message, elicitation mcp.ElicitRequest) (result mcp.ElicitResult, _ error) {
-			err := session.Exchange(ctx, "elicitation/create", elicitation, &result)
-			return result, err
-		}
+	if wire == nil {
+		// In process servers don't need health checks
+		clientOpts.HealthCheck.Interval = s.healthCheck
+	}
+
+	clientOpts.OnElicit = func(ctx context.Context, _ mcp.Message, elicitation mcp.ElicitRequest) (mcp.ElicitResult, error) {
+		return s.forwardElicitation(ctx, session, name, elicitation)
 	}
 	if s.sampler != nil {
 		clientOpts.OnSampling = func(ctx context.Context, samplingRequest mcp.CreateMessageRequest) (mcp.CreateMessageResult, error) {
-			result, err := s.sampler.Sample(ctx, samplingRequest, sampling.SamplerOptions{
-				ProgressToken: uuid.String(),
-			})
-			if err != nil {
-				if !errors.Is(err, sampling.ErrNoMatchingModel) || session.InitializeRequest.Capabilities.Sampling == nil {
-					return mcp.CreateMessageResult{}, err
-				}
-
-				// There was no matching model, but the session supports sampling. Send the sampling request to it.
-				var result mcp.CreateMessageResult
-				if err = session.Exchange(ctx, "sampling/createMessage", samplingRequest, &result); err != nil {
-					return result, fmt.Errorf("failed to send sampling request: %w", err)
-				}
-				return result, nil
-			}
-			for _, content := range result.Content {
-				return mcp.CreateMessageResult{
-					Content:    content,
-					Role:       "assistant",
-					Model:      result.Model,
-					StopReason: result.StopReason,
-				}, nil
-			}
-			return mcp.CreateMessageResult{}, fmt.Errorf("no content returned from sampler")
+			return s.sample(ctx, session, name, samplingRequest)
 		}
 	}
 
 	return mcp.NewClient(session.Context(), name, mcpConfig, clientOpts)
 }
 
+// loggingNotification returns the notification that forwards a log message of the server to a session.
+func loggingNotification(name string, logMsg mcp.LoggingMessage) (mcp.Message, error) {
+	data, err := json.Marshal(mcp.LoggingMessage{
+		Level:  logMsg.Level,
+		Logger: logMsg.Logger,
+		Data: map[string]any{
+			"server": name,
+			"data":   logMsg.Data,
+		},
+	})
+	if err != nil {
+		return mcp.Message{}, fmt.Errorf("failed to marshal logging message: %w", err)
+	}
+	return mcp.Message{
+		Method: "notifications/message",
+		Params: data,
+	}, nil
+}
+
+// forwardElicitation asks the client of the session to answer the elicitation of the server, it is canceled if the
+// client does not support elicitation.
+func (s *Service) forwardElicitation(ctx context.Context, session *mcp.Session, name string, elicitation mcp.ElicitRequest) (result mcp.ElicitResult, _ error) {
+	if session.InitializeRequest.Capabilities.Elicitation == nil {
+		return mcp.ElicitResult{
+			Action: "cancel",
+		}, nil
+	}
+	elicitation.Meta = withServerName(elicitation.Meta, name)
+	err := session.Exchange(ctx, "elicitation/create", elicitation, &result)
+	return result, err
+}
+
+// sample completes the sampling request of the server with the agents of the config, or with the client
+// of the session if no agent matches.
+func (s *Service) sample(ctx context.Context, session *mcp.Session, name string, samplingRequest mcp.CreateMessageRequest) (mcp.CreateMessageResult, error) {
+	result, err := s.sampler.Sample(ctx, samplingRequest, sampling.SamplerOptions{
+		ProgressToken: uuid.String(),
+		Server:        name,
+	})
+	if err != nil {
+		if !errors.Is(err, sampling.ErrNoMatchingModel) || session.InitializeRequest.Capabilities.Sampling == nil {
+			return mcp.CreateMessageResult{}, err
+		}
+
+		// There was no matching model, but the session supports sampling. Send the sampling request to it.
+		var result mcp.CreateMessageResult
+		if err = session.Exchange(ctx, "sampling/createMessage", samplingRequest, &result); err != nil {
+			return result, fmt.Errorf("failed to send sampling request: %w", err)
+		}
+		return result, nil
+	}
+	for _, content := range result.Content {
+		return mcp.CreateMessageResult{
+			Content:    content,
+			Role:       "assistant",
+			Model:      result.Model,
+			StopReason: result.StopReason,
+		}, nil
+	}
+	return mcp.CreateMessageResult{}, fmt.Errorf("no content returned from sampler")
+}
+
+// withServerName sets the name of the MCP server that asks in the meta of an elicitation request, so
+// that whoever answers it knows where it comes from. The server can not set the nanobot meta itself, it
+// would otherwise get the answers configured for other servers and tools.
+func withServerName(meta json.RawMessage, server string) json.RawMessage {
+	values := map[string]any{}
+	if len(meta) > 0 {
+		// Meta that is not an object is replaced
+		_ = json.Unmarshal(meta, &values)
+	}
+	for key := range values {
+		if strings.HasPrefix(key, types.MetaPrefix) {
+			delete(values, key)
+		}
+	}
+	values[types.MetaPrefix+"server-name"] = server
+	data, err := json.Marshal(values)
+	if err != nil {
+		return meta
+	}
+	return data
+}
+
 func (s *Service) SampleCall(ctx context.Context, agent string, args any, opts ...SampleCallOptions) (*types.CallResult, error) {
 	config := types.ConfigFromContext(ctx)
-	createMessageRequest, err := s.convertToSampleRequest(config, agent, args)
+	createMessageRequest, err := s.convertToSampleRequest(ctx, config, agent, args)
 	if err != nil {
 		return nil, err
 	}
@@ -375,6 +579,7 @@ func (s *Service) SampleCall(ctx context.Context, agent string, args any, opts .
 	return s.sampler.Sample(ctx, *createMessageRequest, sampling.SamplerOptions{
 		ProgressToken: opt.ProgressToken,
 		AgentOverride: opt.AgentOverride,
+		Resume:        opt.Resume,
 	})
 }
 
@@ -387,6 +592,8 @@ type CallOptions struct {
 	Target             any
 	ToolCallInvocation *ToolCallInvocation
 	Meta               map[string]any
+	// Resume continues the interrupted turn of the agent instead of starting a new one.
+	Resume bool
 }
 
 type ToolCallInvocation struct {
@@ -404,6 +611,7 @@ func (o CallOptions) Merge(other CallOptions) (result CallOptions) {
 	result.Target = complete.Last(o.Target, other.Target)
 	result.ToolCallInvocation = complete.Last(o.ToolCallInvocation, other.ToolCallInvocation)
 	result.Meta = complete.MergeMap(o.Meta, other.Meta)
+	result.Resume = o.Resume || other.Resume
 	return
 }
 
@@ -497,7 +705,90 @@ func (s *Service) runBefore(ctx context.Context, config types.Config, target, se
 	return args, nil, nil
 }
 
+// recordToolCall adds the call to the audit log, ret and err are pointers so that it can be deferred
+// with the named results of Call.
+func recordToolCall(ctx context.Context, server, tool string, args any, ret **types.CallResult, err *error) {
+	if !audit.Enabled() {
+		return
+	}
+
+	event := audit.Event{
+		Type:   audit.ToolCall,
+		Server: server,
+		Tool:   tool,
+	}
+	if args != nil {
+		data, _ := json.Marshal(args)
+		event.Arguments = string(data)
+	}
+	if *err != nil {
+		event.Error = (*err).Error()
+	} else if *ret != nil && (*ret).IsError {
+		event.Error = "tool returned an error"
+	}
+	audit.Record(ctx, event)
+}
+
+// publishToolCall sends the tool_call debug event and returns the function that sends the tool_result
+// event, ret and err are pointers so that it can be deferred with the named results of Call.
+func publishToolCall(ctx context.Context, server, tool string, args any) func(ret **types.CallResult, err *error) {
+	if !events.Enabled() {
+		return func(**types.CallResult, *error) {}
+	}
+
+	arguments, _ := json.Marshal(args)
+	events.Publish(ctx, events.Event{
+		Type: events.ToolCall,
+		Data: map[string]any{
+			"server":    server,
+			"tool":      tool,
+			"arguments": json.RawMessage(arguments),
+		},
+	})
+
+	start := time.Now()
+	return func(ret **types.CallResult, err *error) {
+		event := events.Event{
+			Type: events.ToolResult,
+			Data: map[string]any{
+				"server":     server,
+				"tool":       tool,
+				"durationMs": time.Since(start).Milliseconds(),
+			},
+		}
+		if *err != nil {
+			event.Message = (*err).Error()
+		} else if *ret != nil {
+			event.Data["isError"] = (*ret).IsError
+			var text []string
+			for _, content := range (*ret).Content {
+				if content.Text != "" {
+					text = append(text, content.Text)
+				}
+			}
+			if output := strings.Join(text, "\n"); len(output) > 1000 {
+				event.Message = output[:1000] + "..."
+			} else {
+				event.Message = output
+			}
+		}
+		events.Publish(ctx, event)
+	}
+}
+
 func (s *Service) Call(ctx context.Context, server, tool string, args any, opts ...CallOptions) (ret *types.CallResult, err error) {
+	ctx, span := telemetry.Start(ctx, "tool.call", telemetry.ServerName.String(server), telemetry.ToolName.String(tool))
+	start := time.Now()
+	defer recordToolCall(ctx, server, tool, args, &ret, &err)
+	defer publishToolCall(ctx, server, tool, args)(&ret, &err)
+	defer func() {
+		metrics.ObserveToolCall(server, tool, start, ret, err)
+		if err == nil && ret != nil && ret.IsError {
+			span.SetStatus(codes.Error, "tool returned an error")
+		}
+		telemetry.End(span, err)
+	}()
+
 	defer func() {
 		if ret == nil {
 			return
@@ -518,6 +809,9 @@ func (s *Service) Call(ctx context.Context, server, tool string, args any, opts
 		config           = types.ConfigFromContext(ctx)
 		logProgressStart = false
 		logProgressDone  = true
+		tc               types.ToolCall
+		messageID        string
+		itemID           string
 	)
 
 	target := server
@@ -532,18 +826,20 @@ func (s *Service) Call(ctx context.Context, server, tool string, args any, opts
 	}()
 
 	targetType := "tool"
-	if _, ok := config.Agents[server]; ok {
+	if agent, ok := config.Agents[server]; ok {
 		targetType = "agent"
+		defer func() {
+			// The final response of an agent with an output schema is JSON matching it
+			if err == nil && ret != nil && !ret.IsError && ret.StructuredContent == nil &&
+				toolOutputSchema(complete.Last(agent.Output, opt.AgentOverride.Output)) != nil {
+				ret.StructuredContent = jsonText(ret.Content)
+			}
+		}()
 	} else if _, ok := config.Flows[server]; ok {
 		targetType = "flow"
 	}
 
 	if session != nil && opt.ProgressToken != nil {
-		var (
-			tc        types.ToolCall
-			messageID string
-			itemID    string
-		)
 		if opt.ToolCallInvocation != nil {
 			tc = opt.ToolCallInvocation.ToolCall
 			messageID = opt.ToolCallInvocation.MessageID
@@ -625,6 +921,7 @@ func (s *Service) Call(ctx context.Context, server, tool string, args any, opts
 		return s.SampleCall(ctx, server, args, SampleCallOptions{
 			ProgressToken: opt.ProgressToken,
 			AgentOverride: opt.AgentOverride,
+			Resume:        opt.Resume,
 		})
 	}
 
@@ -632,22 +929,119 @@ func (s *Service) Call(ctx context.Context, server, tool string, args any, opts
 		return s.startFlow(ctx, config, server, args, opt)
 	}
 
+	// Calls that require confirmation are confirmed even if their result is cached
+	if err := approval.Check(ctx, server, config.MCPServers[server], tool, args); err != nil {
+		var denied *approval.DeniedError
+		if errors.As(err, &denied) {
+			return &types.CallResult{
+				Content: []mcp.Content{
+					{
+						Type: "text",
+						Text: denied.Error(),
+					},
+				},
+				IsError: true,
+			}, nil
+		}
+		return nil, err
+	}
+
+	var (
+		cache    *resultCache
+		cacheKey string
+		ttl      = cacheTTL(ctx, config, server, tool)
+	)
+	if ttl > 0 {
+		var ok bool
+		if cacheKey, ok = toolCacheKey(server, tool, args); ok {
+			cache = getResultCache(session, true)
+		}
+	}
+	if cache != nil {
+		if result, ok := cache.get(cacheKey); ok {
+			return result, nil
+		}
+	}
+
+	if err := s.checkWorkdirQuota(config, server, session); err != nil {
+		var quotaErr *workdir.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return &types.CallResult{
+				Content: []mcp.Content{
+					{
+						Type: "text",
+						Text: quotaErr.Error(),
+					},
+				},
+				IsError: true,
+			}, nil
+		}
+		return nil, err
+	}
+
+	if s.replayable(config, server) && s.cassette.Replaying() {
+		ret = &types.CallResult{}
+		if err := s.cassette.Replay(ctx, replay.KindToolCall, replayToolCall{Server: server, Tool: tool, Arguments: args}, ret); err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+
 	c, err := s.GetClient(ctx, server)
 	if err != nil {
 		return nil, err
 	}
 
-	mcpCallResult, err := c.Call(ctx, tool, args, mcp.CallOption{
+	if session != nil && opt.ProgressToken != nil && logProgressDone {
+		stream := newToolOutputStream(ctx, session, opt.ProgressToken, messageID, itemID, tc)
+		defer stream.Close()
+	}
+
+	callCtx := ctx
+	if timeout := config.GetToolTimeout(server, tool); timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeoutCause(ctx, timeout, &types.TimeoutError{
+			Kind:    types.TimeoutTool,
+			Name:    target,
+			Timeout: timeout.String(),
+		})
+		defer cancel()
+	}
+
+	if session != nil {
+		defer s.trackSharedCall(session, c, opt.ProgressToken)()
+	}
+
+	mcpCallResult, err := c.Call(callCtx, tool, args, mcp.CallOption{
 		ProgressToken: opt.ProgressToken,
 		Meta:          opt.Meta,
 	})
+	if err != nil && ctx.Err() == nil && callCtx.Err() != nil {
+		err = context.Cause(callCtx)
+	}
+	if s.replayable(config, server) && s.cassette.Recording() {
+		var recorded *types.CallResult
+		if err == nil {
+			recorded = &types.CallResult{
+				Content:           mcpCallResult.Content,
+				StructuredContent: mcpCallResult.StructuredContent,
+				IsError:           mcpCallResult.IsError,
+			}
+		}
+		s.cassette.Record(ctx, replay.KindToolCall, replayToolCall{Server: server, Tool: tool, Arguments: args}, recorded, err)
+	}
 	if err != nil {
-		return nil, err
+		return nil, &types.ToolError{Server: server, Tool: tool, Err: err}
 	}
-	return &types.CallResult{
-		Content: mcpCallResult.Content,
-		IsError: mcpCallResult.IsError,
-	}, nil
+	ret = checkStructuredContent(target, s.outputSchemas.get(server, tool), &types.CallResult{
+		Content:           mcpCallResult.Content,
+		StructuredContent: mcpCallResult.StructuredContent,
+		IsError:           mcpCallResult.IsError,
+	})
+	if cache != nil && !ret.IsError {
+		cache.set(cacheKey, server, *ret, ttl)
+	}
+	return ret, nil
 }
 
 type ListToolsOptions struct {
@@ -679,6 +1073,8 @@ func (s *Service) ListTools(ctx context.Context, opts ...ListToolsOptions) (resu
 	}
 
 	serverList := slices.Sorted(maps.Keys(config.MCPServers))
+	serverList = append(serverList, slices.Sorted(maps.Keys(config.Tools))...)
+	serverList = append(serverList, slices.Sorted(maps.Keys(config.A2A))...)
 	agentsList := slices.Sorted(maps.Keys(config.Agents))
 	flowsList := slices.Sorted(maps.Keys(config.Flows))
 	if len(opt.Servers) == 0 {
@@ -686,21 +1082,35 @@ func (s *Service) ListTools(ctx context.Context, opts ...ListToolsOptions) (resu
 		opt.Servers = append(opt.Servers, flowsList...)
 	}
 
-	for _, server := range opt.Servers {
-		if !slices.Contains(serverList, server) {
+	// Servers are started at the same time, so that listing the tools of many servers takes as long as
+	// the slowest one
+	var (
+		listed = make([]*mcp.ListToolsResult, len(opt.Servers))
+		eg     errgroup.Group
+	)
+	eg.SetLimit(s.concurrency)
+	for i, server := range opt.Servers {
+		if !slices.Contains(serverList, server) || slices.Index(opt.Servers, server) != i {
 			continue
 		}
+		eg.Go(func() (err error) {
+			listed[i], err = s.listServerTools(ctx, config, server)
+			if err == nil {
+				s.outputSchemas.set(server, listed[i])
+			}
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
 
-		c, err := s.GetClient(ctx, server)
-		if err != nil {
-			return nil, err
-		}
-
-		tools, err := c.ListTools(ctx)
-		if err != nil {
-			return nil, err
+	for _, server := range opt.Servers {
+		if !slices.Contains(serverList, server) {
+			continue
 		}
 
+		tools := listed[slices.Index(opt.Servers, server)]
 		tools = filterTools(tools, opt.Tools)
 
 		if len(tools.Tools) == 0 {
@@ -722,9 +1132,10 @@ func (s *Service) ListTools(ctx context.Context, opts ...ListToolsOptions) (resu
 		tools := filterTools(&mcp.ListToolsResult{
 			Tools: []mcp.Tool{
 				{
-					Name:        types.AgentTool,
-					Description: agent.Description,
-					InputSchema: types.ChatInputSchema,
+					Name:         types.AgentTool,
+					Description:  agent.Description,
+					InputSchema:  types.ChatInputSchema,
+					OutputSchema: toolOutputSchema(agent.Output),
 				},
 			},
 		}, opt.Tools)
@@ -768,6 +1179,81 @@ func (s *Service) ListTools(ctx context.Context, opts ...ListToolsOptions) (resu
 	return
 }
 
+// checkWorkdirQuota returns an error if the stdio server writes to the session working directory and it
+// is over its quota.
+func (s *Service) checkWorkdirQuota(config types.Config, server string, session *mcp.Session) error {
+	if _, builtin := s.serverFactories[server]; builtin || (config.MCPServers[server].Command == "" && config.MCPServers[server].Runtime == "") {
+		return nil
+	}
+	return workdir.CheckQuota(config.Session.GetWorkdir(), session)
+}
+
+// replayToolCall is the request a tool call is recorded as in a cassette.
+type replayToolCall struct {
+	Server    string `json:"server"`
+	Tool      string `json:"tool"`
+	Arguments any    `json:"arguments,omitempty"`
+}
+
+// replayable returns true for calls to MCP servers that are recorded in or replayed from the cassette.
+// Agents and the built-in servers run in process and are not recorded.
+func (s *Service) replayable(config types.Config, server string) bool {
+	if s.cassette == nil {
+		return false
+	}
+	_, agent := config.Agents[server]
+	_, builtin := s.serverFactories[server]
+	return !agent && !builtin
+}
+
+func (s *Service) listServerTools(ctx context.Context, config types.Config, server string) (*mcp.ListToolsResult, error) {
+	replayable := s.replayable(config, server)
+	if replayable && s.cassette.Replaying() {
+		var tools mcp.ListToolsResult
+		if err := s.cassette.Replay(ctx, replay.KindToolList, server, &tools); err != nil {
+			return nil, err
+		}
+		return &tools, nil
+	}
+
+	var (
+		session   = mcp.SessionFromContext(ctx)
+		recording = replayable && s.cassette.Recording()
+		cacheKey  string
+		cacheable bool
+	)
+	if _, builtin := s.serverFactories[server]; !builtin && !recording && session != nil && lazyServer(config.MCPServers[server]) {
+		cacheKey, cacheable = serverKey(ctx, server, config.MCPServers[server], session.GetEnvMap())
+	}
+	if cacheable && !s.hasClient(session, server, cacheKey) {
+		// The server is started when a tool of it is called
+		if tools, ok := s.toolLists.get(cacheKey); ok {
+			return tools, nil
+		}
+	}
+
+	c, err := s.GetClient(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	tools, err := c.ListTools(ctx)
+	if recording {
+		s.cassette.Record(ctx, replay.KindToolList, server, tools, err)
+	}
+	if cacheable && err == nil {
+		s.toolLists.set(cacheKey, *tools)
+	}
+	return tools, err
+}
+
+// hasClient returns true if the session has a client of the server, without starting it if the client
+// is restored from the stored session, or the server is shared and running.
+func (s *Service) hasClient(session *mcp.Session, server, key string) bool {
+	session = session.Root()
+	return session.Get("clients/"+server, nil) || s.shared.running(key)
+}
+
 func filterTools(tools *mcp.ListToolsResult, filter []string) *mcp.ListToolsResult {
 	if len(filter) == 0 {
 		return tools
@@ -840,7 +1326,15 @@ func (s *Service) BuildToolMappings(ctx context.Context, toolList []string, opts
 
 	result := types.ToolMappings{}
 	for _, ref := range toolList {
-		maps.Copy(result, s.getMatches(ref, tools, opts...))
+		matches := s.getMatches(ref, tools, opts...)
+		for _, name := range slices.Sorted(maps.Keys(matches)) {
+			mapping := matches[name]
+			if existing, ok := result[name]; ok && (existing.MCPServer != mapping.MCPServer || existing.TargetName != mapping.TargetName) {
+				return nil, fmt.Errorf("tool name %q is published by both %s/%s and %s/%s, use \"as\" to rename one of them",
+					name, existing.MCPServer, existing.TargetName, mapping.MCPServer, mapping.TargetName)
+			}
+			result[name] = mapping
+		}
 	}
 
 	return result, nil
@@ -855,7 +1349,7 @@ func hasOnlySampleKeys(args map[string]any) bool {
 	return true
 }
 
-func (s *Service) convertToSampleRequest(config types.Config, agent string, args any) (*mcp.CreateMessageRequest, error) {
+func (s *Service) convertToSampleRequest(ctx context.Context, config types.Config, agent string, args any) (*mcp.CreateMessageRequest, error) {
 	var (
 		sampleArgs types.SampleCallRequest
 	)
@@ -904,30 +1398,16 @@ func (s *Service) convertToSampleRequest(config types.Config, agent string, args
 	}
 
 	for _, attachment := range sampleArgs.Attachments {
-		if strings.HasPrefix(attachment.URL, "data:") {
-			return nil, fmt.Errorf("invalid attachment URL: %s, only data URI are supported", attachment.URL)
-		}
-		parts := strings.Split(strings.TrimPrefix(attachment.URL, "data:"), ",")
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid attachment URL: %s, only data URI are supported", attachment.URL)
-		}
-		mimeType := parts[0]
-		if mimeType == "" {
-			mimeType = attachment.MimeType
+		contents, err := s.attachmentContent(ctx, attachment)
+		if err != nil {
+			return nil, err
 		}
-		data := parts[1]
-		data, ok := strings.CutPrefix(data, "base64,")
-		if !ok {
-			return nil, fmt.Errorf("invalid attachment URL: %s, only base64 data URI are supported", attachment.URL)
+		for _, content := range contents {
+			sampleRequest.Messages = append(sampleRequest.Messages, mcp.SamplingMessage{
+				Role:    "user",
+				Content: content,
+			})
 		}
-		sampleRequest.Messages = append(sampleRequest.Messages, mcp.SamplingMessage{
-			Role: "user",
-			Content: mcp.Content{
-				Type:     "image",
-				Data:     data,
-				MIMEType: mimeType,
-			},
-		})
 	}
 
 	return &sampleRequest, nil
@@ -936,10 +1416,12 @@ func (s *Service) convertToSampleRequest(config types.Config, agent string, args
 type SampleCallOptions struct {
 	ProgressToken any
 	AgentOverride types.AgentCall
+	Resume        bool
 }
 
 func (s SampleCallOptions) Merge(other SampleCallOptions) (result SampleCallOptions) {
 	result.ProgressToken = complete.Last(s.ProgressToken, other.ProgressToken)
 	result.AgentOverride = complete.Merge(s.AgentOverride, other.AgentOverride)
+	result.Resume = s.Resume || other.Resume
 	return
 }
@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func TestWithServerName(t *testing.T) {
+	tests := []struct {
+		name     string
+		meta     string
+		expected map[string]any
+	}{
+		{
+			name: "no meta",
+			expected: map[string]any{
+				types.MetaPrefix + "server-name": "server1",
+			},
+		},
+		{
+			name: "keeps other meta",
+			meta: `{"progressToken": 1}`,
+			expected: map[string]any{
+				"progressToken":                  float64(1),
+				types.MetaPrefix + "server-name": "server1",
+			},
+		},
+		{
+			name: "replaces nanobot meta of the server",
+			meta: `{"` + types.MetaPrefix + `server-name": "server2", "` + types.MetaPrefix + `tool-name": "server2/tool"}`,
+			expected: map[string]any{
+				types.MetaPrefix + "server-name": "server1",
+			},
+		},
+		{
+			name: "replaces meta that is not an object",
+			meta: `["` + types.MetaPrefix + `tool-name"]`,
+			expected: map[string]any{
+				types.MetaPrefix + "server-name": "server1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var meta json.RawMessage
+			if tt.meta != "" {
+				meta = json.RawMessage(tt.meta)
+			}
+			var result map[string]any
+			if err := json.Unmarshal(withServerName(meta, "server1"), &result); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGetDynamicInstructionPinsPrompt(t *testing.T) {
+	setTemplate := func(session *mcp.Session, template string) {
+		session.Set(types.ConfigSessionKey, types.Config{
+			Prompts: map[string]types.Prompt{
+				"instructions": {Template: template},
+			},
+		})
+	}
+	instruction := types.DynamicInstructions{MCPServer: "instructions", Prompt: "instructions"}
+
+	s := NewToolsService()
+	session := mcp.NewEmptySession(context.Background())
+	setTemplate(session, "first")
+	if text, err := s.GetDynamicInstruction(mcp.WithSession(context.Background(), session), instruction); err != nil || text != "first" {
+		t.Fatalf("expected first, got %q, %v", text, err)
+	}
+
+	setTemplate(session, "second")
+	if text, err := s.GetDynamicInstruction(mcp.WithSession(context.Background(), session), instruction); err != nil || text != "first" {
+		t.Errorf("expected the session to keep first, got %q, %v", text, err)
+	}
+
+	newSession := mcp.NewEmptySession(context.Background())
+	setTemplate(newSession, "second")
+	if text, err := s.GetDynamicInstruction(mcp.WithSession(context.Background(), newSession), instruction); err != nil || text != "second" {
+		t.Errorf("expected a new session to get second, got %q, %v", text, err)
+	}
+}
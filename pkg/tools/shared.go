@@ -0,0 +1,397 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// sharedIdleTimeout is how long a shared server keeps running after the last session that used it was
+// closed.
+const sharedIdleTimeout = time.Minute
+
+// sharedClients are the clients of the MCP servers with the shared scope by their serverKey.
+type sharedClients struct {
+	lock    sync.Mutex
+	clients map[string]*sharedClient
+}
+
+// sharedClient is the client of a server with the shared scope. It is used by all sessions that run the
+// server with the same config and closed when the last of them is closed. The sessions can belong to
+// different accounts, so messages of the server only go to the sessions they are about: progress of a
+// call to the session of the call, resource updates to the sessions subscribed to the resource,
+// list_changed to the sessions of the accounts with calls in flight, and requests like sampling, log
+// messages, and other notifications to the one session that has calls in flight.
+type sharedClient struct {
+	name string
+	once sync.Once
+	// ready is closed when the client was created, or creating it failed with err
+	ready  chan struct{}
+	client *mcp.Client
+	err    error
+
+	lock     sync.Mutex
+	sessions map[*mcp.Session]int
+	progress map[string]*mcp.Session
+	// subscriptions are the sessions subscribed to each resource URI
+	subscriptions map[string]map[*mcp.Session]struct{}
+}
+
+func (s *sharedClients) running(key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, ok := s.clients[key]
+	if !ok {
+		return false
+	}
+	select {
+	case <-c.ready:
+		return c.err == nil
+	default:
+		return false
+	}
+}
+
+// getSharedClient returns the shared client of the server and starts the server if no session runs it
+// yet. The session uses the client until it is closed.
+func (s *Service) getSharedClient(ctx context.Context, session *mcp.Session, name string, config mcp.Server) (*mcp.Client, error) {
+	key, ok := serverKey(ctx, name, config, session.GetEnvMap())
+	if !ok {
+		return nil, fmt.Errorf("failed to get key of shared MCP server %s", name)
+	}
+
+	for {
+		c := s.sharedClient(key, name)
+		c.once.Do(func() {
+			defer close(c.ready)
+			c.client, c.err = s.newSharedClient(session.GetEnvMap(), name, config, c)
+			if c.err != nil {
+				s.shared.lock.Lock()
+				delete(s.shared.clients, key)
+				s.shared.lock.Unlock()
+			}
+		})
+		<-c.ready
+		if c.err != nil {
+			return nil, fmt.Errorf("failed to initialize shared client %q: %w", name, c.err)
+		}
+
+		// The client is joined while it is in the map, so that it is not closed as unused at the same time
+		s.shared.lock.Lock()
+		if s.shared.clients[key] != c {
+			s.shared.lock.Unlock()
+			continue
+		}
+		c.lock.Lock()
+		_, joined := c.sessions[session]
+		if !joined {
+			c.sessions[session] = 0
+		}
+		c.lock.Unlock()
+		s.shared.lock.Unlock()
+
+		if !joined {
+			session.OnClose(func(bool) {
+				s.releaseSharedClient(key, c, session)
+			})
+		}
+		return c.client, nil
+	}
+}
+
+// sharedClient returns the shared client for the key, a new one that is not created yet if there is none.
+func (s *Service) sharedClient(key, name string) *sharedClient {
+	s.shared.lock.Lock()
+	defer s.shared.lock.Unlock()
+
+	if s.shared.clients == nil {
+		s.shared.clients = map[string]*sharedClient{}
+	}
+	c, ok := s.shared.clients[key]
+	if !ok {
+		c = &sharedClient{
+			name:          name,
+			ready:         make(chan struct{}),
+			sessions:      map[*mcp.Session]int{},
+			progress:      map[string]*mcp.Session{},
+			subscriptions: map[string]map[*mcp.Session]struct{}{},
+		}
+		s.shared.clients[key] = c
+	}
+	return c
+}
+
+// releaseSharedClient removes the session from the users of the client and closes the client if no
+// session uses it anymore.
+func (s *Service) releaseSharedClient(key string, c *sharedClient, session *mcp.Session) {
+	c.lock.Lock()
+	delete(c.sessions, session)
+	maps.DeleteFunc(c.progress, func(_ string, progressSession *mcp.Session) bool {
+		return progressSession == session
+	})
+	for uri, sessions := range c.subscriptions {
+		delete(sessions, session)
+		if len(sessions) == 0 {
+			delete(c.subscriptions, uri)
+		}
+	}
+	unused := len(c.sessions) == 0
+	c.lock.Unlock()
+	if !unused {
+		return
+	}
+
+	// Sessions are closed shortly after their last request, so the server keeps running for a while for
+	// the next request of any session
+	time.AfterFunc(sharedIdleTimeout, func() {
+		s.shared.lock.Lock()
+		c.lock.Lock()
+		unused := len(c.sessions) == 0
+		c.lock.Unlock()
+		if unused && s.shared.clients[key] == c {
+			delete(s.shared.clients, key)
+		} else {
+			unused = false
+		}
+		s.shared.lock.Unlock()
+		if unused {
+			c.client.Close(true)
+		}
+	})
+}
+
+// closeSharedClients stops the session from using the shared clients of the server.
+func (s *Service) closeSharedClients(session *mcp.Session, name string) {
+	s.shared.lock.Lock()
+	clients := map[string]*sharedClient{}
+	for key, c := range s.shared.clients {
+		if c.name == name {
+			clients[key] = c
+		}
+	}
+	s.shared.lock.Unlock()
+
+	for key, c := range clients {
+		c.lock.Lock()
+		_, ok := c.sessions[session]
+		c.lock.Unlock()
+		if ok {
+			s.releaseSharedClient(key, c, session)
+		}
+	}
+}
+
+// trackSharedCall records that the session has a call in flight on the shared server until the returned
+// function is called, so that requests of the server during the call go to the session. The progress
+// token stays with the session until it stops using the client, progress can arrive after the result.
+func (s *Service) trackSharedCall(session *mcp.Session, client *mcp.Client, progressToken any) func() {
+	session = session.Root()
+
+	s.shared.lock.Lock()
+	var c *sharedClient
+	for _, shared := range s.shared.clients {
+		if shared.client == client {
+			c = shared
+			break
+		}
+	}
+	s.shared.lock.Unlock()
+	if c == nil {
+		return func() {}
+	}
+
+	token := ""
+	if progressToken != nil {
+		token = fmt.Sprint(progressToken)
+	}
+
+	c.lock.Lock()
+	if _, ok := c.sessions[session]; ok {
+		c.sessions[session]++
+	}
+	if token != "" {
+		c.progress[token] = session
+	}
+	c.lock.Unlock()
+
+	return func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if _, ok := c.sessions[session]; ok {
+			c.sessions[session]--
+		}
+	}
+}
+
+// caller returns the session that has calls in flight, if there is one session with calls in flight.
+func (c *sharedClient) caller() (*mcp.Session, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	callers := c.callers()
+	if len(callers) != 1 {
+		return nil, fmt.Errorf("shared MCP server %s can only send requests during the calls of one session, %d sessions have calls in flight", c.name, len(callers))
+	}
+	return callers[0], nil
+}
+
+// callers returns the sessions with calls in flight, c.lock must be held.
+func (c *sharedClient) callers() (callers []*mcp.Session) {
+	for session, calls := range c.sessions {
+		if calls > 0 {
+			callers = append(callers, session)
+		}
+	}
+	return callers
+}
+
+// subscribe records that the session of ctx is subscribed to the resource, or not anymore.
+func (c *sharedClient) subscribe(ctx context.Context, uri string, subscribed bool) {
+	session := mcp.SessionFromContext(ctx).Root()
+	if session == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.sessions[session]; !ok {
+		return
+	}
+	if subscribed {
+		if c.subscriptions[uri] == nil {
+			c.subscriptions[uri] = map[*mcp.Session]struct{}{}
+		}
+		c.subscriptions[uri][session] = struct{}{}
+	} else {
+		delete(c.subscriptions[uri], session)
+		if len(c.subscriptions[uri]) == 0 {
+			delete(c.subscriptions, uri)
+		}
+	}
+}
+
+func accountID(session *mcp.Session) string {
+	var accountID string
+	session.Get(types.AccountIDSessionKey, &accountID)
+	return accountID
+}
+
+// recipients returns the sessions the notification of the server is sent to.
+func (c *sharedClient) recipients(msg mcp.Message) []*mcp.Session {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var params struct {
+		ProgressToken any    `json:"progressToken"`
+		URI           string `json:"uri"`
+	}
+	_ = json.Unmarshal(msg.Params, &params)
+
+	switch {
+	case msg.Method == "notifications/progress":
+		if params.ProgressToken == nil {
+			return nil
+		}
+		if session, ok := c.progress[fmt.Sprint(params.ProgressToken)]; ok {
+			return []*mcp.Session{session}
+		}
+		return nil
+	case msg.Method == "notifications/resources/updated":
+		return slices.Collect(maps.Keys(c.subscriptions[params.URI]))
+	case strings.HasSuffix(msg.Method, "/list_changed"):
+		// Sessions without an account are not the same user, they only get the changes of their calls
+		callers := c.callers()
+		accounts := map[string]bool{}
+		for _, session := range callers {
+			if account := accountID(session); account != "" {
+				accounts[account] = true
+			}
+		}
+		for session := range c.sessions {
+			if accounts[accountID(session)] && !slices.Contains(callers, session) {
+				callers = append(callers, session)
+			}
+		}
+		return callers
+	default:
+		if callers := c.callers(); len(callers) == 1 {
+			return callers
+		}
+		return nil
+	}
+}
+
+// notify sends the notification of the server to the sessions it is about.
+func (c *sharedClient) notify(ctx context.Context, msg mcp.Message) error {
+	sessions := c.recipients(msg)
+	if len(sessions) == 0 {
+		log.Debugf(ctx, "dropping %s of shared MCP server %s, it is not about a session", msg.Method, c.name)
+	}
+	for _, session := range sessions {
+		if err := session.Send(ctx, msg); err != nil {
+			log.Debugf(ctx, "failed to send notification of shared MCP server %s to session %s: %v", c.name, session.ID(), err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) newSharedClient(env map[string]string, name string, config mcp.Server, c *sharedClient) (*mcp.Client, error) {
+	roots := func(context.Context) ([]mcp.Root, error) {
+		return s.roots, nil
+	}
+
+	clientOpts := mcp.ClientOption{
+		Roots: roots,
+		Env:   env,
+		OnRoots: func(ctx context.Context, msg mcp.Message) error {
+			return msg.Reply(ctx, mcp.ListRootsResult{
+				Roots: s.roots,
+			})
+		},
+		OnNotify:    c.notify,
+		OnSubscribe: c.subscribe,
+		OnLogging: func(ctx context.Context, logMsg mcp.LoggingMessage) error {
+			msg, err := loggingNotification(name, logMsg)
+			if err != nil {
+				return err
+			}
+			return c.notify(ctx, msg)
+		},
+		OnElicit: func(ctx context.Context, _ mcp.Message, elicitation mcp.ElicitRequest) (mcp.ElicitResult, error) {
+			session, err := c.caller()
+			if err != nil {
+				log.Errorf(ctx, "canceling elicitation: %v", err)
+				return mcp.ElicitResult{
+					Action: "cancel",
+				}, nil
+			}
+			return s.forwardElicitation(mcp.WithSession(ctx, session), session, name, elicitation)
+		},
+		Runner: &s.runner,
+	}
+	clientOpts.HealthCheck.Interval = s.healthCheck
+
+	if s.sampler != nil {
+		clientOpts.OnSampling = func(ctx context.Context, samplingRequest mcp.CreateMessageRequest) (mcp.CreateMessageResult, error) {
+			session, err := c.caller()
+			if err != nil {
+				return mcp.CreateMessageResult{}, err
+			}
+			return s.sample(mcp.WithSession(ctx, session), session, name, samplingRequest)
+		}
+	}
+
+	// The client outlives the session that starts it, it is closed when no session uses it anymore
+	return mcp.NewClient(mcp.BackgroundContext(), name, config, clientOpts)
+}
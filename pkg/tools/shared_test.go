@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func TestSharedClientRecipients(t *testing.T) {
+	ctx := context.Background()
+	newSession := func(id, accountID string) *mcp.Session {
+		t.Helper()
+		serverSession, err := mcp.NewExistingServerSession(ctx, mcp.SessionState{
+			ID:         id,
+			Attributes: map[string]any{types.AccountIDSessionKey: accountID},
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return serverSession.GetSession()
+	}
+
+	var (
+		alice      = newSession("alice", "alice")
+		aliceOther = newSession("alice-other", "alice")
+		bob        = newSession("bob", "bob")
+		anonymous  = newSession("anonymous", "")
+	)
+	c := &sharedClient{
+		name:          "shared",
+		sessions:      map[*mcp.Session]int{alice: 1, aliceOther: 0, bob: 0, anonymous: 0},
+		progress:      map[string]*mcp.Session{"1": alice},
+		subscriptions: map[string]map[*mcp.Session]struct{}{},
+	}
+	c.subscribe(mcp.WithSession(ctx, bob), "file:///bob.txt", true)
+	c.subscribe(mcp.WithSession(ctx, alice), "file:///shared.txt", true)
+	c.subscribe(mcp.WithSession(ctx, bob), "file:///shared.txt", true)
+
+	tests := []struct {
+		name       string
+		msg        mcp.Message
+		recipients []*mcp.Session
+	}{
+		{name: "progress", msg: mcp.Message{Method: "notifications/progress", Params: []byte(`{"progressToken": 1}`)}, recipients: []*mcp.Session{alice}},
+		{name: "unknown progress", msg: mcp.Message{Method: "notifications/progress", Params: []byte(`{"progressToken": 2}`)}},
+		{name: "resource of the other account", msg: mcp.Message{Method: "notifications/resources/updated", Params: []byte(`{"uri": "file:///bob.txt"}`)}, recipients: []*mcp.Session{bob}},
+		{name: "resource of both accounts", msg: mcp.Message{Method: "notifications/resources/updated", Params: []byte(`{"uri": "file:///shared.txt"}`)}, recipients: []*mcp.Session{alice, bob}},
+		{name: "list changed", msg: mcp.Message{Method: "notifications/tools/list_changed"}, recipients: []*mcp.Session{alice, aliceOther}},
+		{name: "log message", msg: mcp.Message{Method: "notifications/message", Params: []byte(`{"level": "info", "data": "secret"}`)}, recipients: []*mcp.Session{alice}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipients := c.recipients(tt.msg)
+			if len(recipients) != len(tt.recipients) {
+				t.Fatalf("expected %d recipients, got %d", len(tt.recipients), len(recipients))
+			}
+			for _, session := range tt.recipients {
+				if !slices.Contains(recipients, session) {
+					t.Errorf("expected session %s to get the notification", session.ID())
+				}
+			}
+		})
+	}
+
+	t.Run("calls of several sessions", func(t *testing.T) {
+		c.sessions[bob] = 1
+		defer func() { c.sessions[bob] = 0 }()
+		if recipients := c.recipients(mcp.Message{Method: "notifications/message"}); len(recipients) != 0 {
+			t.Errorf("expected no recipients of a log message, got %d", len(recipients))
+		}
+	})
+
+	t.Run("unsubscribed", func(t *testing.T) {
+		c.subscribe(mcp.WithSession(ctx, bob), "file:///bob.txt", false)
+		if recipients := c.recipients(mcp.Message{Method: "notifications/resources/updated", Params: []byte(`{"uri": "file:///bob.txt"}`)}); len(recipients) != 0 {
+			t.Errorf("expected no recipients after unsubscribing, got %d", len(recipients))
+		}
+	})
+}
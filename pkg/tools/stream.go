@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const (
+	// toolOutputFlushInterval is how often buffered tool output is relayed. Coalescing the chunks keeps
+	// chatty servers from flooding the client with notifications.
+	toolOutputFlushInterval = 100 * time.Millisecond
+	// toolOutputMaxPending is the amount of buffered output after which the relay flushes inline.
+	// Flushing inline blocks reading from the MCP server until the client has caught up.
+	toolOutputMaxPending = 64 * 1024
+)
+
+// toolOutputStream relays the progress messages an MCP server sends while a tool call is running as
+// partial output of that tool call, so that long-running tools show output incrementally.
+type toolOutputStream struct {
+	ctx           context.Context
+	session       *mcp.Session
+	progressToken any
+	messageID     string
+	itemID        string
+	toolCall      types.ToolCall
+
+	lock    sync.Mutex
+	pending strings.Builder
+
+	removeFilter func()
+	done         chan struct{}
+	stopped      chan struct{}
+}
+
+func newToolOutputStream(ctx context.Context, session *mcp.Session, progressToken any, messageID, itemID string, toolCall types.ToolCall) *toolOutputStream {
+	root := session.Root()
+
+	s := &toolOutputStream{
+		ctx:           ctx,
+		session:       session,
+		progressToken: progressToken,
+		messageID:     messageID,
+		itemID:        itemID,
+		toolCall:      toolCall,
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+
+	// Notifications from MCP servers are relayed through the root session.
+	s.removeFilter = root.AddFilter(s.filter)
+	go s.run()
+	return s
+}
+
+func (s *toolOutputStream) filter(_ context.Context, msg *mcp.Message) (*mcp.Message, error) {
+	if msg.Method != "notifications/progress" {
+		return msg, nil
+	}
+
+	var progress mcp.NotificationProgressRequest
+	if err := json.Unmarshal(msg.Params, &progress); err != nil {
+		return msg, nil
+	}
+
+	if progress.Message == "" || fmt.Sprint(progress.ProgressToken) != fmt.Sprint(s.progressToken) {
+		return msg, nil
+	}
+	if _, ok := progress.Meta[types.CompletionProgressMetaKey]; ok {
+		// Already relayed by nanobot itself
+		return msg, nil
+	}
+
+	s.lock.Lock()
+	s.pending.WriteString(progress.Message)
+	if !strings.HasSuffix(progress.Message, "\n") {
+		s.pending.WriteString("\n")
+	}
+	full := s.pending.Len() >= toolOutputMaxPending
+	s.lock.Unlock()
+
+	if full {
+		s.flush()
+	}
+
+	return msg, nil
+}
+
+func (s *toolOutputStream) run() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(toolOutputFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+func (s *toolOutputStream) flush() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.pending.Len() == 0 {
+		return
+	}
+
+	text := s.pending.String()
+	s.pending.Reset()
+
+	_ = s.session.SendPayload(s.ctx, "notifications/progress", mcp.NotificationProgressRequest{
+		ProgressToken: s.progressToken,
+		Meta: map[string]any{
+			types.CompletionProgressMetaKey: types.CompletionProgress{
+				MessageID: s.messageID,
+				Item: types.CompletionItem{
+					ID:       s.itemID,
+					Partial:  true,
+					HasMore:  true,
+					ToolCall: &s.toolCall,
+					ToolCallResult: &types.ToolCallResult{
+						CallID: s.toolCall.CallID,
+						Output: types.CallResult{
+							Content: []mcp.Content{
+								{
+									Type: "text",
+									Text: text,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+// Close stops relaying and sends any output that is still buffered.
+func (s *toolOutputStream) Close() {
+	s.removeFilter()
+	close(s.done)
+	<-s.stopped
+	s.flush()
+}
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/schema"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// outputSchemas keeps the output schemas of the tools of the servers when their tools are listed, so
+// that the structured content of their results is validated.
+type outputSchemas struct {
+	lock    sync.Mutex
+	schemas map[string]json.RawMessage
+}
+
+func (o *outputSchemas) set(server string, tools *mcp.ListToolsResult) {
+	if tools == nil {
+		return
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.schemas == nil {
+		o.schemas = map[string]json.RawMessage{}
+	}
+	for _, tool := range tools.Tools {
+		if len(tool.OutputSchema) > 0 {
+			o.schemas[server+"/"+tool.Name] = tool.OutputSchema
+		} else {
+			delete(o.schemas, server+"/"+tool.Name)
+		}
+	}
+}
+
+func (o *outputSchemas) get(server, tool string) json.RawMessage {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.schemas[server+"/"+tool]
+}
+
+// checkStructuredContent validates the structured content of the result against the output schema of
+// the tool. Results of tools with an output schema that only return their structured content as JSON
+// text, as servers of older MCP revisions do, get it from the text. A result that does not match is
+// replaced by an error result, so that the model does not get output the tool does not promise.
+func checkStructuredContent(target string, outputSchema json.RawMessage, ret *types.CallResult) *types.CallResult {
+	if ret == nil || ret.IsError || len(outputSchema) == 0 {
+		return ret
+	}
+
+	if ret.StructuredContent == nil {
+		ret.StructuredContent = jsonText(ret.Content)
+	}
+	if ret.StructuredContent == nil {
+		return structuredError(fmt.Sprintf("Tool %s did not return structured content for its output schema.", target))
+	}
+
+	data, err := json.Marshal(ret.StructuredContent)
+	if err != nil {
+		return structuredError(fmt.Sprintf("Tool %s returned invalid structured content: %v", target, err))
+	}
+	if err := schema.ValidateJSON(outputSchema, string(data)); err != nil {
+		return structuredError(fmt.Sprintf("The structured content of tool %s does not match its output schema: %v", target, err))
+	}
+	return ret
+}
+
+// jsonText returns the last text content that is a JSON object, or nil if there is none. A markdown code
+// fence around the JSON, which some models add to their output, is removed.
+func jsonText(content []mcp.Content) any {
+	for i := len(content) - 1; i >= 0; i-- {
+		text := strings.TrimSpace(content[i].Text)
+		if strings.HasPrefix(text, "```") && strings.HasSuffix(text, "```") {
+			text = strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(text, "```"), "```"), "json")
+			text = strings.TrimSpace(text)
+		}
+		if !strings.HasPrefix(text, "{") {
+			continue
+		}
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(text), &obj); err == nil {
+			return obj
+		}
+	}
+	return nil
+}
+
+func structuredError(message string) *types.CallResult {
+	return &types.CallResult{
+		IsError: true,
+		Content: []mcp.Content{
+			{
+				Type: "text",
+				Text: message,
+			},
+		},
+	}
+}
+
+// toolOutputSchema returns the output schema of the output of an agent, MCP only allows object schemas
+// as the output schemas of tools.
+func toolOutputSchema(output *types.OutputSchema) json.RawMessage {
+	if output == nil {
+		return nil
+	}
+	outputSchema := output.ToSchema()
+	var obj struct {
+		Type any `json:"type"`
+	}
+	if len(outputSchema) == 0 || json.Unmarshal(outputSchema, &obj) != nil || obj.Type != "object" {
+		return nil
+	}
+	return outputSchema
+}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sync"
+
+	"github.com/nanobot-ai/nanobot/pkg/envvar"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+)
+
+// toolListCache holds the last tool list of each stdio MCP server by the server and the command it is
+// run with, so that sessions list the tools of servers without starting them. A server is started when
+// a session calls one of its tools, and lists its tools from then on.
+type toolListCache struct {
+	lock  sync.Mutex
+	lists map[string]mcp.ListToolsResult
+}
+
+// lazyServer returns true for servers that are started as a process of the session.
+func lazyServer(config mcp.Server) bool {
+	return config.BaseURL == "" && (config.Command != "" || config.Runtime == mcp.RuntimeDocker || config.Runtime == mcp.RuntimeKubernetes)
+}
+
+// serverKey is the hash of the server and its config with the env of the session replaced. Tool lists
+// and shared clients are kept by it, so that servers whose command or env depend on the session are
+// separate for sessions with other values.
+func serverKey(ctx context.Context, name string, config mcp.Server, env map[string]string) (string, bool) {
+	command, args, serverEnv := envvar.ReplaceEnv(ctx, env, config.Command, config.Args, config.Env)
+	config.Command, config.Args, config.Env = command, args, nil
+	data, err := json.Marshal(struct {
+		Config mcp.Server `json:"config"`
+		Env    []string   `json:"env"`
+	}{config, serverEnv})
+	if err != nil {
+		return "", false
+	}
+
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+func (c *toolListCache) get(key string) (*mcp.ListToolsResult, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	tools, ok := c.lists[key]
+	if !ok {
+		return nil, false
+	}
+	tools.Tools = slices.Clone(tools.Tools)
+	return &tools, true
+}
+
+func (c *toolListCache) set(key string, tools mcp.ListToolsResult) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.lists == nil {
+		c.lists = map[string]mcp.ListToolsResult{}
+	}
+	tools.Tools = slices.Clone(tools.Tools)
+	c.lists[key] = tools
+}
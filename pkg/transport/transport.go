@@ -0,0 +1,188 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+const defaultMaxIdleConnsPerHost = 32
+
+type Options struct {
+	// Proxy is the URL of the proxy of all outbound requests. Defaults to the HTTP_PROXY and HTTPS_PROXY
+	// environment variables, NO_PROXY applies either way.
+	Proxy string
+	// CAFile is a PEM file of the certificates trusted in addition to the system roots
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key presented to servers that ask for one
+	CertFile string
+	KeyFile  string
+	// MaxConnsPerHost limits the connections to one host, requests wait for a free connection when it is
+	// reached. 0 means no limit.
+	MaxConnsPerHost int
+	// MaxIdleConnsPerHost is how many idle connections to one host are kept for reuse, defaults to 32
+	MaxIdleConnsPerHost int
+}
+
+// Transport carries all outbound HTTP requests to remote MCP servers, LLM providers, and the other
+// services nanobot calls. Connections are pooled across requests and sessions, and HTTP/2 is used with
+// the servers that support it.
+var Transport = newTransport()
+
+// Client sends requests with Transport and without a timeout, requests are bound by their context.
+var Client = &http.Client{
+	Transport: Transport,
+}
+
+// TLSOptions are the TLS settings of the requests to one server, they replace those of Setup that they
+// set.
+type TLSOptions struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+var (
+	transportsLock sync.Mutex
+	transports     = map[TLSOptions]*http.Transport{}
+)
+
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          256,
+		MaxIdleConnsPerHost:   defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// Setup configures Transport, it must be called before the first request is sent.
+func Setup(opts Options) error {
+	if opts.Proxy != "" {
+		if _, err := url.Parse(opts.Proxy); err != nil {
+			return fmt.Errorf("invalid proxy URL %q: %w", opts.Proxy, err)
+		}
+		proxy := (&httpproxy.Config{
+			HTTPProxy:  opts.Proxy,
+			HTTPSProxy: opts.Proxy,
+			NoProxy:    noProxy(),
+		}).ProxyFunc()
+		Transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxy(req.URL)
+		}
+	}
+
+	tlsConfig, err := newTLSConfig(opts.CAFile, opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return err
+	}
+	Transport.TLSClientConfig = tlsConfig
+
+	Transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	if opts.MaxIdleConnsPerHost > 0 {
+		Transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	return nil
+}
+
+// For returns the transport of the requests to servers with the TLS options, Transport if no option is
+// set. Servers with the same options share the connection pool of their transport.
+func For(opts TLSOptions) (*http.Transport, error) {
+	if opts == (TLSOptions{}) {
+		return Transport, nil
+	}
+
+	transportsLock.Lock()
+	defer transportsLock.Unlock()
+
+	if t, ok := transports[opts]; ok {
+		return t, nil
+	}
+
+	tlsConfig, err := newTLSConfig(opts.CAFile, opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	if base := Transport.TLSClientConfig; base != nil {
+		if tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = base.RootCAs
+		}
+		if tlsConfig.Certificates == nil {
+			tlsConfig.Certificates = base.Certificates
+		}
+	}
+	tlsConfig.InsecureSkipVerify = opts.InsecureSkipVerify
+
+	t := Transport.Clone()
+	t.TLSClientConfig = tlsConfig
+	transports[opts] = t
+	return t, nil
+}
+
+// newTLSConfig returns the TLS config that trusts the certificates of caFile in addition to the system
+// roots and presents the client certificate, or nil if neither is set.
+func newTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %w", caFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to read CA file %s: no PEM certificates found", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate %s: %w", certFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func noProxy() string {
+	if v := os.Getenv("NO_PROXY"); v != "" {
+		return v
+	}
+	return os.Getenv("no_proxy")
+}
@@ -0,0 +1,107 @@
+package trigger
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/tools"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/robfig/cron/v3"
+)
+
+type Caller interface {
+	Call(ctx context.Context, server, tool string, args any, opts ...tools.CallOptions) (*types.CallResult, error)
+}
+
+// Result is the outcome of one run of a trigger, as delivered to its sinks.
+type Result struct {
+	Trigger  string    `json:"trigger"`
+	Agent    string    `json:"agent"`
+	Prompt   string    `json:"prompt"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Output   string    `json:"output,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Scheduler runs the triggers of a config on their schedule.
+type Scheduler struct {
+	ctx        context.Context
+	cron       *cron.Cron
+	caller     Caller
+	env        map[string]string
+	newSession func(context.Context) context.Context
+}
+
+// NewScheduler returns a scheduler for the triggers of the config. Each run calls the agent in the
+// session returned by newSession.
+func NewScheduler(config types.Config, env map[string]string, caller Caller, newSession func(context.Context) context.Context) (*Scheduler, error) {
+	s := &Scheduler{
+		cron:       cron.New(cron.WithParser(types.CronParser)),
+		caller:     caller,
+		env:        env,
+		newSession: newSession,
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(config.Triggers)) {
+		trigger := config.Triggers[name]
+		schedule, err := types.CronParser.Parse(trigger.Cron)
+		if err != nil {
+			return nil, err
+		}
+		s.cron.Schedule(schedule, cron.FuncJob(func() {
+			s.Run(s.ctx, name, trigger)
+		}))
+	}
+
+	return s, nil
+}
+
+// Start runs the triggers on their schedule until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	if len(s.cron.Entries()) == 0 {
+		return
+	}
+	s.ctx = ctx
+	s.cron.Start()
+	context.AfterFunc(ctx, func() {
+		s.cron.Stop()
+	})
+}
+
+// Run runs the trigger once and delivers the result to its sinks.
+func (s *Scheduler) Run(ctx context.Context, name string, trigger types.Trigger) Result {
+	result := Result{
+		Trigger: name,
+		Agent:   trigger.Agent,
+		Prompt:  trigger.Prompt,
+		Started: time.Now(),
+	}
+
+	log.Infof(ctx, "running trigger %s with agent %s", name, trigger.Agent)
+	callResult, err := s.caller.Call(s.newSession(ctx), trigger.Agent, trigger.Agent, types.SampleCallRequest{
+		Prompt: trigger.Prompt,
+	})
+	result.Finished = time.Now()
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Output = callResult.Text()
+		if callResult.IsError {
+			result.Error = result.Output
+		}
+	}
+	if result.Error != "" {
+		log.Errorf(ctx, "trigger %s failed: %s", name, result.Error)
+	}
+
+	for _, sink := range trigger.Sinks {
+		if err := deliver(ctx, s.env, sink, result); err != nil {
+			log.Errorf(ctx, "failed to deliver the output of trigger %s: %v", name, err)
+		}
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/envvar"
+	"github.com/nanobot-ai/nanobot/pkg/transport"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+var httpClient = &http.Client{
+	Transport: transport.Transport,
+	Timeout:   30 * time.Second,
+}
+
+func deliver(ctx context.Context, env map[string]string, sink types.Sink, result Result) error {
+	if err := envvar.ReplaceObject(ctx, env, &sink); err != nil {
+		return fmt.Errorf("failed to replace variables in sink: %w", err)
+	}
+
+	switch {
+	case sink.Webhook != nil:
+		return deliverWebhook(ctx, *sink.Webhook, result)
+	case sink.File != "":
+		return deliverFile(sink.File, result)
+	case sink.Email != nil:
+		return deliverEmail(*sink.Email, result)
+	}
+	return nil
+}
+
+func deliverWebhook(ctx context.Context, webhook types.WebhookSink, result Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range webhook.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
+
+func deliverFile(path string, result Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func deliverEmail(email types.EmailSink, result Result) error {
+	subject := email.Subject
+	if subject == "" {
+		subject = "nanobot trigger " + result.Trigger
+	}
+
+	body := result.Output
+	if result.Error != "" {
+		subject += " failed"
+		body = result.Error
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + email.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(email.To, ", ") + "\r\n")
+	msg.WriteString("Subject: " + subject + "\r\n")
+	msg.WriteString("Date: " + result.Finished.Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if email.Username != "" {
+		host, _, _ := strings.Cut(email.SMTP, ":")
+		auth = smtp.PlainAuth("", email.Username, email.Password, host)
+	}
+
+	if err := smtp.SendMail(email.SMTP, auth, email.From, email.To, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
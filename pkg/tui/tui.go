@@ -0,0 +1,749 @@
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/elicit"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tools"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+)
+
+type Caller interface {
+	Call(ctx context.Context, server, tool string, args any, opts ...tools.CallOptions) (*types.CallResult, error)
+}
+
+// NewSession returns a context with a new session that runs agents with the config.
+type NewSession func(ctx context.Context, config *types.Config) context.Context
+
+type Options struct {
+	// Agent the first conversation talks to, it defaults to the first entrypoint of the config.
+	Agent string
+}
+
+func (o Options) Merge(other Options) (result Options) {
+	result.Agent = complete.Last(o.Agent, other.Agent)
+	return
+}
+
+// Run shows the chat in the terminal until the user quits or ctx is canceled. Conversations only
+// live as long as the TUI runs.
+func Run(ctx context.Context, config types.Config, caller Caller, newSession NewSession, opts ...Options) error {
+	opt := complete.Complete(opts...)
+
+	agents := config.Publish.Entrypoint
+	if len(agents) == 0 {
+		agents = slices.Sorted(maps.Keys(config.Agents))
+	}
+	if len(agents) == 0 {
+		return fmt.Errorf("the config has no agents to chat with")
+	}
+	agent := agents[0]
+	if opt.Agent != "" {
+		if _, ok := config.Agents[opt.Agent]; !ok {
+			return fmt.Errorf("agent %q not found", opt.Agent)
+		}
+		agent = opt.Agent
+	}
+
+	m := newModel(ctx, config, caller, newSession, agents)
+	m.newConversation(agent)
+
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx), tea.WithMouseCellMotion())
+	m.send = p.Send
+	_, err := p.Run()
+	m.close()
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+type conversation struct {
+	id      int
+	ctx     context.Context
+	session *mcp.Session
+	// config is the config of the session, /model changes the model of its agents.
+	config  types.Config
+	agent   string
+	entries []*entry
+	busy    bool
+	cancel  context.CancelFunc
+	// streamed is set when text of the running turn was streamed, so the result is not shown twice.
+	streamed bool
+	// usage is the last reported usage of each completion of the last turn, by message ID.
+	usage map[string]types.CompletionProgress
+	// elicitations wait for the user to answer them, the first one is asked.
+	elicitations []*elicitation
+}
+
+// elicitation is an elicitation request of the session that the user answers in the input.
+type elicitation struct {
+	req    mcp.ElicitRequest
+	fields []elicit.Field
+	// field is the index of the field asked next, -1 while asking if the user responds at all.
+	field   int
+	content map[string]any
+	reply   chan mcp.ElicitResult
+}
+
+func (c *conversation) title() string {
+	for _, e := range c.entries {
+		if e.kind == entryUser {
+			return truncate(e.text, 40)
+		}
+	}
+	return "New conversation"
+}
+
+func (c *conversation) model() string {
+	if models := c.config.Agents[c.agent].Model; len(models) > 0 {
+		return models[0]
+	}
+	return ""
+}
+
+// tokens returns the tokens and the cost of the last turn, as far as the providers reported them.
+func (c *conversation) tokens() (int, float64) {
+	var (
+		tokens int
+		cost   float64
+	)
+	for _, progress := range c.usage {
+		tokens += progress.Usage.TotalTokens()
+		cost += progress.CostUSD
+	}
+	return tokens, cost
+}
+
+func (c *conversation) add(e *entry) {
+	c.entries = append(c.entries, e)
+}
+
+type entryKind int
+
+const (
+	entryUser entryKind = iota
+	entryAssistant
+	entryTool
+	entryInfo
+	entryError
+	entryQuestion
+)
+
+type entry struct {
+	kind  entryKind
+	agent string
+	text  string
+	// Tool calls
+	callID    string
+	name      string
+	arguments string
+	done      bool
+	isError   bool
+}
+
+type (
+	textMsg struct {
+		conversation int
+		agent        string
+		text         string
+	}
+	toolCallMsg struct {
+		conversation int
+		agent        string
+		callID       string
+		name         string
+		arguments    string
+	}
+	toolResultMsg struct {
+		conversation int
+		callID       string
+		name         string
+		output       string
+		isError      bool
+	}
+	usageMsg struct {
+		conversation int
+		progress     types.CompletionProgress
+	}
+	doneMsg struct {
+		conversation int
+		result       *types.CallResult
+		err          error
+	}
+	elicitMsg struct {
+		conversation int
+		elicitation  *elicitation
+	}
+)
+
+type model struct {
+	ctx        context.Context
+	config     types.Config
+	caller     Caller
+	newSession NewSession
+	agents     []string
+	send       func(tea.Msg)
+
+	conversations []*conversation
+	current       *conversation
+	nextID        int
+	// expanded shows the full arguments and output of tool calls.
+	expanded bool
+
+	input    textarea.Model
+	viewport viewport.Model
+	spinner  spinner.Model
+	width    int
+	height   int
+	ready    bool
+}
+
+func newModel(ctx context.Context, config types.Config, caller Caller, newSession NewSession, agents []string) *model {
+	input := textarea.New()
+	input.Placeholder = "Send a message, or /help for commands"
+	input.ShowLineNumbers = false
+	input.SetHeight(3)
+	input.CharLimit = 0
+	input.KeyMap.InsertNewline.SetKeys("alt+enter", "ctrl+j")
+	input.Focus()
+
+	return &model{
+		ctx:        ctx,
+		config:     config,
+		caller:     caller,
+		newSession: newSession,
+		agents:     agents,
+		input:      input,
+		spinner:    spinner.New(spinner.WithSpinner(spinner.Dot)),
+	}
+}
+
+func (m *model) newConversation(agent string) *conversation {
+	m.nextID++
+	config := m.config
+	config.Agents = maps.Clone(m.config.Agents)
+	ctx := m.newSession(m.ctx, &config)
+	c := &conversation{
+		id:      m.nextID,
+		ctx:     ctx,
+		session: mcp.SessionFromContext(ctx),
+		config:  config,
+		agent:   agent,
+	}
+	c.session.SetElicitHandler(m.elicitHandler(c.id))
+	m.conversations = append(m.conversations, c)
+	m.current = c
+	return c
+}
+
+func (m *model) conversation(id int) *conversation {
+	for _, c := range m.conversations {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (m *model) close() {
+	for _, c := range m.conversations {
+		for _, e := range c.elicitations {
+			e.reply <- mcp.ElicitResult{Action: elicit.Cancel}
+		}
+		if c.cancel != nil {
+			c.cancel()
+		}
+		c.session.Close(false)
+	}
+}
+
+func (m *model) Init() tea.Cmd {
+	return tea.Batch(textarea.Blink, m.spinner.Tick)
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.input.SetWidth(msg.Width)
+		if !m.ready {
+			m.viewport = viewport.New(msg.Width, m.viewportHeight())
+			m.ready = true
+		} else {
+			m.viewport.Width, m.viewport.Height = msg.Width, m.viewportHeight()
+		}
+		m.refresh(true)
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c":
+			if len(m.current.elicitations) > 0 {
+				m.answer(m.current, mcp.ElicitResult{Action: elicit.Cancel})
+				m.refresh(true)
+				return m, nil
+			}
+			if m.current.busy {
+				m.current.cancel()
+				return m, nil
+			}
+			return m, tea.Quit
+		case "ctrl+d":
+			return m, tea.Quit
+		case "ctrl+o":
+			m.expanded = !m.expanded
+			m.refresh(false)
+			return m, nil
+		case "ctrl+n":
+			m.newConversation(m.current.agent)
+			m.refresh(true)
+			return m, nil
+		case "ctrl+right", "ctrl+left":
+			m.cycle(msg.String() == "ctrl+right")
+			return m, nil
+		case "pgup", "pgdown":
+			var cmd tea.Cmd
+			m.viewport, cmd = m.viewport.Update(msg)
+			return m, cmd
+		case "enter":
+			text := strings.TrimSpace(m.input.Value())
+			m.input.Reset()
+			if len(m.current.elicitations) > 0 {
+				m.respond(m.current, text)
+				m.refresh(true)
+				return m, nil
+			}
+			if text == "" {
+				return m, nil
+			}
+			cmd := m.submit(text)
+			m.refresh(true)
+			return m, cmd
+		}
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		if m.current.busy {
+			m.refresh(false)
+		}
+		return m, cmd
+	case textMsg:
+		if c := m.conversation(msg.conversation); c != nil {
+			c.streamed = true
+			if last := lastEntry(c); last != nil && last.kind == entryAssistant && last.agent == msg.agent {
+				last.text += msg.text
+			} else {
+				c.add(&entry{kind: entryAssistant, agent: msg.agent, text: msg.text})
+			}
+			m.refresh(c == m.current && m.viewport.AtBottom())
+		}
+		return m, nil
+	case toolCallMsg:
+		if c := m.conversation(msg.conversation); c != nil {
+			c.add(&entry{kind: entryTool, agent: msg.agent, callID: msg.callID, name: msg.name, arguments: msg.arguments})
+			m.refresh(c == m.current && m.viewport.AtBottom())
+		}
+		return m, nil
+	case toolResultMsg:
+		if c := m.conversation(msg.conversation); c != nil {
+			for _, e := range slices.Backward(c.entries) {
+				if e.kind == entryTool && e.callID == msg.callID {
+					e.done, e.isError, e.text = true, msg.isError, msg.output
+					break
+				}
+			}
+			m.refresh(c == m.current && m.viewport.AtBottom())
+		}
+		return m, nil
+	case elicitMsg:
+		if c := m.conversation(msg.conversation); c != nil {
+			c.elicitations = append(c.elicitations, msg.elicitation)
+			if len(c.elicitations) == 1 {
+				m.ask(c)
+			}
+			m.refresh(c == m.current)
+		} else {
+			msg.elicitation.reply <- mcp.ElicitResult{Action: elicit.Cancel}
+		}
+		return m, nil
+	case usageMsg:
+		if c := m.conversation(msg.conversation); c != nil && msg.progress.Usage != nil {
+			c.usage[msg.progress.MessageID] = msg.progress
+		}
+		return m, nil
+	case doneMsg:
+		if c := m.conversation(msg.conversation); c != nil {
+			c.busy, c.cancel = false, nil
+			switch {
+			case errors.Is(msg.err, context.Canceled):
+				c.add(&entry{kind: entryInfo, text: "Canceled"})
+			case msg.err != nil:
+				c.add(&entry{kind: entryError, text: msg.err.Error()})
+			case msg.result != nil && (!c.streamed || msg.result.IsError):
+				kind := entryAssistant
+				if msg.result.IsError {
+					kind = entryError
+				}
+				if text := contentText(msg.result.Content); text != "" {
+					c.add(&entry{kind: kind, agent: c.agent, text: text})
+				}
+			}
+			// Questions of the turn that are still open can not be answered anymore
+			for _, e := range c.elicitations {
+				e.reply <- mcp.ElicitResult{Action: elicit.Cancel}
+			}
+			c.elicitations = nil
+			// Tool calls that never got a result were canceled
+			for _, e := range c.entries {
+				if e.kind == entryTool && !e.done {
+					e.done, e.isError, e.text = true, true, "canceled"
+				}
+			}
+			m.refresh(c == m.current)
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	cmds = append(cmds, cmd)
+	return m, tea.Batch(cmds...)
+}
+
+func (m *model) cycle(forward bool) {
+	i := slices.Index(m.conversations, m.current)
+	if forward {
+		i = (i + 1) % len(m.conversations)
+	} else {
+		i = (i - 1 + len(m.conversations)) % len(m.conversations)
+	}
+	m.current = m.conversations[i]
+	m.refresh(true)
+}
+
+// submit runs a slash command or sends the message to the agent of the conversation.
+func (m *model) submit(text string) tea.Cmd {
+	c := m.current
+	if !strings.HasPrefix(text, "/") {
+		if c.busy {
+			c.add(&entry{kind: entryInfo, text: "The agent is still working, press ctrl+c to cancel it."})
+			return nil
+		}
+		c.add(&entry{kind: entryUser, text: text})
+		return m.start(c, text)
+	}
+
+	command, arg, _ := strings.Cut(strings.TrimPrefix(text, "/"), " ")
+	arg = strings.TrimSpace(arg)
+	switch command {
+	case "help":
+		c.add(&entry{kind: entryInfo, text: helpText})
+	case "quit", "exit":
+		return tea.Quit
+	case "agent":
+		if arg == "" {
+			c.add(&entry{kind: entryInfo, text: "Agents: " + m.list(m.agents, c.agent)})
+			break
+		}
+		if !slices.Contains(m.agents, arg) {
+			c.add(&entry{kind: entryError, text: fmt.Sprintf("Unknown agent %q, the agents are %s", arg, strings.Join(m.agents, ", "))})
+			break
+		}
+		c.agent = arg
+		c.add(&entry{kind: entryInfo, text: "Talking to " + arg})
+	case "model":
+		if arg == "" {
+			c.add(&entry{kind: entryInfo, text: fmt.Sprintf("Agent %s uses model %s", c.agent, c.model())})
+			break
+		}
+		agent := c.config.Agents[c.agent]
+		agent.Model = types.ModelList{arg}
+		c.config.Agents[c.agent] = agent
+		c.session.Set(types.ConfigSessionKey, &c.config)
+		c.add(&entry{kind: entryInfo, text: fmt.Sprintf("Agent %s now uses model %s", c.agent, arg)})
+	case "reset":
+		if c.busy {
+			c.cancel()
+		}
+		i := slices.Index(m.conversations, c)
+		agent, config := c.agent, c.config
+		c.session.Close(false)
+		ctx := m.newSession(m.ctx, &config)
+		// A new ID, so that the end of a canceled turn is not shown in the new conversation
+		m.nextID++
+		m.conversations[i] = &conversation{
+			id:      m.nextID,
+			ctx:     ctx,
+			session: mcp.SessionFromContext(ctx),
+			config:  config,
+			agent:   agent,
+			entries: []*entry{{kind: entryInfo, text: "Started over"}},
+		}
+		m.conversations[i].session.SetElicitHandler(m.elicitHandler(m.nextID))
+		for _, e := range c.elicitations {
+			e.reply <- mcp.ElicitResult{Action: elicit.Cancel}
+		}
+		m.current = m.conversations[i]
+	case "new":
+		agent := c.agent
+		if arg != "" {
+			if !slices.Contains(m.agents, arg) {
+				c.add(&entry{kind: entryError, text: fmt.Sprintf("Unknown agent %q, the agents are %s", arg, strings.Join(m.agents, ", "))})
+				break
+			}
+			agent = arg
+		}
+		m.newConversation(agent)
+	case "chats":
+		var lines []string
+		for i, conv := range m.conversations {
+			marker := " "
+			if conv == c {
+				marker = "*"
+			}
+			lines = append(lines, fmt.Sprintf("%s %d. %s (%s)", marker, i+1, conv.title(), conv.agent))
+		}
+		c.add(&entry{kind: entryInfo, text: strings.Join(lines, "\n")})
+	case "chat":
+		var i int
+		if _, err := fmt.Sscan(arg, &i); err != nil || i < 1 || i > len(m.conversations) {
+			c.add(&entry{kind: entryError, text: fmt.Sprintf("Use /chat 1 to /chat %d, see /chats", len(m.conversations))})
+			break
+		}
+		m.current = m.conversations[i-1]
+	default:
+		c.add(&entry{kind: entryError, text: fmt.Sprintf("Unknown command /%s, see /help", command)})
+	}
+	return nil
+}
+
+func (m *model) list(items []string, current string) string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item == current {
+			item += " (current)"
+		}
+		result = append(result, item)
+	}
+	return strings.Join(result, ", ")
+}
+
+const helpText = `Commands:
+  /agent [NAME]   show the agents or talk to another agent
+  /model [MODEL]  show or change the model of the agent
+  /reset          start the conversation over
+  /new [AGENT]    start another conversation
+  /chats          list the conversations
+  /chat N         switch to conversation N
+  /quit           exit
+When a tool asks a question, answer it in the input or press ctrl+c to cancel it.
+Keys: enter sends, alt+enter adds a line, ctrl+c cancels the agent or exits, ctrl+n starts a
+conversation, ctrl+left/right switch conversations, ctrl+o shows full tool calls, pgup/pgdown scroll`
+
+// start runs the agent with the prompt and sends the progress to the program.
+func (m *model) start(c *conversation, prompt string) tea.Cmd {
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.busy, c.cancel, c.streamed = true, cancel, false
+	c.usage = map[string]types.CompletionProgress{}
+
+	var (
+		id            = c.id
+		agent         = c.agent
+		progressToken = uuid.String()
+		remove        = c.session.AddFilter(m.filter(id, progressToken))
+	)
+	return func() tea.Msg {
+		defer cancel()
+		defer remove()
+		result, err := m.caller.Call(ctx, agent, agent, types.SampleCallRequest{
+			Prompt: prompt,
+		}, tools.CallOptions{
+			ProgressToken: progressToken,
+		})
+		return doneMsg{conversation: id, result: result, err: err}
+	}
+}
+
+// filter sends the completion progress of the call with the progress token to the program.
+func (m *model) filter(id int, progressToken string) mcp.MessageFilter {
+	return func(_ context.Context, msg *mcp.Message) (*mcp.Message, error) {
+		if msg.Method != "notifications/progress" {
+			return msg, nil
+		}
+
+		var progress mcp.NotificationProgressRequest
+		if err := json.Unmarshal(msg.Params, &progress); err != nil || fmt.Sprint(progress.ProgressToken) != progressToken {
+			return msg, nil
+		}
+
+		var completion types.CompletionProgress
+		if err := mcp.JSONCoerce(progress.Meta[types.CompletionProgressMetaKey], &completion); err != nil {
+			return msg, nil
+		}
+
+		item := completion.Item
+		switch {
+		case completion.Usage != nil:
+			m.send(usageMsg{conversation: id, progress: completion})
+		case item.Partial && item.Content != nil && item.Content.Type == "text" && item.Content.Text != "":
+			m.send(textMsg{conversation: id, agent: completion.Agent, text: item.Content.Text})
+		case item.Partial:
+		case item.ToolCallResult != nil:
+			result := toolResultMsg{
+				conversation: id,
+				callID:       item.ToolCallResult.CallID,
+				output:       contentText(item.ToolCallResult.Output.Content),
+				isError:      item.ToolCallResult.Output.IsError,
+			}
+			if item.ToolCall != nil {
+				result.name = item.ToolCall.Name
+			}
+			m.send(result)
+		case item.ToolCall != nil && item.ToolCall.Name != "":
+			m.send(toolCallMsg{
+				conversation: id,
+				agent:        completion.Agent,
+				callID:       item.ToolCall.CallID,
+				name:         item.ToolCall.Name,
+				arguments:    item.ToolCall.Arguments,
+			})
+		}
+		return msg, nil
+	}
+}
+
+// elicitHandler asks the user to answer the elicitation requests of the session of the conversation.
+func (m *model) elicitHandler(id int) mcp.ElicitHandler {
+	return func(ctx context.Context, req mcp.ElicitRequest) (mcp.ElicitResult, error) {
+		e := &elicitation{
+			req:     req,
+			fields:  elicit.Fields(req.RequestedSchema),
+			field:   -1,
+			content: map[string]any{},
+			// Buffered, the answer must not block the program if the request was canceled
+			reply: make(chan mcp.ElicitResult, 1),
+		}
+		m.send(elicitMsg{conversation: id, elicitation: e})
+		select {
+		case <-ctx.Done():
+			return mcp.ElicitResult{}, ctx.Err()
+		case result := <-e.reply:
+			return result, nil
+		}
+	}
+}
+
+// ask shows the next question of the first elicitation of the conversation.
+func (m *model) ask(c *conversation) {
+	e := c.elicitations[0]
+	if e.field < 0 {
+		text := e.req.Message
+		if server, _ := elicit.Source(e.req); server != "" {
+			text = server + " asks: " + text
+		}
+		if len(e.fields) == 0 {
+			text += "\nAccept? [y/N]"
+		} else {
+			text += "\nRespond? [(a)ccept, (d)ecline, (c)ancel] (a)"
+		}
+		c.add(&entry{kind: entryQuestion, text: text})
+		return
+	}
+	c.add(&entry{kind: entryQuestion, text: e.fields[e.field].Label()})
+}
+
+// respond handles the text the user entered for the first elicitation of the conversation.
+func (m *model) respond(c *conversation, text string) {
+	e := c.elicitations[0]
+	if text != "" {
+		c.add(&entry{kind: entryUser, text: text})
+	}
+
+	if e.field < 0 {
+		answer := strings.ToLower(text)
+		switch {
+		case len(e.fields) == 0 && (answer == "y" || answer == "yes"):
+			m.answer(c, mcp.ElicitResult{Action: elicit.Accept})
+		case len(e.fields) == 0:
+			m.answer(c, mcp.ElicitResult{Action: elicit.Decline})
+		case answer == "" || answer == "a" || answer == "accept" || answer == "y" || answer == "yes":
+			e.field = 0
+			m.ask(c)
+		case answer == "d" || answer == "decline" || answer == "n" || answer == "no":
+			m.answer(c, mcp.ElicitResult{Action: elicit.Decline})
+		default:
+			m.answer(c, mcp.ElicitResult{Action: elicit.Cancel})
+		}
+		return
+	}
+
+	field := e.fields[e.field]
+	value, ok, err := field.Parse(text)
+	if err != nil {
+		c.add(&entry{kind: entryError, text: fmt.Sprintf("%s %v", field.Name, err)})
+		m.ask(c)
+		return
+	}
+	if ok {
+		e.content[field.Name] = value
+	}
+	if e.field++; e.field < len(e.fields) {
+		m.ask(c)
+		return
+	}
+	m.answer(c, mcp.ElicitResult{Action: elicit.Accept, Content: e.content})
+}
+
+// answer replies to the first elicitation of the conversation and asks the next one.
+func (m *model) answer(c *conversation, result mcp.ElicitResult) {
+	e := c.elicitations[0]
+	c.elicitations = c.elicitations[1:]
+	e.reply <- result
+	if result.Action != elicit.Accept {
+		c.add(&entry{kind: entryInfo, text: "Responded with " + result.Action})
+	}
+	if len(c.elicitations) > 0 {
+		m.ask(c)
+	}
+}
+
+func lastEntry(c *conversation) *entry {
+	if len(c.entries) == 0 {
+		return nil
+	}
+	return c.entries[len(c.entries)-1]
+}
+
+func contentText(contents []mcp.Content) string {
+	var parts []string
+	for _, content := range contents {
+		switch {
+		case content.Text != "":
+			parts = append(parts, content.Text)
+		case content.Resource != nil && content.Resource.Text != "":
+			parts = append(parts, content.Resource.Text)
+		case content.Type != "text":
+			parts = append(parts, "["+content.Type+" "+content.MIMEType+"]")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
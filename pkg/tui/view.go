@@ -0,0 +1,158 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// collapsedLines is how many lines of the arguments and output of a tool call are shown, unless the
+// tool calls are expanded.
+const collapsedLines = 4
+
+var (
+	userStyle      = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	agentStyle     = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("10"))
+	infoStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	errorStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	statusStyle    = lipgloss.NewStyle().Reverse(true).Padding(0, 1)
+	toolStyle      = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8")).Padding(0, 1)
+	toolErrorStyle = toolStyle.BorderForeground(lipgloss.Color("9"))
+	toolNameStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("11"))
+	questionStyle  = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("11")).Padding(0, 1)
+)
+
+func (m *model) View() string {
+	if !m.ready {
+		return "Starting..."
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, m.statusBar(), m.viewport.View(), m.input.View())
+}
+
+func (m *model) viewportHeight() int {
+	// The status bar is one line
+	return max(m.height-m.input.Height()-1, 1)
+}
+
+func (m *model) statusBar() string {
+	c := m.current
+	status := fmt.Sprintf("chat %d/%d · %s", slices.Index(m.conversations, c)+1, len(m.conversations), c.agent)
+	if model := c.model(); model != "" {
+		status += " · " + model
+	}
+	if tokens, cost := c.tokens(); tokens > 0 {
+		status += fmt.Sprintf(" · %d tokens", tokens)
+		if cost > 0 {
+			status += fmt.Sprintf(" $%.4f", cost)
+		}
+	}
+	if len(c.elicitations) > 0 {
+		status += " · waiting for your answer, ctrl+c to cancel"
+	} else if c.busy {
+		status += " · " + m.spinner.View() + " working, ctrl+c to cancel"
+	}
+	return statusStyle.Width(m.width).Render(truncate(status, max(m.width-2, 1)))
+}
+
+// refresh renders the current conversation into the viewport, scrolling to the end if bottom is set.
+func (m *model) refresh(bottom bool) {
+	if !m.ready {
+		return
+	}
+
+	var (
+		c     = m.current
+		width = max(m.width-2, 10)
+		parts []string
+	)
+	for _, e := range c.entries {
+		parts = append(parts, m.render(e, width))
+	}
+	if c.busy {
+		if last := lastEntry(c); last == nil || last.kind != entryAssistant {
+			parts = append(parts, infoStyle.Render(m.spinner.View()+" thinking"))
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, infoStyle.Render(fmt.Sprintf("Chatting with %s. Type /help for commands.", c.agent)))
+	}
+
+	m.viewport.SetContent(strings.Join(parts, "\n\n"))
+	if bottom {
+		m.viewport.GotoBottom()
+	}
+}
+
+func (m *model) render(e *entry, width int) string {
+	wrap := lipgloss.NewStyle().Width(width)
+	switch e.kind {
+	case entryUser:
+		return userStyle.Render("You") + "\n" + wrap.Render(e.text)
+	case entryAssistant:
+		return agentStyle.Render(m.agentName(e.agent)) + "\n" + wrap.Render(e.text)
+	case entryTool:
+		return m.renderTool(e, width)
+	case entryError:
+		return errorStyle.Width(width).Render(e.text)
+	case entryQuestion:
+		return questionStyle.Width(width - 2).Render(e.text)
+	default:
+		return infoStyle.Width(width).Render(e.text)
+	}
+}
+
+func (m *model) renderTool(e *entry, width int) string {
+	status := m.spinner.View()
+	style := toolStyle
+	switch {
+	case e.done && e.isError:
+		status = "✗"
+		style = toolErrorStyle
+	case e.done:
+		status = "✓"
+	}
+
+	inner := max(width-4, 10)
+	lines := []string{status + " " + toolNameStyle.Render(e.name)}
+	if e.arguments != "" && e.arguments != "{}" {
+		lines = append(lines, infoStyle.Render(m.clip(e.arguments, inner)))
+	}
+	if e.done && e.text != "" {
+		lines = append(lines, m.clip(e.text, inner))
+	}
+	return style.Width(width - 2).Render(strings.Join(lines, "\n"))
+}
+
+// clip wraps text to the width and keeps the first lines, unless tool calls are expanded.
+func (m *model) clip(text string, width int) string {
+	wrapped := lipgloss.NewStyle().Width(width).Render(strings.TrimSpace(text))
+	if m.expanded {
+		return wrapped
+	}
+	lines := strings.Split(wrapped, "\n")
+	if len(lines) <= collapsedLines {
+		return wrapped
+	}
+	return strings.Join(lines[:collapsedLines], "\n") + "\n" + infoStyle.Render(fmt.Sprintf("… %d more lines, ctrl+o to expand", len(lines)-collapsedLines))
+}
+
+func (m *model) agentName(agent string) string {
+	if name := m.config.Agents[agent].Name; name != "" {
+		return name
+	}
+	if agent == "" {
+		return "Agent"
+	}
+	return agent
+}
+
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:max(n-1, 0)]) + "…"
+}
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// A2AAgent is a remote agent called with the A2A protocol. Agents refer to it by its name in their tools,
+// like an MCP server, and call it as a single tool.
+type A2AAgent struct {
+	// URL of the agent, or of its agent card.
+	URL string `json:"url,omitempty"`
+	// Headers are sent with every request, for example for authentication.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Description of the tool, defaults to the description in the agent card.
+	Description string `json:"description,omitempty"`
+}
+
+func (a A2AAgent) validate(name string) error {
+	if a.URL == "" {
+		return fmt.Errorf("a2a agent %q must have a url", name)
+	}
+	u, err := url.Parse(a.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("a2a agent %q has invalid url %q, must be an http or https URL", name, a.URL)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package types
+
+import "fmt"
+
+// Channels are chat frontends that relay messages to agents.
+type Channels struct {
+	Slack *SlackChannel `json:"slack,omitempty"`
+}
+
+// SlackChannel connects a Slack app to agents. Each Slack thread is a session. Events are received over
+// Socket Mode if AppToken is set, otherwise over the Events API at /channels/slack/events, verified with
+// the SigningSecret.
+type SlackChannel struct {
+	BotToken      string `json:"botToken,omitempty"`
+	AppToken      string `json:"appToken,omitempty"`
+	SigningSecret string `json:"signingSecret,omitempty"`
+	// Agent answers mentions and direct messages, defaults to the first entrypoint.
+	Agent string `json:"agent,omitempty"`
+	// Commands maps a slash command, like /research, to the agent that runs it.
+	Commands map[string]string `json:"commands,omitempty"`
+	// HideToolCalls disables posting the tool calls of the agent to the thread.
+	HideToolCalls bool `json:"hideToolCalls,omitempty"`
+}
+
+// GetAgent returns the agent that answers messages that are not slash commands.
+func (s *SlackChannel) GetAgent(c Config) string {
+	if s.Agent != "" {
+		return s.Agent
+	}
+	if len(c.Publish.Entrypoint) > 0 {
+		return c.Publish.Entrypoint[0]
+	}
+	return ""
+}
+
+func (c *Channels) validate(config Config) error {
+	if c == nil || c.Slack == nil {
+		return nil
+	}
+
+	slack := c.Slack
+	if slack.BotToken == "" {
+		return fmt.Errorf("channels slack must have a botToken")
+	}
+	if slack.AppToken == "" && slack.SigningSecret == "" {
+		return fmt.Errorf("channels slack must have an appToken for Socket Mode or a signingSecret for the Events API")
+	}
+
+	agents := map[string]string{"agent": slack.GetAgent(config)}
+	for command, agent := range slack.Commands {
+		agents["command "+command] = agent
+	}
+	for field, agent := range agents {
+		if _, ok := config.Agents[agent]; ok {
+			continue
+		}
+		if _, ok := config.MCPServers[agent]; ok {
+			continue
+		}
+		return fmt.Errorf("channels slack %s references undefined agent %q", field, agent)
+	}
+	return nil
+}
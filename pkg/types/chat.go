@@ -26,7 +26,11 @@ var ChatInputSchema = []byte(`{
 	    "required": ["url"],
 	    "properties": {
 	      "url": {
-	        "description": "The URL of the attachment or data URI",
+	        "description": "The data URI of the attachment or the nanobot://resource/ URI of a resource of the session",
+	        "type": "string"
+	      },
+	      "name": {
+	        "description": "The file name of the attachment",
 	        "type": "string"
 	      },
 	      "mimeType": {
@@ -51,6 +55,7 @@ type SampleConfirmRequest struct {
 
 type Attachment struct {
 	URL      string `json:"url"`
+	Name     string `json:"name,omitempty"`
 	MimeType string `json:"mimeType,omitempty"`
 }
 
@@ -79,6 +84,22 @@ type Chat struct {
 	Visibility string    `json:"visibility,omitempty"`
 }
 
+type ConversationList struct {
+	Conversations []Conversation `json:"conversations"`
+}
+
+// Conversation is a session that was started with a conversation ID supplied by the client.
+type Conversation struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"sessionId"`
+	Title     string    `json:"title,omitempty"`
+	Agent     string    `json:"agent,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	Workspace string    `json:"workspace,omitempty"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+}
+
 type AgentList struct {
 	Agents []AgentDisplay `json:"agents"`
 }
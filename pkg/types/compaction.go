@@ -0,0 +1,35 @@
+package types
+
+import (
+	"fmt"
+)
+
+// Compaction configures when the message history of an agent is summarized to fit in the context
+// window of the model.
+type Compaction struct {
+	// ContextWindow of the model in tokens
+	ContextWindow int `json:"contextWindow,omitempty"`
+	// Threshold is the fraction of the context window at which the history is compacted, defaults to 0.8.
+	Threshold float64 `json:"threshold,omitempty"`
+	// Model used to summarize the history, defaults to the model of the agent.
+	Model string `json:"model,omitempty"`
+	// KeepMessages is the number of most recent messages that are never compacted, defaults to 4.
+	KeepMessages int `json:"keepMessages,omitempty"`
+}
+
+func (c *Compaction) IsSet() bool {
+	return c != nil && c.ContextWindow > 0
+}
+
+func (c *Compaction) validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.ContextWindow < 0 || c.KeepMessages < 0 {
+		return fmt.Errorf("contextWindow and keepMessages must not be negative")
+	}
+	if c.Threshold < 0 || c.Threshold > 1 {
+		return fmt.Errorf("threshold must be between 0 and 1")
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/nanobot-ai/nanobot/pkg/complete"
@@ -27,10 +28,17 @@ func (c CompletionOptions) Merge(other CompletionOptions) (result CompletionOpti
 }
 
 type CompletionRequest struct {
-	Model             string               `json:"model,omitempty"`
-	Agent             string               `json:"agent,omitempty"`
-	ThreadName        string               `json:"threadName,omitempty"`
-	NewThread         bool                 `json:"newThread,omitempty"`
+	Model string `json:"model,omitempty"`
+	// FallbackModels are tried in order when the completion with Model fails.
+	FallbackModels []string `json:"fallbackModels,omitempty"`
+	// ModelOverride replaces the models of the agent for this request, like a regenerated response with another model.
+	ModelOverride string `json:"modelOverride,omitempty"`
+	BaseURL       string `json:"baseURL,omitempty"`
+	Agent         string `json:"agent,omitempty"`
+	ThreadName    string `json:"threadName,omitempty"`
+	NewThread     bool   `json:"newThread,omitempty"`
+	// Resume continues the interrupted turn of the checkpoint of the thread instead of starting a new one.
+	Resume            bool                 `json:"resume,omitempty"`
 	Input             []Message            `json:"input,omitzero"`
 	ModelPreferences  mcp.ModelPreferences `json:"modelPreferences,omitzero"`
 	SystemPrompt      string               `json:"systemPrompt,omitzero"`
@@ -40,16 +48,22 @@ type CompletionRequest struct {
 	Temperature       *json.Number         `json:"temperature,omitempty"`
 	Truncation        string               `json:"truncation,omitempty"`
 	TopP              *json.Number         `json:"topP,omitempty"`
+	Stop              []string             `json:"stop,omitempty"`
+	FrequencyPenalty  *json.Number         `json:"frequencyPenalty,omitempty"`
+	PresencePenalty   *json.Number         `json:"presencePenalty,omitempty"`
+	Seed              *int                 `json:"seed,omitempty"`
 	Metadata          map[string]any       `json:"metadata,omitempty"`
 	Tools             []ToolUseDefinition  `json:"tools,omitzero"`
 	InputAsToolResult *bool                `json:"inputAsToolResult,omitempty"`
 	Reasoning         *AgentReasoning      `json:"reasoning,omitempty"`
+	SafetySettings    map[string]string    `json:"safetySettings,omitempty"`
 }
 
 func (r CompletionRequest) Reset() CompletionRequest {
 	r.Input = nil
 	r.InputAsToolResult = &[]bool{false}[0]
 	r.NewThread = false
+	r.Resume = false
 	return r
 }
 
@@ -65,9 +79,24 @@ type CompletionProgress struct {
 	Agent     string         `json:"agent,omitempty"`
 	MessageID string         `json:"messageID,omitempty"`
 	Role      string         `json:"role,omitempty"`
-	Item      CompletionItem `json:"item,omitempty"`
+	Item      CompletionItem `json:"item,omitzero"`
+	// Usage is the usage of the completion of the message so far, it is sent without an item each time
+	// the provider reports it.
+	Usage *Usage `json:"usage,omitempty"`
+	// CostUSD is the cost of Usage with the pricing of the config.
+	CostUSD float64 `json:"costUSD,omitempty"`
+	// StopReason is why the LLM stopped, sent once it is known: end_turn, tool_use, max_tokens,
+	// content_filter, or the reason of the provider.
+	StopReason string `json:"stopReason,omitempty"`
 }
 
+const (
+	StopReasonEndTurn       = "end_turn"
+	StopReasonToolUse       = "tool_use"
+	StopReasonMaxTokens     = "max_tokens"
+	StopReasonContentFilter = "content_filter"
+)
+
 const CompletionProgressMetaKey = "ai.nanobot.progress/completion"
 
 type Message struct {
@@ -76,6 +105,8 @@ type Message struct {
 	Role    string           `json:"role,omitempty"`
 	Items   []CompletionItem `json:"items,omitempty"`
 	HasMore bool             `json:"hasMore,omitempty"`
+	// Tokens are the tokens of the message, as reported by the provider for completed messages.
+	Tokens int `json:"tokens,omitempty"`
 }
 
 type CompletionItem struct {
@@ -235,6 +266,10 @@ func (c CompletionItem) MarshalJSON() ([]byte, error) {
 	return json.Marshal(Alias(c))
 }
 
+// AnthropicReasoningPrefix starts the encrypted content of the reasoning of Anthropic models, which the
+// models of other providers can not read.
+const AnthropicReasoningPrefix = "anthropic-"
+
 type Reasoning struct {
 	EncryptedContent string        `json:"encryptedContent,omitempty"`
 	Summary          []SummaryText `json:"summary,omitempty"`
@@ -253,6 +288,32 @@ type CompletionResponse struct {
 	HasMore          bool      `json:"hasMore,omitempty"`
 	Error            string    `json:"error,omitempty"`
 	ProgressToken    any       `json:"progressToken,omitempty"`
+	Usage            *Usage    `json:"usage,omitempty"`
+	// PlannedToolCalls are the tool calls that were not run because of a dry run.
+	PlannedToolCalls []PlannedToolCall `json:"plannedToolCalls,omitempty"`
+}
+
+// PlannedToolCall is a tool call the model requested in a dry run.
+type PlannedToolCall struct {
+	CallID    string `json:"callID,omitempty"`
+	Name      string `json:"name"`
+	MCPServer string `json:"mcpServer,omitempty"`
+	Tool      string `json:"tool,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+type Usage struct {
+	InputTokens  int `json:"inputTokens,omitempty"`
+	OutputTokens int `json:"outputTokens,omitempty"`
+	// Estimated is true if the provider did not report the usage and it was counted with a tokenizer.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+func (u *Usage) TotalTokens() int {
+	if u == nil {
+		return 0
+	}
+	return u.InputTokens + u.OutputTokens
 }
 
 func (c *CompletionResponse) Serialize() (any, error) {
@@ -286,12 +347,38 @@ type CallResult struct {
 	Agent        string        `json:"agent,omitempty"`
 	Model        string        `json:"model,omitempty"`
 	StopReason   string        `json:"stopReason,omitempty"`
+	// PlannedToolCalls are the tool calls that were not run because of a dry run.
+	PlannedToolCalls []PlannedToolCall `json:"plannedToolCalls,omitempty"`
+	// StructuredContent is the structured content of the result of a tool, it is given to the model
+	// instead of the text content.
+	StructuredContent any `json:"structuredContent,omitempty"`
+}
+
+// Text returns the text content of the result.
+func (c *CallResult) Text() string {
+	var buf strings.Builder
+	for _, content := range c.Content {
+		if content.Type == "text" {
+			buf.WriteString(content.Text)
+		}
+	}
+	return buf.String()
 }
 
 type AsyncCallResult struct {
-	IsError       bool          `json:"isError"`
-	Content       []mcp.Content `json:"content,omitzero"`
-	InProgress    bool          `json:"inProgress,omitempty"`
-	ToolName      string        `json:"toolName,omitempty"`
-	ProgressToken any           `json:"progressToken,omitempty"`
+	IsError       bool           `json:"isError"`
+	Content       []mcp.Content  `json:"content,omitzero"`
+	InProgress    bool           `json:"inProgress,omitempty"`
+	ToolName      string         `json:"toolName,omitempty"`
+	ProgressToken any            `json:"progressToken,omitempty"`
+	Usage         *UsageProgress `json:"usage,omitempty"`
+}
+
+// UsageProgress is the usage of the completions of a call, from what the providers reported so far.
+type UsageProgress struct {
+	InputTokens  int     `json:"inputTokens,omitempty"`
+	OutputTokens int     `json:"outputTokens,omitempty"`
+	CostUSD      float64 `json:"costUSD,omitempty"`
+	// StopReason is the stop reason of the last completion that stopped.
+	StopReason string `json:"stopReason,omitempty"`
 }
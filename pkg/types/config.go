@@ -5,11 +5,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"net/url"
+	"path"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/egress"
 	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tmpl"
 )
 
 const (
@@ -21,6 +30,8 @@ const (
 	PublicSessionKey                = "public"
 	ResourceSubscriptionsSessionKey = "resourceSubscriptions"
 	PublicURLSessionKey             = "publicURL"
+	SessionTTLSessionKey            = "sessionTTL"
+	ConversationIDSessionKey        = "conversationID"
 )
 
 func ConfigFromContext(ctx context.Context) (result Config) {
@@ -31,6 +42,7 @@ func ConfigFromContext(ctx context.Context) (result Config) {
 type Config struct {
 	Auth       *Auth                 `json:"auth,omitempty"`
 	Extends    StringList            `json:"extends,omitempty"`
+	Include    StringList            `json:"include,omitempty"`
 	Env        map[string]EnvDef     `json:"env,omitempty"`
 	Publish    Publish               `json:"publish,omitempty"`
 	Agents     map[string]Agent      `json:"agents,omitempty"`
@@ -38,6 +50,69 @@ type Config struct {
 	Flows      map[string]Flow       `json:"flows,omitempty"`
 	Profiles   map[string]Config     `json:"profiles,omitempty"`
 	Prompts    map[string]Prompt     `json:"prompts,omitempty"`
+	Session    *SessionConfig        `json:"session,omitempty"`
+	Limits     *Limits               `json:"limits,omitempty"`
+	// Pricing maps a model name to its price, used to enforce maxCostUSD limits and to report usage.
+	Pricing map[string]ModelPricing `json:"pricing,omitempty"`
+	// ModelAliases maps a model name used by agents to the name of the model sent to the LLM provider.
+	ModelAliases map[string]string `json:"modelAliases,omitempty"`
+	// ToolConcurrency is the maximum number of tool calls of one turn that run at the same time, defaults
+	// to 8. Set to 1 to run tool calls one after the other.
+	ToolConcurrency int `json:"toolConcurrency,omitempty"`
+	// Triggers run agents on a schedule while the nanobot is running.
+	Triggers map[string]Trigger `json:"triggers,omitempty"`
+	// Webhooks run agents for payloads POSTed to /webhooks/{name}.
+	Webhooks map[string]Webhook `json:"webhooks,omitempty"`
+	// Channels are chat frontends, like Slack, that relay messages to agents.
+	Channels *Channels `json:"channels,omitempty"`
+	// Retries maps an LLM provider, openai, anthropic, ollama, or the name of one of the providers, to
+	// how its failed completions are retried. "*" applies to all providers.
+	Retries map[string]RetryPolicy `json:"retries,omitempty"`
+	// MemoryStores are the vector stores agents refer to in the store field of their memory.
+	MemoryStores map[string]MemoryStore `json:"memoryStores,omitempty"`
+	// Tools are custom tools that run inside nanobot, like WebAssembly modules.
+	Tools map[string]Tool `json:"tools,omitempty"`
+	// A2A are remote agents called with the A2A protocol, agents refer to them by name in their tools.
+	A2A map[string]A2AAgent `json:"a2a,omitempty"`
+	// Middleware runs on every turn of all agents, before the middleware of the agent.
+	Middleware []Middleware `json:"middleware,omitempty"`
+	// Elicitation answers elicitation requests and tool confirmations when there is no user to ask, like
+	// in triggers, webhooks, and nanobot batch.
+	Elicitation *ElicitationConfig `json:"elicitation,omitempty"`
+	// Roots maps root names to the directories exposed to MCP servers that list roots, in addition
+	// to the roots of the client and those given on the command line.
+	Roots map[string]string `json:"roots,omitempty"`
+	// Timeouts are the default timeouts of tool calls and turns.
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
+	// Providers are the Azure OpenAI and AWS Bedrock endpoints agents select with their provider.
+	Providers map[string]Provider `json:"providers,omitempty"`
+	// Partials are templates the instructions of agents include with {{ template "name" . }}.
+	Partials map[string]string `json:"partials,omitempty"`
+	// Experiments route a percentage of the new sessions of agents to variants of the agents.
+	Experiments map[string]Experiment `json:"experiments,omitempty"`
+	// Workspaces group users, the sessions of the members get the env of their workspace.
+	Workspaces map[string]Workspace `json:"workspaces,omitempty"`
+	// Logging sets the format, levels, and sinks of the logs of nanobot.
+	Logging *Logging `json:"logging,omitempty"`
+	// WireLog is the store of the requests and responses of the completions of agents with wireLog.
+	WireLog *WireLog `json:"wireLog,omitempty"`
+}
+
+// ResolveModel returns the provider model name for the given model, following model aliases.
+func (c Config) ResolveModel(model string) string {
+	seen := map[string]struct{}{}
+	for {
+		alias, ok := c.ModelAliases[model]
+		if !ok || alias == "" {
+			return model
+		}
+		if _, ok := seen[model]; ok {
+			// Alias loop, use the last name seen
+			return model
+		}
+		seen[model] = struct{}{}
+		model = alias
+	}
 }
 
 type ConfigFactory func(ctx context.Context, profiles string) (Config, error)
@@ -52,6 +127,101 @@ func (c Config) Validate(allowLocal bool) error {
 		errs = append(errs, fmt.Errorf("publish must have at least one entrypoint agent set if there are multiple agents"))
 	}
 
+	if c.Session != nil {
+		if _, err := c.Session.GetTTL(); err != nil {
+			errs = append(errs, err)
+		}
+		if _, err := c.Session.GetWorkdir().GetQuota(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := c.Limits.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.Auth.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for name, trigger := range c.Triggers {
+		if err := trigger.validate(name, c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for name, webhook := range c.Webhooks {
+		if err := webhook.validate(name, c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := c.Channels.validate(c); err != nil {
+		errs = append(errs, err)
+	}
+
+	for name, store := range c.MemoryStores {
+		if err := store.validate(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for name, provider := range c.Providers {
+		if err := provider.validate(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if _, err := tmpl.Parse("partials", "", c.Partials, tmpl.Funcs{}); err != nil {
+		errs = append(errs, err)
+	}
+
+	for name, experiment := range c.Experiments {
+		if err := experiment.validate(name, c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for name, workspace := range c.Workspaces {
+		if err := workspace.validate(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := c.Logging.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.WireLog.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for provider, policy := range c.Retries {
+		if err := policy.validate(provider); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.ToolConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("toolConcurrency must not be negative"))
+	}
+
+	if err := validateMiddleware(c.Middleware); err != nil {
+		errs = append(errs, fmt.Errorf("invalid middleware: %w", err))
+	}
+
+	if err := c.Elicitation.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateRoots(c.Roots); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.Timeouts.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
 	for _, extend := range c.Extends {
 		if strings.HasPrefix(strings.TrimSpace(extend), "/") {
 			errs = append(errs, fmt.Errorf("extends cannot be an absolute path: %s", c.Extends))
@@ -76,6 +246,24 @@ func (c Config) Validate(allowLocal bool) error {
 		}
 	}
 
+	for toolName, tool := range c.Tools {
+		if err := checkDup(seenNames, "tools", toolName); err != nil {
+			errs = append(errs, err)
+		}
+		if err := tool.validate(toolName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for a2aName, a2aAgent := range c.A2A {
+		if err := checkDup(seenNames, "a2a", a2aName); err != nil {
+			errs = append(errs, err)
+		}
+		if err := a2aAgent.validate(a2aName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	for flowName, flow := range c.Flows {
 		if err := checkDup(seenNames, "flows", flowName); err != nil {
 			errs = append(errs, err)
@@ -85,10 +273,84 @@ func (c Config) Validate(allowLocal bool) error {
 		}
 	}
 
-	return errors.Join(errs...)
+	if len(errs) > 0 {
+		return &ConfigError{Err: errors.Join(errs...)}
+	}
+	return nil
 }
 
 func validateMCPServer(mcpServerName string, mcpServer mcp.Server, allowLocal bool) error {
+	for tool, ttl := range mcpServer.ToolCache {
+		if _, err := time.ParseDuration(ttl); err != nil {
+			return fmt.Errorf("mcpServer %q has invalid toolCache TTL %q for tool %q: %w", mcpServerName, ttl, tool, err)
+		}
+	}
+
+	if mcpServer.MaxConcurrency < 0 {
+		return fmt.Errorf("mcpServer %q has a negative maxConcurrency", mcpServerName)
+	}
+
+	switch mcpServer.Scope {
+	case "", mcp.ScopeSession, mcp.ScopeShared:
+	default:
+		return fmt.Errorf("mcpServer %q has invalid scope %q, must be shared or session", mcpServerName, mcpServer.Scope)
+	}
+	if mcpServer.Scope == mcp.ScopeShared && (mcpServer.BaseURL != "" || mcpServer.Command == "" && mcpServer.Runtime == "") {
+		return fmt.Errorf("mcpServer %q has the shared scope but is not a stdio server", mcpServerName)
+	}
+
+	if tls := mcpServer.TLS; tls != nil {
+		if mcpServer.BaseURL == "" {
+			return fmt.Errorf("mcpServer %q has tls but no url", mcpServerName)
+		}
+		if (tls.CertFile == "") != (tls.KeyFile == "") {
+			return fmt.Errorf("mcpServer %q must set both certFile and keyFile of tls", mcpServerName)
+		}
+	}
+
+	if policy := mcpServer.Egress; policy != nil {
+		if mcpServer.Command == "" && mcpServer.Runtime == "" {
+			return fmt.Errorf("mcpServer %q has an egress policy but no command nanobot starts", mcpServerName)
+		}
+		// Pods run on other hosts, their egress is limited by the network policies of the cluster
+		if mcpServer.Runtime == mcp.RuntimeKubernetes {
+			return fmt.Errorf("mcpServer %q has an egress policy, which the kubernetes runtime does not support, use a network policy", mcpServerName)
+		}
+		// Containers on the host network connect anywhere without going through the proxy
+		if mcpServer.Runtime == mcp.RuntimeDocker && mcpServer.Container.Network == "host" {
+			return fmt.Errorf("mcpServer %q has an egress policy, which the host container network bypasses, use a bridge network", mcpServerName)
+		}
+		if _, err := egress.NewPolicy(policy.Allow, policy.Deny); err != nil {
+			return fmt.Errorf("mcpServer %q has an invalid egress policy: %w", mcpServerName, err)
+		}
+	}
+
+	if err := validateContainer(mcpServerName, mcpServer); err != nil {
+		return err
+	}
+
+	for tool, policy := range mcpServer.Confirm {
+		if policy == "always" || policy == "never" {
+			continue
+		}
+		if _, err := regexp.Compile(policy); err != nil {
+			return fmt.Errorf("mcpServer %q has invalid confirm pattern %q for tool %q: %w", mcpServerName, policy, tool, err)
+		}
+	}
+
+	if err := validateSampling(mcpServerName, mcpServer.Sampling); err != nil {
+		return err
+	}
+
+	if err := validateTimeout(fmt.Sprintf("mcpServer %q", mcpServerName), mcpServer.Timeout); err != nil {
+		return err
+	}
+	for tool, timeout := range mcpServer.ToolTimeouts {
+		if err := validateTimeout(fmt.Sprintf("tool %q of mcpServer %q", tool, mcpServerName), timeout); err != nil {
+			return err
+		}
+	}
+
 	if allowLocal {
 		return nil
 	}
@@ -105,6 +367,68 @@ func validateMCPServer(mcpServerName string, mcpServer mcp.Server, allowLocal bo
 	return nil
 }
 
+func validateSampling(mcpServerName string, sampling *mcp.SamplingConfig) error {
+	if sampling == nil {
+		return nil
+	}
+	switch sampling.Approval {
+	case "", "always", "once", "never":
+	default:
+		return fmt.Errorf("mcpServer %q has invalid sampling approval %q, must be always, once, or never", mcpServerName, sampling.Approval)
+	}
+	if sampling.MaxTokens < 0 || sampling.TokenBudget < 0 {
+		return fmt.Errorf("mcpServer %q has a negative sampling maxTokens or tokenBudget", mcpServerName)
+	}
+	return nil
+}
+
+func validateContainer(mcpServerName string, mcpServer mcp.Server) error {
+	switch mcpServer.Runtime {
+	case "":
+		return nil
+	case mcp.RuntimeDocker:
+	case mcp.RuntimeKubernetes:
+		return validatePod(mcpServerName, mcpServer)
+	default:
+		return fmt.Errorf("mcpServer %q has invalid runtime %q: must be docker or kubernetes", mcpServerName, mcpServer.Runtime)
+	}
+
+	if mcpServer.Image == "" {
+		return fmt.Errorf("mcpServer %q with the docker runtime must have an image", mcpServerName)
+	}
+	if mcpServer.Container.CPUs != "" {
+		if _, err := strconv.ParseFloat(mcpServer.Container.CPUs, 64); err != nil {
+			return fmt.Errorf("mcpServer %q has invalid container cpus %q: %w", mcpServerName, mcpServer.Container.CPUs, err)
+		}
+	}
+	if mcpServer.Container.Network == "none" && mcpServer.BaseURL != "" {
+		return fmt.Errorf("mcpServer %q has a url but its container has no network, use stdio or another network", mcpServerName)
+	}
+	switch mcpServer.Container.Pull {
+	case "", "missing", "always", "never":
+	default:
+		return fmt.Errorf("mcpServer %q has invalid container pull policy %q: must be missing, always, or never", mcpServerName, mcpServer.Container.Pull)
+	}
+	return nil
+}
+
+func validatePod(mcpServerName string, mcpServer mcp.Server) error {
+	if mcpServer.Image == "" {
+		return fmt.Errorf("mcpServer %q with the kubernetes runtime must have an image", mcpServerName)
+	}
+	switch mcpServer.Kubernetes.Connect {
+	case "", "port-forward", "service":
+	default:
+		return fmt.Errorf("mcpServer %q has invalid kubernetes connect %q: must be port-forward or service", mcpServerName, mcpServer.Kubernetes.Connect)
+	}
+	switch mcpServer.Kubernetes.Pull {
+	case "", "missing", "always", "never":
+	default:
+		return fmt.Errorf("mcpServer %q has invalid kubernetes pull policy %q: must be missing, always, or never", mcpServerName, mcpServer.Kubernetes.Pull)
+	}
+	return nil
+}
+
 type Prompt struct {
 	Description string           `json:"description,omitempty"`
 	Input       map[string]Field `json:"input,omitempty"`
@@ -133,6 +457,166 @@ type Auth struct {
 	OAuthScopes                      StringList     `json:"oauthScopes"`
 	OAuthAuthorizationServerMetadata map[string]any `json:"oauthAuthorizationServerMetadata"`
 	EncryptionKey                    string         `json:"encryptionKey"`
+	// APIKeys are static keys that clients send as a bearer token or in the X-API-Key header.
+	APIKeys []APIKey `json:"apiKeys,omitempty"`
+	// JWT validates bearer tokens signed by a key of a JWKS.
+	JWT *JWTAuth `json:"jwt,omitempty"`
+	// Roles maps a role name to the tools and agents identities with the role may use.
+	Roles map[string]Role `json:"roles,omitempty"`
+	// DefaultRoles are the roles of identities that are not assigned any role.
+	DefaultRoles StringList `json:"defaultRoles,omitempty"`
+	// Admins are the IDs or emails of the users that can list, resume and delete the sessions of all
+	// users.
+	Admins StringList `json:"admins,omitempty"`
+}
+
+// IsAdmin returns true if the user is one of the admins.
+func (a *Auth) IsAdmin(user User) bool {
+	if a == nil || user.ID == "" {
+		return false
+	}
+	return slices.ContainsFunc(a.Admins, func(admin string) bool {
+		return admin == user.ID || user.HasEmail(admin)
+	})
+}
+
+// Role lists the tools and agents an identity may use. Tools are matched against the published name of
+// a tool and against "<mcpServer>/<tool>", and may contain wildcards like "search/*". A tool is also
+// allowed if its agent or MCP server is listed in Agents. A role without tools and agents allows
+// everything.
+type Role struct {
+	Tools  StringList `json:"tools,omitempty"`
+	Agents StringList `json:"agents,omitempty"`
+}
+
+// RequiresBearer returns true if requests must carry an API key or a JWT.
+func (a *Auth) RequiresBearer() bool {
+	return a != nil && (len(a.APIKeys) > 0 || a.JWT != nil)
+}
+
+func (a *Auth) validate() error {
+	if a == nil {
+		return nil
+	}
+	names := map[string]bool{}
+	for i, key := range a.APIKeys {
+		if key.Name == "" {
+			return fmt.Errorf("auth apiKeys[%d] must have a name", i)
+		}
+		if key.Key == "" {
+			return fmt.Errorf("auth apiKey %q must have a key", key.Name)
+		}
+		if names[key.Name] {
+			return fmt.Errorf("auth apiKey %q is defined more than once", key.Name)
+		}
+		names[key.Name] = true
+	}
+	if a.JWT != nil && a.JWT.JWKSURL == "" {
+		return fmt.Errorf("auth jwt must have a jwksURL")
+	}
+	for name, role := range a.Roles {
+		for _, tool := range role.Tools {
+			if _, err := path.Match(tool, ""); err != nil {
+				return fmt.Errorf("auth role %q has invalid tool pattern %q: %w", name, tool, err)
+			}
+		}
+	}
+	for _, key := range a.APIKeys {
+		for _, role := range key.Roles {
+			if _, ok := a.Roles[role]; !ok {
+				return fmt.Errorf("auth apiKey %q references undefined role %q", key.Name, role)
+			}
+		}
+	}
+	if a.JWT != nil {
+		for _, role := range a.JWT.Roles {
+			if _, ok := a.Roles[role]; !ok {
+				return fmt.Errorf("auth jwt references undefined role %q", role)
+			}
+		}
+	}
+	for _, role := range a.DefaultRoles {
+		if _, ok := a.Roles[role]; !ok {
+			return fmt.Errorf("auth defaultRoles references undefined role %q", role)
+		}
+	}
+	return nil
+}
+
+type APIKey struct {
+	// Name identifies the key, requests with the key use "apikey:<name>" as their user ID.
+	Name string `json:"name,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// Agents the key is allowed to use, all agents if empty.
+	Agents StringList `json:"agents,omitempty"`
+	// Roles of the key, see Auth.Roles.
+	Roles StringList `json:"roles,omitempty"`
+}
+
+type JWTAuth struct {
+	JWKSURL  string `json:"jwksURL,omitempty"`
+	Issuer   string `json:"issuer,omitempty"`
+	Audience string `json:"audience,omitempty"`
+	// AgentsClaim is the claim that lists the agents a token is allowed to use. If the claim is not set
+	// in a token the Agents field applies.
+	AgentsClaim string `json:"agentsClaim,omitempty"`
+	// Agents tokens are allowed to use, all agents if empty.
+	Agents StringList `json:"agents,omitempty"`
+	// RolesClaim is the claim that lists the roles of a token. If the claim is not set in a token the
+	// Roles field applies.
+	RolesClaim string     `json:"rolesClaim,omitempty"`
+	Roles      StringList `json:"roles,omitempty"`
+}
+
+type SessionConfig struct {
+	TTL string `json:"ttl,omitempty"`
+	// Workdir gives each session its own scratch directory that is shared with the stdio MCP servers of
+	// the session.
+	Workdir *Workdir `json:"workdir,omitempty"`
+}
+
+type Workdir struct {
+	// Dir is the directory the session directories are created in, defaults to nanobot-sessions in the
+	// temp directory.
+	Dir string `json:"dir,omitempty"`
+	// Quota is the maximum size of a session directory (e.g. 500MB), unset means no limit.
+	Quota string `json:"quota,omitempty"`
+}
+
+// GetWorkdir returns the workdir configuration, nil if sessions do not get a working directory.
+func (s *SessionConfig) GetWorkdir() *Workdir {
+	if s == nil {
+		return nil
+	}
+	return s.Workdir
+}
+
+// GetQuota returns the quota in bytes, zero means no limit.
+func (w *Workdir) GetQuota() (uint64, error) {
+	if w == nil || w.Quota == "" {
+		return 0, nil
+	}
+	quota, err := humanize.ParseBytes(w.Quota)
+	if err != nil {
+		return 0, fmt.Errorf("invalid session workdir quota %q: %w", w.Quota, err)
+	}
+	return quota, nil
+}
+
+// GetTTL returns how long an idle session is kept before it is expired. Zero
+// means the session never expires.
+func (s *SessionConfig) GetTTL() (time.Duration, error) {
+	if s == nil || s.TTL == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(s.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid session ttl %q: %w", s.TTL, err)
+	}
+	if ttl < 0 {
+		return 0, fmt.Errorf("invalid session ttl %q: must not be negative", s.TTL)
+	}
+	return ttl, nil
 }
 
 type EnvDef struct {
@@ -176,23 +660,35 @@ func (f Flow) validate(flowName string, c Config) error {
 	return errors.Join(errs...)
 }
 
+// The policies of a step for the loops of forEach and while that fail.
+const (
+	// StepOnErrorFail stops the step, and the parallel loops that are still running, at the first loop that fails.
+	StepOnErrorFail = "fail"
+	// StepOnErrorContinue runs the other loops, the failed loops are in the output of the step as errors.
+	StepOnErrorContinue = "continue"
+)
+
 type Step struct {
-	ID         string         `json:"id,omitempty"`
-	Agent      AgentCall      `json:"agent,omitempty"`
-	Tool       string         `json:"tool,omitempty"`
-	Flow       string         `json:"flow,omitempty"`
-	If         string         `json:"if,omitempty"`
-	While      string         `json:"while,omitempty"`
-	Elicit     *Elicit        `json:"elicit,omitempty"`
-	ForEach    any            `json:"forEach,omitempty"`
-	ForEachVar string         `json:"forEachVar,omitempty"`
-	Set        map[string]any `json:"set,omitempty"`
-	Evaluate   any            `json:"evaluate,omitempty"`
-	Return     map[string]any `json:"return,omitempty"`
-	Input      any            `json:"input,omitempty"`
-	Parallel   bool
-	Steps      []Step `json:"steps,omitzero"`
-	Else       []Step `json:"else,omitzero"`
+	ID            string         `json:"id,omitempty"`
+	Agent         AgentCall      `json:"agent,omitempty"`
+	Tool          string         `json:"tool,omitempty"`
+	Flow          string         `json:"flow,omitempty"`
+	If            string         `json:"if,omitempty"`
+	While         string         `json:"while,omitempty"`
+	Elicit        *Elicit        `json:"elicit,omitempty"`
+	ForEach       any            `json:"forEach,omitempty"`
+	ForEachVar    string         `json:"forEachVar,omitempty"`
+	MaxIterations int            `json:"maxIterations,omitempty"`
+	Set           map[string]any `json:"set,omitempty"`
+	Evaluate      any            `json:"evaluate,omitempty"`
+	Return        map[string]any `json:"return,omitempty"`
+	Input         any            `json:"input,omitempty"`
+	Parallel      bool           `json:"parallel,omitempty"`
+	Concurrency   int            `json:"concurrency,omitempty"`
+	OnError       string         `json:"onError,omitempty"`
+	Reduce        AgentCall      `json:"reduce,omitempty"`
+	Steps         []Step         `json:"steps,omitzero"`
+	Else          []Step         `json:"else,omitzero"`
 }
 
 type Elicit struct {
@@ -232,24 +728,42 @@ func ignoreEmptyStringList(s string) []string {
 }
 
 func (s Step) validate(c Config) error {
-	_, _, errs := validateReferences(c, ignoreEmptyStringList(s.Tool), ignoreEmptyStringList(s.Agent.Name), ignoreEmptyStringList(s.Flow))
+	_, _, errs := validateReferences(c, ignoreEmptyStringList(s.Tool), append(ignoreEmptyStringList(s.Agent.Name), ignoreEmptyStringList(s.Reduce.Name)...), ignoreEmptyStringList(s.Flow))
+	if s.OnError != "" && s.OnError != StepOnErrorFail && s.OnError != StepOnErrorContinue {
+		errs = append(errs, fmt.Errorf("invalid onError %q, must be %s or %s", s.OnError, StepOnErrorFail, StepOnErrorContinue))
+	}
+	if s.Reduce.Name != "" && s.ForEach == nil && s.While == "" {
+		errs = append(errs, fmt.Errorf("reduce requires forEach or while"))
+	}
 	for i, step := range s.Steps {
 		if err := step.validate(c); err != nil {
 			errs = append(errs, fmt.Errorf("error validating nested step %d: %w", i, err))
 		}
 	}
+	for i, step := range s.Else {
+		if err := step.validate(c); err != nil {
+			errs = append(errs, fmt.Errorf("error validating else step %d: %w", i, err))
+		}
+	}
 	return errors.Join(errs...)
 }
 
 type AgentCall struct {
-	Name              string        `json:"name,omitempty"`
-	Output            *OutputSchema `json:"output,omitempty"`
-	Chat              *bool         `json:"chat,omitempty"`
-	ToolChoice        string        `json:"toolChoice,omitempty"`
-	Temperature       *json.Number  `json:"temperature,omitempty"`
-	TopP              *json.Number  `json:"topP,omitempty"`
-	NewThread         *bool         `json:"newThread,omitempty"`
-	InputAsToolResult *bool         `json:"inputAsToolResult,omitempty"`
+	Name              string          `json:"name,omitempty"`
+	Output            *OutputSchema   `json:"output,omitempty"`
+	Chat              *bool           `json:"chat,omitempty"`
+	ToolChoice        string          `json:"toolChoice,omitempty"`
+	Temperature       *json.Number    `json:"temperature,omitempty"`
+	TopP              *json.Number    `json:"topP,omitempty"`
+	NewThread         *bool           `json:"newThread,omitempty"`
+	InputAsToolResult *bool           `json:"inputAsToolResult,omitempty"`
+	Model             string          `json:"model,omitempty"`
+	MaxTokens         int             `json:"maxTokens,omitempty"`
+	Stop              []string        `json:"stop,omitempty"`
+	FrequencyPenalty  *json.Number    `json:"frequencyPenalty,omitempty"`
+	PresencePenalty   *json.Number    `json:"presencePenalty,omitempty"`
+	Seed              *int            `json:"seed,omitempty"`
+	Reasoning         *AgentReasoning `json:"reasoning,omitempty"`
 	// NOTE: DON'T ADD A NEW FIELD HERE WITHOUT UPDATING MarshalJSON/UnmarshalJSON/Merge
 }
 
@@ -262,11 +776,23 @@ func (a AgentCall) Merge(other AgentCall) (result AgentCall) {
 	result.TopP = complete.Last(a.TopP, other.TopP)
 	result.NewThread = complete.Last(a.NewThread, other.NewThread)
 	result.InputAsToolResult = complete.Last(a.InputAsToolResult, other.InputAsToolResult)
+	result.Model = complete.Last(a.Model, other.Model)
+	result.MaxTokens = complete.Last(a.MaxTokens, other.MaxTokens)
+	result.Stop = a.Stop
+	if other.Stop != nil {
+		result.Stop = other.Stop
+	}
+	result.FrequencyPenalty = complete.Last(a.FrequencyPenalty, other.FrequencyPenalty)
+	result.PresencePenalty = complete.Last(a.PresencePenalty, other.PresencePenalty)
+	result.Seed = complete.Last(a.Seed, other.Seed)
+	result.Reasoning = complete.Last(a.Reasoning, other.Reasoning)
 	return
 }
 
 func (a AgentCall) MarshalJSON() ([]byte, error) {
-	if a.Output == nil && a.Chat == nil && a.ToolChoice == "" && a.Temperature == nil && a.TopP == nil && a.NewThread == nil {
+	if a.Output == nil && a.Chat == nil && a.ToolChoice == "" && a.Temperature == nil && a.TopP == nil && a.NewThread == nil &&
+		a.Model == "" && a.MaxTokens == 0 && a.Stop == nil && a.FrequencyPenalty == nil && a.PresencePenalty == nil &&
+		a.Seed == nil && a.Reasoning == nil {
 		return json.Marshal(a.Name)
 	}
 	type Alias AgentCall
@@ -291,7 +817,7 @@ type Publish struct {
 	Introduction      DynamicInstructions `json:"introduction,omitempty"`
 	Version           string              `json:"version,omitempty"`
 	Instructions      string              `json:"instructions,omitempty"`
-	Tools             StringList          `json:"tools,omitzero"`
+	Tools             ToolList            `json:"tools,omitzero"`
 	Prompts           StringList          `json:"prompts,omitzero"`
 	Resources         StringList          `json:"resources,omitzero"`
 	ResourceTemplates StringList          `json:"resourceTemplates,omitzero"`
@@ -445,33 +971,118 @@ func (s *StringList) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// ToolList is a list of tool references. Besides the forms of a StringList it can be a map of tool names
+// to the server they come from and the name they are published as, which is useful to resolve tools with
+// the same name on different servers:
+//
+//	tools:
+//	  fetch: {server: web, as: web_fetch}
+type ToolList []string
+
+type ToolAlias struct {
+	Server string `json:"server"`
+	As     string `json:"as,omitempty"`
+}
+
+func (t *ToolList) UnmarshalJSON(data []byte) error {
+	if data[0] != '{' {
+		return (*StringList)(t).UnmarshalJSON(data)
+	}
+
+	var aliases map[string]ToolAlias
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return err
+	}
+
+	list := make([]string, 0, len(aliases))
+	for _, tool := range slices.Sorted(maps.Keys(aliases)) {
+		alias := aliases[tool]
+		if alias.Server == "" {
+			return fmt.Errorf("tool %q is missing the server it comes from", tool)
+		}
+		ref := alias.Server + "/" + tool
+		if alias.As != "" {
+			ref += ":" + alias.As
+		}
+		list = append(list, ref)
+	}
+	*t = list
+	return nil
+}
+
 type Agent struct {
-	Name            string                    `json:"name,omitempty"`
-	ShortName       string                    `json:"shortName,omitempty"`
-	Description     string                    `json:"description,omitempty"`
-	Icon            string                    `json:"icon,omitempty"`
-	IconDark        string                    `json:"iconDark,omitempty"`
-	StarterMessages StringList                `json:"starterMessages,omitempty"`
-	Instructions    DynamicInstructions       `json:"instructions,omitempty"`
-	Model           string                    `json:"model,omitempty"`
-	Before          StringList                `json:"before,omitempty"`
-	After           StringList                `json:"after,omitempty"`
-	MCPServers      StringList                `json:"mcpServers,omitempty"`
-	Tools           StringList                `json:"tools,omitempty"`
-	Agents          StringList                `json:"agents,omitempty"`
-	Flows           StringList                `json:"flows,omitempty"`
-	Prompts         StringList                `json:"prompts,omitzero"`
-	Reasoning       *AgentReasoning           `json:"reasoning,omitempty"`
-	ThreadName      string                    `json:"threadName,omitempty"`
-	Chat            *bool                     `json:"chat,omitempty"`
-	ToolExtensions  map[string]map[string]any `json:"toolExtensions,omitempty"`
-	ToolChoice      string                    `json:"toolChoice,omitempty"`
-	Temperature     *json.Number              `json:"temperature,omitempty"`
-	TopP            *json.Number              `json:"topP,omitempty"`
-	Output          *OutputSchema             `json:"output,omitempty"`
-	Truncation      string                    `json:"truncation,omitempty"`
-	MaxTokens       int                       `json:"maxTokens,omitempty"`
-	MimeTypes       []string                  `json:"mimeTypes,omitempty"`
+	Name             string                    `json:"name,omitempty"`
+	ShortName        string                    `json:"shortName,omitempty"`
+	Description      string                    `json:"description,omitempty"`
+	Icon             string                    `json:"icon,omitempty"`
+	IconDark         string                    `json:"iconDark,omitempty"`
+	StarterMessages  StringList                `json:"starterMessages,omitempty"`
+	Instructions     DynamicInstructions       `json:"instructions,omitzero"`
+	Model            ModelList                 `json:"model,omitempty"`
+	BaseURL          string                    `json:"baseURL,omitempty"`
+	Before           StringList                `json:"before,omitempty"`
+	After            StringList                `json:"after,omitempty"`
+	MCPServers       StringList                `json:"mcpServers,omitempty"`
+	Tools            ToolList                  `json:"tools,omitempty"`
+	Agents           StringList                `json:"agents,omitempty"`
+	Flows            StringList                `json:"flows,omitempty"`
+	Prompts          StringList                `json:"prompts,omitzero"`
+	Reasoning        *AgentReasoning           `json:"reasoning,omitempty"`
+	ThreadName       string                    `json:"threadName,omitempty"`
+	Chat             *bool                     `json:"chat,omitempty"`
+	ToolExtensions   map[string]map[string]any `json:"toolExtensions,omitempty"`
+	ToolChoice       string                    `json:"toolChoice,omitempty"`
+	Temperature      *json.Number              `json:"temperature,omitempty"`
+	TopP             *json.Number              `json:"topP,omitempty"`
+	Output           *OutputSchema             `json:"output,omitempty"`
+	Truncation       string                    `json:"truncation,omitempty"`
+	MaxTokens        int                       `json:"maxTokens,omitempty"`
+	Stop             []string                  `json:"stop,omitempty"`
+	FrequencyPenalty *json.Number              `json:"frequencyPenalty,omitempty"`
+	PresencePenalty  *json.Number              `json:"presencePenalty,omitempty"`
+	Seed             *int                      `json:"seed,omitempty"`
+	MimeTypes        []string                  `json:"mimeTypes,omitempty"`
+	Limits           *Limits                   `json:"limits,omitempty"`
+	Handoff          *Handoff                  `json:"handoff,omitempty"`
+	Compaction       *Compaction               `json:"compaction,omitempty"`
+	Loop             *Loop                     `json:"loop,omitempty"`
+	// ResponseCache is how long completions are cached and returned for identical requests to the agent.
+	ResponseCache string  `json:"responseCache,omitempty"`
+	Memory        *Memory `json:"memory,omitempty"`
+	// Knowledge are documents the agent can search with the search_knowledge tool.
+	Knowledge *Knowledge `json:"knowledge,omitempty"`
+	// Similarity gives the agent the compute_similarity tool.
+	Similarity *Similarity `json:"similarity,omitempty"`
+	// Exec gives the agent the exec tool, which runs code in a sandbox.
+	Exec *Exec `json:"exec,omitempty"`
+	// Web gives the agent the web_fetch and web_search tools.
+	Web *Web `json:"web,omitempty"`
+	// Speech transcribes audio input and synthesizes replies.
+	Speech *Speech `json:"speech,omitempty"`
+	// Middleware runs on every turn of the agent, in order.
+	Middleware []Middleware `json:"middleware,omitempty"`
+	// Guardrails check the input of the user and the output of the model.
+	Guardrails *Guardrails `json:"guardrails,omitempty"`
+	// Untrusted labels and sanitizes the content of tool results, and requires approval of sensitive
+	// tools after the agent read it.
+	Untrusted *Untrusted `json:"untrusted,omitempty"`
+	// Roots are the names of the roots the MCP servers of the agent can list. Servers shared by
+	// agents can list the roots of all of them, or all roots if one of them does not set roots.
+	Roots StringList `json:"roots,omitempty"`
+	// TurnTimeout is how long a turn of the agent, with all of its completions and tool calls, may
+	// run. The turn ends with what it produced so far.
+	TurnTimeout string `json:"turnTimeout,omitempty"`
+	// Provider is the name of the entry in providers that completes the requests of the agent, instead
+	// of the provider picked by the name of the model.
+	Provider string `json:"provider,omitempty"`
+	// SafetySettings maps Gemini harm categories, like HARM_CATEGORY_HARASSMENT, to the threshold at
+	// which content is blocked, like BLOCK_ONLY_HIGH.
+	SafetySettings map[string]string `json:"safetySettings,omitempty"`
+	// WireLog records the full requests and responses of the completions of the agent in the wire log.
+	WireLog bool `json:"wireLog,omitempty"`
+	// Checkpoint stores the state of turns in progress after each completion and tool call, so that a
+	// turn interrupted by a crash or restart can be resumed.
+	Checkpoint bool `json:"checkpoint,omitempty"`
 
 	// Selection criteria fields
 
@@ -484,6 +1095,13 @@ type Agent struct {
 type AgentReasoning struct {
 	Effort  string `json:"effort,omitempty"`
 	Summary string `json:"summary,omitempty"`
+	// Expose streams the reasoning of the model to the client while it is generated.
+	Expose *bool `json:"expose,omitempty"`
+}
+
+// Exposed returns true if the reasoning is streamed to the client.
+func (a *AgentReasoning) Exposed() bool {
+	return a != nil && a.Expose != nil && *a.Expose
 }
 
 func (a Agent) ToDisplay() AgentDisplay {
@@ -506,7 +1124,7 @@ func validateReference[T any](ref string, targetType string, targets map[string]
 
 	toolRef := ParseToolRef(ref)
 	if _, ok := targets[toolRef.Server]; !ok {
-		return "", fmt.Errorf("can not find %s %q, missing in config", targetType, ref)
+		return "", fmt.Errorf("can not find %s %q, missing in config%s", targetType, ref, didYouMean(toolRef.Server, targets))
 	}
 
 	if targetType == mcpServerName {
@@ -516,14 +1134,44 @@ func validateReference[T any](ref string, targetType string, targets map[string]
 	return toolRef.PublishedName(toolRef.Server), nil
 }
 
-func validateReferences(c Config, tools, agents, flows StringList) (bool, map[string]struct{}, []error) {
+// validateReferences validates the references and returns the tool names they publish, mapped to the
+// reference. Names of tools that are only known once the MCP server runs are not included, unknownNames
+// is true if there are any.
+func validateReferences(c Config, tools, agents, flows []string) (bool, map[string]string, []error) {
 	var (
 		errs              []error
 		unknownNames      bool
-		resolvedToolNames = make(map[string]struct{})
+		resolvedToolNames = make(map[string]string)
 	)
 
+	resolve := func(name, ref string) {
+		if name == "" {
+			return
+		}
+		if other, ok := resolvedToolNames[name]; ok && other != ref {
+			errs = append(errs, fmt.Errorf("tool name %q is published by both %q and %q, use \"as\" to rename one of them", name, other, ref))
+			return
+		}
+		resolvedToolNames[name] = ref
+	}
+
 	for _, ref := range tools {
+		if _, ok := c.Tools[ParseToolRef(ref).Server]; ok {
+			targetName, err := validateReference(ref, "tool", c.Tools)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error validating tool reference %q: %w", ref, err))
+			}
+			resolve(targetName, ref)
+			continue
+		}
+		if _, ok := c.A2A[ParseToolRef(ref).Server]; ok {
+			targetName, err := validateReference(ref, "a2a agent", c.A2A)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error validating tool reference %q: %w", ref, err))
+			}
+			resolve(targetName, ref)
+			continue
+		}
 		targetName, err := validateReference(ref, mcpServerName, c.MCPServers)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("error validating tool reference %q: %w", ref, err))
@@ -531,7 +1179,7 @@ func validateReferences(c Config, tools, agents, flows StringList) (bool, map[st
 		if targetName == "" {
 			unknownNames = true
 		} else {
-			resolvedToolNames[targetName] = struct{}{}
+			resolve(targetName, ref)
 		}
 	}
 
@@ -540,7 +1188,7 @@ func validateReferences(c Config, tools, agents, flows StringList) (bool, map[st
 		if err != nil {
 			errs = append(errs, fmt.Errorf("error validating agent reference %q: %w", ref, err))
 		}
-		resolvedToolNames[targetName] = struct{}{}
+		resolve(targetName, ref)
 	}
 
 	for _, ref := range flows {
@@ -548,7 +1196,7 @@ func validateReferences(c Config, tools, agents, flows StringList) (bool, map[st
 		if err != nil {
 			errs = append(errs, fmt.Errorf("error validating flow reference %q: %w", ref, err))
 		}
-		resolvedToolNames[targetName] = struct{}{}
+		resolve(targetName, ref)
 	}
 
 	return unknownNames, resolvedToolNames, errs
@@ -561,16 +1209,84 @@ func (a Agent) validate(agentName string, c Config) error {
 		errs = append(errs, fmt.Errorf("agent can not be named \"chat\""))
 	}
 
+	if err := a.Limits.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("agent %q has invalid limits: %w", agentName, err))
+	}
+
+	if err := a.Compaction.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("agent %q has invalid compaction: %w", agentName, err))
+	}
+	if err := a.Loop.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("agent %q has invalid loop: %w", agentName, err))
+	}
+
+	if err := a.Handoff.validate(agentName, c); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := a.Memory.validate(agentName, c); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := a.Knowledge.validate(agentName, c); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := a.Exec.validate(agentName); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := a.Web.validate(agentName); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := a.Speech.validate(agentName); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateMiddleware(a.Middleware); err != nil {
+		errs = append(errs, fmt.Errorf("agent %q has invalid middleware: %w", agentName, err))
+	}
+
+	if err := a.Guardrails.validate(agentName); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := a.Untrusted.validate(agentName); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateTimeout(fmt.Sprintf("agent %q", agentName), a.TurnTimeout); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, ok := c.Providers[a.Provider]; a.Provider != "" && !ok {
+		errs = append(errs, fmt.Errorf("agent %q has unknown provider %q", agentName, a.Provider))
+	}
+
+	if a.ResponseCache != "" {
+		if _, err := time.ParseDuration(a.ResponseCache); err != nil {
+			errs = append(errs, fmt.Errorf("agent %q has invalid responseCache TTL %q: %w", agentName, a.ResponseCache, err))
+		}
+	}
+
+	if err := a.Instructions.validate(fmt.Sprintf("agent %q", agentName)); err != nil {
+		errs = append(errs, err)
+	}
 	if a.Instructions.IsSet() && a.Instructions.IsPrompt() {
 		_, ok := c.MCPServers[a.Instructions.MCPServer]
 		if !ok {
-			errs = append(errs, fmt.Errorf("agent %q has instructions with MCP server %q that is not defined in config", agentName, a.Instructions.MCPServer))
+			errs = append(errs, fmt.Errorf("agent %q has instructions with MCP server %q that is not defined in config%s", agentName, a.Instructions.MCPServer, didYouMean(a.Instructions.MCPServer, c.MCPServers)))
+		}
+	} else if tmpl.IsTemplate(a.Instructions.Instructions) {
+		if _, err := tmpl.Parse("instructions", a.Instructions.Instructions, c.Partials, tmpl.Funcs{}); err != nil {
+			errs = append(errs, fmt.Errorf("agent %q has invalid instructions: %w", agentName, err))
 		}
 	}
 
 	for _, mcpServer := range a.MCPServers {
 		if _, ok := c.MCPServers[mcpServer]; !ok {
-			errs = append(errs, fmt.Errorf("agent %q has MCP server %q that is not defined in config", agentName, mcpServer))
+			errs = append(errs, fmt.Errorf("agent %q has MCP server %q that is not defined in config%s", agentName, mcpServer, didYouMean(mcpServer, c.MCPServers)))
 		}
 	}
 
@@ -588,14 +1304,59 @@ type DynamicInstructions struct {
 	MCPServer    string            `json:"mcpServer"`
 	Prompt       string            `json:"prompt"`
 	Args         map[string]string `json:"args"`
+	// MCP is the prompt as server/prompt, a shorter form of mcpServer and prompt.
+	MCP string `json:"mcp,omitempty"`
+	// URL is fetched once per session for the instructions, with Headers added to the request.
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Refresh is how long a fetched URL is reused by new sessions, defaults to 5m.
+	Refresh string `json:"refresh,omitempty"`
+	// Fallback are the instructions used when the prompt or URL can not be fetched and there is no
+	// earlier result to use.
+	Fallback string `json:"fallback,omitempty"`
 }
 
 func (a DynamicInstructions) IsPrompt() bool {
 	return a.MCPServer != "" && a.Prompt != ""
 }
 
+func (a DynamicInstructions) IsURL() bool {
+	return a.URL != ""
+}
+
 func (a DynamicInstructions) IsSet() bool {
-	return a.IsPrompt() || a.Instructions != ""
+	return a.IsPrompt() || a.IsURL() || a.Instructions != ""
+}
+
+// GetRefresh returns how long a fetched URL is reused by new sessions.
+func (a DynamicInstructions) GetRefresh() time.Duration {
+	return parseDurationOr(a.Refresh, 5*time.Minute)
+}
+
+func (a DynamicInstructions) validate(owner string) error {
+	if a.MCP != "" && !a.IsPrompt() {
+		return fmt.Errorf("%s has instructions with invalid mcp %q: must be server/prompt", owner, a.MCP)
+	}
+	if a.IsURL() {
+		if a.IsPrompt() {
+			return fmt.Errorf("%s has instructions with both a url and a prompt", owner)
+		}
+		if u, err := url.Parse(a.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s has instructions with invalid url %q: must be an http or https URL", owner, a.URL)
+		}
+	}
+	if a.Refresh != "" {
+		if _, err := time.ParseDuration(a.Refresh); err != nil {
+			return fmt.Errorf("%s has instructions with invalid refresh %q: %w", owner, a.Refresh, err)
+		}
+	}
+	return nil
+}
+
+// IsZero is true for unset instructions, so that they are left out of the JSON of an agent and do
+// not replace the instructions of the config a profile or include is merged onto.
+func (a DynamicInstructions) IsZero() bool {
+	return !a.IsSet() && len(a.Args) == 0
 }
 
 func (a *DynamicInstructions) UnmarshalJSON(data []byte) error {
@@ -608,7 +1369,13 @@ func (a *DynamicInstructions) UnmarshalJSON(data []byte) error {
 		return nil
 	}
 	type Alias DynamicInstructions
-	return json.Unmarshal(data, (*Alias)(a))
+	if err := json.Unmarshal(data, (*Alias)(a)); err != nil {
+		return err
+	}
+	if server, prompt, ok := strings.Cut(a.MCP, "/"); ok && a.MCPServer == "" && a.Prompt == "" {
+		a.MCPServer, a.Prompt = server, prompt
+	}
+	return nil
 }
 
 func (a DynamicInstructions) MarshalJSON() ([]byte, error) {
@@ -625,6 +1392,8 @@ type OutputSchema struct {
 	Schema      json.RawMessage  `json:"schema,omitzero"`
 	Strict      bool             `json:"strict,omitempty"`
 	Fields      map[string]Field `json:"fields,omitempty"`
+	// MaxRetries is how often the LLM is asked again when the output does not match the schema, defaults to 2.
+	MaxRetries int `json:"maxRetries,omitempty"`
 }
 
 type Field struct {
@@ -663,6 +1432,24 @@ func (o OutputSchema) ToSchema() json.RawMessage {
 	return o.Schema
 }
 
+// OutputValidationError is returned from a completion when the output of the LLM still does not match
+// the output schema after all retries.
+type OutputValidationError struct {
+	Agent    string
+	Attempts int
+	// Output is the last output of the LLM
+	Output string
+	Err    error
+}
+
+func (e *OutputValidationError) Error() string {
+	return fmt.Sprintf("output of agent %q does not match the output schema after %d attempts: %v", e.Agent, e.Attempts, e.Err)
+}
+
+func (e *OutputValidationError) Unwrap() error {
+	return e.Err
+}
+
 type InputSchema struct {
 	Name        string           `json:"name,omitempty"`
 	Description string           `json:"description,omitempty"`
@@ -2,6 +2,10 @@ package types
 
 import (
 	"context"
+	"maps"
+	"path"
+	"slices"
+	"strings"
 
 	"github.com/obot-platform/mcp-oauth-proxy/pkg/providers"
 )
@@ -10,10 +14,88 @@ type Context struct {
 	User    User
 	Config  ConfigFactory
 	Profile []string
+	// AllowedAgents are the agents the caller may use, nil allows all agents.
+	AllowedAgents []string
+	// AllowedTools are the tool patterns the caller may use, nil allows all tools. See Role.
+	AllowedTools []string
+	// DryRun returns the tool calls the model plans to make instead of running them.
+	DryRun bool
+	// Admin is true if the user is one of the admins of the auth config.
+	Admin bool
+	// Auth is true if the server authenticates its callers, callers without a user are then anonymous.
+	Auth bool
+	// SkipResponseCache makes the completions of the request bypass the response cache of the agents, so
+	// that a regenerated response is not the cached one.
+	SkipResponseCache bool
+}
+
+// AccountID returns the account whose sessions the caller may read, an empty account is all of them. All
+// callers of a server without auth, and admins that ask for all, read all sessions. ok is false for
+// anonymous callers of a server with auth, which may not read any.
+func (c Context) AccountID(all bool) (_ string, ok bool) {
+	switch {
+	case c.Admin && all:
+		return "", true
+	case !c.Auth:
+		return c.User.ID, true
+	case c.User.ID == "":
+		return "", false
+	default:
+		return c.User.ID, true
+	}
+}
+
+// DryRunHeader is the request header that enables DryRun for the request when set to true.
+const DryRunHeader = "X-Nanobot-Dry-Run"
+
+// AgentAllowed returns true if the caller may use the agent, or the MCP server, with the given name.
+func (c Context) AgentAllowed(name string) bool {
+	return c.AllowedAgents == nil || slices.Contains(c.AllowedAgents, name)
+}
+
+// AllowedEntrypoints returns the entrypoints of the config the caller may use. All agents, sorted by
+// name, are entrypoints if the config publishes none.
+func (c Context) AllowedEntrypoints(config Config) []string {
+	entrypoints := config.Publish.Entrypoint
+	if len(entrypoints) == 0 {
+		entrypoints = slices.Sorted(maps.Keys(config.Agents))
+	}
+	var agents []string
+	for _, agent := range entrypoints {
+		if c.AgentAllowed(agent) {
+			agents = append(agents, agent)
+		}
+	}
+	return agents
+}
+
+// ToolAllowed returns true if the caller may use the tool published as name that calls the tool target
+// of the MCP server or agent.
+func (c Context) ToolAllowed(name, server, target string) bool {
+	if c.AllowedTools == nil {
+		return c.AgentAllowed(server)
+	}
+	if slices.Contains(c.AllowedAgents, server) {
+		return true
+	}
+	for _, pattern := range c.AllowedTools {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, server+"/"+target); ok {
+			return true
+		}
+	}
+	return false
 }
 
 type User providers.UserInfo
 
+// HasEmail returns true if the email of the user is verified and matches the email, ignoring case.
+func (u User) HasEmail(email string) bool {
+	return u.Email != "" && u.EmailVerified && strings.EqualFold(u.Email, email)
+}
+
 type contextKey struct{}
 
 func WithNanobotContext(ctx context.Context, nc Context) context.Context {
@@ -0,0 +1,52 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ElicitationConfig is how elicitation requests are answered without a user. Requests no answer
+// matches are declined.
+type ElicitationConfig struct {
+	// Answers are tried in order, the first that matches a request answers it.
+	Answers []ElicitAnswer `json:"answers,omitempty"`
+	// Default is the action for requests no answer matches, decline or cancel. Defaults to decline.
+	Default string `json:"default,omitempty"`
+}
+
+type ElicitAnswer struct {
+	// Server is the MCP server that asks, empty matches all servers.
+	Server string `json:"server,omitempty"`
+	// Tool matches the confirmations of calls of the tool, empty matches all requests.
+	Tool string `json:"tool,omitempty"`
+	// Message is a regular expression matched against the message of the request.
+	Message string `json:"message,omitempty"`
+	// Action is accept, decline or cancel. Defaults to accept.
+	Action string `json:"action,omitempty"`
+	// Content are the values of the fields of the requested schema.
+	Content map[string]any `json:"content,omitempty"`
+}
+
+func (e *ElicitationConfig) validate() error {
+	if e == nil {
+		return nil
+	}
+	switch e.Default {
+	case "", "decline", "cancel":
+	default:
+		return fmt.Errorf("elicitation has invalid default %q: must be decline or cancel", e.Default)
+	}
+	for i, answer := range e.Answers {
+		switch answer.Action {
+		case "", "accept", "decline", "cancel":
+		default:
+			return fmt.Errorf("elicitation answer %d has invalid action %q: must be accept, decline or cancel", i+1, answer.Action)
+		}
+		if answer.Message != "" {
+			if _, err := regexp.Compile(answer.Message); err != nil {
+				return fmt.Errorf("elicitation answer %d has invalid message pattern %q: %w", i+1, answer.Message, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+)
+
+const (
+	ErrorTypeProvider       = "provider_error"
+	ErrorTypeTool           = "tool_error"
+	ErrorTypeConfig         = "config_error"
+	ErrorTypeBudgetExceeded = "budget_exceeded"
+	ErrorTypeTimeout        = "timeout"
+	ErrorTypeCancelled      = "cancelled"
+	ErrorTypeInternal       = "internal_error"
+)
+
+// ErrorData is the machine readable form of an error. Clients get it as the data of MCP errors and as
+// the error of HTTP API responses, so they can decide what to do without parsing the message.
+type ErrorData struct {
+	// Type is one of provider_error, tool_error, config_error, budget_exceeded, timeout, cancelled, or
+	// internal_error.
+	Type string `json:"type"`
+	// Code is the specific failure within the type, e.g. rate_limited or tokensPerDay.
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	// Retryable is true if the same request may succeed when it is sent again.
+	Retryable bool `json:"retryable"`
+	// RetryAfterSeconds is how long to wait before retrying, if known.
+	RetryAfterSeconds float64 `json:"retryAfterSeconds,omitempty"`
+}
+
+// StatusCode is the HTTP status of responses that fail with the error.
+func (e ErrorData) StatusCode() int {
+	switch e.Type {
+	case ErrorTypeBudgetExceeded:
+		return http.StatusTooManyRequests
+	case ErrorTypeProvider, ErrorTypeTool:
+		if e.Code == "rate_limited" {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusBadGateway
+	case ErrorTypeConfig:
+		return http.StatusBadRequest
+	case ErrorTypeTimeout:
+		return http.StatusGatewayTimeout
+	case ErrorTypeCancelled:
+		// The status nginx uses for requests the client closed
+		return 499
+	}
+	return http.StatusInternalServerError
+}
+
+// TypedError is implemented by the errors that know their ErrorData.
+type TypedError interface {
+	error
+	ErrorData() ErrorData
+}
+
+// GetErrorData returns the ErrorData of the first TypedError wrapped by err. Errors without a type are
+// internal errors, unless they are the error of a canceled or expired context. The message is always
+// the message of err.
+func GetErrorData(err error) ErrorData {
+	var (
+		data     ErrorData
+		typed    TypedError
+		rpcError *mcp.RPCError
+	)
+	switch {
+	case errors.As(err, &typed):
+		data = typed.ErrorData()
+	case errors.As(err, &rpcError) && remoteErrorData(rpcError, &data):
+	case errors.Is(err, context.DeadlineExceeded):
+		data = ErrorData{Type: ErrorTypeTimeout, Code: "deadline_exceeded", Retryable: true}
+	case errors.Is(err, context.Canceled), errors.Is(err, mcp.ErrRequestCancelled):
+		data = ErrorData{Type: ErrorTypeCancelled}
+	default:
+		data = ErrorData{Type: ErrorTypeInternal}
+	}
+	data.Message = err.Error()
+	return data
+}
+
+// remoteErrorData reads the ErrorData in the data of an MCP error, as sent by another nanobot or by
+// an in process MCP server.
+func remoteErrorData(rpcError *mcp.RPCError, data *ErrorData) bool {
+	if typed, ok := rpcError.DataObject.(ErrorData); ok {
+		*data = typed
+		return true
+	}
+	if len(rpcError.Data) == 0 || json.Unmarshal(rpcError.Data, data) != nil {
+		return false
+	}
+	return data.Type != ""
+}
+
+// NewRPCError returns the MCP error that is sent to clients for err, with its ErrorData as the data.
+// Protocol errors, like unknown methods, and errors of other MCP servers without ErrorData are
+// returned unchanged.
+func NewRPCError(err error) *mcp.RPCError {
+	var (
+		typed    TypedError
+		rpcError mcp.JSONRPCError
+		data     ErrorData
+	)
+	if !errors.As(err, &typed) && errors.As(err, &rpcError) {
+		result := rpcError.RPCError()
+		if !remoteErrorData(result, &data) {
+			return result
+		}
+	}
+
+	data = GetErrorData(err)
+	result := mcp.ErrRPCInternal.WithMessage("%v", err)
+	if data.Type == ErrorTypeConfig {
+		result = mcp.ErrRPCInvalidParams.WithMessage("%v", err)
+	}
+	result.DataObject = data
+	return result.RPCError()
+}
+
+// ToolError is returned when a tool call fails. The message is the message of the wrapped error.
+type ToolError struct {
+	Server string
+	Tool   string
+	Err    error
+}
+
+func (e *ToolError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ToolError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ToolError) ErrorData() ErrorData {
+	var typed TypedError
+	if errors.As(e.Err, &typed) {
+		return typed.ErrorData()
+	}
+	var data ErrorData
+	if rpcError := (*mcp.RPCError)(nil); errors.As(e.Err, &rpcError) && remoteErrorData(rpcError, &data) {
+		return data
+	}
+	if errors.Is(e.Err, context.DeadlineExceeded) || errors.Is(e.Err, context.Canceled) {
+		return GetErrorData(e.Err)
+	}
+	return ErrorData{
+		Type: ErrorTypeTool,
+		Code: "call_failed",
+	}
+}
+
+// ArgumentsError is the result of a tool call with arguments that do not match the input schema of the
+// tool. The tool is not called, the LLM gets the error so it can call it again with valid arguments.
+type ArgumentsError struct {
+	Tool   string          `json:"tool"`
+	Errors []ArgumentError `json:"errors"`
+}
+
+// ArgumentError is one argument that does not match the schema, Path is a JSON pointer to it.
+type ArgumentError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e *ArgumentsError) Error() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "invalid arguments for tool %s:", e.Tool)
+	for _, argErr := range e.Errors {
+		path := argErr.Path
+		if path == "" {
+			path = "/"
+		}
+		fmt.Fprintf(&buf, "\n- %s: %s", path, argErr.Message)
+	}
+	return buf.String()
+}
+
+func (e *ArgumentsError) ErrorData() ErrorData {
+	return ErrorData{
+		Type: ErrorTypeTool,
+		Code: "invalid_arguments",
+	}
+}
+
+// ProviderError is returned when the LLM provider fails a completion, after all retries and fallback
+// models.
+type ProviderError struct {
+	Provider string
+	Model    string
+	// Code is rate_limited, overloaded, unauthorized, bad_request, server_error, or request_failed.
+	Code       string
+	Retryable  bool
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ProviderError) ErrorData() ErrorData {
+	var typed TypedError
+	if errors.As(e.Err, &typed) {
+		return typed.ErrorData()
+	}
+	return ErrorData{
+		Type:              ErrorTypeProvider,
+		Code:              e.Code,
+		Retryable:         e.Retryable,
+		RetryAfterSeconds: e.RetryAfter.Seconds(),
+	}
+}
+
+func (e *TimeoutError) ErrorData() ErrorData {
+	return ErrorData{
+		Type:      ErrorTypeTimeout,
+		Code:      e.Kind + "_timeout",
+		Retryable: true,
+	}
+}
+
+func (e *LimitExceededError) ErrorData() ErrorData {
+	data := ErrorData{
+		Type: ErrorTypeBudgetExceeded,
+		Code: e.Limit,
+	}
+	if e.Limit == "requestsPerMinute" {
+		data.Retryable = true
+		data.RetryAfterSeconds = time.Minute.Seconds()
+	}
+	return data
+}
+
+func (e *OutputValidationError) ErrorData() ErrorData {
+	return ErrorData{
+		Type:      ErrorTypeProvider,
+		Code:      "invalid_output",
+		Retryable: true,
+	}
+}
+
+// ConfigError is returned when the config of nanobot is invalid.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConfigError) ErrorData() ErrorData {
+	return ErrorData{
+		Type: ErrorTypeConfig,
+		Code: "invalid_config",
+	}
+}
+
+// The typed errors are also JSON-RPC errors, so that MCP servers send their ErrorData to clients.
+
+func (e *ToolError) RPCError() *mcp.RPCError {
+	return NewRPCError(e)
+}
+
+func (e *ProviderError) RPCError() *mcp.RPCError {
+	return NewRPCError(e)
+}
+
+func (e *TimeoutError) RPCError() *mcp.RPCError {
+	return NewRPCError(e)
+}
+
+func (e *LimitExceededError) RPCError() *mcp.RPCError {
+	return NewRPCError(e)
+}
+
+func (e *OutputValidationError) RPCError() *mcp.RPCError {
+	return NewRPCError(e)
+}
+
+func (e *ConfigError) RPCError() *mcp.RPCError {
+	return NewRPCError(e)
+}
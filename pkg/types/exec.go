@@ -0,0 +1,118 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	defaultExecTimeout   = 60 * time.Second
+	defaultExecMaxMemory = 512 * 1024 * 1024
+)
+
+// The languages of the exec tool.
+const (
+	ExecPython = "python"
+	ExecNode   = "node"
+	ExecShell  = "shell"
+)
+
+// The sandboxes of the exec tool.
+const (
+	ExecSandboxDocker  = "docker"
+	ExecSandboxProcess = "process"
+)
+
+// DefaultExecImages are the images the docker sandbox runs the languages in.
+var DefaultExecImages = map[string]string{
+	ExecPython: "python:3.13-slim",
+	ExecNode:   "node:22-slim",
+	ExecShell:  "debian:bookworm-slim",
+}
+
+// Exec gives an agent the exec tool, which runs code in a sandbox with the working directory of the
+// session as its scratch directory.
+type Exec struct {
+	// Languages the agent can run code in, defaults to python, node, and shell.
+	Languages []string `json:"languages,omitempty"`
+	// Sandbox is docker (default), which runs the code in a container, or process, which runs it in a
+	// subprocess restricted with landlock and seccomp. The process sandbox is only supported on Linux.
+	Sandbox string `json:"sandbox,omitempty"`
+	// Images replace the default images of the languages in the docker sandbox.
+	Images map[string]string `json:"images,omitempty"`
+	// Timeout defaults to 60s.
+	Timeout string `json:"timeout,omitempty"`
+	// MaxMemory is the memory limit of the code, for example "256MB". Defaults to 512MiB.
+	MaxMemory string `json:"maxMemory,omitempty"`
+	// Network lets the code connect to the network, it has no network by default.
+	Network bool `json:"network,omitempty"`
+}
+
+func (e Exec) GetLanguages() []string {
+	if len(e.Languages) == 0 {
+		return []string{ExecPython, ExecNode, ExecShell}
+	}
+	return e.Languages
+}
+
+func (e Exec) GetSandbox() string {
+	if e.Sandbox == "" {
+		return ExecSandboxDocker
+	}
+	return e.Sandbox
+}
+
+func (e Exec) GetImage(language string) string {
+	if image := e.Images[language]; image != "" {
+		return image
+	}
+	return DefaultExecImages[language]
+}
+
+func (e Exec) GetTimeout() time.Duration {
+	return parseDurationOr(e.Timeout, defaultExecTimeout)
+}
+
+func (e Exec) GetMaxMemory() uint64 {
+	if e.MaxMemory == "" {
+		return defaultExecMaxMemory
+	}
+	size, err := humanize.ParseBytes(e.MaxMemory)
+	if err != nil || size == 0 {
+		return defaultExecMaxMemory
+	}
+	return size
+}
+
+func (e *Exec) validate(agentName string) error {
+	if e == nil {
+		return nil
+	}
+	for _, language := range e.Languages {
+		if _, ok := DefaultExecImages[language]; !ok {
+			return fmt.Errorf("agent %q has invalid exec language %q, must be python, node, or shell", agentName, language)
+		}
+	}
+	for language := range e.Images {
+		if !slices.Contains(e.GetLanguages(), language) {
+			return fmt.Errorf("agent %q has an exec image for language %q it does not run", agentName, language)
+		}
+	}
+	if e.Sandbox != "" && e.Sandbox != ExecSandboxDocker && e.Sandbox != ExecSandboxProcess {
+		return fmt.Errorf("agent %q has invalid exec sandbox %q, must be docker or process", agentName, e.Sandbox)
+	}
+	if e.Timeout != "" {
+		if _, err := time.ParseDuration(e.Timeout); err != nil {
+			return fmt.Errorf("agent %q has invalid exec timeout %q: %w", agentName, e.Timeout, err)
+		}
+	}
+	if e.MaxMemory != "" {
+		if _, err := humanize.ParseBytes(e.MaxMemory); err != nil {
+			return fmt.Errorf("agent %q has invalid exec maxMemory %q: %w", agentName, e.MaxMemory, err)
+		}
+	}
+	return nil
+}
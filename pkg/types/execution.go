@@ -1,8 +1,16 @@
 package types
 
-import "github.com/nanobot-ai/nanobot/pkg/mcp"
+import (
+	"time"
 
-const PreviousExecutionKey = "thread"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+)
+
+const (
+	PreviousExecutionKey = "thread"
+	// CheckpointKey is the session key of the checkpoint of the turn in progress in the thread.
+	CheckpointKey = "checkpoint"
+)
 
 type Execution struct {
 	Request          CompletionRequest     `json:"request,omitempty"`
@@ -25,3 +33,24 @@ type ToolOutput struct {
 	Output Message `json:"output,omitempty"`
 	Done   bool    `json:"done,omitempty"`
 }
+
+// Checkpoint is the state of a turn in progress, stored after each completion and tool call so that a
+// turn interrupted by a crash or restart can be resumed from the last completed step.
+type Checkpoint struct {
+	StartID string            `json:"startID,omitempty"`
+	Request CompletionRequest `json:"request,omitempty"`
+	// Fallback is the thread before the turn, it is restored if the resumed turn fails.
+	Fallback   *Execution `json:"fallback,omitempty"`
+	Previous   *Execution `json:"previous,omitempty"`
+	Run        *Execution `json:"run,omitempty"`
+	AudioInput bool       `json:"audioInput,omitempty"`
+	Updated    time.Time  `json:"updated"`
+}
+
+func (c *Checkpoint) Serialize() (any, error) {
+	return c, nil
+}
+
+func (c *Checkpoint) Deserialize(data any) (any, error) {
+	return c, mcp.JSONCoerce(data, c)
+}
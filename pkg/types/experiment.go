@@ -0,0 +1,44 @@
+package types
+
+import "fmt"
+
+// Experiment routes a percentage of the new sessions of an agent to a variant of the agent, for example
+// one with a new prompt or model, so that the variant can be compared with the agent before it replaces
+// it.
+type Experiment struct {
+	Description string `json:"description,omitempty"`
+	// Agent is the agent sessions are routed from, the control of the experiment.
+	Agent string `json:"agent,omitempty"`
+	// Variant is the agent that runs instead of Agent in the sessions that are routed to it.
+	Variant string `json:"variant,omitempty"`
+	// Percent is the percentage, from 0 to 100, of the new sessions that are routed to the variant.
+	// Sessions keep the variant they were assigned when it changes.
+	Percent float64 `json:"percent,omitempty"`
+}
+
+func (e Experiment) validate(name string, c Config) error {
+	if _, ok := c.Agents[e.Agent]; !ok {
+		return fmt.Errorf("experiment %q references undefined agent %q", name, e.Agent)
+	}
+	if _, ok := c.Agents[e.Variant]; !ok {
+		return fmt.Errorf("experiment %q references undefined variant agent %q", name, e.Variant)
+	}
+	if e.Agent == e.Variant {
+		return fmt.Errorf("experiment %q must have a variant that is not its agent", name)
+	}
+	if e.Percent < 0 || e.Percent > 100 {
+		return fmt.Errorf("experiment %q has invalid percent %v, must be between 0 and 100", name, e.Percent)
+	}
+	for other, experiment := range c.Experiments {
+		if other == name {
+			continue
+		}
+		if experiment.Agent == e.Agent && other < name {
+			return fmt.Errorf("experiments %q and %q route the same agent %q", other, name, e.Agent)
+		}
+		if experiment.Agent == e.Variant {
+			return fmt.Errorf("the variant %q of experiment %q is the agent of experiment %q", e.Variant, name, other)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+const (
+	DefaultModerationModel = "omni-moderation-latest"
+
+	GuardrailBlock   = "block"
+	GuardrailFlag    = "flag"
+	GuardrailRewrite = "rewrite"
+)
+
+// Guardrails check the input of the user before it reaches the model and the output of the model before
+// it reaches the user.
+type Guardrails struct {
+	Input  []Guardrail `json:"input,omitempty"`
+	Output []Guardrail `json:"output,omitempty"`
+}
+
+// Guardrail is a check with one of keywords, regex, moderation, or judge.
+type Guardrail struct {
+	// Name identifies the guardrail in the decisions, defaults to the kind of check.
+	Name string `json:"name,omitempty"`
+	// Keywords are matched as whole words, ignoring case.
+	Keywords   []string    `json:"keywords,omitempty"`
+	Regex      string      `json:"regex,omitempty"`
+	Moderation *Moderation `json:"moderation,omitempty"`
+	Judge      *Judge      `json:"judge,omitempty"`
+	// Action is block (default), flag, or rewrite.
+	Action string `json:"action,omitempty"`
+	// Message replaces blocked text. Rewritten text is replaced by it too, unless the guardrail matches
+	// keywords or a regex or the judge rewrites the text.
+	Message string `json:"message,omitempty"`
+	// Replacement replaces the matches of keywords and regex when rewriting, defaults to "[removed]".
+	Replacement string `json:"replacement,omitempty"`
+}
+
+func (g Guardrail) GetName() string {
+	switch {
+	case g.Name != "":
+		return g.Name
+	case len(g.Keywords) > 0:
+		return "keywords"
+	case g.Regex != "":
+		return "regex"
+	case g.Moderation != nil:
+		return "moderation"
+	default:
+		return "judge"
+	}
+}
+
+func (g Guardrail) GetAction() string {
+	if g.Action == "" {
+		return GuardrailBlock
+	}
+	return g.Action
+}
+
+func (g Guardrail) GetMessage() string {
+	if g.Message == "" {
+		return "This message was blocked by a guardrail."
+	}
+	return g.Message
+}
+
+func (g Guardrail) GetReplacement() string {
+	if g.Replacement == "" {
+		return "[removed]"
+	}
+	return g.Replacement
+}
+
+// Moderation uses the OpenAI moderation API, or a server with the same API when BaseURL is set.
+type Moderation struct {
+	Model   string `json:"model,omitempty"`
+	BaseURL string `json:"baseURL,omitempty"`
+	APIKey  string `json:"apiKey,omitempty"`
+	// Categories that fail the check, defaults to all.
+	Categories []string `json:"categories,omitempty"`
+	// Threshold is the score a category fails the check at. By default the categories flagged by the API
+	// fail the check.
+	Threshold float64 `json:"threshold,omitempty"`
+}
+
+func (m Moderation) GetModel() string {
+	if m.Model == "" {
+		return DefaultModerationModel
+	}
+	return m.Model
+}
+
+// Judge asks a model if the text violates the rubric.
+type Judge struct {
+	// Model defaults to the model of the agent.
+	Model  string `json:"model,omitempty"`
+	Rubric string `json:"rubric,omitempty"`
+}
+
+func (g *Guardrails) validate(agentName string) error {
+	if g == nil {
+		return nil
+	}
+	for i, guardrail := range g.Input {
+		if err := guardrail.validate(); err != nil {
+			return fmt.Errorf("agent %q has invalid input guardrail %d: %w", agentName, i, err)
+		}
+	}
+	for i, guardrail := range g.Output {
+		if err := guardrail.validate(); err != nil {
+			return fmt.Errorf("agent %q has invalid output guardrail %d: %w", agentName, i, err)
+		}
+	}
+	return nil
+}
+
+func (g Guardrail) validate() error {
+	var checks int
+	for _, set := range []bool{len(g.Keywords) > 0, g.Regex != "", g.Moderation != nil, g.Judge != nil} {
+		if set {
+			checks++
+		}
+	}
+	if checks != 1 {
+		return fmt.Errorf("must have exactly one of keywords, regex, moderation, or judge")
+	}
+	if g.Regex != "" {
+		if _, err := regexp.Compile(g.Regex); err != nil {
+			return fmt.Errorf("invalid regex %q: %w", g.Regex, err)
+		}
+	}
+	if g.Judge != nil && g.Judge.Rubric == "" {
+		return fmt.Errorf("judge must have a rubric")
+	}
+	if g.Moderation != nil && (g.Moderation.Threshold < 0 || g.Moderation.Threshold > 1) {
+		return fmt.Errorf("moderation threshold must be between 0 and 1")
+	}
+	switch g.Action {
+	case "", GuardrailBlock, GuardrailFlag, GuardrailRewrite:
+	default:
+		return fmt.Errorf("invalid action %q, must be block, flag, or rewrite", g.Action)
+	}
+	return nil
+}
+
+type ModerationResult struct {
+	Flagged    bool               `json:"flagged"`
+	Categories map[string]bool    `json:"categories"`
+	Scores     map[string]float64 `json:"category_scores"`
+}
+
+type Moderator interface {
+	Moderate(ctx context.Context, config Moderation, text string) (*ModerationResult, error)
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Handoff configures the agents that an agent can delegate a task to. Each target agent is exposed to
+// the model as a handoff_to_<agent> tool.
+type Handoff struct {
+	// Agents that can be handed off to
+	Agents StringList `json:"agents,omitempty"`
+	// ForwardContext includes a transcript of the conversation so far in the request to the target agent.
+	ForwardContext bool `json:"forwardContext,omitempty"`
+	// MaxDepth is the maximum number of nested handoffs, defaults to 3.
+	MaxDepth int `json:"maxDepth,omitempty"`
+	// Summarize the result of the target agent before it is returned to the calling agent.
+	Summarize bool `json:"summarize,omitempty"`
+	// SummaryAgent is the agent whose model is used for summarization, defaults to the calling agent.
+	SummaryAgent string `json:"summaryAgent,omitempty"`
+}
+
+func (h *Handoff) validate(agentName string, c Config) error {
+	if h == nil {
+		return nil
+	}
+
+	var errs []error
+	if h.MaxDepth < 0 {
+		errs = append(errs, fmt.Errorf("agent %q has a negative handoff maxDepth", agentName))
+	}
+	for _, target := range h.Agents {
+		if _, ok := c.Agents[target]; !ok {
+			errs = append(errs, fmt.Errorf("agent %q has handoff agent %q that is not defined in config%s", agentName, target, didYouMean(target, c.Agents)))
+		} else if target == agentName {
+			errs = append(errs, fmt.Errorf("agent %q can not hand off to itself", agentName))
+		}
+	}
+	if h.SummaryAgent != "" {
+		if _, ok := c.Agents[h.SummaryAgent]; !ok {
+			errs = append(errs, fmt.Errorf("agent %q has handoff summaryAgent %q that is not defined in config%s", agentName, h.SummaryAgent, didYouMean(h.SummaryAgent, c.Agents)))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultKnowledgeChunkSize    = 1500
+	defaultKnowledgeChunkOverlap = 200
+	defaultKnowledgeTopK         = 4
+	defaultKnowledgeRefresh      = time.Minute
+)
+
+// Knowledge are local documents of an agent that are chunked, embedded, and indexed in a vector store, so
+// that the agent can search them.
+type Knowledge struct {
+	// Sources are files, directories, or glob patterns of markdown, text, HTML, and PDF documents.
+	// Relative paths are relative to the directory of the config.
+	Sources        StringList `json:"sources,omitempty"`
+	Store          string     `json:"store,omitempty"`
+	EmbeddingModel string     `json:"embeddingModel,omitempty"`
+	// ChunkSize and ChunkOverlap are in characters.
+	ChunkSize    int     `json:"chunkSize,omitempty"`
+	ChunkOverlap int     `json:"chunkOverlap,omitempty"`
+	TopK         int     `json:"topK,omitempty"`
+	MinScore     float64 `json:"minScore,omitempty"`
+	// Inject adds the chunks most relevant to the message of the user to the system prompt, in addition
+	// to the search tool.
+	Inject bool `json:"inject,omitempty"`
+	// Refresh is how often the sources are checked for changes. Defaults to 1m.
+	Refresh string `json:"refresh,omitempty"`
+}
+
+func (k Knowledge) GetEmbeddingModel() string {
+	if k.EmbeddingModel == "" {
+		return DefaultEmbeddingModel
+	}
+	return k.EmbeddingModel
+}
+
+func (k Knowledge) GetChunkSize() int {
+	if k.ChunkSize <= 0 {
+		return defaultKnowledgeChunkSize
+	}
+	return k.ChunkSize
+}
+
+func (k Knowledge) GetChunkOverlap() int {
+	if k.ChunkOverlap <= 0 {
+		return min(defaultKnowledgeChunkOverlap, k.GetChunkSize()/2)
+	}
+	return k.ChunkOverlap
+}
+
+func (k Knowledge) GetTopK() int {
+	if k.TopK <= 0 {
+		return defaultKnowledgeTopK
+	}
+	return k.TopK
+}
+
+func (k Knowledge) GetRefresh() time.Duration {
+	return parseDurationOr(k.Refresh, defaultKnowledgeRefresh)
+}
+
+func (k *Knowledge) validate(agentName string, c Config) error {
+	if k == nil {
+		return nil
+	}
+	if len(k.Sources) == 0 {
+		return fmt.Errorf("agent %q has knowledge without sources", agentName)
+	}
+	if k.Store != "" {
+		if _, ok := c.MemoryStores[k.Store]; !ok {
+			return fmt.Errorf("agent %q has knowledge store %q that is not defined in memoryStores", agentName, k.Store)
+		}
+	}
+	if k.ChunkOverlap < 0 || k.ChunkOverlap >= k.GetChunkSize() {
+		return fmt.Errorf("agent %q has invalid knowledge chunkOverlap %d: must be less than the chunk size", agentName, k.ChunkOverlap)
+	}
+	if k.Refresh != "" {
+		if _, err := time.ParseDuration(k.Refresh); err != nil {
+			return fmt.Errorf("agent %q has invalid knowledge refresh %q: %w", agentName, k.Refresh, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package types
+
+import (
+	"fmt"
+)
+
+// Limits restricts how much a session or an agent can use the LLM. A zero value for any field means
+// that there is no limit.
+type Limits struct {
+	TokensPerDay      int     `json:"tokensPerDay,omitempty"`
+	RequestsPerMinute int     `json:"requestsPerMinute,omitempty"`
+	MaxCostUSD        float64 `json:"maxCostUSD,omitempty"`
+}
+
+func (l *Limits) IsSet() bool {
+	return l != nil && (l.TokensPerDay > 0 || l.RequestsPerMinute > 0 || l.MaxCostUSD > 0)
+}
+
+func (l *Limits) validate() error {
+	if l == nil {
+		return nil
+	}
+	if l.TokensPerDay < 0 || l.RequestsPerMinute < 0 || l.MaxCostUSD < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// ModelPricing is the price in USD of one million tokens for a model.
+type ModelPricing struct {
+	InputPerMillion  float64 `json:"inputPerMillion,omitempty"`
+	OutputPerMillion float64 `json:"outputPerMillion,omitempty"`
+}
+
+// Cost returns the cost in USD of the given usage for the model. Models without pricing cost nothing.
+func (c Config) Cost(model string, usage *Usage) float64 {
+	if usage == nil {
+		return 0
+	}
+	pricing, ok := c.Pricing[model]
+	if !ok {
+		pricing = c.Pricing[c.ResolveModel(model)]
+	}
+	return float64(usage.InputTokens)*pricing.InputPerMillion/1_000_000 +
+		float64(usage.OutputTokens)*pricing.OutputPerMillion/1_000_000
+}
+
+// LimitExceededError is returned from a completion when a configured limit has been reached.
+type LimitExceededError struct {
+	// Agent is set if the limit is for an agent, otherwise the limit is for the session.
+	Agent string
+	// Limit is the name of the limit, one of tokensPerDay, requestsPerMinute or maxCostUSD
+	Limit string
+	Value any
+}
+
+func (e *LimitExceededError) Error() string {
+	scope := "session"
+	if e.Agent != "" {
+		scope = fmt.Sprintf("agent %q", e.Agent)
+	}
+	return fmt.Sprintf("%s exceeded limit %s of %v", scope, e.Limit, e.Value)
+}
@@ -0,0 +1,65 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+)
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// Logging is how nanobot writes its logs. Without a format or sinks logs are printed to stderr as text
+// lines prefixed with their kind.
+type Logging struct {
+	// Format is text or json, json writes a JSON object for each line.
+	Format string `json:"format,omitempty"`
+	// Level is the lowest level that is logged, debug, info, warn, or error, defaults to info.
+	Level string `json:"level,omitempty"`
+	// Components maps a package, like mcp or llm/anthropic, to its level. The level of the longest
+	// matching package applies.
+	Components map[string]string `json:"components,omitempty"`
+	// Sinks are where logs are written, defaults to stderr.
+	Sinks []LogSink `json:"sinks,omitempty"`
+}
+
+type LogSink struct {
+	// Type is stdout, stderr, or file.
+	Type string `json:"type"`
+	// Path is the file of a file sink.
+	Path string `json:"path,omitempty"`
+	// MaxSize is the size in megabytes a file grows to before it is rotated, defaults to 100.
+	MaxSize int `json:"maxSize,omitempty"`
+	// MaxFiles is how many rotated files are kept, defaults to 5.
+	MaxFiles int `json:"maxFiles,omitempty"`
+}
+
+func (l *Logging) validate() error {
+	if l == nil {
+		return nil
+	}
+	if l.Format != "" && l.Format != "text" && l.Format != "json" {
+		return fmt.Errorf("logging format must be text or json, got %q", l.Format)
+	}
+	if l.Level != "" && !slices.Contains(logLevels, l.Level) {
+		return fmt.Errorf("logging level must be one of %v, got %q", logLevels, l.Level)
+	}
+	for component, level := range l.Components {
+		if !slices.Contains(logLevels, level) {
+			return fmt.Errorf("logging level of component %q must be one of %v, got %q", component, logLevels, level)
+		}
+	}
+	for i, sink := range l.Sinks {
+		switch sink.Type {
+		case "stdout", "stderr":
+		case "file":
+			if sink.Path == "" {
+				return fmt.Errorf("logging sink %d of type file must have a path", i)
+			}
+		default:
+			return fmt.Errorf("logging sink %d must be of type stdout, stderr, or file, got %q", i, sink.Type)
+		}
+		if sink.MaxSize < 0 || sink.MaxFiles < 0 {
+			return fmt.Errorf("logging sink %d must not have a negative maxSize or maxFiles", i)
+		}
+	}
+	return nil
+}
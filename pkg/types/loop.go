@@ -0,0 +1,24 @@
+package types
+
+import (
+	"fmt"
+)
+
+// Loop limits the tool calls of one turn of an agent, so that an agent that keeps calling tools stops.
+type Loop struct {
+	// MaxIterations is the number of rounds of tool calls of a turn, unset means no limit.
+	MaxIterations int `json:"maxIterations,omitempty"`
+	// MaxRepeats is how many times in a row the same tool can be called with the same arguments,
+	// unset means no limit.
+	MaxRepeats int `json:"maxRepeats,omitempty"`
+}
+
+func (l *Loop) validate() error {
+	if l == nil {
+		return nil
+	}
+	if l.MaxIterations < 0 || l.MaxRepeats < 0 {
+		return fmt.Errorf("maxIterations and maxRepeats must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+const (
+	DefaultEmbeddingModel = "text-embedding-3-small"
+	defaultMemoryTopK     = 5
+)
+
+// Memory scopes, which decide the memories that are shared between sessions.
+const (
+	// MemoryScopeUser shares memories between the sessions of the same user with the agent, memories of
+	// users without an ID are kept in the session.
+	MemoryScopeUser = "user"
+	// MemoryScopeAgent shares memories between all sessions of the agent.
+	MemoryScopeAgent = "agent"
+	// MemoryScopeSession keeps memories in the session.
+	MemoryScopeSession = "session"
+)
+
+// What a memory remembers of each turn.
+const (
+	RememberUser      = "user"
+	RememberAssistant = "assistant"
+	RememberTools     = "tools"
+)
+
+// Memory stores turns of the agent in a vector store and adds the memories most relevant to the
+// current turn to the system prompt.
+type Memory struct {
+	// Store is the name of the store in memoryStores. Defaults to the database of nanobot.
+	Store          string     `json:"store,omitempty"`
+	EmbeddingModel string     `json:"embeddingModel,omitempty"`
+	TopK           int        `json:"topK,omitempty"`
+	MinScore       float64    `json:"minScore,omitempty"`
+	Remember       StringList `json:"remember,omitempty"`
+	Scope          string     `json:"scope,omitempty"`
+}
+
+func (m Memory) GetEmbeddingModel() string {
+	if m.EmbeddingModel == "" {
+		return DefaultEmbeddingModel
+	}
+	return m.EmbeddingModel
+}
+
+func (m Memory) GetTopK() int {
+	if m.TopK <= 0 {
+		return defaultMemoryTopK
+	}
+	return m.TopK
+}
+
+func (m Memory) GetScope() string {
+	if m.Scope == "" {
+		return MemoryScopeUser
+	}
+	return m.Scope
+}
+
+// Remembers returns true if the memory stores the given part of a turn. Defaults to the messages of the
+// user and the assistant.
+func (m Memory) Remembers(part string) bool {
+	if len(m.Remember) == 0 {
+		return part == RememberUser || part == RememberAssistant
+	}
+	return slices.Contains(m.Remember, part)
+}
+
+func (m *Memory) validate(agentName string, c Config) error {
+	if m == nil {
+		return nil
+	}
+	if m.Store != "" {
+		if _, ok := c.MemoryStores[m.Store]; !ok {
+			return fmt.Errorf("agent %q has memory store %q that is not defined in memoryStores", agentName, m.Store)
+		}
+	}
+	if m.MinScore < -1 || m.MinScore > 1 {
+		return fmt.Errorf("agent %q has invalid memory minScore %v: must be between -1 and 1", agentName, m.MinScore)
+	}
+	switch m.Scope {
+	case "", MemoryScopeUser, MemoryScopeAgent, MemoryScopeSession:
+	default:
+		return fmt.Errorf("agent %q has invalid memory scope %q: must be user, agent, or session", agentName, m.Scope)
+	}
+	for _, part := range m.Remember {
+		switch part {
+		case RememberUser, RememberAssistant, RememberTools:
+		default:
+			return fmt.Errorf("agent %q has invalid memory remember %q: must be user, assistant, or tools", agentName, part)
+		}
+	}
+	return nil
+}
+
+// MemoryStore is a vector store holding the memories of agents.
+type MemoryStore struct {
+	// Type is "database" (the default), "pgvector", or "qdrant".
+	Type string `json:"type,omitempty"`
+	// DSN is the database of the database and pgvector stores. The database store defaults to the
+	// database of nanobot.
+	DSN string `json:"dsn,omitempty"`
+	// URL, APIKey, and Collection configure the qdrant store.
+	URL        string `json:"url,omitempty"`
+	APIKey     string `json:"apiKey,omitempty"`
+	Collection string `json:"collection,omitempty"`
+}
+
+func (m MemoryStore) validate(name string) error {
+	switch m.Type {
+	case "", "database":
+	case "pgvector":
+		if m.DSN == "" {
+			return fmt.Errorf("memory store %q of type pgvector must have a dsn", name)
+		}
+	case "qdrant":
+		if m.URL == "" {
+			return fmt.Errorf("memory store %q of type qdrant must have a url", name)
+		}
+	default:
+		return fmt.Errorf("memory store %q has invalid type %q: must be database, pgvector, or qdrant", name, m.Type)
+	}
+	return nil
+}
+
+type Embedder interface {
+	Embed(ctx context.Context, model string, input []string) ([][]float32, error)
+}
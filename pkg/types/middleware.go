@@ -0,0 +1,38 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Middleware refers to a middleware registered with the middleware package by its name. It is written
+// as just the name when it has no config.
+type Middleware struct {
+	Name   string         `json:"name,omitempty"`
+	Config map[string]any `json:"config,omitempty"`
+}
+
+func (m Middleware) MarshalJSON() ([]byte, error) {
+	if len(m.Config) == 0 {
+		return json.Marshal(m.Name)
+	}
+	type Alias Middleware
+	return json.Marshal(Alias(m))
+}
+
+func (m *Middleware) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &m.Name)
+	}
+	type Alias Middleware
+	return json.Unmarshal(data, (*Alias)(m))
+}
+
+func validateMiddleware(middleware []Middleware) error {
+	for i, m := range middleware {
+		if m.Name == "" {
+			return fmt.Errorf("middleware %d must have a name", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package types
+
+import (
+	"fmt"
+	"net/url"
+)
+
+const (
+	ProviderTypeAzure   = "azure"
+	ProviderTypeBedrock = "bedrock"
+
+	AzureAuthAPIKey = "apiKey"
+	AzureAuthEntra  = "entra"
+
+	DefaultAzureAPIVersion = "2025-04-01-preview"
+)
+
+// Provider is an LLM endpoint that agents select by name with their provider field, for the APIs that
+// enterprises run models behind, Azure OpenAI and AWS Bedrock.
+type Provider struct {
+	// Type is azure or bedrock.
+	Type string `json:"type,omitempty"`
+	// Endpoint is the URL of the Azure OpenAI resource, like https://my-resource.openai.azure.com. For
+	// Bedrock it replaces the regional bedrock-runtime endpoint, e.g. for a VPC endpoint.
+	Endpoint string `json:"endpoint,omitempty"`
+	// APIVersion is the api-version of Azure OpenAI requests.
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Deployments maps the model of an agent to the Azure deployment, or the Bedrock model or inference
+	// profile ID, that serves it. Models that are not mapped are sent as they are.
+	Deployments map[string]string `json:"deployments,omitempty"`
+	// Auth is how Azure requests are authenticated: apiKey (the default) or entra, with a token of the
+	// Entra ID service principal, workload identity, or managed identity.
+	Auth string `json:"auth,omitempty"`
+	// APIKey is the key of the Azure OpenAI resource, defaults to $AZURE_OPENAI_API_KEY.
+	APIKey string `json:"apiKey,omitempty"`
+	// TenantID, ClientID, and ClientSecret are the Entra ID service principal, defaulting to
+	// $AZURE_TENANT_ID, $AZURE_CLIENT_ID, and $AZURE_CLIENT_SECRET. Without a secret the token of the
+	// workload identity in $AZURE_FEDERATED_TOKEN_FILE or of the managed identity is used.
+	TenantID     string `json:"tenantID,omitempty"`
+	ClientID     string `json:"clientID,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	// Region is the AWS region of Bedrock, defaults to $AWS_REGION.
+	Region string `json:"region,omitempty"`
+	// AccessKeyID, SecretAccessKey, and SessionToken sign Bedrock requests, defaulting to
+	// $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY, and $AWS_SESSION_TOKEN.
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+}
+
+// Deployment returns the deployment or model ID the provider serves the model with.
+func (p Provider) Deployment(model string) string {
+	if deployment, ok := p.Deployments[model]; ok && deployment != "" {
+		return deployment
+	}
+	return model
+}
+
+func (p Provider) validate(name string) error {
+	switch p.Type {
+	case ProviderTypeAzure:
+		if p.Endpoint == "" {
+			return fmt.Errorf("provider %q of type azure must have an endpoint", name)
+		}
+		switch p.Auth {
+		case "", AzureAuthAPIKey, AzureAuthEntra:
+		default:
+			return fmt.Errorf("provider %q has invalid auth %q: must be apiKey or entra", name, p.Auth)
+		}
+	case ProviderTypeBedrock:
+		if p.Auth != "" {
+			return fmt.Errorf("provider %q of type bedrock does not support auth, it uses AWS credentials", name)
+		}
+	default:
+		return fmt.Errorf("provider %q has invalid type %q: must be azure or bedrock", name, p.Type)
+	}
+	if p.Endpoint != "" {
+		if u, err := url.Parse(p.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("provider %q has invalid endpoint %q", name, p.Endpoint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// ModelList is the model of an agent, optionally followed by the models to fall back to, in order, when
+// the completion fails with the models before.
+type ModelList []string
+
+func (m *ModelList) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		var list []string
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		*m = list
+		return nil
+	}
+
+	var model string
+	if err := json.Unmarshal(data, &model); err != nil {
+		return err
+	}
+	if model == "" {
+		*m = nil
+	} else {
+		*m = ModelList{model}
+	}
+	return nil
+}
+
+func (m ModelList) MarshalJSON() ([]byte, error) {
+	if len(m) == 1 {
+		return json.Marshal(m[0])
+	}
+	return json.Marshal([]string(m))
+}
+
+// Primary returns the model that is tried first.
+func (m ModelList) Primary() string {
+	if len(m) == 0 {
+		return ""
+	}
+	return m[0]
+}
+
+// Fallbacks returns the models that are tried when the primary model fails.
+func (m ModelList) Fallbacks() []string {
+	if len(m) < 2 {
+		return nil
+	}
+	return m[1:]
+}
+
+// RetryPolicy is how completions of an LLM provider are retried when they fail with a rate limit, an
+// overloaded or unavailable provider, or a network error.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts per model, including the first one. Defaults to 1.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// InitialBackoff is the wait before the first retry, doubled for each retry after. Defaults to 1s.
+	InitialBackoff string `json:"initialBackoff,omitempty"`
+	// MaxBackoff limits the wait between attempts, including waits requested by Retry-After. Defaults to 30s.
+	MaxBackoff string `json:"maxBackoff,omitempty"`
+	// Timeout is the time all attempts of one model may take before falling back to the next model.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// GetRetryPolicy returns the retry policy of the provider, or of "*" if the provider has none.
+func (c Config) GetRetryPolicy(provider string) RetryPolicy {
+	if policy, ok := c.Retries[provider]; ok {
+		return policy
+	}
+	return c.Retries["*"]
+}
+
+func (r RetryPolicy) GetMaxAttempts() int {
+	return max(r.MaxAttempts, 1)
+}
+
+func (r RetryPolicy) GetInitialBackoff() time.Duration {
+	return parseDurationOr(r.InitialBackoff, defaultInitialBackoff)
+}
+
+func (r RetryPolicy) GetMaxBackoff() time.Duration {
+	return parseDurationOr(r.MaxBackoff, defaultMaxBackoff)
+}
+
+// GetTimeout returns the time budget of all attempts of a model, zero means no budget.
+func (r RetryPolicy) GetTimeout() time.Duration {
+	return parseDurationOr(r.Timeout, 0)
+}
+
+func parseDurationOr(value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+func (r RetryPolicy) validate(provider string) error {
+	if r.MaxAttempts < 0 {
+		return fmt.Errorf("retry policy of %q has invalid maxAttempts %d: must not be negative", provider, r.MaxAttempts)
+	}
+	for field, value := range map[string]string{
+		"initialBackoff": r.InitialBackoff,
+		"maxBackoff":     r.MaxBackoff,
+		"timeout":        r.Timeout,
+	} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("retry policy of %q has invalid %s %q: %w", provider, field, value, err)
+		} else if d < 0 {
+			return fmt.Errorf("retry policy of %q has invalid %s %q: must not be negative", provider, field, value)
+		} else if d == 0 && field == "initialBackoff" {
+			return fmt.Errorf("retry policy of %q has invalid %s %q: must be positive", provider, field, value)
+		}
+	}
+	return nil
+}
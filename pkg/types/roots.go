@@ -0,0 +1,75 @@
+package types
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ServerRoots returns the names of the roots the MCP server can list, or false if it can list all
+// roots. The roots of the server are narrowed to the roots of the agents that use it, unless one of
+// them does not set roots.
+func (c Config) ServerRoots(server string) ([]string, bool) {
+	var (
+		agentRoots  = map[string]struct{}{}
+		usedByAgent bool
+		allAgents   bool
+	)
+	for _, agent := range c.Agents {
+		if !agent.usesServer(server) {
+			continue
+		}
+		usedByAgent = true
+		if agent.Roots == nil {
+			allAgents = true
+			break
+		}
+		for _, name := range agent.Roots {
+			agentRoots[name] = struct{}{}
+		}
+	}
+
+	serverRoots := c.MCPServers[server].Roots
+	switch {
+	case !usedByAgent || allAgents:
+		if serverRoots == nil {
+			return nil, false
+		}
+		return slices.Sorted(slices.Values(serverRoots)), true
+	case serverRoots == nil:
+		return slices.Sorted(maps.Keys(agentRoots)), true
+	}
+
+	var names []string
+	for _, name := range serverRoots {
+		if _, ok := agentRoots[name]; ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, true
+}
+
+func (a Agent) usesServer(server string) bool {
+	if slices.Contains(a.MCPServers, server) {
+		return true
+	}
+	for _, tool := range a.Tools {
+		if ParseToolRef(tool).Server == server {
+			return true
+		}
+	}
+	return false
+}
+
+func validateRoots(roots map[string]string) error {
+	for name, dir := range roots {
+		if name == "" {
+			return fmt.Errorf("roots must have a name")
+		}
+		if dir == "" {
+			return fmt.Errorf("root %q must have a directory", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package types
+
+// Similarity gives an agent the compute_similarity tool, which ranks texts by how similar their
+// embeddings are to the embedding of a query.
+type Similarity struct {
+	EmbeddingModel string `json:"embeddingModel,omitempty"`
+}
+
+func (s Similarity) GetEmbeddingModel() string {
+	if s.EmbeddingModel == "" {
+		return DefaultEmbeddingModel
+	}
+	return s.EmbeddingModel
+}
@@ -0,0 +1,99 @@
+package types
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	DefaultTranscriptionModel = "whisper-1"
+	DefaultSynthesisModel     = "gpt-4o-mini-tts"
+	defaultSynthesisVoice     = "alloy"
+	defaultSynthesisFormat    = "mp3"
+)
+
+// Speech lets users talk to the agent. Audio input is transcribed before it reaches the model and the
+// text of the reply can be synthesized to audio.
+type Speech struct {
+	Transcription *Transcription `json:"transcription,omitempty"`
+	Synthesis     *Synthesis     `json:"synthesis,omitempty"`
+}
+
+// Transcription uses the OpenAI transcription API, or a local server with the same API such as
+// whisper.cpp or faster-whisper-server when BaseURL is set.
+type Transcription struct {
+	Model    string `json:"model,omitempty"`
+	BaseURL  string `json:"baseURL,omitempty"`
+	APIKey   string `json:"apiKey,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+func (t Transcription) GetModel() string {
+	if t.Model == "" {
+		return DefaultTranscriptionModel
+	}
+	return t.Model
+}
+
+// Synthesis uses the OpenAI speech API, or a local server with the same API when BaseURL is set.
+type Synthesis struct {
+	Model   string `json:"model,omitempty"`
+	BaseURL string `json:"baseURL,omitempty"`
+	APIKey  string `json:"apiKey,omitempty"`
+	Voice   string `json:"voice,omitempty"`
+	// Format is mp3, opus, aac, flac, wav, or pcm.
+	Format string `json:"format,omitempty"`
+	// Always synthesizes every reply, by default only replies to audio input are synthesized.
+	Always bool `json:"always,omitempty"`
+}
+
+func (s Synthesis) GetModel() string {
+	if s.Model == "" {
+		return DefaultSynthesisModel
+	}
+	return s.Model
+}
+
+func (s Synthesis) GetVoice() string {
+	if s.Voice == "" {
+		return defaultSynthesisVoice
+	}
+	return s.Voice
+}
+
+func (s Synthesis) GetFormat() string {
+	if s.Format == "" {
+		return defaultSynthesisFormat
+	}
+	return s.Format
+}
+
+// MIMEType returns the mime type of the audio in the format of the synthesis.
+func (s Synthesis) MIMEType() string {
+	switch s.GetFormat() {
+	case "mp3":
+		return "audio/mpeg"
+	case "pcm":
+		return "audio/pcm"
+	default:
+		return "audio/" + s.GetFormat()
+	}
+}
+
+func (s *Speech) validate(agentName string) error {
+	if s == nil || s.Synthesis == nil {
+		return nil
+	}
+	switch s.Synthesis.Format {
+	case "", "mp3", "opus", "aac", "flac", "wav", "pcm":
+	default:
+		return fmt.Errorf("agent %q has invalid speech synthesis format %q: must be mp3, opus, aac, flac, wav, or pcm",
+			agentName, s.Synthesis.Format)
+	}
+	return nil
+}
+
+type SpeechConverter interface {
+	Transcribe(ctx context.Context, config Transcription, mimeType string, audio []byte) (string, error)
+	Synthesize(ctx context.Context, config Synthesis, text string) ([]byte, error)
+}
@@ -0,0 +1,82 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	TimeoutTool = "tool"
+	TimeoutTurn = "turn"
+)
+
+// Timeouts are the defaults of the MCP servers and agents that do not set their own.
+type Timeouts struct {
+	// Tool is how long a tool call of an MCP server may run.
+	Tool string `json:"tool,omitempty"`
+	// Turn is how long a turn of an agent, with all of its completions and tool calls, may run.
+	Turn string `json:"turn,omitempty"`
+}
+
+// TimeoutError is the error of a tool call or a turn that ran longer than its timeout.
+type TimeoutError struct {
+	// Kind is tool or turn.
+	Kind string `json:"kind"`
+	// Name is the tool, as server/tool, or the agent of the turn.
+	Name    string `json:"name"`
+	Timeout string `json:"timeout"`
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s %s timed out after %s", e.Kind, e.Name, e.Timeout)
+}
+
+// GetToolTimeout returns how long a call of the tool of the MCP server may run, zero means no limit.
+// The timeout of the tool in toolTimeouts comes first, then the timeout of the server, then the
+// default of the config.
+func (c Config) GetToolTimeout(server, tool string) time.Duration {
+	mcpServer := c.MCPServers[server]
+	if timeout, ok := mcpServer.ToolTimeouts[tool]; ok {
+		return parseDurationOr(timeout, 0)
+	}
+	if mcpServer.Timeout != "" {
+		return parseDurationOr(mcpServer.Timeout, 0)
+	}
+	if c.Timeouts != nil {
+		return parseDurationOr(c.Timeouts.Tool, 0)
+	}
+	return 0
+}
+
+// GetTurnTimeout returns how long a turn of the agent may run, zero means no limit.
+func (c Config) GetTurnTimeout(agent string) time.Duration {
+	if timeout := c.Agents[agent].TurnTimeout; timeout != "" {
+		return parseDurationOr(timeout, 0)
+	}
+	if c.Timeouts != nil {
+		return parseDurationOr(c.Timeouts.Turn, 0)
+	}
+	return 0
+}
+
+func validateTimeout(field, timeout string) error {
+	if timeout == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(timeout); err != nil {
+		return fmt.Errorf("%s has invalid timeout %q: %w", field, timeout, err)
+	} else if d < 0 {
+		return fmt.Errorf("%s has a negative timeout %q", field, timeout)
+	}
+	return nil
+}
+
+func (t *Timeouts) validate() error {
+	if t == nil {
+		return nil
+	}
+	if err := validateTimeout("timeouts.tool", t.Tool); err != nil {
+		return err
+	}
+	return validateTimeout("timeouts.turn", t.Turn)
+}
@@ -0,0 +1,93 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	defaultToolTimeout   = 30 * time.Second
+	defaultToolMaxMemory = 64 * 1024 * 1024
+)
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Tool is a custom tool that runs inside nanobot, without an MCP server. Agents refer to it by its name
+// in their tools.
+type Tool struct {
+	Description string      `json:"description,omitempty"`
+	Input       InputSchema `json:"input,omitempty"`
+	// WASM is the path of a WebAssembly module implementing the tool. The module is run as a WASI command
+	// that reads the JSON arguments of the call on stdin and writes the result to stdout.
+	WASM string `json:"wasm,omitempty"`
+	// Script is the body of a function implementing the tool, the fields of the input are its parameters
+	// and args has all the arguments. The value it returns is the result of the call.
+	Script string `json:"script,omitempty"`
+	// Language of the script, javascript (default) or starlark.
+	Language string `json:"language,omitempty"`
+	// Env are the environment variables of the tool, it gets none of the environment of nanobot.
+	Env map[string]string `json:"env,omitempty"`
+	// Timeout defaults to 30s.
+	Timeout string `json:"timeout,omitempty"`
+	// MaxMemory is the memory limit of the tool, for example "128MB". Defaults to 64MiB.
+	MaxMemory string `json:"maxMemory,omitempty"`
+}
+
+func (t Tool) GetTimeout() time.Duration {
+	return parseDurationOr(t.Timeout, defaultToolTimeout)
+}
+
+func (t Tool) GetMaxMemory() uint64 {
+	if t.MaxMemory == "" {
+		return defaultToolMaxMemory
+	}
+	size, err := humanize.ParseBytes(t.MaxMemory)
+	if err != nil || size == 0 {
+		return defaultToolMaxMemory
+	}
+	return size
+}
+
+// Params returns the names of the fields of the input, sorted, which are the parameters of the script.
+func (t Tool) Params() []string {
+	var params []string
+	for field := range t.Input.Fields {
+		field = strings.TrimSuffix(field, "[]")
+		field, _, _ = strings.Cut(field, "(")
+		params = append(params, field)
+	}
+	slices.Sort(params)
+	return params
+}
+
+func (t Tool) validate(name string) error {
+	if (t.WASM == "") == (t.Script == "") {
+		return fmt.Errorf("tool %q must have either a wasm module or a script", name)
+	}
+	if t.Script != "" {
+		if t.Language != "" && t.Language != "javascript" && t.Language != "starlark" {
+			return fmt.Errorf("tool %q has invalid language %q, must be javascript or starlark", name, t.Language)
+		}
+		for _, param := range t.Params() {
+			if !identifierRegexp.MatchString(param) || param == "args" {
+				return fmt.Errorf("tool %q has input field %q that is not a valid parameter name", name, param)
+			}
+		}
+	}
+	if t.Timeout != "" {
+		if _, err := time.ParseDuration(t.Timeout); err != nil {
+			return fmt.Errorf("tool %q has invalid timeout %q: %w", name, t.Timeout, err)
+		}
+	}
+	if t.MaxMemory != "" {
+		if _, err := humanize.ParseBytes(t.MaxMemory); err != nil {
+			return fmt.Errorf("tool %q has invalid maxMemory %q: %w", name, t.MaxMemory, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/robfig/cron/v3"
+)
+
+// CronParser parses the standard five field cron expressions and descriptors like @daily.
+var CronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Trigger runs an agent with a prompt on a schedule and delivers the output to the sinks.
+type Trigger struct {
+	Cron   string `json:"cron,omitempty"`
+	Agent  string `json:"agent,omitempty"`
+	Prompt string `json:"prompt,omitempty"`
+	Sinks  []Sink `json:"sinks,omitempty"`
+}
+
+// Sink is where the output of a trigger is delivered. Exactly one of the fields must be set.
+type Sink struct {
+	// Webhook is a URL the output is POSTed to as JSON.
+	Webhook *WebhookSink `json:"webhook,omitempty"`
+	// File is a path the output is appended to as a line of JSON.
+	File  string     `json:"file,omitempty"`
+	Email *EmailSink `json:"email,omitempty"`
+}
+
+type WebhookSink struct {
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type EmailSink struct {
+	// SMTP is the host:port of the SMTP server.
+	SMTP     string     `json:"smtp,omitempty"`
+	Username string     `json:"username,omitempty"`
+	Password string     `json:"password,omitempty"`
+	From     string     `json:"from,omitempty"`
+	To       StringList `json:"to,omitempty"`
+	// Subject defaults to the name of the trigger.
+	Subject string `json:"subject,omitempty"`
+}
+
+func (t Trigger) validate(name string, c Config) error {
+	if _, err := CronParser.Parse(t.Cron); err != nil {
+		return fmt.Errorf("trigger %q has invalid cron %q: %w", name, t.Cron, err)
+	}
+	if _, ok := c.Agents[t.Agent]; !ok {
+		if _, ok := c.MCPServers[t.Agent]; !ok {
+			return fmt.Errorf("trigger %q references undefined agent %q", name, t.Agent)
+		}
+	}
+	if t.Prompt == "" {
+		return fmt.Errorf("trigger %q must have a prompt", name)
+	}
+	for i, sink := range t.Sinks {
+		if err := sink.validate(); err != nil {
+			return fmt.Errorf("trigger %q sinks[%d]: %w", name, i, err)
+		}
+	}
+	return nil
+}
+
+func (s Sink) validate() error {
+	set := 0
+	if s.Webhook != nil {
+		set++
+		if s.Webhook.URL == "" {
+			return fmt.Errorf("webhook must have a url")
+		}
+	}
+	if s.File != "" {
+		set++
+	}
+	if s.Email != nil {
+		set++
+		if s.Email.SMTP == "" || s.Email.From == "" || len(s.Email.To) == 0 {
+			return fmt.Errorf("email must have smtp, from, and to")
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("exactly one of webhook, file, or email must be set")
+	}
+	return nil
+}
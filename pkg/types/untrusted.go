@@ -0,0 +1,49 @@
+package types
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// Untrusted is how an agent handles the content of tool results and resources, which can carry
+// instructions of third parties that try to take over the agent (prompt injection). The content is
+// labeled as untrusted data for the model.
+type Untrusted struct {
+	// Trusted are the MCP servers, agents, and flows whose results are not labeled or sanitized.
+	Trusted []string `json:"trusted,omitempty"`
+	// Sanitize removes text that looks like instructions to the model, like "ignore previous
+	// instructions", from untrusted content.
+	Sanitize bool `json:"sanitize,omitempty"`
+	// Patterns are regular expressions of text that is removed in addition to the built-in patterns, they
+	// imply sanitize.
+	Patterns []string `json:"patterns,omitempty"`
+	// Classifier asks a model if untrusted content tries to instruct the agent, content it flags is
+	// removed.
+	Classifier *Classifier `json:"classifier,omitempty"`
+	// Confirm are the tools, as server/tool with * wildcards, that require the approval of the user when
+	// the agent calls them after untrusted content entered the conversation.
+	Confirm []string `json:"confirm,omitempty"`
+}
+
+type Classifier struct {
+	// Model defaults to the model of the agent.
+	Model string `json:"model,omitempty"`
+}
+
+func (u *Untrusted) validate(agentName string) error {
+	if u == nil {
+		return nil
+	}
+	for _, pattern := range u.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("agent %q has invalid untrusted pattern %q: %w", agentName, pattern, err)
+		}
+	}
+	for _, tool := range u.Confirm {
+		if _, err := path.Match(tool, ""); err != nil {
+			return fmt.Errorf("agent %q has invalid untrusted confirm pattern %q: %w", agentName, tool, err)
+		}
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package types
 
 import (
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 )
 
 func checkDup(seen map[string]string, category string, keys ...string) error {
@@ -13,3 +16,47 @@ func checkDup(seen map[string]string, category string, keys ...string) error {
 	}
 	return nil
 }
+
+// ClosestName returns the candidate that is the fewest edits away from name, if it is close enough to
+// be a likely typo.
+func ClosestName(name string, candidates []string) string {
+	var (
+		best     string
+		bestDist = len(name)/3 + 2
+	)
+	for _, candidate := range candidates {
+		if d := distance(strings.ToLower(name), strings.ToLower(candidate)); d < bestDist {
+			best, bestDist = candidate, d
+		}
+	}
+	return best
+}
+
+// didYouMean returns a hint of the name in targets closest to name, or an empty string.
+func didYouMean[T any](name string, targets map[string]T) string {
+	if closest := ClosestName(name, slices.Sorted(maps.Keys(targets))); closest != "" {
+		return fmt.Sprintf(", did you mean %q?", closest)
+	}
+	return ""
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
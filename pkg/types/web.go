@@ -0,0 +1,151 @@
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/nanobot-ai/nanobot/pkg/egress"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+)
+
+const (
+	defaultWebTimeout       = 30 * time.Second
+	defaultWebMaxSize       = 2 * 1024 * 1024
+	defaultWebMaxLength     = 20_000
+	defaultWebSearchResults = 5
+)
+
+// The redirect policies of the fetch tool.
+const (
+	WebRedirectsSameOrigin = "same-origin"
+	WebRedirectsAny        = "any"
+	WebRedirectsNone       = "none"
+)
+
+// The providers of the search tool.
+const (
+	WebSearchBrave   = "brave"
+	WebSearchSearXNG = "searxng"
+	WebSearchTavily  = "tavily"
+)
+
+// Web gives an agent the web_fetch tool, and the web_search tool if it has a search provider.
+type Web struct {
+	// MaxSize is the largest response that is read, for example "5MB". Defaults to 2MiB.
+	MaxSize string `json:"maxSize,omitempty"`
+	// MaxLength is the number of characters of a page returned at once, the agent can fetch the rest of
+	// the page with start. Defaults to 20000.
+	MaxLength int `json:"maxLength,omitempty"`
+	// Redirects is same-origin (default), any, or none.
+	Redirects string `json:"redirects,omitempty"`
+	// IgnoreRobots fetches pages the robots.txt of their site disallows.
+	IgnoreRobots bool `json:"ignoreRobots,omitempty"`
+	// Timeout defaults to 30s.
+	Timeout string `json:"timeout,omitempty"`
+	// UserAgent defaults to nanobot.
+	UserAgent string `json:"userAgent,omitempty"`
+	// Egress are the hosts pages can be fetched from, by default all hosts but private addresses.
+	Egress *mcp.EgressPolicy `json:"egress,omitempty"`
+	Search *WebSearch        `json:"search,omitempty"`
+}
+
+type WebSearch struct {
+	// Provider is brave, searxng, or tavily.
+	Provider string `json:"provider,omitempty"`
+	// APIKey of brave or tavily, defaults to the BRAVE_API_KEY or TAVILY_API_KEY environment variable.
+	APIKey string `json:"apiKey,omitempty"`
+	// URL of the SearXNG instance.
+	URL string `json:"url,omitempty"`
+	// MaxResults defaults to 5.
+	MaxResults int `json:"maxResults,omitempty"`
+}
+
+func (w Web) GetMaxSize() int64 {
+	if w.MaxSize == "" {
+		return defaultWebMaxSize
+	}
+	size, err := humanize.ParseBytes(w.MaxSize)
+	if err != nil || size == 0 {
+		return defaultWebMaxSize
+	}
+	return int64(size)
+}
+
+func (w Web) GetMaxLength() int {
+	if w.MaxLength <= 0 {
+		return defaultWebMaxLength
+	}
+	return w.MaxLength
+}
+
+func (w Web) GetRedirects() string {
+	if w.Redirects == "" {
+		return WebRedirectsSameOrigin
+	}
+	return w.Redirects
+}
+
+func (w Web) GetTimeout() time.Duration {
+	return parseDurationOr(w.Timeout, defaultWebTimeout)
+}
+
+func (w Web) GetUserAgent() string {
+	if w.UserAgent == "" {
+		return "nanobot"
+	}
+	return w.UserAgent
+}
+
+// GetEgress returns the policy of the hosts pages are fetched from.
+func (w Web) GetEgress() mcp.EgressPolicy {
+	if w.Egress == nil {
+		return mcp.EgressPolicy{
+			Deny: []string{egress.Private},
+		}
+	}
+	return *w.Egress
+}
+
+func (s WebSearch) GetMaxResults() int {
+	if s.MaxResults <= 0 {
+		return defaultWebSearchResults
+	}
+	return s.MaxResults
+}
+
+func (w *Web) validate(agentName string) error {
+	if w == nil {
+		return nil
+	}
+	if w.MaxSize != "" {
+		if _, err := humanize.ParseBytes(w.MaxSize); err != nil {
+			return fmt.Errorf("agent %q has invalid web maxSize %q: %w", agentName, w.MaxSize, err)
+		}
+	}
+	if redirects := w.GetRedirects(); redirects != WebRedirectsSameOrigin && redirects != WebRedirectsAny && redirects != WebRedirectsNone {
+		return fmt.Errorf("agent %q has invalid web redirects %q, must be same-origin, any, or none", agentName, w.Redirects)
+	}
+	if w.Timeout != "" {
+		if _, err := time.ParseDuration(w.Timeout); err != nil {
+			return fmt.Errorf("agent %q has invalid web timeout %q: %w", agentName, w.Timeout, err)
+		}
+	}
+	if w.Egress != nil {
+		if _, err := egress.NewPolicy(w.Egress.Allow, w.Egress.Deny); err != nil {
+			return fmt.Errorf("agent %q has an invalid web egress policy: %w", agentName, err)
+		}
+	}
+	if w.Search != nil {
+		switch w.Search.Provider {
+		case WebSearchBrave, WebSearchTavily:
+		case WebSearchSearXNG:
+			if w.Search.URL == "" {
+				return fmt.Errorf("agent %q uses searxng for web search without its url", agentName)
+			}
+		default:
+			return fmt.Errorf("agent %q has invalid web search provider %q, must be brave, searxng, or tavily", agentName, w.Search.Provider)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package types
+
+import "fmt"
+
+// Webhook runs an agent for each payload POSTed to /webhooks/{name}.
+type Webhook struct {
+	Agent string `json:"agent,omitempty"`
+	// Prompt is an expression evaluated with the body, headers, and query of the request, for example
+	// "New issue: ${body.issue.title}".
+	Prompt string `json:"prompt,omitempty"`
+	// Session is an expression for the key of the session the payload is sent to, so that related
+	// payloads continue the same conversation. Each payload gets a new session if not set.
+	Session string `json:"session,omitempty"`
+	// Secret verifies the HMAC-SHA256 signature of the body in the SignatureHeader.
+	Secret          string `json:"secret,omitempty"`
+	SignatureHeader string `json:"signatureHeader,omitempty"`
+	// Async responds with 202 Accepted before the agent runs instead of waiting for its output.
+	Async bool `json:"async,omitempty"`
+}
+
+func (w Webhook) validate(name string, c Config) error {
+	if _, ok := c.Agents[w.Agent]; !ok {
+		if _, ok := c.MCPServers[w.Agent]; !ok {
+			return fmt.Errorf("webhook %q references undefined agent %q", name, w.Agent)
+		}
+	}
+	if w.Prompt == "" {
+		return fmt.Errorf("webhook %q must have a prompt", name)
+	}
+	return nil
+}
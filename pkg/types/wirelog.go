@@ -0,0 +1,69 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// WireLog is where the full requests and responses of the completions of agents with wireLog are
+// recorded, for debugging prompts and building eval datasets.
+type WireLog struct {
+	// DSN is the database of the wire log, defaults to the state database of nanobot.
+	DSN string `json:"dsn,omitempty"`
+	// Retention is how long entries are kept, like 168h. Unset keeps them forever.
+	Retention string `json:"retention,omitempty"`
+	// MaxEntries is how many entries are kept, the oldest are removed first. Zero means no limit.
+	MaxEntries int `json:"maxEntries,omitempty"`
+	// Redact is what is replaced in the string values of the entries before they are stored.
+	Redact *WireLogRedact `json:"redact,omitempty"`
+}
+
+type WireLogRedact struct {
+	// Env replaces the values of the env of the session, defaults to true.
+	Env *bool `json:"env,omitempty"`
+	// Secrets replaces the values of resolved secret references and text that looks like API keys,
+	// tokens, and private keys, defaults to true.
+	Secrets *bool `json:"secrets,omitempty"`
+	// Patterns are regular expressions by name of more text to replace, the name is used in the
+	// replacement text.
+	Patterns map[string]string `json:"patterns,omitempty"`
+}
+
+func (r *WireLogRedact) RedactEnv() bool {
+	return r == nil || r.Env == nil || *r.Env
+}
+
+func (r *WireLogRedact) RedactSecrets() bool {
+	return r == nil || r.Secrets == nil || *r.Secrets
+}
+
+// GetRetention returns how long entries are kept, zero keeps them forever.
+func (w *WireLog) GetRetention() time.Duration {
+	if w == nil {
+		return 0
+	}
+	return parseDurationOr(w.Retention, 0)
+}
+
+func (w *WireLog) validate() error {
+	if w == nil {
+		return nil
+	}
+	if w.Retention != "" {
+		if d, err := time.ParseDuration(w.Retention); err != nil || d <= 0 {
+			return fmt.Errorf("wireLog retention must be a positive duration, got %q", w.Retention)
+		}
+	}
+	if w.MaxEntries < 0 {
+		return fmt.Errorf("wireLog maxEntries must not be negative")
+	}
+	if w.Redact != nil {
+		for name, pattern := range w.Redact.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("wireLog redact pattern %q is invalid: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
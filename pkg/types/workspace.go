@@ -0,0 +1,67 @@
+package types
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	// WorkspaceSessionKey is the session attribute of the name of the workspace of the session.
+	WorkspaceSessionKey = "workspace"
+	// WorkspaceHeader is the request header that selects the workspace of a new session if its user is
+	// a member of more than one.
+	WorkspaceHeader = "X-Nanobot-Workspace"
+)
+
+// Workspace is a group of users whose sessions get the env of the workspace, for example the API keys
+// of a team or of one user.
+type Workspace struct {
+	Description string `json:"description,omitempty"`
+	// Users are the IDs or emails of the members, "*" are all authenticated users.
+	Users StringList `json:"users,omitempty"`
+	// Env is added to the env of the sessions of the members and replaces variables of the same name.
+	// Values can reference env variables and secrets, like ${vault:secret/team#token}.
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// HasUser returns true if the user is a member of the workspace.
+func (w Workspace) HasUser(user User) bool {
+	if user.ID == "" {
+		return false
+	}
+	return slices.ContainsFunc(w.Users, func(member string) bool {
+		return member == "*" || member == user.ID || user.HasEmail(member)
+	})
+}
+
+// WorkspaceOf returns the workspace of a new session of the user, the requested one if it is set or else
+// the first, by name, the user is a member of. It returns "" if the user is not a member of any workspace.
+func (c Config) WorkspaceOf(user User, requested string) (string, error) {
+	if requested != "" {
+		workspace, ok := c.Workspaces[requested]
+		if !ok || !workspace.HasUser(user) {
+			return "", fmt.Errorf("user %s is not a member of workspace %q", user.ID, requested)
+		}
+		return requested, nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Workspaces)) {
+		if c.Workspaces[name].HasUser(user) {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+func (w Workspace) validate(name string) error {
+	if len(w.Users) == 0 {
+		return fmt.Errorf("workspace %q must have at least one user", name)
+	}
+	for key := range w.Env {
+		if key == "" || strings.ContainsAny(key, "= ") {
+			return fmt.Errorf("workspace %q has invalid env variable name %q", name, key)
+		}
+	}
+	return nil
+}
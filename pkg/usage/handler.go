@@ -0,0 +1,77 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/session"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// Load returns the report of the usage of the sessions of the account, or of all sessions if accountID is
+// empty. The sessions are read in batches and sessions not updated since the first day of the filter are
+// skipped.
+func Load(ctx context.Context, store *session.Store, accountID string, filter Filter) (Report, error) {
+	var since time.Time
+	if filter.Since != "" {
+		var err error
+		if since, err = time.Parse(time.DateOnly, filter.Since); err != nil {
+			return Report{}, fmt.Errorf("invalid since %q, must be YYYY-MM-DD: %w", filter.Since, err)
+		}
+	}
+
+	b := newReportBuilder(filter)
+	err := store.FindInBatches(ctx, accountID, since, func(sessions []session.Session) error {
+		for _, s := range sessions {
+			ledger, err := FromAttributes(s.State.Attributes)
+			if err != nil {
+				log.Errorf(ctx, "failed to read usage of session %s: %v", s.SessionID, err)
+				continue
+			}
+			b.add(ledger)
+		}
+		return nil
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return b.report(), nil
+}
+
+// Handler serves the usage report of the sessions of the caller as JSON. Callers of a server without auth,
+// and admins that set all=true, get the report of all sessions, anonymous callers of a server with auth
+// are rejected. The since, agent and model query parameters filter the entries of the report.
+func Handler(store *session.Store) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		accountID, ok := types.NanobotContext(req.Context()).AccountID(req.URL.Query().Get("all") == "true")
+		if !ok {
+			http.Error(rw, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		query := req.URL.Query()
+		filter := Filter{
+			Since: query.Get("since"),
+			Agent: query.Get("agent"),
+			Model: query.Get("model"),
+		}
+		if _, err := time.Parse(time.DateOnly, filter.Since); filter.Since != "" && err != nil {
+			http.Error(rw, "invalid since, must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+
+		report, err := Load(req.Context(), store, accountID, filter)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(rw).Encode(report); err != nil {
+			log.Errorf(req.Context(), "failed to write usage report: %v", err)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/session"
+	"gorm.io/gorm"
+)
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	store, err := session.NewStoreFromDSN(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(accountID string, updated time.Time, entry Entry) {
+		t.Helper()
+		if err := store.Create(ctx, &session.Session{
+			Model:     gorm.Model{CreatedAt: updated, UpdatedAt: updated},
+			AccountID: accountID,
+			State: session.State{
+				Attributes: map[string]any{
+					SessionKey: Ledger{Entries: []Entry{entry}},
+				},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// More sessions than fit in one batch
+	now := time.Now().UTC()
+	for i := range 150 {
+		create("alice", now, Entry{Day: now.Format(time.DateOnly), Agent: fmt.Sprint("agent", i%2), Totals: Totals{Requests: 1, InputTokens: 10}})
+	}
+	create("bob", now, Entry{Day: now.Format(time.DateOnly), Agent: "agent0", Totals: Totals{Requests: 1, InputTokens: 100}})
+	old := now.AddDate(0, -1, 0)
+	create("alice", old, Entry{Day: old.Format(time.DateOnly), Agent: "agent0", Totals: Totals{Requests: 1, InputTokens: 1000}})
+
+	tests := []struct {
+		name      string
+		accountID string
+		filter    Filter
+		requests  int
+		tokens    int
+	}{
+		{name: "all sessions", requests: 152, tokens: 2600},
+		{name: "account", accountID: "alice", requests: 151, tokens: 2500},
+		{name: "since", accountID: "alice", filter: Filter{Since: now.Format(time.DateOnly)}, requests: 150, tokens: 1500},
+		{name: "agent", filter: Filter{Agent: "agent1"}, requests: 75, tokens: 750},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Load(ctx, store, tt.accountID, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Total.Requests != tt.requests || report.Total.InputTokens != tt.tokens {
+				t.Errorf("expected %d requests and %d tokens, got %d and %d", tt.requests, tt.tokens, report.Total.Requests, report.Total.InputTokens)
+			}
+		})
+	}
+
+	if _, err := Load(ctx, store, "", Filter{Since: "last week"}); err == nil {
+		t.Error("expected an error for an invalid since")
+	}
+}
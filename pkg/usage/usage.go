@@ -0,0 +1,245 @@
+package usage
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+// SessionKey is the session attribute the usage of a session is stored in.
+const SessionKey = "usage/ledger"
+
+// Totals are the tokens, completions and cost of a set of LLM calls.
+type Totals struct {
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	Requests     int     `json:"requests"`
+	CostUSD      float64 `json:"costUSD"`
+}
+
+func (t *Totals) add(other Totals) {
+	t.InputTokens += other.InputTokens
+	t.OutputTokens += other.OutputTokens
+	t.Requests += other.Requests
+	t.CostUSD += other.CostUSD
+}
+
+// Entry is the usage of one agent and model on one UTC day.
+type Entry struct {
+	Day   string `json:"day"`
+	Agent string `json:"agent,omitempty"`
+	Model string `json:"model,omitempty"`
+	Totals
+}
+
+// Ledger is the usage of a session.
+type Ledger struct {
+	Entries []Entry `json:"entries,omitempty"`
+}
+
+func (l Ledger) Serialize() (any, error) {
+	return l, nil
+}
+
+func (l *Ledger) Deserialize(data any) (any, error) {
+	if err := mcp.JSONCoerce(data, l); err != nil {
+		return nil, err
+	}
+	return *l, nil
+}
+
+func (l Ledger) add(entry Entry) Ledger {
+	entries := slices.Clone(l.Entries)
+	i := slices.IndexFunc(entries, func(e Entry) bool {
+		return e.Day == entry.Day && e.Agent == entry.Agent && e.Model == entry.Model
+	})
+	if i < 0 {
+		entries = append(entries, entry)
+	} else {
+		entries[i].add(entry.Totals)
+	}
+	return Ledger{Entries: entries}
+}
+
+// Record adds the usage of a completion of the agent to the ledger of the root session in ctx.
+func Record(ctx context.Context, config types.Config, agentName string, resp *types.CompletionResponse) {
+	if resp == nil || resp.Usage == nil {
+		return
+	}
+
+	if counter, ok := ctx.Value(counterKey{}).(*Counter); ok {
+		counter.add(resp.Usage)
+	}
+
+	session := mcp.SessionFromContext(ctx).Root()
+	if session == nil {
+		return
+	}
+
+	entry := Entry{
+		Day:   time.Now().UTC().Format(time.DateOnly),
+		Agent: agentName,
+		Model: resp.Model,
+		Totals: Totals{
+			InputTokens:  resp.Usage.InputTokens,
+			OutputTokens: resp.Usage.OutputTokens,
+			Requests:     1,
+			CostUSD:      config.Cost(resp.Model, resp.Usage),
+		},
+	}
+
+	var ledger Ledger
+	_ = session.Update(SessionKey, &ledger, func() error {
+		ledger = ledger.add(entry)
+		return nil
+	})
+}
+
+// FromAttributes reads the ledger from the stored attributes of a session.
+func FromAttributes(attributes map[string]any) (Ledger, error) {
+	var ledger Ledger
+	data, ok := attributes[SessionKey]
+	if !ok {
+		return ledger, nil
+	}
+	err := mcp.JSONCoerce(data, &ledger)
+	return ledger, err
+}
+
+// Group is the usage of one day, agent or model.
+type Group struct {
+	Key string `json:"key"`
+	Totals
+}
+
+// Report is a breakdown of the usage of one or more sessions.
+type Report struct {
+	Total   Totals  `json:"total"`
+	ByDay   []Group `json:"byDay"`
+	ByAgent []Group `json:"byAgent"`
+	ByModel []Group `json:"byModel"`
+}
+
+// Filter selects the entries that are included in a report. Empty fields match all entries.
+type Filter struct {
+	// Since is the first UTC day (YYYY-MM-DD) to include.
+	Since string
+	Agent string
+	Model string
+}
+
+func (f Filter) matches(entry Entry) bool {
+	return (f.Since == "" || entry.Day >= f.Since) &&
+		(f.Agent == "" || entry.Agent == f.Agent) &&
+		(f.Model == "" || entry.Model == f.Model)
+}
+
+// NewReport sums the entries of the ledgers that match the filter.
+func NewReport(filter Filter, ledgers ...Ledger) Report {
+	b := newReportBuilder(filter)
+	for _, ledger := range ledgers {
+		b.add(ledger)
+	}
+	return b.report()
+}
+
+// reportBuilder sums the entries of ledgers as they are added.
+type reportBuilder struct {
+	filter  Filter
+	total   Totals
+	byDay   map[string]Totals
+	byAgent map[string]Totals
+	byModel map[string]Totals
+}
+
+func newReportBuilder(filter Filter) *reportBuilder {
+	return &reportBuilder{
+		filter:  filter,
+		byDay:   map[string]Totals{},
+		byAgent: map[string]Totals{},
+		byModel: map[string]Totals{},
+	}
+}
+
+func (b *reportBuilder) add(ledger Ledger) {
+	for _, entry := range ledger.Entries {
+		if !b.filter.matches(entry) {
+			continue
+		}
+		b.total.add(entry.Totals)
+		addTo(b.byDay, entry.Day, entry.Totals)
+		addTo(b.byAgent, entry.Agent, entry.Totals)
+		addTo(b.byModel, entry.Model, entry.Totals)
+	}
+}
+
+func (b *reportBuilder) report() Report {
+	return Report{
+		Total:   b.total,
+		ByDay:   groups(b.byDay),
+		ByAgent: groups(b.byAgent),
+		ByModel: groups(b.byModel),
+	}
+}
+
+func addTo(m map[string]Totals, key string, totals Totals) {
+	t := m[key]
+	t.add(totals)
+	m[key] = t
+}
+
+func groups(m map[string]Totals) []Group {
+	result := make([]Group, 0, len(m))
+	for key, totals := range m {
+		result = append(result, Group{
+			Key:    key,
+			Totals: totals,
+		})
+	}
+	slices.SortFunc(result, func(a, b Group) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return result
+}
+
+// SessionTotals returns the usage recorded in the ledger of the session, or nil if there is none.
+func SessionTotals(session *mcp.Session) *Totals {
+	var ledger Ledger
+	if session == nil || !session.Get(SessionKey, &ledger) || len(ledger.Entries) == 0 {
+		return nil
+	}
+	total := NewReport(Filter{}, ledger).Total
+	return &total
+}
+
+type counterKey struct{}
+
+// Counter adds up the tokens of the completions made with a context returned by WithCounter.
+type Counter struct {
+	lock   sync.Mutex
+	tokens int
+}
+
+func (c *Counter) add(u *types.Usage) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.tokens += u.TotalTokens()
+}
+
+// Tokens returns the input and output tokens counted so far.
+func (c *Counter) Tokens() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.tokens
+}
+
+// WithCounter returns a context that counts the tokens of its completions, including those of the
+// agents and tools they call, in counter.
+func WithCounter(ctx context.Context, counter *Counter) context.Context {
+	return context.WithValue(ctx, counterKey{}, counter)
+}
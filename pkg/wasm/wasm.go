@@ -0,0 +1,219 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+const (
+	pageSize = 64 * 1024
+	// maxPages is the 4GiB limit of 32-bit memories.
+	maxPages = 65536
+	// maxOutput limits the stdout and stderr kept of a module, the rest of the output is dropped.
+	maxOutput = 1024 * 1024
+)
+
+// Runtime runs WebAssembly modules as WASI commands. Modules are compiled once and recompiled when
+// their file changes. Modules have no filesystem and no network, they only get their stdin, env, and
+// clocks.
+type Runtime struct {
+	lock     sync.Mutex
+	cache    wazero.CompilationCache
+	runtimes map[uint32]wazero.Runtime
+	modules  map[moduleKey]wazero.CompiledModule
+}
+
+type moduleKey struct {
+	path    string
+	pages   uint32
+	modTime time.Time
+	size    int64
+}
+
+type RunOptions struct {
+	// Name is argv[0] of the module.
+	Name      string
+	Env       map[string]string
+	Stdin     []byte
+	Timeout   time.Duration
+	MaxMemory uint64
+}
+
+// ExitError is returned when the module exits with a non-zero code.
+type ExitError struct {
+	Code   uint32
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("module exited with code %d", e.Code)
+	}
+	return fmt.Sprintf("module exited with code %d: %s", e.Code, e.Stderr)
+}
+
+func NewRuntime() *Runtime {
+	return &Runtime{
+		cache:    wazero.NewCompilationCache(),
+		runtimes: map[uint32]wazero.Runtime{},
+		modules:  map[moduleKey]wazero.CompiledModule{},
+	}
+}
+
+// runtime returns the runtime of modules with the memory limit, the limit is a setting of the runtime in wazero.
+func (r *Runtime) runtime(ctx context.Context, pages uint32) (wazero.Runtime, error) {
+	if rt, ok := r.runtimes[pages]; ok {
+		return rt, nil
+	}
+
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCompilationCache(r.cache).
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(pages))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		_ = rt.Close(ctx)
+		return nil, fmt.Errorf("failed to instantiate WASI: %w", err)
+	}
+	r.runtimes[pages] = rt
+	return rt, nil
+}
+
+func (r *Runtime) compile(ctx context.Context, path string, pages uint32) (wazero.Runtime, wazero.CompiledModule, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read module %s: %w", path, err)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rt, err := r.runtime(ctx, pages)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := moduleKey{
+		path:    path,
+		pages:   pages,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+	if compiled, ok := r.modules[key]; ok {
+		return rt, compiled, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read module %s: %w", path, err)
+	}
+	compiled, err := rt.CompileModule(ctx, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compile module %s: %w", path, err)
+	}
+
+	// Drop the previous versions of the module
+	for k, old := range r.modules {
+		if k.path == path && k.pages == pages {
+			_ = old.Close(ctx)
+			delete(r.modules, k)
+		}
+	}
+	r.modules[key] = compiled
+	return rt, compiled, nil
+}
+
+// Run runs the module at path and returns what it wrote to stdout.
+func (r *Runtime) Run(ctx context.Context, path string, opts RunOptions) ([]byte, error) {
+	pages := uint32(min(max(opts.MaxMemory/pageSize, 1), maxPages))
+	rt, compiled, err := r.compile(ctx, path, pages)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	stdout := &limitedBuffer{limit: maxOutput}
+	stderr := &limitedBuffer{limit: maxOutput}
+	config := wazero.NewModuleConfig().
+		// Anonymous modules can run concurrently
+		WithName("").
+		WithArgs(opts.Name).
+		WithStdin(bytes.NewReader(opts.Stdin)).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep().
+		WithRandSource(rand.Reader)
+	for k, v := range opts.Env {
+		config = config.WithEnv(k, v)
+	}
+
+	mod, err := rt.InstantiateModule(ctx, compiled, config)
+	if mod != nil {
+		defer mod.Close(context.WithoutCancel(ctx))
+	}
+
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.ExitCode() == 0 {
+			return stdout.output(path)
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("module %s did not finish within %s", path, opts.Timeout)
+		}
+		return nil, &ExitError{
+			Code:   exitErr.ExitCode(),
+			Stderr: strings.TrimSpace(stderr.String()),
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to run module %s: %w", path, err)
+	}
+
+	return stdout.output(path)
+}
+
+// limitedBuffer keeps the first limit bytes written to it.
+type limitedBuffer struct {
+	data      []byte
+	limit     int
+	truncated bool
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := l.limit - len(l.data); remaining < len(p) {
+		l.data = append(l.data, p[:max(remaining, 0)]...)
+		l.truncated = true
+	} else {
+		l.data = append(l.data, p...)
+	}
+	return len(p), nil
+}
+
+func (l *limitedBuffer) String() string {
+	return string(l.data)
+}
+
+// output returns the stdout of the module, it fails if the output was truncated because a partial
+// result can not be parsed.
+func (l *limitedBuffer) output(path string) ([]byte, error) {
+	if l.truncated {
+		return nil, fmt.Errorf("module %s wrote more than %d bytes to stdout", path, l.limit)
+	}
+	return l.data, nil
+}
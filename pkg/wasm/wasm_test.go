@@ -0,0 +1,108 @@
+package wasm
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildModule compiles the Go program to a WASI module.
+func buildModule(t *testing.T, program string) string {
+	t.Helper()
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is needed to build the test module")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(program), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "module.wasm")
+	cmd := exec.Command(goBin, "build", "-o", path, "main.go")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm", "GO111MODULE=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build module: %v: %s", err, out)
+	}
+	return path
+}
+
+func TestRunLimitsOutput(t *testing.T) {
+	path := buildModule(t, `package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+func main() {
+	input, _ := io.ReadAll(os.Stdin)
+	chunk := []byte(strings.Repeat("x", 64*1024))
+	switch string(input) {
+	case "stdout":
+		for range 64 {
+			os.Stdout.Write(chunk)
+		}
+	case "stderr":
+		for range 64 {
+			os.Stderr.Write(chunk)
+		}
+		os.Exit(1)
+	default:
+		os.Stdout.Write(input)
+	}
+}
+`)
+	r := NewRuntime()
+
+	tests := []struct {
+		name   string
+		stdin  string
+		output string
+		err    bool
+		stderr int
+	}{
+		{name: "small output", stdin: "hello", output: "hello"},
+		{name: "too much stdout", stdin: "stdout", err: true},
+		{name: "too much stderr", stdin: "stderr", err: true, stderr: maxOutput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := r.Run(t.Context(), path, RunOptions{
+				Name:      "test",
+				Stdin:     []byte(tt.stdin),
+				Timeout:   time.Minute,
+				MaxMemory: 64 * 1024 * 1024,
+			})
+			if !tt.err {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(output) != tt.output {
+					t.Errorf("expected output %q, got %q", tt.output, output)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error, got %d bytes of output", len(output))
+			}
+			var exitErr *ExitError
+			if tt.stderr > 0 {
+				if !errors.As(err, &exitErr) {
+					t.Fatalf("expected an exit error, got %v", err)
+				}
+				if len(exitErr.Stderr) != tt.stderr || strings.Trim(exitErr.Stderr, "x") != "" {
+					t.Errorf("expected %d bytes of stderr, got %d", tt.stderr, len(exitErr.Stderr))
+				}
+			} else if errors.As(err, &exitErr) {
+				t.Errorf("expected the output limit error, got %v", err)
+			}
+		})
+	}
+}
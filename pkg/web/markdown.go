@@ -0,0 +1,314 @@
+package web
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// skipped are the elements that have no content for the model.
+var skipped = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true, "canvas": true,
+	"iframe": true, "object": true, "embed": true, "button": true, "select": true, "input": true, "textarea": true,
+}
+
+// blocks are the elements that start a new paragraph.
+var blocks = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "header": true, "footer": true,
+	"nav": true, "aside": true, "figure": true, "figcaption": true, "dl": true, "dt": true, "dd": true,
+	"form": true, "fieldset": true, "details": true, "summary": true, "address": true,
+}
+
+// markdown returns the title and the content of the HTML document as markdown, links and images are
+// resolved against the base URL. The content is the main element of the document if it has one.
+func markdown(doc *html.Node, base *url.URL) (title, content string) {
+	if n := find(doc, "title"); n != nil {
+		title = strings.Join(strings.Fields(textContent(n)), " ")
+	}
+	if n := find(doc, "base"); n != nil && attr(n, "href") != "" {
+		if href, err := base.Parse(attr(n, "href")); err == nil {
+			base = href
+		}
+	}
+
+	root := find(doc, "main")
+	if root == nil {
+		root = find(doc, "body")
+	}
+	if root == nil {
+		root = doc
+	}
+
+	c := converter{base: base}
+	return title, c.render(root)
+}
+
+type converter struct {
+	base *url.URL
+}
+
+// render returns the children of the node as markdown.
+func (c converter) render(n *html.Node) string {
+	var buf strings.Builder
+	for child := range n.ChildNodes() {
+		c.write(&buf, child)
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(buf.String(), "\n\n"))
+}
+
+// renderInline returns the children of the node as markdown on one line.
+func (c converter) renderInline(n *html.Node) string {
+	return strings.Join(strings.Fields(c.render(n)), " ")
+}
+
+func (c converter) write(buf *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		text := n.Data
+		if strings.TrimSpace(text) == "" {
+			if buf.Len() > 0 && !endsWithSpace(buf.String()) {
+				buf.WriteString(" ")
+			}
+			return
+		}
+		if startsWithSpace(text) && buf.Len() > 0 && !endsWithSpace(buf.String()) {
+			buf.WriteString(" ")
+		}
+		buf.WriteString(strings.Join(strings.Fields(text), " "))
+		if endsWithSpace(text) {
+			buf.WriteString(" ")
+		}
+		return
+	case html.ElementNode:
+	default:
+		for child := range n.ChildNodes() {
+			c.write(buf, child)
+		}
+		return
+	}
+
+	if skipped[n.Data] || hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" {
+		return
+	}
+
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		if text := c.renderInline(n); text != "" {
+			paragraph(buf, strings.Repeat("#", int(n.Data[1]-'0'))+" "+text)
+		}
+	case "br":
+		buf.WriteString("\n")
+	case "hr":
+		paragraph(buf, "---")
+	case "a":
+		text := c.renderInline(n)
+		href := c.resolve(attr(n, "href"))
+		switch {
+		case text == "":
+		case href == "":
+			buf.WriteString(text)
+		default:
+			fmt.Fprintf(buf, "[%s](%s)", text, href)
+		}
+	case "img":
+		if src := c.resolve(attr(n, "src")); src != "" {
+			fmt.Fprintf(buf, "![%s](%s)", strings.Join(strings.Fields(attr(n, "alt")), " "), src)
+		}
+	case "strong", "b":
+		if text := c.renderInline(n); text != "" {
+			buf.WriteString("**" + text + "**")
+		}
+	case "em", "i":
+		if text := c.renderInline(n); text != "" {
+			buf.WriteString("*" + text + "*")
+		}
+	case "code", "kbd", "samp":
+		if text := textContent(n); strings.TrimSpace(text) != "" {
+			buf.WriteString("`" + strings.Join(strings.Fields(text), " ") + "`")
+		}
+	case "pre":
+		language := ""
+		if code := find(n, "code"); code != nil {
+			for _, class := range strings.Fields(attr(code, "class")) {
+				if strings.HasPrefix(class, "language-") {
+					language = strings.TrimPrefix(class, "language-")
+				}
+			}
+		}
+		paragraph(buf, "```"+language+"\n"+strings.Trim(textContent(n), "\n")+"\n```")
+	case "blockquote":
+		if text := c.render(n); text != "" {
+			paragraph(buf, prefixLines(text, "> ", "> "))
+		}
+	case "ul", "ol":
+		paragraph(buf, c.list(n))
+	case "table":
+		paragraph(buf, c.table(n))
+	default:
+		if blocks[n.Data] {
+			if text := c.render(n); text != "" {
+				paragraph(buf, text)
+			}
+			return
+		}
+		for child := range n.ChildNodes() {
+			c.write(buf, child)
+		}
+	}
+}
+
+// list returns the items of the list, the items of nested lists are indented.
+func (c converter) list(n *html.Node) string {
+	var (
+		items   []string
+		ordered = n.Data == "ol"
+	)
+	for child := range n.ChildNodes() {
+		if child.Type != html.ElementNode || child.Data != "li" {
+			continue
+		}
+		text := c.render(child)
+		if text == "" {
+			continue
+		}
+		marker := "- "
+		if ordered {
+			marker = fmt.Sprintf("%d. ", len(items)+1)
+		}
+		items = append(items, prefixLines(text, marker, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// table returns the rows of the table, the first row is the header.
+func (c converter) table(n *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := range n.ChildNodes() {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.Data {
+			case "tr":
+				var row []string
+				for cell := range child.ChildNodes() {
+					if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+						row = append(row, strings.ReplaceAll(c.renderInline(cell), "|", `\|`))
+					}
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			case "thead", "tbody", "tfoot":
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	var buf strings.Builder
+	for i, row := range rows {
+		row = append(row, make([]string, columns-len(row))...)
+		buf.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			buf.WriteString(strings.Repeat("| --- ", columns) + "|\n")
+		}
+	}
+	return buf.String()
+}
+
+// resolve returns the absolute URL of the reference, or "" if it is not a link to a page.
+func (c converter) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return ""
+	}
+	u, err := c.base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "mailto") {
+		return ""
+	}
+	return u.String()
+}
+
+// paragraph writes the text separated by blank lines from the content around it.
+func paragraph(buf *strings.Builder, text string) {
+	if text == "" {
+		return
+	}
+	buf.WriteString("\n\n")
+	buf.WriteString(text)
+	buf.WriteString("\n\n")
+}
+
+func prefixLines(text, first, rest string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = first + line
+		case line == "":
+			lines[i] = strings.TrimRight(rest, " ")
+		default:
+			lines[i] = rest + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func find(n *html.Node, name string) *html.Node {
+	for d := range n.Descendants() {
+		if d.Type == html.ElementNode && d.Data == name {
+			return d
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, name string) bool {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+func textContent(n *html.Node) string {
+	var buf strings.Builder
+	for d := range n.Descendants() {
+		if d.Type == html.TextNode {
+			buf.WriteString(d.Data)
+		}
+	}
+	return buf.String()
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.ContainsAny(s[len(s)-1:], " \t\n\r\f")
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.ContainsAny(s[:1], " \t\n\r\f")
+}
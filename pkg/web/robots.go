@@ -0,0 +1,203 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// robotsTTL is how long the robots.txt of a site is cached.
+	robotsTTL = time.Hour
+	// maxRobotsSize is the part of a robots.txt that is read, as allowed by RFC 9309.
+	maxRobotsSize = 500 * 1024
+)
+
+var (
+	robotsLock  sync.Mutex
+	robotsCache = map[string]cachedRobots{}
+)
+
+type cachedRobots struct {
+	rules   *robots
+	expires time.Time
+}
+
+// robots are the rules of a robots.txt that apply to the user agent. A nil robots allows all paths.
+type robots struct {
+	disallowAll bool
+	rules       []robotsRule
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// allowed returns whether the robots.txt of the site of the URL allows the user agent to fetch it.
+func allowed(ctx context.Context, client *http.Client, userAgent string, u *url.URL) (bool, error) {
+	origin := u.Scheme + "://" + u.Host
+
+	robotsLock.Lock()
+	cached, ok := robotsCache[origin+" "+userAgent]
+	robotsLock.Unlock()
+
+	if !ok || time.Now().After(cached.expires) {
+		rules, err := fetchRobots(ctx, client, userAgent, origin)
+		if err != nil {
+			return false, err
+		}
+		cached = cachedRobots{
+			rules:   rules,
+			expires: time.Now().Add(robotsTTL),
+		}
+		robotsLock.Lock()
+		robotsCache[origin+" "+userAgent] = cached
+		robotsLock.Unlock()
+	}
+
+	return cached.rules.allows(u.EscapedPath() + queryOf(u)), nil
+}
+
+// fetchRobots returns the rules of the robots.txt of the origin. As in RFC 9309 all paths are allowed if
+// the site has no robots.txt, and no paths are allowed if the site fails to return it.
+func fetchRobots(ctx context.Context, client *http.Client, userAgent, origin string) (*robots, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch robots.txt of %s: %w", origin, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseRobots(io.LimitReader(resp.Body, maxRobotsSize), userAgent), nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return nil, nil
+	default:
+		return &robots{disallowAll: true}, nil
+	}
+}
+
+// parseRobots returns the rules of the groups of the robots.txt that match the product token of the user
+// agent, or the rules of the * groups if no group matches.
+func parseRobots(r io.Reader, userAgent string) *robots {
+	token, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(userAgent)), "/")
+	token, _, _ = strings.Cut(token, " ")
+
+	var (
+		matched, wildcard []robotsRule
+		hasMatched        bool
+		// agents are the user agents of the current group, inRules is true once the group has rules
+		agents  []string
+		inRules bool
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", pattern: value}
+			for _, agent := range agents {
+				switch agent {
+				case token:
+					hasMatched = true
+					matched = append(matched, rule)
+				case "*":
+					wildcard = append(wildcard, rule)
+				}
+			}
+		}
+	}
+
+	if hasMatched {
+		return &robots{rules: matched}
+	}
+	return &robots{rules: wildcard}
+}
+
+// allows returns whether the path is allowed, the longest matching rule wins and allow rules win ties.
+func (r *robots) allows(path string) bool {
+	if r == nil {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	var (
+		result  = true
+		longest = -1
+	)
+	for _, rule := range r.rules {
+		if !matchRobots(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			longest = len(rule.pattern)
+			result = rule.allow
+		}
+	}
+	return result
+}
+
+// matchRobots returns whether the pattern matches the start of the path, * matches any characters and
+// a $ at the end of the pattern matches the end of the path.
+func matchRobots(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		index := strings.Index(rest, part)
+		if index < 0 {
+			return false
+		}
+		rest = rest[index+len(part):]
+	}
+	return !anchored || rest == ""
+}
+
+func queryOf(u *url.URL) string {
+	if u.RawQuery == "" {
+		return ""
+	}
+	return "?" + u.RawQuery
+}
@@ -0,0 +1,180 @@
+package web
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nanobot-ai/nanobot/pkg/envvar"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const (
+	braveURL  = "https://api.search.brave.com/res/v1/web/search"
+	tavilyURL = "https://api.tavily.com/search"
+	// maxSearchResults limits the count of a search call.
+	maxSearchResults = 20
+)
+
+// apiKeys are the environment variables the API keys of the providers default to.
+var apiKeys = map[string]string{
+	types.WebSearchBrave:  "BRAVE_API_KEY",
+	types.WebSearchTavily: "TAVILY_API_KEY",
+}
+
+// SearchArgs are the arguments of a web_search tool call.
+type SearchArgs struct {
+	Query string `json:"query"`
+	Count int    `json:"count,omitempty"`
+}
+
+type SearchResult struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// Search returns the results of the query from the search provider of the config.
+func Search(ctx context.Context, config types.Web, args SearchArgs) ([]SearchResult, error) {
+	if config.Search == nil {
+		return nil, fmt.Errorf("web search is not configured")
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+
+	var (
+		search = *config.Search
+		count  = min(cmp.Or(max(args.Count, 0), search.GetMaxResults()), maxSearchResults)
+		client = &http.Client{Timeout: config.GetTimeout()}
+		apiKey string
+	)
+	if envKey, ok := apiKeys[search.Provider]; ok {
+		env := mcp.SessionFromContext(ctx).GetEnvMap()
+		apiKey = env[envKey]
+		if search.APIKey != "" {
+			apiKey = envvar.ReplaceString(ctx, env, search.APIKey)
+		}
+		if apiKey == "" {
+			return nil, fmt.Errorf("no API key for %s search, set the apiKey of web search or %s", search.Provider, envKey)
+		}
+	}
+
+	var (
+		req *http.Request
+		err error
+	)
+	switch search.Provider {
+	case types.WebSearchBrave:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, braveURL+"?"+url.Values{
+			"q":     {args.Query},
+			"count": {strconv.Itoa(count)},
+		}.Encode(), nil)
+		if err == nil {
+			req.Header.Set("X-Subscription-Token", apiKey)
+		}
+	case types.WebSearchTavily:
+		body, _ := json.Marshal(map[string]any{
+			"query":       args.Query,
+			"max_results": count,
+		})
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, tavilyURL, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+			req.Header.Set("Content-Type", "application/json")
+		}
+	case types.WebSearchSearXNG:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(search.URL, "/")+"/search?"+url.Values{
+			"q":      {args.Query},
+			"format": {"json"},
+		}.Encode(), nil)
+	default:
+		return nil, fmt.Errorf("unsupported web search provider %q", search.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", config.GetUserAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search with %s: %w", search.Provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("failed to search with %s: %s: %s", search.Provider, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var data struct {
+		// Results of tavily and searxng
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+		// Results of brave
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode results of %s: %w", search.Provider, err)
+	}
+
+	var results []SearchResult
+	for _, result := range data.Results {
+		results = append(results, SearchResult{Title: result.Title, URL: result.URL, Snippet: result.Content})
+	}
+	for _, result := range data.Web.Results {
+		results = append(results, SearchResult{Title: result.Title, URL: result.URL, Snippet: result.Description})
+	}
+	for i := range results {
+		results[i].Snippet = strings.Join(strings.Fields(stripTags(results[i].Snippet)), " ")
+	}
+	if len(results) > count {
+		results = results[:count]
+	}
+	return results, nil
+}
+
+// FormatResults returns the results as the text of the tool call result.
+func FormatResults(results []SearchResult) string {
+	if len(results) == 0 {
+		return "No results found."
+	}
+	var text strings.Builder
+	for i, result := range results {
+		if i > 0 {
+			text.WriteString("\n\n")
+		}
+		fmt.Fprintf(&text, "%d. [%s](%s)", i+1, result.Title, result.URL)
+		if result.Snippet != "" {
+			text.WriteString("\n   ")
+			text.WriteString(result.Snippet)
+		}
+	}
+	return text.String()
+}
+
+// stripTags removes the highlighting markup of the snippets of brave.
+func stripTags(s string) string {
+	for _, tag := range []string{"<strong>", "</strong>", "<b>", "</b>", "<em>", "</em>"} {
+		s = strings.ReplaceAll(s, tag, "")
+	}
+	return s
+}
@@ -0,0 +1,299 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/egress"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// The names of the tools, and the target names of their tool mappings.
+const (
+	FetchTool  = "web_fetch"
+	SearchTool = "web_search"
+)
+
+// maxRedirects is the number of redirects followed before a fetch fails.
+const maxRedirects = 10
+
+// FetchArgs are the arguments of a web_fetch tool call.
+type FetchArgs struct {
+	URL   string `json:"url"`
+	Start int    `json:"start,omitempty"`
+}
+
+// Page is a fetched page, Content is the part of the page from Start to End, of Length characters.
+type Page struct {
+	URL         string `json:"url"`
+	Status      int    `json:"status"`
+	Title       string `json:"title,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Content     string `json:"content"`
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Length      int    `json:"length"`
+	// Redirect is the location of a redirect the redirect policy did not follow.
+	Redirect string `json:"redirect,omitempty"`
+	// Truncated is true if the response was larger than the max size and only its start was read.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ToolMappings returns the web_fetch tool of the agent if it has web, and the web_search tool if it also
+// has a search provider.
+func ToolMappings(agentName string, config *types.Web) types.ToolMappings {
+	result := types.ToolMappings{}
+	if config == nil {
+		return result
+	}
+
+	result[FetchTool] = types.TargetMapping[mcp.Tool]{
+		MCPServer:  agentName,
+		TargetName: FetchTool,
+		Target: mcp.Tool{
+			Name: FetchTool,
+			Description: fmt.Sprintf("Fetch a web page and return it as markdown. Pages longer than %d characters are returned "+
+				"in parts, fetch the next part with start.", config.GetMaxLength()),
+			InputSchema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "url": {
+      "type": "string",
+      "description": "The http or https URL of the page"
+    },
+    "start": {
+      "type": "integer",
+      "minimum": 0,
+      "description": "The character of the page to start at, 0 to fetch the start of the page"
+    }
+  },
+  "required": ["url"]
+}`),
+		},
+	}
+
+	if config.Search != nil {
+		result[SearchTool] = types.TargetMapping[mcp.Tool]{
+			MCPServer:  agentName,
+			TargetName: SearchTool,
+			Target: mcp.Tool{
+				Name:        SearchTool,
+				Description: "Search the web and return the title, URL, and a snippet of each result. Fetch the results with " + FetchTool + " to read them.",
+				InputSchema: json.RawMessage(fmt.Sprintf(`{
+  "type": "object",
+  "properties": {
+    "query": {
+      "type": "string",
+      "description": "The search query"
+    },
+    "count": {
+      "type": "integer",
+      "minimum": 1,
+      "maximum": 20,
+      "description": "The number of results, defaults to %d"
+    }
+  },
+  "required": ["query"]
+}`, config.Search.GetMaxResults())),
+			},
+		}
+	}
+	return result
+}
+
+// Fetch fetches the page of the URL from the hosts the egress policy of the config allows, following the
+// redirects its redirect policy allows. A same-origin redirect policy also follows redirects from http to
+// https on the same host.
+func Fetch(ctx context.Context, config types.Web, args FetchArgs) (*Page, error) {
+	u, err := url.Parse(strings.TrimSpace(args.URL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", args.URL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q, must be an http or https URL", args.URL)
+	}
+	u.Fragment = ""
+
+	egressConfig := config.GetEgress()
+	policy, err := egress.NewPolicy(egressConfig.Allow, egressConfig.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.GetTimeout())
+	defer cancel()
+
+	// The environment's proxy is not used, the egress policy applies to the host of the page
+	transport := &http.Transport{
+		DialContext:         policy.DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	defer transport.CloseIdleConnections()
+
+	var (
+		userAgent    = config.GetUserAgent()
+		robotsClient = &http.Client{Transport: transport}
+		client       = &http.Client{
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+				switch config.GetRedirects() {
+				case types.WebRedirectsNone:
+					return http.ErrUseLastResponse
+				case types.WebRedirectsSameOrigin:
+					from := via[len(via)-1].URL
+					if req.URL.Host != from.Host || (req.URL.Scheme != from.Scheme && req.URL.Scheme != "https") {
+						return http.ErrUseLastResponse
+					}
+				}
+				return checkRobots(req.Context(), config, robotsClient, req.URL)
+			},
+		}
+	)
+
+	if err := checkRobots(ctx, config, robotsClient, u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/markdown,text/plain;q=0.9,*/*;q=0.8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if deniedErr := (*egress.DeniedError)(nil); errors.As(err, &deniedErr) {
+			return nil, deniedErr
+		}
+		return nil, fmt.Errorf("failed to fetch %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	page := &Page{
+		URL:    resp.Request.URL.String(),
+		Status: resp.StatusCode,
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if location, err := resp.Location(); err == nil {
+			page.Redirect = location.String()
+			return page, nil
+		}
+	}
+
+	maxSize := config.GetMaxSize()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", page.URL, err)
+	}
+	if int64(len(data)) > maxSize {
+		data = data[:maxSize]
+		page.Truncated = true
+	}
+
+	content, err := convert(page, resp.Request.URL, resp.Header.Get("Content-Type"), data)
+	if err != nil {
+		return nil, err
+	}
+
+	runes := []rune(content)
+	page.Length = len(runes)
+	page.Start = min(max(args.Start, 0), page.Length)
+	page.End = min(page.Start+config.GetMaxLength(), page.Length)
+	page.Content = string(runes[page.Start:page.End])
+	return page, nil
+}
+
+// convert returns the response as text, HTML is converted to markdown.
+func convert(page *Page, base *url.URL, contentType string, data []byte) (string, error) {
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		contentType = http.DetectContentType(data)
+		mediaType, _, _ = mime.ParseMediaType(contentType)
+	}
+	page.ContentType = mediaType
+
+	r, err := charset.NewReader(bytes.NewReader(data), contentType)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", page.URL, err)
+	}
+
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		doc, err := html.Parse(r)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", page.URL, err)
+		}
+		var content string
+		page.Title, content = markdown(doc, base)
+		return content, nil
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/json", mediaType == "application/xml",
+		mediaType == "application/javascript", strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		text, err := io.ReadAll(r)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode %s: %w", page.URL, err)
+		}
+		return string(text), nil
+	default:
+		return "", fmt.Errorf("unsupported content type %s of %s, only HTML and text are supported", mediaType, page.URL)
+	}
+}
+
+func checkRobots(ctx context.Context, config types.Web, client *http.Client, u *url.URL) error {
+	if config.IgnoreRobots {
+		return nil
+	}
+	ok, err := allowed(ctx, client, config.GetUserAgent(), u)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("the robots.txt of %s disallows fetching %s", u.Host, u)
+	}
+	return nil
+}
+
+// FormatPage returns the page as the text of the tool call result.
+func FormatPage(page *Page, redirects string) string {
+	var text strings.Builder
+	if page.Title != "" {
+		fmt.Fprintf(&text, "Title: %s\n", page.Title)
+	}
+	fmt.Fprintf(&text, "URL: %s\n", page.URL)
+	if page.Status >= 300 {
+		fmt.Fprintf(&text, "Status: %d %s\n", page.Status, http.StatusText(page.Status))
+	}
+	if page.Redirect != "" {
+		fmt.Fprintf(&text, "\nThe page redirects to %s, which the %s redirect policy does not follow. Fetch it to follow the redirect.", page.Redirect, redirects)
+		return text.String()
+	}
+
+	text.WriteString("\n")
+	text.WriteString(page.Content)
+	if page.End < page.Length {
+		fmt.Fprintf(&text, "\n\n[showing characters %d to %d of %d, fetch with start %d for more]", page.Start, page.End, page.Length, page.End)
+	}
+	if page.Truncated {
+		text.WriteString("\n\n[the page is larger than the max size, only its start was read]")
+	}
+	return text.String()
+}
@@ -0,0 +1,269 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/expr"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/tools"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const (
+	// PathPrefix is the path webhooks are served under, followed by the name of the webhook.
+	PathPrefix = "/webhooks/"
+
+	defaultSignatureHeader = "X-Hub-Signature-256"
+	maxBodySize            = 10 << 20
+	// sessionIdleTimeout is how long a keyed session is kept without receiving payloads.
+	sessionIdleTimeout = 24 * time.Hour
+)
+
+type Caller interface {
+	Call(ctx context.Context, server, tool string, args any, opts ...tools.CallOptions) (*types.CallResult, error)
+}
+
+type Response struct {
+	Webhook string `json:"webhook"`
+	Agent   string `json:"agent"`
+	Session string `json:"session,omitempty"`
+	Status  string `json:"status"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type keyedSession struct {
+	session  *mcp.Session
+	lastUsed time.Time
+	// lock keeps payloads for the same session from running at the same time.
+	lock sync.Mutex
+}
+
+// Handler runs the agent of a webhook for each payload POSTed to PathPrefix + name.
+type Handler struct {
+	ctx        context.Context
+	webhooks   map[string]types.Webhook
+	caller     Caller
+	newSession func(context.Context) context.Context
+
+	sessionsLock sync.Mutex
+	sessions     map[string]*keyedSession
+}
+
+// NewHandler returns the handler for the webhooks of the config. Async runs and keyed sessions use ctx,
+// which should be canceled when the server stops. newSession returns a context with a new session. A
+// configured secret that is empty or refers to an unset environment variable is an error, the webhook
+// would otherwise accept unsigned payloads or ones signed with the literal expression.
+func NewHandler(ctx context.Context, config types.Config, env map[string]string, caller Caller, newSession func(context.Context) context.Context) (*Handler, error) {
+	webhooks := make(map[string]types.Webhook, len(config.Webhooks))
+	for name, webhook := range config.Webhooks {
+		// Only the secret refers to environment variables, the prompt and session are evaluated per request.
+		if webhook.Secret != "" {
+			secret, err := expr.EvalString(ctx, env, nil, webhook.Secret)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate secret of webhook %s: %w", name, err)
+			}
+			if strings.TrimSpace(secret) == "" {
+				return nil, fmt.Errorf("secret of webhook %s is empty", name)
+			}
+			webhook.Secret = secret
+		}
+		webhooks[name] = webhook
+	}
+	return &Handler{
+		ctx:        ctx,
+		webhooks:   webhooks,
+		caller:     caller,
+		newSession: newSession,
+		sessions:   map[string]*keyedSession{},
+	}, nil
+}
+
+// PublicPaths returns the paths of the webhooks that verify signatures, so they can be called without
+// other credentials.
+func (h *Handler) PublicPaths() (result []string) {
+	for name, webhook := range h.webhooks {
+		if webhook.Secret != "" {
+			result = append(result, PathPrefix+name)
+		}
+	}
+	return
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	name := req.PathValue("name")
+	webhook, ok := h.webhooks[name]
+	if !ok {
+		http.Error(rw, fmt.Sprintf("webhook %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBodySize))
+	if err != nil {
+		http.Error(rw, "failed to read body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if webhook.Secret != "" && !verifySignature(webhook, req.Header, body) {
+		http.Error(rw, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	data := requestData(req, body)
+
+	prompt, err := expr.EvalString(req.Context(), nil, data, webhook.Prompt)
+	if err != nil {
+		http.Error(rw, "failed to evaluate prompt: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var sessionKey string
+	if webhook.Session != "" {
+		key, err := expr.EvalAny(req.Context(), nil, data, webhook.Session)
+		if err != nil {
+			http.Error(rw, "failed to evaluate session: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if key != nil {
+			sessionKey = fmt.Sprint(key)
+		}
+	}
+
+	resp := Response{
+		Webhook: name,
+		Agent:   webhook.Agent,
+		Session: sessionKey,
+	}
+
+	if webhook.Async {
+		go h.run(h.ctx, name, webhook, sessionKey, prompt)
+		resp.Status = "accepted"
+		writeJSON(req.Context(), rw, http.StatusAccepted, resp)
+		return
+	}
+
+	resp.Output, err = h.run(req.Context(), name, webhook, sessionKey, prompt)
+	if err != nil {
+		resp.Status = "error"
+		resp.Error = err.Error()
+		writeJSON(req.Context(), rw, http.StatusBadGateway, resp)
+		return
+	}
+	resp.Status = "completed"
+	writeJSON(req.Context(), rw, http.StatusOK, resp)
+}
+
+func (h *Handler) run(ctx context.Context, name string, webhook types.Webhook, sessionKey, prompt string) (string, error) {
+	if sessionKey == "" {
+		ctx = h.newSession(ctx)
+	} else {
+		keyed := h.session(name, sessionKey)
+		keyed.lock.Lock()
+		defer keyed.lock.Unlock()
+		ctx = mcp.WithSession(ctx, keyed.session)
+	}
+
+	result, err := h.caller.Call(ctx, webhook.Agent, webhook.Agent, types.SampleCallRequest{
+		Prompt: prompt,
+	})
+	if err != nil {
+		log.Errorf(ctx, "webhook %s failed: %v", name, err)
+		return "", err
+	}
+
+	output := result.Text()
+	if result.IsError {
+		log.Errorf(ctx, "webhook %s failed: %s", name, output)
+		return "", fmt.Errorf("agent %s returned an error: %s", webhook.Agent, output)
+	}
+	return output, nil
+}
+
+// session returns the session for the key, creating it if needed, and drops sessions that have been
+// idle for too long.
+func (h *Handler) session(name, key string) *keyedSession {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	now := time.Now()
+	for k, s := range h.sessions {
+		// Sessions with a payload running are in use even if they were not used recently.
+		if now.Sub(s.lastUsed) > sessionIdleTimeout && s.lock.TryLock() {
+			s.session.Close(false)
+			delete(h.sessions, k)
+			s.lock.Unlock()
+		}
+	}
+
+	id := name + "/" + key
+	s, ok := h.sessions[id]
+	if !ok {
+		s = &keyedSession{
+			session: mcp.SessionFromContext(h.newSession(h.ctx)),
+		}
+		h.sessions[id] = s
+	}
+	s.lastUsed = now
+	return s
+}
+
+// verifySignature checks the hex encoded HMAC-SHA256 of the body, optionally prefixed with "sha256=" like
+// GitHub sends it.
+func verifySignature(webhook types.Webhook, header http.Header, body []byte) bool {
+	headerName := webhook.SignatureHeader
+	if headerName == "" {
+		headerName = defaultSignatureHeader
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(header.Get(headerName), "sha256="))
+	if err != nil || len(signature) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write(body)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+func requestData(req *http.Request, body []byte) map[string]any {
+	var parsed any
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		parsed = string(body)
+	}
+
+	headers := map[string]any{}
+	for k := range req.Header {
+		headers[strings.ToLower(k)] = req.Header.Get(k)
+	}
+
+	query := map[string]any{}
+	for k := range req.URL.Query() {
+		query[k] = req.URL.Query().Get(k)
+	}
+
+	return map[string]any{
+		"webhook": req.PathValue("name"),
+		"body":    parsed,
+		"headers": headers,
+		"query":   query,
+	}
+}
+
+func writeJSON(ctx context.Context, rw http.ResponseWriter, status int, obj any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(obj); err != nil {
+		log.Errorf(ctx, "failed to write webhook response: %v", err)
+	}
+}
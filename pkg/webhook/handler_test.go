@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestNewHandlerSecrets(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		env    map[string]string
+		err    string
+	}{
+		{name: "literal", secret: "s3cret"},
+		{name: "env", secret: "${SECRET}", env: map[string]string{"SECRET": "s3cret"}},
+		{name: "no secret"},
+		{name: "empty env", secret: "${SECRET}", env: map[string]string{"SECRET": ""}, err: "secret of webhook hook is empty"},
+		{name: "unset env", secret: "${SECRET}", err: "failed to evaluate secret of webhook hook"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := types.Config{
+				Webhooks: map[string]types.Webhook{
+					"hook": {Agent: "agent1", Secret: tt.secret},
+				},
+			}
+			h, err := NewHandler(context.Background(), config, tt.env, nil, nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var expected []string
+			if tt.secret != "" {
+				expected = []string{PathPrefix + "hook"}
+			}
+			if paths := h.PublicPaths(); !reflect.DeepEqual(paths, expected) {
+				t.Errorf("expected public paths %v, got %v", expected, paths)
+			}
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	webhook := types.Webhook{Secret: "s3cret"}
+	body := `{"action": "opened"}`
+
+	tests := []struct {
+		name      string
+		webhook   types.Webhook
+		header    string
+		signature string
+		valid     bool
+	}{
+		{name: "valid", webhook: webhook, signature: sign("s3cret", body), valid: true},
+		{name: "without prefix", webhook: webhook, signature: strings.TrimPrefix(sign("s3cret", body), "sha256="), valid: true},
+		{name: "wrong secret", webhook: webhook, signature: sign("other", body)},
+		{name: "other body", webhook: webhook, signature: sign("s3cret", body+" ")},
+		{name: "missing", webhook: webhook},
+		{name: "not hex", webhook: webhook, signature: "sha256=zz"},
+		{
+			name:      "custom header",
+			webhook:   types.Webhook{Secret: "s3cret", SignatureHeader: "X-Signature"},
+			header:    "X-Signature",
+			signature: sign("s3cret", body),
+			valid:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.signature != "" {
+				name := tt.header
+				if name == "" {
+					name = defaultSignatureHeader
+				}
+				header.Set(name, tt.signature)
+			}
+			if valid := verifySignature(tt.webhook, header, []byte(body)); valid != tt.valid {
+				t.Errorf("expected valid %v, got %v", tt.valid, valid)
+			}
+		})
+	}
+}
+
+func TestServeHTTPRejectsUnsignedPayloads(t *testing.T) {
+	h, err := NewHandler(context.Background(), types.Config{
+		Webhooks: map[string]types.Webhook{
+			"hook": {Agent: "agent1", Secret: "s3cret"},
+		},
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, PathPrefix+"hook", strings.NewReader(`{}`))
+	req.SetPathValue("name", "hook")
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rw.Code)
+	}
+}
@@ -0,0 +1,365 @@
+package wirelog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanobot-ai/nanobot/pkg/complete"
+	"github.com/nanobot-ai/nanobot/pkg/gormdsn"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/middleware"
+	"github.com/nanobot-ai/nanobot/pkg/secrets"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+	"github.com/nanobot-ai/nanobot/pkg/uuid"
+	"gorm.io/gorm"
+)
+
+// pruneInterval is how often entries beyond the retention or the maximum are removed while recording.
+const pruneInterval = 10 * time.Minute
+
+// minRedactedLength is the length of the shortest env value that is redacted, shorter values like "1"
+// or "true" would replace too much of the entries.
+const minRedactedLength = 8
+
+// Entry is a completion of an agent with its full request and response, as JSON.
+type Entry struct {
+	ID         string    `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"created" gorm:"index"`
+	SessionID  string    `json:"sessionID,omitempty" gorm:"index"`
+	TurnID     string    `json:"turnID,omitempty"`
+	Agent      string    `json:"agent,omitempty" gorm:"index"`
+	Model      string    `json:"model,omitempty"`
+	DurationMS int64     `json:"durationMs"`
+	Request    string    `json:"request"`
+	Response   string    `json:"response,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func (Entry) TableName() string {
+	return "wire_log"
+}
+
+type Options struct {
+	// DSN is the database of the wire logs that do not set their own.
+	DSN       string
+	DBOptions gormdsn.Options
+}
+
+func (o Options) Merge(other Options) (result Options) {
+	result.DSN = complete.Last(o.DSN, other.DSN)
+	result.DBOptions = o.DBOptions.Merge(other.DBOptions)
+	return
+}
+
+// Logger records the completions of agents with wireLog in the database of the wire log of their config.
+type Logger struct {
+	opt Options
+
+	lock       sync.Mutex
+	dbs        map[string]*gorm.DB
+	lastPrunes map[string]time.Time
+}
+
+func New(opts ...Options) *Logger {
+	return &Logger{
+		opt:        complete.Complete(opts...),
+		dbs:        map[string]*gorm.DB{},
+		lastPrunes: map[string]time.Time{},
+	}
+}
+
+// Open returns the database of the wire log of the config.
+func (l *Logger) Open(config *types.WireLog) (*gorm.DB, error) {
+	dsn := l.opt.DSN
+	if config != nil && config.DSN != "" {
+		dsn = config.DSN
+	}
+	if dsn == "" {
+		return nil, fmt.Errorf("wire log requires a dsn")
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if db, ok := l.dbs[dsn]; ok {
+		return db, nil
+	}
+	db, err := gormdsn.NewDBFromDSN(dsn, l.opt.DBOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wire log: %w", err)
+	}
+	if err := db.AutoMigrate(&Entry{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate wire log: %w", err)
+	}
+	l.dbs[dsn] = db
+	return db, nil
+}
+
+// Completer returns a completer that records the completions of next for agents with wireLog.
+func (l *Logger) Completer(next types.Completer) types.Completer {
+	return &completer{
+		logger: l,
+		next:   next,
+	}
+}
+
+type completer struct {
+	logger *Logger
+	next   types.Completer
+}
+
+func (c *completer) Complete(ctx context.Context, req types.CompletionRequest, opts ...types.CompletionOptions) (*types.CompletionResponse, error) {
+	config := types.ConfigFromContext(ctx)
+	if !config.Agents[req.Agent].WireLog {
+		return c.next.Complete(ctx, req, opts...)
+	}
+
+	start := time.Now()
+	resp, err := c.next.Complete(ctx, req, opts...)
+	if recordErr := c.logger.record(ctx, config.WireLog, start, req, resp, err); recordErr != nil {
+		log.Errorf(ctx, "failed to record completion of agent %s in the wire log: %v", req.Agent, recordErr)
+	}
+	return resp, err
+}
+
+func (l *Logger) record(ctx context.Context, config *types.WireLog, start time.Time, req types.CompletionRequest, resp *types.CompletionResponse, completionErr error) error {
+	redact, err := redactor(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	session := mcp.SessionFromContext(ctx).Root()
+
+	entry := Entry{
+		ID:         uuid.String(),
+		CreatedAt:  start.UTC(),
+		SessionID:  session.ID(),
+		Agent:      req.Agent,
+		Model:      req.Model,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	for _, attr := range log.Attrs(ctx) {
+		if attr.Key == "turn_id" {
+			entry.TurnID = attr.Value.String()
+		}
+	}
+
+	entry.Request, err = redactJSON(req, redact)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	if resp != nil {
+		entry.Model = complete.First(resp.Model, entry.Model)
+		entry.Response, err = redactJSON(resp, redact)
+		if err != nil {
+			return fmt.Errorf("failed to marshal response: %w", err)
+		}
+	}
+	if completionErr != nil {
+		entry.Error = redact(completionErr.Error())
+	}
+
+	db, err := l.Open(config)
+	if err != nil {
+		return err
+	}
+	if err := db.WithContext(ctx).Create(&entry).Error; err != nil {
+		return err
+	}
+	return l.prune(ctx, db, config)
+}
+
+// prune removes the entries older than the retention and the oldest entries beyond the maximum number of
+// entries, at most once per pruneInterval for each database.
+func (l *Logger) prune(ctx context.Context, db *gorm.DB, config *types.WireLog) error {
+	if config == nil || config.GetRetention() <= 0 && config.MaxEntries <= 0 {
+		return nil
+	}
+
+	dsn := complete.First(config.DSN, l.opt.DSN)
+	l.lock.Lock()
+	if time.Since(l.lastPrunes[dsn]) < pruneInterval {
+		l.lock.Unlock()
+		return nil
+	}
+	l.lastPrunes[dsn] = time.Now()
+	l.lock.Unlock()
+
+	if retention := config.GetRetention(); retention > 0 {
+		if err := db.WithContext(ctx).Where("created_at < ?", time.Now().Add(-retention).UTC()).Delete(&Entry{}).Error; err != nil {
+			return fmt.Errorf("failed to remove entries older than %s: %w", retention, err)
+		}
+	}
+	if config.MaxEntries > 0 {
+		var cutoff Entry
+		err := db.WithContext(ctx).Order("created_at DESC").Offset(config.MaxEntries).Limit(1).Find(&cutoff).Error
+		if err != nil {
+			return fmt.Errorf("failed to find entries beyond %d: %w", config.MaxEntries, err)
+		}
+		if cutoff.ID != "" {
+			if err := db.WithContext(ctx).Where("created_at <= ?", cutoff.CreatedAt).Delete(&Entry{}).Error; err != nil {
+				return fmt.Errorf("failed to remove entries beyond %d: %w", config.MaxEntries, err)
+			}
+		}
+	}
+	return nil
+}
+
+// redactor returns the function that redacts the entries of the session in ctx.
+func redactor(ctx context.Context, config *types.WireLog) (func(string) string, error) {
+	var redactConfig *types.WireLogRedact
+	if config != nil {
+		redactConfig = config.Redact
+	}
+
+	var (
+		detect   []string
+		patterns map[string]string
+		values   = map[string]string{}
+	)
+	if redactConfig != nil {
+		patterns = redactConfig.Patterns
+	}
+	if redactConfig.RedactSecrets() {
+		detect = append(detect, "secrets")
+		for _, value := range secrets.Values() {
+			values[value] = "[REDACTED secret]"
+		}
+	}
+	if redactConfig.RedactEnv() {
+		env := mcp.SessionFromContext(ctx).GetEnvMap()
+		for _, name := range slices.Sorted(maps.Keys(env)) {
+			if _, ok := values[env[name]]; !ok {
+				values[env[name]] = "[REDACTED env " + name + "]"
+			}
+		}
+	}
+
+	redactPatterns, err := middleware.TextRedactor(detect, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Longer values first, so that a value that contains another one is replaced as a whole
+	var replacements []string
+	for _, value := range slices.SortedFunc(maps.Keys(values), func(a, b string) int { return len(b) - len(a) }) {
+		if len(value) < minRedactedLength {
+			continue
+		}
+		replacements = append(replacements, value, values[value])
+	}
+	replacer := strings.NewReplacer(replacements...)
+
+	return func(text string) string {
+		return redactPatterns(replacer.Replace(text))
+	}, nil
+}
+
+// redactJSON returns v as JSON with its string values redacted. The values are redacted before they
+// are encoded, so a replacement never breaks the escaping of the JSON.
+func redactJSON(v any, redact func(string) string) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	var decoded any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return "", err
+	}
+
+	data, err = json.Marshal(redactValues(decoded, redact))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func redactValues(v any, redact func(string) string) any {
+	switch v := v.(type) {
+	case string:
+		return redact(v)
+	case []any:
+		for i := range v {
+			v[i] = redactValues(v[i], redact)
+		}
+	case map[string]any:
+		for key := range v {
+			v[key] = redactValues(v[key], redact)
+		}
+	}
+	return v
+}
+
+// Filter selects the entries of an export, empty fields match all entries.
+type Filter struct {
+	Agent     string
+	SessionID string
+	Since     time.Time
+	Until     time.Time
+}
+
+// Export writes the entries that match the filter as JSONL, oldest first, and returns how many it wrote.
+func Export(ctx context.Context, db *gorm.DB, filter Filter, w io.Writer) (int, error) {
+	query := db.WithContext(ctx).Model(&Entry{}).Order("created_at")
+	if filter.Agent != "" {
+		query = query.Where("agent = ?", filter.Agent)
+	}
+	if filter.SessionID != "" {
+		query = query.Where("session_id = ?", filter.SessionID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until.UTC())
+	}
+
+	var (
+		count   int
+		encoder = json.NewEncoder(w)
+		entries []Entry
+	)
+	err := query.FindInBatches(&entries, 100, func(*gorm.DB, int) error {
+		for _, entry := range entries {
+			if err := encoder.Encode(exported{
+				Entry:    entry,
+				Request:  json.RawMessage(entry.Request),
+				Response: rawOrNull(entry.Response),
+			}); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return count, fmt.Errorf("failed to export wire log: %w", err)
+	}
+	return count, nil
+}
+
+// exported is an entry with its request and response as JSON objects instead of strings.
+type exported struct {
+	Entry
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+func rawOrNull(data string) json.RawMessage {
+	if data == "" {
+		return nil
+	}
+	return json.RawMessage(data)
+}
@@ -0,0 +1,58 @@
+package wirelog
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+func TestRedactJSON(t *testing.T) {
+	session := mcp.NewEmptySession(context.Background())
+	session.Set(mcp.SessionEnvMapKey, map[string]string{
+		"PASSWORD": `pa"ss\word`,
+		"SHORT":    "1",
+	})
+	ctx := mcp.WithSession(context.Background(), session)
+
+	redact, err := redactor(ctx, &types.WireLog{
+		Redact: &types.WireLogRedact{
+			Patterns: map[string]string{"ticket": `TICKET-\d+`},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{name: "env with quotes", value: `the password is pa"ss\word`, expected: "the password is [REDACTED env PASSWORD]"},
+		{name: "short env", value: "1 item", expected: "1 item"},
+		{name: "pattern", value: "see TICKET-42", expected: "see [REDACTED ticket]"},
+		{name: "pattern across the escaping", value: `"TICKET-7"`, expected: `"[REDACTED ticket]"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := redactJSON(types.CompletionRequest{
+				Model: "model",
+				Input: []types.Message{{Role: "user", Items: []types.CompletionItem{{Content: &mcp.Content{Type: "text", Text: tt.value}}}}},
+			}, redact)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var req types.CompletionRequest
+			if err := json.Unmarshal([]byte(data), &req); err != nil {
+				t.Fatalf("expected valid JSON, got %v: %s", err, data)
+			}
+			if text := req.Input[0].Items[0].Content.Text; text != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, text)
+			}
+		})
+	}
+}
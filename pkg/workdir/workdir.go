@@ -0,0 +1,152 @@
+package workdir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+	"github.com/nanobot-ai/nanobot/pkg/log"
+	"github.com/nanobot-ai/nanobot/pkg/mcp"
+	"github.com/nanobot-ai/nanobot/pkg/types"
+)
+
+const (
+	// EnvVar is the environment variable stdio MCP servers find the working directory of the session in.
+	EnvVar = "NANOBOT_WORKDIR"
+	// RootName is the name of the root the working directory is exposed as.
+	RootName = "workdir"
+
+	sessionKey = "workdir/path"
+)
+
+var invalidChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// setupLock serializes creating the directory of a session and registering its cleanup.
+var setupLock sync.Mutex
+
+// QuotaExceededError is returned when the working directory of a session is larger than its quota.
+type QuotaExceededError struct {
+	Used  uint64
+	Quota uint64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("the session working directory uses %s of its %s quota, remove files before calling more tools",
+		humanize.Bytes(e.Used), humanize.Bytes(e.Quota))
+}
+
+func baseDir(config *types.Workdir) string {
+	if config.Dir != "" {
+		return config.Dir
+	}
+	return filepath.Join(os.TempDir(), "nanobot-sessions")
+}
+
+// ValidID returns whether the session ID is used as is as the name of its working directory, IDs that
+// are changed by Path or name the base directory or its parent are not.
+func ValidID(sessionID string) bool {
+	return sessionID != "" && sessionID != "." && sessionID != ".." && !invalidChars.MatchString(sessionID)
+}
+
+// Path returns the working directory of the session with the given ID.
+func Path(config *types.Workdir, sessionID string) string {
+	return filepath.Join(baseDir(config), invalidChars.ReplaceAllString(sessionID, "_"))
+}
+
+// Ensure creates the working directory of the root session if it does not exist and returns its path.
+// The directory is removed when the session is deleted.
+func Ensure(ctx context.Context, config *types.Workdir, session *mcp.Session) (string, error) {
+	session = session.Root()
+
+	setupLock.Lock()
+	defer setupLock.Unlock()
+
+	var dir string
+	if session.Get(sessionKey, &dir) && dir != "" {
+		return dir, nil
+	}
+
+	dir = Path(config, session.ID())
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create session working directory: %w", err)
+	}
+
+	session.Set(sessionKey, dir)
+	session.OnClose(func(deleted bool) {
+		if !deleted {
+			return
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Errorf(ctx, "failed to remove session working directory %s: %v", dir, err)
+		}
+	})
+	return dir, nil
+}
+
+// Remove deletes the working directory of the session with the given ID.
+func Remove(config *types.Workdir, sessionID string) error {
+	if config == nil || sessionID == "" {
+		return nil
+	}
+	if err := os.RemoveAll(Path(config, sessionID)); err != nil {
+		return fmt.Errorf("failed to remove session working directory: %w", err)
+	}
+	return nil
+}
+
+// Usage returns the total size of the files in dir.
+func Usage(dir string) (uint64, error) {
+	var size uint64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		size += uint64(info.Size())
+		return nil
+	})
+	return size, err
+}
+
+// CheckQuota returns a QuotaExceededError if the working directory of the session is over its quota.
+func CheckQuota(config *types.Workdir, session *mcp.Session) error {
+	quota, err := config.GetQuota()
+	if err != nil || quota == 0 || session == nil {
+		return err
+	}
+
+	session = session.Root()
+
+	var dir string
+	if !session.Get(sessionKey, &dir) || dir == "" {
+		return nil
+	}
+
+	used, err := Usage(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check session working directory size: %w", err)
+	}
+	if used > quota {
+		return &QuotaExceededError{
+			Used:  used,
+			Quota: quota,
+		}
+	}
+	return nil
+}